@@ -23,9 +23,20 @@ type BleVisitorConfig struct {
 	DataConvert        DataConvert       `json:"dataConverter"`
 }
 
+// DataConvert describes how the characteristic value is decoded and encoded.
 type DataConvert struct {
-	StartIndex        int                 `json:"startIndex"`
-	EndIndex          int                 `json:"endIndex"`
+	StartIndex int `json:"startIndex"`
+	EndIndex   int `json:"endIndex"`
+	// Type is the data type of the value starting at StartIndex: uint8, int8, uint16, int16,
+	// uint32, int32, uint64, int64, float32, float64, medfloat16, medfloat32 or string.
+	// medfloat16 and medfloat32 are the IEEE-11073 SFLOAT and FLOAT types of the Bluetooth GATT
+	// specification, float is not accepted as it could mean either float32 or medfloat32.
+	// If empty, the bytes from StartIndex to EndIndex are read as big endian unsigned integer.
+	Type string `json:"type,omitempty"`
+	// ByteOrder is LittleEndian or BigEndian, the default is LittleEndian as in the GATT specification.
+	ByteOrder string `json:"byteOrder,omitempty"`
+	// Mask is applied to integer values before shifting.
+	Mask              uint64              `json:"mask,omitempty"`
 	ShiftLeft         uint                `json:"shiftLeft"`
 	ShiftRight        uint                `json:"shiftRight"`
 	OrderOfOperations []OrderOfOperations `json:"orderOfOperations"`
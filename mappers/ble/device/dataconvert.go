@@ -0,0 +1,459 @@
+/*
+Copyright 2021 The KubeEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package device
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/kubeedge/kubeedge/pkg/apis/devices/v1alpha2"
+
+	"github.com/kubeedge/mappers-go/mappers/ble/configmap"
+)
+
+// Data types of the data converter.
+const (
+	TypeUint8      = "uint8"
+	TypeInt8       = "int8"
+	TypeUint16     = "uint16"
+	TypeInt16      = "int16"
+	TypeUint32     = "uint32"
+	TypeInt32      = "int32"
+	TypeUint64     = "uint64"
+	TypeInt64      = "int64"
+	TypeFloat32    = "float32"
+	TypeFloat64    = "float64"
+	TypeMedFloat16 = "medfloat16"
+	TypeMedFloat32 = "medfloat32"
+	TypeString     = "string"
+)
+
+// ErrShortData error of a value shorter than the data type.
+var ErrShortData = errors.New("Data is too short")
+
+// Special values of the IEEE-11073 SFLOAT and FLOAT types.
+const (
+	medFloat16NaN      = 0x07FF
+	medFloat16NRes     = 0x0800
+	medFloat16PosInf   = 0x07FE
+	medFloat16NegInf   = 0x0802
+	medFloat16Reserved = 0x0801
+	medFloat16MaxMant  = 0x07FD
+	medFloat32NaN      = 0x007FFFFF
+	medFloat32NRes     = 0x00800000
+	medFloat32PosInf   = 0x007FFFFE
+	medFloat32NegInf   = 0x00800002
+	medFloat32Reserved = 0x00800001
+	medFloat32MaxMant  = 0x007FFFFD
+	medFloat16MinExp   = -8
+	medFloat16MaxExp   = 7
+	medFloat32MinExp   = -128
+	medFloat32MaxExp   = 127
+	legacyMaxLength    = 8
+)
+
+type intType struct {
+	size   int
+	signed bool
+}
+
+var intTypes = map[string]intType{
+	TypeUint8:  {1, false},
+	TypeInt8:   {1, true},
+	TypeUint16: {2, false},
+	TypeInt16:  {2, true},
+	TypeUint32: {4, false},
+	TypeInt32:  {4, true},
+	TypeUint64: {8, false},
+	TypeInt64:  {8, true},
+}
+
+func byteOrder(dc configmap.DataConvert) binary.ByteOrder {
+	if strings.EqualFold(dc.ByteOrder, "BigEndian") {
+		return binary.BigEndian
+	}
+	return binary.LittleEndian
+}
+
+// readUint reads an unsigned integer of size bytes.
+func readUint(order binary.ByteOrder, b []byte) uint64 {
+	var buf [8]byte
+	if order == binary.BigEndian {
+		copy(buf[8-len(b):], b)
+		return binary.BigEndian.Uint64(buf[:])
+	}
+	copy(buf[:], b)
+	return binary.LittleEndian.Uint64(buf[:])
+}
+
+// putUint writes the lower size bytes of an unsigned integer.
+func putUint(order binary.ByteOrder, v uint64, size int) []byte {
+	var buf [8]byte
+	if order == binary.BigEndian {
+		binary.BigEndian.PutUint64(buf[:], v)
+		return buf[8-size:]
+	}
+	binary.LittleEndian.PutUint64(buf[:], v)
+	return buf[:size]
+}
+
+// field returns size bytes of the data starting at the start index.
+func field(dc configmap.DataConvert, data []byte, size int) ([]byte, error) {
+	if dc.StartIndex < 0 || dc.StartIndex+size > len(data) {
+		return nil, fmt.Errorf("%w: %d bytes at index %d, got %d bytes", ErrShortData, size, dc.StartIndex, len(data))
+	}
+	return data[dc.StartIndex : dc.StartIndex+size], nil
+}
+
+// legacyValue concatenates the bytes from the start index to the end index,
+// the bytes are read in reverse order if the start index is greater.
+func legacyValue(dc configmap.DataConvert, data []byte) (uint64, error) {
+	first, last := dc.StartIndex, dc.EndIndex
+	if first > last {
+		first, last = last, first
+	}
+	if first < 0 || last >= len(data) {
+		return 0, fmt.Errorf("%w: index %d to %d, got %d bytes", ErrShortData, dc.StartIndex, dc.EndIndex, len(data))
+	}
+	if last-first+1 > legacyMaxLength {
+		return 0, fmt.Errorf("index %d to %d exceeds %d bytes", dc.StartIndex, dc.EndIndex, legacyMaxLength)
+	}
+	var v uint64
+	if dc.StartIndex <= dc.EndIndex {
+		for i := first; i <= last; i++ {
+			v = v<<8 | uint64(data[i])
+		}
+	} else {
+		for i := last; i >= first; i-- {
+			v = v<<8 | uint64(data[i])
+		}
+	}
+	return v, nil
+}
+
+// mask applies the mask of the data converter to the raw value.
+func mask(dc configmap.DataConvert, v uint64) uint64 {
+	if dc.Mask != 0 {
+		v &= dc.Mask
+	}
+	return v
+}
+
+// shift applies the shift of the data converter, signed values are shifted arithmetically.
+func shift(dc configmap.DataConvert, v uint64, signed bool) uint64 {
+	switch {
+	case dc.ShiftLeft != 0:
+		return v << dc.ShiftLeft
+	case dc.ShiftRight != 0 && signed:
+		return uint64(int64(v) >> dc.ShiftRight)
+	case dc.ShiftRight != 0:
+		return v >> dc.ShiftRight
+	}
+	return v
+}
+
+// unshift reverts the shift of the data converter.
+func unshift(dc configmap.DataConvert, v uint64) uint64 {
+	switch {
+	case dc.ShiftLeft != 0:
+		v >>= dc.ShiftLeft
+	case dc.ShiftRight != 0:
+		v <<= dc.ShiftRight
+	}
+	if dc.Mask != 0 {
+		v &= dc.Mask
+	}
+	return v
+}
+
+// signExtend interprets the lower size bytes as a two's complement integer.
+func signExtend(v uint64, size int) int64 {
+	bits := uint(64 - size*8)
+	return int64(v<<bits) >> bits
+}
+
+// decodeMedFloat16 decodes a 16 bit IEEE-11073 SFLOAT.
+func decodeMedFloat16(v uint16) float64 {
+	switch v {
+	case medFloat16NaN, medFloat16NRes, medFloat16Reserved:
+		return math.NaN()
+	case medFloat16PosInf:
+		return math.Inf(1)
+	case medFloat16NegInf:
+		return math.Inf(-1)
+	}
+	mantissa := int64(int16(v<<4) >> 4)
+	exponent := int(int8(v>>8) >> 4)
+	return float64(mantissa) * math.Pow10(exponent)
+}
+
+// decodeMedFloat32 decodes a 32 bit IEEE-11073 FLOAT.
+func decodeMedFloat32(v uint32) float64 {
+	switch v {
+	case medFloat32NaN, medFloat32NRes, medFloat32Reserved:
+		return math.NaN()
+	case medFloat32PosInf:
+		return math.Inf(1)
+	case medFloat32NegInf:
+		return math.Inf(-1)
+	}
+	mantissa := int64(int32(v<<8) >> 8)
+	exponent := int(int8(v >> 24))
+	return float64(mantissa) * math.Pow10(exponent)
+}
+
+// encodeMedical finds the smallest exponent, i.e. the highest precision, whose mantissa fits.
+// Trailing zeros of the mantissa are removed, so that 36.6 is encoded as 366e-1.
+func encodeMedical(f float64, minExp int, maxExp int, maxMant int64) (int64, int, error) {
+	for exp := minExp; exp <= maxExp; exp++ {
+		mantissa := math.Round(f / math.Pow10(exp))
+		if math.Abs(mantissa) > float64(maxMant) {
+			continue
+		}
+		m := int64(mantissa)
+		for m != 0 && m%10 == 0 && exp < maxExp {
+			m /= 10
+			exp++
+		}
+		if m == 0 {
+			exp = 0
+		}
+		return m, exp, nil
+	}
+	return 0, 0, fmt.Errorf("value %v out of range", f)
+}
+
+func encodeMedFloat16(f float64) (uint16, error) {
+	switch {
+	case math.IsNaN(f):
+		return medFloat16NaN, nil
+	case math.IsInf(f, 1):
+		return medFloat16PosInf, nil
+	case math.IsInf(f, -1):
+		return medFloat16NegInf, nil
+	}
+	mantissa, exp, err := encodeMedical(f, medFloat16MinExp, medFloat16MaxExp, medFloat16MaxMant)
+	if err != nil {
+		return 0, err
+	}
+	return uint16(exp)<<12 | uint16(mantissa)&0x0FFF, nil
+}
+
+func encodeMedFloat32(f float64) (uint32, error) {
+	switch {
+	case math.IsNaN(f):
+		return medFloat32NaN, nil
+	case math.IsInf(f, 1):
+		return medFloat32PosInf, nil
+	case math.IsInf(f, -1):
+		return medFloat32NegInf, nil
+	}
+	mantissa, exp, err := encodeMedical(f, medFloat32MinExp, medFloat32MaxExp, medFloat32MaxMant)
+	if err != nil {
+		return 0, err
+	}
+	return uint32(exp)<<24 | uint32(mantissa)&0x00FFFFFF, nil
+}
+
+// operate applies the order of operations to the value.
+func operate(dc configmap.DataConvert, v float64) float64 {
+	for _, op := range dc.OrderOfOperations {
+		switch strings.ToUpper(op.OperationType) {
+		case strings.ToUpper(string(v1alpha2.BluetoothAdd)):
+			v += op.OperationValue
+		case strings.ToUpper(string(v1alpha2.BluetoothSubtract)):
+			v -= op.OperationValue
+		case strings.ToUpper(string(v1alpha2.BluetoothMultiply)):
+			v *= op.OperationValue
+		case strings.ToUpper(string(v1alpha2.BluetoothDivide)):
+			v /= op.OperationValue
+		}
+	}
+	return v
+}
+
+// revert applies the inverse of the order of operations in reverse order.
+func revert(dc configmap.DataConvert, v float64) float64 {
+	for i := len(dc.OrderOfOperations) - 1; i >= 0; i-- {
+		op := dc.OrderOfOperations[i]
+		switch strings.ToUpper(op.OperationType) {
+		case strings.ToUpper(string(v1alpha2.BluetoothAdd)):
+			v -= op.OperationValue
+		case strings.ToUpper(string(v1alpha2.BluetoothSubtract)):
+			v += op.OperationValue
+		case strings.ToUpper(string(v1alpha2.BluetoothMultiply)):
+			v /= op.OperationValue
+		case strings.ToUpper(string(v1alpha2.BluetoothDivide)):
+			v *= op.OperationValue
+		}
+	}
+	return v
+}
+
+// formatNumber formats integers without operations exactly, other values as float.
+func formatNumber(dc configmap.DataConvert, v uint64, signed bool) string {
+	if len(dc.OrderOfOperations) == 0 {
+		if signed {
+			return strconv.FormatInt(int64(v), 10)
+		}
+		return strconv.FormatUint(v, 10)
+	}
+	f := float64(v)
+	if signed {
+		f = float64(int64(v))
+	}
+	return strconv.FormatFloat(operate(dc, f), 'f', -1, 64)
+}
+
+// Decode converts the characteristic value to the property value.
+func Decode(dc configmap.DataConvert, data []byte) (string, error) {
+	order := byteOrder(dc)
+	switch dc.Type {
+	case "":
+		v, err := legacyValue(dc, data)
+		if err != nil {
+			return "", err
+		}
+		return formatNumber(dc, shift(dc, mask(dc, v), false), false), nil
+	case TypeFloat32:
+		b, err := field(dc, data, 4)
+		if err != nil {
+			return "", err
+		}
+		f := float64(math.Float32frombits(uint32(readUint(order, b))))
+		return strconv.FormatFloat(operate(dc, f), 'f', -1, 32), nil
+	case TypeFloat64:
+		b, err := field(dc, data, 8)
+		if err != nil {
+			return "", err
+		}
+		f := math.Float64frombits(readUint(order, b))
+		return strconv.FormatFloat(operate(dc, f), 'f', -1, 64), nil
+	case TypeMedFloat16:
+		b, err := field(dc, data, 2)
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatFloat(operate(dc, decodeMedFloat16(uint16(readUint(order, b)))), 'f', -1, 64), nil
+	case TypeMedFloat32:
+		b, err := field(dc, data, 4)
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatFloat(operate(dc, decodeMedFloat32(uint32(readUint(order, b)))), 'f', -1, 64), nil
+	case TypeString:
+		b := data
+		if dc.StartIndex < 0 || dc.StartIndex > len(data) {
+			return "", fmt.Errorf("%w: index %d, got %d bytes", ErrShortData, dc.StartIndex, len(data))
+		}
+		if dc.EndIndex > dc.StartIndex {
+			if dc.EndIndex >= len(data) {
+				return "", fmt.Errorf("%w: index %d, got %d bytes", ErrShortData, dc.EndIndex, len(data))
+			}
+			b = data[dc.StartIndex : dc.EndIndex+1]
+		} else {
+			b = data[dc.StartIndex:]
+		}
+		b = []byte(strings.TrimRight(string(b), "\x00"))
+		if !utf8.Valid(b) {
+			return "", errors.New("invalid UTF-8 string")
+		}
+		return string(b), nil
+	}
+
+	t, ok := intTypes[dc.Type]
+	if !ok {
+		return "", fmt.Errorf("unsupported data type %s", dc.Type)
+	}
+	b, err := field(dc, data, t.size)
+	if err != nil {
+		return "", err
+	}
+	// The mask selects the bits of the raw value, the sign is the highest bit of the type.
+	v := mask(dc, readUint(order, b))
+	if t.signed {
+		v = uint64(signExtend(v, t.size))
+	}
+	return formatNumber(dc, shift(dc, v, t.signed), t.signed), nil
+}
+
+// Encode converts the property value to the characteristic value.
+func Encode(dc configmap.DataConvert, value string) ([]byte, error) {
+	order := byteOrder(dc)
+	switch dc.Type {
+	case "":
+		return []byte(value), nil
+	case TypeString:
+		return []byte(value), nil
+	}
+
+	f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		// Booleans are written as 1 and 0.
+		b, errBool := strconv.ParseBool(value)
+		if errBool != nil {
+			return nil, fmt.Errorf("invalid number %s: %v", value, err)
+		}
+		if f = 0; b {
+			f = 1
+		}
+	}
+	f = revert(dc, f)
+	switch dc.Type {
+	case TypeFloat32:
+		return putUint(order, uint64(math.Float32bits(float32(f))), 4), nil
+	case TypeFloat64:
+		return putUint(order, math.Float64bits(f), 8), nil
+	case TypeMedFloat16:
+		v, err := encodeMedFloat16(f)
+		if err != nil {
+			return nil, err
+		}
+		return putUint(order, uint64(v), 2), nil
+	case TypeMedFloat32:
+		v, err := encodeMedFloat32(f)
+		if err != nil {
+			return nil, err
+		}
+		return putUint(order, uint64(v), 4), nil
+	}
+
+	t, ok := intTypes[dc.Type]
+	if !ok {
+		return nil, fmt.Errorf("unsupported data type %s", dc.Type)
+	}
+	f = math.Round(f)
+	bits := t.size * 8
+	var v uint64
+	if t.signed {
+		if f < -math.Ldexp(1, bits-1) || f >= math.Ldexp(1, bits-1) {
+			return nil, fmt.Errorf("value %s out of range of %s", value, dc.Type)
+		}
+		v = uint64(int64(f))
+	} else {
+		if f < 0 || f >= math.Ldexp(1, bits) {
+			return nil, fmt.Errorf("value %s out of range of %s", value, dc.Type)
+		}
+		v = uint64(f)
+	}
+	return putUint(order, unshift(dc, v), t.size), nil
+}
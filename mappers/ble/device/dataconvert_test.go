@@ -0,0 +1,133 @@
+/*
+Copyright 2021 The KubeEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package device
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kubeedge/mappers-go/mappers/ble/configmap"
+)
+
+func TestDecode(t *testing.T) {
+	divide100 := []configmap.OrderOfOperations{{OperationType: "Divide", OperationValue: 100}}
+	tests := []struct {
+		name string
+		dc   configmap.DataConvert
+		data []byte
+		want string
+	}{
+		{"legacy", configmap.DataConvert{StartIndex: 0, EndIndex: 1}, []byte{0x01, 0x02}, "258"},
+		{"legacy reversed", configmap.DataConvert{StartIndex: 1, EndIndex: 0}, []byte{0x01, 0x02}, "513"},
+		{"uint8", configmap.DataConvert{StartIndex: 2, Type: TypeUint8}, []byte{0, 0, 0xFF}, "255"},
+		{"int8", configmap.DataConvert{Type: TypeInt8}, []byte{0xFE}, "-2"},
+		{"int16 little endian", configmap.DataConvert{Type: TypeInt16, OrderOfOperations: divide100},
+			[]byte{0x2A, 0x09}, "23.46"},
+		{"uint16 big endian", configmap.DataConvert{Type: TypeUint16, ByteOrder: "BigEndian"}, []byte{0x01, 0x02}, "258"},
+		{"int32", configmap.DataConvert{StartIndex: 1, Type: TypeInt32}, []byte{0, 0xFF, 0xFF, 0xFF, 0xFF}, "-1"},
+		{"uint64", configmap.DataConvert{Type: TypeUint64}, []byte{1, 0, 0, 0, 0, 0, 0, 0x80}, "9223372036854775809"},
+		{"mask and shift", configmap.DataConvert{Type: TypeUint8, Mask: 0xF0, ShiftRight: 4}, []byte{0xAB}, "10"},
+		// the upper nibble 0xA is -6, the lower bits don't change the sign
+		{"signed mask and shift", configmap.DataConvert{Type: TypeInt8, Mask: 0xF0, ShiftRight: 4}, []byte{0xAB}, "-6"},
+		{"signed mask", configmap.DataConvert{Type: TypeInt16, Mask: 0x0FFF}, []byte{0xFF, 0xFF}, "4095"},
+		{"signed mask keeps sign", configmap.DataConvert{Type: TypeInt16, Mask: 0xFFF0, ShiftRight: 4},
+			[]byte{0xF0, 0xFF}, "-1"},
+		{"float32", configmap.DataConvert{Type: TypeFloat32}, []byte{0x00, 0x00, 0xC0, 0x3F}, "1.5"},
+		{"float64 big endian", configmap.DataConvert{Type: TypeFloat64, ByteOrder: "BigEndian"},
+			[]byte{0x40, 0x09, 0x21, 0xFB, 0x54, 0x44, 0x2D, 0x18}, "3.141592653589793"},
+		// 0xF16E: exponent -1, mantissa 366
+		{"sfloat", configmap.DataConvert{Type: TypeMedFloat16}, []byte{0x6E, 0xF1}, "36.6"},
+		{"sfloat negative mantissa", configmap.DataConvert{Type: TypeMedFloat16}, []byte{0xFF, 0x0F}, "-1"},
+		{"sfloat NaN", configmap.DataConvert{Type: TypeMedFloat16}, []byte{0xFF, 0x07}, "NaN"},
+		// exponent -2, mantissa 3646
+		{"float", configmap.DataConvert{Type: TypeMedFloat32}, []byte{0x3E, 0x0E, 0x00, 0xFE}, "36.46"},
+		{"string", configmap.DataConvert{StartIndex: 1, Type: TypeString}, []byte("xhello\x00\x00"), "hello"},
+		{"string range", configmap.DataConvert{StartIndex: 1, EndIndex: 3, Type: TypeString}, []byte("héllo"), "él"},
+	}
+	for _, tt := range tests {
+		got, err := Decode(tt.dc, tt.data)
+		assert.Nil(t, err, tt.name)
+		assert.Equal(t, tt.want, got, tt.name)
+	}
+
+	_, err := Decode(configmap.DataConvert{StartIndex: 1, Type: TypeUint16}, []byte{1, 2})
+	assert.ErrorIs(t, err, ErrShortData)
+	_, err = Decode(configmap.DataConvert{StartIndex: 0, EndIndex: 3}, []byte{1, 2})
+	assert.ErrorIs(t, err, ErrShortData)
+	_, err = Decode(configmap.DataConvert{EndIndex: 1, Type: TypeString}, []byte("h\xc3"))
+	assert.NotNil(t, err)
+	_, err = Decode(configmap.DataConvert{Type: "uint128"}, []byte{1, 2})
+	assert.NotNil(t, err)
+	// The medical float types must be named, float could as well be float32.
+	_, err = Decode(configmap.DataConvert{Type: "float"}, []byte{0x00, 0x00, 0xC0, 0x3F})
+	assert.NotNil(t, err)
+	_, err = Decode(configmap.DataConvert{Type: "sfloat"}, []byte{0x6E, 0xF1})
+	assert.NotNil(t, err)
+}
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		dc    configmap.DataConvert
+		value string
+		want  []byte
+	}{
+		{configmap.DataConvert{Type: TypeUint8}, "255", []byte{0xFF}},
+		{configmap.DataConvert{Type: TypeUint8}, "true", []byte{0x01}},
+		{configmap.DataConvert{Type: TypeInt16,
+			OrderOfOperations: []configmap.OrderOfOperations{{OperationType: "Divide", OperationValue: 100}}},
+			"23.46", []byte{0x2A, 0x09}},
+		{configmap.DataConvert{Type: TypeUint16, ByteOrder: "BigEndian"}, "258", []byte{0x01, 0x02}},
+		{configmap.DataConvert{Type: TypeInt32}, "-1", []byte{0xFF, 0xFF, 0xFF, 0xFF}},
+		{configmap.DataConvert{Type: TypeUint8, Mask: 0xF0, ShiftRight: 4}, "10", []byte{0xA0}},
+		{configmap.DataConvert{Type: TypeInt8, Mask: 0xF0, ShiftRight: 4}, "-6", []byte{0xA0}},
+		{configmap.DataConvert{Type: TypeFloat32}, "1.5", []byte{0x00, 0x00, 0xC0, 0x3F}},
+		{configmap.DataConvert{Type: TypeMedFloat16}, "36.6", []byte{0x6E, 0xF1}},
+		{configmap.DataConvert{Type: TypeMedFloat32}, "36.46", []byte{0x3E, 0x0E, 0x00, 0xFE}},
+		{configmap.DataConvert{Type: TypeString}, "on", []byte("on")},
+		{configmap.DataConvert{}, "on", []byte("on")},
+	}
+	for _, tt := range tests {
+		got, err := Encode(tt.dc, tt.value)
+		assert.Nil(t, err, tt.value)
+		assert.Equal(t, tt.want, got, tt.value)
+	}
+
+	_, err := Encode(configmap.DataConvert{Type: TypeUint8}, "256")
+	assert.NotNil(t, err)
+	_, err = Encode(configmap.DataConvert{Type: TypeInt8}, "-129")
+	assert.NotNil(t, err)
+	_, err = Encode(configmap.DataConvert{Type: TypeInt16}, "abc")
+	assert.NotNil(t, err)
+	_, err = Encode(configmap.DataConvert{Type: TypeMedFloat16}, "1e20")
+	assert.NotNil(t, err)
+	_, err = Encode(configmap.DataConvert{Type: "float"}, "1.5")
+	assert.NotNil(t, err)
+}
+
+func TestMedicalFloatRoundTrip(t *testing.T) {
+	for _, f := range []float64{0, 1, -1, 0.001, 2045, -2045e3, math.Inf(1)} {
+		v, err := encodeMedFloat16(f)
+		assert.Nil(t, err)
+		assert.InDelta(t, f, decodeMedFloat16(v), math.Abs(f)*1e-3, f)
+	}
+	assert.True(t, math.IsNaN(decodeMedFloat32(medFloat32NaN)))
+	v, err := encodeMedFloat32(123456.78)
+	assert.Nil(t, err)
+	assert.InDelta(t, 123456.8, decodeMedFloat32(v), 1e-9)
+}
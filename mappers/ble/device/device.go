@@ -39,6 +39,9 @@ var models map[string]common.DeviceModel
 var protocols map[string]common.Protocol
 var wg sync.WaitGroup
 
+// dial connects to the peripherals, the go-ble HCI device is used if nil.
+var dial driver.Dialer
+
 // setVisitor check if visitor property is readonly, if not then set it.
 func setVisitor(visitorConfig *configmap.BleVisitorConfig, twin *common.Twin, bleClient *driver.BleClient) {
 	if twin.PVisitor.PProperty.AccessMode == "ReadOnly" {
@@ -53,8 +56,15 @@ func setVisitor(visitorConfig *configmap.BleVisitorConfig, twin *common.Twin, bl
 		return
 	}
 
-	valueString, _ := value.(string)
-	err = bleClient.Set(ble.MustParse(visitorConfig.CharacteristicUUID), []byte(valueString))
+	valueString := fmt.Sprint(value)
+	data, ok := visitorConfig.DataWrite[valueString]
+	if !ok {
+		if data, err = Encode(visitorConfig.DataConvert, valueString); err != nil {
+			klog.Errorf("Encode error: %v", err)
+			return
+		}
+	}
+	err = bleClient.Set(ble.MustParse(visitorConfig.CharacteristicUUID), data)
 	if err != nil {
 		klog.Errorf("Set visitor error: %v %v", err, visitorConfig)
 		return
@@ -121,12 +131,48 @@ func initBle(protocolConfig configmap.BleProtocolConfig, name string) (client dr
 	if protocolConfig.MacAddress != "" {
 		config := driver.BleConfig{
 			Addr: protocolConfig.MacAddress,
+			Dial: dial,
 		}
 		client, err = driver.NewClient(config)
 	}
 	return
 }
 
+// startCollect subscribes to the notifications of the characteristic, or starts
+// a timer to read it if it does not support notifications.
+func startCollect(twinData *TwinData, collectCycle time.Duration) {
+	// If the collect cycle is not set, set it to 1 second.
+	if collectCycle == 0 {
+		collectCycle = 1 * time.Second
+	}
+	uuid, err := ble.Parse(twinData.BleVisitorConfig.CharacteristicUUID)
+	if err != nil {
+		klog.Errorf("Invalid characteristic uuid %s: %v", twinData.BleVisitorConfig.CharacteristicUUID, err)
+		return
+	}
+	c, err := twinData.BleClient.Find(uuid)
+	if err != nil {
+		klog.Errorf("can't find uuid %s: %v", uuid.String(), err)
+		return
+	}
+	twinData.FindedCharacteristic = c
+	// If this Characteristic supports notifications and there's a CCCD
+	// Then subscribe to it, the notifications operation is different from reading operation, notifications will keep looping when connected
+	// so we can't use timer.Start() for notifications
+	if (c.Property&ble.CharNotify) != 0 && c.CCCD != nil {
+		if err := twinData.BleClient.Subscribe(c, twinData.notificationHandler()); err != nil {
+			klog.Errorf("Subscribe error: %v", err)
+		}
+	} else if (c.Property & ble.CharRead) != 0 { // read data actively
+		timer := mappercommon.Timer{Function: twinData.Run, Duration: collectCycle, Times: 0}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			timer.Start()
+		}()
+	}
+}
+
 // initTwin initialize the timer to get twin value.
 func initTwin(dev *globals.BleDev) {
 	for i := 0; i < len(dev.Instance.Twins); i++ {
@@ -143,38 +189,7 @@ func initTwin(dev *globals.BleDev) {
 			Type:             dev.Instance.Twins[i].Desired.Metadatas.Type,
 			BleVisitorConfig: visitorConfig,
 			Topic:            fmt.Sprintf(mappercommon.TopicTwinUpdate, dev.Instance.ID)}
-		collectCycle := time.Duration(dev.Instance.Twins[i].PVisitor.CollectCycle)
-		// If the collect cycle is not set, set it to 1 second.
-		if collectCycle == 0 {
-			collectCycle = 1 * time.Second
-		}
-		uuid := ble.MustParse(twinData.BleVisitorConfig.CharacteristicUUID)
-		if p, err := twinData.BleClient.Client.DiscoverProfile(true); err == nil {
-			if twinData.FindedCharacteristic = p.Find(ble.NewCharacteristic(uuid)); twinData.FindedCharacteristic == nil {
-				klog.Errorf("can't find uuid %s", uuid.String())
-				continue
-			}
-			c := twinData.FindedCharacteristic.(*ble.Characteristic)
-			// If this Characteristic supports notifications and there's a CCCD
-			// Then subscribe to it, the notifications operation is different from reading operation, notifications will keep looping when connected
-			// so we can't use timer.Start() for notifications
-			if (c.Property&ble.CharNotify) != 0 && c.CCCD != nil {
-				wg.Add(1)
-				go func() {
-					if err := twinData.BleClient.Client.Subscribe(c, false, twinData.notificationHandler()); err != nil {
-						klog.Errorf("Subscribe error: %v", err)
-						wg.Done()
-					}
-				}()
-			} else if (c.Property & ble.CharRead) != 0 { // // read data actively
-				timer := mappercommon.Timer{Function: twinData.Run, Duration: collectCycle, Times: 0}
-				wg.Add(1)
-				go func() {
-					defer wg.Done()
-					timer.Start()
-				}()
-			}
-		}
+		startCollect(&twinData, time.Duration(dev.Instance.Twins[i].PVisitor.CollectCycle))
 	}
 }
 
@@ -182,7 +197,7 @@ func initTwin(dev *globals.BleDev) {
 func initData(dev *globals.BleDev) {
 	for i := 0; i < len(dev.Instance.Datas.Properties); i++ {
 		var visitorConfig configmap.BleVisitorConfig
-		if err := json.Unmarshal([]byte(dev.Instance.Twins[i].PVisitor.VisitorConfig), &visitorConfig); err != nil {
+		if err := json.Unmarshal(dev.Instance.Datas.Properties[i].PVisitor.VisitorConfig, &visitorConfig); err != nil {
 			klog.Errorf("Unmarshal VisitorConfig error: %v", err)
 			continue
 		}
@@ -193,36 +208,7 @@ func initData(dev *globals.BleDev) {
 			Type:             dev.Instance.Datas.Properties[i].Metadatas.Type,
 			BleVisitorConfig: visitorConfig,
 			Topic:            fmt.Sprintf(mappercommon.TopicDataUpdate, dev.Instance.ID)}
-		collectCycle := time.Duration(dev.Instance.Datas.Properties[i].PVisitor.CollectCycle)
-		// If the collect cycle is not set, set it to 1 second.
-		if collectCycle == 0 {
-			collectCycle = 1 * time.Second
-		}
-		uuid := ble.MustParse(twinData.BleVisitorConfig.CharacteristicUUID)
-		if p, err := twinData.BleClient.Client.DiscoverProfile(true); err == nil {
-			if u := p.Find(ble.NewCharacteristic(uuid)); u == nil {
-				klog.Errorf("can't find uuid %s", uuid.String())
-				continue
-			}
-			timer := mappercommon.Timer{Function: twinData.Run, Duration: collectCycle, Times: 0}
-			// If this Characteristic supports notifications and there's a CCCD
-			// Then subscribe to it, the notifications operation is different from reading operation, notifications will keep looping when connected
-			// so we can't use timer.Start() for notifications
-			wg.Add(1)
-			go func() {
-				c := twinData.FindedCharacteristic.(*ble.Characteristic)
-				if (c.Property&ble.CharNotify) != 0 && c.CCCD != nil {
-					if err := twinData.BleClient.Client.Subscribe(c, false, twinData.notificationHandler()); err != nil {
-						klog.Errorf("Subscribe failed: %v", err)
-					}
-				}
-			}()
-			wg.Add(1)
-			go func() {
-				defer wg.Done()
-				timer.Start()
-			}()
-		}
+		startCollect(&twinData, time.Duration(dev.Instance.Datas.Properties[i].PVisitor.CollectCycle))
 	}
 }
 
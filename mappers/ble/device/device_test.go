@@ -0,0 +1,210 @@
+/*
+Copyright 2021 The KubeEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package device
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/currantlabs/ble"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kubeedge/mappers-go/mappers/ble/configmap"
+	"github.com/kubeedge/mappers-go/mappers/ble/driver"
+	"github.com/kubeedge/mappers-go/mappers/ble/driver/fake"
+	"github.com/kubeedge/mappers-go/mappers/ble/globals"
+	"github.com/kubeedge/mappers-go/mappers/common"
+)
+
+type token struct {
+	mqtt.Token
+}
+
+func (token) Wait() bool   { return true }
+func (token) Error() error { return nil }
+
+type published struct {
+	topic   string
+	payload []byte
+}
+
+// fakeMqtt records published messages and subscribed topics.
+type fakeMqtt struct {
+	mqtt.Client
+
+	mu        sync.Mutex
+	messages  []published
+	subscribe map[string]mqtt.MessageHandler
+}
+
+func (m *fakeMqtt) Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, published{topic: topic, payload: payload.([]byte)})
+	return token{}
+}
+
+func (m *fakeMqtt) Subscribe(topic string, qos byte, callback mqtt.MessageHandler) mqtt.Token {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.subscribe[topic] = callback
+	return token{}
+}
+
+// twinValue returns the last reported value of the twin property.
+func (m *fakeMqtt) twinValue(topic string, name string) (string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := len(m.messages) - 1; i >= 0; i-- {
+		if m.messages[i].topic != topic {
+			continue
+		}
+		var update common.DeviceTwinUpdate
+		if err := json.Unmarshal(m.messages[i].payload, &update); err != nil {
+			continue
+		}
+		if twin, ok := update.Twin[name]; ok {
+			return *twin.Actual.Value, true
+		}
+	}
+	return "", false
+}
+
+type message struct {
+	mqtt.Message
+	topic   string
+	payload []byte
+}
+
+func (m message) Topic() string   { return m.topic }
+func (m message) Payload() []byte { return m.payload }
+
+var (
+	serviceUUID = ble.MustParse("ebe0ccb0-7a0a-4b0c-8a1a-6ff2997da3a6")
+	humidity    = ble.MustParse("ebe0ccc1-7a0a-4b0c-8a1a-6ff2997da3a6")
+	switchUUID  = ble.MustParse("ebe0ccc2-7a0a-4b0c-8a1a-6ff2997da3a6")
+)
+
+func newFakeMqtt() *fakeMqtt {
+	m := &fakeMqtt{subscribe: make(map[string]mqtt.MessageHandler)}
+	globals.MqttClient = &common.MqttClient{Client: m}
+	return m
+}
+
+func newFakeClient(p *fake.Peripheral) *driver.BleClient {
+	client, _ := driver.NewClient(driver.BleConfig{Dial: func(string) (driver.GattClient, error) { return p, nil }})
+	return &client
+}
+
+func TestTwinDataRun(t *testing.T) {
+	m := newFakeMqtt()
+	p := fake.NewPeripheral()
+	c := p.AddCharacteristic(serviceUUID, humidity, ble.CharRead, []byte{0x2A, 0x09})
+
+	td := TwinData{
+		BleClient: newFakeClient(p),
+		Name:      "humidity",
+		Type:      "float",
+		BleVisitorConfig: configmap.BleVisitorConfig{DataConvert: configmap.DataConvert{Type: TypeInt16,
+			OrderOfOperations: []configmap.OrderOfOperations{{OperationType: "Divide", OperationValue: 100}}}},
+		Topic:                "$hw/events/device/dev/twin/update",
+		FindedCharacteristic: c,
+	}
+	td.Run()
+	value, ok := m.twinValue(td.Topic, "humidity")
+	assert.True(t, ok)
+	assert.Equal(t, "23.46", value)
+
+	// Failed reads are not reported.
+	p.Disconnect()
+	m.messages = nil
+	td.Run()
+	_, ok = m.twinValue(td.Topic, "humidity")
+	assert.False(t, ok)
+}
+
+func TestNotification(t *testing.T) {
+	m := newFakeMqtt()
+	p := fake.NewPeripheral()
+	p.AddCharacteristic(serviceUUID, humidity, ble.CharNotify, nil)
+
+	td := TwinData{
+		BleClient:        newFakeClient(p),
+		Name:             "humidity",
+		Type:             "int",
+		BleVisitorConfig: configmap.BleVisitorConfig{CharacteristicUUID: humidity.String(), DataConvert: configmap.DataConvert{Type: TypeUint8}},
+		Topic:            "$hw/events/device/dev/twin/update",
+	}
+	startCollect(&td, 0)
+	assert.True(t, p.Notify(humidity, []byte{42}))
+	value, _ := m.twinValue(td.Topic, "humidity")
+	assert.Equal(t, "42", value)
+
+	p.Disconnect()
+	assert.False(t, p.Notify(humidity, []byte{43}))
+}
+
+func TestGetStatus(t *testing.T) {
+	p := fake.NewPeripheral()
+	client := newFakeClient(p)
+	assert.Equal(t, common.DEVSTOK, client.GetStatus())
+	p.Disconnect()
+	assert.Equal(t, common.DEVSTDISCONN, client.GetStatus())
+}
+
+func TestDevice(t *testing.T) {
+	m := newFakeMqtt()
+	p := fake.NewPeripheral()
+	p.AddCharacteristic(serviceUUID, humidity, ble.CharRead, []byte{0, 0, 55})
+	p.AddCharacteristic(serviceUUID, switchUUID, ble.CharRead|ble.CharWrite, []byte{0})
+	dial = func(addr string) (driver.GattClient, error) {
+		assert.Equal(t, "A4:C1:38:1A:49:90", addr)
+		return p, nil
+	}
+	defer func() { dial = nil }()
+
+	assert.Nil(t, DevInit("../configmap/configmap_test.json"))
+	dev := devices["xiaomi-device"]
+	// Add a writable twin encoded as uint8.
+	dev.Instance.PropertyVisitors = append(dev.Instance.PropertyVisitors, common.PropertyVisitor{
+		PropertyName:  "switch",
+		VisitorConfig: json.RawMessage(fmt.Sprintf(`{"characteristicUUID":"%s","dataConverter":{"type":"uint8"}}`, switchUUID)),
+		PProperty:     common.Property{Name: "switch", DataType: "int", AccessMode: "ReadWrite"},
+	})
+	dev.Instance.Twins = append(dev.Instance.Twins, common.Twin{PropertyName: "switch",
+		PVisitor: &dev.Instance.PropertyVisitors[len(dev.Instance.PropertyVisitors)-1]})
+	start(dev)
+
+	twinTopic := fmt.Sprintf(common.TopicTwinUpdate, "xiaomi-device")
+	assert.Eventually(t, func() bool {
+		value, ok := m.twinValue(twinTopic, "humidity")
+		return ok && value == "0.55"
+	}, 3*time.Second, 100*time.Millisecond)
+
+	deltaTopic := fmt.Sprintf(common.TopicTwinUpdateDelta, "xiaomi-device")
+	m.mu.Lock()
+	onDelta := m.subscribe[deltaTopic]
+	m.mu.Unlock()
+	if assert.NotNil(t, onDelta) {
+		onDelta(nil, message{topic: deltaTopic, payload: []byte(`{"delta":{"switch":"1"}}`)})
+		assert.Equal(t, []byte{1}, p.Value(switchUUID))
+	}
+}
@@ -17,14 +17,11 @@ limitations under the License.
 package device
 
 import (
-	"fmt"
-	"strconv"
 	"strings"
 
 	"github.com/currantlabs/ble"
 	"k8s.io/klog/v2"
 
-	"github.com/kubeedge/kubeedge/pkg/apis/devices/v1alpha2"
 	"github.com/kubeedge/mappers-go/mappers/ble/configmap"
 	"github.com/kubeedge/mappers-go/mappers/ble/driver"
 	"github.com/kubeedge/mappers-go/mappers/ble/globals"
@@ -49,9 +46,13 @@ func (td *TwinData) Run() {
 	b, err := td.BleClient.Read(c)
 	if err != nil {
 		klog.Errorf("Failed to read characteristic: %s\n", err)
+		return
 	}
 
-	td.Result = fmt.Sprintf("%f", td.ConvertReadData(b))
+	if td.Result, err = td.ConvertReadData(b); err != nil {
+		klog.Errorf("Failed to convert data of %s: %v", td.Name, err)
+		return
+	}
 
 	if err = td.handlerPublish(); err != nil {
 		klog.Errorf("publish data to mqtt failed: %v", err)
@@ -60,7 +61,11 @@ func (td *TwinData) Run() {
 
 func (td *TwinData) notificationHandler() func(req []byte) {
 	return func(req []byte) {
-		td.Result = fmt.Sprintf("%f", td.ConvertReadData(req))
+		var err error
+		if td.Result, err = td.ConvertReadData(req); err != nil {
+			klog.Errorf("Failed to convert data of %s: %v", td.Name, err)
+			return
+		}
 		if err := td.handlerPublish(); err != nil {
 			klog.Errorf("publish data to mq failed: %v", err)
 		}
@@ -90,42 +95,7 @@ func (td *TwinData) handlerPublish() (err error) {
 }
 
 // ConvertReadData is the function responsible to convert the data read from the device into meaningful data.
-// If currently logic of converting data is not suitable for your device, you can change ConvertReadData function manually.
-func (td *TwinData) ConvertReadData(data []byte) float64 {
-	var intermediateResult uint64
-	var initialValue []byte
-	var initialStringValue = ""
-	if td.BleVisitorConfig.DataConvert.StartIndex <= td.BleVisitorConfig.DataConvert.EndIndex {
-		for index := td.BleVisitorConfig.DataConvert.StartIndex; index <= td.BleVisitorConfig.DataConvert.EndIndex; index++ {
-			initialValue = append(initialValue, data[index])
-		}
-	} else {
-		for index := td.BleVisitorConfig.DataConvert.StartIndex; index >= td.BleVisitorConfig.DataConvert.EndIndex; index-- {
-			initialValue = append(initialValue, data[index])
-		}
-	}
-	for _, value := range initialValue {
-		initialStringValue = initialStringValue + strconv.Itoa(int(value))
-	}
-	initialByteValue, _ := strconv.ParseUint(initialStringValue, 10, 64)
-	if td.BleVisitorConfig.DataConvert.ShiftLeft != 0 {
-		intermediateResult = initialByteValue << td.BleVisitorConfig.DataConvert.ShiftLeft
-	} else if td.BleVisitorConfig.DataConvert.ShiftRight != 0 {
-		intermediateResult = initialByteValue >> td.BleVisitorConfig.DataConvert.ShiftRight
-	} else {
-		intermediateResult = initialByteValue
-	}
-	finalResult := float64(intermediateResult)
-	for _, orderOfOperations := range td.BleVisitorConfig.DataConvert.OrderOfOperations {
-		if strings.ToUpper(orderOfOperations.OperationType) == strings.ToUpper(string(v1alpha2.BluetoothAdd)) {
-			finalResult = finalResult + orderOfOperations.OperationValue
-		} else if strings.ToUpper(orderOfOperations.OperationType) == strings.ToUpper(string(v1alpha2.BluetoothSubtract)) {
-			finalResult = finalResult - orderOfOperations.OperationValue
-		} else if strings.ToUpper(orderOfOperations.OperationType) == strings.ToUpper(string(v1alpha2.BluetoothMultiply)) {
-			finalResult = finalResult * orderOfOperations.OperationValue
-		} else if strings.ToUpper(orderOfOperations.OperationType) == strings.ToUpper(string(v1alpha2.BluetoothDivide)) {
-			finalResult = finalResult / orderOfOperations.OperationValue
-		}
-	}
-	return finalResult
+// The data is decoded according to the data converter of the visitor, see Decode.
+func (td *TwinData) ConvertReadData(data []byte) (string, error) {
+	return Decode(td.BleVisitorConfig.DataConvert, data)
 }
@@ -17,6 +17,7 @@ limitations under the License.
 package driver
 
 import (
+	"fmt"
 	"sync"
 	"time"
 
@@ -30,22 +31,55 @@ import (
 
 type BleConfig struct {
 	Addr string
+	// Dial connects to the peripheral, DialGoBle is used if nil.
+	Dial Dialer
 }
 
+// GattClient is the GATT client the mapper depends on.
+// The ble.Client of go-ble implements it.
+type GattClient interface {
+	// DiscoverProfile discovers the services, characteristics and descriptors of the peripheral.
+	DiscoverProfile(force bool) (*ble.Profile, error)
+	// ReadCharacteristic reads a characteristic value.
+	ReadCharacteristic(c *ble.Characteristic) ([]byte, error)
+	// WriteCharacteristic writes a characteristic value.
+	WriteCharacteristic(c *ble.Characteristic, value []byte, noRsp bool) error
+	// Subscribe subscribes to indication (if ind is set true), or notification of a characteristic value.
+	Subscribe(c *ble.Characteristic, ind bool, h ble.NotificationHandler) error
+	// ReadRSSI retrieves the current RSSI value of the peripheral.
+	ReadRSSI() int
+	// CancelConnection disconnects the connection.
+	CancelConnection() error
+	// Disconnected returns a channel which is closed when the peripheral disconnects.
+	Disconnected() <-chan struct{}
+}
+
+// Dialer connects to the peripheral of the address.
+type Dialer func(addr string) (GattClient, error)
+
 // BleClient is the client structure.
 type BleClient struct {
-	Client ble.Client
+	Client GattClient
 	mu     sync.Mutex
 }
 
-func NewClient(config BleConfig) (bc BleClient, err error) {
+// DialGoBle connects to the peripheral with the HCI device of go-ble.
+func DialGoBle(addr string) (GattClient, error) {
 	ctx := ble.WithSigHandler(context.WithTimeout(context.Background(), 1*time.Minute))
 	host, err := linux.NewDevice()
 	if err != nil {
 		klog.Errorf("New device error: %v", err)
-		return
+		return nil, err
+	}
+	return host.Dial(ctx, ble.NewAddr(addr))
+}
+
+func NewClient(config BleConfig) (bc BleClient, err error) {
+	dial := config.Dial
+	if dial == nil {
+		dial = DialGoBle
 	}
-	bc.Client, err = host.Dial(ctx, ble.NewAddr(config.Addr))
+	bc.Client, err = dial(config.Addr)
 	return
 }
 
@@ -55,28 +89,67 @@ func (bc *BleClient) Disconnect() error {
 }
 
 func (bc *BleClient) Set(c ble.UUID, b []byte) error {
-	if p, err := bc.Client.DiscoverProfile(true); err == nil {
-		if u := p.Find(ble.NewCharacteristic(c)); u != nil {
-			c := u.(*ble.Characteristic)
-			if err := bc.Client.WriteCharacteristic(c, b, false); err != nil {
-				klog.Errorf("Write characteristic error %v", err)
-				return err
-			}
-		}
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	p, err := bc.Client.DiscoverProfile(false)
+	if err != nil {
+		klog.Errorf("Discover profile error %v", err)
+		return err
+	}
+	u := p.Find(ble.NewCharacteristic(c))
+	if u == nil {
+		return fmt.Errorf("characteristic %s not found", c)
+	}
+	if err := bc.Client.WriteCharacteristic(u.(*ble.Characteristic), b, false); err != nil {
+		klog.Errorf("Write characteristic error %v", err)
+		return err
 	}
 	return nil
 }
 
 func (bc *BleClient) Read(c *ble.Characteristic) ([]byte, error) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
 	return bc.Client.ReadCharacteristic(c)
 }
 
+// Find discovers the characteristic of the UUID.
+func (bc *BleClient) Find(c ble.UUID) (*ble.Characteristic, error) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	p, err := bc.Client.DiscoverProfile(true)
+	if err != nil {
+		return nil, err
+	}
+	u := p.Find(ble.NewCharacteristic(c))
+	if u == nil {
+		return nil, fmt.Errorf("characteristic %s not found", c)
+	}
+	return u.(*ble.Characteristic), nil
+}
+
+// Subscribe subscribes to the notifications of the characteristic.
+func (bc *BleClient) Subscribe(c *ble.Characteristic, h ble.NotificationHandler) error {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	return bc.Client.Subscribe(c, false, h)
+}
+
 // GetStatus get device status.
 // Now we could only get the connection status.
 func (bc *BleClient) GetStatus() string {
 	bc.mu.Lock()
 	defer bc.mu.Unlock()
 
+	select {
+	case <-bc.Client.Disconnected():
+		return common.DEVSTDISCONN
+	default:
+	}
 	rssi := bc.Client.ReadRSSI()
 	if rssi < 0 {
 		return common.DEVSTOK
@@ -0,0 +1,279 @@
+/*
+Copyright 2021 The KubeEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package fake provides an in-memory GATT peripheral, so that the mapper
+// could be tested without a Bluetooth adapter.
+package fake
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/currantlabs/ble"
+
+	"github.com/kubeedge/mappers-go/mappers/ble/driver"
+)
+
+var _ driver.GattClient = (*Peripheral)(nil)
+
+var (
+	// ErrDisconnected error of an operation after the peripheral disconnected.
+	ErrDisconnected = errors.New("Peripheral disconnected")
+	// ErrNotPermitted error of an operation the characteristic property does not permit.
+	ErrNotPermitted = errors.New("Operation not permitted")
+)
+
+// Write is a characteristic value written by the client.
+type Write struct {
+	UUID  ble.UUID
+	Value []byte
+	NoRsp bool
+}
+
+// Peripheral is an in-memory GATT peripheral implementing driver.GattClient.
+type Peripheral struct {
+	// ReadErr is returned by reads if set.
+	ReadErr error
+	// WriteErr is returned by writes if set.
+	WriteErr error
+
+	mu           sync.Mutex
+	profile      ble.Profile
+	values       map[*ble.Characteristic][]byte
+	handlers     map[*ble.Characteristic]ble.NotificationHandler
+	writes       []Write
+	rssi         int
+	disconnected chan struct{}
+}
+
+// NewPeripheral creates a connected peripheral without services.
+func NewPeripheral() *Peripheral {
+	return &Peripheral{
+		values:       make(map[*ble.Characteristic][]byte),
+		handlers:     make(map[*ble.Characteristic]ble.NotificationHandler),
+		rssi:         -50,
+		disconnected: make(chan struct{}),
+	}
+}
+
+// AddCharacteristic adds a characteristic to the service, the service is created if it does not exist.
+// Characteristics which support notifications or indications get a CCCD.
+func (p *Peripheral) AddCharacteristic(service ble.UUID, uuid ble.UUID, property ble.Property, value []byte) *ble.Characteristic {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var s *ble.Service
+	for _, svc := range p.profile.Services {
+		if svc.UUID.Equal(service) {
+			s = svc
+			break
+		}
+	}
+	if s == nil {
+		s = ble.NewService(service)
+		p.profile.Services = append(p.profile.Services, s)
+	}
+	c := s.NewCharacteristic(uuid)
+	c.Property = property
+	if property&(ble.CharNotify|ble.CharIndicate) != 0 {
+		c.CCCD = c.NewDescriptor(ble.ClientCharacteristicConfigUUID)
+	}
+	p.values[c] = value
+	return c
+}
+
+func (p *Peripheral) find(uuid ble.UUID) (*ble.Characteristic, error) {
+	if u := p.profile.Find(ble.NewCharacteristic(uuid)); u != nil {
+		return u.(*ble.Characteristic), nil
+	}
+	return nil, fmt.Errorf("characteristic %s not found", uuid)
+}
+
+// SetValue sets the value of a characteristic without notifying the client.
+func (p *Peripheral) SetValue(uuid ble.UUID, value []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	c, err := p.find(uuid)
+	if err != nil {
+		return err
+	}
+	p.values[c] = value
+	return nil
+}
+
+// Value returns the value of a characteristic.
+func (p *Peripheral) Value(uuid ble.UUID) []byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	c, err := p.find(uuid)
+	if err != nil {
+		return nil
+	}
+	return p.values[c]
+}
+
+// Notify sets the value of a characteristic and sends it to the subscribed handler.
+// It reports whether the client was notified.
+func (p *Peripheral) Notify(uuid ble.UUID, value []byte) bool {
+	p.mu.Lock()
+	c, err := p.find(uuid)
+	if err != nil || p.isDisconnected() {
+		p.mu.Unlock()
+		return false
+	}
+	p.values[c] = value
+	h := p.handlers[c]
+	p.mu.Unlock()
+
+	if h == nil {
+		return false
+	}
+	h(value)
+	return true
+}
+
+// Writes returns the values written by the client.
+func (p *Peripheral) Writes() []Write {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]Write(nil), p.writes...)
+}
+
+// SetRSSI sets the RSSI returned by ReadRSSI.
+func (p *Peripheral) SetRSSI(rssi int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.rssi = rssi
+}
+
+// Disconnect simulates a lost connection, all later operations fail with ErrDisconnected.
+func (p *Peripheral) Disconnect() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.isDisconnected() {
+		close(p.disconnected)
+	}
+	p.handlers = make(map[*ble.Characteristic]ble.NotificationHandler)
+}
+
+func (p *Peripheral) isDisconnected() bool {
+	select {
+	case <-p.disconnected:
+		return true
+	default:
+		return false
+	}
+}
+
+// DiscoverProfile returns the profile of the peripheral.
+func (p *Peripheral) DiscoverProfile(force bool) (*ble.Profile, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.isDisconnected() {
+		return nil, ErrDisconnected
+	}
+	return &p.profile, nil
+}
+
+// ReadCharacteristic reads a characteristic value.
+func (p *Peripheral) ReadCharacteristic(c *ble.Characteristic) ([]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	switch {
+	case p.isDisconnected():
+		return nil, ErrDisconnected
+	case p.ReadErr != nil:
+		return nil, p.ReadErr
+	case c.Property&ble.CharRead == 0:
+		return nil, ErrNotPermitted
+	}
+	found, err := p.find(c.UUID)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), p.values[found]...), nil
+}
+
+// WriteCharacteristic writes a characteristic value.
+func (p *Peripheral) WriteCharacteristic(c *ble.Characteristic, value []byte, noRsp bool) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	switch {
+	case p.isDisconnected():
+		return ErrDisconnected
+	case p.WriteErr != nil:
+		return p.WriteErr
+	case c.Property&(ble.CharWrite|ble.CharWriteNR) == 0:
+		return ErrNotPermitted
+	}
+	found, err := p.find(c.UUID)
+	if err != nil {
+		return err
+	}
+	p.values[found] = append([]byte(nil), value...)
+	p.writes = append(p.writes, Write{UUID: c.UUID, Value: p.values[found], NoRsp: noRsp})
+	return nil
+}
+
+// Subscribe subscribes to the notifications of a characteristic.
+func (p *Peripheral) Subscribe(c *ble.Characteristic, ind bool, h ble.NotificationHandler) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.isDisconnected() {
+		return ErrDisconnected
+	}
+	if c.CCCD == nil {
+		return ErrNotPermitted
+	}
+	found, err := p.find(c.UUID)
+	if err != nil {
+		return err
+	}
+	p.handlers[found] = h
+	return nil
+}
+
+// ReadRSSI returns the RSSI, it is 0 after the peripheral disconnected.
+func (p *Peripheral) ReadRSSI() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.isDisconnected() {
+		return 0
+	}
+	return p.rssi
+}
+
+// CancelConnection disconnects the peripheral.
+func (p *Peripheral) CancelConnection() error {
+	p.Disconnect()
+	return nil
+}
+
+// Disconnected returns a channel which is closed when the peripheral disconnects.
+func (p *Peripheral) Disconnected() <-chan struct{} {
+	return p.disconnected
+}
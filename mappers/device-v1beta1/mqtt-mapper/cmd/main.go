@@ -1,7 +1,12 @@
 package main
 
 import (
+	"context"
 	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"k8s.io/klog/v2"
 
@@ -13,6 +18,10 @@ import (
 	"github.com/kubeedge/mapper-framework/pkg/httpserver"
 )
 
+// shutdownTimeout bounds how long in-flight pushes and database writes may
+// take to finish once the mapper is asked to stop.
+const shutdownTimeout = 10 * time.Second
+
 func main() {
 	var err error
 	var c *config.Config
@@ -20,6 +29,9 @@ func main() {
 	klog.InitFlags(nil)
 	defer klog.Flush()
 
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	if c, err = config.Parse(); err != nil {
 		klog.Fatal(err)
 	}
@@ -52,9 +64,27 @@ func main() {
 		},
 		panel,
 	)
-	defer grpcServer.Stop()
-	if err = grpcServer.Start(); err != nil {
-		klog.Fatal(err)
-	}
+	go func() {
+		if err := grpcServer.Start(); err != nil {
+			klog.Fatal(err)
+		}
+	}()
 
+	<-ctx.Done()
+	klog.Infoln("Mapper is shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	// report the final state of the devices while edgecore still reaches the
+	// mapper
+	if err = panel.Deregister(shutdownCtx); err != nil {
+		klog.Errorf("Mapper deregistration is incomplete: %v", err)
+	}
+	// stop accepting DMI requests, this also removes the mapper socket, which
+	// is how edgecore learns that the mapper is gone
+	grpcServer.Stop()
+	if err = panel.Shutdown(shutdownCtx); err != nil {
+		klog.Errorf("Mapper shutdown is incomplete: %v", err)
+		return
+	}
+	klog.Infoln("Mapper stopped")
 }
@@ -26,6 +26,8 @@ import (
 	"github.com/kubeedge/mapper-framework/pkg/common"
 )
 
+// DataHandler saves the device data into the database every report cycle
+// until ctx is done, then closes the database session.
 func DataHandler(ctx context.Context, twin *common.Twin, client *driver.CustomizedClient, visitorConfig *driver.VisitorConfig, dataModel *common.DataModel) {
 	dbConfig, err := NewDataBaseClient(twin.Property.PushMethod.DBMethod.DBConfig.Influxdb2ClientConfig, twin.Property.PushMethod.DBMethod.DBConfig.Influxdb2DataConfig)
 	if err != nil {
@@ -42,32 +44,31 @@ func DataHandler(ctx context.Context, twin *common.Twin, client *driver.Customiz
 		reportCycle = common.DefaultReportCycle
 	}
 	ticker := time.NewTicker(reportCycle)
-	go func() {
-		for {
-			select {
-			case <-ticker.C:
-				deviceData, err := client.GetDeviceData(visitorConfig)
-				if err != nil {
-					klog.Errorf("publish error: %v", err)
-					continue
-				}
-				sData, err := common.ConvertToString(deviceData)
-				if err != nil {
-					klog.Errorf("Failed to convert publish method data : %v", err)
-					continue
-				}
-				dataModel.SetValue(sData)
-				dataModel.SetTimeStamp()
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			deviceData, err := client.GetDeviceData(visitorConfig)
+			if err != nil {
+				klog.Errorf("publish error: %v", err)
+				continue
+			}
+			sData, err := common.ConvertToString(deviceData)
+			if err != nil {
+				klog.Errorf("Failed to convert publish method data : %v", err)
+				continue
+			}
+			dataModel.SetValue(sData)
+			dataModel.SetTimeStamp()
 
-				err = dbConfig.AddData(dataModel, dbClient)
-				if err != nil {
-					klog.Errorf("influx database add data error: %v", err)
-					return
-				}
-			case <-ctx.Done():
-				dbConfig.CloseSession(dbClient)
+			err = dbConfig.AddData(dataModel, dbClient)
+			if err != nil {
+				klog.Errorf("influx database add data error: %v", err)
 				return
 			}
+		case <-ctx.Done():
+			dbConfig.CloseSession(dbClient)
+			return
 		}
-	}()
+	}
 }
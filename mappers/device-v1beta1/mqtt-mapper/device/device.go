@@ -5,8 +5,6 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"os"
-	"os/signal"
 	"strings"
 	"sync"
 	"time"
@@ -31,9 +29,11 @@ type DevPanel struct {
 	deviceMuxs   map[string]context.CancelFunc
 	devices      map[string]*driver.CustomizedDev
 	models       map[string]common.DeviceModel
+	states       map[string]*StateMachine
 	wg           sync.WaitGroup
 	serviceMutex sync.Mutex
-	quitChan     chan os.Signal
+	// workers tracks acquisition, push and database goroutines of all devices
+	workers sync.WaitGroup
 }
 
 var (
@@ -43,6 +43,9 @@ var (
 
 var ErrEmptyData = errors.New("device or device model list is empty")
 
+// newStateReporter builds the reporter of device state transitions, tests replace it.
+var newStateReporter = reportDeviceState
+
 // NewDevPanel init and return devPanel
 func NewDevPanel() *DevPanel {
 	once.Do(func() {
@@ -50,64 +53,145 @@ func NewDevPanel() *DevPanel {
 			deviceMuxs:   make(map[string]context.CancelFunc),
 			devices:      make(map[string]*driver.CustomizedDev),
 			models:       make(map[string]common.DeviceModel),
+			states:       make(map[string]*StateMachine),
 			wg:           sync.WaitGroup{},
 			serviceMutex: sync.Mutex{},
-			quitChan:     make(chan os.Signal),
 		}
 	})
 	return devPanel
 }
 
-// DevStart start all devices.
+// DevStart start all devices and wait until they are stopped by Shutdown.
 func (d *DevPanel) DevStart() {
+	d.serviceMutex.Lock()
 	for id, dev := range d.devices {
 		klog.V(4).Info("Dev: ", id, dev)
 		ctx, cancel := context.WithCancel(context.Background())
 		d.deviceMuxs[id] = cancel
+		d.states[id] = NewStateMachine(id, newStateReporter(dev.Instance.Name, dev.Instance.Namespace))
 		d.wg.Add(1)
-		go d.start(ctx, dev)
+		go d.start(ctx, dev, d.states[id])
+	}
+	d.serviceMutex.Unlock()
+	d.wg.Wait()
+}
+
+// Deregister reports every device as removing to edgecore and waits until the
+// reports are sent or ctx is done. The DMI API has no call to deregister a
+// mapper, edgecore loses the mapper once the gRPC server removes its socket.
+func (d *DevPanel) Deregister(ctx context.Context) error {
+	d.serviceMutex.Lock()
+	for _, state := range d.states {
+		state.Removing("mapper is shutting down")
+	}
+	d.serviceMutex.Unlock()
+	return waitStateReports(ctx)
+}
+
+// Shutdown stops data acquisition of all devices, waits for in-flight pushes
+// and database writes until ctx is done, then closes the driver connections.
+// The panel is only locked to stop the devices, so that handlers and REST
+// calls which need it are not blocked while they are drained.
+func (d *DevPanel) Shutdown(ctx context.Context) error {
+	d.serviceMutex.Lock()
+	for id, cancel := range d.deviceMuxs {
+		d.states[id].Removing("mapper is shutting down")
+		cancel()
 	}
-	signal.Notify(d.quitChan, os.Interrupt)
+	devices := make(map[string]*driver.CustomizedDev, len(d.devices))
+	for id, dev := range d.devices {
+		devices[id] = dev
+	}
+	d.serviceMutex.Unlock()
+
+	drained := make(chan struct{})
 	go func() {
-		<-d.quitChan
-		for id, device := range d.devices {
-			err := device.CustomizedClient.StopDevice()
-			if err != nil {
-				klog.Errorf("Service has stopped but failed to stop %s:%v", id, err)
-			}
+		d.wg.Wait()
+		d.workers.Wait()
+		close(drained)
+	}()
+	var err error
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		err = fmt.Errorf("wait for device handlers to stop: %w", ctx.Err())
+	}
+
+	for id, dev := range devices {
+		if dev.CustomizedClient == nil {
+			continue
+		}
+		if stopErr := dev.CustomizedClient.StopDevice(); stopErr != nil {
+			klog.Errorf("Service has stopped but failed to stop %s:%v", id, stopErr)
 		}
-		klog.V(1).Info("Exit mapper")
-		os.Exit(1)
+	}
+	return err
+}
+
+// spawn runs f in a goroutine that Shutdown waits for.
+func (d *DevPanel) spawn(f func()) {
+	d.workers.Add(1)
+	go func() {
+		defer d.workers.Done()
+		f()
 	}()
-	d.wg.Wait()
 }
 
 // start the device
-func (d *DevPanel) start(ctx context.Context, dev *driver.CustomizedDev) {
+func (d *DevPanel) start(ctx context.Context, dev *driver.CustomizedDev, state *StateMachine) {
 	defer d.wg.Done()
 
 	var protocolConfig driver.ProtocolConfig
 	if err := json.Unmarshal(dev.Instance.PProtocol.ConfigData, &protocolConfig); err != nil {
 		klog.Errorf("Unmarshal ProtocolConfigs error: %v", err)
+		state.DriverError(err)
 		return
 	}
 	client, err := driver.NewClient(protocolConfig)
 	if err != nil {
 		klog.Errorf("Init dev %s error: %v", dev.Instance.Name, err)
+		state.DriverError(err)
 		return
 	}
 	dev.CustomizedClient = client
-	err = dev.CustomizedClient.InitDevice()
-	if err != nil {
-		klog.Errorf("Init device %s error: %v", dev.Instance.ID, err)
+	if !connect(ctx, dev, state) {
 		return
 	}
-	go dataHandler(ctx, dev)
-	<-ctx.Done()
+	d.spawn(func() { d.dataHandler(ctx, dev, state) })
+	for {
+		select {
+		case <-state.Lost():
+			klog.Warningf("Device %s went offline, reconnecting", dev.Instance.ID)
+			if !connect(ctx, dev, state) {
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// connect initializes the device, retrying with backoff until it succeeds.
+// It returns false if ctx is cancelled first.
+func connect(ctx context.Context, dev *driver.CustomizedDev, state *StateMachine) bool {
+	for attempt := 1; ; attempt++ {
+		err := dev.CustomizedClient.InitDevice()
+		if err == nil {
+			state.Connected()
+			return true
+		}
+		klog.Errorf("Init device %s error: %v", dev.Instance.ID, err)
+		state.ConnectFailed(attempt, err)
+		select {
+		case <-time.After(reconnectBackoff(attempt)):
+		case <-ctx.Done():
+			return false
+		}
+	}
 }
 
 // dataHandler initialize the timer to handle data plane and devicetwin.
-func dataHandler(ctx context.Context, dev *driver.CustomizedDev) {
+func (d *DevPanel) dataHandler(ctx context.Context, dev *driver.CustomizedDev, state *StateMachine) {
 	for _, twin := range dev.Instance.Twins {
 		twin.Property.PProperty.DataType = strings.ToLower(twin.Property.PProperty.DataType)
 		var visitorConfig driver.VisitorConfig
@@ -147,39 +231,31 @@ func dataHandler(ctx context.Context, dev *driver.CustomizedDev) {
 			Topic:           fmt.Sprintf(common.TopicTwinUpdate, dev.Instance.ID),
 			CollectCycle:    time.Millisecond * time.Duration(twin.Property.CollectCycle),
 			ReportToCloud:   twin.Property.ReportToCloud,
+			State:           state,
 		}
-		go twinData.Run(ctx)
+		d.spawn(func() { twinData.Run(ctx) })
 
 		//handle status
 		getStates := &DeviceStates{Client: dev.CustomizedClient, DeviceName: dev.Instance.Name,
-			DeviceNamespace: dev.Instance.Namespace}
-		go getStates.Run(ctx)
+			DeviceNamespace: dev.Instance.Namespace, VisitorConfig: &visitorConfig, State: state}
+		d.spawn(func() { getStates.Run(ctx) })
 
 		// handle push method
 		if twin.Property.PushMethod.MethodConfig != nil && twin.Property.PushMethod.MethodName != "" {
 			dataModel := common.NewDataModel(dev.Instance.Name, twin.Property.PropertyName, dev.Instance.Namespace, common.WithType(twin.ObservedDesired.Metadata.Type))
-			pushHandler(ctx, &twin, dev.CustomizedClient, &visitorConfig, dataModel)
+			twin, visitorConfig := twin, visitorConfig
+			d.spawn(func() { pushHandler(ctx, &twin, dev.CustomizedClient, &visitorConfig, dataModel) })
 		}
 		// handle database
 		if twin.Property.PushMethod.DBMethod.DBMethodName != "" {
 			dataModel := common.NewDataModel(dev.Instance.Name, twin.Property.PropertyName, dev.Instance.Namespace, common.WithType(twin.ObservedDesired.Metadata.Type))
-			dbHandler(ctx, &twin, dev.CustomizedClient, &visitorConfig, dataModel)
-			switch twin.Property.PushMethod.DBMethod.DBMethodName {
-			// TODO add more database
-			case "influx":
-				dbInflux.DataHandler(ctx, &twin, dev.CustomizedClient, &visitorConfig, dataModel)
-			case "redis":
-				dbRedis.DataHandler(ctx, &twin, dev.CustomizedClient, &visitorConfig, dataModel)
-			case "tdengine":
-				dbTdengine.DataHandler(ctx, &twin, dev.CustomizedClient, &visitorConfig, dataModel)
-			case "mysql":
-				dbMysql.DataHandler(ctx, &twin, dev.CustomizedClient, &visitorConfig, dataModel)
-			}
+			twin, visitorConfig := twin, visitorConfig
+			d.spawn(func() { dbHandler(ctx, &twin, dev.CustomizedClient, &visitorConfig, dataModel) })
 		}
 	}
 }
 
-// pushHandler start data panel work
+// pushHandler pushes device data every report cycle until ctx is done
 func pushHandler(ctx context.Context, twin *common.Twin, client *driver.CustomizedClient, visitorConfig *driver.VisitorConfig, dataModel *common.DataModel) {
 	var dataPanel global.DataPanel
 	var err error
@@ -207,31 +283,30 @@ func pushHandler(ctx context.Context, twin *common.Twin, client *driver.Customiz
 		reportCycle = common.DefaultReportCycle
 	}
 	ticker := time.NewTicker(reportCycle)
-	go func() {
-		for {
-			select {
-			case <-ticker.C:
-				deviceData, err := client.GetDeviceData(visitorConfig)
-				if err != nil {
-					klog.Errorf("publish error: %v", err)
-					continue
-				}
-				sData, err := common.ConvertToString(deviceData)
-				if err != nil {
-					klog.Errorf("Failed to convert publish method data : %v", err)
-					continue
-				}
-				dataModel.SetValue(sData)
-				dataModel.SetTimeStamp()
-				dataPanel.Push(dataModel)
-			case <-ctx.Done():
-				return
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			deviceData, err := client.GetDeviceData(visitorConfig)
+			if err != nil {
+				klog.Errorf("publish error: %v", err)
+				continue
+			}
+			sData, err := common.ConvertToString(deviceData)
+			if err != nil {
+				klog.Errorf("Failed to convert publish method data : %v", err)
+				continue
 			}
+			dataModel.SetValue(sData)
+			dataModel.SetTimeStamp()
+			dataPanel.Push(dataModel)
+		case <-ctx.Done():
+			return
 		}
-	}()
+	}
 }
 
-// dbHandler start db client to save data
+// dbHandler saves device data into the configured database until ctx is done
 func dbHandler(ctx context.Context, twin *common.Twin, client *driver.CustomizedClient, visitorConfig *driver.VisitorConfig, dataModel *common.DataModel) {
 	switch twin.Property.PushMethod.DBMethod.DBMethodName {
 	// TODO add more database
@@ -307,6 +382,7 @@ func (d *DevPanel) UpdateDev(model *common.DeviceModel, device *common.DeviceIns
 	defer d.serviceMutex.Unlock()
 
 	if oldDevice, ok := d.devices[device.ID]; ok {
+		d.states[device.ID].Removing("device is being updated")
 		err := d.stopDev(oldDevice, device.ID)
 		if err != nil {
 			klog.Error(err)
@@ -319,8 +395,9 @@ func (d *DevPanel) UpdateDev(model *common.DeviceModel, device *common.DeviceIns
 
 	ctx, cancelFunc := context.WithCancel(context.Background())
 	d.deviceMuxs[device.ID] = cancelFunc
+	d.states[device.ID] = NewStateMachine(device.ID, newStateReporter(device.Name, device.Namespace))
 	d.wg.Add(1)
-	go d.start(ctx, d.devices[device.ID])
+	go d.start(ctx, d.devices[device.ID], d.states[device.ID])
 }
 
 // UpdateDevTwins update device's twins
@@ -412,6 +489,8 @@ func (d *DevPanel) RemoveDevice(deviceID string) error {
 	defer d.serviceMutex.Unlock()
 	dev := d.devices[deviceID]
 	delete(d.devices, deviceID)
+	d.states[deviceID].Removing("device is being removed")
+	delete(d.states, deviceID)
 	err := d.stopDev(dev, deviceID)
 	if err != nil {
 		return err
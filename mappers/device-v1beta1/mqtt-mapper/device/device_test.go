@@ -0,0 +1,140 @@
+package device
+
+import (
+	"context"
+	"encoding/json"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kubeedge/mapper-framework/pkg/common"
+	"github.com/kubeedge/mqtt/driver"
+)
+
+// newThermometer returns an mqtt device whose config data is published on
+// topic, with a single read-only twin.
+func newThermometer(t *testing.T, id, topic string) *driver.CustomizedDev {
+	t.Helper()
+	protocol, err := json.Marshal(driver.ProtocolConfig{
+		ProtocolName: "mqtt",
+		ConfigData:   driver.ConfigData{ClientID: id, Topic: topic, Message: `{"status":"ok"}`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	visitor, err := json.Marshal(driver.VisitorConfig{ProtocolName: "mqtt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &driver.CustomizedDev{Instance: common.DeviceInstance{
+		ID:        id,
+		Name:      id,
+		Namespace: "default",
+		PProtocol: common.ProtocolConfig{ProtocolName: "mqtt", ConfigData: protocol},
+		Twins: []common.Twin{{
+			PropertyName: "temperature",
+			Property: &common.DeviceProperty{
+				Visitors:  visitor,
+				PProperty: common.ModelProperty{AccessMode: "ReadOnly"},
+			},
+		}},
+	}}
+}
+
+func waitForState(t *testing.T, d *DevPanel, id string, want DeviceState) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		d.serviceMutex.Lock()
+		m := d.states[id]
+		d.serviceMutex.Unlock()
+		if state, _ := m.State(); m != nil && state == want {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("device %s did not reach state %s", id, want)
+}
+
+func TestShutdownStopsStatusPolling(t *testing.T) {
+	newStateReporter = func(string, string) StateReporter { return nil }
+	t.Cleanup(func() { newStateReporter = reportDeviceState })
+	before := runtime.NumGoroutine()
+	d := &DevPanel{
+		deviceMuxs: make(map[string]context.CancelFunc),
+		devices: map[string]*driver.CustomizedDev{
+			// a deviceinfo topic connects and polls the status of the device
+			"thermometer": newThermometer(t, "thermometer", "home/thermometer/deviceinfo/json"),
+			// an update topic carries no device config, so it never connects
+			"updater": newThermometer(t, "updater", "home/thermometer/update/json"),
+		},
+		models: make(map[string]common.DeviceModel),
+		states: make(map[string]*StateMachine),
+	}
+	stopped := make(chan struct{})
+	go func() {
+		d.DevStart()
+		close(stopped)
+	}()
+	waitForState(t, d, "thermometer", StateOnline)
+	waitForState(t, d, "updater", StateOffline)
+	if _, reason := d.states["updater"].State(); !strings.Contains(reason, "This is not a device config.") {
+		t.Errorf("updater reason = %q, want the rejected topic", reason)
+	}
+	if client := d.devices["thermometer"].CustomizedClient; client.TempMessage != `{"status":"ok"}` {
+		t.Errorf("TempMessage = %q, want the published device config", client.TempMessage)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := d.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("DevStart did not return after Shutdown")
+	}
+	for id := range d.devices {
+		if state, _ := d.states[id].State(); state != StateRemoving {
+			t.Errorf("%s state = %s, want %s", id, state, StateRemoving)
+		}
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if left := runtime.NumGoroutine() - before; left > 0 {
+		buf := make([]byte, 1<<16)
+		buf = buf[:runtime.Stack(buf, true)]
+		t.Fatalf("%d goroutines left after Shutdown:\n%s", left, buf)
+	}
+}
+
+func TestShutdownReleasesPanelWhileDraining(t *testing.T) {
+	d := &DevPanel{
+		deviceMuxs: make(map[string]context.CancelFunc),
+		devices:    make(map[string]*driver.CustomizedDev),
+		models:     make(map[string]common.DeviceModel),
+		states:     make(map[string]*StateMachine),
+	}
+	state := NewStateMachine("thermometer", nil)
+	d.states["thermometer"] = state
+	d.deviceMuxs["thermometer"] = func() {}
+	// an in-flight call which needs the panel once the mapper is shutting down
+	d.spawn(func() {
+		for s, _ := state.State(); s != StateRemoving; s, _ = state.State() {
+			time.Sleep(time.Millisecond)
+		}
+		d.serviceMutex.Lock()
+		d.serviceMutex.Unlock()
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := d.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+}
@@ -0,0 +1,299 @@
+/*
+Copyright 2024 The KubeEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package device
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	dmiapi "github.com/kubeedge/kubeedge/pkg/apis/dmi/v1beta1"
+	"github.com/kubeedge/mapper-framework/pkg/grpcclient"
+)
+
+// DeviceState is the lifecycle state of a device handled by the mapper.
+type DeviceState string
+
+// Device lifecycle states.
+const (
+	StateInitializing DeviceState = "initializing"
+	StateOnline       DeviceState = "online"
+	StateDegraded     DeviceState = "degraded"
+	StateOffline      DeviceState = "offline"
+	StateRemoving     DeviceState = "removing"
+)
+
+// MaxReadFailures is the number of consecutive failed reads after which
+// a degraded device is considered offline and gets reconnected.
+const MaxReadFailures = 3
+
+// StateReporter is called once for every state transition of a device.
+type StateReporter func(state DeviceState, reason string)
+
+// StateTwin is the twin which carries the lifecycle state of a device with
+// the reason of the last transition in its metadata, since the device state
+// reported to edgecore has no reason.
+const StateTwin = "deviceState"
+
+// stateQueueSize is the number of transitions of a device waiting to be sent.
+const stateQueueSize = 16
+
+// reportDeviceStates sends a device state to edgecore, tests replace it.
+var reportDeviceStates = grpcclient.ReportDeviceStates
+
+// reportDeviceStatus sends twin updates to edgecore, tests replace it.
+var reportDeviceStatus = grpcclient.ReportDeviceStatus
+
+// stateReporters counts the reporters which have not sent the removing state
+// of their device yet.
+var stateReporters sync.WaitGroup
+
+// stateReport is a transition of a device waiting to be sent.
+type stateReport struct {
+	state  DeviceState
+	reason string
+	at     time.Time
+}
+
+// reportDeviceState returns a StateReporter that sends every transition of
+// the device to edgecore, as the device state and as the value of the
+// StateTwin twin. The transitions are sent in order by a goroutine, so that
+// a slow edgecore doesn't block the device, which stops after the removing
+// state is sent.
+func reportDeviceState(name, namespace string) StateReporter {
+	queue := make(chan stateReport, stateQueueSize)
+	stateReporters.Add(1)
+	go func() {
+		defer stateReporters.Done()
+		for report := range queue {
+			sendDeviceState(name, namespace, report)
+		}
+	}()
+	return func(state DeviceState, reason string) {
+		select {
+		case queue <- stateReport{state: state, reason: reason, at: time.Now()}:
+		default:
+			klog.Errorf("fail to report state %s of device %s: too many pending reports", state, name)
+		}
+		if state == StateRemoving {
+			close(queue)
+		}
+	}
+}
+
+// waitStateReports waits until the reporters have sent the removing state of
+// their devices, or until ctx is done.
+func waitStateReports(ctx context.Context) error {
+	sent := make(chan struct{})
+	go func() {
+		stateReporters.Wait()
+		close(sent)
+	}()
+	select {
+	case <-sent:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("wait for device states to be reported: %w", ctx.Err())
+	}
+}
+
+func sendDeviceState(name, namespace string, report stateReport) {
+	states := &dmiapi.ReportDeviceStatesRequest{
+		DeviceName:      name,
+		DeviceNamespace: namespace,
+		State:           string(report.state),
+	}
+	if err := reportDeviceStates(states); err != nil {
+		klog.Errorf("fail to report state %s of device %s with err: %+v", report.state, name, err)
+	}
+	property := &dmiapi.TwinProperty{
+		Value: string(report.state),
+		Metadata: map[string]string{
+			"type":      "string",
+			"timestamp": strconv.FormatInt(report.at.UnixMilli(), 10),
+			"reason":    report.reason,
+		},
+	}
+	status := &dmiapi.ReportDeviceStatusRequest{
+		DeviceName:      name,
+		DeviceNamespace: namespace,
+		ReportedDevice: &dmiapi.DeviceStatus{
+			Twins: []*dmiapi.Twin{{PropertyName: StateTwin, Reported: property, ObservedDesired: property}},
+		},
+	}
+	if err := reportDeviceStatus(status); err != nil {
+		klog.Errorf("fail to report the reason of state %s of device %s with err: %+v", report.state, name, err)
+	}
+}
+
+// StateMachine tracks the lifecycle of a single device. Drivers and twin
+// collectors feed it with the outcome of their operations and it reports
+// a transition only when the state actually changes.
+type StateMachine struct {
+	mutex    sync.Mutex
+	name     string
+	state    DeviceState
+	reason   string
+	failures int
+	lost     chan struct{}
+	report   StateReporter
+}
+
+// NewStateMachine returns a state machine in the initializing state and
+// reports that state right away.
+func NewStateMachine(name string, report StateReporter) *StateMachine {
+	m := &StateMachine{
+		name:   name,
+		lost:   make(chan struct{}, 1),
+		report: report,
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.transition(StateInitializing, "device is being initialized")
+	return m
+}
+
+// State returns the current state and the reason of the last transition.
+func (m *StateMachine) State() (DeviceState, string) {
+	if m == nil {
+		return StateInitializing, ""
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.state, m.reason
+}
+
+// Lost is signalled when a connected device goes offline and should be
+// reconnected.
+func (m *StateMachine) Lost() <-chan struct{} {
+	return m.lost
+}
+
+// Connected records a successful (re)connection to the device.
+func (m *StateMachine) Connected() {
+	if m == nil {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.failures = 0
+	select {
+	case <-m.lost:
+	default:
+	}
+	m.transition(StateOnline, "device connected")
+}
+
+// ConnectFailed records a failed connection attempt.
+func (m *StateMachine) ConnectFailed(attempt int, err error) {
+	if m == nil {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	klog.V(2).Infof("Connect device %s attempt %d failed: %v", m.name, attempt, err)
+	m.transition(StateOffline, fmt.Sprintf("connect attempt %d failed: %v", attempt, err))
+}
+
+// ReadSucceeded records a successful read and brings a degraded device
+// back online.
+func (m *StateMachine) ReadSucceeded() {
+	if m == nil {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.failures = 0
+	m.transition(StateOnline, "device data read successfully")
+}
+
+// ReadFailed records a failed read. The device is degraded on the first
+// failure and offline after MaxReadFailures consecutive ones.
+func (m *StateMachine) ReadFailed(err error) {
+	if m == nil {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.failures++
+	if m.failures < MaxReadFailures {
+		m.transition(StateDegraded, fmt.Sprintf("read failed: %v", err))
+		return
+	}
+	m.goOffline(fmt.Sprintf("%d consecutive reads failed: %v", m.failures, err))
+}
+
+// DriverError records an error reported by the driver itself, which takes
+// the device offline immediately.
+func (m *StateMachine) DriverError(err error) {
+	if m == nil {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.goOffline(fmt.Sprintf("driver error: %v", err))
+}
+
+// Removing marks the device as being removed. No transition is reported
+// after that.
+func (m *StateMachine) Removing(reason string) {
+	if m == nil {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.transition(StateRemoving, reason)
+}
+
+func (m *StateMachine) goOffline(reason string) {
+	if m.state == StateOffline || m.state == StateRemoving {
+		return
+	}
+	m.transition(StateOffline, reason)
+	select {
+	case m.lost <- struct{}{}:
+	default:
+	}
+}
+
+// transition must be called with the mutex held. The report only queues the
+// transition, so that transitions reach edgecore in order without waiting for
+// edgecore under the mutex.
+func (m *StateMachine) transition(state DeviceState, reason string) {
+	if m.state == state || m.state == StateRemoving {
+		return
+	}
+	klog.Infof("Device %s state changed from %q to %q: %s", m.name, m.state, state, reason)
+	m.state = state
+	m.reason = reason
+	if m.report != nil {
+		m.report(state, reason)
+	}
+}
+
+// reconnectBackoff returns how long to wait before the given connect attempt.
+func reconnectBackoff(attempt int) time.Duration {
+	backoff := time.Second << uint(attempt-1)
+	if attempt > 6 || backoff > 30*time.Second {
+		return 30 * time.Second
+	}
+	return backoff
+}
@@ -0,0 +1,170 @@
+/*
+Copyright 2024 The KubeEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package device
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	dmiapi "github.com/kubeedge/kubeedge/pkg/apis/dmi/v1beta1"
+	"github.com/kubeedge/mapper-framework/pkg/common"
+	"github.com/kubeedge/mapper-framework/pkg/grpcclient"
+	"github.com/kubeedge/mqtt/driver"
+)
+
+// statusConfig is device config data whose status field is read by GetDeviceStates.
+type statusConfig struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+}
+
+func newDeviceStates(status string) (*DeviceStates, *statusConfig) {
+	config := &statusConfig{Name: "thermometer", Status: status}
+	return &DeviceStates{
+		Client:        &driver.CustomizedClient{DeviceConfigData: config},
+		DeviceName:    "thermometer",
+		VisitorConfig: &driver.VisitorConfig{VisitorConfigData: driver.VisitorConfigData{SerializedFormat: driver.JSON}},
+		State:         NewStateMachine("thermometer", nil),
+	}, config
+}
+
+func TestDisconnectedStatusTakesDeviceOffline(t *testing.T) {
+	states, _ := newDeviceStates(common.DeviceStatusDisCONN)
+	states.State.Connected()
+
+	states.PushStatesToEdgeCore()
+	state, reason := states.State.State()
+	if state != StateOffline {
+		t.Fatalf("state = %s, want %s", state, StateOffline)
+	}
+	if want := "driver error: device reports " + common.DeviceStatusDisCONN; reason != want {
+		t.Errorf("reason = %q, want %q", reason, want)
+	}
+	select {
+	case <-states.State.Lost():
+	default:
+		t.Fatal("an offline device is not reconnected")
+	}
+}
+
+func TestOKStatusOnlyRevivesOfflineDevice(t *testing.T) {
+	states, config := newDeviceStates(common.DeviceStatusOK)
+	states.State.Connected()
+
+	// read failures decide whether the device is degraded, the status doesn't hide them
+	states.State.ReadFailed(errors.New("no message"))
+	states.PushStatesToEdgeCore()
+	if state, _ := states.State.State(); state != StateDegraded {
+		t.Fatalf("state = %s, want %s", state, StateDegraded)
+	}
+
+	config.Status = common.DeviceStatusDisCONN
+	states.PushStatesToEdgeCore()
+	config.Status = common.DeviceStatusOK
+	states.PushStatesToEdgeCore()
+	if state, _ := states.State.State(); state != StateOnline {
+		t.Fatalf("state = %s, want %s", state, StateOnline)
+	}
+}
+
+func TestReportDeviceState(t *testing.T) {
+	states := make(chan *dmiapi.ReportDeviceStatesRequest, 8)
+	twins := make(chan *dmiapi.ReportDeviceStatusRequest, 8)
+	reportDeviceStates = func(request *dmiapi.ReportDeviceStatesRequest) error {
+		states <- request
+		return nil
+	}
+	reportDeviceStatus = func(request *dmiapi.ReportDeviceStatusRequest) error {
+		twins <- request
+		return nil
+	}
+	defer func() {
+		reportDeviceStates = grpcclient.ReportDeviceStates
+		reportDeviceStatus = grpcclient.ReportDeviceStatus
+	}()
+
+	m := NewStateMachine("thermometer-id", reportDeviceState("thermometer", "default"))
+	m.ConnectFailed(1, errors.New("connection refused"))
+	m.Connected()
+	m.Removing("device is being removed")
+
+	want := []struct {
+		state  DeviceState
+		reason string
+	}{
+		{StateInitializing, "device is being initialized"},
+		{StateOffline, "connect attempt 1 failed: connection refused"},
+		{StateOnline, "device connected"},
+		{StateRemoving, "device is being removed"},
+	}
+	for _, w := range want {
+		select {
+		case request := <-states:
+			if request.DeviceName != "thermometer" || request.DeviceNamespace != "default" || request.State != string(w.state) {
+				t.Errorf("state request = %+v, want %s", request, w.state)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("state %s not reported", w.state)
+		}
+		select {
+		case request := <-twins:
+			reported := request.ReportedDevice.Twins
+			if len(reported) != 1 || reported[0].PropertyName != StateTwin {
+				t.Fatalf("twins = %v, want one %s twin", reported, StateTwin)
+			}
+			if value := reported[0].Reported; value.Value != string(w.state) || value.Metadata["reason"] != w.reason {
+				t.Errorf("reported %q (%q), want %q (%q)", value.Value, value.Metadata["reason"], w.state, w.reason)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("reason of state %s not reported", w.state)
+		}
+	}
+}
+
+func TestDeregisterReportsRemoving(t *testing.T) {
+	sent := make(chan string, 8)
+	reportDeviceStates = func(request *dmiapi.ReportDeviceStatesRequest) error {
+		sent <- request.State
+		return nil
+	}
+	reportDeviceStatus = func(*dmiapi.ReportDeviceStatusRequest) error { return nil }
+	defer func() {
+		reportDeviceStates = grpcclient.ReportDeviceStates
+		reportDeviceStatus = grpcclient.ReportDeviceStatus
+	}()
+	d := &DevPanel{states: map[string]*StateMachine{
+		"thermometer-id": NewStateMachine("thermometer-id", reportDeviceState("thermometer", "default")),
+	}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := d.Deregister(ctx); err != nil {
+		t.Fatalf("Deregister() error = %v", err)
+	}
+	// the reports are sent once Deregister returns
+	close(sent)
+	var states []string
+	for state := range sent {
+		states = append(states, state)
+	}
+	if want := []string{string(StateInitializing), string(StateRemoving)}; strings.Join(states, ",") != strings.Join(want, ",") {
+		t.Errorf("reported %v, want %v", states, want)
+	}
+}
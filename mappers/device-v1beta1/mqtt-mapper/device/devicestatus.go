@@ -18,14 +18,13 @@ package device
 
 import (
 	"context"
-	"log"
+	"fmt"
 	"time"
 
 	"k8s.io/klog/v2"
 
+	"github.com/kubeedge/mapper-framework/pkg/common"
 	"github.com/kubeedge/mqtt/driver"
-	dmiapi "github.com/kubeedge/kubeedge/pkg/apis/dmi/v1beta1"
-	"github.com/kubeedge/mapper-framework/pkg/grpcclient"
 )
 
 // DeviceStates is structure for getting device states.
@@ -33,31 +32,36 @@ type DeviceStates struct {
 	Client          *driver.CustomizedClient
 	DeviceName      string
 	DeviceNamespace string
+	VisitorConfig   *driver.VisitorConfig
+	State           *StateMachine
 }
 
-// Run timer function.
+// PushStatesToEdgeCore feeds the state read from the device into its state
+// machine, which reports the transitions to edgecore.
 func (deviceStates *DeviceStates) PushStatesToEdgeCore() {
-	states, error := deviceStates.Client.GetDeviceStates()
-	if error != nil {
-		klog.Errorf("GetDeviceStates failed: %v", error)
+	states, err := deviceStates.Client.GetDeviceStates(deviceStates.VisitorConfig)
+	if err != nil {
+		klog.Errorf("GetDeviceStates failed: %v", err)
+		deviceStates.State.DriverError(err)
 		return
 	}
 
-	statesRequest := &dmiapi.ReportDeviceStatesRequest{
-		DeviceName:      deviceStates.DeviceName,
-		State:           states,
-		DeviceNamespace: deviceStates.DeviceNamespace,
-	}
-
-	log.Printf("send statesRequest", statesRequest.DeviceName, statesRequest.State)
-	if err := grpcclient.ReportDeviceStates(statesRequest); err != nil {
-		klog.Errorf("fail to report device states of %s with err: %+v", deviceStates.DeviceName, err)
+	klog.V(4).Infof("Device %s reports state %s", deviceStates.DeviceName, states)
+	switch states {
+	case common.DeviceStatusOK:
+		// only bring an offline device back, read failures decide between online and degraded
+		if state, _ := deviceStates.State.State(); state == StateOffline {
+			deviceStates.State.Connected()
+		}
+	case common.DeviceStatusDisCONN:
+		deviceStates.State.DriverError(fmt.Errorf("device reports %s", states))
 	}
 }
 
 func (deviceStates *DeviceStates) Run(ctx context.Context) {
 	// TODO setting states reportCycle
 	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
 	for {
 		select {
 		case <-ticker.C:
@@ -65,6 +65,9 @@ func (c *CustomizedClient) SetDeviceData(visitor *VisitorConfig) error {
 }
 
 func (c *CustomizedClient) StopDevice() error {
+	if c.DeviceConfigData == nil {
+		return nil
+	}
 	updateFieldsByTag(c.DeviceConfigData, map[string]interface{}{
 		"status": common.DeviceStatusDisCONN,
 		"Status": common.DeviceStatusDisCONN,
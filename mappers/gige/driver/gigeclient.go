@@ -1,141 +1,24 @@
 package driver
 
-/*
-#include <dlfcn.h>
-#include <stdlib.h>
-int open_device(unsigned int** device, char* deviceSN, char** error)
-{
-    void* handle;
-    int result = -1;
-    typedef int (*FPTR)(unsigned int**, char*, char**);
-    handle = dlopen("../bin/librcapi.so", 1);
-    if(handle == NULL){
-        *error = (char *)dlerror();
-        return result;
-    }
-    FPTR fptr = (FPTR)dlsym(handle, "open_device");
-    if(fptr == NULL){
-        *error = (char *)dlerror();
-        result = -2;
-    } else {
-        result = (*fptr)(device, deviceSN, error);
-    }
-    dlclose(handle);
-    return result;
-}
-int set_value (unsigned int* device, char* feature, char* value, char** error)
-{
-    void* handle;
-    int result = -1;
-    typedef int (*FPTR)(unsigned int*, char*, char*, char**);
-    handle = dlopen("../bin/librcapi.so", 1);
-    if(handle == NULL){
-        *error = (char *)dlerror();
-        return result;
-    }
-    FPTR fptr = (FPTR)dlsym(handle, "set_value");
-    if(fptr == NULL){
-        *error = (char *)dlerror();
-        result = -2;
-    } else {
-        result = (*fptr)(device, feature, value, error);
-    }
-    dlclose(handle);
-    return result;
-}
-int get_value (unsigned int* device, char* feature, char** value, char** error)
-{
-    void* handle;
-    int result = -1;
-    typedef int (*FPTR)(unsigned int*, char*, char**, char**);
-	handle = dlopen("../bin/librcapi.so", 1);
-    if(handle == NULL){
-        *error = (char *)dlerror();
-        return result;
-    }
-    FPTR fptr = (FPTR)dlsym(handle, "get_value");
-    if(fptr == NULL){
-        *error = (char *)dlerror();
-        result = -2;
-    } else {
-        result = (*fptr)(device, feature, value, error);
-    }
-    dlclose(handle);
-    return result;
-}
-int get_image (unsigned int* device, char* type, char** bufferPointer, int* size, char** error)
-{
-    void* handle;
-    int result = -1;
-    typedef int (*FPTR)(unsigned int*, char*, char**, int*, char**);
-    handle = dlopen("../bin/librcapi.so", 1);
-    if(handle == NULL){
-        *error = (char *)dlerror();
-        return result;
-    }
-    FPTR fptr = (FPTR)dlsym(handle, "get_image");
-    if(fptr == NULL){
-        *error = (char *)dlerror();
-        result = -2;
-    } else {
-        result = (*fptr)(device, type, bufferPointer, size, error);
-    }
-    dlclose(handle);
-    return result;
-}
-int close_device (unsigned int* device)
-{
-    void* handle;
-    typedef void (*FPTR)(unsigned int*);
-    handle = dlopen("../bin/librcapi.so", 1);
-    if(handle == NULL){
-        return -1;
-    }
-    FPTR fptr = (FPTR)dlsym(handle, "close_device");
-    if(fptr == NULL){
-	dlclose(handle);
-        return -2;
-    } else {
-        (*fptr)(device);
-    }
-    dlclose(handle);
-    return 0;
-}
-int free_image (char** bufferPointer)
-{
-    void* handle;
-    typedef void (*FPTR)(char** bufferPointer);
-    handle = dlopen("../bin/librcapi.so", 1);
-    if(handle == NULL){
-        return -1;
-    }
-    FPTR fptr = (FPTR)dlsym(handle, "free_image");
-    if(fptr == NULL){
-	dlclose(handle);
-        return -2;
-    } else {
-        (*fptr)(bufferPointer);
-    }
-    dlclose(handle);
-    return 0;
-}
-#cgo LDFLAGS: -ldl
-*/
-import "C"
 import (
+	"context"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
-	"io"
-	"io/ioutil"
 	"k8s.io/klog/v2"
-	"net/http"
-	"net/url"
-	"reflect"
 	"strconv"
 	"strings"
-	"unsafe"
+	"time"
+
+	"github.com/kubeedge/mappers-go/mappers/gige/driver/imagesink"
 )
 
+// legacyImageSink is the name of the sink of the images posted to the ImageURL feature
+const legacyImageSink = "imageURL"
+
+// exposureFeatures are the features of the exposure time of cameras, in microseconds
+var exposureFeatures = []string{"ExposureTime", "ExposureTimeAbs"}
+
 func (gigEClient *GigEVisionDevice) Set(DeviceSN string, value interface{}) (err error) {
 	convertValue, err := gigEClient.convert(value)
 	if err != nil {
@@ -156,24 +39,24 @@ func (gigEClient *GigEVisionDevice) Set(DeviceSN string, value interface{}) (err
 		}
 	case "ImageURL":
 		convertValue = strings.TrimSpace(convertValue)
-		_, err := url.Parse(convertValue)
+		sink, err := imagesink.NewHTTP(imagesink.HTTPConfig{URL: convertValue, Encoding: imagesink.EncodingForm})
 		if err != nil {
 			err = fmt.Errorf("set imageURL failed because of incorrect format, message: %s", err)
 			return err
 		}
 		gigEClient.deviceMeta[DeviceSN].imageURL = convertValue
+		gigEClient.deviceMeta[DeviceSN].sinks.Set(legacyImageSink, imagesink.TypeHTTP, sink, imagesink.RetryConfig{})
 		gigEClient.PostImage(DeviceSN)
+	case "PostImage", "ImageSinkMetrics":
+		return fmt.Errorf("%s of device %s is read only", gigEClient.deviceMeta[DeviceSN].FeatureName, DeviceSN)
 	default:
-		var msg *C.char
-		defer C.free(unsafe.Pointer(msg))
-		signal := C.set_value(gigEClient.deviceMeta[DeviceSN].dev, C.CString(gigEClient.deviceMeta[DeviceSN].FeatureName), C.CString(convertValue), &msg)
-		if signal != 0 {
-			err = fmt.Errorf("set %s from device %s failed: %s", gigEClient.deviceMeta[DeviceSN].FeatureName, DeviceSN, (string)(C.GoString(msg)))
-			if signal > 1 {
-				gigEClient.deviceMeta[DeviceSN].deviceStatus = false
-				go gigEClient.ReconnectDevice(DeviceSN)
-			}
-			return err
+		cam, ok := gigEClient.deviceMeta[DeviceSN].getCamera()
+		if !ok {
+			return fmt.Errorf("device %s is unreachable", DeviceSN)
+		}
+		if err = cam.set(gigEClient.deviceMeta[DeviceSN].FeatureName, convertValue); err != nil {
+			gigEClient.lost(DeviceSN, err)
+			return fmt.Errorf("set %s from device %s failed: %v", gigEClient.deviceMeta[DeviceSN].FeatureName, DeviceSN, err)
 		}
 	}
 	return nil
@@ -182,26 +65,11 @@ func (gigEClient *GigEVisionDevice) Set(DeviceSN string, value interface{}) (err
 func (gigEClient *GigEVisionDevice) Get(DeviceSN string) (results string, err error) {
 	switch gigEClient.deviceMeta[DeviceSN].FeatureName {
 	case "ImageTrigger":
-		var imageBuffer *byte
-		var size int
-		var msg *C.char
-		defer C.free(unsafe.Pointer(msg))
-		signal := C.get_image(gigEClient.deviceMeta[DeviceSN].dev, C.CString(gigEClient.deviceMeta[DeviceSN].imageFormat), (**C.char)(unsafe.Pointer(&imageBuffer)), (*C.int)(unsafe.Pointer(&size)), &msg)
-		if signal != 0 {
-			err = fmt.Errorf("failed to get %s's images: %s", DeviceSN, (string)(C.GoString(msg)))
-			if signal >= 4 {
-				gigEClient.deviceMeta[DeviceSN].deviceStatus = false
-				go gigEClient.ReconnectDevice(DeviceSN)
-			}
+		buffer, err := gigEClient.image(DeviceSN)
+		if err != nil {
 			return "", err
 		}
-		var buffer []byte
-		var bufferHdr = (*reflect.SliceHeader)(unsafe.Pointer(&buffer))
-		bufferHdr.Data = uintptr(unsafe.Pointer(imageBuffer))
-		bufferHdr.Len = size
-		bufferHdr.Cap = size
 		results = base64.StdEncoding.EncodeToString(buffer)
-		C.free_image((**C.char)(unsafe.Pointer(&imageBuffer)))
 	case "ImageFormat":
 		if gigEClient.deviceMeta[DeviceSN].imageFormat != "" {
 			results = gigEClient.deviceMeta[DeviceSN].imageFormat
@@ -218,28 +86,33 @@ func (gigEClient *GigEVisionDevice) Get(DeviceSN string) (results string, err er
 		}
 		gigEClient.PostImage(DeviceSN)
 		return results, nil
-	default:
-		var msg *C.char
-		var value *C.char
-		defer C.free(unsafe.Pointer(msg))
-		defer C.free(unsafe.Pointer(value))
-		signal := C.get_value(gigEClient.deviceMeta[DeviceSN].dev, C.CString(gigEClient.deviceMeta[DeviceSN].FeatureName), &value, &msg)
-		if signal != 0 {
-			err = fmt.Errorf("get %s from device %s's failed: %s", gigEClient.deviceMeta[DeviceSN].FeatureName, DeviceSN, (string)(C.GoString(msg)))
-			if signal > 1 {
-				gigEClient.deviceMeta[DeviceSN].deviceStatus = false
-				go gigEClient.ReconnectDevice(DeviceSN)
-			}
+	case "PostImage":
+		// the images are posted to the image sinks each time the feature is read
+		results, err = gigEClient.PostImage(DeviceSN)
+		if err != nil {
 			return "", err
 		}
-		results = C.GoString(value)
+	case "ImageSinkMetrics":
+		metrics, err := json.Marshal(gigEClient.deviceMeta[DeviceSN].sinks.Metrics())
+		if err != nil {
+			return "", err
+		}
+		results = string(metrics)
+	default:
+		cam, ok := gigEClient.deviceMeta[DeviceSN].getCamera()
+		if !ok {
+			return "", fmt.Errorf("device %s is unreachable", DeviceSN)
+		}
+		results, err = cam.get(gigEClient.deviceMeta[DeviceSN].FeatureName)
+		if err != nil {
+			gigEClient.lost(DeviceSN, err)
+			return "", fmt.Errorf("get %s from device %s's failed: %v", gigEClient.deviceMeta[DeviceSN].FeatureName, DeviceSN, err)
+		}
 	}
 	return results, err
 }
 
 func (gigEClient *GigEVisionDevice) NewClient(DeviceSN string) (err error) {
-	var msg *C.char
-	var dev *C.uint
 	if gigEClient.deviceMeta == nil {
 		gigEClient.deviceMeta = make(map[string]*DeviceMeta)
 	}
@@ -247,82 +120,123 @@ func (gigEClient *GigEVisionDevice) NewClient(DeviceSN string) (err error) {
 		err = fmt.Errorf("deviceSN can not be empty")
 		return err
 	}
-	_, ok := gigEClient.deviceMeta[DeviceSN]
+	meta, ok := gigEClient.deviceMeta[DeviceSN]
 	if !ok {
-		signal := C.open_device(&dev, C.CString(DeviceSN), &msg)
-		if signal != 0 {
-			klog.Errorf("Failed to open device %s: %s.", DeviceSN, (string)(C.GoString(msg)))
-			gigEClient.deviceMeta[DeviceSN] = &DeviceMeta{
-				dev:           nil,
-				deviceStatus:  false,
-				imageFormat:   "jpeg",
-				imageURL:      "",
-				FeatureName:   "",
-				maxRetryTimes: 100,
-			}
-			go gigEClient.ReconnectDevice(DeviceSN)
-			return nil
+		sinks, err := imagesink.NewUploader(gigEClient.protocolCommonConfig.ImageSinks)
+		if err != nil {
+			return fmt.Errorf("configure the image sinks of device %s: %v", DeviceSN, err)
 		}
-		gigEClient.deviceMeta[DeviceSN] = &DeviceMeta{
-			dev:           dev,
-			deviceStatus:  true,
+		meta = &DeviceMeta{
+			config:        gigEClient.protocolCommonConfig.CommonCustomizedValues,
+			sinks:         sinks,
 			imageFormat:   "jpeg",
 			imageURL:      "",
 			FeatureName:   "",
 			maxRetryTimes: 100,
 		}
+		gigEClient.deviceMeta[DeviceSN] = meta
+	} else if open, err := gigEClient.restart(DeviceSN, meta); err != nil || !open {
+		return err
+	}
+	cam, err := openCamera(meta.config)
+	if err != nil {
+		klog.Errorf("Failed to open device %s: %v.", DeviceSN, err)
+		gigEClient.reconnect(DeviceSN, meta)
+		return nil
 	}
+	meta.mutex.Lock()
+	meta.cam = cam
+	meta.deviceStatus = true
+	meta.mutex.Unlock()
 	return nil
 }
 
-func (gigEClient *GigEVisionDevice) PostImage(DeviceSN string) {
-	var imageBuffer *byte
-	var size int
-	var p = &imageBuffer
-	var msg *C.char
-	defer C.free(unsafe.Pointer(msg))
-	signal := C.get_image(gigEClient.deviceMeta[DeviceSN].dev, C.CString(gigEClient.deviceMeta[DeviceSN].imageFormat), (**C.char)(unsafe.Pointer(p)), (*C.int)(unsafe.Pointer(&size)), &msg)
-	if signal != 0 {
-		klog.Errorf("Failed to get %s's images: %s.", DeviceSN, (string)(C.GoString(msg)))
-		if signal > 1 {
-			gigEClient.deviceMeta[DeviceSN].deviceStatus = false
-			go gigEClient.ReconnectDevice(DeviceSN)
+// restart open the image sinks of a device again after it was stopped, and tell whether its camera is
+// to be opened. The camera of a device which is reconnecting is opened by the reconnection.
+func (gigEClient *GigEVisionDevice) restart(DeviceSN string, meta *DeviceMeta) (bool, error) {
+	meta.mutex.Lock()
+	defer meta.mutex.Unlock()
+	if !meta.stopped {
+		return false, nil
+	}
+	config := gigEClient.protocolCommonConfig.CommonCustomizedValues
+	if err := meta.sinks.Open(config.ImageSinks); err != nil {
+		return false, fmt.Errorf("configure the image sinks of device %s: %v", DeviceSN, err)
+	}
+	meta.config = config
+	if meta.imageURL != "" {
+		sink, err := imagesink.NewHTTP(imagesink.HTTPConfig{URL: meta.imageURL, Encoding: imagesink.EncodingForm})
+		if err == nil {
+			meta.sinks.Set(legacyImageSink, imagesink.TypeHTTP, sink, imagesink.RetryConfig{})
 		}
-		return
+	}
+	meta.stopped = false
+	return !meta.reconnecting, nil
+}
+
+// image grab an image of a device in its image format
+func (gigEClient *GigEVisionDevice) image(DeviceSN string) ([]byte, error) {
+	cam, ok := gigEClient.deviceMeta[DeviceSN].getCamera()
+	if !ok {
+		return nil, fmt.Errorf("device %s is unreachable", DeviceSN)
+	}
+	buffer, err := cam.image(gigEClient.deviceMeta[DeviceSN].imageFormat)
+	if err != nil {
+		gigEClient.lost(DeviceSN, err)
+		return nil, fmt.Errorf("failed to get %s's images: %v", DeviceSN, err)
+	}
+	return buffer, nil
+}
+
+// PostImage grab an image of a device and upload it to its image sinks in the background, and get the
+// file name of the image
+func (gigEClient *GigEVisionDevice) PostImage(DeviceSN string) (string, error) {
+	meta := gigEClient.deviceMeta[DeviceSN]
+	if meta.sinks.Len() == 0 {
+		err := fmt.Errorf("failed to post %s's images: no image sink is configured", DeviceSN)
+		klog.Errorf("%v.", err)
+		return "", err
+	}
+	buffer, err := gigEClient.image(DeviceSN)
+	if err != nil {
+		klog.Errorf("%v.", err)
+		return "", err
+	}
+	image := &imagesink.Image{
+		Data: buffer,
+		Metadata: imagesink.Metadata{
+			SerialNumber: DeviceSN,
+			Timestamp:    time.Now(),
+			Format:       meta.imageFormat,
+			ExposureTime: gigEClient.exposureTime(DeviceSN),
+		},
 	}
 	go func() {
-		var buffer []byte
-		var bufferHdr = (*reflect.SliceHeader)(unsafe.Pointer(&buffer))
-		bufferHdr.Data = uintptr(unsafe.Pointer(imageBuffer))
-		bufferHdr.Len = size
-		bufferHdr.Cap = size
-		postStr := base64.URLEncoding.EncodeToString(buffer)
-		v := url.Values{}
-		v.Set("gigEImage", postStr)
-		body := ioutil.NopCloser(strings.NewReader(v.Encode()))
-		req, _ := http.NewRequest(http.MethodPost, gigEClient.deviceMeta[DeviceSN].imageURL, body)
-		if req == nil {
-			klog.Errorf("Failed to post %s's images: URL can't POST.", DeviceSN)
-			return
-		}
-		req.Header.Set("Content-Type", "application/x-www-form-urlencoded; param=value")
-		client := &http.Client{}
-		resp, _ := client.Do(req)
-		if resp == nil {
-			klog.Errorf("Failed to post %s's images: URL no reaction.", DeviceSN)
+		if err := meta.sinks.Upload(context.Background(), image); err != nil {
+			klog.Errorf("Failed to post %s's images: %v.", DeviceSN, err)
 			return
 		}
-		defer func(Body io.ReadCloser) {
-			err := Body.Close()
-			if err != nil {
-
-			}
-		}(resp.Body)
-		data, _ := ioutil.ReadAll(resp.Body)
-		fmt.Println("response Status:", resp.Status)
-		fmt.Println("response Headers:", resp.Header)
-		fmt.Println("response Body:", string(data))
+		klog.V(4).Infof("Posted image %s of device %s.", image.FileName(), DeviceSN)
 	}()
+	return image.FileName(), nil
+}
+
+// exposureTime get the exposure time of a device in microseconds, 0 if the camera does not report it
+func (gigEClient *GigEVisionDevice) exposureTime(DeviceSN string) float64 {
+	cam, ok := gigEClient.deviceMeta[DeviceSN].getCamera()
+	if !ok {
+		return 0
+	}
+	for _, feature := range exposureFeatures {
+		value, err := cam.get(feature)
+		if err != nil {
+			continue
+		}
+		if exposure, err := strconv.ParseFloat(value, 64); err == nil {
+			return exposure
+		}
+	}
+	return 0
 }
 
 func (gigEClient *GigEVisionDevice) convert(value interface{}) (convertValue string, err error) {
@@ -363,4 +277,3 @@ func (gigEClient *GigEVisionDevice) convert(value interface{}) (convertValue str
 	}
 	return convertValue, nil
 }
-
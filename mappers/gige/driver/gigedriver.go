@@ -1,22 +1,14 @@
 package driver
 
-/*
-#include <dlfcn.h>
-#include <stdlib.h>
-int open_device(unsigned int** device,char* deviceId,char** error);
-int get_value (unsigned int* device, char* feature, char** value,char** error);
-int set_value (unsigned int* device, char* feature, char* value,char** error);
-int close_device (unsigned int* device);
-#cgo LDFLAGS: -ldl
-*/
-import "C"
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"k8s.io/klog/v2"
 	"sync"
 	"time"
-	"unsafe"
+
+	"github.com/kubeedge/mappers-go/mappers/gige/driver/imagesink"
 )
 
 type GigEVisionDeviceProtocolCommonConfig struct {
@@ -25,6 +17,14 @@ type GigEVisionDeviceProtocolCommonConfig struct {
 
 type CommonCustomizedValues struct {
 	DeviceSN string `json:"deviceSN"`
+	// Backend is how the camera is accessed, gvcp or rcapi. The default is rcapi if the mapper is built with
+	// cgo, gvcp otherwise.
+	Backend string `json:"backend,omitempty"`
+	// Address is the IP address of the camera for the gvcp backend, the camera is discovered by its
+	// DeviceSN if it is empty
+	Address string `json:"address,omitempty"`
+	// ImageSinks are where the images are posted, besides the URL of the ImageURL feature
+	ImageSinks []imagesink.Config `json:"imageSinks,omitempty"`
 }
 
 type GigEVisionDeviceVisitorConfig struct {
@@ -44,14 +44,63 @@ type GigEVisionDevice struct {
 }
 
 type DeviceMeta struct {
-	dev           *C.uint
+	// mutex protects cam and deviceStatus, which are changed when the device reconnects
+	mutex         sync.Mutex
+	cam           camera
+	config        CommonCustomizedValues
 	FeatureName   string
 	deviceStatus  bool
+	reconnecting  bool
+	stopped       bool
 	imageFormat   string
 	imageURL      string
+	sinks         *imagesink.Uploader
 	maxRetryTimes int
 }
 
+// camera is a camera opened by a backend
+type camera interface {
+	// get the value of a feature as a string
+	get(feature string) (string, error)
+	// set the value of a feature from a string
+	set(feature string, value string) error
+	// image grab an image encoded in format, jpeg, png or pnm
+	image(format string) ([]byte, error)
+	close()
+}
+
+// errDisconnected is wrapped by the errors of cameras which can not be reached any more
+var errDisconnected = errors.New("the camera is disconnected")
+
+// backends open the cameras of their protocol
+var backends = map[string]func(config CommonCustomizedValues) (camera, error){
+	gvcpBackend: openGVCPCamera,
+}
+
+var defaultBackend = gvcpBackend
+
+// reconnectInterval is the time between two attempts to reconnect a device
+var reconnectInterval = 5 * time.Second
+
+func openCamera(config CommonCustomizedValues) (camera, error) {
+	name := config.Backend
+	if name == "" {
+		name = defaultBackend
+	}
+	open, ok := backends[name]
+	if !ok {
+		return nil, fmt.Errorf("backend %s of device %s is not supported", name, config.DeviceSN)
+	}
+	return open(config)
+}
+
+// getCamera get the camera of a device if it is reachable
+func (meta *DeviceMeta) getCamera() (camera, bool) {
+	meta.mutex.Lock()
+	defer meta.mutex.Unlock()
+	return meta.cam, meta.deviceStatus
+}
+
 func (gigEClient *GigEVisionDevice) InitDevice(protocolCommon []byte) (err error) {
 	if protocolCommon != nil {
 		if err = json.Unmarshal(protocolCommon, &gigEClient.protocolCommonConfig); err != nil {
@@ -92,7 +141,7 @@ func (gigEClient *GigEVisionDevice) ReadDeviceData(protocolCommon, visitor, _ []
 	if err != nil {
 		return nil, err
 	}
-	if !gigEClient.deviceMeta[deviceSN].deviceStatus {
+	if _, ok := gigEClient.deviceMeta[deviceSN].getCamera(); !ok {
 		err = fmt.Errorf("device %s is unreachable and failed to read device %s data", deviceSN, gigEClient.deviceMeta[deviceSN].FeatureName)
 		return nil, err
 	}
@@ -109,7 +158,7 @@ func (gigEClient *GigEVisionDevice) WriteDeviceData(data interface{}, protocolCo
 	if err != nil {
 		return err
 	}
-	if !gigEClient.deviceMeta[deviceSN].deviceStatus {
+	if _, ok := gigEClient.deviceMeta[deviceSN].getCamera(); !ok {
 		err = fmt.Errorf("device %s is unreachable and failed to get %s", deviceSN, gigEClient.deviceMeta[deviceSN].FeatureName)
 		return err
 	}
@@ -123,11 +172,16 @@ func (gigEClient *GigEVisionDevice) WriteDeviceData(data interface{}, protocolCo
 // StopDevice is an interface to disconnect a specific device
 func (gigEClient *GigEVisionDevice) StopDevice() (err error) {
 	for s := range gigEClient.deviceMeta {
-		if gigEClient.deviceMeta[s].deviceStatus {
-			C.close_device(gigEClient.deviceMeta[s].dev)
-			gigEClient.deviceMeta[s].dev = nil
-			gigEClient.deviceMeta[s].deviceStatus = false
+		meta := gigEClient.deviceMeta[s]
+		meta.mutex.Lock()
+		if meta.cam != nil {
+			meta.cam.close()
+			meta.cam = nil
 		}
+		meta.deviceStatus = false
+		meta.stopped = true
+		meta.mutex.Unlock()
+		meta.sinks.Close()
 	}
 	fmt.Println("----------Stop GigE Device Successful----------")
 	return nil
@@ -136,33 +190,71 @@ func (gigEClient *GigEVisionDevice) StopDevice() (err error) {
 // GetDeviceStatus is an interface to get the device status, true is OK , false is DISCONNECTED
 func (gigEClient *GigEVisionDevice) GetDeviceStatus(protocolCommon, visitor, _ []byte) (status bool) {
 	deviceSN, err := gigEClient.ParseConfig(protocolCommon, visitor)
-	if err == nil {
+	if err != nil {
 		return false
 	}
-	return gigEClient.deviceMeta[deviceSN].deviceStatus
+	_, status = gigEClient.deviceMeta[deviceSN].getCamera()
+	return status
 }
 
+// ReconnectDevice close a device and open it again in the background
 func (gigEClient *GigEVisionDevice) ReconnectDevice(DeviceSN string) {
-	var msg *C.char
-	var dev *C.uint
-	defer C.free(unsafe.Pointer(msg))
-	if gigEClient.deviceMeta[DeviceSN].dev != nil {
-		C.close_device(gigEClient.deviceMeta[DeviceSN].dev)
-	}
-	gigEClient.deviceMeta[DeviceSN].dev = nil
-	retryTimes := 0
-	for retryTimes < gigEClient.deviceMeta[DeviceSN].maxRetryTimes {
-		time.Sleep(5 * time.Second)
-		signal := C.open_device(&dev, C.CString(DeviceSN), &msg)
-		if signal != 0 {
-			klog.Errorf("Failed to restart device %s: %s.", DeviceSN, (string)(C.GoString(msg)))
-		} else {
-			gigEClient.deviceMeta[DeviceSN].dev = dev
-			gigEClient.deviceMeta[DeviceSN].deviceStatus = true
-			break
-		}
-		retryTimes++
+	gigEClient.reconnect(DeviceSN, gigEClient.deviceMeta[DeviceSN])
+}
+
+// lost mark a device unreachable if err tells that its camera is disconnected, and reconnect it
+func (gigEClient *GigEVisionDevice) lost(DeviceSN string, err error) {
+	if errors.Is(err, errDisconnected) {
+		gigEClient.ReconnectDevice(DeviceSN)
 	}
-	fmt.Printf("Device %s restart success!\n", DeviceSN)
 }
 
+func (gigEClient *GigEVisionDevice) reconnect(DeviceSN string, meta *DeviceMeta) {
+	meta.mutex.Lock()
+	defer meta.mutex.Unlock()
+	if meta.cam != nil {
+		meta.cam.close()
+		meta.cam = nil
+	}
+	meta.deviceStatus = false
+	if meta.reconnecting {
+		return
+	}
+	meta.reconnecting = true
+	go func() {
+		retryTimes := 0
+		for {
+			meta.mutex.Lock()
+			if meta.stopped || retryTimes >= meta.maxRetryTimes {
+				meta.reconnecting = false
+				if !meta.stopped {
+					klog.Errorf("Failed to restart device %s after %d attempts.", DeviceSN, retryTimes)
+				}
+				meta.mutex.Unlock()
+				return
+			}
+			// the config is changed when a stopped device is started again
+			config := meta.config
+			meta.mutex.Unlock()
+			time.Sleep(reconnectInterval)
+			cam, err := openCamera(config)
+			retryTimes++
+			if err != nil {
+				klog.Errorf("Failed to restart device %s: %v.", DeviceSN, err)
+				continue
+			}
+			meta.mutex.Lock()
+			meta.reconnecting = false
+			if meta.stopped {
+				meta.mutex.Unlock()
+				cam.close()
+				return
+			}
+			meta.cam = cam
+			meta.deviceStatus = true
+			meta.mutex.Unlock()
+			fmt.Printf("Device %s restart success!\n", DeviceSN)
+			return
+		}
+	}()
+}
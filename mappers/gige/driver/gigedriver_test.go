@@ -0,0 +1,160 @@
+package driver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kubeedge/mappers-go/mappers/gige/driver/gvcp/gvcptest"
+	"github.com/kubeedge/mappers-go/mappers/gige/driver/imagesink"
+)
+
+func newTestDevice(t *testing.T) (*GigEVisionDevice, *gvcptest.Device, []byte) {
+	device, err := gvcptest.NewDevice("SN0001")
+	require.NoError(t, err)
+	common := []byte(fmt.Sprintf(`{"customizedValues":{"deviceSN":"SN0001","backend":"gvcp","address":%q}}`, device.Addr()))
+	gd := &GigEVisionDevice{}
+	require.NoError(t, gd.InitDevice(common))
+	t.Cleanup(func() {
+		gd.StopDevice()
+		device.Close()
+	})
+	return gd, device, common
+}
+
+func visitor(featureName string) []byte {
+	return []byte(fmt.Sprintf(`{"protocolName":"GigEVision","configData":{"FeatureName":%q}}`, featureName))
+}
+
+func TestFeatures(t *testing.T) {
+	gd, device, common := newTestDevice(t)
+
+	value, err := gd.ReadDeviceData(common, visitor("Width"), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "1280", value)
+	require.NoError(t, gd.WriteDeviceData(int64(640), common, visitor("Width"), nil))
+	assert.Equal(t, uint32(640), device.Register(gvcptest.RegWidth))
+	require.NoError(t, gd.WriteDeviceData("RGB8", common, visitor("PixelFormat"), nil))
+	value, err = gd.ReadDeviceData(common, visitor("PixelFormat"), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "RGB8", value)
+	require.NoError(t, gd.WriteDeviceData(true, common, visitor("ReverseX"), nil))
+	assert.Equal(t, uint32(1), device.Register(gvcptest.RegReverse))
+
+	assert.Error(t, gd.WriteDeviceData(int64(4096), common, visitor("Width"), nil))
+	_, err = gd.ReadDeviceData(common, visitor("ExposureTime"), nil)
+	assert.Error(t, err)
+	_, err = gd.ReadDeviceData(common, visitor("ImageTrigger"), nil)
+	assert.Error(t, err, "the gvcp backend does not stream images")
+	assert.NotNil(t, device.Controller(), "the mapper has the control of the camera")
+}
+
+func TestSerialNumberMismatch(t *testing.T) {
+	device, err := gvcptest.NewDevice("SN0002")
+	require.NoError(t, err)
+	defer device.Close()
+	_, err = openCamera(CommonCustomizedValues{DeviceSN: "SN0001", Backend: gvcpBackend, Address: device.Addr()})
+	assert.Error(t, err)
+	assert.Nil(t, device.Controller())
+}
+
+func TestReconnect(t *testing.T) {
+	interval := reconnectInterval
+	reconnectInterval = 20 * time.Millisecond
+	defer func() { reconnectInterval = interval }()
+	gd, device, common := newTestDevice(t)
+
+	device.SetOffline(true)
+	_, err := gd.ReadDeviceData(common, visitor("Width"), nil)
+	require.Error(t, err)
+	_, err = gd.ReadDeviceData(common, visitor("Width"), nil)
+	assert.Error(t, err, "the device is unreachable until it reconnects")
+	assert.False(t, gd.GetDeviceStatus(common, visitor("Width"), nil))
+
+	device.SetRegister(gvcptest.RegWidth, 800)
+	device.SetOffline(false)
+	assert.Eventually(t, func() bool {
+		value, err := gd.ReadDeviceData(common, visitor("Width"), nil)
+		return err == nil && value == "800"
+	}, 10*time.Second, 50*time.Millisecond)
+	assert.True(t, gd.GetDeviceStatus(common, visitor("Width"), nil))
+	assert.NotNil(t, device.Controller(), "the control of the camera is requested again")
+}
+
+// fakeCamera grabs the same image in all formats
+type fakeCamera struct {
+	features map[string]string
+}
+
+func (c *fakeCamera) get(feature string) (string, error) {
+	value, ok := c.features[feature]
+	if !ok {
+		return "", fmt.Errorf("no feature %s", feature)
+	}
+	return value, nil
+}
+
+func (c *fakeCamera) set(feature string, value string) error {
+	c.features[feature] = value
+	return nil
+}
+
+func (c *fakeCamera) image(string) ([]byte, error) {
+	return []byte{0xFF, 0xD8, 0xFF, 0xD9}, nil
+}
+
+func (c *fakeCamera) close() {}
+
+func TestPostImage(t *testing.T) {
+	backends["fake"] = func(CommonCustomizedValues) (camera, error) {
+		return &fakeCamera{features: map[string]string{"ExposureTimeAbs": "2500"}}, nil
+	}
+	defer delete(backends, "fake")
+	dir := t.TempDir()
+	common := []byte(fmt.Sprintf(`{"customizedValues":{"deviceSN":"SN0001","backend":"fake",
+"imageSinks":[{"type":"directory","directory":{"path":%q}}]}}`, dir))
+	gd := &GigEVisionDevice{}
+	require.NoError(t, gd.InitDevice(common))
+	defer gd.StopDevice()
+
+	value, err := gd.ReadDeviceData(common, visitor("PostImage"), nil)
+	require.NoError(t, err)
+	name := filepath.Join(dir, value.(string))
+	var metrics []imagesink.Metrics
+	assert.Eventually(t, func() bool {
+		value, err := gd.ReadDeviceData(common, visitor("ImageSinkMetrics"), nil)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal([]byte(value.(string)), &metrics))
+		return len(metrics) == 1 && metrics[0].Successes == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, imagesink.TypeDirectory, metrics[0].Sink)
+	_, err = ioutil.ReadFile(name)
+	assert.NoError(t, err)
+	data, err := ioutil.ReadFile(name + ".json")
+	require.NoError(t, err)
+	var metadata imagesink.Metadata
+	require.NoError(t, json.Unmarshal(data, &metadata))
+	assert.Equal(t, "SN0001", metadata.SerialNumber)
+	assert.Equal(t, "jpeg", metadata.Format)
+	assert.Equal(t, float64(2500), metadata.ExposureTime)
+
+	assert.Error(t, gd.WriteDeviceData("ftp://example.com", common, visitor("ImageURL"), nil))
+	assert.Error(t, gd.WriteDeviceData("", common, visitor("ImageSinkMetrics"), nil))
+
+	// the image sinks are opened again when the stopped device starts again
+	require.NoError(t, gd.StopDevice())
+	require.NoError(t, gd.InitDevice(common))
+	assert.True(t, gd.GetDeviceStatus(common, visitor("PostImage"), nil))
+	value, err = gd.ReadDeviceData(common, visitor("PostImage"), nil)
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		_, err := ioutil.ReadFile(filepath.Join(dir, value.(string)))
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+}
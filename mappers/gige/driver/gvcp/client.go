@@ -0,0 +1,345 @@
+package gvcp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+const (
+	defaultTimeout = 500 * time.Millisecond
+	defaultRetries = 2
+	// defaultHeartbeatTimeout is the heartbeat timeout of GigE Vision devices after they boot
+	defaultHeartbeatTimeout = 3 * time.Second
+	minHeartbeatInterval    = 50 * time.Millisecond
+)
+
+var errClosed = errors.New("gvcp: the client is closed")
+
+// Client is the control channel of a GigE Vision device. It is safe for concurrent use, commands are sent
+// one at a time as the protocol requires.
+type Client struct {
+	// Timeout is the time to wait for the acknowledge of a command, 500ms by default
+	Timeout time.Duration
+	// Retries is the number of times a command is sent again when it is not acknowledged, 2 by default
+	Retries int
+
+	mutex sync.Mutex
+	conn  *net.UDPConn
+	id    uint16
+	buf   []byte
+
+	heartbeatStop chan struct{}
+	heartbeatDone chan struct{}
+}
+
+// withPort add the control port to address if it has none
+func withPort(address string) string {
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		return net.JoinHostPort(address, strconv.Itoa(ControlPort))
+	}
+	return address
+}
+
+// Dial open the control channel of the device at address, an IPv4 address with an optional port
+func Dial(address string) (*Client, error) {
+	raddr, err := net.ResolveUDPAddr("udp4", withPort(address))
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.DialUDP("udp4", nil, raddr)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		Timeout: defaultTimeout,
+		Retries: defaultRetries,
+		conn:    conn,
+		buf:     make([]byte, 1500),
+	}, nil
+}
+
+// transact send a command until it is acknowledged and get the payload of the acknowledge
+func (c *Client) transact(code uint16, payload []byte, ackCode uint16) ([]byte, error) {
+	return c.send(code, payload, ackCode, c.Retries)
+}
+
+func (c *Client) send(code uint16, payload []byte, ackCode uint16, retries int) ([]byte, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.conn == nil {
+		return nil, errClosed
+	}
+	c.id++
+	if c.id == 0 {
+		// 0 is not a valid request id
+		c.id = 1
+	}
+	packet := (&command{flags: flagAckRequired, code: code, id: c.id, payload: payload}).marshal()
+	for attempt := 0; attempt <= retries; attempt++ {
+		// a command sent again keeps its id, so that the device can detect it
+		if _, err := c.conn.Write(packet); err != nil {
+			return nil, fmt.Errorf("gvcp: %v", err)
+		}
+		deadline := time.Now().Add(c.Timeout)
+		for {
+			if err := c.conn.SetReadDeadline(deadline); err != nil {
+				return nil, err
+			}
+			n, err := c.conn.Read(c.buf)
+			if err != nil {
+				var netErr net.Error
+				if errors.As(err, &netErr) && netErr.Timeout() {
+					break
+				}
+				return nil, fmt.Errorf("gvcp: %v", err)
+			}
+			ack, err := parseAck(c.buf[:n])
+			if err != nil || ack.id != c.id {
+				// the late acknowledge of a previous command
+				continue
+			}
+			if ack.code == ackPendingResp && len(ack.payload) >= 4 {
+				// the device needs more time to complete the command
+				deadline = time.Now().Add(time.Duration(binary.BigEndian.Uint16(ack.payload[2:])) * time.Millisecond)
+				continue
+			}
+			if ack.flags != StatusSuccess {
+				return nil, &StatusError{Status: ack.flags}
+			}
+			if ack.code != ackCode {
+				return nil, fmt.Errorf("gvcp: acknowledge 0x%04X of command 0x%04X", ack.code, code)
+			}
+			return append([]byte(nil), ack.payload...), nil
+		}
+	}
+	return nil, ErrTimeout
+}
+
+// ReadRegisters read 32-bit registers
+func (c *Client) ReadRegisters(addresses ...uint32) ([]uint32, error) {
+	payload := make([]byte, 4*len(addresses))
+	for i, address := range addresses {
+		binary.BigEndian.PutUint32(payload[4*i:], address)
+	}
+	ack, err := c.transact(cmdReadReg, payload, ackReadReg)
+	if err != nil {
+		return nil, err
+	}
+	if len(ack) < len(payload) {
+		return nil, fmt.Errorf("gvcp: %d bytes of %d registers", len(ack), len(addresses))
+	}
+	values := make([]uint32, len(addresses))
+	for i := range values {
+		values[i] = binary.BigEndian.Uint32(ack[4*i:])
+	}
+	return values, nil
+}
+
+// ReadRegister read a 32-bit register
+func (c *Client) ReadRegister(address uint32) (uint32, error) {
+	values, err := c.ReadRegisters(address)
+	if err != nil {
+		return 0, err
+	}
+	return values[0], nil
+}
+
+// WriteRegister write a 32-bit register
+func (c *Client) WriteRegister(address uint32, value uint32) error {
+	payload := make([]byte, 8)
+	binary.BigEndian.PutUint32(payload, address)
+	binary.BigEndian.PutUint32(payload[4:], value)
+	_, err := c.transact(cmdWriteReg, payload, ackWriteReg)
+	return err
+}
+
+// ReadMemory read n bytes at address, with as many commands as needed. Memory is read by 4 bytes aligned
+// words, the bytes around the asked ones are dropped.
+func (c *Client) ReadMemory(address uint32, n int) ([]byte, error) {
+	start := address &^ 3
+	end := (uint64(address) + uint64(n) + 3) &^ 3
+	data := make([]byte, 0, end-uint64(start))
+	for at := uint64(start); at < end; {
+		count := end - at
+		if count > MaxMemorySize {
+			count = MaxMemorySize
+		}
+		payload := make([]byte, 8)
+		binary.BigEndian.PutUint32(payload, uint32(at))
+		binary.BigEndian.PutUint16(payload[6:], uint16(count))
+		ack, err := c.transact(cmdReadMem, payload, ackReadMem)
+		if err != nil {
+			return nil, err
+		}
+		if len(ack) < 4+int(count) {
+			return nil, fmt.Errorf("gvcp: %d bytes read at 0x%X, %d expected", len(ack)-4, at, count)
+		}
+		data = append(data, ack[4:4+count]...)
+		at += count
+	}
+	return data[address-start : address-start+uint32(n)], nil
+}
+
+// WriteMemory write data at address, with as many commands as needed. The address and the length of
+// data must be multiples of 4.
+func (c *Client) WriteMemory(address uint32, data []byte) error {
+	if address%4 != 0 || len(data)%4 != 0 {
+		return fmt.Errorf("gvcp: write of %d bytes at 0x%X is not aligned to 4 bytes", len(data), address)
+	}
+	for offset := 0; offset < len(data); offset += MaxMemorySize {
+		chunk := data[offset:]
+		if len(chunk) > MaxMemorySize {
+			chunk = chunk[:MaxMemorySize]
+		}
+		payload := make([]byte, 4+len(chunk))
+		binary.BigEndian.PutUint32(payload, address+uint32(offset))
+		copy(payload[4:], chunk)
+		if _, err := c.transact(cmdWriteMem, payload, ackWriteMem); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadString read a string register of the bootstrap registers, such as RegSerialNumber
+func (c *Client) ReadString(address uint32, length int) (string, error) {
+	data, err := c.ReadMemory(address, length)
+	if err != nil {
+		return "", err
+	}
+	return cString(data), nil
+}
+
+// RequestControl get the control access of the device, which other applications can still read, and keep
+// it with heartbeats until the client is closed
+func (c *Client) RequestControl() error {
+	if err := c.WriteRegister(RegControlChannelPrivilege, PrivilegeControlAccess); err != nil {
+		return fmt.Errorf("gvcp: request control of the device: %w", err)
+	}
+	timeout := defaultHeartbeatTimeout
+	if ms, err := c.ReadRegister(RegHeartbeatTimeout); err == nil && ms > 0 {
+		timeout = time.Duration(ms) * time.Millisecond
+	}
+	interval := timeout / 3
+	if interval < minHeartbeatInterval {
+		interval = minHeartbeatInterval
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.heartbeatStop != nil {
+		return nil
+	}
+	c.heartbeatStop, c.heartbeatDone = make(chan struct{}), make(chan struct{})
+	go c.heartbeat(interval, c.heartbeatStop, c.heartbeatDone)
+	return nil
+}
+
+// heartbeat read the control channel privilege register, the device releases the control of an
+// application which sends no command during the heartbeat timeout
+func (c *Client) heartbeat(interval time.Duration, stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			privilege, err := c.ReadRegister(RegControlChannelPrivilege)
+			if err != nil {
+				klog.V(4).Infof("GVCP heartbeat failed: %v", err)
+			} else if privilege&(PrivilegeControlAccess|PrivilegeExclusiveAccess) == 0 {
+				klog.Warningf("GVCP control of %s was lost", c.conn.RemoteAddr())
+			}
+		}
+	}
+}
+
+// Close release the control of the device and close the channel
+func (c *Client) Close() error {
+	c.mutex.Lock()
+	stop, done := c.heartbeatStop, c.heartbeatDone
+	c.heartbeatStop, c.heartbeatDone = nil, nil
+	c.mutex.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
+		// best effort, the device releases it after the heartbeat timeout anyway
+		payload := make([]byte, 8)
+		binary.BigEndian.PutUint32(payload, RegControlChannelPrivilege)
+		_, _ = c.send(cmdWriteReg, payload, ackWriteReg, 0)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+// Discover send a discovery command to address, the broadcast address if empty, and collect the
+// acknowledges of the devices until timeout
+func Discover(address string, timeout time.Duration) ([]*DeviceInfo, error) {
+	if address == "" {
+		address = net.IPv4bcast.String()
+	}
+	raddr, err := net.ResolveUDPAddr("udp4", withPort(address))
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	const id = 1
+	packet := (&command{flags: flagAckRequired | flagBroadcastAck, code: cmdDiscovery, id: id}).marshal()
+	if _, err = conn.WriteToUDP(packet, raddr); err != nil {
+		return nil, fmt.Errorf("gvcp: send discovery command: %v", err)
+	}
+
+	var devices []*DeviceInfo
+	found := make(map[string]bool)
+	buf := make([]byte, 1500)
+	if err = conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+	for {
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return devices, nil
+			}
+			return devices, err
+		}
+		ack, err := parseAck(buf[:n])
+		if err != nil || ack.code != ackDiscovery || ack.id != id || ack.flags != StatusSuccess {
+			continue
+		}
+		info, err := parseDeviceInfo(ack.payload)
+		if err != nil {
+			klog.V(4).Infof("Invalid discovery acknowledge from %s: %v", from, err)
+			continue
+		}
+		if info.IP.IsUnspecified() {
+			info.IP = from.IP
+		}
+		key := info.MAC.String() + "/" + info.SerialNumber
+		if !found[key] {
+			found[key] = true
+			devices = append(devices, info)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package gvcp_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kubeedge/mappers-go/mappers/gige/driver/gvcp"
+	"github.com/kubeedge/mappers-go/mappers/gige/driver/gvcp/gvcptest"
+)
+
+func newDevice(t *testing.T) *gvcptest.Device {
+	device, err := gvcptest.NewDevice("SN0001")
+	require.NoError(t, err)
+	t.Cleanup(func() { device.Close() })
+	return device
+}
+
+func dial(t *testing.T, device *gvcptest.Device) *gvcp.Client {
+	client, err := gvcp.Dial(device.Addr())
+	require.NoError(t, err)
+	client.Timeout = 100 * time.Millisecond
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestDiscover(t *testing.T) {
+	device := newDevice(t)
+	devices, err := gvcp.Discover(device.Addr(), 200*time.Millisecond)
+	require.NoError(t, err)
+	require.Len(t, devices, 1)
+	assert.Equal(t, "SN0001", devices[0].SerialNumber)
+	assert.Equal(t, "KubeEdge", devices[0].ManufacturerName)
+	assert.Equal(t, "GVCP Test Camera", devices[0].ModelName)
+	assert.Equal(t, "127.0.0.1", devices[0].IP.String())
+	assert.Equal(t, "02:00:00:00:00:01", devices[0].MAC.String())
+}
+
+func TestRegisters(t *testing.T) {
+	device := newDevice(t)
+	client := dial(t, device)
+
+	values, err := client.ReadRegisters(gvcptest.RegWidth, gvcptest.RegHeight)
+	require.NoError(t, err)
+	assert.Equal(t, []uint32{1280, 720}, values)
+	require.NoError(t, client.WriteRegister(gvcptest.RegWidth, 640))
+	assert.Equal(t, uint32(640), device.Register(gvcptest.RegWidth))
+
+	serial, err := client.ReadString(gvcp.RegSerialNumber, 16)
+	require.NoError(t, err)
+	assert.Equal(t, "SN0001", serial)
+
+	_, err = client.ReadRegister(gvcptest.RegWidth + 1)
+	var statusErr *gvcp.StatusError
+	require.True(t, errors.As(err, &statusErr), "unaligned read error = %v", err)
+	assert.Equal(t, gvcp.StatusBadAlignment, statusErr.Status)
+}
+
+func TestMemory(t *testing.T) {
+	device := newDevice(t)
+	client := dial(t, device)
+
+	// more than a command can write, at an address which is not aligned to the memory commands
+	data := make([]byte, 2*gvcp.MaxMemorySize+4)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	require.NoError(t, client.WriteMemory(0x20000, data))
+	assert.Equal(t, data, device.Memory(0x20000, len(data)))
+
+	read, err := client.ReadMemory(0x20003, 2*gvcp.MaxMemorySize)
+	require.NoError(t, err)
+	assert.Equal(t, data[3:3+2*gvcp.MaxMemorySize], read)
+
+	assert.Error(t, client.WriteMemory(0x20001, data[:4]))
+}
+
+func TestControl(t *testing.T) {
+	device := newDevice(t)
+	// the heartbeats are sent every 50ms
+	device.SetRegister(gvcp.RegHeartbeatTimeout, 150)
+	client := dial(t, device)
+	other := dial(t, device)
+
+	require.NoError(t, client.RequestControl())
+	require.NotNil(t, device.Controller())
+
+	// the other application can read but not write
+	_, err := other.ReadRegister(gvcptest.RegWidth)
+	assert.NoError(t, err)
+	err = other.WriteRegister(gvcptest.RegWidth, 640)
+	var statusErr *gvcp.StatusError
+	require.True(t, errors.As(err, &statusErr), "write without control error = %v", err)
+	assert.Equal(t, gvcp.StatusAccessDenied, statusErr.Status)
+	assert.Error(t, other.RequestControl())
+
+	// the heartbeats keep the control beyond the heartbeat timeout
+	time.Sleep(400 * time.Millisecond)
+	assert.NoError(t, client.Close())
+	assert.Nil(t, device.Controller(), "the control is released when the client is closed")
+	assert.NoError(t, other.RequestControl())
+}
+
+func TestTimeout(t *testing.T) {
+	device := newDevice(t)
+	client := dial(t, device)
+	client.Retries = 1
+
+	device.SetOffline(true)
+	start := time.Now()
+	_, err := client.ReadRegister(gvcptest.RegWidth)
+	assert.ErrorIs(t, err, gvcp.ErrTimeout)
+	assert.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond, "the command is sent again once")
+
+	device.SetOffline(false)
+	value, err := client.ReadRegister(gvcptest.RegWidth)
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(1280), value)
+}
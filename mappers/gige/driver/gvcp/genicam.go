@@ -0,0 +1,742 @@
+package gvcp
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Port reads and writes the memory of a device, such as a Client
+type Port interface {
+	ReadMemory(address uint32, n int) ([]byte, error)
+	WriteMemory(address uint32, data []byte) error
+}
+
+// registerPort is a Port which also reads and writes 32-bit registers with a single command
+type registerPort interface {
+	ReadRegister(address uint32) (uint32, error)
+	WriteRegister(address uint32, value uint32) error
+}
+
+// Node types of GenICam XML files
+const (
+	kindInteger      = "Integer"
+	kindIntReg       = "IntReg"
+	kindMaskedIntReg = "MaskedIntReg"
+	kindFloat        = "Float"
+	kindFloatReg     = "FloatReg"
+	kindBoolean      = "Boolean"
+	kindEnumeration  = "Enumeration"
+	kindCommand      = "Command"
+	kindStringReg    = "StringReg"
+	kindStructReg    = "StructReg"
+)
+
+// node is a node of a GenICam XML file, only the elements of the supported node types are decoded
+type node struct {
+	kind string
+
+	Name          string      `xml:"Name,attr"`
+	Value         string      `xml:"Value"`
+	PValue        string      `xml:"pValue"`
+	Min           string      `xml:"Min"`
+	Max           string      `xml:"Max"`
+	PMin          string      `xml:"pMin"`
+	PMax          string      `xml:"pMax"`
+	Address       []string    `xml:"Address"`
+	PAddress      []string    `xml:"pAddress"`
+	Length        string      `xml:"Length"`
+	AccessMode    string      `xml:"AccessMode"`
+	Endianess     string      `xml:"Endianess"`
+	Sign          string      `xml:"Sign"`
+	LSB           string      `xml:"LSB"`
+	MSB           string      `xml:"MSB"`
+	Bit           string      `xml:"Bit"`
+	OnValue       string      `xml:"OnValue"`
+	OffValue      string      `xml:"OffValue"`
+	CommandValue  string      `xml:"CommandValue"`
+	PCommandValue string      `xml:"pCommandValue"`
+	Entries       []enumEntry `xml:"EnumEntry"`
+	StructEntries []node      `xml:"StructEntry"`
+}
+
+type enumEntry struct {
+	Name  string `xml:"Name,attr"`
+	Value string `xml:"Value"`
+}
+
+// NodeMap gets and sets the features of a device described by its GenICam XML file. Integer, IntReg,
+// MaskedIntReg, Float, FloatReg, Boolean, Enumeration, Command, StringReg and StructReg nodes are
+// supported, formulas of SwissKnife and Converter nodes are not.
+type NodeMap struct {
+	port  Port
+	mutex sync.Mutex
+	nodes map[string]*node
+}
+
+// LoadNodeMap read the GenICam XML file of a device at the first URL of its bootstrap registers
+func LoadNodeMap(port Port) (*NodeMap, error) {
+	data, err := port.ReadMemory(RegFirstURL, 512)
+	if err != nil {
+		return nil, fmt.Errorf("gvcp: read the URL of the GenICam XML file: %w", err)
+	}
+	xmlData, err := readURL(port, cString(data))
+	if err != nil {
+		return nil, err
+	}
+	return ParseNodeMap(port, xmlData)
+}
+
+// readURL read a file in the memory of the device at a URL like Local:name.xml;address;length, where the
+// address and the length are hexadecimal. Zip files are uncompressed.
+func readURL(port Port, url string) ([]byte, error) {
+	const scheme = "local:"
+	if !strings.HasPrefix(strings.ToLower(url), scheme) {
+		return nil, fmt.Errorf("gvcp: GenICam XML file at %q is not in the memory of the device", url)
+	}
+	location := url[len(scheme):]
+	if i := strings.IndexByte(location, '?'); i >= 0 {
+		location = location[:i]
+	}
+	parts := strings.Split(location, ";")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("gvcp: invalid GenICam XML file URL %q", url)
+	}
+	address, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(parts[1]), "0x"), 16, 32)
+	if err != nil {
+		return nil, fmt.Errorf("gvcp: invalid address in GenICam XML file URL %q", url)
+	}
+	length, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(parts[2]), "0x"), 16, 32)
+	if err != nil {
+		return nil, fmt.Errorf("gvcp: invalid length in GenICam XML file URL %q", url)
+	}
+	data, err := port.ReadMemory(uint32(address), int(length))
+	if err != nil {
+		return nil, fmt.Errorf("gvcp: read GenICam XML file %s: %w", parts[0], err)
+	}
+	if !strings.HasSuffix(strings.ToLower(parts[0]), ".zip") {
+		return data, nil
+	}
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("gvcp: unzip GenICam XML file %s: %v", parts[0], err)
+	}
+	for _, file := range archive.File {
+		if !strings.HasSuffix(strings.ToLower(file.Name), ".xml") {
+			continue
+		}
+		r, err := file.Open()
+		if err != nil {
+			return nil, fmt.Errorf("gvcp: unzip GenICam XML file %s: %v", parts[0], err)
+		}
+		defer r.Close()
+		return ioutil.ReadAll(r)
+	}
+	return nil, fmt.Errorf("gvcp: no XML file in %s", parts[0])
+}
+
+// ParseNodeMap parse the GenICam XML file of the device read and written through port
+func ParseNodeMap(port Port, xmlData []byte) (*NodeMap, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(xmlData))
+	// the nodes are ASCII, whatever the declared encoding is
+	decoder.CharsetReader = func(_ string, input io.Reader) (io.Reader, error) { return input, nil }
+	nodes := make(map[string]*node)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("gvcp: parse GenICam XML file: %v", err)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || (!hasName(start) && start.Name.Local != kindStructReg) {
+			// the root element and groups of nodes
+			continue
+		}
+		n := &node{kind: start.Name.Local}
+		if err = decoder.DecodeElement(n, &start); err != nil {
+			return nil, fmt.Errorf("gvcp: parse GenICam node %s: %v", n.Name, err)
+		}
+		if n.Name != "" {
+			nodes[n.Name] = n
+		}
+		if n.kind == kindStructReg {
+			// each entry is a masked register in the register of the struct
+			for i := range n.StructEntries {
+				entry := n.StructEntries[i]
+				entry.kind = kindMaskedIntReg
+				entry.Address, entry.PAddress, entry.Length = n.Address, n.PAddress, n.Length
+				if entry.AccessMode == "" {
+					entry.AccessMode = n.AccessMode
+				}
+				if entry.Endianess == "" {
+					entry.Endianess = n.Endianess
+				}
+				nodes[entry.Name] = &entry
+			}
+		}
+	}
+	if len(nodes) == 0 {
+		return nil, errors.New("gvcp: no node in GenICam XML file")
+	}
+	return &NodeMap{port: port, nodes: nodes}, nil
+}
+
+func hasName(start xml.StartElement) bool {
+	for _, attr := range start.Attr {
+		if attr.Name.Local == "Name" {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *NodeMap) node(name string) (*node, error) {
+	n, ok := m.nodes[name]
+	if !ok {
+		return nil, fmt.Errorf("gvcp: no feature %s in the GenICam XML file", name)
+	}
+	return n, nil
+}
+
+// Get get the value of a feature as a string: a decimal number, true or false, the name of an enumeration
+// entry or a string
+func (m *NodeMap) Get(feature string) (string, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	n, err := m.node(feature)
+	if err != nil {
+		return "", err
+	}
+	if n.accessMode() == "WO" {
+		return "", fmt.Errorf("gvcp: feature %s is write only", feature)
+	}
+	switch n.kind {
+	case kindInteger, kindIntReg, kindMaskedIntReg:
+		v, err := m.getInt(n)
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatInt(v, 10), nil
+	case kindFloat, kindFloatReg:
+		v, err := m.getFloat(n)
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatFloat(v, 'g', -1, 64), nil
+	case kindBoolean:
+		v, err := m.getInt(n)
+		if err != nil {
+			return "", err
+		}
+		on, off, err := n.onOff()
+		if err != nil {
+			return "", err
+		}
+		switch v {
+		case on:
+			return "true", nil
+		case off:
+			return "false", nil
+		}
+		return "", fmt.Errorf("gvcp: feature %s has value %d, neither on nor off", feature, v)
+	case kindEnumeration:
+		v, err := m.getInt(n)
+		if err != nil {
+			return "", err
+		}
+		for _, entry := range n.Entries {
+			if value, err := parseInt(entry.Value); err == nil && value == v {
+				return entry.Name, nil
+			}
+		}
+		return "", fmt.Errorf("gvcp: feature %s has value %d of no enumeration entry", feature, v)
+	case kindStringReg:
+		data, err := m.readRegister(n)
+		if err != nil {
+			return "", err
+		}
+		return cString(data), nil
+	}
+	return "", fmt.Errorf("gvcp: feature %s of type %s can not be read", feature, n.kind)
+}
+
+// Set set the value of a feature from a string: a number, a boolean, the name or value of an enumeration
+// entry or a string. The value of a command is ignored, the command is executed.
+func (m *NodeMap) Set(feature string, value string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	n, err := m.node(feature)
+	if err != nil {
+		return err
+	}
+	value = strings.TrimSpace(value)
+	switch n.kind {
+	case kindInteger, kindIntReg, kindMaskedIntReg:
+		v, err := strconv.ParseInt(value, 0, 64)
+		if err != nil {
+			return fmt.Errorf("gvcp: invalid integer %q of feature %s", value, feature)
+		}
+		return m.setInt(n, v)
+	case kindFloat, kindFloatReg:
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("gvcp: invalid float %q of feature %s", value, feature)
+		}
+		return m.setFloat(n, v)
+	case kindBoolean:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("gvcp: invalid boolean %q of feature %s", value, feature)
+		}
+		on, off, err := n.onOff()
+		if err != nil {
+			return err
+		}
+		if b {
+			return m.setInt(n, on)
+		}
+		return m.setInt(n, off)
+	case kindEnumeration:
+		for _, entry := range n.Entries {
+			if entry.Name == value {
+				v, err := parseInt(entry.Value)
+				if err != nil {
+					return fmt.Errorf("gvcp: invalid value of enumeration entry %s: %v", entry.Name, err)
+				}
+				return m.setInt(n, v)
+			}
+		}
+		if v, err := strconv.ParseInt(value, 0, 64); err == nil {
+			for _, entry := range n.Entries {
+				if ev, err := parseInt(entry.Value); err == nil && ev == v {
+					return m.setInt(n, v)
+				}
+			}
+		}
+		return fmt.Errorf("gvcp: no entry %q in enumeration %s", value, feature)
+	case kindCommand:
+		if !n.writable() {
+			return fmt.Errorf("gvcp: feature %s is read only", feature)
+		}
+		v, err := m.intValue(n.CommandValue, n.PCommandValue)
+		if err != nil {
+			return err
+		}
+		target, err := m.node(n.PValue)
+		if err != nil {
+			return err
+		}
+		return m.setInt(target, v)
+	case kindStringReg:
+		if !n.writable() {
+			return fmt.Errorf("gvcp: feature %s is read only", feature)
+		}
+		length, err := parseInt(n.Length)
+		if err != nil {
+			return fmt.Errorf("gvcp: invalid length of %s: %v", n.Name, err)
+		}
+		if int64(len(value)) > length {
+			return fmt.Errorf("gvcp: string of %d bytes is longer than feature %s of %d bytes", len(value), feature, length)
+		}
+		data := make([]byte, length)
+		copy(data, value)
+		return m.writeRegister(n, data)
+	}
+	return fmt.Errorf("gvcp: feature %s of type %s can not be written", feature, n.kind)
+}
+
+// accessMode is RO, WO or RW. Nodes with a constant value are read only by default, the other ones can
+// be written unless the device denies it.
+func (n *node) accessMode() string {
+	if n.AccessMode != "" {
+		return n.AccessMode
+	}
+	switch n.kind {
+	case kindInteger, kindFloat, kindBoolean, kindEnumeration:
+		if n.PValue == "" {
+			return "RO"
+		}
+	}
+	return "RW"
+}
+
+func (n *node) writable() bool {
+	return n.accessMode() != "RO"
+}
+
+func (n *node) bigEndian() bool {
+	return n.Endianess == "BigEndian"
+}
+
+func (n *node) signed() bool {
+	return n.Sign == "Signed"
+}
+
+func (n *node) onOff() (on int64, off int64, err error) {
+	on, off = 1, 0
+	if n.OnValue != "" {
+		if on, err = parseInt(n.OnValue); err != nil {
+			return 0, 0, fmt.Errorf("gvcp: invalid on value of %s: %v", n.Name, err)
+		}
+	}
+	if n.OffValue != "" {
+		if off, err = parseInt(n.OffValue); err != nil {
+			return 0, 0, fmt.Errorf("gvcp: invalid off value of %s: %v", n.Name, err)
+		}
+	}
+	return on, off, nil
+}
+
+// bits get the position of the least significant bit and the number of bits of a masked register of size
+// bytes. Bits are numbered from the most significant one in big endian registers.
+func (n *node) bits(size int) (lsb uint, width uint, err error) {
+	lsbText, msbText := n.LSB, n.MSB
+	if n.Bit != "" {
+		lsbText, msbText = n.Bit, n.Bit
+	}
+	l, err := parseInt(lsbText)
+	if err != nil {
+		return 0, 0, fmt.Errorf("gvcp: invalid LSB of %s: %v", n.Name, err)
+	}
+	h, err := parseInt(msbText)
+	if err != nil {
+		return 0, 0, fmt.Errorf("gvcp: invalid MSB of %s: %v", n.Name, err)
+	}
+	if n.bigEndian() {
+		l, h = int64(size*8-1)-l, int64(size*8-1)-h
+	}
+	if l < 0 || h < l || h >= int64(size*8) {
+		return 0, 0, fmt.Errorf("gvcp: invalid bits %s..%s of %s", lsbText, msbText, n.Name)
+	}
+	return uint(l), uint(h - l + 1), nil
+}
+
+// intValue get a constant value, or the value of the node it points to
+func (m *NodeMap) intValue(value string, pointer string) (int64, error) {
+	if pointer != "" {
+		n, err := m.node(pointer)
+		if err != nil {
+			return 0, err
+		}
+		return m.getInt(n)
+	}
+	return parseInt(value)
+}
+
+func (m *NodeMap) floatValue(value string, pointer string) (float64, error) {
+	if pointer != "" {
+		n, err := m.node(pointer)
+		if err != nil {
+			return 0, err
+		}
+		return m.getFloat(n)
+	}
+	return strconv.ParseFloat(strings.TrimSpace(value), 64)
+}
+
+func (m *NodeMap) getInt(n *node) (int64, error) {
+	switch n.kind {
+	case kindInteger, kindBoolean, kindEnumeration:
+		return m.intValue(n.Value, n.PValue)
+	case kindIntReg, kindMaskedIntReg:
+		data, err := m.readRegister(n)
+		if err != nil {
+			return 0, err
+		}
+		v := decodeUint(data, n.bigEndian())
+		width := uint(len(data) * 8)
+		if n.kind == kindMaskedIntReg {
+			var lsb uint
+			if lsb, width, err = n.bits(len(data)); err != nil {
+				return 0, err
+			}
+			v = (v >> lsb) & mask(width)
+		}
+		if n.signed() && width < 64 && v&(1<<(width-1)) != 0 {
+			v |= ^mask(width)
+		}
+		return int64(v), nil
+	case kindFloat, kindFloatReg:
+		f, err := m.getFloat(n)
+		return int64(f), err
+	}
+	return 0, fmt.Errorf("gvcp: feature %s of type %s is not an integer", n.Name, n.kind)
+}
+
+func (m *NodeMap) getFloat(n *node) (float64, error) {
+	switch n.kind {
+	case kindFloat:
+		return m.floatValue(n.Value, n.PValue)
+	case kindFloatReg:
+		data, err := m.readRegister(n)
+		if err != nil {
+			return 0, err
+		}
+		bits := decodeUint(data, n.bigEndian())
+		switch len(data) {
+		case 4:
+			return float64(math.Float32frombits(uint32(bits))), nil
+		case 8:
+			return math.Float64frombits(bits), nil
+		}
+		return 0, fmt.Errorf("gvcp: float register %s of %d bytes", n.Name, len(data))
+	case kindInteger, kindIntReg, kindMaskedIntReg:
+		v, err := m.getInt(n)
+		return float64(v), err
+	}
+	return 0, fmt.Errorf("gvcp: feature %s of type %s is not a float", n.Name, n.kind)
+}
+
+func (m *NodeMap) setInt(n *node, v int64) error {
+	if !n.writable() {
+		return fmt.Errorf("gvcp: feature %s is read only", n.Name)
+	}
+	switch n.kind {
+	case kindInteger:
+		if n.Min != "" || n.PMin != "" {
+			min, err := m.intValue(n.Min, n.PMin)
+			if err != nil {
+				return err
+			}
+			if v < min {
+				return fmt.Errorf("gvcp: %d is less than the minimum %d of %s", v, min, n.Name)
+			}
+		}
+		if n.Max != "" || n.PMax != "" {
+			max, err := m.intValue(n.Max, n.PMax)
+			if err != nil {
+				return err
+			}
+			if v > max {
+				return fmt.Errorf("gvcp: %d is greater than the maximum %d of %s", v, max, n.Name)
+			}
+		}
+		fallthrough
+	case kindBoolean, kindEnumeration:
+		if n.PValue == "" {
+			n.Value = strconv.FormatInt(v, 10)
+			return nil
+		}
+		target, err := m.node(n.PValue)
+		if err != nil {
+			return err
+		}
+		return m.setInt(target, v)
+	case kindIntReg, kindMaskedIntReg:
+		size, err := parseInt(n.Length)
+		if err != nil || size <= 0 || size > 8 {
+			return fmt.Errorf("gvcp: invalid length %q of %s", n.Length, n.Name)
+		}
+		width := uint(size * 8)
+		var lsb uint
+		if n.kind == kindMaskedIntReg {
+			if lsb, width, err = n.bits(int(size)); err != nil {
+				return err
+			}
+		}
+		if !fits(v, width, n.signed()) {
+			return fmt.Errorf("gvcp: %d does not fit in the %d bits of %s", v, width, n.Name)
+		}
+		bits := uint64(v) & mask(width)
+		if n.kind == kindMaskedIntReg {
+			data, err := m.readRegister(n)
+			if err != nil {
+				return err
+			}
+			bits = decodeUint(data, n.bigEndian())&^(mask(width)<<lsb) | bits<<lsb
+		}
+		return m.writeRegister(n, encodeUint(bits, int(size), n.bigEndian()))
+	case kindFloat, kindFloatReg:
+		return m.setFloat(n, float64(v))
+	}
+	return fmt.Errorf("gvcp: feature %s of type %s is not an integer", n.Name, n.kind)
+}
+
+func (m *NodeMap) setFloat(n *node, v float64) error {
+	if !n.writable() {
+		return fmt.Errorf("gvcp: feature %s is read only", n.Name)
+	}
+	switch n.kind {
+	case kindFloat:
+		if n.Min != "" || n.PMin != "" {
+			min, err := m.floatValue(n.Min, n.PMin)
+			if err != nil {
+				return err
+			}
+			if v < min {
+				return fmt.Errorf("gvcp: %g is less than the minimum %g of %s", v, min, n.Name)
+			}
+		}
+		if n.Max != "" || n.PMax != "" {
+			max, err := m.floatValue(n.Max, n.PMax)
+			if err != nil {
+				return err
+			}
+			if v > max {
+				return fmt.Errorf("gvcp: %g is greater than the maximum %g of %s", v, max, n.Name)
+			}
+		}
+		if n.PValue == "" {
+			n.Value = strconv.FormatFloat(v, 'g', -1, 64)
+			return nil
+		}
+		target, err := m.node(n.PValue)
+		if err != nil {
+			return err
+		}
+		return m.setFloat(target, v)
+	case kindFloatReg:
+		size, err := parseInt(n.Length)
+		if err != nil {
+			return fmt.Errorf("gvcp: invalid length %q of %s", n.Length, n.Name)
+		}
+		switch size {
+		case 4:
+			return m.writeRegister(n, encodeUint(uint64(math.Float32bits(float32(v))), 4, n.bigEndian()))
+		case 8:
+			return m.writeRegister(n, encodeUint(math.Float64bits(v), 8, n.bigEndian()))
+		}
+		return fmt.Errorf("gvcp: float register %s of %d bytes", n.Name, size)
+	case kindInteger, kindIntReg, kindMaskedIntReg:
+		if v != math.Trunc(v) {
+			return fmt.Errorf("gvcp: %g is not an integer of %s", v, n.Name)
+		}
+		return m.setInt(n, int64(v))
+	}
+	return fmt.Errorf("gvcp: feature %s of type %s is not a float", n.Name, n.kind)
+}
+
+// register get the address and the length of a register, its address is the sum of its addresses and of the
+// values of the nodes its address points to
+func (m *NodeMap) register(n *node) (uint32, int, error) {
+	var address int64
+	for _, text := range n.Address {
+		v, err := parseInt(text)
+		if err != nil {
+			return 0, 0, fmt.Errorf("gvcp: invalid address of %s: %v", n.Name, err)
+		}
+		address += v
+	}
+	for _, pointer := range n.PAddress {
+		v, err := m.intValue("", pointer)
+		if err != nil {
+			return 0, 0, err
+		}
+		address += v
+	}
+	length, err := parseInt(n.Length)
+	if err != nil || length <= 0 {
+		return 0, 0, fmt.Errorf("gvcp: invalid length %q of %s", n.Length, n.Name)
+	}
+	return uint32(address), int(length), nil
+}
+
+func (m *NodeMap) readRegister(n *node) ([]byte, error) {
+	address, length, err := m.register(n)
+	if err != nil {
+		return nil, err
+	}
+	if port, ok := m.port.(registerPort); ok && length == 4 && address%4 == 0 {
+		v, err := port.ReadRegister(address)
+		if err != nil {
+			return nil, fmt.Errorf("gvcp: read %s: %w", n.Name, err)
+		}
+		data := make([]byte, 4)
+		binary.BigEndian.PutUint32(data, v)
+		return data, nil
+	}
+	data, err := m.port.ReadMemory(address, length)
+	if err != nil {
+		return nil, fmt.Errorf("gvcp: read %s: %w", n.Name, err)
+	}
+	return data, nil
+}
+
+// writeRegister write a register, the bytes around it are read and written again if it is not aligned
+// to 4 bytes
+func (m *NodeMap) writeRegister(n *node, data []byte) error {
+	address, length, err := m.register(n)
+	if err != nil {
+		return err
+	}
+	if len(data) != length {
+		return fmt.Errorf("gvcp: %d bytes written to %s of %d bytes", len(data), n.Name, length)
+	}
+	if port, ok := m.port.(registerPort); ok && length == 4 && address%4 == 0 {
+		if err = port.WriteRegister(address, binary.BigEndian.Uint32(data)); err != nil {
+			return fmt.Errorf("gvcp: write %s: %w", n.Name, err)
+		}
+		return nil
+	}
+	start, end := address&^3, (address+uint32(length)+3)&^3
+	if start != address || end != address+uint32(length) {
+		aligned, err := m.port.ReadMemory(start, int(end-start))
+		if err != nil {
+			return fmt.Errorf("gvcp: write %s: %w", n.Name, err)
+		}
+		copy(aligned[address-start:], data)
+		data = aligned
+	}
+	if err = m.port.WriteMemory(start, data); err != nil {
+		return fmt.Errorf("gvcp: write %s: %w", n.Name, err)
+	}
+	return nil
+}
+
+// parseInt parse a decimal or hexadecimal integer of a GenICam XML file
+func parseInt(text string) (int64, error) {
+	return strconv.ParseInt(strings.TrimSpace(text), 0, 64)
+}
+
+func mask(width uint) uint64 {
+	if width >= 64 {
+		return math.MaxUint64
+	}
+	return 1<<width - 1
+}
+
+func fits(v int64, width uint, signed bool) bool {
+	if width >= 64 {
+		return signed || v >= 0
+	}
+	if signed {
+		return v >= -1<<(width-1) && v < 1<<(width-1)
+	}
+	return v >= 0 && uint64(v) <= mask(width)
+}
+
+func decodeUint(data []byte, bigEndian bool) uint64 {
+	var v uint64
+	for i := range data {
+		b := data[i]
+		if !bigEndian {
+			b = data[len(data)-1-i]
+		}
+		v = v<<8 | uint64(b)
+	}
+	return v
+}
+
+func encodeUint(v uint64, size int, bigEndian bool) []byte {
+	data := make([]byte, size)
+	for i := 0; i < size; i++ {
+		b := byte(v >> (8 * uint(i)))
+		if bigEndian {
+			data[size-1-i] = b
+		} else {
+			data[i] = b
+		}
+	}
+	return data
+}
@@ -0,0 +1,97 @@
+package gvcp_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kubeedge/mappers-go/mappers/gige/driver/gvcp"
+	"github.com/kubeedge/mappers-go/mappers/gige/driver/gvcp/gvcptest"
+)
+
+func TestNodeMapGet(t *testing.T) {
+	device := newDevice(t)
+	device.SetRegister(gvcptest.RegReverse, 0x1)
+	nodes, err := gvcp.LoadNodeMap(dial(t, device))
+	require.NoError(t, err)
+
+	for feature, want := range map[string]string{
+		"Width":              "1280",
+		"Height":             "720",
+		"PixelFormat":        "Mono8",
+		"Gain":               "1.5",
+		"ReverseX":           "true",
+		"ReverseY":           "false",
+		"DeviceSerialNumber": "SN0001",
+	} {
+		value, err := nodes.Get(feature)
+		assert.NoError(t, err, feature)
+		assert.Equal(t, want, value, feature)
+	}
+	for _, feature := range []string{"AcquisitionStart", "AcquisitionCommandReg", "ImageFormatControl", "ExposureTime"} {
+		_, err := nodes.Get(feature)
+		assert.Error(t, err, feature)
+	}
+}
+
+func TestNodeMapSet(t *testing.T) {
+	device := newDevice(t)
+	client := dial(t, device)
+	require.NoError(t, client.RequestControl())
+	nodes, err := gvcp.LoadNodeMap(client)
+	require.NoError(t, err)
+
+	require.NoError(t, nodes.Set("Width", "640"))
+	assert.Equal(t, uint32(640), device.Register(gvcptest.RegWidth))
+	require.NoError(t, nodes.Set("PixelFormat", "RGB8"))
+	assert.Equal(t, gvcptest.PixelFormatRGB8, device.Register(gvcptest.RegPixelFormat))
+	require.NoError(t, nodes.Set("Gain", "12.25"))
+	value, err := nodes.Get("Gain")
+	require.NoError(t, err)
+	assert.Equal(t, "12.25", value)
+	require.NoError(t, nodes.Set("ReverseY", "true"))
+	require.NoError(t, nodes.Set("ReverseX", "1"))
+	assert.Equal(t, uint32(0x3), device.Register(gvcptest.RegReverse))
+	require.NoError(t, nodes.Set("ReverseX", "false"))
+	assert.Equal(t, uint32(0x2), device.Register(gvcptest.RegReverse))
+	require.NoError(t, nodes.Set("AcquisitionStart", ""))
+	assert.Equal(t, uint32(1), device.Register(gvcptest.RegAcquisitionStart))
+	require.NoError(t, nodes.Set("DeviceUserID", "line-3"))
+	assert.Equal(t, append([]byte("line-3"), make([]byte, 10)...), device.Memory(gvcp.RegUserDefinedName, 16))
+
+	for feature, value := range map[string]string{
+		"Width":              "8",
+		"Height":             "2000",
+		"PixelFormat":        "Mono16",
+		"Gain":               "30",
+		"ReverseX":           "maybe",
+		"DeviceSerialNumber": "SN0002",
+		"DeviceUserID":       "a name longer than 16 bytes",
+		"WidthMaxReg":        "4096",
+	} {
+		assert.Error(t, nodes.Set(feature, value), "%s=%s", feature, value)
+	}
+	assert.Equal(t, uint32(640), device.Register(gvcptest.RegWidth))
+	assert.Equal(t, uint32(720), device.Register(gvcptest.RegHeight))
+}
+
+func TestNodeMapZip(t *testing.T) {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	file, err := archive.Create("camera.xml")
+	require.NoError(t, err)
+	_, err = file.Write([]byte(gvcptest.CameraXML))
+	require.NoError(t, err)
+	require.NoError(t, archive.Close())
+
+	device := newDevice(t)
+	device.SetGenICamFile("camera.zip", buf.Bytes())
+	nodes, err := gvcp.LoadNodeMap(dial(t, device))
+	require.NoError(t, err)
+	value, err := nodes.Get("Width")
+	assert.NoError(t, err)
+	assert.Equal(t, "1280", value)
+}
@@ -0,0 +1,188 @@
+package gvcptest
+
+// Addresses of the registers of the features of CameraXML
+const (
+	RegWidth            uint32 = 0x30204
+	RegWidthMax         uint32 = 0x30208
+	RegHeight           uint32 = 0x3020C
+	RegHeightMax        uint32 = 0x30210
+	RegPixelFormat      uint32 = 0x30214
+	RegGain             uint32 = 0x30220
+	RegReverse          uint32 = 0x30230
+	RegAcquisitionStart uint32 = 0x30240
+)
+
+// Pixel formats of CameraXML
+const (
+	PixelFormatMono8 uint32 = 0x01080001
+	PixelFormatRGB8  uint32 = 0x02180014
+)
+
+// CameraRegisters are the initial values of the registers of CameraXML
+var CameraRegisters = map[uint32]uint32{
+	RegWidth:       1280,
+	RegWidthMax:    1920,
+	RegHeight:      720,
+	RegHeightMax:   1080,
+	RegPixelFormat: PixelFormatMono8,
+	// 1.5 as a big endian IEEE 754 float
+	RegGain: 0x3FC00000,
+}
+
+// CameraXML is the GenICam XML file of a camera with some of the features of the standard feature naming
+// convention
+const CameraXML = `<?xml version="1.0" encoding="UTF-8"?>
+<RegisterDescription ModelName="GVCPTestCamera" VendorName="KubeEdge" StandardNameSpace="GEV"
+    SchemaMajorVersion="1" SchemaMinorVersion="1" SchemaSubMinorVersion="0"
+    MajorVersion="1" MinorVersion="0" SubMinorVersion="0" ToolTip="GVCP test camera"
+    ProductGuid="00000000-0000-0000-0000-000000000000" VersionGuid="00000000-0000-0000-0000-000000000000"
+    xmlns="http://www.genicam.org/GenApi/Version_1_1">
+  <Category Name="Root" NameSpace="Standard">
+    <pFeature>DeviceControl</pFeature>
+    <pFeature>ImageFormatControl</pFeature>
+    <pFeature>AcquisitionControl</pFeature>
+  </Category>
+  <Category Name="DeviceControl" NameSpace="Standard">
+    <pFeature>DeviceSerialNumber</pFeature>
+    <pFeature>DeviceUserID</pFeature>
+  </Category>
+  <Category Name="ImageFormatControl" NameSpace="Standard">
+    <pFeature>Width</pFeature>
+    <pFeature>Height</pFeature>
+    <pFeature>PixelFormat</pFeature>
+    <pFeature>ReverseX</pFeature>
+    <pFeature>ReverseY</pFeature>
+  </Category>
+  <Category Name="AcquisitionControl" NameSpace="Standard">
+    <pFeature>Gain</pFeature>
+    <pFeature>AcquisitionStart</pFeature>
+  </Category>
+
+  <StringReg Name="DeviceSerialNumber" NameSpace="Standard">
+    <Address>0x00D8</Address>
+    <Length>16</Length>
+    <AccessMode>RO</AccessMode>
+    <pPort>Device</pPort>
+  </StringReg>
+  <StringReg Name="DeviceUserID" NameSpace="Standard">
+    <Address>0x00E8</Address>
+    <Length>16</Length>
+    <AccessMode>RW</AccessMode>
+    <pPort>Device</pPort>
+  </StringReg>
+
+  <Group Comment="Image format">
+    <Integer Name="Width" NameSpace="Standard">
+      <pValue>WidthReg</pValue>
+      <Min>16</Min>
+      <pMax>WidthMaxReg</pMax>
+      <Inc>16</Inc>
+    </Integer>
+    <IntReg Name="WidthReg">
+      <Address>0x30204</Address>
+      <Length>4</Length>
+      <AccessMode>RW</AccessMode>
+      <pPort>Device</pPort>
+      <Sign>Unsigned</Sign>
+      <Endianess>BigEndian</Endianess>
+    </IntReg>
+    <IntReg Name="WidthMaxReg">
+      <Address>0x30208</Address>
+      <Length>4</Length>
+      <AccessMode>RO</AccessMode>
+      <pPort>Device</pPort>
+      <Sign>Unsigned</Sign>
+      <Endianess>BigEndian</Endianess>
+    </IntReg>
+    <Integer Name="Height" NameSpace="Standard">
+      <pValue>HeightReg</pValue>
+      <Min>16</Min>
+      <pMax>HeightMaxReg</pMax>
+    </Integer>
+    <IntReg Name="HeightReg">
+      <Address>0x30000</Address>
+      <Address>0x020C</Address>
+      <Length>4</Length>
+      <AccessMode>RW</AccessMode>
+      <pPort>Device</pPort>
+      <Sign>Unsigned</Sign>
+      <Endianess>BigEndian</Endianess>
+    </IntReg>
+    <IntReg Name="HeightMaxReg">
+      <Address>0x30210</Address>
+      <Length>4</Length>
+      <AccessMode>RO</AccessMode>
+      <pPort>Device</pPort>
+      <Sign>Unsigned</Sign>
+      <Endianess>BigEndian</Endianess>
+    </IntReg>
+    <Enumeration Name="PixelFormat" NameSpace="Standard">
+      <EnumEntry Name="Mono8">
+        <Value>0x01080001</Value>
+      </EnumEntry>
+      <EnumEntry Name="RGB8">
+        <Value>0x02180014</Value>
+      </EnumEntry>
+      <pValue>PixelFormatReg</pValue>
+    </Enumeration>
+    <IntReg Name="PixelFormatReg">
+      <Address>0x30214</Address>
+      <Length>4</Length>
+      <AccessMode>RW</AccessMode>
+      <pPort>Device</pPort>
+      <Sign>Unsigned</Sign>
+      <Endianess>BigEndian</Endianess>
+    </IntReg>
+    <Boolean Name="ReverseX" NameSpace="Standard">
+      <pValue>ReverseXReg</pValue>
+    </Boolean>
+    <Boolean Name="ReverseY" NameSpace="Standard">
+      <pValue>ReverseYReg</pValue>
+    </Boolean>
+    <StructReg Comment="Reverse">
+      <Address>0x30230</Address>
+      <Length>4</Length>
+      <AccessMode>RW</AccessMode>
+      <pPort>Device</pPort>
+      <Endianess>BigEndian</Endianess>
+      <StructEntry Name="ReverseXReg">
+        <Bit>31</Bit>
+      </StructEntry>
+      <StructEntry Name="ReverseYReg">
+        <Bit>30</Bit>
+      </StructEntry>
+    </StructReg>
+  </Group>
+
+  <Group Comment="Acquisition">
+    <Float Name="Gain" NameSpace="Standard">
+      <pValue>GainReg</pValue>
+      <Min>0</Min>
+      <Max>24</Max>
+      <Unit>dB</Unit>
+    </Float>
+    <FloatReg Name="GainReg">
+      <Address>0x30220</Address>
+      <Length>4</Length>
+      <AccessMode>RW</AccessMode>
+      <pPort>Device</pPort>
+      <Endianess>BigEndian</Endianess>
+    </FloatReg>
+    <Command Name="AcquisitionStart" NameSpace="Standard">
+      <pValue>AcquisitionCommandReg</pValue>
+      <CommandValue>1</CommandValue>
+    </Command>
+    <IntReg Name="AcquisitionCommandReg">
+      <Address>0x30240</Address>
+      <Length>4</Length>
+      <AccessMode>WO</AccessMode>
+      <pPort>Device</pPort>
+      <Sign>Unsigned</Sign>
+      <Endianess>BigEndian</Endianess>
+    </IntReg>
+  </Group>
+
+  <Port Name="Device" NameSpace="Standard">
+  </Port>
+</RegisterDescription>
+`
@@ -0,0 +1,311 @@
+// Package gvcptest provides a GigE Vision device answering GVCP commands on a local UDP port, to test
+// the clients of GigE Vision cameras without cameras.
+package gvcptest
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/kubeedge/mappers-go/mappers/gige/driver/gvcp"
+)
+
+// GenICamFileAddress is the address of the GenICam XML file in the memory of a Device
+const GenICamFileAddress uint32 = 0x10000
+
+// Commands and acknowledges of the control protocol, as the device sees them
+const (
+	cmdDiscovery uint16 = 0x0002
+	cmdReadReg   uint16 = 0x0080
+	cmdWriteReg  uint16 = 0x0082
+	cmdReadMem   uint16 = 0x0084
+	cmdWriteMem  uint16 = 0x0086
+)
+
+// Device is a GigE Vision device which answers the commands sent to a local UDP port with its memory,
+// which is zero but for the bootstrap registers and the registers of CameraXML. Like a camera, it denies
+// writes of the applications which do not have the control of the device, and releases the control after
+// the heartbeat timeout.
+type Device struct {
+	conn *net.UDPConn
+	done chan struct{}
+
+	mutex      sync.Mutex
+	memory     map[uint32]byte
+	offline    bool
+	controller *net.UDPAddr
+	// lastCommand is the time of the last command of the controller
+	lastCommand time.Time
+	commands    int
+}
+
+// NewDevice start a device with a serial number, described by CameraXML
+func NewDevice(serialNumber string) (*Device, error) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		return nil, err
+	}
+	d := &Device{
+		conn:   conn,
+		done:   make(chan struct{}),
+		memory: make(map[uint32]byte),
+	}
+	d.SetRegister(gvcp.RegVersion, 0x00020000)
+	d.SetString(gvcp.RegManufacturerName, "KubeEdge")
+	d.SetString(gvcp.RegModelName, "GVCP Test Camera")
+	d.SetString(gvcp.RegDeviceVersion, "1.0")
+	d.SetString(gvcp.RegSerialNumber, serialNumber)
+	d.SetRegister(gvcp.RegHeartbeatTimeout, 3000)
+	for address, value := range CameraRegisters {
+		d.SetRegister(address, value)
+	}
+	d.SetGenICamFile("camera.xml", []byte(CameraXML))
+	go d.serve()
+	return d, nil
+}
+
+// Addr get the address of the control channel of the device
+func (d *Device) Addr() string {
+	return d.conn.LocalAddr().String()
+}
+
+// Close stop the device
+func (d *Device) Close() error {
+	err := d.conn.Close()
+	<-d.done
+	return err
+}
+
+// SetOffline stop answering commands while offline is true. The device loses the control of the
+// application as if it was powered off.
+func (d *Device) SetOffline(offline bool) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.offline = offline
+	if offline {
+		d.controller = nil
+	}
+}
+
+// Controller get the address of the application which has the control of the device, nil if none
+func (d *Device) Controller() net.Addr {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if !d.controlled() {
+		return nil
+	}
+	return d.controller
+}
+
+// Commands get the number of commands the device answered
+func (d *Device) Commands() int {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.commands
+}
+
+// Register read a 32-bit register
+func (d *Device) Register(address uint32) uint32 {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return binary.BigEndian.Uint32(d.read(address, 4))
+}
+
+// SetRegister write a 32-bit register
+func (d *Device) SetRegister(address uint32, value uint32) {
+	data := make([]byte, 4)
+	binary.BigEndian.PutUint32(data, value)
+	d.SetMemory(address, data)
+}
+
+// Memory read n bytes of memory
+func (d *Device) Memory(address uint32, n int) []byte {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.read(address, n)
+}
+
+// SetMemory write data to memory
+func (d *Device) SetMemory(address uint32, data []byte) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.write(address, data)
+}
+
+// SetString write a string register of the bootstrap registers, such as gvcp.RegSerialNumber
+func (d *Device) SetString(address uint32, value string) {
+	d.SetMemory(address, append([]byte(value), 0))
+}
+
+// SetGenICamFile write a GenICam XML file, or a zip file of it if name ends with .zip, at
+// GenICamFileAddress and its URL to the first URL register
+func (d *Device) SetGenICamFile(name string, data []byte) {
+	d.SetMemory(GenICamFileAddress, data)
+	d.SetString(gvcp.RegFirstURL, fmt.Sprintf("Local:%s;%X;%X", name, GenICamFileAddress, len(data)))
+}
+
+func (d *Device) read(address uint32, n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = d.memory[address+uint32(i)]
+	}
+	return data
+}
+
+func (d *Device) write(address uint32, data []byte) {
+	for i, b := range data {
+		d.memory[address+uint32(i)] = b
+	}
+}
+
+// controlled tell whether an application has the control of the device and sent commands during the
+// heartbeat timeout
+func (d *Device) controlled() bool {
+	timeout := time.Duration(binary.BigEndian.Uint32(d.read(gvcp.RegHeartbeatTimeout, 4))) * time.Millisecond
+	if d.controller != nil && time.Since(d.lastCommand) > timeout {
+		d.controller = nil
+	}
+	return d.controller != nil
+}
+
+func sameAddr(a *net.UDPAddr, b *net.UDPAddr) bool {
+	return a != nil && b != nil && a.IP.Equal(b.IP) && a.Port == b.Port
+}
+
+func (d *Device) serve() {
+	defer close(d.done)
+	buf := make([]byte, 1500)
+	for {
+		n, from, err := d.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		if n < 8 || buf[0] != 0x42 {
+			continue
+		}
+		flags := buf[1]
+		code := binary.BigEndian.Uint16(buf[2:])
+		length := int(binary.BigEndian.Uint16(buf[4:]))
+		id := binary.BigEndian.Uint16(buf[6:])
+		if n < 8+length {
+			continue
+		}
+		d.mutex.Lock()
+		if d.offline {
+			d.mutex.Unlock()
+			continue
+		}
+		d.commands++
+		status, payload := d.handle(from, code, buf[8:8+length])
+		d.mutex.Unlock()
+		if flags&0x01 == 0 {
+			continue
+		}
+		ack := make([]byte, 8+len(payload))
+		binary.BigEndian.PutUint16(ack, status)
+		binary.BigEndian.PutUint16(ack[2:], code+1)
+		binary.BigEndian.PutUint16(ack[4:], uint16(len(payload)))
+		binary.BigEndian.PutUint16(ack[6:], id)
+		copy(ack[8:], payload)
+		_, _ = d.conn.WriteToUDP(ack, from)
+	}
+}
+
+// handle a command of an application and get the status and the payload of its acknowledge
+func (d *Device) handle(from *net.UDPAddr, code uint16, payload []byte) (uint16, []byte) {
+	controlled := d.controlled()
+	if sameAddr(from, d.controller) {
+		d.lastCommand = time.Now()
+	}
+	// the applications which do not have the control can only read
+	canWrite := !controlled || sameAddr(from, d.controller)
+
+	switch code {
+	case cmdDiscovery:
+		return gvcp.StatusSuccess, d.discoveryAck()
+	case cmdReadReg:
+		if len(payload)%4 != 0 {
+			return gvcp.StatusInvalidParameter, nil
+		}
+		ack := make([]byte, 0, len(payload))
+		for i := 0; i < len(payload); i += 4 {
+			address := binary.BigEndian.Uint32(payload[i:])
+			if address%4 != 0 {
+				return gvcp.StatusBadAlignment, nil
+			}
+			ack = append(ack, d.read(address, 4)...)
+		}
+		return gvcp.StatusSuccess, ack
+	case cmdWriteReg:
+		if len(payload)%8 != 0 {
+			return gvcp.StatusInvalidParameter, nil
+		}
+		for i := 0; i < len(payload); i += 8 {
+			address := binary.BigEndian.Uint32(payload[i:])
+			value := binary.BigEndian.Uint32(payload[i+4:])
+			if address%4 != 0 {
+				return gvcp.StatusBadAlignment, nil
+			}
+			if address == gvcp.RegControlChannelPrivilege {
+				if !canWrite {
+					return gvcp.StatusAccessDenied, nil
+				}
+				if value&(gvcp.PrivilegeControlAccess|gvcp.PrivilegeExclusiveAccess) == 0 {
+					d.controller = nil
+				} else {
+					d.controller, d.lastCommand = from, time.Now()
+				}
+			} else if !canWrite {
+				return gvcp.StatusAccessDenied, nil
+			}
+			d.write(address, payload[i+4:i+8])
+		}
+		return gvcp.StatusSuccess, []byte{0, 0, 0, byte(len(payload) / 8)}
+	case cmdReadMem:
+		if len(payload) < 8 {
+			return gvcp.StatusInvalidParameter, nil
+		}
+		address := binary.BigEndian.Uint32(payload)
+		count := int(binary.BigEndian.Uint16(payload[6:]))
+		if address%4 != 0 || count%4 != 0 {
+			return gvcp.StatusBadAlignment, nil
+		}
+		if count > gvcp.MaxMemorySize {
+			return gvcp.StatusInvalidParameter, nil
+		}
+		return gvcp.StatusSuccess, append(append([]byte(nil), payload[:4]...), d.read(address, count)...)
+	case cmdWriteMem:
+		if len(payload) < 4 || len(payload) > 4+gvcp.MaxMemorySize {
+			return gvcp.StatusInvalidParameter, nil
+		}
+		address := binary.BigEndian.Uint32(payload)
+		if address%4 != 0 || len(payload)%4 != 0 {
+			return gvcp.StatusBadAlignment, nil
+		}
+		if !canWrite {
+			return gvcp.StatusAccessDenied, nil
+		}
+		d.write(address, payload[4:])
+		written := make([]byte, 4)
+		binary.BigEndian.PutUint16(written[2:], uint16(len(payload)-4))
+		return gvcp.StatusSuccess, written
+	}
+	return gvcp.StatusNotImplemented, nil
+}
+
+// discoveryAck get the payload of the acknowledge of a discovery command
+func (d *Device) discoveryAck() []byte {
+	ack := make([]byte, 248)
+	copy(ack, d.read(gvcp.RegVersion, 4))
+	copy(ack[10:16], []byte{0x02, 0x00, 0x00, 0x00, 0x00, 0x01})
+	copy(ack[36:40], net.IPv4(127, 0, 0, 1).To4())
+	copy(ack[52:56], net.IPv4(255, 0, 0, 0).To4())
+	copy(ack[72:104], d.read(gvcp.RegManufacturerName, 32))
+	copy(ack[104:136], d.read(gvcp.RegModelName, 32))
+	copy(ack[136:168], d.read(gvcp.RegDeviceVersion, 32))
+	copy(ack[216:232], d.read(gvcp.RegSerialNumber, 16))
+	copy(ack[232:248], d.read(gvcp.RegUserDefinedName, 16))
+	return ack
+}
@@ -0,0 +1,190 @@
+// Package gvcp is a client of the GigE Vision Control Protocol, which discovers GigE Vision cameras,
+// reads and writes their registers and memory, and gets their features described by GenICam XML files.
+package gvcp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// ControlPort is the UDP port of the control channel of GigE Vision devices
+const ControlPort = 3956
+
+const (
+	headerSize = 8
+	keyCommand = 0x42
+	// flagAckRequired asks the device to acknowledge a command
+	flagAckRequired = 0x01
+	// flagBroadcastAck allows the device to broadcast the acknowledge of a discovery command when it is
+	// not in the subnet of the application
+	flagBroadcastAck = 0x10
+)
+
+// Commands and their acknowledges
+const (
+	cmdDiscovery   uint16 = 0x0002
+	ackDiscovery   uint16 = 0x0003
+	cmdReadReg     uint16 = 0x0080
+	ackReadReg     uint16 = 0x0081
+	cmdWriteReg    uint16 = 0x0082
+	ackWriteReg    uint16 = 0x0083
+	cmdReadMem     uint16 = 0x0084
+	ackReadMem     uint16 = 0x0085
+	cmdWriteMem    uint16 = 0x0086
+	ackWriteMem    uint16 = 0x0087
+	ackPendingResp uint16 = 0x0089
+)
+
+// MaxMemorySize is the most bytes read or written by a memory command
+const MaxMemorySize = 512
+
+// Bootstrap registers of GigE Vision devices
+const (
+	RegVersion          uint32 = 0x0000
+	RegManufacturerName uint32 = 0x0048
+	RegModelName        uint32 = 0x0068
+	RegDeviceVersion    uint32 = 0x0088
+	RegSerialNumber     uint32 = 0x00D8
+	RegUserDefinedName  uint32 = 0x00E8
+	RegFirstURL         uint32 = 0x0200
+	RegSecondURL        uint32 = 0x0400
+	RegHeartbeatTimeout uint32 = 0x0938
+	// RegControlChannelPrivilege is written by the application that controls the device
+	RegControlChannelPrivilege uint32 = 0x0A00
+)
+
+// Values of the control channel privilege register
+const (
+	PrivilegeExclusiveAccess uint32 = 0x1
+	PrivilegeControlAccess   uint32 = 0x2
+)
+
+// Status codes of acknowledges
+const (
+	StatusSuccess          uint16 = 0x0000
+	StatusNotImplemented   uint16 = 0x8001
+	StatusInvalidParameter uint16 = 0x8002
+	StatusInvalidAddress   uint16 = 0x8003
+	StatusWriteProtect     uint16 = 0x8004
+	StatusBadAlignment     uint16 = 0x8005
+	StatusAccessDenied     uint16 = 0x8006
+	StatusBusy             uint16 = 0x8007
+	StatusGenericError     uint16 = 0x8FFF
+)
+
+var statusNames = map[uint16]string{
+	StatusNotImplemented:   "not implemented",
+	StatusInvalidParameter: "invalid parameter",
+	StatusInvalidAddress:   "invalid address",
+	StatusWriteProtect:     "write protect",
+	StatusBadAlignment:     "bad alignment",
+	StatusAccessDenied:     "access denied",
+	StatusBusy:             "busy",
+	StatusGenericError:     "error",
+}
+
+// StatusError is the status of a command that failed on the device
+type StatusError struct {
+	Status uint16
+}
+
+func (e *StatusError) Error() string {
+	if name, ok := statusNames[e.Status]; ok {
+		return fmt.Sprintf("gvcp status 0x%04X: %s", e.Status, name)
+	}
+	return fmt.Sprintf("gvcp status 0x%04X", e.Status)
+}
+
+// ErrTimeout is returned when the device did not acknowledge a command after the retries
+var ErrTimeout = errors.New("gvcp: the device did not answer")
+
+// command is a GVCP command or acknowledge packet
+type command struct {
+	// flags of a command, status of an acknowledge
+	flags   uint16
+	code    uint16
+	id      uint16
+	payload []byte
+}
+
+func (c *command) marshal() []byte {
+	buf := make([]byte, headerSize+len(c.payload))
+	buf[0] = keyCommand
+	buf[1] = byte(c.flags)
+	binary.BigEndian.PutUint16(buf[2:], c.code)
+	binary.BigEndian.PutUint16(buf[4:], uint16(len(c.payload)))
+	binary.BigEndian.PutUint16(buf[6:], c.id)
+	copy(buf[headerSize:], c.payload)
+	return buf
+}
+
+func parseCommand(buf []byte) (*command, error) {
+	if len(buf) < headerSize || buf[0] != keyCommand {
+		return nil, errors.New("gvcp: invalid command")
+	}
+	return parsePacket(buf, uint16(buf[1]))
+}
+
+func parseAck(buf []byte) (*command, error) {
+	if len(buf) < headerSize {
+		return nil, errors.New("gvcp: invalid acknowledge")
+	}
+	return parsePacket(buf, binary.BigEndian.Uint16(buf))
+}
+
+func parsePacket(buf []byte, flags uint16) (*command, error) {
+	length := int(binary.BigEndian.Uint16(buf[4:]))
+	if len(buf) < headerSize+length {
+		return nil, fmt.Errorf("gvcp: truncated packet of %d bytes, %d expected", len(buf), headerSize+length)
+	}
+	return &command{
+		flags:   flags,
+		code:    binary.BigEndian.Uint16(buf[2:]),
+		id:      binary.BigEndian.Uint16(buf[6:]),
+		payload: buf[headerSize : headerSize+length],
+	}, nil
+}
+
+// DeviceInfo is the acknowledge of a discovery command
+type DeviceInfo struct {
+	MAC              net.HardwareAddr
+	IP               net.IP
+	SubnetMask       net.IP
+	Gateway          net.IP
+	ManufacturerName string
+	ModelName        string
+	DeviceVersion    string
+	SerialNumber     string
+	UserDefinedName  string
+}
+
+const discoveryAckSize = 248
+
+func parseDeviceInfo(buf []byte) (*DeviceInfo, error) {
+	if len(buf) < discoveryAckSize {
+		return nil, fmt.Errorf("gvcp: discovery acknowledge of %d bytes, %d expected", len(buf), discoveryAckSize)
+	}
+	ip := func(b []byte) net.IP { return net.IPv4(b[0], b[1], b[2], b[3]) }
+	return &DeviceInfo{
+		MAC:              net.HardwareAddr(append([]byte(nil), buf[10:16]...)),
+		IP:               ip(buf[36:40]),
+		SubnetMask:       ip(buf[52:56]),
+		Gateway:          ip(buf[68:72]),
+		ManufacturerName: cString(buf[72:104]),
+		ModelName:        cString(buf[104:136]),
+		DeviceVersion:    cString(buf[136:168]),
+		SerialNumber:     cString(buf[216:232]),
+		UserDefinedName:  cString(buf[232:248]),
+	}, nil
+}
+
+// cString get a string ended by a NUL byte, or the end of b
+func cString(b []byte) string {
+	if i := strings.IndexByte(string(b), 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
@@ -0,0 +1,90 @@
+package driver
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kubeedge/mappers-go/mappers/gige/driver/gvcp"
+)
+
+const gvcpBackend = "gvcp"
+
+// discoveryTimeout is the time to wait for the cameras to answer a discovery
+var discoveryTimeout = time.Second
+
+// gvcpCamera is a camera controlled with GVCP, its features are described by its GenICam XML file
+type gvcpCamera struct {
+	client *gvcp.Client
+	nodes  *gvcp.NodeMap
+}
+
+func openGVCPCamera(config CommonCustomizedValues) (camera, error) {
+	address := config.Address
+	if address == "" {
+		devices, err := gvcp.Discover("", discoveryTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("discover GigE Vision cameras: %v", err)
+		}
+		for _, device := range devices {
+			if device.SerialNumber == config.DeviceSN {
+				address = device.IP.String()
+				break
+			}
+		}
+		if address == "" {
+			return nil, fmt.Errorf("no GigE Vision camera with serial number %s was discovered", config.DeviceSN)
+		}
+	}
+	client, err := gvcp.Dial(address)
+	if err != nil {
+		return nil, err
+	}
+	cam, err := func() (*gvcpCamera, error) {
+		serialNumber, err := client.ReadString(gvcp.RegSerialNumber, 16)
+		if err != nil {
+			return nil, fmt.Errorf("read the serial number of the camera at %s: %v", address, err)
+		}
+		if serialNumber != config.DeviceSN {
+			return nil, fmt.Errorf("the camera at %s has serial number %s, not %s", address, serialNumber, config.DeviceSN)
+		}
+		if err = client.RequestControl(); err != nil {
+			return nil, err
+		}
+		nodes, err := gvcp.LoadNodeMap(client)
+		if err != nil {
+			return nil, err
+		}
+		return &gvcpCamera{client: client, nodes: nodes}, nil
+	}()
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	return cam, nil
+}
+
+// gvcpError wrap errDisconnected in the errors of commands the camera did not answer
+func gvcpError(err error) error {
+	if errors.Is(err, gvcp.ErrTimeout) {
+		return fmt.Errorf("%w: %v", errDisconnected, err)
+	}
+	return err
+}
+
+func (c *gvcpCamera) get(feature string) (string, error) {
+	value, err := c.nodes.Get(feature)
+	return value, gvcpError(err)
+}
+
+func (c *gvcpCamera) set(feature string, value string) error {
+	return gvcpError(c.nodes.Set(feature, value))
+}
+
+func (c *gvcpCamera) image(string) ([]byte, error) {
+	return nil, errors.New("images are not streamed by the gvcp backend, use the rcapi backend")
+}
+
+func (c *gvcpCamera) close() {
+	c.client.Close()
+}
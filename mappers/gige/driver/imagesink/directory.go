@@ -0,0 +1,132 @@
+package imagesink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// metadataExt is the extension of the metadata file written next to each image
+const metadataExt = ".json"
+
+// DirectoryConfig is the configuration of a sink which writes images to a local directory
+type DirectoryConfig struct {
+	Path string `json:"path"`
+	// MaxFiles is the number of images kept in the directory, unlimited if 0
+	MaxFiles int `json:"maxFiles,omitempty"`
+	// MaxAge is how long images are kept in seconds, unlimited if 0
+	MaxAge int `json:"maxAge,omitempty"`
+}
+
+// Directory is a sink which writes each image and its metadata to files of a local directory, and deletes
+// the oldest images beyond its retention
+type Directory struct {
+	config DirectoryConfig
+	mutex  sync.Mutex
+}
+
+// NewDirectory create a sink which writes images to a local directory, which is created if it does not
+// exist
+func NewDirectory(config DirectoryConfig) (*Directory, error) {
+	if config.Path == "" {
+		return nil, fmt.Errorf("the path of the image directory is empty")
+	}
+	if err := os.MkdirAll(config.Path, 0755); err != nil {
+		return nil, err
+	}
+	return &Directory{config: config}, nil
+}
+
+// Send write an image and its metadata, then apply the retention
+func (s *Directory) Send(_ context.Context, image *Image) error {
+	metadata, err := json.Marshal(image.Metadata)
+	if err != nil {
+		return &permanentError{err: err}
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	name := filepath.Join(s.config.Path, image.FileName())
+	// the metadata is written first, so that an image is never found without it
+	if err = writeFile(name+metadataExt, metadata); err != nil {
+		return err
+	}
+	if err = writeFile(name, image.Data); err != nil {
+		os.Remove(name + metadataExt)
+		return err
+	}
+	s.retain()
+	return nil
+}
+
+// writeFile write a file atomically, with a temporary file renamed when it is complete
+func writeFile(name string, data []byte) error {
+	tmp := name + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+// retain delete the images older than the maximum age, then the oldest ones beyond the maximum number of
+// files, with their metadata
+func (s *Directory) retain() {
+	if s.config.MaxFiles <= 0 && s.config.MaxAge <= 0 {
+		return
+	}
+	entries, err := ioutil.ReadDir(s.config.Path)
+	if err != nil {
+		klog.Errorf("Failed to apply the retention of image directory %s: %v", s.config.Path, err)
+		return
+	}
+	var images []os.FileInfo
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasSuffix(name, metadataExt) || strings.HasSuffix(name, ".tmp") {
+			continue
+		}
+		images = append(images, entry)
+	}
+	sort.Slice(images, func(i, j int) bool {
+		if !images[i].ModTime().Equal(images[j].ModTime()) {
+			return images[i].ModTime().Before(images[j].ModTime())
+		}
+		// the names of the images of a camera sort by timestamp
+		return images[i].Name() < images[j].Name()
+	})
+
+	remove := 0
+	if s.config.MaxAge > 0 {
+		oldest := time.Now().Add(-time.Duration(s.config.MaxAge) * time.Second)
+		for remove < len(images) && images[remove].ModTime().Before(oldest) {
+			remove++
+		}
+	}
+	if s.config.MaxFiles > 0 && len(images)-remove > s.config.MaxFiles {
+		remove = len(images) - s.config.MaxFiles
+	}
+	for _, image := range images[:remove] {
+		name := filepath.Join(s.config.Path, image.Name())
+		if err := os.Remove(name); err != nil {
+			klog.Errorf("Failed to delete image %s: %v", name, err)
+			continue
+		}
+		if err := os.Remove(name + metadataExt); err != nil && !os.IsNotExist(err) {
+			klog.Errorf("Failed to delete image metadata %s: %v", name+metadataExt, err)
+		}
+	}
+}
+
+// Close does nothing, the files are closed when they are written
+func (s *Directory) Close() error {
+	return nil
+}
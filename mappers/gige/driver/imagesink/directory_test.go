@@ -0,0 +1,55 @@
+package imagesink
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDirectoryRetention(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "images")
+	s, err := NewDirectory(DirectoryConfig{Path: dir, MaxFiles: 2, MaxAge: 3600})
+	require.NoError(t, err)
+
+	image := testImage()
+	require.NoError(t, s.Send(context.Background(), image))
+	name := filepath.Join(dir, image.FileName())
+	data, err := ioutil.ReadFile(name)
+	require.NoError(t, err)
+	assert.Equal(t, image.Data, data)
+	data, err = ioutil.ReadFile(name + ".json")
+	require.NoError(t, err)
+	var metadata Metadata
+	require.NoError(t, json.Unmarshal(data, &metadata))
+	assert.Equal(t, image.Metadata, metadata)
+
+	// the image is older than the maximum age when the next one is written
+	old := time.Now().Add(-2 * time.Hour)
+	require.NoError(t, os.Chtimes(name, old, old))
+	var names []string
+	for i := 1; i <= 3; i++ {
+		image := testImage()
+		image.Timestamp = image.Timestamp.Add(time.Duration(i) * time.Second)
+		require.NoError(t, s.Send(context.Background(), image))
+		names = append(names, image.FileName())
+	}
+	_, err = os.Stat(name)
+	assert.True(t, os.IsNotExist(err), "the image older than the maximum age is deleted")
+	_, err = os.Stat(name + ".json")
+	assert.True(t, os.IsNotExist(err), "the metadata of deleted images is deleted")
+
+	entries, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	var files []string
+	for _, entry := range entries {
+		files = append(files, entry.Name())
+	}
+	assert.Equal(t, []string{names[1], names[1] + ".json", names[2], names[2] + ".json"}, files)
+}
@@ -0,0 +1,162 @@
+package imagesink
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Encodings of the images posted to HTTP servers
+const (
+	// EncodingMultipart posts the image as a file and its metadata as JSON in a multipart/form-data body
+	EncodingMultipart = "multipart"
+	// EncodingForm posts the image encoded in base64 in the gigEImage field of a form, as the mapper did
+	// before sinks could be configured
+	EncodingForm = "form"
+)
+
+const (
+	defaultHTTPTimeout = 30000 // milliseconds
+	defaultFileField   = "image"
+)
+
+// HTTPConfig is the configuration of a sink which posts images to an HTTP server
+type HTTPConfig struct {
+	URL string `json:"url"`
+	// Method is POST by default
+	Method string `json:"method,omitempty"`
+	// Encoding is multipart by default
+	Encoding string `json:"encoding,omitempty"`
+	// FileField is the name of the field of the image in multipart bodies, image by default
+	FileField string            `json:"fileField,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	// Username and Password are sent with basic authentication
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	// Token is sent as a bearer token
+	Token string `json:"token,omitempty"`
+	// Timeout of a request in milliseconds, 30000 by default
+	Timeout int `json:"timeout,omitempty"`
+}
+
+// HTTP is a sink which posts images to an HTTP server
+type HTTP struct {
+	config HTTPConfig
+	client *http.Client
+}
+
+// NewHTTP create a sink which posts images to an HTTP server
+func NewHTTP(config HTTPConfig) (*HTTP, error) {
+	u, err := url.Parse(strings.TrimSpace(config.URL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid image URL %q", config.URL)
+	}
+	config.URL = u.String()
+	if config.Method == "" {
+		config.Method = http.MethodPost
+	}
+	switch config.Encoding {
+	case "":
+		config.Encoding = EncodingMultipart
+	case EncodingMultipart, EncodingForm:
+	default:
+		return nil, fmt.Errorf("encoding %q is not supported", config.Encoding)
+	}
+	if config.FileField == "" {
+		config.FileField = defaultFileField
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaultHTTPTimeout
+	}
+	return &HTTP{
+		config: config,
+		client: &http.Client{Timeout: time.Duration(config.Timeout) * time.Millisecond},
+	}, nil
+}
+
+// Send post an image, the requests answered with client errors are not retried
+func (s *HTTP) Send(ctx context.Context, image *Image) error {
+	body, contentType, err := s.encode(image)
+	if err != nil {
+		return &permanentError{err: err}
+	}
+	request, err := http.NewRequestWithContext(ctx, s.config.Method, s.config.URL, body)
+	if err != nil {
+		return &permanentError{err: err}
+	}
+	request.Header.Set("Content-Type", contentType)
+	for key, value := range s.config.Headers {
+		request.Header.Set(key, value)
+	}
+	if s.config.Username != "" {
+		request.SetBasicAuth(s.config.Username, s.config.Password)
+	}
+	if s.config.Token != "" {
+		request.Header.Set("Authorization", "Bearer "+s.config.Token)
+	}
+	response, err := s.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	message, _ := ioutil.ReadAll(io.LimitReader(response.Body, 512))
+	if response.StatusCode < 300 {
+		return nil
+	}
+	err = fmt.Errorf("%s %s: %s %s", s.config.Method, s.config.URL, response.Status, strings.TrimSpace(string(message)))
+	if response.StatusCode < 500 && response.StatusCode != http.StatusRequestTimeout &&
+		response.StatusCode != http.StatusTooManyRequests {
+		return &permanentError{err: err}
+	}
+	return err
+}
+
+// encode the body of the request of an image
+func (s *HTTP) encode(image *Image) (io.Reader, string, error) {
+	metadata, err := json.Marshal(image.Metadata)
+	if err != nil {
+		return nil, "", err
+	}
+	if s.config.Encoding == EncodingForm {
+		v := url.Values{}
+		v.Set("gigEImage", base64.URLEncoding.EncodeToString(image.Data))
+		v.Set("metadata", string(metadata))
+		return strings.NewReader(v.Encode()), "application/x-www-form-urlencoded", nil
+	}
+
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name=%q; filename=%q`, s.config.FileField, image.FileName()))
+	header.Set("Content-Type", image.ContentType())
+	part, err := writer.CreatePart(header)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err = part.Write(image.Data); err != nil {
+		return nil, "", err
+	}
+	if err = writer.WriteField("metadata", string(metadata)); err != nil {
+		return nil, "", err
+	}
+	if err = writer.Close(); err != nil {
+		return nil, "", err
+	}
+	return &buf, writer.FormDataContentType(), nil
+}
+
+// Close close the idle connections to the server
+func (s *HTTP) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,79 @@
+package imagesink
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPMultipart(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			http.Error(w, "restarting", http.StatusServiceUnavailable)
+			return
+		}
+		username, password, ok := r.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "camera", username)
+		assert.Equal(t, "secret", password)
+		assert.Equal(t, "line-3", r.Header.Get("X-Line"))
+		assert.Equal(t, http.MethodPut, r.Method)
+
+		require.NoError(t, r.ParseMultipartForm(1<<20))
+		file, header, err := r.FormFile("frame")
+		require.NoError(t, err)
+		defer file.Close()
+		data, _ := ioutil.ReadAll(file)
+		assert.Equal(t, testImage().Data, data)
+		assert.Equal(t, "SN0001_20220304T050607.000008000Z.jpeg", header.Filename)
+		assert.Equal(t, "image/jpeg", header.Header.Get("Content-Type"))
+		var metadata Metadata
+		require.NoError(t, json.Unmarshal([]byte(r.FormValue("metadata")), &metadata))
+		assert.Equal(t, testImage().Metadata, metadata)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	s, err := NewHTTP(HTTPConfig{URL: server.URL, Method: http.MethodPut, FileField: "frame",
+		Headers: map[string]string{"X-Line": "line-3"}, Username: "camera", Password: "secret"})
+	require.NoError(t, err)
+	defer s.Close()
+	// server errors are retried
+	assert.Error(t, s.Send(context.Background(), testImage()))
+	assert.NoError(t, s.Send(context.Background(), testImage()))
+}
+
+func TestHTTPForm(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			http.Error(w, "who are you", http.StatusUnauthorized)
+			return
+		}
+		require.NoError(t, r.ParseForm())
+		data, err := base64.URLEncoding.DecodeString(r.PostForm.Get("gigEImage"))
+		assert.NoError(t, err)
+		assert.Equal(t, testImage().Data, data)
+		assert.Contains(t, r.PostForm.Get("metadata"), `"serialNumber":"SN0001"`)
+	}))
+	defer server.Close()
+
+	s, err := NewHTTP(HTTPConfig{URL: server.URL, Encoding: EncodingForm, Token: "token"})
+	require.NoError(t, err)
+	assert.NoError(t, s.Send(context.Background(), testImage()))
+
+	s, err = NewHTTP(HTTPConfig{URL: server.URL, Encoding: EncodingForm})
+	require.NoError(t, err)
+	err = s.Send(context.Background(), testImage())
+	var permanent *permanentError
+	assert.True(t, errors.As(err, &permanent), "client errors are not retried: %v", err)
+}
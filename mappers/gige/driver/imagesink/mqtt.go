@@ -0,0 +1,122 @@
+package imagesink
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+const (
+	defaultMQTTTimeout = 30000 // milliseconds
+	// serialPlaceholder in a topic is replaced by the serial number of the camera
+	serialPlaceholder = "{serialNumber}"
+	// metadataTopic is added to the topic of the images for their metadata
+	metadataTopic = "/metadata"
+)
+
+// MQTTConfig is the configuration of a sink which publishes images to an MQTT broker
+type MQTTConfig struct {
+	// Broker is the URL of the broker, such as tcp://127.0.0.1:1883
+	Broker string `json:"broker"`
+	// Topic of the images, {serialNumber} is replaced by the serial number of the camera. The metadata of
+	// each image is published as JSON to the topic followed by /metadata, before the image.
+	Topic    string `json:"topic"`
+	QoS      byte   `json:"qos,omitempty"`
+	Retained bool   `json:"retained,omitempty"`
+	ClientID string `json:"clientID,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	// Timeout of the connection and of a publication in milliseconds, 30000 by default
+	Timeout int `json:"timeout,omitempty"`
+}
+
+// newMQTTClient create the client of a broker, it is replaced in tests
+var newMQTTClient = mqtt.NewClient
+
+// MQTT is a sink which publishes images as binary messages to an MQTT broker
+type MQTT struct {
+	config  MQTTConfig
+	timeout time.Duration
+	mutex   sync.Mutex
+	client  mqtt.Client
+}
+
+// NewMQTT create a sink which publishes images to an MQTT broker, it connects when the first image is sent
+func NewMQTT(config MQTTConfig) (*MQTT, error) {
+	if config.Broker == "" {
+		return nil, errors.New("the MQTT broker is empty")
+	}
+	if config.Topic == "" {
+		return nil, errors.New("the MQTT topic is empty")
+	}
+	if config.QoS > 2 {
+		return nil, fmt.Errorf("invalid MQTT QoS %d", config.QoS)
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaultMQTTTimeout
+	}
+	return &MQTT{config: config, timeout: time.Duration(config.Timeout) * time.Millisecond}, nil
+}
+
+// connect connect to the broker if it is not connected, the client reconnects by itself once connected
+func (s *MQTT) connect() (mqtt.Client, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.client != nil {
+		return s.client, nil
+	}
+	opts := mqtt.NewClientOptions().AddBroker(s.config.Broker).SetClientID(s.config.ClientID).
+		SetCleanSession(true).SetAutoReconnect(true).SetConnectTimeout(s.timeout)
+	opts.SetUsername(s.config.Username)
+	opts.SetPassword(s.config.Password)
+	client := newMQTTClient(opts)
+	if err := wait(client.Connect(), s.timeout); err != nil {
+		return nil, fmt.Errorf("connect to MQTT broker %s: %v", s.config.Broker, err)
+	}
+	s.client = client
+	return client, nil
+}
+
+func wait(token mqtt.Token, timeout time.Duration) error {
+	if !token.WaitTimeout(timeout) {
+		return errors.New("timeout")
+	}
+	return token.Error()
+}
+
+// Send publish the metadata of an image, then the image
+func (s *MQTT) Send(_ context.Context, image *Image) error {
+	metadata, err := json.Marshal(image.Metadata)
+	if err != nil {
+		return &permanentError{err: err}
+	}
+	client, err := s.connect()
+	if err != nil {
+		return err
+	}
+	topic := strings.ReplaceAll(s.config.Topic, serialPlaceholder, image.SerialNumber)
+	if err = wait(client.Publish(topic+metadataTopic, s.config.QoS, s.config.Retained, metadata), s.timeout); err != nil {
+		return fmt.Errorf("publish the metadata of image %s to %s: %v", image.FileName(), topic+metadataTopic, err)
+	}
+	if err = wait(client.Publish(topic, s.config.QoS, s.config.Retained, image.Data), s.timeout); err != nil {
+		return fmt.Errorf("publish image %s to %s: %v", image.FileName(), topic, err)
+	}
+	return nil
+}
+
+// Close disconnect from the broker
+func (s *MQTT) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.client != nil {
+		s.client.Disconnect(250)
+		s.client = nil
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package imagesink
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeToken struct {
+	err error
+}
+
+func (t *fakeToken) Wait() bool                     { return true }
+func (t *fakeToken) WaitTimeout(time.Duration) bool { return true }
+func (t *fakeToken) Error() error                   { return t.err }
+
+func (t *fakeToken) Done() <-chan struct{} {
+	done := make(chan struct{})
+	close(done)
+	return done
+}
+
+type message struct {
+	topic    string
+	qos      byte
+	retained bool
+	payload  []byte
+}
+
+type fakeMQTT struct {
+	mqtt.Client
+	options    *mqtt.ClientOptions
+	connectErr error
+	published  []message
+	connected  bool
+}
+
+func (c *fakeMQTT) Connect() mqtt.Token {
+	c.connected = c.connectErr == nil
+	return &fakeToken{err: c.connectErr}
+}
+
+func (c *fakeMQTT) Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token {
+	c.published = append(c.published, message{topic: topic, qos: qos, retained: retained, payload: payload.([]byte)})
+	return &fakeToken{}
+}
+
+func (c *fakeMQTT) Disconnect(uint) {
+	c.connected = false
+}
+
+func TestMQTT(t *testing.T) {
+	client := &fakeMQTT{connectErr: errors.New("connection refused")}
+	newMQTTClient = func(options *mqtt.ClientOptions) mqtt.Client {
+		client.options = options
+		return client
+	}
+	defer func() { newMQTTClient = mqtt.NewClient }()
+
+	s, err := NewMQTT(MQTTConfig{Broker: "tcp://127.0.0.1:1883", Topic: "cameras/{serialNumber}/image", QoS: 1,
+		Username: "camera", Password: "secret"})
+	require.NoError(t, err)
+	assert.Error(t, s.Send(context.Background(), testImage()), "the broker is unreachable")
+
+	client.connectErr = nil
+	require.NoError(t, s.Send(context.Background(), testImage()))
+	assert.Equal(t, "camera", client.options.Username)
+	require.Len(t, client.published, 2)
+	assert.Equal(t, "cameras/SN0001/image/metadata", client.published[0].topic)
+	var metadata Metadata
+	require.NoError(t, json.Unmarshal(client.published[0].payload, &metadata))
+	assert.Equal(t, testImage().Metadata, metadata)
+	assert.Equal(t, message{topic: "cameras/SN0001/image", qos: 1, payload: testImage().Data}, client.published[1])
+
+	require.NoError(t, s.Close())
+	assert.False(t, client.connected)
+}
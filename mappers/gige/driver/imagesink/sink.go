@@ -0,0 +1,360 @@
+// Package imagesink uploads the images grabbed by cameras to HTTP servers, local directories or MQTT
+// brokers, retrying the failed uploads and counting the uploads of each sink.
+package imagesink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// Types of sinks
+const (
+	TypeHTTP      = "http"
+	TypeDirectory = "directory"
+	TypeMQTT      = "mqtt"
+)
+
+// Defaults of the retries of uploads
+const (
+	defaultMaxAttempts    = 3
+	defaultInitialBackoff = 1000  // milliseconds
+	defaultMaxBackoff     = 30000 // milliseconds
+)
+
+// Metadata describes an image, it is attached to each upload
+type Metadata struct {
+	SerialNumber string    `json:"serialNumber"`
+	Timestamp    time.Time `json:"timestamp"`
+	// Format is the encoding of the image, jpeg, png or pnm
+	Format string `json:"format"`
+	// ExposureTime is the exposure time of the camera in microseconds, 0 if it is unknown
+	ExposureTime float64 `json:"exposureTime,omitempty"`
+}
+
+// Image is an image grabbed by a camera
+type Image struct {
+	Data []byte
+	Metadata
+}
+
+// FileName get the name of the image file, made of the serial number and the timestamp of the image
+func (image *Image) FileName() string {
+	return fmt.Sprintf("%s_%s.%s", image.SerialNumber, image.Timestamp.UTC().Format("20060102T150405.000000000Z"),
+		image.Format)
+}
+
+// ContentType get the media type of the image
+func (image *Image) ContentType() string {
+	switch image.Format {
+	case "jpeg":
+		return "image/jpeg"
+	case "png":
+		return "image/png"
+	case "pnm":
+		return "image/x-portable-anymap"
+	}
+	return "application/octet-stream"
+}
+
+// Sink stores or sends images
+type Sink interface {
+	Send(ctx context.Context, image *Image) error
+	Close() error
+}
+
+// Config is the configuration of a sink in the device instance, only the fields of its type are used
+type Config struct {
+	// Name identifies the sink in the metrics, its type by default
+	Name  string      `json:"name,omitempty"`
+	Type  string      `json:"type"`
+	Retry RetryConfig `json:"retry,omitempty"`
+
+	HTTP      *HTTPConfig      `json:"http,omitempty"`
+	Directory *DirectoryConfig `json:"directory,omitempty"`
+	MQTT      *MQTTConfig      `json:"mqtt,omitempty"`
+}
+
+// RetryConfig is how failed uploads are retried, with a backoff doubled after each attempt
+type RetryConfig struct {
+	// MaxAttempts is the number of attempts to upload an image, 3 by default
+	MaxAttempts int `json:"maxAttempts,omitempty"`
+	// InitialBackoff is the time to wait before the first retry in milliseconds, 1000 by default
+	InitialBackoff int `json:"initialBackoff,omitempty"`
+	// MaxBackoff is the longest time to wait between two attempts in milliseconds, 30000 by default
+	MaxBackoff int `json:"maxBackoff,omitempty"`
+}
+
+func (c RetryConfig) withDefaults() RetryConfig {
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = defaultMaxAttempts
+	}
+	if c.InitialBackoff <= 0 {
+		c.InitialBackoff = defaultInitialBackoff
+	}
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = defaultMaxBackoff
+	}
+	return c
+}
+
+// New create the sink of a configuration
+func New(config Config) (Sink, error) {
+	switch config.Type {
+	case TypeHTTP:
+		if config.HTTP == nil {
+			return nil, errors.New("the http configuration of the sink is missing")
+		}
+		return NewHTTP(*config.HTTP)
+	case TypeDirectory:
+		if config.Directory == nil {
+			return nil, errors.New("the directory configuration of the sink is missing")
+		}
+		return NewDirectory(*config.Directory)
+	case TypeMQTT:
+		if config.MQTT == nil {
+			return nil, errors.New("the mqtt configuration of the sink is missing")
+		}
+		return NewMQTT(*config.MQTT)
+	}
+	return nil, fmt.Errorf("sink type %q is not supported", config.Type)
+}
+
+// permanentError is the error of an upload which fails again if it is retried
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Metrics counts the uploads of a sink
+type Metrics struct {
+	Sink string `json:"sink"`
+	Type string `json:"type"`
+	// Successes is the number of images uploaded
+	Successes uint64 `json:"successes"`
+	// Failures is the number of images which were not uploaded after all the attempts
+	Failures uint64 `json:"failures"`
+	// Retries is the number of attempts after the first ones
+	Retries uint64 `json:"retries"`
+	// Bytes is the size of the images uploaded
+	Bytes       uint64    `json:"bytes"`
+	LastSuccess time.Time `json:"lastSuccess,omitempty"`
+	LastError   string    `json:"lastError,omitempty"`
+}
+
+// namedSink is a sink of an Uploader
+type namedSink struct {
+	name    string
+	kind    string
+	sink    Sink
+	retry   RetryConfig
+	mutex   sync.Mutex
+	metrics Metrics
+	// uploads is the number of uploads sending to the sink and removed tells that the sink was replaced
+	// or the uploader closed, the sink is closed once both are true. They are guarded by the mutex of the
+	// Uploader.
+	uploads int
+	removed bool
+}
+
+func (s *namedSink) close() {
+	if err := s.sink.Close(); err != nil {
+		klog.Warningf("Failed to close image sink %s: %v", s.name, err)
+	}
+}
+
+// Uploader uploads images to sinks. It is safe for concurrent use.
+type Uploader struct {
+	mutex sync.Mutex
+	sinks []*namedSink
+	// sleep waits between two attempts, it is replaced in tests
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// NewUploader create the sinks of configurations
+func NewUploader(configs []Config) (*Uploader, error) {
+	u := &Uploader{sleep: sleep}
+	if err := u.Open(configs); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// Open create the sinks of configurations, e.g. when a device starts again after the uploader was
+// closed. All the sinks are closed if one of them can not be created.
+func (u *Uploader) Open(configs []Config) error {
+	for _, config := range configs {
+		s, err := New(config)
+		if err != nil {
+			u.Close()
+			return fmt.Errorf("image sink %s: %v", config.Name, err)
+		}
+		u.Set(config.Name, config.Type, s, config.Retry)
+	}
+	return nil
+}
+
+// Set add a sink, replacing the sink with the same name, which is closed once its uploads are done.
+// The name is the type if it is empty.
+func (u *Uploader) Set(name string, kind string, s Sink, retry RetryConfig) {
+	if name == "" {
+		name = kind
+	}
+	ns := &namedSink{name: name, kind: kind, sink: s, retry: retry.withDefaults(),
+		metrics: Metrics{Sink: name, Type: kind}}
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	for i, old := range u.sinks {
+		if old.name == name {
+			u.remove(old)
+			u.sinks[i] = ns
+			return
+		}
+	}
+	u.sinks = append(u.sinks, ns)
+}
+
+// Len get the number of sinks
+func (u *Uploader) Len() int {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	return len(u.sinks)
+}
+
+// Upload upload an image to all the sinks at the same time, retrying the failed uploads, and get the
+// errors of the sinks which failed
+func (u *Uploader) Upload(ctx context.Context, image *Image) error {
+	u.mutex.Lock()
+	sinks := append([]*namedSink(nil), u.sinks...)
+	for _, s := range sinks {
+		s.uploads++
+	}
+	u.mutex.Unlock()
+	if len(sinks) == 0 {
+		return errors.New("no image sink is configured")
+	}
+
+	errs := make([]error, len(sinks))
+	var wg sync.WaitGroup
+	for i, s := range sinks {
+		wg.Add(1)
+		go func(i int, s *namedSink) {
+			defer wg.Done()
+			defer u.release(s)
+			errs[i] = u.send(ctx, s, image)
+		}(i, s)
+	}
+	wg.Wait()
+
+	var failed []string
+	for i, err := range errs {
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", sinks[i].name, err))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to upload image %s to %v", image.FileName(), failed)
+	}
+	return nil
+}
+
+// remove a sink from the uploader, closing it if no upload sends to it. The caller holds the mutex.
+func (u *Uploader) remove(s *namedSink) {
+	s.removed = true
+	if s.uploads == 0 {
+		s.close()
+	}
+}
+
+// release a sink after an upload, closing it if it was removed and it was the last upload
+func (u *Uploader) release(s *namedSink) {
+	u.mutex.Lock()
+	s.uploads--
+	closing := s.removed && s.uploads == 0
+	u.mutex.Unlock()
+	if closing {
+		s.close()
+	}
+}
+
+// send an image to a sink, retrying with backoff until it succeeds, fails permanently or the attempts
+// are exhausted
+func (u *Uploader) send(ctx context.Context, s *namedSink, image *Image) error {
+	backoff := time.Duration(s.retry.InitialBackoff) * time.Millisecond
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = s.sink.Send(ctx, image); err == nil {
+			s.mutex.Lock()
+			s.metrics.Successes++
+			s.metrics.Bytes += uint64(len(image.Data))
+			s.metrics.LastSuccess = time.Now()
+			s.mutex.Unlock()
+			return nil
+		}
+		var permanent *permanentError
+		if errors.As(err, &permanent) || attempt >= s.retry.MaxAttempts || ctx.Err() != nil {
+			break
+		}
+		klog.V(2).Infof("Failed to upload image %s to sink %s, attempt %d: %v", image.FileName(), s.name, attempt, err)
+		if sleepErr := u.sleep(ctx, backoff); sleepErr != nil {
+			break
+		}
+		backoff *= 2
+		if max := time.Duration(s.retry.MaxBackoff) * time.Millisecond; backoff > max {
+			backoff = max
+		}
+		s.mutex.Lock()
+		s.metrics.Retries++
+		s.mutex.Unlock()
+	}
+	s.mutex.Lock()
+	s.metrics.Failures++
+	s.metrics.LastError = err.Error()
+	s.mutex.Unlock()
+	return err
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Metrics get the metrics of the sinks
+func (u *Uploader) Metrics() []Metrics {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	metrics := make([]Metrics, 0, len(u.sinks))
+	for _, s := range u.sinks {
+		s.mutex.Lock()
+		metrics = append(metrics, s.metrics)
+		s.mutex.Unlock()
+	}
+	return metrics
+}
+
+// Close remove all the sinks, each one is closed once its uploads are done
+func (u *Uploader) Close() {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	for _, s := range u.sinks {
+		u.remove(s)
+	}
+	u.sinks = nil
+}
@@ -0,0 +1,179 @@
+package imagesink
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSink fails the first failures images it is sent
+type fakeSink struct {
+	failures int
+	err      error
+	sent     int
+	closed   bool
+}
+
+func (s *fakeSink) Send(context.Context, *Image) error {
+	s.sent++
+	if s.sent <= s.failures {
+		return s.err
+	}
+	return nil
+}
+
+func (s *fakeSink) Close() error {
+	s.closed = true
+	return nil
+}
+
+func testImage() *Image {
+	return &Image{
+		Data: []byte{0xFF, 0xD8, 0xFF, 0xD9},
+		Metadata: Metadata{
+			SerialNumber: "SN0001",
+			Timestamp:    time.Date(2022, 3, 4, 5, 6, 7, 8000, time.UTC),
+			Format:       "jpeg",
+			ExposureTime: 5000,
+		},
+	}
+}
+
+func TestUploaderRetry(t *testing.T) {
+	u, err := NewUploader(nil)
+	require.NoError(t, err)
+	var mutex sync.Mutex
+	var backoffs []time.Duration
+	u.sleep = func(_ context.Context, d time.Duration) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		backoffs = append(backoffs, d)
+		return nil
+	}
+	flaky := &fakeSink{failures: 2, err: errors.New("connection refused")}
+	broken := &fakeSink{failures: 10, err: errors.New("connection refused")}
+	rejected := &fakeSink{failures: 10, err: &permanentError{err: errors.New("401 Unauthorized")}}
+	u.Set("flaky", TypeHTTP, flaky, RetryConfig{MaxAttempts: 3, InitialBackoff: 100, MaxBackoff: 150})
+	u.Set("", TypeMQTT, broken, RetryConfig{MaxAttempts: 2})
+	u.Set("rejected", TypeHTTP, rejected, RetryConfig{})
+
+	err = u.Upload(context.Background(), testImage())
+	assert.Error(t, err)
+	assert.Equal(t, 3, flaky.sent)
+	assert.Equal(t, 2, broken.sent)
+	assert.Equal(t, 1, rejected.sent, "permanent errors are not retried")
+	assert.Contains(t, backoffs, 100*time.Millisecond)
+	assert.Contains(t, backoffs, 150*time.Millisecond, "the backoff is limited")
+
+	metrics := u.Metrics()
+	require.Len(t, metrics, 3)
+	assert.Equal(t, Metrics{Sink: "flaky", Type: TypeHTTP, Successes: 1, Retries: 2, Bytes: 4,
+		LastSuccess: metrics[0].LastSuccess}, metrics[0])
+	assert.False(t, metrics[0].LastSuccess.IsZero())
+	assert.Equal(t, Metrics{Sink: TypeMQTT, Type: TypeMQTT, Failures: 1, Retries: 1, LastError: "connection refused"}, metrics[1])
+	assert.Equal(t, uint64(1), metrics[2].Failures)
+	assert.Equal(t, uint64(0), metrics[2].Retries)
+
+	// a sink with the same name replaces the previous one
+	replacement := &fakeSink{}
+	u.Set("flaky", TypeHTTP, replacement, RetryConfig{})
+	assert.True(t, flaky.closed)
+	assert.Equal(t, 3, u.Len())
+	u.Close()
+	assert.True(t, replacement.closed)
+	assert.True(t, broken.closed)
+	assert.Error(t, u.Upload(context.Background(), testImage()), "no sink")
+}
+
+// blockingSink sends images once it is released
+type blockingSink struct {
+	sending chan struct{}
+	release chan struct{}
+	mutex   sync.Mutex
+	closed  bool
+}
+
+func (s *blockingSink) Send(context.Context, *Image) error {
+	s.sending <- struct{}{}
+	<-s.release
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return errors.New("sink is closed")
+	}
+	return nil
+}
+
+func (s *blockingSink) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.closed = true
+	return nil
+}
+
+func (s *blockingSink) isClosed() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.closed
+}
+
+func TestUploaderClosesSinkAfterUploads(t *testing.T) {
+	u, err := NewUploader(nil)
+	require.NoError(t, err)
+	for _, remove := range map[string]func(){
+		"replaced": func() { u.Set("server", TypeHTTP, &fakeSink{}, RetryConfig{}) },
+		"closed":   u.Close,
+	} {
+		busy := &blockingSink{sending: make(chan struct{}), release: make(chan struct{})}
+		u.Set("server", TypeHTTP, busy, RetryConfig{MaxAttempts: 1})
+		done := make(chan error)
+		go func() { done <- u.Upload(context.Background(), testImage()) }()
+		<-busy.sending
+		remove()
+		assert.False(t, busy.isClosed(), "a sink is closed while it uploads")
+		close(busy.release)
+		assert.NoError(t, <-done)
+		assert.True(t, busy.isClosed(), "the sink is not closed after its upload")
+	}
+}
+
+func TestUploaderCanceled(t *testing.T) {
+	u, err := NewUploader(nil)
+	require.NoError(t, err)
+	broken := &fakeSink{failures: 10, err: errors.New("connection refused")}
+	u.Set("broken", TypeHTTP, broken, RetryConfig{MaxAttempts: 5, InitialBackoff: 60000})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Error(t, u.Upload(ctx, testImage()))
+	assert.Equal(t, 1, broken.sent)
+}
+
+func TestNewUploader(t *testing.T) {
+	for _, config := range []Config{
+		{Type: "ftp"},
+		{Type: TypeHTTP},
+		{Type: TypeHTTP, HTTP: &HTTPConfig{URL: "ftp://example.com/images"}},
+		{Type: TypeHTTP, HTTP: &HTTPConfig{URL: "http://example.com/images", Encoding: "json"}},
+		{Type: TypeDirectory, Directory: &DirectoryConfig{}},
+		{Type: TypeMQTT, MQTT: &MQTTConfig{Broker: "tcp://127.0.0.1:1883"}},
+		{Type: TypeMQTT, MQTT: &MQTTConfig{Broker: "tcp://127.0.0.1:1883", Topic: "images", QoS: 3}},
+	} {
+		_, err := NewUploader([]Config{config})
+		assert.Error(t, err, "%+v", config)
+	}
+
+	u, err := NewUploader([]Config{
+		{Type: TypeDirectory, Directory: &DirectoryConfig{Path: t.TempDir()}},
+		{Name: "server", Type: TypeHTTP, HTTP: &HTTPConfig{URL: "http://example.com/images"}},
+	})
+	require.NoError(t, err)
+	metrics := u.Metrics()
+	require.Len(t, metrics, 2)
+	assert.Equal(t, TypeDirectory, metrics[0].Sink)
+	assert.Equal(t, "server", metrics[1].Sink)
+}
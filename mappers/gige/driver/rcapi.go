@@ -0,0 +1,205 @@
+//go:build cgo
+// +build cgo
+
+package driver
+
+/*
+#include <dlfcn.h>
+#include <stdlib.h>
+int open_device(unsigned int** device, char* deviceSN, char** error)
+{
+    void* handle;
+    int result = -1;
+    typedef int (*FPTR)(unsigned int**, char*, char**);
+    handle = dlopen("../bin/librcapi.so", 1);
+    if(handle == NULL){
+        *error = (char *)dlerror();
+        return result;
+    }
+    FPTR fptr = (FPTR)dlsym(handle, "open_device");
+    if(fptr == NULL){
+        *error = (char *)dlerror();
+        result = -2;
+    } else {
+        result = (*fptr)(device, deviceSN, error);
+    }
+    dlclose(handle);
+    return result;
+}
+int set_value (unsigned int* device, char* feature, char* value, char** error)
+{
+    void* handle;
+    int result = -1;
+    typedef int (*FPTR)(unsigned int*, char*, char*, char**);
+    handle = dlopen("../bin/librcapi.so", 1);
+    if(handle == NULL){
+        *error = (char *)dlerror();
+        return result;
+    }
+    FPTR fptr = (FPTR)dlsym(handle, "set_value");
+    if(fptr == NULL){
+        *error = (char *)dlerror();
+        result = -2;
+    } else {
+        result = (*fptr)(device, feature, value, error);
+    }
+    dlclose(handle);
+    return result;
+}
+int get_value (unsigned int* device, char* feature, char** value, char** error)
+{
+    void* handle;
+    int result = -1;
+    typedef int (*FPTR)(unsigned int*, char*, char**, char**);
+	handle = dlopen("../bin/librcapi.so", 1);
+    if(handle == NULL){
+        *error = (char *)dlerror();
+        return result;
+    }
+    FPTR fptr = (FPTR)dlsym(handle, "get_value");
+    if(fptr == NULL){
+        *error = (char *)dlerror();
+        result = -2;
+    } else {
+        result = (*fptr)(device, feature, value, error);
+    }
+    dlclose(handle);
+    return result;
+}
+int get_image (unsigned int* device, char* type, char** bufferPointer, int* size, char** error)
+{
+    void* handle;
+    int result = -1;
+    typedef int (*FPTR)(unsigned int*, char*, char**, int*, char**);
+    handle = dlopen("../bin/librcapi.so", 1);
+    if(handle == NULL){
+        *error = (char *)dlerror();
+        return result;
+    }
+    FPTR fptr = (FPTR)dlsym(handle, "get_image");
+    if(fptr == NULL){
+        *error = (char *)dlerror();
+        result = -2;
+    } else {
+        result = (*fptr)(device, type, bufferPointer, size, error);
+    }
+    dlclose(handle);
+    return result;
+}
+int close_device (unsigned int* device)
+{
+    void* handle;
+    typedef void (*FPTR)(unsigned int*);
+    handle = dlopen("../bin/librcapi.so", 1);
+    if(handle == NULL){
+        return -1;
+    }
+    FPTR fptr = (FPTR)dlsym(handle, "close_device");
+    if(fptr == NULL){
+	dlclose(handle);
+        return -2;
+    } else {
+        (*fptr)(device);
+    }
+    dlclose(handle);
+    return 0;
+}
+int free_image (char** bufferPointer)
+{
+    void* handle;
+    typedef void (*FPTR)(char** bufferPointer);
+    handle = dlopen("../bin/librcapi.so", 1);
+    if(handle == NULL){
+        return -1;
+    }
+    FPTR fptr = (FPTR)dlsym(handle, "free_image");
+    if(fptr == NULL){
+	dlclose(handle);
+        return -2;
+    } else {
+        (*fptr)(bufferPointer);
+    }
+    dlclose(handle);
+    return 0;
+}
+#cgo LDFLAGS: -ldl
+*/
+import "C"
+import (
+	"errors"
+	"fmt"
+	"unsafe"
+)
+
+const rcapiBackend = "rcapi"
+
+func init() {
+	backends[rcapiBackend] = openRCAPICamera
+	defaultBackend = rcapiBackend
+}
+
+// rcapiCamera is a camera accessed with the rc_genicam_api library loaded from ../bin/librcapi.so
+type rcapiCamera struct {
+	dev *C.uint
+}
+
+func openRCAPICamera(config CommonCustomizedValues) (camera, error) {
+	var msg *C.char
+	var dev *C.uint
+	deviceSN := C.CString(config.DeviceSN)
+	defer C.free(unsafe.Pointer(deviceSN))
+	if signal := C.open_device(&dev, deviceSN, &msg); signal != 0 {
+		return nil, errors.New(C.GoString(msg))
+	}
+	return &rcapiCamera{dev: dev}, nil
+}
+
+// rcapiError get the error of a call to the library, the camera is disconnected if signal is greater
+// than maxSignal
+func rcapiError(signal C.int, msg *C.char, maxSignal C.int) error {
+	err := errors.New(C.GoString(msg))
+	if signal > maxSignal {
+		return fmt.Errorf("%w: %v", errDisconnected, err)
+	}
+	return err
+}
+
+func (c *rcapiCamera) get(feature string) (string, error) {
+	var msg *C.char
+	var value *C.char
+	name := C.CString(feature)
+	defer C.free(unsafe.Pointer(name))
+	if signal := C.get_value(c.dev, name, &value, &msg); signal != 0 {
+		return "", rcapiError(signal, msg, 1)
+	}
+	defer C.free(unsafe.Pointer(value))
+	return C.GoString(value), nil
+}
+
+func (c *rcapiCamera) set(feature string, value string) error {
+	var msg *C.char
+	name, cValue := C.CString(feature), C.CString(value)
+	defer C.free(unsafe.Pointer(name))
+	defer C.free(unsafe.Pointer(cValue))
+	if signal := C.set_value(c.dev, name, cValue, &msg); signal != 0 {
+		return rcapiError(signal, msg, 1)
+	}
+	return nil
+}
+
+func (c *rcapiCamera) image(format string) ([]byte, error) {
+	var buffer *C.char
+	var size C.int
+	var msg *C.char
+	cFormat := C.CString(format)
+	defer C.free(unsafe.Pointer(cFormat))
+	if signal := C.get_image(c.dev, cFormat, &buffer, &size, &msg); signal != 0 {
+		return nil, rcapiError(signal, msg, 3)
+	}
+	defer C.free_image(&buffer)
+	return C.GoBytes(unsafe.Pointer(buffer), size), nil
+}
+
+func (c *rcapiCamera) close() {
+	C.close_device(c.dev)
+}
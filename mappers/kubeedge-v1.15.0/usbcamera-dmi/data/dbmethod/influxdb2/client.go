@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"sort"
 	"strings"
 	"time"
 
@@ -12,11 +13,14 @@ import (
 
 	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
 	"github.com/kubeedge/usb/pkg/common"
+	"github.com/kubeedge/usb/pkg/global"
 )
 
 type DataBaseConfig struct {
 	Influxdb2ClientConfig *Influxdb2ClientConfig `json:"influxdb2ClientConfig,omitempty"`
 	Influxdb2DataConfig   *Influxdb2DataConfig   `json:"influxdb2DataConfig,omitempty"`
+
+	client influxdb2.Client
 }
 
 type Influxdb2ClientConfig struct {
@@ -49,20 +53,23 @@ func NewDataBaseClient(clientConfig json.RawMessage, dataConfig json.RawMessage)
 	}, nil
 }
 
-func (d *DataBaseConfig) InitDbClient() influxdb2.Client {
+func (d *DataBaseConfig) InitDbClient() error {
 	var usrtoken string
 	usrtoken = os.Getenv("TOKEN")
-	client := influxdb2.NewClient(d.Influxdb2ClientConfig.Url, usrtoken)
+	d.client = influxdb2.NewClient(d.Influxdb2ClientConfig.Url, usrtoken)
 
-	return client
+	return nil
 }
 
-func (d *DataBaseConfig) CloseSession(client influxdb2.Client) {
-	client.Close()
+func (d *DataBaseConfig) CloseSession() {
+	if d.client != nil {
+		d.client.Close()
+	}
 }
 
-func (d *DataBaseConfig) AddData(data *common.DataModel, client influxdb2.Client) error {
+func (d *DataBaseConfig) AddData(data *common.DataModel) error {
 	// write device data to influx database
+	client := d.client
 	orgName := d.Influxdb2ClientConfig.Org
 	bucketName := d.Influxdb2ClientConfig.Bucket
 	ctx := context.Background()
@@ -113,3 +120,190 @@ func (d *DataBaseConfig) AddData(data *common.DataModel, client influxdb2.Client
 	}
 	return nil
 }
+
+// GetDataByDeviceName get all the data of the property, the client only reads the data it saves
+func (d *DataBaseConfig) GetDataByDeviceName(deviceName string) ([]*common.DataModel, error) {
+	return d.query(time.Unix(0, 0), time.Now())
+}
+
+// GetPropertyDataByDeviceName get all the data of the property, the client only reads the data it saves
+func (d *DataBaseConfig) GetPropertyDataByDeviceName(deviceName string, propertyData string) ([]*common.DataModel, error) {
+	return d.query(time.Unix(0, 0), time.Now())
+}
+
+// GetDataByTimeRange get the data of the property between start and end, in milliseconds, oldest first
+func (d *DataBaseConfig) GetDataByTimeRange(start int64, end int64) ([]*common.DataModel, error) {
+	return d.query(milliseconds(start), milliseconds(end+1))
+}
+
+// QueryData get the data of the query, limited and aggregated by the database, and the number of data
+// the query matches in total
+func (d *DataBaseConfig) QueryData(query *global.HistoryQuery) ([]*common.DataModel, int, error) {
+	flux := d.historyQuery(milliseconds(query.Start), milliseconds(query.End+1), query.Aggregate, query.Interval)
+	total, err := d.count(flux)
+	if err != nil {
+		return nil, 0, err
+	}
+	data, err := d.read(fmt.Sprintf("%s\n  |> limit(n: %d)", flux, query.Limit))
+	if err != nil {
+		return nil, 0, err
+	}
+	if query.Aggregate != "" {
+		for _, item := range data {
+			item.Type = "float"
+		}
+	}
+	return data, total, nil
+}
+
+// DeleteDataByTimeRange delete the data of the property between start and end, in milliseconds,
+// and return the deleted data. A delete predicate can not select a field, so the data of the property
+// is only deleted if no other field is saved with its measurement and tags in the time range.
+func (d *DataBaseConfig) DeleteDataByTimeRange(start int64, end int64) ([]*common.DataModel, error) {
+	// the data saved while deleting is neither returned nor deleted
+	stop := milliseconds(end + 1)
+	if now := time.Now(); stop.After(now) {
+		stop = now
+	}
+	others, err := d.count(d.fluxFilter(milliseconds(start), stop, "!="))
+	if err != nil {
+		return nil, err
+	}
+	if others > 0 {
+		return nil, fmt.Errorf("%d data of other fields are saved with the measurement and tags of the field %s, "+
+			"save the property with its own measurement or tag to delete its data", others, d.Influxdb2DataConfig.FieldKey)
+	}
+	data, err := d.query(milliseconds(start), stop)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return data, nil
+	}
+	// the stop of a delete is inclusive
+	err = d.client.DeleteAPI().DeleteWithName(context.Background(), d.Influxdb2ClientConfig.Org, d.Influxdb2ClientConfig.Bucket,
+		milliseconds(start), stop.Add(-time.Nanosecond), d.deletePredicate())
+	if err != nil {
+		return nil, fmt.Errorf("delete data faild with err:%v", err)
+	}
+	return data, nil
+}
+
+func (d *DataBaseConfig) query(start, stop time.Time) ([]*common.DataModel, error) {
+	return d.read(d.fluxQuery(start, stop))
+}
+
+// count get the number of data of a flux query
+func (d *DataBaseConfig) count(flux string) (int, error) {
+	result, err := d.client.QueryAPI(d.Influxdb2ClientConfig.Org).Query(context.Background(), flux+"\n  |> group()\n  |> count()")
+	if err != nil {
+		return 0, fmt.Errorf("count data faild with err:%v", err)
+	}
+	defer result.Close()
+	total := 0
+	for result.Next() {
+		if n, ok := result.Record().Value().(int64); ok {
+			total += int(n)
+		}
+	}
+	if result.Err() != nil {
+		return 0, fmt.Errorf("count data faild with err:%v", result.Err())
+	}
+	return total, nil
+}
+
+func (d *DataBaseConfig) read(flux string) ([]*common.DataModel, error) {
+	result, err := d.client.QueryAPI(d.Influxdb2ClientConfig.Org).Query(context.Background(), flux)
+	if err != nil {
+		return nil, fmt.Errorf("query data faild with err:%v", err)
+	}
+	defer result.Close()
+	var data []*common.DataModel
+	for result.Next() {
+		record := result.Record()
+		value, err := common.ConvertToString(record.Value())
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, common.NewDataModel("", record.Field(),
+			common.WithValue(value),
+			common.WithTimeStamp(record.Time().UnixNano()/1e6)))
+	}
+	if result.Err() != nil {
+		return nil, fmt.Errorf("query data faild with err:%v", result.Err())
+	}
+	return data, nil
+}
+
+// fluxQuery builds the query of the data of the measurement, tags and field in [start, stop), oldest first
+func (d *DataBaseConfig) fluxQuery(start, stop time.Time) string {
+	return d.fluxFilter(start, stop, "==") + "\n  |> group()\n  |> sort(columns: [\"_time\"])"
+}
+
+// historyQuery builds the query of fluxQuery, with the numeric values aggregated in each interval of
+// milliseconds like the history API, timestamped with the start of the interval
+func (d *DataBaseConfig) historyQuery(start, stop time.Time, aggregate string, interval int64) string {
+	query := d.fluxQuery(start, stop)
+	if aggregate == "" {
+		return query
+	}
+	fn := map[string]string{"avg": "mean", "min": "min", "max": "max"}[aggregate]
+	return query + "\n  |> toString()" +
+		"\n  |> filter(fn: (r) => r._value =~ " + numberPattern + ")" +
+		"\n  |> toFloat()" +
+		fmt.Sprintf("\n  |> aggregateWindow(every: %dms, fn: %s, timeSrc: \"_start\", createEmpty: false)", interval, fn)
+}
+
+// numberPattern matches the values saved as strings that are numbers
+const numberPattern = `/^[-+]?([0-9]+\.?[0-9]*|\.[0-9]+)([eE][-+]?[0-9]+)?$/`
+
+// fluxFilter builds the query of the data of the measurement and tags in [start, stop) whose field compares
+// with op to the field key
+func (d *DataBaseConfig) fluxFilter(start, stop time.Time, op string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "from(bucket: %s)\n", fluxString(d.Influxdb2ClientConfig.Bucket))
+	fmt.Fprintf(&b, "  |> range(start: %s, stop: %s)\n", start.UTC().Format(time.RFC3339Nano), stop.UTC().Format(time.RFC3339Nano))
+	fmt.Fprintf(&b, "  |> filter(fn: (r) => r._measurement == %s and r._field %s %s",
+		fluxString(d.Influxdb2DataConfig.Measurement), op, fluxString(d.Influxdb2DataConfig.FieldKey))
+	for _, key := range d.tagKeys() {
+		fmt.Fprintf(&b, " and r[%s] == %s", fluxString(key), fluxString(d.Influxdb2DataConfig.Tag[key]))
+	}
+	b.WriteString(")")
+	return b.String()
+}
+
+// deletePredicate selects the measurement and tags of the data
+func (d *DataBaseConfig) deletePredicate() string {
+	predicate := []string{"_measurement=" + predicateString(d.Influxdb2DataConfig.Measurement)}
+	for _, key := range d.tagKeys() {
+		predicate = append(predicate, key+"="+predicateString(d.Influxdb2DataConfig.Tag[key]))
+	}
+	return strings.Join(predicate, " AND ")
+}
+
+func (d *DataBaseConfig) tagKeys() []string {
+	keys := make([]string, 0, len(d.Influxdb2DataConfig.Tag))
+	for key := range d.Influxdb2DataConfig.Tag {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func milliseconds(ms int64) time.Time {
+	return time.Unix(0, ms*int64(time.Millisecond))
+}
+
+var (
+	fluxEscaper      = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`)
+	predicateEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+)
+
+// fluxString quotes s as a Flux string literal, which must not interpolate ${}
+func fluxString(s string) string {
+	return `"` + fluxEscaper.Replace(s) + `"`
+}
+
+func predicateString(s string) string {
+	return `"` + predicateEscaper.Replace(s) + `"`
+}
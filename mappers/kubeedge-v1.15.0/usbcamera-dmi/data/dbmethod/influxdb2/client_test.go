@@ -0,0 +1,49 @@
+package influxdb2
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFluxQuery(t *testing.T) {
+	d := &DataBaseConfig{
+		Influxdb2ClientConfig: &Influxdb2ClientConfig{Bucket: "usb"},
+		Influxdb2DataConfig: &Influxdb2DataConfig{
+			Measurement: `camera"1`,
+			Tag:         map[string]string{"location": "${bucket}", "device": "camera"},
+			FieldKey:    "brightness",
+		},
+	}
+	want := `from(bucket: "usb")
+  |> range(start: 1970-01-01T00:00:01Z, stop: 1970-01-01T00:00:02.5Z)
+  |> filter(fn: (r) => r._measurement == "camera\"1" and r._field == "brightness" and r["device"] == "camera" and r["location"] == "\${bucket}")
+  |> group()
+  |> sort(columns: ["_time"])`
+	if got := d.fluxQuery(milliseconds(1000), milliseconds(2500)); got != want {
+		t.Errorf("fluxQuery() =\n%s\nwant\n%s", got, want)
+	}
+	if got := d.historyQuery(milliseconds(1000), milliseconds(2500), "", 0); got != want {
+		t.Errorf("historyQuery() without aggregate =\n%s\nwant\n%s", got, want)
+	}
+	aggregated := want + `
+  |> toString()
+  |> filter(fn: (r) => r._value =~ /^[-+]?([0-9]+\.?[0-9]*|\.[0-9]+)([eE][-+]?[0-9]+)?$/)
+  |> toFloat()
+  |> aggregateWindow(every: 2000ms, fn: mean, timeSrc: "_start", createEmpty: false)`
+	if got := d.historyQuery(milliseconds(1000), milliseconds(2500), "avg", 2000); got != aggregated {
+		t.Errorf("historyQuery() =\n%s\nwant\n%s", got, aggregated)
+	}
+	// the data of other fields that a delete of the property would remove
+	others := `from(bucket: "usb")
+  |> range(start: 1970-01-01T00:00:01Z, stop: 1970-01-01T00:00:02.5Z)
+  |> filter(fn: (r) => r._measurement == "camera\"1" and r._field != "brightness" and r["device"] == "camera" and r["location"] == "\${bucket}")`
+	if got := d.fluxFilter(milliseconds(1000), milliseconds(2500), "!="); got != others {
+		t.Errorf("fluxFilter() =\n%s\nwant\n%s", got, others)
+	}
+	if got := d.deletePredicate(); got != `_measurement="camera\"1" AND device="camera" AND location="${bucket}"` {
+		t.Errorf("deletePredicate() = %s", got)
+	}
+	if got := milliseconds(1500); !got.Equal(time.Unix(1, 5e8)) {
+		t.Errorf("milliseconds(1500) = %v", got)
+	}
+}
@@ -22,7 +22,7 @@ func (d *DataBaseConfig) CloseSession() {
 	panic("implement me")
 }
 
-func (d *DataBaseConfig) AddData(data *common.DataModel) {
+func (d *DataBaseConfig) AddData(data *common.DataModel) error {
 	//TODO implement me
 	panic("implement me")
 }
@@ -28,6 +28,7 @@ type DevPanel struct {
 	devices      map[string]*driver.CustomizedDev
 	models       map[string]common.DeviceModel
 	protocols    map[string]common.ProtocolConfig
+	states       map[string]*StateMachine
 	wg           sync.WaitGroup
 	serviceMutex sync.Mutex
 	quitChan     chan os.Signal
@@ -36,6 +37,8 @@ type DevPanel struct {
 var (
 	devPanel *DevPanel
 	once     sync.Once
+	// newStateReporter creates the reporter of the state transitions of a device
+	newStateReporter = reportDeviceState
 )
 
 // NewDevPanel init and return devPanel
@@ -46,6 +49,7 @@ func NewDevPanel() *DevPanel {
 			devices:      make(map[string]*driver.CustomizedDev),
 			models:       make(map[string]common.DeviceModel),
 			protocols:    make(map[string]common.ProtocolConfig),
+			states:       make(map[string]*StateMachine),
 			wg:           sync.WaitGroup{},
 			serviceMutex: sync.Mutex{},
 			quitChan:     make(chan os.Signal),
@@ -60,8 +64,9 @@ func (d *DevPanel) DevStart() {
 		klog.V(4).Info("Dev: ", id, dev)
 		ctx, cancel := context.WithCancel(context.Background())
 		d.deviceMuxs[id] = cancel
+		d.states[id] = NewStateMachine(id, newStateReporter(dev.Instance.Name))
 		d.wg.Add(1)
-		go d.start(ctx, dev)
+		go d.start(ctx, dev, d.states[id])
 	}
 	signal.Notify(d.quitChan, os.Interrupt)
 	go func() {
@@ -79,31 +84,60 @@ func (d *DevPanel) DevStart() {
 }
 
 // start the device
-func (d *DevPanel) start(ctx context.Context, dev *driver.CustomizedDev) {
+func (d *DevPanel) start(ctx context.Context, dev *driver.CustomizedDev, state *StateMachine) {
 	defer d.wg.Done()
 
 	var protocolConfig driver.ProtocolConfig
 	if err := json.Unmarshal(dev.Instance.PProtocol.ConfigData, &protocolConfig); err != nil {
 		klog.Errorf("Unmarshal ProtocolConfigs error: %v", err)
+		state.DriverError(err)
 		return
 	}
 	client, err := driver.NewClient(protocolConfig)
 	if err != nil {
 		klog.Errorf("Init dev %s error: %v", dev.Instance.Name, err)
+		state.DriverError(err)
 		return
 	}
 	dev.CustomizedClient = client
-	err = dev.CustomizedClient.InitDevice()
-	if err != nil {
-		klog.Errorf("Init device %s error: %v", dev.Instance.ID, err)
+	if !connect(ctx, dev, state) {
 		return
 	}
-	go dataHandler(ctx, dev)
-	<-ctx.Done()
+	go dataHandler(ctx, dev, state)
+	for {
+		select {
+		case <-state.Lost():
+			klog.Warningf("Device %s went offline, reconnecting", dev.Instance.ID)
+			if !connect(ctx, dev, state) {
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// connect initializes the device, retrying with backoff until it succeeds.
+// It returns false if ctx is cancelled first.
+func connect(ctx context.Context, dev *driver.CustomizedDev, state *StateMachine) bool {
+	for attempt := 1; ; attempt++ {
+		err := dev.CustomizedClient.InitDevice()
+		if err == nil {
+			state.Connected()
+			return true
+		}
+		klog.Errorf("Init device %s error: %v", dev.Instance.ID, err)
+		state.ConnectFailed(attempt, err)
+		select {
+		case <-time.After(reconnectBackoff(attempt)):
+		case <-ctx.Done():
+			return false
+		}
+	}
 }
 
 // dataHandler initialize the timer to handle data plane and devicetwin.
-func dataHandler(ctx context.Context, dev *driver.CustomizedDev) {
+func dataHandler(ctx context.Context, dev *driver.CustomizedDev, state *StateMachine) {
 	for _, twin := range dev.Instance.Twins {
 		twin.Property.PProperty.DataType = strings.ToLower(twin.Property.PProperty.DataType)
 		var visitorConfig driver.VisitorConfig
@@ -130,6 +164,7 @@ func dataHandler(ctx context.Context, dev *driver.CustomizedDev) {
 			Topic:           fmt.Sprintf(common.TopicTwinUpdate, dev.Instance.ID),
 			CollectCycle:    time.Duration(twin.Property.CollectCycle),
 			ReportToCloud:   twin.Property.ReportToCloud,
+			State:           state,
 		}
 		go twinData.Run(ctx)
 		// handle push method
@@ -199,53 +234,64 @@ func pushHandler(ctx context.Context, twin *common.Twin, client *driver.Customiz
 
 // dbHandler start db client to save data
 func dbHandler(ctx context.Context, twin *common.Twin, client *driver.CustomizedClient, visitorConfig *driver.VisitorConfig, dataModel *common.DataModel) {
-	switch twin.Property.PushMethod.DBMethod.DBMethodName {
+	dbClient, err := newDataBaseClient(twin)
+	if err != nil {
+		klog.Errorf("new database client error: %v", err)
+		return
+	}
+	err = dbClient.InitDbClient()
+	if err != nil {
+		klog.Errorf("init database client err: %v", err)
+		return
+	}
+	reportCycle := time.Duration(twin.Property.ReportCycle)
+	if reportCycle == 0 {
+		reportCycle = 1 * time.Second
+	}
+	ticker := time.NewTicker(reportCycle)
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				deviceData, err := client.GetDeviceData(visitorConfig)
+				if err != nil {
+					klog.Errorf("publish error: %v", err)
+					continue
+				}
+				sData, err := common.ConvertToString(deviceData)
+				if err != nil {
+					klog.Errorf("Failed to convert publish method data : %v", err)
+					continue
+				}
+				dataModel.SetValue(sData)
+				dataModel.SetTimeStamp()
+
+				err = dbClient.AddData(dataModel)
+				if err != nil {
+					klog.Errorf("%s database add data error: %v", twin.Property.PushMethod.DBMethod.DBMethodName, err)
+					return
+				}
+			case <-ctx.Done():
+				dbClient.CloseSession()
+				return
+			}
+		}
+	}()
+}
+
+// newDataBaseClient get the database client of twin's dbMethod
+func newDataBaseClient(twin *common.Twin) (global.DataBaseClient, error) {
+	dbMethod := twin.Property.PushMethod.DBMethod
+	switch dbMethod.DBMethodName {
 	// TODO add more database
 	case "influx":
-		dbConfig, err := dbInflux.NewDataBaseClient(twin.Property.PushMethod.DBMethod.DBConfig.Influxdb2ClientConfig, twin.Property.PushMethod.DBMethod.DBConfig.Influxdb2DataConfig)
+		dbConfig, err := dbInflux.NewDataBaseClient(dbMethod.DBConfig.Influxdb2ClientConfig, dbMethod.DBConfig.Influxdb2DataConfig)
 		if err != nil {
-			klog.Errorf("new database client error: %v", err)
-			return
-		}
-		dbClient := dbConfig.InitDbClient()
-		if err != nil {
-			klog.Errorf("init database client err: %v", err)
-			return
-		}
-		reportCycle := time.Duration(twin.Property.ReportCycle)
-		if reportCycle == 0 {
-			reportCycle = 1 * time.Second
+			return nil, err
 		}
-		ticker := time.NewTicker(reportCycle)
-		go func() {
-			for {
-				select {
-				case <-ticker.C:
-					deviceData, err := client.GetDeviceData(visitorConfig)
-					if err != nil {
-						klog.Errorf("publish error: %v", err)
-						continue
-					}
-					sData, err := common.ConvertToString(deviceData)
-					if err != nil {
-						klog.Errorf("Failed to convert publish method data : %v", err)
-						continue
-					}
-					dataModel.SetValue(sData)
-					dataModel.SetTimeStamp()
-
-					err = dbConfig.AddData(dataModel, dbClient)
-					if err != nil {
-						klog.Errorf("influx database add data error: %v", err)
-						return
-					}
-				case <-ctx.Done():
-					dbConfig.CloseSession(dbClient)
-					return
-				}
-			}
-		}()
+		return dbConfig, nil
 	}
+	return nil, fmt.Errorf("database %s is not supported", dbMethod.DBMethodName)
 }
 
 // setVisitor check if visitor property is readonly, if not then set it.
@@ -296,6 +342,7 @@ func (d *DevPanel) UpdateDev(model *common.DeviceModel, device *common.DeviceIns
 	defer d.serviceMutex.Unlock()
 
 	if oldDevice, ok := d.devices[device.ID]; ok {
+		d.states[device.ID].Removing("device is being updated")
 		err := d.stopDev(oldDevice, device.ID)
 		if err != nil {
 			klog.Error(err)
@@ -309,8 +356,9 @@ func (d *DevPanel) UpdateDev(model *common.DeviceModel, device *common.DeviceIns
 
 	ctx, cancelFunc := context.WithCancel(context.Background())
 	d.deviceMuxs[device.ID] = cancelFunc
+	d.states[device.ID] = NewStateMachine(device.ID, newStateReporter(device.Name))
 	d.wg.Add(1)
-	go d.start(ctx, d.devices[device.ID])
+	go d.start(ctx, d.devices[device.ID], d.states[device.ID])
 }
 
 // UpdateDevTwins update device's twins
@@ -402,6 +450,8 @@ func (d *DevPanel) RemoveDevice(deviceID string) error {
 	defer d.serviceMutex.Unlock()
 	dev := d.devices[deviceID]
 	delete(d.devices, deviceID)
+	d.states[deviceID].Removing("device is being removed")
+	delete(d.states, deviceID)
 	err := d.stopDev(dev, deviceID)
 	if err != nil {
 		return err
@@ -424,6 +474,48 @@ func (d *DevPanel) stopDev(dev *driver.CustomizedDev, id string) error {
 	return nil
 }
 
+// GetDeviceState get device's lifecycle state and the reason of its last transition
+func (d *DevPanel) GetDeviceState(deviceID string) (string, string, error) {
+	d.serviceMutex.Lock()
+	defer d.serviceMutex.Unlock()
+	state, ok := d.states[deviceID]
+	if !ok {
+		return "", "", fmt.Errorf("not found device %s", deviceID)
+	}
+	current, reason := state.State()
+	return string(current), reason, nil
+}
+
+// GetCapabilities get the capabilities discovered when device's camera was opened
+func (d *DevPanel) GetCapabilities(deviceID string) (interface{}, error) {
+	d.serviceMutex.Lock()
+	found, ok := d.devices[deviceID]
+	d.serviceMutex.Unlock()
+	if !ok || found == nil {
+		return nil, fmt.Errorf("device %s not found", deviceID)
+	}
+	return found.CustomizedClient.Capabilities()
+}
+
+// GetFrame get a frame of device's camera from its capture loop, encoded as JPEG
+func (d *DevPanel) GetFrame(ctx context.Context, deviceID string, after uint64) (*global.Frame, error) {
+	d.serviceMutex.Lock()
+	found, ok := d.devices[deviceID]
+	d.serviceMutex.Unlock()
+	if !ok || found == nil {
+		return nil, fmt.Errorf("device %s not found", deviceID)
+	}
+	frame, err := found.CustomizedClient.NextFrame(ctx, after)
+	if err != nil {
+		return nil, err
+	}
+	data, err := frame.JPEG()
+	if err != nil {
+		return nil, err
+	}
+	return &global.Frame{Data: data, Timestamp: frame.Timestamp, Sequence: frame.Sequence}, nil
+}
+
 // GetModel if the model exists, return device model
 func (d *DevPanel) GetModel(modelName string) (common.DeviceModel, error) {
 	d.serviceMutex.Lock()
@@ -481,3 +573,31 @@ func (d *DevPanel) GetTwinResult(deviceID string, twinName string) (string, stri
 	}
 	return res, dataType, nil
 }
+
+// GetDataBaseClients get initialized database clients of device's properties that are saved to a database
+func (d *DevPanel) GetDataBaseClients(deviceID string) (map[string]global.DataBaseClient, error) {
+	d.serviceMutex.Lock()
+	defer d.serviceMutex.Unlock()
+	dev, ok := d.devices[deviceID]
+	if !ok {
+		return nil, fmt.Errorf("not found device %s", deviceID)
+	}
+	clients := make(map[string]global.DataBaseClient)
+	for _, twin := range dev.Instance.Twins {
+		if twin.Property == nil || twin.Property.PushMethod.DBMethod.DBMethodName == "" {
+			continue
+		}
+		dbClient, err := newDataBaseClient(&twin)
+		if err == nil {
+			err = dbClient.InitDbClient()
+		}
+		if err != nil {
+			for _, c := range clients {
+				c.CloseSession()
+			}
+			return nil, fmt.Errorf("%s database client error: %v", twin.PropertyName, err)
+		}
+		clients[twin.PropertyName] = dbClient
+	}
+	return clients, nil
+}
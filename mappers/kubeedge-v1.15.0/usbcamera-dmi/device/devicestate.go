@@ -0,0 +1,235 @@
+package device
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	dmiapi "github.com/kubeedge/usb/pkg/dmi-api"
+	"github.com/kubeedge/usb/pkg/util/grpcclient"
+)
+
+// DeviceState is the lifecycle state of a device handled by the mapper.
+type DeviceState string
+
+// Device lifecycle states.
+const (
+	StateInitializing DeviceState = "initializing"
+	StateOnline       DeviceState = "online"
+	StateDegraded     DeviceState = "degraded"
+	StateOffline      DeviceState = "offline"
+	StateRemoving     DeviceState = "removing"
+)
+
+// MaxReadFailures is the number of consecutive failed reads after which
+// a degraded device is considered offline and gets reconnected.
+const MaxReadFailures = 3
+
+// StateReporter is called once for every state transition of a device.
+type StateReporter func(state DeviceState, reason string)
+
+// StateTwin is the twin which carries the lifecycle state of a device. The
+// DMI API of edgecore v1.15 has no device state, so the state is reported as
+// the value of this twin and the reason of the transition as its metadata.
+const StateTwin = "deviceState"
+
+// stateQueueSize is the number of transitions of a device waiting to be sent.
+const stateQueueSize = 16
+
+// reportDeviceStatus sends a report to edgecore, it's replaced in tests.
+var reportDeviceStatus = grpcclient.ReportDeviceStatus
+
+// reportDeviceState returns a StateReporter that sends every transition of
+// the device to edgecore. The transitions are sent in order by a goroutine,
+// so that a slow edgecore doesn't block the device, which stops after the
+// removing state is sent.
+func reportDeviceState(name string) StateReporter {
+	queue := make(chan *dmiapi.ReportDeviceStatusRequest, stateQueueSize)
+	go func() {
+		for request := range queue {
+			if err := reportDeviceStatus(request); err != nil {
+				klog.Errorf("fail to report state of device %s with err: %+v", name, err)
+			}
+		}
+	}()
+	return func(state DeviceState, reason string) {
+		property := &dmiapi.TwinProperty{
+			Value: string(state),
+			Metadata: map[string]string{
+				"type":      "string",
+				"timestamp": strconv.FormatInt(time.Now().UnixNano()/1e6, 10),
+				"reason":    reason,
+			},
+		}
+		request := &dmiapi.ReportDeviceStatusRequest{
+			DeviceName: name,
+			ReportedDevice: &dmiapi.DeviceStatus{
+				Twins: []*dmiapi.Twin{{PropertyName: StateTwin, Reported: property, ObservedDesired: property}},
+			},
+		}
+		select {
+		case queue <- request:
+		default:
+			klog.Errorf("fail to report state %s of device %s: too many pending reports", state, name)
+		}
+		if state == StateRemoving {
+			close(queue)
+		}
+	}
+}
+
+// StateMachine tracks the lifecycle of a single device. Drivers and twin
+// collectors feed it with the outcome of their operations and it reports
+// a transition only when the state actually changes.
+type StateMachine struct {
+	mutex    sync.Mutex
+	name     string
+	state    DeviceState
+	reason   string
+	failures int
+	lost     chan struct{}
+	report   StateReporter
+}
+
+// NewStateMachine returns a state machine in the initializing state and
+// reports that state right away.
+func NewStateMachine(name string, report StateReporter) *StateMachine {
+	m := &StateMachine{
+		name:   name,
+		lost:   make(chan struct{}, 1),
+		report: report,
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.transition(StateInitializing, "device is being initialized")
+	return m
+}
+
+// State returns the current state and the reason of the last transition.
+func (m *StateMachine) State() (DeviceState, string) {
+	if m == nil {
+		return StateInitializing, ""
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.state, m.reason
+}
+
+// Lost is signalled when a connected device goes offline and should be
+// reconnected.
+func (m *StateMachine) Lost() <-chan struct{} {
+	return m.lost
+}
+
+// Connected records a successful (re)connection to the device.
+func (m *StateMachine) Connected() {
+	if m == nil {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.failures = 0
+	select {
+	case <-m.lost:
+	default:
+	}
+	m.transition(StateOnline, "device connected")
+}
+
+// ConnectFailed records a failed connection attempt.
+func (m *StateMachine) ConnectFailed(attempt int, err error) {
+	if m == nil {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	klog.V(2).Infof("Connect device %s attempt %d failed: %v", m.name, attempt, err)
+	m.transition(StateOffline, fmt.Sprintf("connect attempt %d failed: %v", attempt, err))
+}
+
+// ReadSucceeded records a successful read and brings a degraded device
+// back online.
+func (m *StateMachine) ReadSucceeded() {
+	if m == nil {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.failures = 0
+	m.transition(StateOnline, "device data read successfully")
+}
+
+// ReadFailed records a failed read. The device is degraded on the first
+// failure and offline after MaxReadFailures consecutive ones.
+func (m *StateMachine) ReadFailed(err error) {
+	if m == nil {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.failures++
+	if m.failures < MaxReadFailures {
+		m.transition(StateDegraded, fmt.Sprintf("read failed: %v", err))
+		return
+	}
+	m.goOffline(fmt.Sprintf("%d consecutive reads failed: %v", m.failures, err))
+}
+
+// DriverError records an error reported by the driver itself, which takes
+// the device offline immediately.
+func (m *StateMachine) DriverError(err error) {
+	if m == nil {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.goOffline(fmt.Sprintf("driver error: %v", err))
+}
+
+// Removing marks the device as being removed. No transition is reported
+// after that.
+func (m *StateMachine) Removing(reason string) {
+	if m == nil {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.transition(StateRemoving, reason)
+}
+
+func (m *StateMachine) goOffline(reason string) {
+	if m.state == StateOffline || m.state == StateRemoving {
+		return
+	}
+	m.transition(StateOffline, reason)
+	select {
+	case m.lost <- struct{}{}:
+	default:
+	}
+}
+
+// transition must be called with the mutex held. The report is sent while
+// holding it so that transitions reach edgecore in order.
+func (m *StateMachine) transition(state DeviceState, reason string) {
+	if m.state == state || m.state == StateRemoving {
+		return
+	}
+	klog.Infof("Device %s state changed from %q to %q: %s", m.name, m.state, state, reason)
+	m.state = state
+	m.reason = reason
+	if m.report != nil {
+		m.report(state, reason)
+	}
+}
+
+// reconnectBackoff returns how long to wait before the given connect attempt.
+func reconnectBackoff(attempt int) time.Duration {
+	backoff := time.Second << uint(attempt-1)
+	if attempt > 6 || backoff > 30*time.Second {
+		return 30 * time.Second
+	}
+	return backoff
+}
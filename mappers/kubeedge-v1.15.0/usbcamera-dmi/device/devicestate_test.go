@@ -0,0 +1,179 @@
+package device
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	dmiapi "github.com/kubeedge/usb/pkg/dmi-api"
+	"github.com/kubeedge/usb/pkg/util/grpcclient"
+)
+
+type transition struct {
+	state  DeviceState
+	reason string
+}
+
+func newRecordedStateMachine() (*StateMachine, *[]transition) {
+	var reported []transition
+	m := NewStateMachine("camera", func(state DeviceState, reason string) {
+		reported = append(reported, transition{state, reason})
+	})
+	return m, &reported
+}
+
+func states(reported []transition) []DeviceState {
+	var res []DeviceState
+	for _, t := range reported {
+		res = append(res, t.state)
+	}
+	return res
+}
+
+func TestStateMachineReportsOncePerTransition(t *testing.T) {
+	m, reported := newRecordedStateMachine()
+	errRead := errors.New("timeout")
+
+	m.Connected()
+	m.ReadSucceeded()
+	m.ReadSucceeded()
+	m.ReadFailed(errRead)
+	m.ReadFailed(errRead)
+	m.ReadSucceeded()
+
+	want := []DeviceState{StateInitializing, StateOnline, StateDegraded, StateOnline}
+	if got := states(*reported); !reflect.DeepEqual(got, want) {
+		t.Fatalf("reported states = %v, want %v", got, want)
+	}
+	if reason := (*reported)[2].reason; reason != "read failed: timeout" {
+		t.Errorf("degraded reason = %q", reason)
+	}
+}
+
+func TestStateMachineOfflineAfterConsecutiveFailures(t *testing.T) {
+	m, reported := newRecordedStateMachine()
+	m.Connected()
+	for i := 0; i < MaxReadFailures+2; i++ {
+		m.ReadFailed(errors.New("no response"))
+	}
+
+	want := []DeviceState{StateInitializing, StateOnline, StateDegraded, StateOffline}
+	if got := states(*reported); !reflect.DeepEqual(got, want) {
+		t.Fatalf("reported states = %v, want %v", got, want)
+	}
+	state, reason := m.State()
+	if state != StateOffline || reason != "3 consecutive reads failed: no response" {
+		t.Errorf("State() = %q, %q", state, reason)
+	}
+	select {
+	case <-m.Lost():
+	default:
+		t.Fatal("Lost() not signalled when the device went offline")
+	}
+
+	m.Connected()
+	if state, _ := m.State(); state != StateOnline {
+		t.Errorf("state after reconnect = %q, want %q", state, StateOnline)
+	}
+	select {
+	case <-m.Lost():
+		t.Fatal("Lost() signalled after reconnect")
+	default:
+	}
+}
+
+func TestStateMachineConnectFailures(t *testing.T) {
+	m, reported := newRecordedStateMachine()
+	m.ConnectFailed(1, errors.New("no such device"))
+	m.ConnectFailed(2, errors.New("no such device"))
+	m.Connected()
+
+	want := []transition{
+		{StateInitializing, "device is being initialized"},
+		{StateOffline, "connect attempt 1 failed: no such device"},
+		{StateOnline, "device connected"},
+	}
+	if !reflect.DeepEqual(*reported, want) {
+		t.Fatalf("reported = %v, want %v", *reported, want)
+	}
+	select {
+	case <-m.Lost():
+		t.Fatal("Lost() signalled for a failed connect attempt")
+	default:
+	}
+}
+
+func TestStateMachineRemovingIsFinal(t *testing.T) {
+	m, reported := newRecordedStateMachine()
+	m.Connected()
+	m.DriverError(errors.New("device unplugged"))
+	m.Removing("device is being removed")
+	m.Connected()
+	m.ReadFailed(errors.New("closed"))
+
+	want := []DeviceState{StateInitializing, StateOnline, StateOffline, StateRemoving}
+	if got := states(*reported); !reflect.DeepEqual(got, want) {
+		t.Fatalf("reported states = %v, want %v", got, want)
+	}
+	if reason := (*reported)[2].reason; reason != "driver error: device unplugged" {
+		t.Errorf("offline reason = %q", reason)
+	}
+}
+
+func TestStateMachineNil(t *testing.T) {
+	var m *StateMachine
+	m.ReadFailed(errors.New("ignored"))
+	m.ReadSucceeded()
+	m.Removing("ignored")
+	if state, _ := m.State(); state != StateInitializing {
+		t.Errorf("nil State() = %q", state)
+	}
+}
+
+func TestReconnectBackoff(t *testing.T) {
+	for attempt, want := range map[int]string{1: "1s", 2: "2s", 5: "16s", 6: "30s", 40: "30s"} {
+		if got := reconnectBackoff(attempt).String(); got != want {
+			t.Errorf("reconnectBackoff(%d) = %s, want %s", attempt, got, want)
+		}
+	}
+}
+
+func TestReportDeviceState(t *testing.T) {
+	sent := make(chan *dmiapi.ReportDeviceStatusRequest, 8)
+	reportDeviceStatus = func(request *dmiapi.ReportDeviceStatusRequest) error {
+		sent <- request
+		return nil
+	}
+	defer func() { reportDeviceStatus = grpcclient.ReportDeviceStatus }()
+
+	m := NewStateMachine("camera-id", reportDeviceState("camera"))
+	m.ConnectFailed(1, errors.New("no such device"))
+	m.Connected()
+	m.Removing("device is being removed")
+
+	want := []transition{
+		{StateInitializing, "device is being initialized"},
+		{StateOffline, "connect attempt 1 failed: no such device"},
+		{StateOnline, "device connected"},
+		{StateRemoving, "device is being removed"},
+	}
+	for _, w := range want {
+		select {
+		case request := <-sent:
+			if request.DeviceName != "camera" {
+				t.Errorf("DeviceName = %q, want camera", request.DeviceName)
+			}
+			twins := request.ReportedDevice.Twins
+			if len(twins) != 1 || twins[0].PropertyName != StateTwin {
+				t.Fatalf("twins = %v, want one %s twin", twins, StateTwin)
+			}
+			reported := twins[0].Reported
+			if reported.Value != string(w.state) || reported.Metadata["reason"] != w.reason {
+				t.Errorf("reported %q (%q), want %q (%q)", reported.Value, reported.Metadata["reason"], w.state, w.reason)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("state %s not reported", w.state)
+		}
+	}
+}
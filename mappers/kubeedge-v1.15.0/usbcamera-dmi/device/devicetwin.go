@@ -27,6 +27,7 @@ type TwinData struct {
 	Results         interface{}
 	CollectCycle    time.Duration
 	ReportToCloud   bool
+	State           *StateMachine
 }
 
 func (td *TwinData) GetPayLoad() ([]byte, error) {
@@ -34,8 +35,10 @@ func (td *TwinData) GetPayLoad() ([]byte, error) {
 	td.VisitorConfig.VisitorConfigData.DataType = strings.ToLower(td.VisitorConfig.VisitorConfigData.DataType)
 	td.Results, err = td.Client.GetDeviceData(td.VisitorConfig)
 	if err != nil {
+		td.State.ReadFailed(err)
 		return nil, fmt.Errorf("get device data failed: %v", err)
 	}
+	td.State.ReadSucceeded()
 	sData, err := common.ConvertToString(td.Results)
 	if err != nil {
 		klog.Errorf("Failed to convert %s %s value as string : %v", td.DeviceName, td.Name, err)
@@ -78,7 +81,6 @@ func (td *TwinData) PushToEdgeCore() {
 		DeviceName: td.DeviceName,
 		ReportedDevice: &dmiapi.DeviceStatus{
 			Twins: twins,
-			//State: "OK",
 		},
 	}
 
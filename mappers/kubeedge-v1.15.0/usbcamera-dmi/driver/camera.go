@@ -0,0 +1,201 @@
+package driver
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/blackjack/webcam"
+	"k8s.io/klog/v2"
+)
+
+// Pixel formats preferred when the configured one is not supported
+const (
+	PixelFormatMJPEG webcam.PixelFormat = 0x47504A4D // MJPG
+	PixelFormatYUYV  webcam.PixelFormat = 0x56595559 // YUYV
+)
+
+// Camera is an opened video device, implemented by *webcam.Webcam with QueryControls
+type Camera interface {
+	GetSupportedFormats() map[webcam.PixelFormat]string
+	GetSupportedFrameSizes(f webcam.PixelFormat) []webcam.FrameSize
+	SetImageFormat(f webcam.PixelFormat, width, height uint32) (webcam.PixelFormat, uint32, uint32, error)
+	SetBufferCount(count uint32) error
+
+	GetControls() map[webcam.ControlID]webcam.Control
+	QueryControls() ([]ControlCapability, error)
+	GetControl(id webcam.ControlID) (int32, error)
+	SetControl(id webcam.ControlID, value int32) error
+	GetFramerate() (float32, error)
+	SetFramerate(fps float32) error
+	GetInput() (int32, error)
+	GetBusInfo() (string, error)
+
+	StartStreaming() error
+	WaitForFrame(timeout uint32) error
+	ReadFrame() ([]byte, error)
+	Close() error
+}
+
+// openCamera opens the video device at path, replaced by tests
+var openCamera = func(path string) (Camera, error) {
+	cam, err := webcam.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &v4l2Camera{Webcam: cam, path: path}, nil
+}
+
+// v4lByIDDir holds the links to the video devices named after their USB vendor, model and serial number,
+// such as usb-046d_HD_Pro_Webcam_C920_ABCD1234-video-index0
+var v4lByIDDir = "/dev/v4l/by-id"
+
+// resolveDevicePath get the video device of a camera, found by its serial number if set, otherwise at
+// serialPort, which may be a stable link of /dev/v4l/by-id. Links are resolved so that a camera opened
+// through different paths is the same device.
+func resolveDevicePath(serialPort string, serialNumber string) (string, error) {
+	path := serialPort
+	if serialNumber != "" {
+		entries, err := os.ReadDir(v4lByIDDir)
+		if err != nil {
+			return "", fmt.Errorf("find camera with serial number %s: %v", serialNumber, err)
+		}
+		var matches []string
+		for _, entry := range entries {
+			// the capture node of a camera is index 0, index 1 is its metadata node
+			if strings.HasSuffix(entry.Name(), "_"+serialNumber+"-video-index0") {
+				matches = append(matches, filepath.Join(v4lByIDDir, entry.Name()))
+			}
+		}
+		switch len(matches) {
+		case 0:
+			return "", fmt.Errorf("no camera with serial number %s in %s", serialNumber, v4lByIDDir)
+		case 1:
+			path = matches[0]
+		default:
+			return "", fmt.Errorf("cameras %s have the same serial number %s", strings.Join(matches, ", "), serialNumber)
+		}
+	}
+	if path == "" {
+		return "", fmt.Errorf("neither serialPort nor serialNumber of the camera is set")
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", fmt.Errorf("camera %s not found: %v", path, err)
+	}
+	return resolved, nil
+}
+
+var (
+	openedMutex sync.Mutex
+	// opened clients by the video device they opened
+	opened = make(map[string]*CustomizedClient)
+)
+
+// claimDevice reserve the video device for the client, a device can only be streamed by one client
+func claimDevice(path string, c *CustomizedClient) error {
+	openedMutex.Lock()
+	defer openedMutex.Unlock()
+	if owner, ok := opened[path]; ok && owner != c {
+		return fmt.Errorf("camera %s is already opened by the device with protocolID %d", path, owner.ProtocolID)
+	}
+	opened[path] = c
+	return nil
+}
+
+func releaseDevice(path string, c *CustomizedClient) {
+	openedMutex.Lock()
+	defer openedMutex.Unlock()
+	if opened[path] == c {
+		delete(opened, path)
+	}
+}
+
+// negotiateFormat set the pixel format and frame size of the camera closest to the configured ones.
+// The configured format is used if the camera supports it, otherwise Motion-JPEG, YUYV or the first
+// supported format. The configured size is used if supported, otherwise the closest one, or the largest
+// one if no size is configured.
+func negotiateFormat(cam Camera, format webcam.PixelFormat, width uint32, height uint32) (webcam.PixelFormat, uint32, uint32, error) {
+	supported := cam.GetSupportedFormats()
+	if len(supported) == 0 {
+		return 0, 0, 0, fmt.Errorf("the camera supports no pixel format")
+	}
+	if _, ok := supported[format]; !ok {
+		candidates := make([]webcam.PixelFormat, 0, len(supported))
+		for f := range supported {
+			candidates = append(candidates, f)
+		}
+		sort.Slice(candidates, func(i, j int) bool { return candidates[i] < candidates[j] })
+		chosen := candidates[0]
+		for _, preferred := range []webcam.PixelFormat{PixelFormatYUYV, PixelFormatMJPEG} {
+			if _, ok := supported[preferred]; ok {
+				chosen = preferred
+			}
+		}
+		if format != 0 {
+			klog.Warningf("Camera does not support pixel format %s, using %s", fourcc(format), fourcc(chosen))
+		}
+		format = chosen
+	}
+
+	bestWidth, bestHeight, found := closestSize(cam.GetSupportedFrameSizes(format), width, height)
+	if !found {
+		// the camera does not enumerate its frame sizes, let the driver adjust the configured one
+		bestWidth, bestHeight = width, height
+	}
+	return cam.SetImageFormat(format, bestWidth, bestHeight)
+}
+
+// closestSize get the frame size of sizes closest to width x height, or the largest one if either is 0
+func closestSize(sizes []webcam.FrameSize, width uint32, height uint32) (uint32, uint32, bool) {
+	var bestWidth, bestHeight uint32
+	var best int64
+	found := false
+	for _, size := range sizes {
+		w := fitSize(width, size.MinWidth, size.MaxWidth, size.StepWidth)
+		h := fitSize(height, size.MinHeight, size.MaxHeight, size.StepHeight)
+		var distance int64
+		if width == 0 || height == 0 {
+			distance = -int64(w) * int64(h)
+		} else {
+			distance = abs(int64(w)-int64(width)) + abs(int64(h)-int64(height))
+		}
+		if !found || distance < best {
+			found, best, bestWidth, bestHeight = true, distance, w, h
+		}
+	}
+	return bestWidth, bestHeight, found
+}
+
+// fitSize get the size of a range closest to want, or the largest one if want is 0
+func fitSize(want uint32, min uint32, max uint32, step uint32) uint32 {
+	if want == 0 || want >= max {
+		return max
+	}
+	if want <= min {
+		return min
+	}
+	if step == 0 {
+		return want
+	}
+	size := min + (want-min+step/2)/step*step
+	if size > max {
+		size -= step
+	}
+	return size
+}
+
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// fourcc get the four character code of a pixel format, such as YUYV
+func fourcc(format webcam.PixelFormat) string {
+	return string([]byte{byte(format), byte(format >> 8), byte(format >> 16), byte(format >> 24)})
+}
@@ -0,0 +1,330 @@
+package driver
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"unsafe"
+
+	"github.com/blackjack/webcam"
+	"github.com/blackjack/webcam/ioctl"
+	"k8s.io/klog/v2"
+)
+
+// CameraCapabilities are the pixel formats, frame sizes and controls of a camera, discovered when it is opened
+type CameraCapabilities struct {
+	Formats  []FormatCapability  `json:"formats"`
+	Controls []ControlCapability `json:"controls"`
+
+	// current image format of the camera
+	Format string `json:"format"`
+	Width  uint32 `json:"width"`
+	Height uint32 `json:"height"`
+}
+
+// FormatCapability is a pixel format and its frame sizes
+type FormatCapability struct {
+	Format      string                `json:"format"` // four character code, such as YUYV
+	Description string                `json:"description"`
+	FrameSizes  []FrameSizeCapability `json:"frameSizes"`
+}
+
+// FrameSizeCapability is a frame size, or a range of sizes if the steps are not 0
+type FrameSizeCapability struct {
+	MinWidth   uint32 `json:"minWidth"`
+	MaxWidth   uint32 `json:"maxWidth"`
+	StepWidth  uint32 `json:"stepWidth,omitempty"`
+	MinHeight  uint32 `json:"minHeight"`
+	MaxHeight  uint32 `json:"maxHeight"`
+	StepHeight uint32 `json:"stepHeight,omitempty"`
+}
+
+// ControlCapability is a V4L2 control, such as Brightness
+type ControlCapability struct {
+	ID       uint32     `json:"id"`
+	Name     string     `json:"name"`
+	Type     string     `json:"type"`
+	Min      int32      `json:"min"`
+	Max      int32      `json:"max"`
+	Step     int32      `json:"step"`
+	Default  int32      `json:"default"`
+	ReadOnly bool       `json:"readOnly,omitempty"`
+	Inactive bool       `json:"inactive,omitempty"` // e.g. Exposure (Absolute) while Exposure, Auto is on
+	Menu     []MenuItem `json:"menu,omitempty"`
+}
+
+// MenuItem is a value of a menu control
+type MenuItem struct {
+	Index int32  `json:"index"`
+	Name  string `json:"name,omitempty"`
+	Value int64  `json:"value,omitempty"` // value of integer menus
+}
+
+// Types of controls
+const (
+	ControlTypeInteger     = "integer"
+	ControlTypeBoolean     = "boolean"
+	ControlTypeMenu        = "menu"
+	ControlTypeButton      = "button"
+	ControlTypeInteger64   = "integer64"
+	ControlTypeBitmask     = "bitmask"
+	ControlTypeIntegerMenu = "integerMenu"
+)
+
+// v4l2Camera is a webcam whose controls are queried with their default values and menu items,
+// which the webcam package does not report
+type v4l2Camera struct {
+	*webcam.Webcam
+	path string
+}
+
+func (c *v4l2Camera) QueryControls() ([]ControlCapability, error) {
+	// the file descriptor of the webcam is not exported, controls are queried with another one
+	f, err := os.OpenFile(c.path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return queryControls(f.Fd())
+}
+
+const (
+	v4l2CtrlFlagDisabled  uint32 = 0x0001
+	v4l2CtrlFlagReadOnly  uint32 = 0x0004
+	v4l2CtrlFlagInactive  uint32 = 0x0010
+	v4l2CtrlFlagNextCtrl  uint32 = 0x80000000
+	v4l2CtrlCompoundTypes uint32 = 0x0100
+)
+
+var v4l2ControlTypes = map[uint32]string{
+	1: ControlTypeInteger,
+	2: ControlTypeBoolean,
+	3: ControlTypeMenu,
+	4: ControlTypeButton,
+	5: ControlTypeInteger64,
+	8: ControlTypeBitmask,
+	9: ControlTypeIntegerMenu,
+}
+
+// types of the controls reported by the webcam package
+var webcamControlTypes = map[int32]string{
+	0: ControlTypeInteger,
+	1: ControlTypeBoolean,
+	2: ControlTypeMenu,
+}
+
+// v4l2QueryCtrl is struct v4l2_queryctrl of linux/videodev2.h
+type v4l2QueryCtrl struct {
+	id           uint32
+	controlType  uint32
+	name         [32]uint8
+	minimum      int32
+	maximum      int32
+	step         int32
+	defaultValue int32
+	flags        uint32
+	reserved     [2]uint32
+}
+
+// v4l2QueryMenu is struct v4l2_querymenu of linux/videodev2.h, name is a union with the int64 value of
+// integer menus
+type v4l2QueryMenu struct {
+	id       uint32
+	index    uint32
+	name     [32]uint8
+	reserved uint32
+}
+
+var (
+	vidiocQueryCtrl = ioctl.IoRW(uintptr('V'), 36, unsafe.Sizeof(v4l2QueryCtrl{}))
+	vidiocQueryMenu = ioctl.IoRW(uintptr('V'), 37, unsafe.Sizeof(v4l2QueryMenu{}))
+)
+
+// queryControls enumerate the controls of a video device with VIDIOC_QUERYCTRL, skipping disabled
+// controls, control classes and compound controls
+func queryControls(fd uintptr) ([]ControlCapability, error) {
+	var controls []ControlCapability
+	id := uint32(0)
+	for {
+		query := &v4l2QueryCtrl{id: id | v4l2CtrlFlagNextCtrl}
+		if err := ioctl.Ioctl(fd, vidiocQueryCtrl, uintptr(unsafe.Pointer(query))); err != nil {
+			// EINVAL after the last control
+			break
+		}
+		id = query.id
+		controlType, ok := v4l2ControlTypes[query.controlType]
+		if !ok || query.controlType >= v4l2CtrlCompoundTypes || query.flags&v4l2CtrlFlagDisabled != 0 {
+			continue
+		}
+		control := ControlCapability{
+			ID:       query.id,
+			Name:     webcam.CToGoString(query.name[:]),
+			Type:     controlType,
+			Min:      query.minimum,
+			Max:      query.maximum,
+			Step:     query.step,
+			Default:  query.defaultValue,
+			ReadOnly: query.flags&v4l2CtrlFlagReadOnly != 0,
+			Inactive: query.flags&v4l2CtrlFlagInactive != 0,
+		}
+		if controlType == ControlTypeMenu || controlType == ControlTypeIntegerMenu {
+			for index := query.minimum; index <= query.maximum && index >= 0; index++ {
+				menu := &v4l2QueryMenu{id: query.id, index: uint32(index)}
+				// menus may have holes
+				if err := ioctl.Ioctl(fd, vidiocQueryMenu, uintptr(unsafe.Pointer(menu))); err != nil {
+					continue
+				}
+				item := MenuItem{Index: index}
+				if controlType == ControlTypeMenu {
+					item.Name = webcam.CToGoString(menu.name[:])
+				} else {
+					copy((*[8]byte)(unsafe.Pointer(&item.Value))[:], menu.name[:8])
+				}
+				control.Menu = append(control.Menu, item)
+			}
+		}
+		controls = append(controls, control)
+	}
+	if len(controls) == 0 && id == 0 {
+		return nil, fmt.Errorf("query controls failed")
+	}
+	return controls, nil
+}
+
+// discoverCapabilities enumerate the formats, frame sizes and controls of the camera. The controls
+// reported by the webcam package, without default values and menu items, are used if they can not be
+// queried.
+func discoverCapabilities(cam Camera) CameraCapabilities {
+	var capabilities CameraCapabilities
+	formats := cam.GetSupportedFormats()
+	codes := make([]webcam.PixelFormat, 0, len(formats))
+	for code := range formats {
+		codes = append(codes, code)
+	}
+	sort.Slice(codes, func(i, j int) bool { return codes[i] < codes[j] })
+	for _, code := range codes {
+		format := FormatCapability{Format: fourcc(code), Description: formats[code], FrameSizes: []FrameSizeCapability{}}
+		for _, size := range cam.GetSupportedFrameSizes(code) {
+			format.FrameSizes = append(format.FrameSizes, FrameSizeCapability(size))
+		}
+		capabilities.Formats = append(capabilities.Formats, format)
+	}
+
+	controls, err := cam.QueryControls()
+	if err != nil {
+		klog.Warningf("Query the controls of the camera failed with err: %v", err)
+		controls = nil
+		for id, control := range cam.GetControls() {
+			controls = append(controls, ControlCapability{
+				ID:   uint32(id),
+				Name: control.Name,
+				Type: webcamControlTypes[control.Type],
+				Min:  control.Min,
+				Max:  control.Max,
+				Step: control.Step,
+			})
+		}
+	}
+	sort.Slice(controls, func(i, j int) bool { return controls[i].ID < controls[j].ID })
+	capabilities.Controls = controls
+	return capabilities
+}
+
+// frameSizes get the frame sizes of a pixel format, nil if it is not supported
+func (c *CameraCapabilities) frameSizes(format webcam.PixelFormat) []webcam.FrameSize {
+	for _, f := range c.Formats {
+		if f.Format == fourcc(format) {
+			sizes := make([]webcam.FrameSize, 0, len(f.FrameSizes))
+			for _, size := range f.FrameSizes {
+				sizes = append(sizes, webcam.FrameSize(size))
+			}
+			return sizes
+		}
+	}
+	return nil
+}
+
+// control get the control of a name
+func (c *CameraCapabilities) control(name string) (ControlCapability, bool) {
+	for _, control := range c.Controls {
+		if control.Name == name {
+			return control, true
+		}
+	}
+	return ControlCapability{}, false
+}
+
+// validate check that a value can be written to the control
+func (control *ControlCapability) validate(value int64) error {
+	if control.ReadOnly {
+		return fmt.Errorf("control %s is read only", control.Name)
+	}
+	switch control.Type {
+	case ControlTypeButton:
+		return nil
+	case ControlTypeMenu, ControlTypeIntegerMenu:
+		// menu items are unknown if the controls could not be queried, the range is checked instead
+		if len(control.Menu) > 0 {
+			for _, item := range control.Menu {
+				if int64(item.Index) == value {
+					return nil
+				}
+			}
+			return fmt.Errorf("%d is not a menu index of control %s", value, control.Name)
+		}
+	}
+	if value < int64(control.Min) || value > int64(control.Max) {
+		return fmt.Errorf("value %d of control %s is out of the range [%d, %d]", value, control.Name, control.Min, control.Max)
+	}
+	if control.Step > 1 && (value-int64(control.Min))%int64(control.Step) != 0 {
+		return fmt.Errorf("value %d of control %s is not a step of %d from %d", value, control.Name, control.Step, control.Min)
+	}
+	return nil
+}
+
+// sizeFits reports whether size is in the range of a dimension of a frame size
+func sizeFits(size uint32, min uint32, max uint32, step uint32) bool {
+	if size < min || size > max {
+		return false
+	}
+	return step == 0 || (size-min)%step == 0
+}
+
+// parsePixelFormat parse a four character code such as MJPG, or the number of a pixel format
+func parsePixelFormat(data interface{}) (webcam.PixelFormat, error) {
+	switch v := data.(type) {
+	case string:
+		if len(v) == 4 {
+			return webcam.PixelFormat(uint32(v[0]) | uint32(v[1])<<8 | uint32(v[2])<<16 | uint32(v[3])<<24), nil
+		}
+		code, err := strconv.ParseUint(v, 0, 32)
+		if err != nil {
+			return 0, fmt.Errorf("invalid pixel format %q", v)
+		}
+		return webcam.PixelFormat(code), nil
+	case int64:
+		return webcam.PixelFormat(v), nil
+	}
+	return 0, fmt.Errorf("invalid pixel format %v", data)
+}
+
+// toInt64 convert the value of an int, boolean or integral float property
+func toInt64(data interface{}) (int64, error) {
+	switch v := data.(type) {
+	case int64:
+		return v, nil
+	case float64:
+		if v == float64(int64(v)) {
+			return int64(v), nil
+		}
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	case string:
+		return strconv.ParseInt(v, 0, 64)
+	}
+	return 0, fmt.Errorf("invalid integer %v", data)
+}
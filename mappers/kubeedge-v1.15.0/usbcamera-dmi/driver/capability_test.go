@@ -0,0 +1,181 @@
+package driver
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/blackjack/webcam"
+)
+
+func visitor(featureName string) *VisitorConfig {
+	return &VisitorConfig{VisitorConfigData: VisitorConfigData{FeatureName: featureName}}
+}
+
+func TestDiscoverCapabilities(t *testing.T) {
+	dir, cameras := fakeDevices(t, "video0")
+	client := newTestClient(t, ConfigData{SerialPort: filepath.Join(dir, "video0"), Width: 640, Height: 480, Format: int(PixelFormatYUYV)})
+	if err := client.InitDevice(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := client.GetDeviceData(visitor(Capabilities))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var capabilities CameraCapabilities
+	if err = json.Unmarshal([]byte(data.(string)), &capabilities); err != nil {
+		t.Fatal(err)
+	}
+	if len(capabilities.Formats) != 2 || capabilities.Formats[0].Format != "MJPG" || capabilities.Formats[1].Format != "YUYV" ||
+		len(capabilities.Formats[1].FrameSizes) != 2 {
+		t.Errorf("formats = %+v", capabilities.Formats)
+	}
+	if capabilities.Format != "YUYV" || capabilities.Width != 640 || capabilities.Height != 480 {
+		t.Errorf("current format = %s %dx%d, want YUYV 640x480", capabilities.Format, capabilities.Width, capabilities.Height)
+	}
+	if len(capabilities.Controls) != 3 || capabilities.Controls[0].Name != Brightness || capabilities.Controls[0].Default != 128 ||
+		len(capabilities.Controls[1].Menu) != 3 {
+		t.Errorf("controls = %+v", capabilities.Controls)
+	}
+
+	// the webcam package reports the controls if they can not be queried
+	cameras[filepath.Join(dir, "video0")].queryErr = errors.New("inappropriate ioctl for device")
+	if err = client.InitDevice(); err != nil {
+		t.Fatal(err)
+	}
+	capabilities, err = client.Capabilities()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(capabilities.Controls) != 3 || capabilities.Controls[1].Name != PowerLineFrequency || capabilities.Controls[1].Menu != nil {
+		t.Errorf("controls = %+v", capabilities.Controls)
+	}
+	if err = client.SetDeviceData(int64(2), visitor(PowerLineFrequency)); err != nil {
+		t.Errorf("set a menu control without menu items error = %v", err)
+	}
+}
+
+func TestSetControl(t *testing.T) {
+	dir, cameras := fakeDevices(t, "video0")
+	cam := cameras[filepath.Join(dir, "video0")]
+	cam.controls = append(cam.controls, ControlCapability{ID: 4, Name: "Focus (absolute)", Type: ControlTypeInteger, Max: 250, Step: 5, ReadOnly: true})
+	client := newTestClient(t, ConfigData{SerialPort: filepath.Join(dir, "video0")})
+	if err := client.InitDevice(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		featureName string
+		value       interface{}
+		wantErr     bool
+	}{
+		{featureName: Brightness, value: int64(255)},
+		{featureName: Brightness, value: float64(10)},
+		{featureName: Brightness, value: int64(256), wantErr: true},
+		{featureName: Brightness, value: int64(-1), wantErr: true},
+		{featureName: Brightness, value: "bright", wantErr: true},
+		{featureName: PowerLineFrequency, value: int64(2)},
+		{featureName: PowerLineFrequency, value: int64(3), wantErr: true},
+		{featureName: WhiteBalanceTemperature, value: int64(5000)},
+		{featureName: WhiteBalanceTemperature, value: int64(5005), wantErr: true},
+		{featureName: "Focus (absolute)", value: int64(10), wantErr: true},
+		{featureName: "Zoom, Absolute", value: int64(1), wantErr: true},
+		{featureName: BusInfo, value: "usb-1", wantErr: true},
+	}
+	for _, tt := range tests {
+		err := client.SetDeviceData(tt.value, visitor(tt.featureName))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("SetDeviceData(%v, %s) error = %v, wantErr %v", tt.value, tt.featureName, err, tt.wantErr)
+		}
+	}
+	if cam.values[1] != 10 || cam.values[2] != 2 || cam.values[3] != 5000 {
+		t.Errorf("control values = %v", cam.values)
+	}
+	if value, err := client.GetDeviceData(visitor(PowerLineFrequency)); err != nil || value != int32(2) {
+		t.Errorf("GetDeviceData(%s) = %v, %v", PowerLineFrequency, value, err)
+	}
+	if _, err := client.GetDeviceData(visitor("Zoom, Absolute")); err == nil {
+		t.Error("GetDeviceData() of an unknown control succeeded")
+	}
+}
+
+func TestSetImageFormat(t *testing.T) {
+	dir, cameras := fakeDevices(t, "video0")
+	cam := cameras[filepath.Join(dir, "video0")]
+	cam.sizes = []webcam.FrameSize{
+		{MinWidth: 640, MaxWidth: 640, MinHeight: 360, MaxHeight: 360},
+		{MinWidth: 640, MaxWidth: 640, MinHeight: 480, MaxHeight: 480},
+		{MinWidth: 1280, MaxWidth: 1280, MinHeight: 720, MaxHeight: 720},
+	}
+	client := newTestClient(t, ConfigData{SerialPort: filepath.Join(dir, "video0"), Width: 640, Height: 480, Format: int(PixelFormatYUYV)})
+	if err := client.InitDevice(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.GetDeviceData(visitor(ImageTrigger)); err != nil {
+		t.Fatal(err)
+	}
+
+	// writing the current size does not restart streaming
+	if err := client.SetDeviceData(int64(640), visitor(Width)); err != nil || cam.opens != 1 {
+		t.Fatalf("set the current width: opens = %d, err = %v", cam.opens, err)
+	}
+	// the height follows the width
+	if err := client.SetDeviceData(int64(1280), visitor(Width)); err != nil {
+		t.Fatal(err)
+	}
+	if cam.opens != 2 || cam.width != 1280 || cam.height != 720 {
+		t.Errorf("opens = %d, frame size = %dx%d, want the camera opened again with 1280x720", cam.opens, cam.width, cam.height)
+	}
+	if client.Width != 1280 || client.Height != 720 {
+		t.Errorf("configured frame size = %dx%d, want 1280x720", client.Width, client.Height)
+	}
+	if _, err := client.GetDeviceData(visitor(ImageTrigger)); err != nil {
+		t.Fatalf("read an image after the frame size changed: %v", err)
+	}
+
+	if err := client.SetDeviceData(int64(360), visitor(Height)); err != nil {
+		t.Fatal(err)
+	}
+	if cam.width != 640 || cam.height != 360 {
+		t.Errorf("frame size = %dx%d, want 640x360", cam.width, cam.height)
+	}
+	if err := client.SetDeviceData("MJPG", visitor(PixelFormat)); err != nil {
+		t.Fatal(err)
+	}
+	if cam.format != PixelFormatMJPEG || cam.width != 640 || cam.height != 360 {
+		t.Errorf("format = %s %dx%d, want MJPG 640x360", fourcc(cam.format), cam.width, cam.height)
+	}
+	if value, err := client.GetDeviceData(visitor(PixelFormat)); err != nil || value != "MJPG" {
+		t.Errorf("GetDeviceData(%s) = %v, %v", PixelFormat, value, err)
+	}
+
+	for featureName, value := range map[string]interface{}{
+		Width:       int64(1000),
+		Height:      int64(0),
+		PixelFormat: "H264",
+	} {
+		if err := client.SetDeviceData(value, visitor(featureName)); err == nil {
+			t.Errorf("SetDeviceData(%v, %s) succeeded", value, featureName)
+		}
+	}
+	if cam.format != PixelFormatMJPEG || cam.width != 640 || cam.height != 360 {
+		t.Errorf("format after invalid writes = %s %dx%d", fourcc(cam.format), cam.width, cam.height)
+	}
+}
+
+func TestParsePixelFormat(t *testing.T) {
+	for value, want := range map[interface{}]webcam.PixelFormat{
+		"YUYV":                 PixelFormatYUYV,
+		"0x47504A4D":           PixelFormatMJPEG,
+		int64(PixelFormatYUYV): PixelFormatYUYV,
+	} {
+		if got, err := parsePixelFormat(value); err != nil || got != want {
+			t.Errorf("parsePixelFormat(%v) = %s, %v, want %s", value, fourcc(got), err, fourcc(want))
+		}
+	}
+	if _, err := parsePixelFormat("MJPEG"); err == nil {
+		t.Error("parsePixelFormat(MJPEG) succeeded")
+	}
+}
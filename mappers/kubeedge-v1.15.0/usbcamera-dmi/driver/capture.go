@@ -0,0 +1,301 @@
+package driver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"sync"
+	"time"
+
+	"github.com/blackjack/webcam"
+	"k8s.io/klog/v2"
+)
+
+// Defaults of the capture loop
+const (
+	defaultFrameBuffer = 4
+	defaultIdleTimeout = 30 // seconds
+	defaultJPEGQuality = 80
+)
+
+// errCaptureIdle stops the capture loop when no consumer asked for frames for the idle timeout
+var errCaptureIdle = errors.New("the capture stopped, no frame was asked for")
+
+// Frame is an image captured by the camera in its pixel format
+type Frame struct {
+	Data      []byte
+	Format    webcam.PixelFormat
+	Width     uint32
+	Height    uint32
+	Timestamp time.Time
+	// Sequence increases with each frame captured by the camera
+	Sequence uint64
+
+	quality  int
+	jpegOnce sync.Once
+	jpeg     []byte
+	jpegErr  error
+}
+
+// JPEG get the frame as a JPEG image. Motion-JPEG frames are returned as they are, YUYV frames are
+// encoded once for all the consumers of the frame.
+func (f *Frame) JPEG() ([]byte, error) {
+	f.jpegOnce.Do(func() {
+		switch f.Format {
+		case PixelFormatMJPEG:
+			f.jpeg = f.Data
+		case PixelFormatYUYV:
+			f.jpeg, f.jpegErr = encodeYUYV(f.Data, int(f.Width), int(f.Height), f.quality)
+		default:
+			f.jpegErr = fmt.Errorf("frames in pixel format %s can not be encoded as JPEG", fourcc(f.Format))
+		}
+	})
+	return f.jpeg, f.jpegErr
+}
+
+// encodeYUYV encode a YUYV 4:2:2 frame, Y0 Cb Y1 Cr for each two pixels, as JPEG
+func encodeYUYV(data []byte, width int, height int, quality int) ([]byte, error) {
+	if width <= 0 || height <= 0 || width%2 != 0 || len(data) < width*height*2 {
+		return nil, fmt.Errorf("invalid YUYV frame of %d bytes for %dx%d", len(data), width, height)
+	}
+	img := image.NewYCbCr(image.Rect(0, 0, width, height), image.YCbCrSubsampleRatio422)
+	for y := 0; y < height; y++ {
+		row := data[y*width*2 : (y+1)*width*2]
+		for x := 0; x < width; x += 2 {
+			img.Y[y*img.YStride+x] = row[x*2]
+			img.Cb[y*img.CStride+x/2] = row[x*2+1]
+			img.Y[y*img.YStride+x+1] = row[x*2+2]
+			img.Cr[y*img.CStride+x/2] = row[x*2+3]
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// frameBuffer is a ring of the last frames of the capture loop
+type frameBuffer struct {
+	mutex    sync.Mutex
+	frames   []*Frame
+	next     int
+	sequence uint64
+	// notify is closed and replaced when a frame is added or the capture stops
+	notify chan struct{}
+	// err is why the capture stopped
+	err error
+}
+
+func newFrameBuffer(size int) *frameBuffer {
+	if size <= 0 {
+		size = defaultFrameBuffer
+	}
+	return &frameBuffer{frames: make([]*Frame, size), notify: make(chan struct{})}
+}
+
+func (b *frameBuffer) broadcast() {
+	close(b.notify)
+	b.notify = make(chan struct{})
+}
+
+func (b *frameBuffer) push(frame *Frame) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.sequence++
+	frame.Sequence = b.sequence
+	b.frames[b.next] = frame
+	b.next = (b.next + 1) % len(b.frames)
+	b.broadcast()
+}
+
+// reset drop the frames of a previous capture, which are out of date
+func (b *frameBuffer) reset() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for i := range b.frames {
+		b.frames[i] = nil
+	}
+	b.err = nil
+}
+
+func (b *frameBuffer) stop(err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.err = err
+	b.broadcast()
+}
+
+// get the oldest buffered frame captured after the frame with sequence after, so that a consumer
+// slower than the camera gets the frames in order while they are buffered, or the latest frame if
+// after is 0. Otherwise get the channel notified by the next frame, or why the capture stopped.
+func (b *frameBuffer) get(after uint64) (*Frame, <-chan struct{}, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	var found *Frame
+	for i := range b.frames {
+		// from the newest frame to the oldest one
+		frame := b.frames[(b.next-1-i+2*len(b.frames))%len(b.frames)]
+		if frame == nil || frame.Sequence <= after {
+			break
+		}
+		found = frame
+		if after == 0 {
+			break
+		}
+	}
+	if found != nil {
+		return found, nil, nil
+	}
+	return nil, b.notify, b.err
+}
+
+// NextFrame get the oldest buffered frame captured after the frame with sequence after, or the latest
+// frame if after is 0, waiting for the next one if there is none. The capture loop is started if it
+// is not running.
+func (c *CustomizedClient) NextFrame(ctx context.Context, after uint64) (*Frame, error) {
+	if err := c.startCapture(); err != nil {
+		return nil, err
+	}
+	timer := time.NewTimer(frameTimeout * time.Second)
+	defer timer.Stop()
+	for {
+		frame, notify, err := c.frames.get(after)
+		if frame != nil {
+			return frame, nil
+		}
+		if errors.Is(err, errCaptureIdle) {
+			// stopped right before the frame was asked for
+			if err = c.startCapture(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		select {
+		case <-notify:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-timer.C:
+			return nil, fmt.Errorf("no frame was captured in %d seconds", frameTimeout)
+		}
+	}
+}
+
+// startCapture start the capture loop if it is not running, and keep it running for the idle timeout
+func (c *CustomizedClient) startCapture() error {
+	c.deviceMutex.Lock()
+	defer c.deviceMutex.Unlock()
+	if c.cam == nil {
+		return errNotOpened
+	}
+	c.lastAccess = time.Now()
+	if !c.capturing {
+		c.capturing = true
+		c.frames.reset()
+		go c.capture()
+	}
+	return nil
+}
+
+// capture read the frames of the camera into the frame buffer until it fails or no consumer asked
+// for frames for the idle timeout
+func (c *CustomizedClient) capture() {
+	for {
+		frame, err := c.captureFrame()
+		if err != nil {
+			klog.V(2).Infof("Stopped capturing the frames of camera %s: %v", c.SerialPort, err)
+			return
+		}
+		if frame != nil {
+			c.frames.push(frame)
+		}
+	}
+}
+
+// captureFrame read a frame of the camera, or stop the capture loop. The frame is waited for without
+// holding deviceMutex, so the twins and the controls of the camera are not blocked by a slow camera.
+func (c *CustomizedClient) captureFrame() (*Frame, error) {
+	cam, err := c.startStreaming()
+	if err != nil {
+		return nil, err
+	}
+	waitErr := cam.WaitForFrame(frameTimeout)
+
+	c.deviceMutex.Lock()
+	defer c.deviceMutex.Unlock()
+	if c.cam == nil {
+		return nil, c.stopCapture(errNotOpened)
+	}
+	if c.cam != cam || !c.streaming {
+		// the camera was opened again while waiting, e.g. for a new image format
+		return nil, nil
+	}
+	if waitErr != nil {
+		return nil, c.stopCapture(fmt.Errorf("error waiting for frame:%v", waitErr))
+	}
+	data, err := c.cam.ReadFrame()
+	if err != nil {
+		return nil, c.stopCapture(fmt.Errorf("error reading frame:%v", err))
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+	quality := c.JPEGQuality
+	if quality <= 0 || quality > 100 {
+		quality = defaultJPEGQuality
+	}
+	// the data is in a buffer of the camera, which is queued again for the next frames
+	return &Frame{
+		Data:      append([]byte(nil), data...),
+		Format:    c.format,
+		Width:     c.width,
+		Height:    c.height,
+		Timestamp: time.Now(),
+		quality:   quality,
+	}, nil
+}
+
+// startStreaming start streaming the camera for the capture loop and return it, or stop the capture
+// loop if the camera is closed or was idle
+func (c *CustomizedClient) startStreaming() (Camera, error) {
+	c.deviceMutex.Lock()
+	defer c.deviceMutex.Unlock()
+	if c.cam == nil {
+		return nil, c.stopCapture(errNotOpened)
+	}
+	idleTimeout := time.Duration(c.IdleTimeout) * time.Second
+	if idleTimeout <= 0 {
+		idleTimeout = defaultIdleTimeout * time.Second
+	}
+	if time.Since(c.lastAccess) > idleTimeout {
+		if c.streaming {
+			if err := c.reopenCamera(); err != nil {
+				return nil, c.stopCapture(err)
+			}
+			if _, _, _, err := c.cam.SetImageFormat(c.format, c.width, c.height); err != nil {
+				return nil, c.stopCapture(fmt.Errorf("set the image format of the camera %s failed with err: %v", c.devicePath, err))
+			}
+		}
+		return nil, c.stopCapture(errCaptureIdle)
+	}
+	if !c.streaming {
+		if err := c.cam.StartStreaming(); err != nil {
+			return nil, c.stopCapture(fmt.Errorf("error starting streaming:%v", err))
+		}
+		c.streaming = true
+	}
+	return c.cam, nil
+}
+
+// stopCapture stop the capture loop with err, the caller holds deviceMutex
+func (c *CustomizedClient) stopCapture(err error) error {
+	c.capturing = false
+	c.frames.stop(err)
+	return err
+}
@@ -0,0 +1,179 @@
+package driver
+
+import (
+	"bytes"
+	"context"
+	"image/jpeg"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCaptureLoop(t *testing.T) {
+	dir, cameras := fakeDevices(t, "video0")
+	cam := cameras[filepath.Join(dir, "video0")]
+	client := newTestClient(t, ConfigData{SerialPort: filepath.Join(dir, "video0"), Width: 640, Height: 480, Format: int(PixelFormatYUYV)})
+	if err := client.InitDevice(); err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := client.NextFrame(context.Background(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(first.Data) != "video0" || first.Width != 640 || first.Height != 480 || first.Timestamp.IsZero() {
+		t.Errorf("frame = %+v", first)
+	}
+	next, err := client.NextFrame(context.Background(), first.Sequence)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.Sequence != first.Sequence+1 {
+		t.Errorf("sequence of the next frame = %d, want %d", next.Sequence, first.Sequence+1)
+	}
+
+	// the camera stops streaming when no frame was asked for during the idle timeout
+	client.deviceMutex.Lock()
+	client.lastAccess = time.Now().Add(-time.Hour)
+	client.deviceMutex.Unlock()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		client.deviceMutex.Lock()
+		capturing, streaming := client.capturing, client.streaming
+		client.deviceMutex.Unlock()
+		if !capturing && !streaming {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the capture loop did not stop")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if cam.opens != 2 || cam.format != PixelFormatYUYV || cam.width != 640 {
+		t.Errorf("opens = %d, format = %s %dx%d after the capture stopped", cam.opens, fourcc(cam.format), cam.width, cam.height)
+	}
+
+	// the capture starts again with fresh frames
+	frame, err := client.NextFrame(context.Background(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frame.Sequence <= next.Sequence {
+		t.Errorf("sequence after the capture started again = %d, want more than %d", frame.Sequence, next.Sequence)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err = client.StopDevice(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.NextFrame(ctx, frame.Sequence); err != errNotOpened {
+		t.Errorf("NextFrame() of a stopped device error = %v", err)
+	}
+}
+
+func TestWaitForFrameUnlocked(t *testing.T) {
+	dir, cameras := fakeDevices(t, "video0")
+	cam := cameras[filepath.Join(dir, "video0")]
+	cam.wait = make(chan struct{})
+	client := newTestClient(t, ConfigData{SerialPort: filepath.Join(dir, "video0"), Width: 640, Height: 480, Format: int(PixelFormatYUYV)})
+	if err := client.InitDevice(); err != nil {
+		t.Fatal(err)
+	}
+
+	frames := make(chan *Frame)
+	go func() {
+		frame, _ := client.NextFrame(context.Background(), 0)
+		frames <- frame
+	}()
+	// the capture loop waits for the camera, the controls can still be set
+	done := make(chan error)
+	go func() {
+		done <- client.SetDeviceData(int64(200), &VisitorConfig{VisitorConfigData: VisitorConfigData{FeatureName: Brightness}})
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("setting a control is blocked while waiting for a frame")
+	}
+
+	close(cam.wait)
+	select {
+	case frame := <-frames:
+		if frame == nil || string(frame.Data) != "video0" {
+			t.Errorf("frame = %+v", frame)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no frame after the camera is ready")
+	}
+}
+
+func TestFrameBuffer(t *testing.T) {
+	buffer := newFrameBuffer(3)
+	if frame, notify, err := buffer.get(0); frame != nil || notify == nil || err != nil {
+		t.Fatalf("get() of an empty buffer = %v, %v, %v", frame, notify, err)
+	}
+	for i := 0; i < 5; i++ {
+		buffer.push(&Frame{})
+	}
+	tests := []struct {
+		after uint64
+		want  uint64
+	}{
+		{after: 0, want: 5},
+		{after: 1, want: 3},
+		{after: 3, want: 4},
+		{after: 4, want: 5},
+		{after: 5},
+	}
+	for _, tt := range tests {
+		frame, _, _ := buffer.get(tt.after)
+		if tt.want == 0 {
+			if frame != nil {
+				t.Errorf("get(%d) = frame %d, want none", tt.after, frame.Sequence)
+			}
+			continue
+		}
+		if frame == nil || frame.Sequence != tt.want {
+			t.Errorf("get(%d) = %+v, want frame %d", tt.after, frame, tt.want)
+		}
+	}
+
+	_, notify, _ := buffer.get(5)
+	buffer.stop(errCaptureIdle)
+	select {
+	case <-notify:
+	default:
+		t.Error("stopping the buffer did not notify the consumers")
+	}
+	if _, _, err := buffer.get(5); err != errCaptureIdle {
+		t.Errorf("get() of a stopped buffer error = %v", err)
+	}
+}
+
+func TestFrameJPEG(t *testing.T) {
+	// a gray 4x2 YUYV frame
+	data := bytes.Repeat([]byte{128, 128, 128, 128}, 4)
+	frame := &Frame{Data: data, Format: PixelFormatYUYV, Width: 4, Height: 2, quality: defaultJPEGQuality}
+	encoded, err := frame.JPEG()
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := jpeg.Decode(bytes.NewReader(encoded))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := img.Bounds().Size(); size.X != 4 || size.Y != 2 {
+		t.Errorf("size of the image = %v, want 4x2", size)
+	}
+
+	if encoded, err = (&Frame{Data: []byte("jpeg"), Format: PixelFormatMJPEG}).JPEG(); err != nil || string(encoded) != "jpeg" {
+		t.Errorf("JPEG() of a Motion-JPEG frame = %q, %v", encoded, err)
+	}
+	if _, err = (&Frame{Data: data[:4], Format: PixelFormatYUYV, Width: 4, Height: 2}).JPEG(); err == nil {
+		t.Error("JPEG() of a short frame succeeded")
+	}
+}
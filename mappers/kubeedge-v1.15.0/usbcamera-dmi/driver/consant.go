@@ -23,4 +23,5 @@ const (
 	Brightness                  = "Brightness"
 	ImageTrigger                = "ImageTrigger"
 	PixelFormat                 = "PixelFormat"
+	Capabilities                = "Capabilities"
 )
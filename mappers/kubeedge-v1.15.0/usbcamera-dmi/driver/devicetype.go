@@ -2,6 +2,9 @@ package driver
 
 import (
 	"sync"
+	"time"
+
+	"github.com/blackjack/webcam"
 
 	"github.com/kubeedge/usb/pkg/common"
 )
@@ -13,9 +16,25 @@ type CustomizedDev struct {
 }
 
 type CustomizedClient struct {
-	// TODO add some variables to help you better implement device drivers
+	// deviceMutex guards the camera, which is not safe for concurrent use
 	deviceMutex sync.Mutex
 	ProtocolConfig
+
+	cam        Camera
+	devicePath string // resolved path of the opened camera
+	streaming  bool
+
+	// negotiated image format of the camera
+	format webcam.PixelFormat
+	width  uint32
+	height uint32
+
+	capabilities CameraCapabilities
+
+	// frames of the capture loop, which runs while consumers ask for frames
+	frames     *frameBuffer
+	capturing  bool
+	lastAccess time.Time
 }
 
 type ProtocolConfig struct {
@@ -24,14 +43,23 @@ type ProtocolConfig struct {
 }
 
 type ConfigData struct {
-	// TODO: add your protocol config data
+	// SerialPort is the path of the video device, such as /dev/video0, or a stable link of /dev/v4l/by-id
 	SerialPort string `json:"serialPort"`
+	// SerialNumber finds the camera by the serial number of its /dev/v4l/by-id link instead of SerialPort
+	SerialNumber string `json:"serialNumber,omitempty"`
 
 	DeviceID int `json:"deviceID,omitempty"`
 	Width    int `json:"width,omitempty"`
 	Height   int `json:"height,omitempty"`
 	Format   int `json:"format,omitempty"`
 
+	// FrameBuffer is the number of the last captured frames kept for slow consumers, 4 by default
+	FrameBuffer int `json:"frameBuffer,omitempty"`
+	// IdleTimeout is the time in seconds the camera streams after the last frame was asked for, 30 by default
+	IdleTimeout int `json:"idleTimeout,omitempty"`
+	// JPEGQuality is the quality of the frames encoded as JPEG, 1 to 100, 80 by default
+	JPEGQuality int `json:"jpegQuality,omitempty"`
+
 	ProtocolID int `json:"protocolID"`
 }
 
@@ -1,100 +1,258 @@
 package driver
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+
 	"github.com/blackjack/webcam"
 	"k8s.io/klog/v2"
-	"sync"
-	"time"
 )
 
-var Cam *webcam.Webcam
+// frameTimeout is the time in seconds to wait for a frame of the camera
+const frameTimeout = 5
+
+var errNotOpened = errors.New("the camera is not opened")
 
 func NewClient(protocol ProtocolConfig) (*CustomizedClient, error) {
 	client := &CustomizedClient{
 		ProtocolConfig: protocol,
 		deviceMutex:    sync.Mutex{},
-		// TODO initialize the variables you added
+		frames:         newFrameBuffer(protocol.FrameBuffer),
 	}
 	return client, nil
 }
 
 func (c *CustomizedClient) InitDevice() error {
-	// TODO: add init operation
-	// you can use c.ProtocolConfig
-	cam, err := inner(c.SerialPort)
+	c.deviceMutex.Lock()
+	defer c.deviceMutex.Unlock()
+	// the camera is opened again when the device reconnects
+	c.closeCamera()
+
+	path, err := resolveDevicePath(c.SerialPort, c.SerialNumber)
 	if err != nil {
 		return err
 	}
-	Cam = cam
-
-	return nil
-}
-
-func inner(path string) (*webcam.Webcam, error) {
-	var cam *webcam.Webcam = nil
-	var err error
-	for {
-		cam, err = webcam.Open(path)
-		if err == nil {
-			break
-		} else {
-			klog.Errorf("open the carmera failed with err: %v", err)
-			time.Sleep(1 * time.Second)
-		}
+	if err = claimDevice(path, c); err != nil {
+		return err
+	}
+	cam, err := openCamera(path)
+	if err != nil {
+		releaseDevice(path, c)
+		return fmt.Errorf("open the camera %s failed with err: %v", path, err)
+	}
+	format, width, height, err := negotiateFormat(cam, webcam.PixelFormat(c.Format), uint32(c.Width), uint32(c.Height))
+	if err != nil {
+		cam.Close()
+		releaseDevice(path, c)
+		return fmt.Errorf("set the image format of the camera %s failed with err: %v", path, err)
 	}
-	return cam, err
+	c.cam, c.devicePath = cam, path
+	c.format, c.width, c.height = format, width, height
+	c.capabilities = discoverCapabilities(cam)
+	c.capabilities.Format, c.capabilities.Width, c.capabilities.Height = fourcc(format), width, height
+	klog.V(2).Infof("Opened the camera %s with pixel format %s and frame size %dx%d", path, fourcc(format), width, height)
+	return nil
 }
 
 func (c *CustomizedClient) GetDeviceData(visitor *VisitorConfig) (interface{}, error) {
-	// TODO: add the code to get device's data
-	// you can use c.ProtocolConfig and visitor
+	if visitor.FeatureName == ImageTrigger {
+		// the frame is read by the capture loop, which holds deviceMutex
+		return c.getImage()
+	}
+	c.deviceMutex.Lock()
+	defer c.deviceMutex.Unlock()
+	if c.cam == nil {
+		return nil, errNotOpened
+	}
 	featureName := visitor.FeatureName
 	switch featureName {
 	case Framerate:
-		return Cam.GetFramerate()
+		return c.cam.GetFramerate()
 	case Input:
-		return Cam.GetInput()
+		return c.cam.GetInput()
 	case BusInfo:
-		return Cam.GetBusInfo()
-	case Gain, Contrast, Saturation, WhiteBalanceTemperature,
-		WhiteBalanceTemperatureAuto, Sharpness, PowerLineFrequency, ExposureAuto, ExposureAbsolute, Brightness:
-		controls := Cam.GetControls()
-		return GetControl(controls, featureName)
-	case ImageTrigger:
-		return GetImage(c.Width, c.Height, c.Format)
-	}
-	return nil, nil
+		return c.cam.GetBusInfo()
+	case Width:
+		return c.width, nil
+	case Height:
+		return c.height, nil
+	case PixelFormat:
+		return fourcc(c.format), nil
+	case Capabilities:
+		data, err := json.Marshal(c.capabilities)
+		if err != nil {
+			return nil, err
+		}
+		return string(data), nil
+	}
+	if _, ok := c.capabilities.control(featureName); ok {
+		return GetControl(c.cam, featureName)
+	}
+	return nil, fmt.Errorf("feature %s is not supported by the camera", featureName)
 }
 
 func (c *CustomizedClient) SetDeviceData(data interface{}, visitor *VisitorConfig) error {
-	// TODO: set device's data
-	// you can use c.ProtocolConfig and visitor
+	c.deviceMutex.Lock()
+	defer c.deviceMutex.Unlock()
+	if c.cam == nil {
+		return errNotOpened
+	}
 	featureName := visitor.FeatureName
 	switch featureName {
 	case Framerate:
-		return Cam.SetFramerate(float32(data.(float64)))
+		return c.cam.SetFramerate(float32(data.(float64)))
 	case BufferCount:
-		return Cam.SetBufferCount(uint32(data.(uint64)))
-	case Gain, Contrast, Saturation,
-		WhiteBalanceTemperatureAuto, Sharpness, PowerLineFrequency, ExposureAuto, Brightness:
-		controls := Cam.GetControls()
-		return SetControl(controls, featureName, data)
-		//case Width:
-		//	_, err := GetOrSetSize(data.(int), Width)
-		//	return err
-		//case Height:
-		//	_, err := GetOrSetSize(data.(int), Height)
-		//	return err
+		return c.cam.SetBufferCount(uint32(data.(uint64)))
+	case Width, Height:
+		size, err := toInt64(data)
+		if err != nil {
+			return err
+		}
+		return c.setFrameSize(featureName, size)
+	case PixelFormat:
+		format, err := parsePixelFormat(data)
+		if err != nil {
+			return err
+		}
+		return c.setPixelFormat(format)
+	case Input, BusInfo, Capabilities, ImageTrigger:
+		return fmt.Errorf("feature %s is read only", featureName)
 	}
-	return nil
+	control, ok := c.capabilities.control(featureName)
+	if !ok {
+		return fmt.Errorf("feature %s is not supported by the camera", featureName)
+	}
+	return SetControl(c.cam, control, data)
+}
+
+// Capabilities get the formats, frame sizes and controls discovered when the camera was opened
+func (c *CustomizedClient) Capabilities() (CameraCapabilities, error) {
+	c.deviceMutex.Lock()
+	defer c.deviceMutex.Unlock()
+	if c.cam == nil {
+		return CameraCapabilities{}, errNotOpened
+	}
+	return c.capabilities, nil
 }
 
 func (c *CustomizedClient) StopDevice() error {
-	// TODO: stop device
-	// you can use c.ProtocolConfig
-	err := Cam.Close()
+	c.deviceMutex.Lock()
+	defer c.deviceMutex.Unlock()
+	return c.closeCamera()
+}
+
+// closeCamera close the camera if it is opened and release its device, the caller holds deviceMutex
+func (c *CustomizedClient) closeCamera() error {
+	if c.cam == nil {
+		return nil
+	}
+	err := c.cam.Close()
+	releaseDevice(c.devicePath, c)
+	c.cam, c.devicePath, c.streaming = nil, "", false
+	return err
+}
+
+// setFrameSize set the width or the height of the frames. The other dimension is kept if the camera
+// supports the new size, otherwise it is the closest supported one. The caller holds deviceMutex.
+func (c *CustomizedClient) setFrameSize(featureName string, size int64) error {
+	if size <= 0 || size > math.MaxUint32 {
+		return fmt.Errorf("invalid %s %d", featureName, size)
+	}
+	width, height := c.width, c.height
+	if featureName == Width {
+		width = uint32(size)
+	} else {
+		height = uint32(size)
+	}
+	if width == c.width && height == c.height {
+		return nil
+	}
+
+	sizes := c.capabilities.frameSizes(c.format)
+	if len(sizes) > 0 {
+		var best int64
+		found := false
+		for _, s := range sizes {
+			w, h := width, height
+			if featureName == Width {
+				if !sizeFits(width, s.MinWidth, s.MaxWidth, s.StepWidth) {
+					continue
+				}
+				h = fitSize(height, s.MinHeight, s.MaxHeight, s.StepHeight)
+			} else {
+				if !sizeFits(height, s.MinHeight, s.MaxHeight, s.StepHeight) {
+					continue
+				}
+				w = fitSize(width, s.MinWidth, s.MaxWidth, s.StepWidth)
+			}
+			distance := abs(int64(w)-int64(width)) + abs(int64(h)-int64(height))
+			if !found || distance < best {
+				found, best = true, distance
+				width, height = w, h
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s %d is not supported by the camera in pixel format %s", featureName, size, fourcc(c.format))
+		}
+	}
+	return c.applyImageFormat(c.format, width, height)
+}
+
+// setPixelFormat set the pixel format of the frames with the supported frame size closest to the
+// current one, the caller holds deviceMutex
+func (c *CustomizedClient) setPixelFormat(format webcam.PixelFormat) error {
+	if format == c.format {
+		return nil
+	}
+	sizes := c.capabilities.frameSizes(format)
+	if sizes == nil {
+		return fmt.Errorf("pixel format %s is not supported by the camera", fourcc(format))
+	}
+	width, height, found := closestSize(sizes, c.width, c.height)
+	if !found {
+		width, height = c.width, c.height
+	}
+	return c.applyImageFormat(format, width, height)
+}
+
+// applyImageFormat set the image format of the camera. The format can not be changed while the camera
+// streams, so it is opened again and streams the new format from the next image. The caller holds
+// deviceMutex.
+func (c *CustomizedClient) applyImageFormat(format webcam.PixelFormat, width uint32, height uint32) error {
+	if c.streaming {
+		if err := c.reopenCamera(); err != nil {
+			return err
+		}
+	}
+	format, width, height, err := c.cam.SetImageFormat(format, width, height)
 	if err != nil {
-		return err
+		return fmt.Errorf("set the image format of the camera %s failed with err: %v", c.devicePath, err)
+	}
+	c.format, c.width, c.height = format, width, height
+	c.capabilities.Format, c.capabilities.Width, c.capabilities.Height = fourcc(format), width, height
+	// the camera is opened with the new format when the device reconnects
+	c.Format, c.Width, c.Height = int(format), int(width), int(height)
+	klog.V(2).Infof("Set the image format of the camera %s to %s %dx%d", c.devicePath, fourcc(format), width, height)
+	return nil
+}
+
+// reopenCamera stop streaming by closing the camera and opening it again, keeping its device claimed.
+// The camera is closed if it can not be opened again. The caller holds deviceMutex.
+func (c *CustomizedClient) reopenCamera() error {
+	if err := c.cam.Close(); err != nil {
+		klog.Warningf("Close the camera %s failed with err: %v", c.devicePath, err)
+	}
+	c.streaming = false
+	cam, err := openCamera(c.devicePath)
+	if err != nil {
+		path := c.devicePath
+		releaseDevice(path, c)
+		c.cam, c.devicePath = nil, ""
+		return fmt.Errorf("open the camera %s again failed with err: %v", path, err)
 	}
+	c.cam = cam
 	return nil
 }
@@ -0,0 +1,333 @@
+package driver
+
+import (
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/blackjack/webcam"
+)
+
+// fakeCamera is a camera that returns the same frame, in memory
+type fakeCamera struct {
+	formats map[webcam.PixelFormat]string
+	sizes   []webcam.FrameSize
+	frame   []byte
+
+	// controls reported by QueryControls, which fails if queryErr is set
+	controls []ControlCapability
+	queryErr error
+	values   map[webcam.ControlID]int32
+
+	format        webcam.PixelFormat
+	width, height uint32
+	streaming     bool
+	closed        bool
+	opens         int
+
+	// WaitForFrame blocks until wait is closed, if it is set
+	wait chan struct{}
+}
+
+func newFakeCamera(frame string) *fakeCamera {
+	return &fakeCamera{
+		formats: map[webcam.PixelFormat]string{PixelFormatYUYV: "YUYV 4:2:2", PixelFormatMJPEG: "Motion-JPEG"},
+		sizes: []webcam.FrameSize{
+			{MinWidth: 640, MaxWidth: 640, MinHeight: 480, MaxHeight: 480},
+			{MinWidth: 1280, MaxWidth: 1280, MinHeight: 720, MaxHeight: 720},
+		},
+		frame: []byte(frame),
+		controls: []ControlCapability{
+			{ID: 2, Name: PowerLineFrequency, Type: ControlTypeMenu, Max: 2, Step: 1, Default: 1,
+				Menu: []MenuItem{{Index: 0, Name: "Disabled"}, {Index: 1, Name: "50 Hz"}, {Index: 2, Name: "60 Hz"}}},
+			{ID: 1, Name: Brightness, Type: ControlTypeInteger, Max: 255, Step: 1, Default: 128},
+			{ID: 3, Name: WhiteBalanceTemperature, Type: ControlTypeInteger, Min: 2800, Max: 6500, Step: 10, Default: 4600, Inactive: true},
+		},
+		values: map[webcam.ControlID]int32{1: 128, 2: 1, 3: 4600},
+	}
+}
+
+func (f *fakeCamera) GetSupportedFormats() map[webcam.PixelFormat]string { return f.formats }
+func (f *fakeCamera) GetSupportedFrameSizes(webcam.PixelFormat) []webcam.FrameSize {
+	return f.sizes
+}
+func (f *fakeCamera) SetImageFormat(format webcam.PixelFormat, width, height uint32) (webcam.PixelFormat, uint32, uint32, error) {
+	if f.streaming {
+		return 0, 0, 0, errors.New("device or resource busy")
+	}
+	f.format, f.width, f.height = format, width, height
+	return format, width, height, nil
+}
+func (f *fakeCamera) SetBufferCount(uint32) error { return nil }
+func (f *fakeCamera) GetControls() map[webcam.ControlID]webcam.Control {
+	controls := make(map[webcam.ControlID]webcam.Control)
+	for _, control := range f.controls {
+		controls[webcam.ControlID(control.ID)] = webcam.Control{Name: control.Name, Min: control.Min, Max: control.Max, Step: control.Step}
+	}
+	return controls
+}
+func (f *fakeCamera) QueryControls() ([]ControlCapability, error) {
+	if f.queryErr != nil {
+		return nil, f.queryErr
+	}
+	return append([]ControlCapability(nil), f.controls...), nil
+}
+func (f *fakeCamera) GetControl(id webcam.ControlID) (int32, error) { return f.values[id], nil }
+func (f *fakeCamera) SetControl(id webcam.ControlID, value int32) error {
+	f.values[id] = value
+	return nil
+}
+func (f *fakeCamera) GetFramerate() (float32, error) { return 30, nil }
+func (f *fakeCamera) SetFramerate(float32) error     { return nil }
+func (f *fakeCamera) GetInput() (int32, error)       { return 0, nil }
+func (f *fakeCamera) GetBusInfo() (string, error)    { return "usb-0000:00:14.0-1", nil }
+func (f *fakeCamera) StartStreaming() error {
+	if f.streaming {
+		return errors.New("Already streaming")
+	}
+	f.streaming = true
+	return nil
+}
+func (f *fakeCamera) WaitForFrame(uint32) error {
+	if f.wait != nil {
+		<-f.wait
+		return nil
+	}
+	// about the frame rate of a camera
+	time.Sleep(time.Millisecond)
+	return nil
+}
+func (f *fakeCamera) ReadFrame() ([]byte, error) {
+	if !f.streaming {
+		return nil, errors.New("not streaming")
+	}
+	return f.frame, nil
+}
+func (f *fakeCamera) Close() error {
+	f.closed = true
+	return nil
+}
+
+// fakeDevices opens fake cameras for video device files in a temporary directory
+func fakeDevices(t *testing.T, names ...string) (string, map[string]*fakeCamera) {
+	dir := t.TempDir()
+	cameras := make(map[string]*fakeCamera)
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+		cameras[path] = newFakeCamera(name)
+	}
+	original := openCamera
+	openCamera = func(path string) (Camera, error) {
+		cam, ok := cameras[path]
+		if !ok {
+			return nil, os.ErrNotExist
+		}
+		// a camera is opened again after it is closed
+		cam.closed, cam.streaming = false, false
+		cam.opens++
+		return cam, nil
+	}
+	t.Cleanup(func() { openCamera = original })
+	return dir, cameras
+}
+
+func newTestClient(t *testing.T, config ConfigData) *CustomizedClient {
+	client, err := NewClient(ProtocolConfig{ConfigData: config})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.StopDevice() })
+	return client
+}
+
+func TestMultipleCameras(t *testing.T) {
+	dir, cameras := fakeDevices(t, "video0", "video2")
+	video0, video2 := filepath.Join(dir, "video0"), filepath.Join(dir, "video2")
+	first := newTestClient(t, ConfigData{SerialPort: video0, Width: 640, Height: 480, Format: int(PixelFormatYUYV), ProtocolID: 0})
+	second := newTestClient(t, ConfigData{SerialPort: video2, Width: 1920, Height: 1080, Format: int(PixelFormatMJPEG), ProtocolID: 1})
+	for _, client := range []*CustomizedClient{first, second} {
+		if err := client.InitDevice(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for client, want := range map[*CustomizedClient]string{first: "video0", second: "video2"} {
+		image, err := client.GetDeviceData(&VisitorConfig{VisitorConfigData: VisitorConfigData{FeatureName: ImageTrigger}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the second frame is read from the same stream
+		if _, err = client.GetDeviceData(&VisitorConfig{VisitorConfigData: VisitorConfigData{FeatureName: ImageTrigger}}); err != nil {
+			t.Fatal(err)
+		}
+		if image != base64.StdEncoding.EncodeToString([]byte(want)) {
+			t.Errorf("image of %s = %s", want, image)
+		}
+	}
+	if cam := cameras[video0]; cam.format != PixelFormatYUYV || cam.width != 640 || cam.height != 480 {
+		t.Errorf("video0 format = %s %dx%d, want YUYV 640x480", fourcc(cam.format), cam.width, cam.height)
+	}
+	if cam := cameras[video2]; cam.format != PixelFormatMJPEG || cam.width != 1280 || cam.height != 720 {
+		t.Errorf("video2 format = %s %dx%d, want MJPG 1280x720", fourcc(cam.format), cam.width, cam.height)
+	}
+
+	// controls are set on the camera of the device only
+	if err := first.SetDeviceData(int64(200), &VisitorConfig{VisitorConfigData: VisitorConfigData{FeatureName: Brightness}}); err != nil {
+		t.Fatal(err)
+	}
+	if cameras[video0].values[1] != 200 || cameras[video2].values[1] != 128 {
+		t.Errorf("brightness = %d and %d, want 200 and 128", cameras[video0].values[1], cameras[video2].values[1])
+	}
+
+	if err := first.StopDevice(); err != nil {
+		t.Fatal(err)
+	}
+	if !cameras[video0].closed || cameras[video2].closed {
+		t.Error("stopping a device closed another camera")
+	}
+	if _, err := first.GetDeviceData(&VisitorConfig{VisitorConfigData: VisitorConfigData{FeatureName: Framerate}}); !errors.Is(err, errNotOpened) {
+		t.Errorf("GetDeviceData() of a stopped device error = %v", err)
+	}
+}
+
+func TestCameraOpenedOnce(t *testing.T) {
+	dir, cameras := fakeDevices(t, "video0")
+	video0 := filepath.Join(dir, "video0")
+	link := filepath.Join(dir, "usb-046d_HD_Pro_Webcam_C920_ABCD1234-video-index0")
+	if err := os.Symlink(video0, link); err != nil {
+		t.Fatal(err)
+	}
+	first := newTestClient(t, ConfigData{SerialPort: video0})
+	second := newTestClient(t, ConfigData{SerialPort: link, ProtocolID: 1})
+	if err := first.InitDevice(); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.InitDevice(); err == nil {
+		t.Fatal("the camera is opened by two devices")
+	}
+
+	// reconnecting opens the camera again
+	if err := first.InitDevice(); err != nil {
+		t.Fatal(err)
+	}
+	if err := first.StopDevice(); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.InitDevice(); err != nil {
+		t.Fatalf("InitDevice() after the camera is released error = %v", err)
+	}
+	// no size is configured, the largest one is used
+	if cam := cameras[video0]; cam.width != 1280 || cam.height != 720 {
+		t.Errorf("frame size = %dx%d, want 1280x720", cam.width, cam.height)
+	}
+}
+
+func TestResolveDevicePath(t *testing.T) {
+	dir, _ := fakeDevices(t, "video0", "video1", "video2")
+	byID := t.TempDir()
+	for name, target := range map[string]string{
+		"usb-046d_HD_Pro_Webcam_C920_ABCD1234-video-index0": "video0",
+		"usb-046d_HD_Pro_Webcam_C920_ABCD1234-video-index1": "video1",
+		"usb-0c45_USB_Camera_SN0001-video-index0":           "video2",
+		"usb-0c45_USB_Camera_SN0001-copy-video-index0":      "video2",
+	} {
+		if err := os.Symlink(filepath.Join(dir, target), filepath.Join(byID, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	original := v4lByIDDir
+	v4lByIDDir = byID
+	t.Cleanup(func() { v4lByIDDir = original })
+
+	tests := []struct {
+		serialPort   string
+		serialNumber string
+		want         string
+	}{
+		{serialNumber: "ABCD1234", want: filepath.Join(dir, "video0")},
+		{serialPort: filepath.Join(byID, "usb-0c45_USB_Camera_SN0001-video-index0"), want: filepath.Join(dir, "video2")},
+		{serialPort: filepath.Join(dir, "video1"), want: filepath.Join(dir, "video1")},
+		{serialNumber: "SN0001", want: filepath.Join(dir, "video2")},
+		{serialNumber: "MISSING"},
+		{serialPort: filepath.Join(dir, "video9")},
+		{},
+	}
+	for _, tt := range tests {
+		got, err := resolveDevicePath(tt.serialPort, tt.serialNumber)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("resolveDevicePath(%q, %q) = %s, want an error", tt.serialPort, tt.serialNumber, got)
+			}
+			continue
+		}
+		want, _ := filepath.EvalSymlinks(tt.want)
+		if err != nil || got != want {
+			t.Errorf("resolveDevicePath(%q, %q) = %s, %v, want %s", tt.serialPort, tt.serialNumber, got, err, want)
+		}
+	}
+}
+
+func TestNegotiateFormat(t *testing.T) {
+	tests := []struct {
+		name          string
+		formats       []webcam.PixelFormat
+		sizes         []webcam.FrameSize
+		format        webcam.PixelFormat
+		width, height uint32
+		wantFormat    webcam.PixelFormat
+		wantW, wantH  uint32
+	}{
+		{
+			name:    "unsupported format falls back to Motion-JPEG",
+			formats: []webcam.PixelFormat{PixelFormatYUYV, PixelFormatMJPEG},
+			sizes:   []webcam.FrameSize{{MinWidth: 640, MaxWidth: 640, MinHeight: 480, MaxHeight: 480}},
+			format:  0x34363248, width: 640, height: 480,
+			wantFormat: PixelFormatMJPEG, wantW: 640, wantH: 480,
+		},
+		{
+			name:    "closest discrete size",
+			formats: []webcam.PixelFormat{PixelFormatYUYV},
+			sizes: []webcam.FrameSize{
+				{MinWidth: 320, MaxWidth: 320, MinHeight: 240, MaxHeight: 240},
+				{MinWidth: 800, MaxWidth: 800, MinHeight: 600, MaxHeight: 600},
+				{MinWidth: 1920, MaxWidth: 1920, MinHeight: 1080, MaxHeight: 1080},
+			},
+			format: PixelFormatYUYV, width: 1024, height: 768,
+			wantFormat: PixelFormatYUYV, wantW: 800, wantH: 600,
+		},
+		{
+			name:    "stepwise size",
+			formats: []webcam.PixelFormat{PixelFormatYUYV},
+			sizes: []webcam.FrameSize{
+				{MinWidth: 160, MaxWidth: 1280, StepWidth: 16, MinHeight: 120, MaxHeight: 720, StepHeight: 8},
+			},
+			format: PixelFormatYUYV, width: 1000, height: 2000,
+			wantFormat: PixelFormatYUYV, wantW: 1008, wantH: 720,
+		},
+		{
+			name:    "sizes not enumerated",
+			formats: []webcam.PixelFormat{PixelFormatYUYV},
+			format:  PixelFormatYUYV, width: 640, height: 360,
+			wantFormat: PixelFormatYUYV, wantW: 640, wantH: 360,
+		},
+	}
+	for _, tt := range tests {
+		cam := newFakeCamera("")
+		cam.formats = make(map[webcam.PixelFormat]string)
+		for _, format := range tt.formats {
+			cam.formats[format] = fourcc(format)
+		}
+		cam.sizes = tt.sizes
+		format, width, height, err := negotiateFormat(cam, tt.format, tt.width, tt.height)
+		if err != nil || format != tt.wantFormat || width != tt.wantW || height != tt.wantH {
+			t.Errorf("%s: negotiateFormat() = %s %dx%d, %v, want %s %dx%d", tt.name, fourcc(format), width, height, err,
+				fourcc(tt.wantFormat), tt.wantW, tt.wantH)
+		}
+	}
+}
@@ -1,29 +1,29 @@
 package driver
 
 import (
+	"context"
 	"encoding/base64"
 	"fmt"
+
 	"github.com/blackjack/webcam"
 )
 
-func SetControl(controls map[webcam.ControlID]webcam.Control, featureName string, data interface{}) error {
-	for controlID, control := range controls {
-		if control.Name == featureName {
-			err := Cam.SetControl(controlID, int32(data.(int64)))
-			if err != nil {
-				return err
-			}
-			return nil
-		}
+// SetControl set the control after validating the value against its discovered range
+func SetControl(cam Camera, control ControlCapability, data interface{}) error {
+	value, err := toInt64(data)
+	if err != nil {
+		return fmt.Errorf("set control %s: %v", control.Name, err)
 	}
-	err := fmt.Errorf("set control:%s not found the parament", featureName)
-	return err
+	if err = control.validate(value); err != nil {
+		return err
+	}
+	return cam.SetControl(webcam.ControlID(control.ID), int32(value))
 }
 
-func GetControl(controls map[webcam.ControlID]webcam.Control, featureName string) (int32, error) {
-	for controlID, control := range controls {
+func GetControl(cam Camera, featureName string) (int32, error) {
+	for controlID, control := range cam.GetControls() {
 		if control.Name == featureName {
-			value, err := Cam.GetControl(controlID)
+			value, err := cam.GetControl(controlID)
 			if err != nil {
 				return -1, err
 			}
@@ -34,27 +34,12 @@ func GetControl(controls map[webcam.ControlID]webcam.Control, featureName string
 	return -1, err
 }
 
-var format webcam.PixelFormat = 0
-
-func GetImage(width, height, pixelFormat int) (string, error) {
-	// 读取摄像头的参数
-	if format == 0 {
-		format_ := webcam.PixelFormat(pixelFormat)
-		if result, _, _, err := Cam.SetImageFormat(format_, uint32(width), uint32(height)); err != nil {
-			return "", fmt.Errorf("error setting format:%v", err)
-		} else {
-			format = result
-		}
-	}
-	if err := Cam.StartStreaming(); err != nil {
-		if err.Error() != "Already streaming" {
-			return "", fmt.Errorf("error starting streaming:%v", err)
-		}
-	}
-	frame, err := Cam.ReadFrame()
+// getImage get the latest frame of the capture loop in the negotiated format
+func (c *CustomizedClient) getImage() (string, error) {
+	frame, err := c.NextFrame(context.Background(), 0)
 	if err != nil {
-		return "", fmt.Errorf("error reading frame:%v", err)
+		return "", err
 	}
-	result := base64.StdEncoding.EncodeToString(frame)
+	result := base64.StdEncoding.EncodeToString(frame.Data)
 	return result, nil
 }
@@ -1,6 +1,9 @@
 package global
 
 import (
+	"context"
+	"time"
+
 	"github.com/kubeedge/usb/pkg/common"
 	"github.com/kubeedge/usb/pkg/config"
 )
@@ -29,6 +32,16 @@ type DevPanel interface {
 	RemoveModel(modelName string)
 	// GetTwinResult get device's property value and datatype
 	GetTwinResult(deviceID string, twinName string) (string, string, error)
+	// GetDeviceState get device's lifecycle state and the reason of its last transition
+	GetDeviceState(deviceID string) (string, string, error)
+	// GetCapabilities get the pixel formats, frame sizes and controls of device's camera
+	GetCapabilities(deviceID string) (interface{}, error)
+	// GetFrame get the latest JPEG frame of device's camera if after is 0, otherwise the next frame
+	// after the frame with sequence after, waiting for it until ctx is done
+	GetFrame(ctx context.Context, deviceID string, after uint64) (*Frame, error)
+	// GetDataBaseClients get initialized database clients of device's properties that are saved to a database,
+	// by property name. The caller closes their sessions.
+	GetDataBaseClients(deviceID string) (map[string]DataBaseClient, error)
 }
 
 // DataPanel defined push method, parse the push operation in CRD and execute it
@@ -41,14 +54,15 @@ type DataPanel interface {
 	Push(data *common.DataModel)
 }
 
-// DataBaseClient defined database interface, save data and provide data to REST API
+// DataBaseClient defined database interface, save data and provide data to REST API.
+// A client saves the data of one device property, timestamps are in milliseconds.
 type DataBaseClient interface {
 	// TODO add more interface
 
 	InitDbClient() error
 	CloseSession()
 
-	AddData(data *common.DataModel)
+	AddData(data *common.DataModel) error
 
 	GetDataByDeviceName(deviceName string) ([]*common.DataModel, error)
 	GetPropertyDataByDeviceName(deviceName string, propertyData string) ([]*common.DataModel, error)
@@ -56,3 +70,27 @@ type DataBaseClient interface {
 
 	DeleteDataByTimeRange(start int64, end int64) ([]*common.DataModel, error)
 }
+
+// HistoryQuery a query of the saved data of a property between Start and End, in milliseconds, of at most
+// Limit data. If Aggregate is set, it is avg, min or max of the numeric values in each Interval milliseconds.
+type HistoryQuery struct {
+	Start     int64
+	End       int64
+	Limit     int
+	Aggregate string
+	Interval  int64
+}
+
+// DataBaseQuerier is implemented by database clients that limit and aggregate the saved data in the database,
+// instead of returning all the data of the time range
+type DataBaseQuerier interface {
+	// QueryData get the data of the query, oldest first, and the number of data the query matches in total
+	QueryData(query *HistoryQuery) ([]*common.DataModel, int, error)
+}
+
+// Frame a JPEG image of a camera
+type Frame struct {
+	Data      []byte
+	Timestamp time.Time
+	Sequence  uint64
+}
@@ -4,9 +4,14 @@ import (
 	"fmt"
 	"net/http"
 	"reflect"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
 
 	"github.com/kubeedge/usb/pkg/common"
+	"github.com/kubeedge/usb/pkg/global"
 )
 
 func (rs *RestServer) Ping(writer http.ResponseWriter, request *http.Request) {
@@ -38,6 +43,75 @@ func (rs *RestServer) DeviceRead(writer http.ResponseWriter, request *http.Reque
 	}
 }
 
+func (rs *RestServer) DeviceState(writer http.ResponseWriter, request *http.Request) {
+	urlItem := strings.Split(request.URL.Path, "/")
+	deviceName := urlItem[len(urlItem)-1]
+	state, reason, err := rs.devPanel.GetDeviceState(deviceName)
+	if err != nil {
+		http.Error(writer, fmt.Sprintf("Get device state error: %v", err), http.StatusNotFound)
+		return
+	}
+	response := &DeviceStateResponse{
+		BaseResponse: NewBaseResponse(http.StatusOK),
+		DeviceName:   deviceName,
+		State:        state,
+		Reason:       reason,
+	}
+	rs.sendResponse(writer, request, response, http.StatusOK)
+}
+
+func (rs *RestServer) DeviceCapabilities(writer http.ResponseWriter, request *http.Request) {
+	urlItem := strings.Split(request.URL.Path, "/")
+	deviceName := urlItem[len(urlItem)-1]
+	capabilities, err := rs.devPanel.GetCapabilities(deviceName)
+	if err != nil {
+		http.Error(writer, fmt.Sprintf("Get device capabilities error: %v", err), http.StatusNotFound)
+		return
+	}
+	response := &DeviceCapabilitiesResponse{
+		BaseResponse: NewBaseResponse(http.StatusOK),
+		DeviceName:   deviceName,
+		Capabilities: capabilities,
+	}
+	rs.sendResponse(writer, request, response, http.StatusOK)
+}
+
+func (rs *RestServer) DeviceSnapshot(writer http.ResponseWriter, request *http.Request) {
+	urlItem := strings.Split(request.URL.Path, "/")
+	deviceName := urlItem[len(urlItem)-1]
+	if _, _, err := rs.devPanel.GetDeviceState(deviceName); err != nil {
+		http.Error(writer, fmt.Sprintf("Get device snapshot error: %v", err), http.StatusNotFound)
+		return
+	}
+	frame, err := rs.devPanel.GetFrame(request.Context(), deviceName, 0)
+	if err != nil {
+		http.Error(writer, fmt.Sprintf("Get device snapshot error: %v", err), http.StatusServiceUnavailable)
+		return
+	}
+	writeSnapshot(writer, request, frame)
+}
+
+func (rs *RestServer) DeviceStream(writer http.ResponseWriter, request *http.Request) {
+	urlItem := strings.Split(request.URL.Path, "/")
+	deviceName := urlItem[len(urlItem)-1]
+	interval, err := parseFrameInterval(request.URL.Query())
+	if err != nil {
+		http.Error(writer, fmt.Sprintf("Stream device frames error: %v", err), http.StatusBadRequest)
+		return
+	}
+	if _, _, err = rs.devPanel.GetDeviceState(deviceName); err != nil {
+		http.Error(writer, fmt.Sprintf("Stream device frames error: %v", err), http.StatusNotFound)
+		return
+	}
+	// the first frame is read before the response is written, so that failures are reported
+	first, err := rs.devPanel.GetFrame(request.Context(), deviceName, 0)
+	if err != nil {
+		http.Error(writer, fmt.Sprintf("Stream device frames error: %v", err), http.StatusServiceUnavailable)
+		return
+	}
+	rs.streamMJPEG(writer, request, deviceName, first, interval)
+}
+
 func (rs *RestServer) MetaGetModel(writer http.ResponseWriter, request *http.Request) {
 	urlItem := strings.Split(request.URL.Path, "/")
 	deviceName := urlItem[len(urlItem)-1]
@@ -73,14 +147,105 @@ func (rs *RestServer) MetaGetModel(writer http.ResponseWriter, request *http.Req
 
 }
 
+// DataBaseGetDataByID get the saved data of device's properties, or of one property, see parseHistoryQuery
 func (rs *RestServer) DataBaseGetDataByID(writer http.ResponseWriter, request *http.Request) {
-	if rs.databaseClient == nil {
-		http.Error(writer, "The database is not enabled. Please configure mapper and try again", http.StatusServiceUnavailable)
+	query, err := parseHistoryQuery(request.URL.Query(), time.Now())
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+	clients, status, err := rs.dataBaseClients(request)
+	if err != nil {
+		http.Error(writer, err.Error(), status)
+		return
+	}
+	defer closeDataBaseClients(clients)
+
+	var data []common.DataModel
+	total := 0
+	for propertyName, client := range clients {
+		res, count, err := queryData(client, query, mux.Vars(request)["id"], propertyName)
+		if err != nil {
+			http.Error(writer, fmt.Sprintf("Get %s data error: %v", propertyName, err), http.StatusInternalServerError)
+			return
+		}
+		data = append(data, res...)
+		total += count
+	}
+	sortData(data)
+	data = page(data, query.Offset, query.Limit)
+
+	if query.Format == formatCSV {
+		writer.Header().Set(TotalCountHeader, strconv.Itoa(total))
+		writeCSV(writer, request, data)
 		return
 	}
 	response := &DataBaseResponse{
 		BaseResponse: NewBaseResponse(http.StatusOK),
-		Data:         nil,
+		Data:         data,
+		Total:        total,
+		Offset:       query.Offset,
+		Limit:        query.Limit,
+	}
+	rs.sendResponse(writer, request, response, http.StatusOK)
+}
+
+// DataBaseDeleteData delete the saved data of device's properties, or of one property, in a time range.
+// The end is required, either directly or as a retain duration before now.
+func (rs *RestServer) DataBaseDeleteData(writer http.ResponseWriter, request *http.Request) {
+	start, end, err := parseRetention(request.URL.Query(), time.Now())
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+	clients, status, err := rs.dataBaseClients(request)
+	if err != nil {
+		http.Error(writer, err.Error(), status)
+		return
+	}
+	defer closeDataBaseClients(clients)
+
+	deleted := 0
+	for propertyName, client := range clients {
+		res, err := client.DeleteDataByTimeRange(start, end)
+		if err != nil {
+			http.Error(writer, fmt.Sprintf("Delete %s data error: %v", propertyName, err), http.StatusInternalServerError)
+			return
+		}
+		deleted += len(res)
+	}
+	response := &DataBaseDeleteResponse{
+		BaseResponse: NewBaseResponse(http.StatusOK),
+		Deleted:      deleted,
 	}
 	rs.sendResponse(writer, request, response, http.StatusOK)
 }
+
+// dataBaseClients get the database clients of the properties of the request, with the status code of an error
+func (rs *RestServer) dataBaseClients(request *http.Request) (map[string]global.DataBaseClient, int, error) {
+	vars := mux.Vars(request)
+	deviceID, propertyName := vars["id"], vars["property"]
+	clients, err := rs.devPanel.GetDataBaseClients(deviceID)
+	if err != nil {
+		return nil, http.StatusNotFound, fmt.Errorf("Get database clients error: %v", err)
+	}
+	if propertyName == "" {
+		if len(clients) == 0 {
+			return nil, http.StatusNotFound, fmt.Errorf("device %s saves no property to a database", deviceID)
+		}
+		return clients, http.StatusOK, nil
+	}
+	client, ok := clients[propertyName]
+	delete(clients, propertyName)
+	closeDataBaseClients(clients)
+	if !ok {
+		return nil, http.StatusNotFound, fmt.Errorf("property %s of device %s is not saved to a database", propertyName, deviceID)
+	}
+	return map[string]global.DataBaseClient{propertyName: client}, http.StatusOK, nil
+}
+
+func closeDataBaseClients(clients map[string]global.DataBaseClient) {
+	for _, client := range clients {
+		client.CloseSession()
+	}
+}
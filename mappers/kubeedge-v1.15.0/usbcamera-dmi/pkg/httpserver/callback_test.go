@@ -0,0 +1,107 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestDeviceCapabilities(t *testing.T) {
+	rs, _ := newTestServer()
+	recorder := serve(rs, http.MethodGet, "/api/v1/device/capabilities/camera")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("code = %d (%s)", recorder.Code, recorder.Body)
+	}
+	var response struct {
+		DeviceName   string `json:"deviceName"`
+		Capabilities struct {
+			Format string `json:"format"`
+			Width  int    `json:"width"`
+		} `json:"capabilities"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.DeviceName != "camera" || response.Capabilities.Format != "YUYV" || response.Capabilities.Width != 640 {
+		t.Errorf("response = %s", recorder.Body)
+	}
+
+	if recorder = serve(rs, http.MethodGet, "/api/v1/device/capabilities/missing"); recorder.Code != http.StatusNotFound {
+		t.Errorf("code of a missing device = %d, want %d", recorder.Code, http.StatusNotFound)
+	}
+}
+
+func TestDeviceSnapshot(t *testing.T) {
+	rs, _ := newTestServer()
+	recorder := serve(rs, http.MethodGet, "/api/v1/device/snapshot/camera")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("code = %d (%s)", recorder.Code, recorder.Body)
+	}
+	if contentType := recorder.Header().Get(ContentType); contentType != ContentTypeJPEG {
+		t.Errorf("content type = %s", contentType)
+	}
+	if recorder.Body.String() != "jpeg 1" || recorder.Header().Get(FrameSequenceHeader) != "1" {
+		t.Errorf("snapshot = %q, sequence %s", recorder.Body, recorder.Header().Get(FrameSequenceHeader))
+	}
+	if _, err := time.Parse(time.RFC3339Nano, recorder.Header().Get(FrameTimestampHeader)); err != nil {
+		t.Errorf("invalid timestamp: %v", err)
+	}
+
+	if recorder = serve(rs, http.MethodGet, "/api/v1/device/snapshot/missing"); recorder.Code != http.StatusNotFound {
+		t.Errorf("code of a missing device = %d, want %d", recorder.Code, http.StatusNotFound)
+	}
+}
+
+func TestDeviceStream(t *testing.T) {
+	rs, _ := newTestServer()
+	server := httptest.NewServer(rs.Router)
+	defer server.Close()
+
+	response, err := http.Get(server.URL + "/api/v1/device/stream/camera?fps=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusBadRequest {
+		t.Errorf("code of an invalid fps = %d", response.StatusCode)
+	}
+
+	response, err = http.Get(server.URL + "/api/v1/device/stream/camera?fps=100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	mediaType, params, err := mime.ParseMediaType(response.Header.Get(ContentType))
+	if err != nil || mediaType != "multipart/x-mixed-replace" {
+		t.Fatalf("content type = %s, %v", response.Header.Get(ContentType), err)
+	}
+	reader := multipart.NewReader(response.Body, params["boundary"])
+	var last uint64
+	var lastTime time.Time
+	for i := 0; i < 3; i++ {
+		part, err := reader.NextPart()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sequence, _ := strconv.ParseUint(part.Header.Get(FrameSequenceHeader), 10, 64)
+		timestamp, _ := time.Parse(time.RFC3339Nano, part.Header.Get(FrameTimestampHeader))
+		if part.Header.Get(ContentType) != ContentTypeJPEG || string(data) != "jpeg "+strconv.FormatUint(sequence, 10) {
+			t.Errorf("frame %d = %q, %v", i, data, part.Header)
+		}
+		// at most 100 frames per second of the 1000 of the camera
+		if i > 0 && (sequence <= last || timestamp.Sub(lastTime) < 10*time.Millisecond) {
+			t.Errorf("frame %d at %s after %s, sequence %d after %d", i, timestamp, lastTime, sequence, last)
+		}
+		last, lastTime = sequence, timestamp
+	}
+}
@@ -0,0 +1,290 @@
+package httpserver
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"github.com/kubeedge/usb/pkg/common"
+	"github.com/kubeedge/usb/pkg/global"
+)
+
+// Output formats of the saved data
+const (
+	formatJSON = "json"
+	formatCSV  = "csv"
+)
+
+// Aggregations of the saved data in each interval
+const (
+	aggregateAvg = "avg"
+	aggregateMin = "min"
+	aggregateMax = "max"
+)
+
+const (
+	defaultHistoryLimit = 1000
+	maxHistoryLimit     = 10000
+)
+
+// historyQuery a query of the saved data, times are in milliseconds
+type historyQuery struct {
+	Start     int64
+	End       int64
+	Offset    int
+	Limit     int
+	Aggregate string
+	Interval  int64
+	Format    string
+}
+
+// parseHistoryQuery parse the query parameters of the saved data:
+//   - start, end: RFC3339 times or unix timestamps in milliseconds, start is required and end is now by default
+//   - offset, limit: the page of the data, 1000 items by default and 10000 at most
+//   - aggregate, interval: avg, min or max of the numeric values in each interval such as 1m
+//   - format: json or csv
+func parseHistoryQuery(values url.Values, now time.Time) (*historyQuery, error) {
+	var err error
+	query := &historyQuery{Limit: defaultHistoryLimit, Format: formatJSON}
+	// the data is only read in a bounded time range
+	if values.Get("start") == "" {
+		return nil, errors.New("start is required")
+	}
+	if query.Start, err = parseTime(values.Get("start"), 0); err != nil {
+		return nil, fmt.Errorf("invalid start: %v", err)
+	}
+	if query.End, err = parseTime(values.Get("end"), now.UnixNano()/1e6); err != nil {
+		return nil, fmt.Errorf("invalid end: %v", err)
+	}
+	if query.End < query.Start {
+		return nil, errors.New("end is before start")
+	}
+	if v := values.Get("offset"); v != "" {
+		if query.Offset, err = strconv.Atoi(v); err != nil || query.Offset < 0 {
+			return nil, fmt.Errorf("invalid offset %q", v)
+		}
+	}
+	if v := values.Get("limit"); v != "" {
+		if query.Limit, err = strconv.Atoi(v); err != nil || query.Limit < 1 || query.Limit > maxHistoryLimit {
+			return nil, fmt.Errorf("invalid limit %q, it must be 1 to %d", v, maxHistoryLimit)
+		}
+	}
+
+	query.Aggregate = values.Get("aggregate")
+	switch query.Aggregate {
+	case "":
+		if values.Get("interval") != "" {
+			return nil, errors.New("interval requires an aggregate")
+		}
+	case aggregateAvg, aggregateMin, aggregateMax:
+		interval, err := time.ParseDuration(values.Get("interval"))
+		if err != nil || interval < time.Millisecond {
+			return nil, fmt.Errorf("invalid interval %q, it must be a duration of 1ms at least", values.Get("interval"))
+		}
+		query.Interval = int64(interval / time.Millisecond)
+	default:
+		return nil, fmt.Errorf("invalid aggregate %q, it must be %s, %s or %s", query.Aggregate, aggregateAvg, aggregateMin, aggregateMax)
+	}
+
+	if v := values.Get("format"); v != "" {
+		if v != formatJSON && v != formatCSV {
+			return nil, fmt.Errorf("invalid format %q, it must be %s or %s", v, formatJSON, formatCSV)
+		}
+		query.Format = v
+	}
+	return query, nil
+}
+
+// parseRetention parse the time range of the data to delete, start and end like parseHistoryQuery,
+// or retain, a duration such as 720h, to delete the data older than it
+func parseRetention(values url.Values, now time.Time) (int64, int64, error) {
+	start, err := parseTime(values.Get("start"), 0)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid start: %v", err)
+	}
+	endValue, retainValue := values.Get("end"), values.Get("retain")
+	var end int64
+	switch {
+	case endValue != "" && retainValue != "":
+		return 0, 0, errors.New("end and retain are exclusive")
+	case endValue != "":
+		if end, err = parseTime(endValue, 0); err != nil {
+			return 0, 0, fmt.Errorf("invalid end: %v", err)
+		}
+	case retainValue != "":
+		retain, err := time.ParseDuration(retainValue)
+		if err != nil || retain < 0 {
+			return 0, 0, fmt.Errorf("invalid retain %q", retainValue)
+		}
+		end = now.Add(-retain).UnixNano() / 1e6
+	default:
+		return 0, 0, errors.New("end or retain is required")
+	}
+	if end < start {
+		return 0, 0, errors.New("end is before start")
+	}
+	return start, end, nil
+}
+
+// parseTime parse an RFC3339 time or a unix timestamp in milliseconds
+func parseTime(value string, defaultValue int64) (int64, error) {
+	if value == "" {
+		return defaultValue, nil
+	}
+	if ms, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return ms, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return 0, err
+	}
+	return t.UnixNano() / 1e6, nil
+}
+
+// queryData get the data of a property's database client for the query, at most offset+limit of them, and
+// the number of data in total. Clients that are not a global.DataBaseQuerier return all the data of the time
+// range, which is aggregated and limited here.
+func queryData(client global.DataBaseClient, query *historyQuery, deviceName string, propertyName string) ([]common.DataModel, int, error) {
+	if querier, ok := client.(global.DataBaseQuerier); ok {
+		res, total, err := querier.QueryData(&global.HistoryQuery{
+			Start:     query.Start,
+			End:       query.End,
+			Limit:     query.Offset + query.Limit,
+			Aggregate: query.Aggregate,
+			Interval:  query.Interval,
+		})
+		if err != nil {
+			return nil, 0, err
+		}
+		return withProperty(res, deviceName, propertyName), total, nil
+	}
+	res, err := client.GetDataByTimeRange(query.Start, query.End)
+	if err != nil {
+		return nil, 0, err
+	}
+	data := withProperty(res, deviceName, propertyName)
+	sortData(data)
+	if query.Aggregate != "" {
+		data = downsample(data, query.Aggregate, query.Interval)
+	}
+	return page(data, 0, query.Offset+query.Limit), len(data), nil
+}
+
+// withProperty set the device and property names of the data of a property's database client
+func withProperty(data []*common.DataModel, deviceName string, propertyName string) []common.DataModel {
+	res := make([]common.DataModel, 0, len(data))
+	for _, item := range data {
+		if item == nil {
+			continue
+		}
+		dataModel := *item
+		dataModel.DeviceName = deviceName
+		dataModel.PropertyName = propertyName
+		res = append(res, dataModel)
+	}
+	return res
+}
+
+// sortData sort data by timestamp, then by property
+func sortData(data []common.DataModel) {
+	sort.SliceStable(data, func(i, j int) bool {
+		if data[i].TimeStamp != data[j].TimeStamp {
+			return data[i].TimeStamp < data[j].TimeStamp
+		}
+		return data[i].PropertyName < data[j].PropertyName
+	})
+}
+
+// downsample aggregate the numeric values of each property in each interval, timestamped with the
+// start of the interval. Other values are skipped.
+func downsample(data []common.DataModel, aggregate string, interval int64) []common.DataModel {
+	type bucketKey struct {
+		propertyName string
+		start        int64
+	}
+	type bucket struct {
+		deviceName string
+		sum        float64
+		min        float64
+		max        float64
+		count      int
+	}
+	var keys []bucketKey
+	buckets := make(map[bucketKey]*bucket)
+	for _, item := range data {
+		value, err := strconv.ParseFloat(item.Value, 64)
+		if err != nil || math.IsNaN(value) {
+			continue
+		}
+		start := item.TimeStamp - item.TimeStamp%interval
+		if item.TimeStamp < 0 && item.TimeStamp%interval != 0 {
+			start -= interval
+		}
+		key := bucketKey{item.PropertyName, start}
+		b, ok := buckets[key]
+		if !ok {
+			b = &bucket{deviceName: item.DeviceName, min: value, max: value}
+			buckets[key] = b
+			keys = append(keys, key)
+		}
+		b.sum += value
+		b.min = math.Min(b.min, value)
+		b.max = math.Max(b.max, value)
+		b.count++
+	}
+
+	res := make([]common.DataModel, 0, len(keys))
+	for _, key := range keys {
+		b := buckets[key]
+		value := b.sum / float64(b.count)
+		switch aggregate {
+		case aggregateMin:
+			value = b.min
+		case aggregateMax:
+			value = b.max
+		}
+		res = append(res, *common.NewDataModel(b.deviceName, key.propertyName,
+			common.WithValue(strconv.FormatFloat(value, 'f', -1, 64)),
+			common.WithType("float"),
+			common.WithTimeStamp(key.start)))
+	}
+	sortData(res)
+	return res
+}
+
+func page(data []common.DataModel, offset int, limit int) []common.DataModel {
+	if offset >= len(data) {
+		return []common.DataModel{}
+	}
+	data = data[offset:]
+	if len(data) > limit {
+		data = data[:limit]
+	}
+	return data
+}
+
+// writeCSV write data as csv with a header line
+func writeCSV(writer http.ResponseWriter, request *http.Request, data []common.DataModel) {
+	correlationID := request.Header.Get(CorrelationHeader)
+	if correlationID != "" {
+		writer.Header().Set(CorrelationHeader, correlationID)
+	}
+	writer.Header().Set(ContentType, ContentTypeCSV)
+	writer.WriteHeader(http.StatusOK)
+	w := csv.NewWriter(writer)
+	records := [][]string{{"deviceName", "propertyName", "timestamp", "value", "type"}}
+	for _, item := range data {
+		records = append(records, []string{item.DeviceName, item.PropertyName, strconv.FormatInt(item.TimeStamp, 10), item.Value, item.Type})
+	}
+	if err := w.WriteAll(records); err != nil {
+		klog.Errorf("write %s response error: %v", request.URL.Path, err)
+	}
+}
@@ -0,0 +1,286 @@
+package httpserver
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/kubeedge/usb/pkg/common"
+	"github.com/kubeedge/usb/pkg/global"
+)
+
+// memoryDataBase keeps the data of a property in memory
+type memoryDataBase struct {
+	data   []*common.DataModel
+	closed *int
+}
+
+func (m *memoryDataBase) InitDbClient() error                  { return nil }
+func (m *memoryDataBase) CloseSession()                        { *m.closed++ }
+func (m *memoryDataBase) AddData(data *common.DataModel) error { return nil }
+func (m *memoryDataBase) GetDataByDeviceName(string) ([]*common.DataModel, error) {
+	return m.data, nil
+}
+func (m *memoryDataBase) GetPropertyDataByDeviceName(string, string) ([]*common.DataModel, error) {
+	return m.data, nil
+}
+func (m *memoryDataBase) GetDataByTimeRange(start int64, end int64) ([]*common.DataModel, error) {
+	var res []*common.DataModel
+	for _, item := range m.data {
+		if item.TimeStamp >= start && item.TimeStamp <= end {
+			res = append(res, item)
+		}
+	}
+	return res, nil
+}
+func (m *memoryDataBase) DeleteDataByTimeRange(start int64, end int64) ([]*common.DataModel, error) {
+	deleted, _ := m.GetDataByTimeRange(start, end)
+	var kept []*common.DataModel
+	for _, item := range m.data {
+		if item.TimeStamp < start || item.TimeStamp > end {
+			kept = append(kept, item)
+		}
+	}
+	m.data = kept
+	return deleted, nil
+}
+
+// querierDataBase answers queries itself and records them, it never returns a whole time range
+type querierDataBase struct {
+	memoryDataBase
+	queries []global.HistoryQuery
+}
+
+func (q *querierDataBase) GetDataByTimeRange(int64, int64) ([]*common.DataModel, error) {
+	return nil, errors.New("the time range is read at once")
+}
+func (q *querierDataBase) QueryData(query *global.HistoryQuery) ([]*common.DataModel, int, error) {
+	q.queries = append(q.queries, *query)
+	data, _ := q.memoryDataBase.GetDataByTimeRange(query.Start, query.End)
+	total := len(data)
+	if len(data) > query.Limit {
+		data = data[:query.Limit]
+	}
+	return data, total, nil
+}
+
+type fakePanel struct {
+	global.DevPanel
+	databases  map[string]*memoryDataBase
+	querier    *querierDataBase // replaces the brightness database if set
+	closed     int
+	frameStart time.Time
+}
+
+func (f *fakePanel) GetDataBaseClients(deviceID string) (map[string]global.DataBaseClient, error) {
+	if deviceID != "camera" {
+		return nil, errors.New("not found device " + deviceID)
+	}
+	clients := make(map[string]global.DataBaseClient)
+	for name, db := range f.databases {
+		db.closed = &f.closed
+		clients[name] = db
+	}
+	if f.querier != nil {
+		f.querier.closed = &f.closed
+		clients["brightness"] = f.querier
+	}
+	return clients, nil
+}
+
+func (f *fakePanel) GetCapabilities(deviceID string) (interface{}, error) {
+	if deviceID != "camera" {
+		return nil, errors.New("not found device " + deviceID)
+	}
+	return map[string]interface{}{"format": "YUYV", "width": 640, "height": 480}, nil
+}
+
+func (f *fakePanel) GetDeviceState(deviceID string) (string, string, error) {
+	if deviceID != "camera" {
+		return "", "", errors.New("not found device " + deviceID)
+	}
+	return "Online", "", nil
+}
+
+// GetFrame get frames captured every millisecond since the first one was asked for
+func (f *fakePanel) GetFrame(ctx context.Context, deviceID string, after uint64) (*global.Frame, error) {
+	if f.frameStart.IsZero() {
+		f.frameStart = time.Now()
+	}
+	sequence := uint64(time.Since(f.frameStart)/time.Millisecond) + 1
+	if sequence <= after {
+		select {
+		case <-time.After(time.Duration(after+1-sequence) * time.Millisecond):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		sequence = after + 1
+	}
+	return &global.Frame{
+		Data:      []byte("jpeg " + strconv.FormatUint(sequence, 10)),
+		Timestamp: f.frameStart.Add(time.Duration(sequence-1) * time.Millisecond),
+		Sequence:  sequence,
+	}, nil
+}
+
+func newTestServer() (*RestServer, *fakePanel) {
+	var brightness, fps []*common.DataModel
+	for ts := int64(0); ts < 10; ts++ {
+		brightness = append(brightness, &common.DataModel{Value: []string{"1", "3"}[ts%2], TimeStamp: ts * 1000})
+		fps = append(fps, &common.DataModel{Value: "30", TimeStamp: ts*1000 + 500})
+	}
+	panel := &fakePanel{databases: map[string]*memoryDataBase{
+		"brightness": {data: brightness},
+		"fps":        {data: fps},
+	}}
+	rs := NewRestServer(panel)
+	rs.InitRouter()
+	return rs, panel
+}
+
+func serve(rs *RestServer, method string, target string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	rs.Router.ServeHTTP(recorder, httptest.NewRequest(method, target, nil))
+	return recorder
+}
+
+func TestDataBaseGetData(t *testing.T) {
+	rs, panel := newTestServer()
+	tests := []struct {
+		target string
+		total  int
+		values []string
+		times  []int64
+	}{
+		{"/api/v1/database/camera/brightness?start=0&limit=3", 10, []string{"1", "3", "1"}, []int64{0, 1000, 2000}},
+		{"/api/v1/database/camera/brightness?start=1000&end=1970-01-01T00:00:03Z", 3, []string{"3", "1", "3"}, []int64{1000, 2000, 3000}},
+		{"/api/v1/database/camera?start=0&offset=18&limit=5", 20, []string{"3", "30"}, []int64{9000, 9500}},
+		{"/api/v1/database/camera/brightness?start=0&aggregate=avg&interval=2s", 5, []string{"2", "2", "2", "2", "2"}, []int64{0, 2000, 4000, 6000, 8000}},
+		{"/api/v1/database/camera/brightness?start=0&aggregate=max&interval=5s&end=4999", 1, []string{"3"}, []int64{0}},
+		{"/api/v1/database/camera/brightness?start=0&aggregate=min&interval=1m", 1, []string{"1"}, []int64{0}},
+		{"/api/v1/database/camera/brightness?start=0&offset=100", 10, nil, nil},
+	}
+	for _, tt := range tests {
+		recorder := serve(rs, http.MethodGet, tt.target)
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("GET %s: code = %d (%s)", tt.target, recorder.Code, recorder.Body)
+		}
+		var response DataBaseResponse
+		if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		var values []string
+		var times []int64
+		for _, item := range response.Data {
+			values = append(values, item.Value)
+			times = append(times, item.TimeStamp)
+			if item.DeviceName != "camera" || item.PropertyName == "" {
+				t.Errorf("GET %s: data without names: %+v", tt.target, item)
+			}
+		}
+		if response.Total != tt.total || !reflect.DeepEqual(values, tt.values) || !reflect.DeepEqual(times, tt.times) {
+			t.Errorf("GET %s: total %d, values %v at %v, want %d, %v at %v", tt.target, response.Total, values, times, tt.total, tt.values, tt.times)
+		}
+	}
+	if panel.closed != 2*len(tests) {
+		t.Errorf("closed %d database sessions, want %d", panel.closed, 2*len(tests))
+	}
+}
+
+func TestDataBaseGetDataCSV(t *testing.T) {
+	rs, _ := newTestServer()
+	recorder := serve(rs, http.MethodGet, "/api/v1/database/camera/fps?start=0&format=csv&limit=2")
+	if recorder.Code != http.StatusOK || recorder.Header().Get(ContentType) != ContentTypeCSV || recorder.Header().Get(TotalCountHeader) != "10" {
+		t.Fatalf("code = %d, headers = %v", recorder.Code, recorder.Header())
+	}
+	records, err := csv.NewReader(recorder.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"deviceName", "propertyName", "timestamp", "value", "type"},
+		{"camera", "fps", "500", "30", ""},
+		{"camera", "fps", "1500", "30", ""},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("records = %v, want %v", records, want)
+	}
+}
+
+func TestDataBaseDeleteData(t *testing.T) {
+	rs, panel := newTestServer()
+	recorder := serve(rs, http.MethodDelete, "/api/v1/database/camera/brightness?end=4000")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("code = %d (%s)", recorder.Code, recorder.Body)
+	}
+	var response DataBaseDeleteResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Deleted != 5 || len(panel.databases["brightness"].data) != 5 || len(panel.databases["fps"].data) != 10 {
+		t.Errorf("deleted %d, kept %d brightness and %d fps data", response.Deleted,
+			len(panel.databases["brightness"].data), len(panel.databases["fps"].data))
+	}
+
+	// all the data is older than a day
+	recorder = serve(rs, http.MethodDelete, "/api/v1/database/camera?retain=24h")
+	if recorder.Code != http.StatusOK || len(panel.databases["brightness"].data)+len(panel.databases["fps"].data) != 0 {
+		t.Errorf("code = %d, data left after retain", recorder.Code)
+	}
+}
+
+func TestDataBaseErrors(t *testing.T) {
+	rs, _ := newTestServer()
+	tests := []struct {
+		method string
+		target string
+		code   int
+	}{
+		{http.MethodGet, "/api/v1/database/missing?start=0", http.StatusNotFound},
+		{http.MethodGet, "/api/v1/database/camera/missing?start=0", http.StatusNotFound},
+		{http.MethodGet, "/api/v1/database/camera", http.StatusBadRequest},
+		{http.MethodGet, "/api/v1/database/camera?start=yesterday", http.StatusBadRequest},
+		{http.MethodGet, "/api/v1/database/camera?start=2000&end=1000", http.StatusBadRequest},
+		{http.MethodGet, "/api/v1/database/camera?start=0&limit=0", http.StatusBadRequest},
+		{http.MethodGet, "/api/v1/database/camera?start=0&aggregate=sum&interval=1m", http.StatusBadRequest},
+		{http.MethodGet, "/api/v1/database/camera?start=0&aggregate=avg", http.StatusBadRequest},
+		{http.MethodGet, "/api/v1/database/camera?start=0&interval=1m", http.StatusBadRequest},
+		{http.MethodGet, "/api/v1/database/camera?start=0&format=xml", http.StatusBadRequest},
+		{http.MethodDelete, "/api/v1/database/camera", http.StatusBadRequest},
+		{http.MethodDelete, "/api/v1/database/camera?end=1000&retain=1h", http.StatusBadRequest},
+		{http.MethodDelete, "/api/v1/database/missing?retain=1h", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if recorder := serve(rs, tt.method, tt.target); recorder.Code != tt.code {
+			t.Errorf("%s %s: code = %d, want %d (%s)", tt.method, tt.target, recorder.Code, tt.code, recorder.Body)
+		}
+	}
+}
+
+func TestDataBaseGetDataQuerier(t *testing.T) {
+	rs, panel := newTestServer()
+	querier := &querierDataBase{memoryDataBase: *panel.databases["brightness"]}
+	panel.querier = querier
+	recorder := serve(rs, http.MethodGet, "/api/v1/database/camera/brightness?start=2000&end=8000&offset=2&limit=3&aggregate=max&interval=1s")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("code = %d (%s)", recorder.Code, recorder.Body)
+	}
+	var response DataBaseResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	want := []global.HistoryQuery{{Start: 2000, End: 8000, Limit: 5, Aggregate: aggregateMax, Interval: 1000}}
+	if !reflect.DeepEqual(querier.queries, want) {
+		t.Errorf("queries = %+v, want %+v", querier.queries, want)
+	}
+	if response.Total != 7 || len(response.Data) != 3 || response.Data[0].TimeStamp != 4000 || response.Data[0].PropertyName != "brightness" {
+		t.Errorf("total %d, data %+v", response.Total, response.Data)
+	}
+}
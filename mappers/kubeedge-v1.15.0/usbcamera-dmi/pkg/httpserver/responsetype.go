@@ -32,14 +32,36 @@ type DeviceReadResponse struct {
 	Data *common.DataModel
 }
 
+type DeviceStateResponse struct {
+	*BaseResponse
+	DeviceName string `json:"deviceName"`
+	State      string `json:"state"`
+	Reason     string `json:"reason,omitempty"`
+}
+
+// DeviceCapabilitiesResponse the pixel formats, frame sizes and controls of device's camera
+type DeviceCapabilitiesResponse struct {
+	*BaseResponse
+	DeviceName   string      `json:"deviceName"`
+	Capabilities interface{} `json:"capabilities"`
+}
+
 type MetaGetModelResponse struct {
 	*BaseResponse
 	*common.DeviceModel
 }
 
-// DataBaseResponse just for test
+// DataBaseResponse a page of the saved data of a device, oldest first
 type DataBaseResponse struct {
-	// TODO DataBase API need to add
 	*BaseResponse
-	Data []common.DataModel
+	Data   []common.DataModel
+	Total  int `json:"total"`
+	Offset int `json:"offset"`
+	Limit  int `json:"limit"`
+}
+
+// DataBaseDeleteResponse the number of deleted data
+type DataBaseDeleteResponse struct {
+	*BaseResponse
+	Deleted int `json:"deleted"`
 }
@@ -14,6 +14,14 @@ const (
 	APIDeviceRoute = APIBase + "/device"
 	// APIDeviceReadRoute API that read device's property
 	APIDeviceReadRoute = APIDeviceRoute + "/" + DeviceID + "/" + PropertyName
+	// APIDeviceStateRoute API that get device's lifecycle state
+	APIDeviceStateRoute = APIDeviceRoute + "/state/" + DeviceID
+	// APIDeviceCapabilitiesRoute API that get the formats, frame sizes and controls of device's camera
+	APIDeviceCapabilitiesRoute = APIDeviceRoute + "/capabilities/" + DeviceID
+	// APIDeviceSnapshotRoute API that get the latest frame of device's camera as a JPEG image
+	APIDeviceSnapshotRoute = APIDeviceRoute + "/snapshot/" + DeviceID
+	// APIDeviceStreamRoute API that stream the frames of device's camera as Motion-JPEG
+	APIDeviceStreamRoute = APIDeviceRoute + "/stream/" + DeviceID
 
 	// APIMetaRoute to build meta RESTful API
 	APIMetaRoute = APIBase + "/meta"
@@ -22,8 +30,10 @@ const (
 
 	// APIDataBaseRoute to build database RESTful API
 	APIDataBaseRoute = APIBase + "/database"
-	// APIDataBaseGetDataByID API that get data by device id
+	// APIDataBaseGetDataByID API that get or delete the saved data of all device's properties
 	APIDataBaseGetDataByID = APIDataBaseRoute + "/" + DeviceID
+	// APIDataBasePropertyRoute API that get or delete the saved data of device's property
+	APIDataBasePropertyRoute = APIDataBaseRoute + "/" + DeviceID + "/" + PropertyName
 )
 
 // API field pattern
@@ -40,6 +50,16 @@ const (
 	ContentType = "Content-Type"
 	// ContentTypeJSON content type is json
 	ContentTypeJSON = "application/json"
+	// ContentTypeCSV content type is csv
+	ContentTypeCSV = "text/csv"
+	// ContentTypeJPEG content type is jpeg
+	ContentTypeJPEG = "image/jpeg"
+	// TotalCountHeader the number of items of a paged csv response
+	TotalCountHeader = "X-Total-Count"
+	// FrameTimestampHeader the time a frame was captured, in RFC3339 format
+	FrameTimestampHeader = "X-Frame-Timestamp"
+	// FrameSequenceHeader the sequence number of a frame, which increases with each captured frame
+	FrameSequenceHeader = "X-Frame-Sequence"
 
 	// CorrelationHeader correlation header key
 	CorrelationHeader = "X-Correlation-ID"
@@ -7,6 +7,11 @@ func (rs *RestServer) InitRouter() {
 	rs.Router.HandleFunc(APIPing, rs.Ping).Methods(http.MethodGet)
 
 	// Device
+	// these routes must be registered before the read route, which would match them too
+	rs.Router.HandleFunc(APIDeviceStateRoute, rs.DeviceState).Methods(http.MethodGet)
+	rs.Router.HandleFunc(APIDeviceCapabilitiesRoute, rs.DeviceCapabilities).Methods(http.MethodGet)
+	rs.Router.HandleFunc(APIDeviceSnapshotRoute, rs.DeviceSnapshot).Methods(http.MethodGet)
+	rs.Router.HandleFunc(APIDeviceStreamRoute, rs.DeviceStream).Methods(http.MethodGet)
 	rs.Router.HandleFunc(APIDeviceReadRoute, rs.DeviceRead).Methods(http.MethodGet)
 
 	// Meta
@@ -14,4 +19,7 @@ func (rs *RestServer) InitRouter() {
 
 	// DataBase
 	rs.Router.HandleFunc(APIDataBaseGetDataByID, rs.DataBaseGetDataByID).Methods(http.MethodGet)
+	rs.Router.HandleFunc(APIDataBaseGetDataByID, rs.DataBaseDeleteData).Methods(http.MethodDelete)
+	rs.Router.HandleFunc(APIDataBasePropertyRoute, rs.DataBaseGetDataByID).Methods(http.MethodGet)
+	rs.Router.HandleFunc(APIDataBasePropertyRoute, rs.DataBaseDeleteData).Methods(http.MethodDelete)
 }
@@ -25,7 +25,6 @@ type RestServer struct {
 	server         *http.Server
 	Router         *mux.Router
 	devPanel       global.DevPanel
-	databaseClient global.DataBaseClient
 }
 
 type Option func(server *RestServer)
@@ -162,9 +161,3 @@ func WithCaCertFile(caCertPath string) Option {
 		server.CaCertFilePath = caCertPath
 	}
 }
-
-func WithDbClient(dbClient global.DataBaseClient) Option {
-	return func(server *RestServer) {
-		server.databaseClient = dbClient
-	}
-}
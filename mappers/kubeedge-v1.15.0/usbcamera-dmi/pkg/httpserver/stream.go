@@ -0,0 +1,115 @@
+package httpserver
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"github.com/kubeedge/usb/pkg/global"
+)
+
+// mjpegBoundary separates the frames of a Motion-JPEG stream
+const mjpegBoundary = "frame"
+
+// parseFrameInterval parse fps, the maximum frame rate of a stream, all the frames of the camera by default
+func parseFrameInterval(values url.Values) (time.Duration, error) {
+	v := values.Get("fps")
+	if v == "" {
+		return 0, nil
+	}
+	fps, err := strconv.ParseFloat(v, 64)
+	if err != nil || fps <= 0 || fps > 1000 {
+		return 0, fmt.Errorf("invalid fps %q", v)
+	}
+	return time.Duration(float64(time.Second) / fps), nil
+}
+
+// setFrameHeader set the headers of a frame
+func setFrameHeader(header http.Header, frame *global.Frame) {
+	header.Set(ContentType, ContentTypeJPEG)
+	header.Set("Content-Length", strconv.Itoa(len(frame.Data)))
+	header.Set(FrameTimestampHeader, frame.Timestamp.UTC().Format(time.RFC3339Nano))
+	header.Set(FrameSequenceHeader, strconv.FormatUint(frame.Sequence, 10))
+}
+
+// writeSnapshot write a frame as a JPEG image
+func writeSnapshot(writer http.ResponseWriter, request *http.Request, frame *global.Frame) {
+	correlationID := request.Header.Get(CorrelationHeader)
+	if correlationID != "" {
+		writer.Header().Set(CorrelationHeader, correlationID)
+	}
+	setFrameHeader(writer.Header(), frame)
+	writer.Header().Set("Last-Modified", frame.Timestamp.UTC().Format(http.TimeFormat))
+	writer.Header().Set("Cache-Control", "no-store")
+	writer.WriteHeader(http.StatusOK)
+	if _, err := writer.Write(frame.Data); err != nil {
+		klog.Errorf("write %s response error: %v", request.URL.Path, err)
+	}
+}
+
+// streamMJPEG write the frames of a device as a multipart/x-mixed-replace stream, from the first one, until
+// the client disconnects or no frame can be captured. The write timeout of the server would end the stream,
+// so the connection is hijacked if possible and each frame must be written within the write timeout.
+func (rs *RestServer) streamMJPEG(writer http.ResponseWriter, request *http.Request, deviceName string,
+	first *global.Frame, interval time.Duration) {
+	contentType := "multipart/x-mixed-replace; boundary=" + mjpegBoundary
+	var out *bufio.Writer
+	var conn net.Conn
+	if hijacker, ok := writer.(http.Hijacker); ok {
+		c, rw, err := hijacker.Hijack()
+		if err != nil {
+			http.Error(writer, fmt.Sprintf("Stream device frames error: %v", err), http.StatusInternalServerError)
+			return
+		}
+		defer c.Close()
+		conn, out = c, rw.Writer
+		if err = conn.SetDeadline(time.Time{}); err != nil {
+			klog.Errorf("stream frames of device %s error: %v", deviceName, err)
+			return
+		}
+		fmt.Fprintf(out, "HTTP/1.1 200 OK\r\n%s: %s\r\nCache-Control: no-store\r\nConnection: close\r\n\r\n",
+			ContentType, contentType)
+	} else {
+		// HTTP/2 connections can not be hijacked
+		writer.Header().Set(ContentType, contentType)
+		writer.Header().Set("Cache-Control", "no-store")
+		writer.WriteHeader(http.StatusOK)
+		out = bufio.NewWriter(writer)
+	}
+
+	frame := first
+	var next time.Time
+	for {
+		if interval == 0 || !frame.Timestamp.Before(next) {
+			next = frame.Timestamp.Add(interval)
+			if conn != nil && rs.WriteTimeout > 0 {
+				_ = conn.SetWriteDeadline(time.Now().Add(rs.WriteTimeout))
+			}
+			header := make(http.Header)
+			setFrameHeader(header, frame)
+			fmt.Fprintf(out, "--%s\r\n", mjpegBoundary)
+			_ = header.Write(out)
+			fmt.Fprint(out, "\r\n")
+			_, _ = out.Write(frame.Data)
+			fmt.Fprint(out, "\r\n")
+			if err := out.Flush(); err != nil {
+				klog.V(2).Infof("stopped streaming frames of device %s: %v", deviceName, err)
+				return
+			}
+			if flusher, ok := writer.(http.Flusher); ok && conn == nil {
+				flusher.Flush()
+			}
+		}
+		var err error
+		if frame, err = rs.devPanel.GetFrame(request.Context(), deviceName, frame.Sequence); err != nil {
+			klog.V(2).Infof("stopped streaming frames of device %s: %v", deviceName, err)
+			return
+		}
+	}
+}
@@ -1,8 +1,13 @@
 package main
 
 import (
+	"context"
 	"errors"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"k8s.io/klog/v2"
 
@@ -14,6 +19,10 @@ import (
 	"github.com/kubeedge/mapper-framework/pkg/httpserver"
 )
 
+// shutdownTimeout bounds how long in-flight pushes and database writes may
+// take to finish once the mapper is asked to stop.
+const shutdownTimeout = 10 * time.Second
+
 func main() {
 	var err error
 	var c *config.Config
@@ -21,6 +30,9 @@ func main() {
 	klog.InitFlags(nil)
 	defer klog.Flush()
 
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	if c, err = config.Parse(); err != nil {
 		klog.Fatal(err)
 	}
@@ -43,6 +55,8 @@ func main() {
 
 	// start http server
 	httpServer := httpserver.NewRestServer(panel, c.Common.HTTPPort)
+	httpServer.Router.HandleFunc(device.DeviceWriteRoute, device.DeviceWriteHandler(panel)).Methods(http.MethodPut)
+	httpServer.Router.HandleFunc(device.DeviceArtifactRoute, device.DeviceArtifactHandler(panel)).Methods(http.MethodGet)
 	go httpServer.StartServer()
 
 	// start grpc server
@@ -53,9 +67,27 @@ func main() {
 		},
 		panel,
 	)
-	defer grpcServer.Stop()
-	if err = grpcServer.Start(); err != nil {
-		klog.Fatal(err)
-	}
+	go func() {
+		if err := grpcServer.Start(); err != nil {
+			klog.Fatal(err)
+		}
+	}()
 
+	<-ctx.Done()
+	klog.Infoln("Mapper is shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	// report the final state of the devices while edgecore still reaches the
+	// mapper
+	if err = panel.Deregister(shutdownCtx); err != nil {
+		klog.Errorf("Mapper deregistration is incomplete: %v", err)
+	}
+	// stop accepting DMI requests, this also removes the mapper socket, which
+	// is how edgecore learns that the mapper is gone
+	grpcServer.Stop()
+	if err = panel.Shutdown(shutdownCtx); err != nil {
+		klog.Errorf("Mapper shutdown is incomplete: %v", err)
+		return
+	}
+	klog.Infoln("Mapper stopped")
 }
@@ -0,0 +1,434 @@
+/*
+Copyright 2024 The KubeEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// Kinds of artifacts.
+const (
+	KindFrame = "frame"
+	KindVideo = "video"
+)
+
+// maxUploadedArtifacts bounds the uploaded artifacts kept in an index, they
+// take no disk space but the index would grow forever.
+const maxUploadedArtifacts = 1000
+
+// sweepInterval is how often expired artifacts are removed and failed uploads
+// are retried.
+const sweepInterval = time.Minute
+
+// Artifact is a file saved from a stream.
+type Artifact struct {
+	Name      string    `json:"name"`
+	Kind      string    `json:"kind"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Path is the local file, empty once it is uploaded.
+	Path string `json:"path,omitempty"`
+	// URL is the object the file was uploaded to.
+	URL string `json:"url,omitempty"`
+}
+
+// Retention limits the artifacts kept on disk. Zero values do not limit.
+type Retention struct {
+	MaxFiles int
+	MaxBytes int64
+	MaxAge   time.Duration
+}
+
+// Artifacts is the index of the files saved for a stream property. It names
+// the files, keeps them within the retention limits and uploads them. The
+// index is kept in a hidden file of the output directory.
+type Artifacts struct {
+	deviceID string
+	property string
+	dir      string
+	// key prefixes the hidden files of the property in dir
+	key  string
+	wake chan struct{}
+	// stop ends the run goroutine of the device that opened the artifacts
+	// last, guarded by artifactsMutex
+	stop context.CancelFunc
+
+	mutex     sync.Mutex
+	retention Retention
+	uploader  *uploader
+	artifacts []Artifact // oldest first
+	uploading string     // name of the artifact being uploaded, kept on disk until it is done
+
+	uploadMutex sync.Mutex // one upload pass at a time
+	saveMutex   sync.Mutex // writes the index in the order it changes
+}
+
+var (
+	artifactsMutex sync.Mutex
+	artifactsByID  = make(map[string]*Artifacts)
+	unsafeKeyChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+)
+
+// OpenArtifacts returns the artifacts of the stream property of a device in
+// dir, loading the index the first time. Later calls change the retention
+// and the upload configuration. Uploads and the removal of expired files run
+// in the background until ctx, the context of the device, is done.
+func OpenArtifacts(ctx context.Context, deviceID, property, dir string, retention Retention, upload *UploadConfig) (*Artifacts, error) {
+	var up *uploader
+	if upload != nil {
+		var err error
+		if up, err = newUploader(*upload); err != nil {
+			return nil, err
+		}
+	}
+
+	artifactsMutex.Lock()
+	defer artifactsMutex.Unlock()
+	id := deviceID + "/" + property
+	a, ok := artifactsByID[id]
+	if !ok || a.dir != dir {
+		var err error
+		if a, err = loadArtifacts(deviceID, property, dir); err != nil {
+			return nil, err
+		}
+		artifactsByID[id] = a
+	}
+	if a.stop != nil {
+		a.stop()
+	}
+	var runCtx context.Context
+	runCtx, a.stop = context.WithCancel(ctx)
+	go a.run(runCtx)
+
+	a.mutex.Lock()
+	a.retention, a.uploader = retention, up
+	changed := a.applyRetention(time.Now())
+	a.mutex.Unlock()
+	if changed {
+		a.save()
+	}
+	a.notify()
+	return a, nil
+}
+
+// LookupArtifacts returns the artifacts of the stream property of a device,
+// nil if it has saved none since the mapper started.
+func LookupArtifacts(deviceID, property string) *Artifacts {
+	artifactsMutex.Lock()
+	defer artifactsMutex.Unlock()
+	return artifactsByID[deviceID+"/"+property]
+}
+
+func loadArtifacts(deviceID, property, dir string) (*Artifacts, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("no output directory")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	a := &Artifacts{
+		deviceID: deviceID,
+		property: property,
+		dir:      dir,
+		key:      unsafeKeyChars.ReplaceAllString(deviceID+"."+property, "_"),
+		wake:     make(chan struct{}, 1),
+	}
+
+	// files left by a write that did not finish
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), a.tempPrefix()) {
+			if err = os.Remove(filepath.Join(dir, entry.Name())); err != nil {
+				klog.Warningf("Remove unfinished artifact: %v", err)
+			}
+		}
+	}
+
+	b, err := os.ReadFile(a.indexPath())
+	if os.IsNotExist(err) {
+		return a, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var artifacts []Artifact
+	if err = json.Unmarshal(b, &artifacts); err != nil {
+		klog.Errorf("Ignore invalid artifact index %s: %v", a.indexPath(), err)
+		return a, nil
+	}
+	// the files may have been removed while the mapper was stopped
+	for _, artifact := range artifacts {
+		if artifact.Path != "" {
+			if _, err = os.Stat(artifact.Path); err != nil {
+				artifact.Path = ""
+			}
+		}
+		if artifact.Path != "" || artifact.URL != "" {
+			a.artifacts = append(a.artifacts, artifact)
+		}
+	}
+	return a, nil
+}
+
+func (a *Artifacts) tempPrefix() string {
+	return "." + a.key + "~"
+}
+
+func (a *Artifacts) indexPath() string {
+	return filepath.Join(a.dir, "."+a.key+".json")
+}
+
+// TempPath returns the path to write a new file of the format to, hidden
+// until it is committed.
+func (a *Artifacts) TempPath(format string) string {
+	return filepath.Join(a.dir, a.tempPrefix()+filepath.Base(GenFileName(a.dir, format)))
+}
+
+// Commit moves a file written to a TempPath to its final name and adds it to
+// the index.
+func (a *Artifacts) Commit(tempPath string, kind string) (Artifact, error) {
+	name := strings.TrimPrefix(filepath.Base(tempPath), a.tempPrefix())
+	info, err := os.Stat(tempPath)
+	if err != nil {
+		return Artifact{}, err
+	}
+	artifact := Artifact{
+		Name:      name,
+		Kind:      kind,
+		Size:      info.Size(),
+		CreatedAt: time.Now().UTC(),
+		Path:      filepath.Join(a.dir, name),
+	}
+	if err = os.Rename(tempPath, artifact.Path); err != nil {
+		return Artifact{}, err
+	}
+
+	a.mutex.Lock()
+	a.artifacts = append(a.artifacts, artifact)
+	a.applyRetention(time.Now())
+	a.mutex.Unlock()
+	a.save()
+	a.notify()
+	return artifact, nil
+}
+
+// Discard removes a file written to a TempPath that is not committed.
+func (a *Artifacts) Discard(tempPath string) {
+	if err := os.Remove(tempPath); err != nil && !os.IsNotExist(err) {
+		klog.Warningf("Remove unfinished artifact: %v", err)
+	}
+}
+
+// WriteFile saves data as a new artifact of the format.
+func (a *Artifacts) WriteFile(format string, kind string, data []byte) (Artifact, error) {
+	tempPath := a.TempPath(format)
+	f, err := os.Create(tempPath)
+	if err != nil {
+		return Artifact{}, err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		a.Discard(tempPath)
+		return Artifact{}, err
+	}
+	return a.Commit(tempPath, kind)
+}
+
+// List returns the artifacts created at or after since, oldest first.
+func (a *Artifacts) List(since time.Time) []Artifact {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	artifacts := make([]Artifact, 0, len(a.artifacts))
+	for _, artifact := range a.artifacts {
+		if !artifact.CreatedAt.Before(since) {
+			artifacts = append(artifacts, artifact)
+		}
+	}
+	return artifacts
+}
+
+// applyRetention removes the artifacts beyond the retention limits, oldest
+// first, and reports whether the index changed. The caller holds a.mutex.
+func (a *Artifacts) applyRetention(now time.Time) bool {
+	r := a.retention
+	remove := make([]bool, len(a.artifacts))
+	var files int
+	var bytes int64
+	for i, artifact := range a.artifacts {
+		if artifact.Name == a.uploading {
+			// the file is being uploaded, the retention applies once it is done
+			continue
+		}
+		if r.MaxAge > 0 && now.Sub(artifact.CreatedAt) > r.MaxAge {
+			remove[i] = true
+		} else if artifact.Path != "" {
+			files++
+			bytes += artifact.Size
+		}
+	}
+	for i, artifact := range a.artifacts {
+		if (r.MaxFiles <= 0 || files <= r.MaxFiles) && (r.MaxBytes <= 0 || bytes <= r.MaxBytes) {
+			break
+		}
+		if !remove[i] && artifact.Path != "" && artifact.Name != a.uploading {
+			remove[i] = true
+			files--
+			bytes -= artifact.Size
+		}
+	}
+	uploaded := 0
+	for i := len(a.artifacts) - 1; i >= 0; i-- {
+		if !remove[i] && a.artifacts[i].Path == "" {
+			uploaded++
+			remove[i] = uploaded > maxUploadedArtifacts
+		}
+	}
+
+	kept := a.artifacts[:0]
+	changed := false
+	for i, artifact := range a.artifacts {
+		if !remove[i] {
+			kept = append(kept, artifact)
+			continue
+		}
+		changed = true
+		if artifact.Path != "" {
+			klog.V(4).Infof("Remove artifact %s of %s by the retention policy", artifact.Path, a.property)
+			if err := os.Remove(artifact.Path); err != nil && !os.IsNotExist(err) {
+				klog.Warningf("Remove artifact: %v", err)
+			}
+		}
+	}
+	for i := len(kept); i < len(a.artifacts); i++ {
+		a.artifacts[i] = Artifact{}
+	}
+	a.artifacts = kept
+	return changed
+}
+
+// save writes the index, errors are only logged since the files are saved.
+func (a *Artifacts) save() {
+	a.saveMutex.Lock()
+	defer a.saveMutex.Unlock()
+	a.mutex.Lock()
+	b, err := json.Marshal(a.artifacts)
+	a.mutex.Unlock()
+	if err != nil {
+		klog.Errorf("Marshal artifact index: %v", err)
+		return
+	}
+	tempPath := filepath.Join(a.dir, a.tempPrefix()+"index")
+	if err = os.WriteFile(tempPath, b, 0644); err == nil {
+		err = os.Rename(tempPath, a.indexPath())
+	}
+	if err != nil {
+		klog.Errorf("Write artifact index of %s: %v", a.property, err)
+	}
+}
+
+func (a *Artifacts) notify() {
+	select {
+	case a.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run uploads new artifacts and removes expired ones until ctx is done.
+func (a *Artifacts) run(ctx context.Context) {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-a.wake:
+		case <-ticker.C:
+			a.mutex.Lock()
+			changed := a.applyRetention(time.Now())
+			a.mutex.Unlock()
+			if changed {
+				a.save()
+			}
+		}
+		a.uploadPending()
+	}
+}
+
+// uploadPending uploads the local artifacts oldest first and removes the
+// local files. A failed upload ends the pass, it is retried later.
+func (a *Artifacts) uploadPending() {
+	a.uploadMutex.Lock()
+	defer a.uploadMutex.Unlock()
+	for {
+		a.mutex.Lock()
+		up := a.uploader
+		var next Artifact
+		for _, artifact := range a.artifacts {
+			if artifact.Path != "" && artifact.URL == "" {
+				next = artifact
+				break
+			}
+		}
+		if up == nil || next.Path == "" {
+			a.mutex.Unlock()
+			return
+		}
+		// the retention keeps the file until the upload is done
+		a.uploading = next.Name
+		a.mutex.Unlock()
+
+		url, err := up.upload(a.deviceID+"/"+a.property+"/"+next.Name, next.Path)
+		a.mutex.Lock()
+		a.uploading = ""
+		if err != nil {
+			a.mutex.Unlock()
+			klog.Errorf("Upload artifact %s of %s: %v", next.Name, a.property, err)
+			return
+		}
+		for i := range a.artifacts {
+			if a.artifacts[i].Name == next.Name {
+				a.artifacts[i].URL = url
+				a.artifacts[i].Path = ""
+			}
+		}
+		a.applyRetention(time.Now())
+		a.mutex.Unlock()
+		if err = os.Remove(next.Path); err != nil && !os.IsNotExist(err) {
+			klog.Warningf("Remove uploaded artifact: %v", err)
+		}
+		klog.V(4).Infof("Uploaded artifact %s of %s to %s", next.Name, a.property, url)
+		a.save()
+	}
+}
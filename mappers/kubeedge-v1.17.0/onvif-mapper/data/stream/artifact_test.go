@@ -0,0 +1,149 @@
+/*
+Copyright 2024 The KubeEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stream
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func writeArtifacts(t *testing.T, a *Artifacts, sizes ...int) {
+	t.Helper()
+	for _, size := range sizes {
+		if _, err := a.WriteFile("jpg", KindFrame, make([]byte, size)); err != nil {
+			t.Fatal(err)
+		}
+		// names have a millisecond resolution
+		time.Sleep(2 * time.Millisecond)
+	}
+}
+
+func sizes(artifacts []Artifact) []int64 {
+	var sizes []int64
+	for _, artifact := range artifacts {
+		sizes = append(sizes, artifact.Size)
+	}
+	return sizes
+}
+
+func TestArtifactsRetention(t *testing.T) {
+	tests := []struct {
+		name      string
+		retention Retention
+		want      []int64
+	}{
+		{name: "unlimited", want: []int64{1, 2, 3, 4}},
+		{name: "max files", retention: Retention{MaxFiles: 2}, want: []int64{3, 4}},
+		{name: "max bytes", retention: Retention{MaxBytes: 7}, want: []int64{3, 4}},
+		{name: "max bytes of a file", retention: Retention{MaxBytes: 4}, want: []int64{4}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := newArtifacts(t)
+			a.retention = test.retention
+			writeArtifacts(t, a, 1, 2, 3, 4)
+
+			artifacts := a.List(time.Time{})
+			if got := sizes(artifacts); len(got) != len(test.want) || got[0] != test.want[0] {
+				t.Fatalf("sizes = %v, want %v", got, test.want)
+			}
+			names, _ := filepath.Glob(filepath.Join(a.dir, "*.jpg"))
+			if len(names) != len(test.want) {
+				t.Errorf("%d files, want %d", len(names), len(test.want))
+			}
+		})
+	}
+}
+
+func TestArtifactsMaxAge(t *testing.T) {
+	a := newArtifacts(t)
+	writeArtifacts(t, a, 1, 2)
+	a.mutex.Lock()
+	a.artifacts[0].CreatedAt = time.Now().Add(-2 * time.Hour)
+	a.retention = Retention{MaxAge: time.Hour}
+	changed := a.applyRetention(time.Now())
+	a.mutex.Unlock()
+
+	if !changed {
+		t.Error("no change for an expired artifact")
+	}
+	artifacts := a.List(time.Time{})
+	if got := sizes(artifacts); len(got) != 1 || got[0] != 2 {
+		t.Errorf("sizes = %v, want [2]", got)
+	}
+	if since := a.List(time.Now().Add(time.Minute)); len(since) != 0 {
+		t.Errorf("%d artifacts in the future", len(since))
+	}
+}
+
+func TestArtifactsReload(t *testing.T) {
+	a := newArtifacts(t)
+	writeArtifacts(t, a, 1, 2, 3)
+	artifacts := a.List(time.Time{})
+	if err := os.Remove(artifacts[1].Path); err != nil {
+		t.Fatal(err)
+	}
+	unfinished := a.TempPath("mp4")
+	if err := os.WriteFile(unfinished, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := loadArtifacts(a.deviceID, a.property, a.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := reloaded.List(time.Time{})
+	if len(got) != 2 || got[0].Name != artifacts[0].Name || got[1].Name != artifacts[2].Name {
+		t.Errorf("reloaded %v, want the first and the last of %v", got, artifacts)
+	}
+	if _, err = os.Stat(unfinished); !os.IsNotExist(err) {
+		t.Errorf("unfinished file is not removed: %v", err)
+	}
+}
+
+func TestArtifactsStopWithDevice(t *testing.T) {
+	dir := t.TempDir()
+	before := runtime.NumGoroutine()
+	ctx, cancel := context.WithCancel(context.Background())
+	a, err := OpenArtifacts(ctx, "camera", "stopped", dir, Retention{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a restarted device takes the artifacts over, the first one is stopped
+	restarted, cancelRestarted := context.WithCancel(context.Background())
+	reopened, err := OpenArtifacts(restarted, "camera", "stopped", dir, Retention{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reopened != a {
+		t.Fatal("the artifacts are loaded again")
+	}
+	cancelRestarted()
+	cancel()
+
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if left := runtime.NumGoroutine() - before; left > 0 {
+		t.Fatalf("%d goroutines left after the device stopped", left)
+	}
+}
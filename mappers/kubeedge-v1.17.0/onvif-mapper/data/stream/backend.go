@@ -0,0 +1,67 @@
+/*
+Copyright 2024 The KubeEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stream
+
+import (
+	"fmt"
+	"time"
+)
+
+// Backends that acquire stream data.
+const (
+	// BackendNative reads the stream with the RTSP client of this mapper, see native.go.
+	BackendNative = "native"
+	// BackendFFmpeg decodes the stream with FFmpeg, in builds with the ffmpeg tag only, see ffmpeg.go.
+	BackendFFmpeg = "ffmpeg"
+)
+
+// Backend saves frames and videos of the stream at an URI as artifacts.
+type Backend interface {
+	// SaveFrame saves frameCount frames at least frameInterval nanoseconds apart.
+	SaveFrame(uri string, out *Artifacts, format string, frameCount int, frameInterval int) error
+	// SaveVideo saves videoNum videos of frameCount frames each.
+	SaveVideo(uri string, out *Artifacts, format string, frameCount int, videoNum int) error
+}
+
+var backends = map[string]Backend{
+	BackendNative: nativeBackend{},
+}
+
+// backendOf returns the backend of the name. If empty, it is the ffmpeg one
+// in builds that have it, which decodes frames into any image format, and
+// the native one otherwise.
+func backendOf(name string) (Backend, error) {
+	if name == "" {
+		name = BackendNative
+		if _, ok := backends[BackendFFmpeg]; ok {
+			name = BackendFFmpeg
+		}
+	}
+	backend, ok := backends[name]
+	if !ok {
+		if name == BackendFFmpeg {
+			return nil, fmt.Errorf("the mapper is built without the %s backend, build it with -tags ffmpeg", name)
+		}
+		return nil, fmt.Errorf("unknown stream backend %q", name)
+	}
+	return backend, nil
+}
+
+// GenFileName generate file name with current time. Formate f<year><month><day><hour><minute><second><millisecond>.<format>
+func GenFileName(dir string, format string) string {
+	return fmt.Sprintf("%s/f%s.%s", dir, time.Now().Format(time.RFC3339Nano), format)
+}
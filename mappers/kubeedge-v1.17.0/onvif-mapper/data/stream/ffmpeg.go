@@ -0,0 +1,34 @@
+//go:build ffmpeg
+
+/*
+Copyright 2024 The KubeEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stream
+
+// ffmpegBackend decodes the stream with the FFmpeg libraries, see img.go and video.go.
+type ffmpegBackend struct{}
+
+func init() {
+	backends[BackendFFmpeg] = ffmpegBackend{}
+}
+
+func (ffmpegBackend) SaveFrame(uri string, out *Artifacts, format string, frameCount int, frameInterval int) error {
+	return SaveFrame(uri, out, format, frameCount, frameInterval)
+}
+
+func (ffmpegBackend) SaveVideo(uri string, out *Artifacts, format string, frameCount int, videoNum int) error {
+	return SaveVideo(uri, out, format, frameCount, videoNum)
+}
@@ -0,0 +1,258 @@
+/*
+Copyright 2024 The KubeEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fmp4
+
+import (
+	"errors"
+	"fmt"
+)
+
+var errShortSPS = errors.New("short SPS")
+
+// h264SPS is what the MP4 sample entry needs from an H.264 SPS.
+type h264SPS struct {
+	width, height int
+}
+
+// h265SPS is what the MP4 sample entry needs from an H.265 SPS.
+type h265SPS struct {
+	width, height     int
+	maxSubLayers      int
+	temporalIDNesting bool
+	// profileTierLevel is the general profile, tier and level, 12 bytes
+	profileTierLevel []byte
+	chromaFormat     int
+	bitDepthLuma     int
+	bitDepthChroma   int
+}
+
+func parseH264SPS(nalu []byte) (*h264SPS, error) {
+	if len(nalu) < 4 {
+		return nil, errShortSPS
+	}
+	r := &bitReader{data: unescape(nalu[1:])}
+	profile := r.bits(8)
+	r.bits(16) // constraint flags and level
+	r.ue()     // seq_parameter_set_id
+	chromaFormat := 1
+	switch profile {
+	case 100, 110, 122, 244, 44, 83, 86, 118, 128, 138, 139, 134, 135:
+		chromaFormat = r.ue()
+		if chromaFormat == 3 {
+			r.bits(1) // separate_colour_plane_flag
+		}
+		r.ue()    // bit_depth_luma_minus8
+		r.ue()    // bit_depth_chroma_minus8
+		r.bits(1) // qpprime_y_zero_transform_bypass_flag
+		if r.bits(1) == 1 {
+			lists := 8
+			if chromaFormat == 3 {
+				lists = 12
+			}
+			for i := 0; i < lists; i++ {
+				if r.bits(1) == 1 {
+					size := 16
+					if i >= 6 {
+						size = 64
+					}
+					skipScalingList(r, size)
+				}
+			}
+		}
+	}
+	r.ue() // log2_max_frame_num_minus4
+	switch r.ue() {
+	case 0:
+		r.ue() // log2_max_pic_order_cnt_lsb_minus4
+	case 1:
+		r.bits(1) // delta_pic_order_always_zero_flag
+		r.se()    // offset_for_non_ref_pic
+		r.se()    // offset_for_top_to_bottom_field
+		for n := r.ue(); n > 0 && r.err == nil; n-- {
+			r.se()
+		}
+	}
+	r.ue()    // max_num_ref_frames
+	r.bits(1) // gaps_in_frame_num_value_allowed_flag
+	widthInMbs := r.ue() + 1
+	heightInMapUnits := r.ue() + 1
+	frameMbsOnly := r.bits(1)
+	if frameMbsOnly == 0 {
+		r.bits(1) // mb_adaptive_frame_field_flag
+	}
+	r.bits(1) // direct_8x8_inference_flag
+	var cropLeft, cropRight, cropTop, cropBottom int
+	if r.bits(1) == 1 {
+		cropLeft, cropRight, cropTop, cropBottom = r.ue(), r.ue(), r.ue(), r.ue()
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	cropX, cropY := 1, 2-frameMbsOnly
+	switch chromaFormat {
+	case 1:
+		cropX, cropY = 2, 2*(2-frameMbsOnly)
+	case 2:
+		cropX = 2
+	}
+	sps := &h264SPS{
+		width:  widthInMbs*16 - cropX*(cropLeft+cropRight),
+		height: (2-frameMbsOnly)*heightInMapUnits*16 - cropY*(cropTop+cropBottom),
+	}
+	if sps.width <= 0 || sps.height <= 0 {
+		return nil, fmt.Errorf("invalid picture size %dx%d", sps.width, sps.height)
+	}
+	return sps, nil
+}
+
+func skipScalingList(r *bitReader, size int) {
+	last, next := 8, 8
+	for i := 0; i < size && r.err == nil; i++ {
+		if next != 0 {
+			next = (last + r.se() + 256) % 256
+		}
+		if next != 0 {
+			last = next
+		}
+	}
+}
+
+func parseH265SPS(nalu []byte) (*h265SPS, error) {
+	if len(nalu) < 15 {
+		return nil, errShortSPS
+	}
+	data := unescape(nalu[2:])
+	r := &bitReader{data: data}
+	r.bits(4) // sps_video_parameter_set_id
+	sps := &h265SPS{maxSubLayers: r.bits(3) + 1}
+	sps.temporalIDNesting = r.bits(1) == 1
+	if len(data) < 13 {
+		return nil, errShortSPS
+	}
+	sps.profileTierLevel = append([]byte{}, data[1:13]...)
+	r.bits(96)
+	subLayerProfile := make([]bool, sps.maxSubLayers-1)
+	subLayerLevel := make([]bool, sps.maxSubLayers-1)
+	for i := range subLayerProfile {
+		subLayerProfile[i] = r.bits(1) == 1
+		subLayerLevel[i] = r.bits(1) == 1
+	}
+	if sps.maxSubLayers > 1 {
+		for i := sps.maxSubLayers - 1; i < 8; i++ {
+			r.bits(2) // reserved_zero_2bits
+		}
+	}
+	for i := range subLayerProfile {
+		if subLayerProfile[i] {
+			r.bits(88)
+		}
+		if subLayerLevel[i] {
+			r.bits(8)
+		}
+	}
+	r.ue() // sps_seq_parameter_set_id
+	sps.chromaFormat = r.ue()
+	if sps.chromaFormat == 3 {
+		r.bits(1) // separate_colour_plane_flag
+	}
+	width, height := r.ue(), r.ue()
+	if r.bits(1) == 1 {
+		left, right, top, bottom := r.ue(), r.ue(), r.ue(), r.ue()
+		subWidth, subHeight := 1, 1
+		switch sps.chromaFormat {
+		case 1:
+			subWidth, subHeight = 2, 2
+		case 2:
+			subWidth = 2
+		}
+		width -= subWidth * (left + right)
+		height -= subHeight * (top + bottom)
+	}
+	sps.bitDepthLuma = r.ue() + 8
+	sps.bitDepthChroma = r.ue() + 8
+	if r.err != nil {
+		return nil, r.err
+	}
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("invalid picture size %dx%d", width, height)
+	}
+	sps.width, sps.height = width, height
+	return sps, nil
+}
+
+// unescape removes the emulation prevention bytes of a NAL unit.
+func unescape(b []byte) []byte {
+	out := make([]byte, 0, len(b))
+	zeros := 0
+	for _, c := range b {
+		if zeros >= 2 && c == 3 {
+			zeros = 0
+			continue
+		}
+		if c == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// bitReader reads the fields of a parameter set. The first read past the
+// end sets err and the following ones return zero.
+type bitReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *bitReader) bits(n int) int {
+	v := 0
+	for i := 0; i < n; i++ {
+		if r.pos >= len(r.data)*8 {
+			r.err = errShortSPS
+			return 0
+		}
+		v = v<<1 | int(r.data[r.pos/8]>>(7-r.pos%8)&1)
+		r.pos++
+	}
+	return v
+}
+
+// ue reads an unsigned Exp-Golomb code.
+func (r *bitReader) ue() int {
+	zeros := 0
+	for r.bits(1) == 0 {
+		if r.err != nil || zeros > 31 {
+			r.err = errShortSPS
+			return 0
+		}
+		zeros++
+	}
+	return 1<<zeros - 1 + r.bits(zeros)
+}
+
+// se reads a signed Exp-Golomb code.
+func (r *bitReader) se() int {
+	v := r.ue()
+	if v%2 == 0 {
+		return -v / 2
+	}
+	return (v + 1) / 2
+}
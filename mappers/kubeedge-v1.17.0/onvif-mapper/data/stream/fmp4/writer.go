@@ -0,0 +1,292 @@
+/*
+Copyright 2024 The KubeEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package fmp4 writes H.264 and H.265 video to fragmented MP4 files, ISO/IEC
+// 14496-12 and 14496-15, without re-encoding it.
+package fmp4
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Codecs the writer accepts.
+const (
+	H264 = "H264"
+	H265 = "H265"
+)
+
+const trackID = 1
+
+// sample flags of trun entries
+const (
+	syncSampleFlags    = 0x02000000 // depends on no other sample
+	nonSyncSampleFlags = 0x01010000 // depends on others, not a sync sample
+)
+
+// Config describes the video track of a file.
+type Config struct {
+	Codec string
+	// Timescale is the number of sample time units per second, the RTP
+	// clock rate.
+	Timescale uint32
+	// VPS, SPS and PPS are the parameter sets of the stream, VPS for H.265
+	// only.
+	VPS, SPS, PPS []byte
+}
+
+// Sample is an access unit.
+type Sample struct {
+	// NALUs are the NAL units of the sample without start codes.
+	NALUs    [][]byte
+	Duration uint32
+	Keyframe bool
+}
+
+// Writer writes the fragments of a file. Every fragment should start with a
+// keyframe.
+type Writer struct {
+	w          io.Writer
+	sequence   uint32
+	decodeTime uint64
+}
+
+// NewWriter writes the file header of the track to w.
+func NewWriter(w io.Writer, config Config) (*Writer, error) {
+	if config.Timescale == 0 {
+		return nil, errors.New("timescale is zero")
+	}
+	entry, width, height, err := sampleEntry(config)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(initSegment(config.Timescale, entry, width, height)); err != nil {
+		return nil, err
+	}
+	return &Writer{w: w}, nil
+}
+
+// WriteFragment writes the samples as a movie fragment.
+func (w *Writer) WriteFragment(samples []Sample) error {
+	if len(samples) == 0 {
+		return nil
+	}
+	w.sequence++
+
+	var mdatSize int
+	entries := make([]byte, 0, 12*len(samples))
+	for _, s := range samples {
+		size := 0
+		for _, nalu := range s.NALUs {
+			size += 4 + len(nalu)
+		}
+		mdatSize += size
+		flags := uint32(nonSyncSampleFlags)
+		if s.Keyframe {
+			flags = syncSampleFlags
+		}
+		entries = appendUint32(entries, s.Duration)
+		entries = appendUint32(entries, uint32(size))
+		entries = appendUint32(entries, flags)
+	}
+
+	// data-offset, sample-duration, sample-size and sample-flags present
+	trun := fullBox("trun", 0, 0x000701, appendUint32(appendUint32(nil, uint32(len(samples))), 0), entries)
+	traf := box("traf",
+		// default-base-is-moof
+		fullBox("tfhd", 0, 0x020000, appendUint32(nil, trackID)),
+		fullBox("tfdt", 1, 0, appendUint64(nil, w.decodeTime)),
+		trun,
+	)
+	moof := box("moof", fullBox("mfhd", 0, 0, appendUint32(nil, w.sequence)), traf)
+	// the data offset of trun is relative to the start of moof
+	dataOffset := len(moof) + 8
+	trunOffset := len(moof) - len(trun) + 16
+	binary.BigEndian.PutUint32(moof[trunOffset:], uint32(dataOffset))
+
+	mdat := make([]byte, 8, 8+mdatSize)
+	binary.BigEndian.PutUint32(mdat, uint32(8+mdatSize))
+	copy(mdat[4:], "mdat")
+	for _, s := range samples {
+		for _, nalu := range s.NALUs {
+			mdat = appendUint32(mdat, uint32(len(nalu)))
+			mdat = append(mdat, nalu...)
+		}
+		w.decodeTime += uint64(s.Duration)
+	}
+	if _, err := w.w.Write(moof); err != nil {
+		return err
+	}
+	_, err := w.w.Write(mdat)
+	return err
+}
+
+func initSegment(timescale uint32, entry []byte, width, height uint16) []byte {
+	ftyp := box("ftyp", []byte("iso5"), appendUint32(nil, 512), []byte("iso5iso6mp41"))
+
+	mvhd := fullBox("mvhd", 0, 0,
+		make([]byte, 8),                // creation and modification time
+		appendUint32(nil, 1000),        // timescale
+		make([]byte, 4),                // duration
+		appendUint32(nil, 0x10000),     // rate
+		[]byte{1, 0}, make([]byte, 10), // volume, reserved
+		matrix(),
+		make([]byte, 24),             // pre_defined
+		appendUint32(nil, trackID+1), // next_track_ID
+	)
+	tkhd := fullBox("tkhd", 0, 3, // enabled and in movie
+		make([]byte, 8), appendUint32(nil, trackID), make([]byte, 4), make([]byte, 4), // times, ID, reserved, duration
+		make([]byte, 8), make([]byte, 8), // reserved, layer, alternate group, volume, reserved
+		matrix(),
+		appendUint32(nil, uint32(width)<<16), appendUint32(nil, uint32(height)<<16),
+	)
+	mdhd := fullBox("mdhd", 0, 0,
+		make([]byte, 8), appendUint32(nil, timescale), make([]byte, 4),
+		[]byte{0x55, 0xc4, 0, 0}, // language und
+	)
+	hdlr := fullBox("hdlr", 0, 0, make([]byte, 4), []byte("vide"), make([]byte, 12), []byte("VideoHandler\x00"))
+	dinf := box("dinf", fullBox("dref", 0, 0, appendUint32(nil, 1), fullBox("url ", 0, 1)))
+	stbl := box("stbl",
+		fullBox("stsd", 0, 0, appendUint32(nil, 1), entry),
+		fullBox("stts", 0, 0, make([]byte, 4)),
+		fullBox("stsc", 0, 0, make([]byte, 4)),
+		fullBox("stsz", 0, 0, make([]byte, 8)),
+		fullBox("stco", 0, 0, make([]byte, 4)),
+	)
+	minf := box("minf", fullBox("vmhd", 0, 1, make([]byte, 8)), dinf, stbl)
+	trak := box("trak", tkhd, box("mdia", mdhd, hdlr, minf))
+	trex := fullBox("trex", 0, 0, appendUint32(nil, trackID), appendUint32(nil, 1), make([]byte, 12))
+	moov := box("moov", mvhd, trak, box("mvex", trex))
+	return append(ftyp, moov...)
+}
+
+// sampleEntry returns the avc1 or hvc1 sample entry of the track and the
+// picture size.
+func sampleEntry(config Config) ([]byte, uint16, uint16, error) {
+	if len(config.SPS) == 0 || len(config.PPS) == 0 {
+		return nil, 0, 0, errors.New("no parameter sets")
+	}
+	var typ string
+	var width, height int
+	var decoderConfig []byte
+	switch config.Codec {
+	case H264:
+		sps, err := parseH264SPS(config.SPS)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		typ, width, height = "avc1", sps.width, sps.height
+		decoderConfig = box("avcC", []byte{1, config.SPS[1], config.SPS[2], config.SPS[3], 0xff, 0xe1},
+			appendUint16(nil, uint16(len(config.SPS))), config.SPS,
+			[]byte{1}, appendUint16(nil, uint16(len(config.PPS))), config.PPS)
+	case H265:
+		if len(config.VPS) == 0 {
+			return nil, 0, 0, errors.New("no VPS")
+		}
+		sps, err := parseH265SPS(config.SPS)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		typ, width, height = "hvc1", sps.width, sps.height
+		decoderConfig = box("hvcC", hvcc(sps, config.VPS, config.SPS, config.PPS))
+	default:
+		return nil, 0, 0, fmt.Errorf("unsupported codec %q", config.Codec)
+	}
+	if width > 0xffff || height > 0xffff {
+		return nil, 0, 0, fmt.Errorf("picture size %dx%d too large", width, height)
+	}
+
+	return box(typ,
+		make([]byte, 6), appendUint16(nil, 1), // reserved, data_reference_index
+		make([]byte, 16), // pre_defined and reserved
+		appendUint16(nil, uint16(width)), appendUint16(nil, uint16(height)),
+		appendUint32(nil, 0x00480000), appendUint32(nil, 0x00480000), // 72 dpi
+		make([]byte, 4), appendUint16(nil, 1), // reserved, frame_count
+		make([]byte, 32),            // compressorname
+		[]byte{0, 0x18, 0xff, 0xff}, // depth, pre_defined
+		decoderConfig,
+	), uint16(width), uint16(height), nil
+}
+
+// hvcc returns the HEVCDecoderConfigurationRecord of the parameter sets.
+func hvcc(sps *h265SPS, vps, spsNALU, pps []byte) []byte {
+	record := []byte{1}
+	record = append(record, sps.profileTierLevel...)
+	record = append(record,
+		0xf0, 0x00, // min_spatial_segmentation_idc
+		0xfc,                                // parallelismType
+		0xfc|byte(sps.chromaFormat&3),       // chromaFormat
+		0xf8|byte((sps.bitDepthLuma-8)&7),   // bitDepthLumaMinus8
+		0xf8|byte((sps.bitDepthChroma-8)&7), // bitDepthChromaMinus8
+		0, 0,                                // avgFrameRate
+	)
+	nesting := byte(0)
+	if sps.temporalIDNesting {
+		nesting = 1
+	}
+	// constantFrameRate, numTemporalLayers, temporalIdNested, lengthSizeMinusOne
+	record = append(record, byte(sps.maxSubLayers&7)<<3|nesting<<2|3)
+	record = append(record, 3)
+	for _, nalu := range [][]byte{vps, spsNALU, pps} {
+		// array_completeness and the NAL unit type
+		record = append(record, 0x80|nalu[0]>>1&0x3f)
+		record = appendUint16(record, 1)
+		record = appendUint16(record, uint16(len(nalu)))
+		record = append(record, nalu...)
+	}
+	return record
+}
+
+func matrix() []byte {
+	var m []byte
+	for _, v := range []uint32{0x10000, 0, 0, 0, 0x10000, 0, 0, 0, 0x40000000} {
+		m = appendUint32(m, v)
+	}
+	return m
+}
+
+func box(typ string, payloads ...[]byte) []byte {
+	size := 8
+	for _, p := range payloads {
+		size += len(p)
+	}
+	b := make([]byte, 8, size)
+	binary.BigEndian.PutUint32(b, uint32(size))
+	copy(b[4:], typ)
+	for _, p := range payloads {
+		b = append(b, p...)
+	}
+	return b
+}
+
+func fullBox(typ string, version byte, flags uint32, payloads ...[]byte) []byte {
+	header := []byte{version, byte(flags >> 16), byte(flags >> 8), byte(flags)}
+	return box(typ, append([][]byte{header}, payloads...)...)
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func appendUint64(b []byte, v uint64) []byte {
+	return appendUint32(appendUint32(b, uint32(v>>32)), uint32(v))
+}
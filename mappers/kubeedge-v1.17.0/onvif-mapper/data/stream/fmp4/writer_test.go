@@ -0,0 +1,150 @@
+/*
+Copyright 2024 The KubeEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fmp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/kubeedge/onvif/data/stream/rtsp/rtsptest"
+)
+
+// boxes returns the boxes at the top of b by type, in order.
+func boxes(t *testing.T, b []byte) ([]string, map[string][]byte) {
+	t.Helper()
+	var types []string
+	payloads := make(map[string][]byte)
+	for len(b) > 0 {
+		if len(b) < 8 {
+			t.Fatalf("short box header %x", b)
+		}
+		size := int(binary.BigEndian.Uint32(b))
+		if size < 8 || size > len(b) {
+			t.Fatalf("box size %d out of %d bytes", size, len(b))
+		}
+		typ := string(b[4:8])
+		types = append(types, typ)
+		payloads[typ] = b[8:size]
+		b = b[size:]
+	}
+	return types, payloads
+}
+
+func TestSPSSize(t *testing.T) {
+	for _, size := range [][2]int{{1920, 1080}, {1280, 720}, {640, 480}, {352, 288}} {
+		h264, err := parseH264SPS(rtsptest.H264SPS(size[0], size[1]))
+		if err != nil {
+			t.Fatalf("H.264 %v: %v", size, err)
+		}
+		if h264.width != size[0] || h264.height != size[1] {
+			t.Errorf("H.264 size = %dx%d, want %dx%d", h264.width, h264.height, size[0], size[1])
+		}
+		h265, err := parseH265SPS(rtsptest.H265SPS(size[0], size[1]))
+		if err != nil {
+			t.Fatalf("H.265 %v: %v", size, err)
+		}
+		if h265.width != size[0] || h265.height != size[1] {
+			t.Errorf("H.265 size = %dx%d, want %dx%d", h265.width, h265.height, size[0], size[1])
+		}
+		if h265.chromaFormat != 1 || h265.bitDepthLuma != 8 || h265.maxSubLayers != 1 {
+			t.Errorf("H.265 SPS = %+v", h265)
+		}
+	}
+}
+
+func TestWriter(t *testing.T) {
+	tests := []struct {
+		codec  string
+		entry  string
+		config Config
+	}{
+		{
+			codec:  H264,
+			entry:  "avc1",
+			config: Config{Codec: H264, Timescale: 90000, SPS: rtsptest.H264SPS(1920, 1080), PPS: rtsptest.H264PPS()},
+		},
+		{
+			codec: H265,
+			entry: "hvc1",
+			config: Config{Codec: H265, Timescale: 90000, VPS: rtsptest.H265VPS(), SPS: rtsptest.H265SPS(1920, 1080),
+				PPS: rtsptest.H265PPS()},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.codec, func(t *testing.T) {
+			var buf bytes.Buffer
+			w, err := NewWriter(&buf, test.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			frames := rtsptest.Frames(test.codec, 6, 3, 100)
+			for gop := 0; gop < 2; gop++ {
+				var samples []Sample
+				for i := gop * 3; i < gop*3+3; i++ {
+					samples = append(samples, Sample{NALUs: frames[i], Duration: 3000, Keyframe: i%3 == 0})
+				}
+				if err = w.WriteFragment(samples); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			file := buf.Bytes()
+			types, top := boxes(t, file)
+			if want := []string{"ftyp", "moov", "moof", "mdat", "moof", "mdat"}; len(types) != len(want) {
+				t.Fatalf("boxes = %v, want %v", types, want)
+			}
+			if !bytes.Contains(top["moov"], []byte(test.entry)) {
+				t.Errorf("moov has no %s sample entry", test.entry)
+			}
+
+			// the second fragment, its decode time and its samples
+			moofStart := bytes.LastIndex(file, []byte("moof")) - 4
+			_, moof := boxes(t, file[moofStart:])
+			_, traf := boxes(t, moof["moof"][16:])
+			_, parts := boxes(t, traf["traf"])
+			if decodeTime := binary.BigEndian.Uint64(parts["tfdt"][4:]); decodeTime != 9000 {
+				t.Errorf("decode time = %d, want 9000", decodeTime)
+			}
+			trun := parts["trun"]
+			if count := binary.BigEndian.Uint32(trun[4:]); count != 3 {
+				t.Fatalf("sample count = %d, want 3", count)
+			}
+			dataOffset := int(binary.BigEndian.Uint32(trun[8:]))
+			data := file[moofStart+dataOffset:]
+			if size := int(binary.BigEndian.Uint32(data)); !bytes.Equal(data[4:4+size], frames[3][0]) {
+				t.Error("data offset does not point at the first sample")
+			}
+			if flags := binary.BigEndian.Uint32(trun[12+8:]); flags != syncSampleFlags {
+				t.Errorf("flags of the first sample = %#x, want %#x", flags, syncSampleFlags)
+			}
+		})
+	}
+}
+
+func TestWriterErrors(t *testing.T) {
+	var buf bytes.Buffer
+	if _, err := NewWriter(&buf, Config{Codec: H264, Timescale: 90000}); err == nil {
+		t.Error("no error without parameter sets")
+	}
+	if _, err := NewWriter(&buf, Config{Codec: H265, Timescale: 90000, SPS: rtsptest.H265SPS(64, 64), PPS: rtsptest.H265PPS()}); err == nil {
+		t.Error("no error without a VPS")
+	}
+	if _, err := NewWriter(&buf, Config{Codec: "VP8", Timescale: 90000, SPS: []byte{1}, PPS: []byte{1}}); err == nil {
+		t.Error("no error for an unsupported codec")
+	}
+}
@@ -17,8 +17,14 @@ limitations under the License.
 package stream
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
 
 	"k8s.io/klog/v2"
 
@@ -32,9 +38,13 @@ type StreamConfig struct {
 	FrameCount    int    `json:"frameCount"`
 	FrameInterval int    `json:"frameInterval"`
 	VideoNum      int    `json:"videoNum"`
+	Backend       string `json:"backend"`
+
+	Retention *driver.RetentionVisitorConfig `json:"retention"`
+	Upload    *driver.UploadVisitorConfig    `json:"upload"`
 }
 
-func StreamHandler(twin *common.Twin, client *driver.CustomizedClient, visitorConfig *driver.VisitorConfig) error {
+func StreamHandler(ctx context.Context, deviceID string, twin *common.Twin, client *driver.CustomizedClient, visitorConfig *driver.VisitorConfig) error {
 	// Get RTSP URI from camera device
 	streamURI, err := client.GetDeviceData(visitorConfig)
 	if err != nil {
@@ -49,13 +59,26 @@ func StreamHandler(twin *common.Twin, client *driver.CustomizedClient, visitorCo
 		return fmt.Errorf("Unmarshal streamConfigs error: %v", err)
 	}
 
+	backend, err := backendOf(streamConfig.Backend)
+	if err != nil {
+		return err
+	}
+	uri, err := withCredentials(streamURI.(string), client)
+	if err != nil {
+		return err
+	}
+	out, err := openArtifacts(ctx, deviceID, twin.PropertyName, &streamConfig)
+	if err != nil {
+		return err
+	}
+
 	switch twin.PropertyName {
 	// Currently, the function of saving frames and saving videos is built-in according to the configuration.
 	// Other functions can be expanded here.
 	case common.SaveFrame:
-		err = SaveFrame(streamURI.(string), streamConfig.OutputDir, streamConfig.Format, streamConfig.FrameCount, streamConfig.FrameInterval)
+		err = backend.SaveFrame(uri, out, streamConfig.Format, streamConfig.FrameCount, streamConfig.FrameInterval)
 	case common.SaveVideo:
-		err = SaveVideo(streamURI.(string), streamConfig.OutputDir, streamConfig.Format, streamConfig.FrameCount, streamConfig.VideoNum)
+		err = backend.SaveVideo(uri, out, streamConfig.Format, streamConfig.FrameCount, streamConfig.VideoNum)
 	default:
 		err = fmt.Errorf("cannot find the processing method for the corresponding Property %s of the stream data", twin.PropertyName)
 	}
@@ -65,3 +88,54 @@ func StreamHandler(twin *common.Twin, client *driver.CustomizedClient, visitorCo
 	klog.V(2).Infof("Successfully processed streaming data by %s", twin.PropertyName)
 	return nil
 }
+
+// withCredentials adds the credentials of the device to a stream URI without
+// them, cameras usually require the same ones for RTSP.
+func withCredentials(streamURI string, client *driver.CustomizedClient) (string, error) {
+	u, err := url.Parse(streamURI)
+	if err != nil {
+		// the error of url.Parse holds the URI, which may have a password
+		return "", fmt.Errorf("parse stream URI: %v", errors.Unwrap(err))
+	}
+	username, password := client.Credentials()
+	if u.User != nil || username == "" {
+		return streamURI, nil
+	}
+	u.User = url.UserPassword(username, password)
+	return u.String(), nil
+}
+
+// openArtifacts returns the artifacts of the stream property with the
+// retention and the upload of the stream configuration.
+func openArtifacts(ctx context.Context, deviceID string, property string, streamConfig *StreamConfig) (*Artifacts, error) {
+	var retention Retention
+	if r := streamConfig.Retention; r != nil {
+		retention = Retention{MaxFiles: r.MaxFiles, MaxBytes: r.MaxBytes}
+		if r.MaxAge != "" {
+			maxAge, err := time.ParseDuration(r.MaxAge)
+			if err != nil {
+				return nil, fmt.Errorf("parse retention maxAge: %v", err)
+			}
+			retention.MaxAge = maxAge
+		}
+	}
+
+	var upload *UploadConfig
+	if u := streamConfig.Upload; u != nil {
+		upload = &UploadConfig{
+			Endpoint:  u.Endpoint,
+			Region:    u.Region,
+			Bucket:    u.Bucket,
+			Prefix:    u.Prefix,
+			AccessKey: u.AccessKey,
+		}
+		if u.SecretKeyFile != "" {
+			secretKey, err := os.ReadFile(u.SecretKeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("read upload secret key: %v", err)
+			}
+			upload.SecretKey = strings.TrimSpace(string(secretKey))
+		}
+	}
+	return OpenArtifacts(ctx, deviceID, property, streamConfig.OutputDir, retention, upload)
+}
@@ -1,3 +1,5 @@
+//go:build ffmpeg
+
 /*
 Copyright 2024 The KubeEdge Authors.
 
@@ -29,14 +31,10 @@ import (
 	"k8s.io/klog/v2"
 )
 
-// GenFileName generate file name with current time. Formate f<year><month><day><hour><minute><second><millisecond>.<format>
-func GenFileName(dir string, format string) string {
-	return fmt.Sprintf("%s/f%s.%s", dir, time.Now().Format(time.RFC3339Nano), format)
-}
-
-func save(frame *avutil.Frame, width int, height int, dir string, format string) error {
-	// Save video frames to picture file
-	outputFile := GenFileName(dir, format)
+func save(frame *avutil.Frame, width int, height int, out *Artifacts, format string) error {
+	// Save video frames to a hidden picture file, renamed once it is complete
+	outputFile := out.TempPath(format)
+	defer out.Discard(outputFile)
 	var outputFmtCtx *avformat.Context
 	avformat.AvAllocOutputContext2(&outputFmtCtx, nil, nil, &outputFile)
 	if outputFmtCtx == nil {
@@ -104,11 +102,12 @@ func save(frame *avutil.Frame, width int, height int, dir string, format string)
 			return fmt.Errorf("close output fmt context failed: %v", err)
 		}
 	}
-	return nil
+	_, err = out.Commit(outputFile, KindFrame)
+	return err
 }
 
 // SaveFrame save frame.
-func SaveFrame(input string, outDir string, format string, frameCount int, frameInterval int) error {
+func SaveFrame(input string, out *Artifacts, format string, frameCount int, frameInterval int) error {
 	// Open video file
 	avformat.AvDictSet(&avformat.Dict, "rtsp_transport", "tcp", 0)
 	avformat.AvDictSet(&avformat.Dict, "max_delay", "5000000", 0)
@@ -229,7 +228,7 @@ func SaveFrame(input string, outDir string, format string, frameCount int, frame
 			avutil.Data(pFrameRGB), avutil.Linesize(pFrameRGB))
 
 		// Save the frame to disk
-		err := save(pFrameRGB, pCodecCtx.Width(), pCodecCtx.Height(), outDir, format)
+		err := save(pFrameRGB, pCodecCtx.Width(), pCodecCtx.Height(), out, format)
 		if err != nil {
 			klog.Error(err)
 			continue
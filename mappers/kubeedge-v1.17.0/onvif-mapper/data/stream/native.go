@@ -0,0 +1,256 @@
+/*
+Copyright 2024 The KubeEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stream
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"github.com/kubeedge/onvif/data/stream/fmp4"
+	"github.com/kubeedge/onvif/data/stream/rtsp"
+)
+
+// nativeBackend reads the stream over RTSP without decoding it. Frames of
+// MJPEG streams are saved as images, H.264 and H.265 streams are saved as
+// their keyframes and as fragmented MP4 videos.
+type nativeBackend struct{}
+
+var annexBStartCode = []byte{0, 0, 0, 1}
+
+func dial(uri string) (*rtsp.Client, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), rtsp.DefaultTimeout)
+	defer cancel()
+	client, err := rtsp.Dial(ctx, uri)
+	if err != nil {
+		return nil, fmt.Errorf("open stream: %v", err)
+	}
+	return client, nil
+}
+
+// SaveFrame saves the frames of MJPEG streams as JPEG or PNG images. Without
+// a decoder, frames of H.264 and H.265 streams are saved as keyframes in
+// Annex B byte stream files, so the format has to be h264 or h265.
+func (nativeBackend) SaveFrame(uri string, out *Artifacts, format string, frameCount int, frameInterval int) error {
+	client, err := dial(uri)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	track := &client.Track
+	if err = checkFrameFormat(track, format); err != nil {
+		return err
+	}
+	// the interval in units of the clock rate of the track
+	interval := int64(frameInterval) * int64(track.ClockRate) / int64(time.Second)
+	next := int64(0)
+	for frameNum := 0; frameNum < frameCount; {
+		frame, err := client.ReadFrame()
+		if err != nil {
+			return fmt.Errorf("read frame failed: %v", err)
+		}
+		if !frame.Keyframe || frame.Timestamp < next {
+			continue
+		}
+		data, ext, err := snapshot(track, frame, format)
+		if err != nil {
+			klog.Error(err)
+			continue
+		}
+		if _, err = out.WriteFile(ext, KindFrame, data); err != nil {
+			return err
+		}
+		frameNum++
+		next = frame.Timestamp + interval
+	}
+	return nil
+}
+
+// checkFrameFormat returns an error if frames of the track can not be saved
+// in the format.
+func checkFrameFormat(track *rtsp.Track, format string) error {
+	if track.Codec == rtsp.JPEG {
+		switch format {
+		case "jpg", "jpeg", "png":
+			return nil
+		}
+		return fmt.Errorf("unsupported frame format %q, use jpg or png", format)
+	}
+	if keyframes := strings.ToLower(track.Codec); format != keyframes {
+		return fmt.Errorf("the %s backend cannot save %s frames as %q, use the format %s or the %s backend",
+			BackendNative, track.Codec, format, keyframes, BackendFFmpeg)
+	}
+	return nil
+}
+
+// snapshot returns the file of a frame and its extension.
+func snapshot(track *rtsp.Track, frame *rtsp.Frame, format string) ([]byte, string, error) {
+	if track.Codec != rtsp.JPEG {
+		var buf bytes.Buffer
+		sets := [][]byte{track.SPS, track.PPS}
+		if track.Codec == rtsp.H265 {
+			sets = append([][]byte{track.VPS}, sets...)
+		}
+		for _, nalu := range append(sets, frame.NALUs...) {
+			buf.Write(annexBStartCode)
+			buf.Write(nalu)
+		}
+		return buf.Bytes(), strings.ToLower(track.Codec), nil
+	}
+
+	switch format {
+	case "jpg", "jpeg":
+		return frame.JPEG, format, nil
+	case "png":
+		img, err := jpeg.Decode(bytes.NewReader(frame.JPEG))
+		if err != nil {
+			return nil, "", fmt.Errorf("decode JPEG frame: %v", err)
+		}
+		var buf bytes.Buffer
+		if err = png.Encode(&buf, img); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), format, nil
+	}
+	return nil, "", fmt.Errorf("unsupported frame format %q, use jpg or png", format)
+}
+
+// SaveVideo saves H.264 and H.265 streams as fragmented MP4 videos with one
+// fragment per group of pictures. Every video starts with a keyframe.
+// Durations come from the timestamps of consecutive frames, so streams with
+// B-frames are not supported.
+func (nativeBackend) SaveVideo(uri string, out *Artifacts, format string, frameCount int, videoNum int) error {
+	if format != "mp4" {
+		return fmt.Errorf("unsupported video format %q, the %s backend writes mp4", format, BackendNative)
+	}
+	client, err := dial(uri)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	if client.Track.Codec != rtsp.H264 && client.Track.Codec != rtsp.H265 {
+		return fmt.Errorf("cannot save %s streams as videos without the %s backend", client.Track.Codec, BackendFFmpeg)
+	}
+
+	r := &clipRecorder{client: client}
+	for idx := 0; idx < videoNum; idx++ {
+		if err = r.record(out, format, frameCount); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// clipRecorder records consecutive videos of a stream. The frame after the
+// last one of a video is kept for the next one.
+type clipRecorder struct {
+	client  *rtsp.Client
+	pending *rtsp.Frame
+}
+
+func (r *clipRecorder) read() (*rtsp.Frame, error) {
+	if frame := r.pending; frame != nil {
+		r.pending = nil
+		return frame, nil
+	}
+	frame, err := r.client.ReadFrame()
+	if err != nil {
+		return nil, fmt.Errorf("read frame failed: %v", err)
+	}
+	return frame, nil
+}
+
+func (r *clipRecorder) record(out *Artifacts, format string, frameCount int) error {
+	first, err := r.read()
+	for err == nil && !first.Keyframe {
+		first, err = r.read()
+	}
+	if err != nil {
+		return err
+	}
+
+	tempPath := out.TempPath(format)
+	f, err := os.Create(tempPath)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	err = r.writeClip(w, r.client.Track, first, frameCount)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		out.Discard(tempPath)
+		return err
+	}
+	_, err = out.Commit(tempPath, KindVideo)
+	return err
+}
+
+func (r *clipRecorder) writeClip(out *bufio.Writer, track rtsp.Track, first *rtsp.Frame, frameCount int) error {
+	w, err := fmp4.NewWriter(out, fmp4.Config{
+		Codec:     track.Codec,
+		Timescale: uint32(track.ClockRate),
+		VPS:       track.VPS,
+		SPS:       track.SPS,
+		PPS:       track.PPS,
+	})
+	if err != nil {
+		return fmt.Errorf("write %s video: %v", track.Codec, err)
+	}
+
+	var gop []fmp4.Sample
+	frame := first
+	for frameNum := 1; ; frameNum++ {
+		next, err := r.read()
+		if err != nil {
+			return err
+		}
+		duration := next.Timestamp - frame.Timestamp
+		if duration <= 0 || duration > int64(^uint32(0)) {
+			return errors.New("frames are not in presentation order")
+		}
+		gop = append(gop, fmp4.Sample{NALUs: frame.NALUs, Duration: uint32(duration), Keyframe: frame.Keyframe})
+		if frameNum >= frameCount {
+			r.pending = next
+			return w.WriteFragment(gop)
+		}
+		if next.Keyframe {
+			if err = w.WriteFragment(gop); err != nil {
+				return err
+			}
+			gop = nil
+		}
+		frame = next
+	}
+}
@@ -0,0 +1,211 @@
+/*
+Copyright 2024 The KubeEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stream
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kubeedge/onvif/data/stream/rtsp/rtsptest"
+)
+
+func startServer(t *testing.T, stream rtsptest.Stream) *rtsptest.Server {
+	t.Helper()
+	server, err := rtsptest.NewServer(stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Close)
+	return server
+}
+
+// newArtifacts returns artifacts in a new directory, without uploads.
+func newArtifacts(t *testing.T) *Artifacts {
+	t.Helper()
+	a, err := loadArtifacts("camera", "stream", t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+// files returns the contents of the files in dir by name.
+func files(t *testing.T, dir, ext string) [][]byte {
+	t.Helper()
+	names, err := filepath.Glob(filepath.Join(dir, "*."+ext))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(names)
+	var contents [][]byte
+	for _, name := range names {
+		b, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents = append(contents, b)
+	}
+	return contents
+}
+
+func TestNativeSaveFrameJPEG(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 32, 16)), nil); err != nil {
+		t.Fatal(err)
+	}
+	server := startServer(t, rtsptest.Stream{Codec: rtsptest.JPEG, Images: [][]byte{buf.Bytes()}})
+
+	for _, format := range []string{"jpg", "png"} {
+		out := newArtifacts(t)
+		if err := (nativeBackend{}).SaveFrame(server.URL, out, format, 3, 0); err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if n := len(out.List(time.Time{})); n != 3 {
+			t.Errorf("%s: %d artifacts, want 3", format, n)
+		}
+		images := files(t, out.dir, format)
+		if len(images) != 3 {
+			t.Fatalf("%s: saved %d images, want 3", format, len(images))
+		}
+		decode := jpeg.Decode
+		if format == "png" {
+			decode = png.Decode
+		}
+		img, err := decode(bytes.NewReader(images[0]))
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if size := img.Bounds().Size(); size != image.Pt(32, 16) {
+			t.Errorf("%s: size = %v, want 32x16", format, size)
+		}
+	}
+}
+
+func TestNativeSaveFrameKeyframes(t *testing.T) {
+	sps, pps := rtsptest.H264SPS(640, 480), rtsptest.H264PPS()
+	server := startServer(t, rtsptest.Stream{
+		Codec:  rtsptest.H264,
+		SPS:    sps,
+		PPS:    pps,
+		Frames: rtsptest.Frames(rtsptest.H264, 10, 5, 2000),
+	})
+
+	out := newArtifacts(t)
+	// keyframes can not be decoded into images without ffmpeg
+	if err := (nativeBackend{}).SaveFrame(server.URL, out, "jpg", 2, 0); err == nil {
+		t.Fatal("no error for jpg frames of an H.264 stream")
+	}
+	if n := len(out.List(time.Time{})); n != 0 {
+		t.Fatalf("%d artifacts saved in the wrong format", n)
+	}
+	// 30 frames a second in stream time, 60 frames apart
+	if err := (nativeBackend{}).SaveFrame(server.URL, out, "h264", 2, int(2*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	keyframes := files(t, out.dir, "h264")
+	if len(keyframes) != 2 {
+		t.Fatalf("saved %d keyframes, want 2", len(keyframes))
+	}
+	nalus := bytes.Split(keyframes[0], []byte{0, 0, 0, 1})
+	if len(nalus) != 4 || !bytes.Equal(nalus[1], sps) || !bytes.Equal(nalus[2], pps) || nalus[3][0] != 0x65 {
+		t.Errorf("keyframe is not SPS, PPS and an IDR slice: %x", keyframes[0][:16])
+	}
+}
+
+func TestNativeSaveVideo(t *testing.T) {
+	server := startServer(t, rtsptest.Stream{
+		Codec:  rtsptest.H265,
+		VPS:    rtsptest.H265VPS(),
+		SPS:    rtsptest.H265SPS(1280, 720),
+		PPS:    rtsptest.H265PPS(),
+		InBand: true,
+		Frames: rtsptest.Frames(rtsptest.H265, 12, 4, 3000),
+	})
+
+	out := newArtifacts(t)
+	if err := (nativeBackend{}).SaveVideo(server.URL, out, "mp4", 10, 2); err != nil {
+		t.Fatal(err)
+	}
+	for _, artifact := range out.List(time.Time{}) {
+		if artifact.Kind != KindVideo {
+			t.Errorf("artifact %s is a %s", artifact.Name, artifact.Kind)
+		}
+	}
+	videos := files(t, out.dir, "mp4")
+	if len(videos) != 2 {
+		t.Fatalf("saved %d videos, want 2", len(videos))
+	}
+	for i, video := range videos {
+		var types []string
+		samples := 0
+		for b := video; len(b) >= 8; {
+			size := int(binary.BigEndian.Uint32(b))
+			if size < 8 || size > len(b) {
+				t.Fatalf("video %d: box size %d out of %d bytes", i, size, len(b))
+			}
+			types = append(types, string(b[4:8]))
+			if string(b[4:8]) == "moof" {
+				trun := bytes.Index(b[:size], []byte("trun"))
+				samples += int(binary.BigEndian.Uint32(b[trun+8:]))
+			}
+			b = b[size:]
+		}
+		// a fragment per group of 4 pictures
+		if got := strings.Join(types, " "); got != "ftyp moov moof mdat moof mdat moof mdat" {
+			t.Errorf("video %d: boxes = %s", i, got)
+		}
+		if samples != 10 {
+			t.Errorf("video %d: %d samples, want 10", i, samples)
+		}
+	}
+}
+
+func TestNativeSaveVideoErrors(t *testing.T) {
+	server := startServer(t, rtsptest.Stream{Codec: rtsptest.JPEG})
+	if err := (nativeBackend{}).SaveVideo(server.URL, newArtifacts(t), "mp4", 10, 1); err == nil {
+		t.Error("no error for an MJPEG stream")
+	}
+	if err := (nativeBackend{}).SaveVideo(server.URL, newArtifacts(t), "mkv", 10, 1); err == nil {
+		t.Error("no error for an mkv video")
+	}
+}
+
+func TestBackendOf(t *testing.T) {
+	if backend, err := backendOf(BackendNative); err != nil || backend != (nativeBackend{}) {
+		t.Errorf("backendOf(%q) = %v, %v", BackendNative, backend, err)
+	}
+	// ffmpeg is the default in builds that have it
+	want := Backend(nativeBackend{})
+	if ffmpeg, ok := backends[BackendFFmpeg]; ok {
+		want = ffmpeg
+	}
+	if backend, err := backendOf(""); err != nil || backend != want {
+		t.Errorf("backendOf(\"\") = %v, %v, want %v", backend, err, want)
+	}
+	if _, err := backendOf("gstreamer"); err == nil {
+		t.Error("no error for an unknown backend")
+	}
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2024 The KubeEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rtsp
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// authenticator answers the Basic or Digest challenge of a server.
+type authenticator struct {
+	username string
+	password string
+	digest   bool
+	realm    string
+	nonce    string
+	opaque   string
+	qop      string
+	cnonce   string
+	nc       int
+}
+
+// newAuthenticator picks Digest over Basic from the challenges.
+func newAuthenticator(challenges []string, user *url.Userinfo) (*authenticator, error) {
+	password, _ := user.Password()
+	a := &authenticator{username: user.Username(), password: password}
+	basic := false
+	for _, challenge := range challenges {
+		scheme, params := parseChallenge(challenge)
+		switch strings.ToLower(scheme) {
+		case "digest":
+			if algorithm := params["algorithm"]; algorithm != "" && !strings.EqualFold(algorithm, "MD5") {
+				continue
+			}
+			a.digest = true
+			a.realm = params["realm"]
+			a.nonce = params["nonce"]
+			a.opaque = params["opaque"]
+			for _, qop := range strings.Split(params["qop"], ",") {
+				if strings.TrimSpace(qop) == "auth" {
+					a.qop = "auth"
+				}
+			}
+			if a.qop != "" {
+				b := make([]byte, 8)
+				if _, err := rand.Read(b); err != nil {
+					return nil, err
+				}
+				a.cnonce = hex.EncodeToString(b)
+			}
+			return a, nil
+		case "basic":
+			basic = true
+		}
+	}
+	if !basic {
+		return nil, fmt.Errorf("unsupported authentication %q", challenges)
+	}
+	return a, nil
+}
+
+func (a *authenticator) authorization(method, uri string) string {
+	if !a.digest {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(a.username+":"+a.password))
+	}
+	ha1 := md5Hex(a.username + ":" + a.realm + ":" + a.password)
+	ha2 := md5Hex(method + ":" + uri)
+	header := fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s"`, a.username, a.realm, a.nonce, uri)
+	if a.qop != "" {
+		a.nc++
+		nc := fmt.Sprintf("%08x", a.nc)
+		response := md5Hex(ha1 + ":" + a.nonce + ":" + nc + ":" + a.cnonce + ":" + a.qop + ":" + ha2)
+		header += fmt.Sprintf(`, response="%s", qop=%s, nc=%s, cnonce="%s"`, response, a.qop, nc, a.cnonce)
+	} else {
+		header += fmt.Sprintf(`, response="%s"`, md5Hex(ha1+":"+a.nonce+":"+ha2))
+	}
+	if a.opaque != "" {
+		header += fmt.Sprintf(`, opaque="%s"`, a.opaque)
+	}
+	return header
+}
+
+// parseChallenge splits a WWW-Authenticate header into its scheme and
+// parameters.
+func parseChallenge(challenge string) (string, map[string]string) {
+	challenge = strings.TrimSpace(challenge)
+	scheme := challenge
+	rest := ""
+	if i := strings.IndexByte(challenge, ' '); i >= 0 {
+		scheme, rest = challenge[:i], challenge[i+1:]
+	}
+	params := make(map[string]string)
+	for rest != "" {
+		rest = strings.TrimLeft(rest, " ,")
+		i := strings.IndexByte(rest, '=')
+		if i < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(rest[:i]))
+		rest = strings.TrimLeft(rest[i+1:], " ")
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else if end := strings.IndexByte(rest, ','); end >= 0 {
+			value, rest = strings.TrimSpace(rest[:end]), rest[end+1:]
+		} else {
+			value, rest = strings.TrimSpace(rest), ""
+		}
+		params[key] = value
+	}
+	return scheme, params
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
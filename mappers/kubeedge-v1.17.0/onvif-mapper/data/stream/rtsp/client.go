@@ -0,0 +1,392 @@
+/*
+Copyright 2024 The KubeEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package rtsp is a small RTSP client that plays the video stream of a camera
+// over TCP and returns its frames: H.264 and H.265 access units or JPEG images.
+package rtsp
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// DefaultTimeout bounds every request and every read of the stream.
+const DefaultTimeout = 10 * time.Second
+
+const userAgent = "kubeedge-onvif-mapper"
+
+// Client plays the first video track of an RTSP stream. It is not safe for
+// concurrent use.
+type Client struct {
+	// Timeout bounds every request and every read of the stream.
+	Timeout time.Duration
+	// Track is the video track being played.
+	Track Track
+
+	conn    net.Conn
+	reader  *bufio.Reader
+	url     *url.URL
+	user    *url.Userinfo
+	auth    *authenticator
+	cseq    int
+	session string
+	// keepAlive is how often the session is refreshed, half its timeout
+	keepAlive time.Duration
+	lastSent  time.Time
+
+	depacketizer depacketizer
+	queue        []timedFrame // frames completed by the last packet
+	timestamps   timestampExtender
+}
+
+// Frame is a frame of the video track.
+type Frame struct {
+	// Timestamp is the presentation time in units of the clock rate of the
+	// track, counted from the first frame.
+	Timestamp int64
+	// Keyframe is set on frames that can be decoded on their own.
+	Keyframe bool
+	// NALUs are the NAL units of an H.264 or H.265 access unit, without
+	// start codes.
+	NALUs [][]byte
+	// JPEG is the image of a JPEG frame.
+	JPEG []byte
+}
+
+// Response is an RTSP response.
+type Response struct {
+	StatusCode int
+	Status     string
+	Header     textproto.MIMEHeader
+	Body       []byte
+}
+
+// Dial connects to the RTSP URI and starts playing its first video track.
+// Credentials are taken from the user info of the URI.
+func Dial(ctx context.Context, uri string) (*Client, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("parse %q: %v", redact(uri), errors.Unwrap(err))
+	}
+	if u.Scheme != "rtsp" {
+		return nil, fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "554")
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		Timeout: DefaultTimeout,
+		conn:    conn,
+		reader:  bufio.NewReaderSize(conn, 64*1024),
+		user:    u.User,
+	}
+	u.User = nil
+	c.url = u
+	if deadline, ok := ctx.Deadline(); ok {
+		c.Timeout = time.Until(deadline)
+	}
+	if err = c.start(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	c.Timeout = DefaultTimeout
+	return c, nil
+}
+
+// redact hides the password in the user info of a URI which can not be
+// parsed. Everything up to the last @ is taken as user info, a password may
+// contain slashes.
+func redact(uri string) string {
+	scheme := strings.Index(uri, "://")
+	if scheme < 0 {
+		return uri
+	}
+	rest := uri[scheme+3:]
+	at := strings.LastIndex(rest, "@")
+	if at < 0 {
+		return uri
+	}
+	user := rest[:at]
+	if colon := strings.Index(user, ":"); colon >= 0 {
+		user = user[:colon] + ":xxxxx"
+	}
+	return uri[:scheme+3] + user + rest[at:]
+}
+
+// start describes the stream, sets up its video track and plays it.
+func (c *Client) start() error {
+	resp, err := c.Do("DESCRIBE", c.url.String(), map[string]string{"Accept": "application/sdp"})
+	if err != nil {
+		return err
+	}
+	base := c.url.String()
+	if contentBase := resp.Header.Get("Content-Base"); contentBase != "" {
+		base = contentBase
+	}
+	if c.Track, err = parseSDP(resp.Body, base); err != nil {
+		return err
+	}
+	if c.depacketizer, err = newDepacketizer(&c.Track); err != nil {
+		return err
+	}
+
+	resp, err = c.Do("SETUP", c.Track.Control, map[string]string{"Transport": "RTP/AVP/TCP;unicast;interleaved=0-1"})
+	if err != nil {
+		return err
+	}
+	session := resp.Header.Get("Session")
+	if session == "" {
+		return errors.New("SETUP: no session")
+	}
+	c.session = session
+	c.keepAlive = 30 * time.Second
+	if i := strings.Index(session, ";"); i >= 0 {
+		c.session = strings.TrimSpace(session[:i])
+		for _, param := range strings.Split(session[i+1:], ";") {
+			param = strings.TrimSpace(param)
+			if !strings.HasPrefix(param, "timeout=") {
+				continue
+			}
+			if timeout, err := strconv.Atoi(strings.TrimPrefix(param, "timeout=")); err == nil && timeout > 1 {
+				c.keepAlive = time.Duration(timeout) * time.Second / 2
+			}
+		}
+	}
+	if transport := resp.Header.Get("Transport"); transport != "" && !strings.Contains(transport, "interleaved=0") {
+		return fmt.Errorf("SETUP: unsupported transport %q", transport)
+	}
+
+	playURL := base
+	if c.Track.SessionControl != "" {
+		playURL = c.Track.SessionControl
+	}
+	_, err = c.Do("PLAY", playURL, map[string]string{"Range": "npt=0.000-"})
+	return err
+}
+
+// Do sends a request and reads its response, logging in when the server asks
+// for credentials. Responses other than 200 OK are returned as errors.
+func (c *Client) Do(method, uri string, header map[string]string) (*Response, error) {
+	for attempt := 0; ; attempt++ {
+		if err := c.send(method, uri, header); err != nil {
+			return nil, err
+		}
+		resp, err := c.readResponse()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", method, err)
+		}
+		if resp.StatusCode == 401 && attempt == 0 && c.user != nil {
+			if c.auth, err = newAuthenticator(resp.Header.Values("WWW-Authenticate"), c.user); err != nil {
+				return nil, fmt.Errorf("%s: %v", method, err)
+			}
+			continue
+		}
+		if resp.StatusCode != 200 {
+			return nil, fmt.Errorf("%s: %d %s", method, resp.StatusCode, resp.Status)
+		}
+		return resp, nil
+	}
+}
+
+func (c *Client) send(method, uri string, header map[string]string) error {
+	c.cseq++
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s RTSP/1.0\r\nCSeq: %d\r\nUser-Agent: %s\r\n", method, uri, c.cseq, userAgent)
+	if c.session != "" {
+		fmt.Fprintf(&b, "Session: %s\r\n", c.session)
+	}
+	if c.auth != nil {
+		fmt.Fprintf(&b, "Authorization: %s\r\n", c.auth.authorization(method, uri))
+	}
+	for k, v := range header {
+		fmt.Fprintf(&b, "%s: %s\r\n", k, v)
+	}
+	b.WriteString("\r\n")
+
+	if err := c.conn.SetWriteDeadline(time.Now().Add(c.Timeout)); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(c.conn, b.String()); err != nil {
+		return fmt.Errorf("%s: %v", method, err)
+	}
+	c.lastSent = time.Now()
+	return nil
+}
+
+// readResponse reads the next response, skipping the RTP and RTCP packets
+// that may arrive before it.
+func (c *Client) readResponse() (*Response, error) {
+	for {
+		if err := c.conn.SetReadDeadline(time.Now().Add(c.Timeout)); err != nil {
+			return nil, err
+		}
+		b, err := c.reader.Peek(1)
+		if err != nil {
+			return nil, err
+		}
+		if b[0] == '$' {
+			if _, _, err = c.readInterleaved(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		return c.readMessage()
+	}
+}
+
+func (c *Client) readMessage() (*Response, error) {
+	tp := textproto.NewReader(c.reader)
+	line, err := tp.ReadLine()
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.SplitN(line, " ", 3)
+	if len(parts) < 2 || !strings.HasPrefix(parts[0], "RTSP/") {
+		return nil, fmt.Errorf("malformed status line %q", line)
+	}
+	resp := &Response{}
+	if resp.StatusCode, err = strconv.Atoi(parts[1]); err != nil {
+		return nil, fmt.Errorf("malformed status line %q", line)
+	}
+	if len(parts) == 3 {
+		resp.Status = parts[2]
+	}
+	if resp.Header, err = tp.ReadMIMEHeader(); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if length := resp.Header.Get("Content-Length"); length != "" {
+		n, err := strconv.Atoi(length)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("malformed Content-Length %q", length)
+		}
+		resp.Body = make([]byte, n)
+		if _, err = io.ReadFull(c.reader, resp.Body); err != nil {
+			return nil, err
+		}
+	}
+	return resp, nil
+}
+
+// readInterleaved reads an RTP or RTCP packet sent on the connection.
+func (c *Client) readInterleaved() (byte, []byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		return 0, nil, err
+	}
+	payload := make([]byte, binary.BigEndian.Uint16(header[2:]))
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return 0, nil, err
+	}
+	return header[1], payload, nil
+}
+
+// ReadFrame returns the next frame of the video track.
+func (c *Client) ReadFrame() (*Frame, error) {
+	for {
+		if len(c.queue) > 0 {
+			next := c.queue[0]
+			c.queue = c.queue[1:]
+			next.frame.Timestamp = c.timestamps.extend(next.timestamp)
+			return next.frame, nil
+		}
+		if time.Since(c.lastSent) > c.keepAlive {
+			// the response is skipped by the loop below
+			if err := c.send("GET_PARAMETER", c.url.String(), nil); err != nil {
+				return nil, err
+			}
+		}
+		if err := c.conn.SetReadDeadline(time.Now().Add(c.Timeout)); err != nil {
+			return nil, err
+		}
+		b, err := c.reader.Peek(1)
+		if err != nil {
+			return nil, err
+		}
+		if b[0] != '$' {
+			resp, err := c.readMessage()
+			if err != nil {
+				return nil, err
+			}
+			if resp.StatusCode != 200 {
+				klog.V(4).Infof("Keep alive of %s: %d %s", c.url.Redacted(), resp.StatusCode, resp.Status)
+			}
+			continue
+		}
+		channel, payload, err := c.readInterleaved()
+		if err != nil {
+			return nil, err
+		}
+		if channel != 0 {
+			continue
+		}
+		var packet rtpPacket
+		if err = packet.unmarshal(payload); err != nil {
+			klog.V(4).Infof("Skip RTP packet of %s: %v", c.url.Redacted(), err)
+			continue
+		}
+		if packet.payloadType != c.Track.PayloadType {
+			continue
+		}
+		c.queue = append(c.queue, c.depacketizer.push(&packet)...)
+	}
+}
+
+// Close tears the session down and closes the connection.
+func (c *Client) Close() error {
+	if c.session != "" {
+		c.Timeout = time.Second
+		if err := c.send("TEARDOWN", c.url.String(), nil); err != nil {
+			klog.V(4).Infof("Teardown %s: %v", c.url.Redacted(), err)
+		}
+	}
+	return c.conn.Close()
+}
+
+// timestampExtender counts RTP timestamps from the first one without
+// wrapping around.
+type timestampExtender struct {
+	started bool
+	last    uint32
+	value   int64
+}
+
+func (t *timestampExtender) extend(ts uint32) int64 {
+	if t.started {
+		t.value += int64(int32(ts - t.last))
+	}
+	t.started = true
+	t.last = ts
+	return t.value
+}
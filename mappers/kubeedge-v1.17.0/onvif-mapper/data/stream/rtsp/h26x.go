@@ -0,0 +1,123 @@
+/*
+Copyright 2024 The KubeEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rtsp
+
+import (
+	"errors"
+	"fmt"
+)
+
+// H.264 NAL unit types, RFC 6184.
+const (
+	h264NALUIDR   = 5
+	h264NALUSPS   = 7
+	h264NALUPPS   = 8
+	h264NALUAUD   = 9
+	h264NALUSTAPA = 24
+	h264NALUFUA   = 28
+)
+
+// H.265 NAL unit types, RFC 7798.
+const (
+	h265NALUBLAWLP  = 16
+	h265NALURSVIRAP = 23
+	h265NALUVPS     = 32
+	h265NALUSPS     = 33
+	h265NALUPPS     = 34
+	h265NALUAUD     = 35
+	h265NALUAP      = 48
+	h265NALUFU      = 49
+)
+
+type h264Codec struct{}
+
+func (h264Codec) unpack(payload []byte, nalus [][]byte, fragment *[]byte) ([][]byte, error) {
+	if len(payload) < 1 {
+		return nil, errors.New("empty payload")
+	}
+	switch typ := payload[0] & 0x1f; {
+	case typ >= 1 && typ <= 23:
+		return append(nalus, copyBytes(payload)), nil
+	case typ == h264NALUSTAPA:
+		return unpackAggregate(payload[1:], nalus)
+	case typ == h264NALUFUA:
+		if len(payload) < 2 {
+			return nil, errors.New("short FU-A")
+		}
+		header := []byte{payload[0]&0xe0 | payload[1]&0x1f}
+		return unpackFragment(header, payload[2:], payload[1]&0x80 != 0, payload[1]&0x40 != 0, nalus, fragment)
+	default:
+		return nil, fmt.Errorf("unsupported packet type %d", typ)
+	}
+}
+
+func (h264Codec) classify(track *Track, nalu []byte) (bool, bool) {
+	switch nalu[0] & 0x1f {
+	case h264NALUIDR:
+		return true, true
+	case h264NALUSPS:
+		track.SPS = nalu
+		return false, false
+	case h264NALUPPS:
+		track.PPS = nalu
+		return false, false
+	case h264NALUAUD:
+		return false, false
+	}
+	return false, true
+}
+
+type h265Codec struct{}
+
+func (h265Codec) unpack(payload []byte, nalus [][]byte, fragment *[]byte) ([][]byte, error) {
+	if len(payload) < 2 {
+		return nil, errors.New("short payload")
+	}
+	switch typ := payload[0] >> 1 & 0x3f; {
+	case typ < h265NALUAP:
+		return append(nalus, copyBytes(payload)), nil
+	case typ == h265NALUAP:
+		return unpackAggregate(payload[2:], nalus)
+	case typ == h265NALUFU:
+		if len(payload) < 3 {
+			return nil, errors.New("short FU")
+		}
+		header := []byte{payload[0]&0x81 | (payload[2]&0x3f)<<1, payload[1]}
+		return unpackFragment(header, payload[3:], payload[2]&0x80 != 0, payload[2]&0x40 != 0, nalus, fragment)
+	default:
+		return nil, fmt.Errorf("unsupported packet type %d", typ)
+	}
+}
+
+func (h265Codec) classify(track *Track, nalu []byte) (bool, bool) {
+	switch typ := nalu[0] >> 1 & 0x3f; {
+	case typ >= h265NALUBLAWLP && typ <= h265NALURSVIRAP:
+		return true, true
+	case typ == h265NALUVPS:
+		track.VPS = nalu
+		return false, false
+	case typ == h265NALUSPS:
+		track.SPS = nalu
+		return false, false
+	case typ == h265NALUPPS:
+		track.PPS = nalu
+		return false, false
+	case typ == h265NALUAUD:
+		return false, false
+	}
+	return false, true
+}
@@ -0,0 +1,296 @@
+/*
+Copyright 2024 The KubeEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rtsp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"k8s.io/klog/v2"
+)
+
+// jpegDepacketizer assembles JPEG images from RTP packets, RFC 2435. The
+// headers the payload format leaves out are written from its parameters.
+type jpegDepacketizer struct {
+	data      []byte
+	header    jpegHeader
+	timestamp uint32
+	started   bool
+	broken    bool
+	lastSeq   uint16
+	seqKnown  bool
+	// tables sent in band, by Q value, for packets that refer to them
+	tables map[uint8][]byte
+}
+
+type jpegHeader struct {
+	typ             uint8
+	q               uint8
+	width, height   int
+	restartInterval uint16
+	tables          []byte
+}
+
+func (d *jpegDepacketizer) push(p *rtpPacket) []timedFrame {
+	var frames []timedFrame
+	if d.seqKnown && p.sequenceNumber != d.lastSeq+1 {
+		d.broken = true
+	}
+	d.seqKnown = true
+	d.lastSeq = p.sequenceNumber
+	if d.started && p.timestamp != d.timestamp {
+		klog.V(4).Info("Drop JPEG frame without its last packet")
+		d.reset()
+	}
+
+	if err := d.unpack(p); err != nil {
+		klog.V(4).Infof("Invalid JPEG packet: %v", err)
+		d.broken = true
+	}
+	if p.marker {
+		if !d.broken && d.started {
+			frames = append(frames, timedFrame{frame: &Frame{Keyframe: true, JPEG: d.image()}, timestamp: d.timestamp})
+		} else {
+			klog.V(4).Info("Drop incomplete JPEG frame")
+		}
+		d.reset()
+	}
+	return frames
+}
+
+func (d *jpegDepacketizer) reset() {
+	d.data, d.started, d.broken = nil, false, false
+}
+
+func (d *jpegDepacketizer) unpack(p *rtpPacket) error {
+	b := p.payload
+	if len(b) < 8 {
+		return errors.New("short header")
+	}
+	offset := int(b[1])<<16 | int(b[2])<<8 | int(b[3])
+	header := jpegHeader{typ: b[4], q: b[5], width: int(b[6]) * 8, height: int(b[7]) * 8}
+	b = b[8:]
+	if header.typ >= 64 && header.typ <= 127 {
+		if len(b) < 4 {
+			return errors.New("short restart marker header")
+		}
+		header.restartInterval = binary.BigEndian.Uint16(b)
+		header.typ -= 64
+		b = b[4:]
+	}
+	if header.typ > 1 {
+		return fmt.Errorf("unsupported type %d", header.typ)
+	}
+
+	if offset == 0 {
+		if header.q >= 128 {
+			if len(b) < 4 {
+				return errors.New("short quantization table header")
+			}
+			length := int(binary.BigEndian.Uint16(b[2:]))
+			if len(b) < 4+length {
+				return errors.New("short quantization tables")
+			}
+			if length > 0 {
+				if d.tables == nil {
+					d.tables = make(map[uint8][]byte)
+				}
+				d.tables[header.q] = dqt(b[1], b[4:4+length])
+			}
+			b = b[4+length:]
+			if header.tables = d.tables[header.q]; header.tables == nil {
+				return fmt.Errorf("no quantization tables for Q %d", header.q)
+			}
+		} else {
+			header.tables = standardTables(int(header.q))
+		}
+		d.reset()
+		d.started = true
+		d.timestamp = p.timestamp
+		d.header = header
+	} else if !d.started || offset != len(d.data) {
+		return fmt.Errorf("fragment at %d, want %d", offset, len(d.data))
+	}
+	d.data = append(d.data, b...)
+	return nil
+}
+
+// image returns the JPEG file of the collected scan.
+func (d *jpegDepacketizer) image() []byte {
+	h := d.header
+	var buf bytes.Buffer
+	buf.Write([]byte{0xff, 0xd8})
+	buf.Write(h.tables)
+
+	// baseline frame with Y, Cb and Cr, Y subsampled 2x1 or 2x2
+	ySampling := byte(0x21)
+	if h.typ == 1 {
+		ySampling = 0x22
+	}
+	buf.Write([]byte{0xff, 0xc0, 0, 17, 8, byte(h.height >> 8), byte(h.height), byte(h.width >> 8), byte(h.width), 3,
+		0, ySampling, 0, 1, 0x11, 1, 2, 0x11, 1})
+	for i, spec := range huffmanSpecs {
+		length := 2 + 1 + 16 + len(spec.values)
+		buf.Write([]byte{0xff, 0xc4, byte(length >> 8), byte(length), huffmanClasses[i]})
+		buf.Write(spec.counts[:])
+		buf.Write(spec.values)
+	}
+	if h.restartInterval != 0 {
+		buf.Write([]byte{0xff, 0xdd, 0, 4, byte(h.restartInterval >> 8), byte(h.restartInterval)})
+	}
+	buf.Write([]byte{0xff, 0xda, 0, 12, 3, 0, 0x00, 1, 0x11, 2, 0x11, 0, 63, 0})
+	buf.Write(d.data)
+	if !bytes.HasSuffix(d.data, []byte{0xff, 0xd9}) {
+		buf.Write([]byte{0xff, 0xd9})
+	}
+	return buf.Bytes()
+}
+
+// dqt returns the DQT segments of in-band tables, luma then chroma.
+func dqt(precision byte, tables []byte) []byte {
+	var buf bytes.Buffer
+	for id := 0; len(tables) > 0 && id < 4; id++ {
+		size := 64
+		if precision&(1<<id) != 0 {
+			size = 128
+		}
+		if len(tables) < size {
+			break
+		}
+		length := 2 + 1 + size
+		buf.Write([]byte{0xff, 0xdb, byte(length >> 8), byte(length), byte(size/128)<<4 | byte(id)})
+		buf.Write(tables[:size])
+		tables = tables[size:]
+	}
+	return buf.Bytes()
+}
+
+// standardTables returns the DQT segments of the tables of the JPEG standard
+// scaled by the quality factor q, the same way as the IJG library.
+func standardTables(q int) []byte {
+	if q < 1 {
+		q = 1
+	} else if q > 99 {
+		q = 99
+	}
+	scale := 200 - q*2
+	if q < 50 {
+		scale = 5000 / q
+	}
+	tables := make([]byte, 128)
+	for i, base := range append(lumaQuantizer[:], chromaQuantizer[:]...) {
+		v := (int(base)*scale + 50) / 100
+		if v < 1 {
+			v = 1
+		} else if v > 255 {
+			v = 255
+		}
+		tables[i] = byte(v)
+	}
+	return dqt(0, tables)
+}
+
+// lumaQuantizer and chromaQuantizer are table K.1 and K.2 of the JPEG
+// standard in zig-zag order.
+var lumaQuantizer = [64]byte{
+	16, 11, 12, 14, 12, 10, 16, 14, 13, 14, 18, 17, 16, 19, 24, 40,
+	26, 24, 22, 22, 24, 49, 35, 37, 29, 40, 58, 51, 61, 60, 57, 51,
+	56, 55, 64, 72, 92, 78, 64, 68, 87, 69, 55, 56, 80, 109, 81, 87,
+	95, 98, 103, 104, 103, 62, 77, 113, 121, 112, 100, 120, 92, 101, 103, 99,
+}
+
+var chromaQuantizer = [64]byte{
+	17, 18, 18, 24, 21, 24, 47, 26, 26, 47, 99, 66, 56, 66, 99, 99,
+	99, 99, 99, 99, 99, 99, 99, 99, 99, 99, 99, 99, 99, 99, 99, 99,
+	99, 99, 99, 99, 99, 99, 99, 99, 99, 99, 99, 99, 99, 99, 99, 99,
+	99, 99, 99, 99, 99, 99, 99, 99, 99, 99, 99, 99, 99, 99, 99, 99,
+}
+
+type huffmanSpec struct {
+	counts [16]byte
+	values []byte
+}
+
+// huffmanClasses are the class and destination of huffmanSpecs.
+var huffmanClasses = [4]byte{0x00, 0x10, 0x01, 0x11}
+
+// huffmanSpecs are the tables of section K.3 of the JPEG standard: luma DC,
+// luma AC, chroma DC and chroma AC.
+var huffmanSpecs = [4]huffmanSpec{
+	{
+		[16]byte{0, 1, 5, 1, 1, 1, 1, 1, 1, 0, 0, 0, 0, 0, 0, 0},
+		[]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+	},
+	{
+		[16]byte{0, 2, 1, 3, 3, 2, 4, 3, 5, 5, 4, 4, 0, 0, 1, 125},
+		[]byte{
+			0x01, 0x02, 0x03, 0x00, 0x04, 0x11, 0x05, 0x12,
+			0x21, 0x31, 0x41, 0x06, 0x13, 0x51, 0x61, 0x07,
+			0x22, 0x71, 0x14, 0x32, 0x81, 0x91, 0xa1, 0x08,
+			0x23, 0x42, 0xb1, 0xc1, 0x15, 0x52, 0xd1, 0xf0,
+			0x24, 0x33, 0x62, 0x72, 0x82, 0x09, 0x0a, 0x16,
+			0x17, 0x18, 0x19, 0x1a, 0x25, 0x26, 0x27, 0x28,
+			0x29, 0x2a, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39,
+			0x3a, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49,
+			0x4a, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59,
+			0x5a, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68, 0x69,
+			0x6a, 0x73, 0x74, 0x75, 0x76, 0x77, 0x78, 0x79,
+			0x7a, 0x83, 0x84, 0x85, 0x86, 0x87, 0x88, 0x89,
+			0x8a, 0x92, 0x93, 0x94, 0x95, 0x96, 0x97, 0x98,
+			0x99, 0x9a, 0xa2, 0xa3, 0xa4, 0xa5, 0xa6, 0xa7,
+			0xa8, 0xa9, 0xaa, 0xb2, 0xb3, 0xb4, 0xb5, 0xb6,
+			0xb7, 0xb8, 0xb9, 0xba, 0xc2, 0xc3, 0xc4, 0xc5,
+			0xc6, 0xc7, 0xc8, 0xc9, 0xca, 0xd2, 0xd3, 0xd4,
+			0xd5, 0xd6, 0xd7, 0xd8, 0xd9, 0xda, 0xe1, 0xe2,
+			0xe3, 0xe4, 0xe5, 0xe6, 0xe7, 0xe8, 0xe9, 0xea,
+			0xf1, 0xf2, 0xf3, 0xf4, 0xf5, 0xf6, 0xf7, 0xf8,
+			0xf9, 0xfa,
+		},
+	},
+	{
+		[16]byte{0, 3, 1, 1, 1, 1, 1, 1, 1, 1, 1, 0, 0, 0, 0, 0},
+		[]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+	},
+	{
+		[16]byte{0, 2, 1, 2, 4, 4, 3, 4, 7, 5, 4, 4, 0, 1, 2, 119},
+		[]byte{
+			0x00, 0x01, 0x02, 0x03, 0x11, 0x04, 0x05, 0x21,
+			0x31, 0x06, 0x12, 0x41, 0x51, 0x07, 0x61, 0x71,
+			0x13, 0x22, 0x32, 0x81, 0x08, 0x14, 0x42, 0x91,
+			0xa1, 0xb1, 0xc1, 0x09, 0x23, 0x33, 0x52, 0xf0,
+			0x15, 0x62, 0x72, 0xd1, 0x0a, 0x16, 0x24, 0x34,
+			0xe1, 0x25, 0xf1, 0x17, 0x18, 0x19, 0x1a, 0x26,
+			0x27, 0x28, 0x29, 0x2a, 0x35, 0x36, 0x37, 0x38,
+			0x39, 0x3a, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48,
+			0x49, 0x4a, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58,
+			0x59, 0x5a, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68,
+			0x69, 0x6a, 0x73, 0x74, 0x75, 0x76, 0x77, 0x78,
+			0x79, 0x7a, 0x82, 0x83, 0x84, 0x85, 0x86, 0x87,
+			0x88, 0x89, 0x8a, 0x92, 0x93, 0x94, 0x95, 0x96,
+			0x97, 0x98, 0x99, 0x9a, 0xa2, 0xa3, 0xa4, 0xa5,
+			0xa6, 0xa7, 0xa8, 0xa9, 0xaa, 0xb2, 0xb3, 0xb4,
+			0xb5, 0xb6, 0xb7, 0xb8, 0xb9, 0xba, 0xc2, 0xc3,
+			0xc4, 0xc5, 0xc6, 0xc7, 0xc8, 0xc9, 0xca, 0xd2,
+			0xd3, 0xd4, 0xd5, 0xd6, 0xd7, 0xd8, 0xd9, 0xda,
+			0xe2, 0xe3, 0xe4, 0xe5, 0xe6, 0xe7, 0xe8, 0xe9,
+			0xea, 0xf2, 0xf3, 0xf4, 0xf5, 0xf6, 0xf7, 0xf8,
+			0xf9, 0xfa,
+		},
+	},
+}
@@ -0,0 +1,207 @@
+/*
+Copyright 2024 The KubeEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rtsp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"k8s.io/klog/v2"
+)
+
+type rtpPacket struct {
+	marker         bool
+	payloadType    uint8
+	sequenceNumber uint16
+	timestamp      uint32
+	payload        []byte
+}
+
+func (p *rtpPacket) unmarshal(b []byte) error {
+	if len(b) < 12 {
+		return errors.New("short packet")
+	}
+	if b[0]>>6 != 2 {
+		return fmt.Errorf("RTP version %d", b[0]>>6)
+	}
+	p.marker = b[1]&0x80 != 0
+	p.payloadType = b[1] & 0x7f
+	p.sequenceNumber = binary.BigEndian.Uint16(b[2:])
+	p.timestamp = binary.BigEndian.Uint32(b[4:])
+	offset := 12 + 4*int(b[0]&0x0f)
+	if b[0]&0x10 != 0 {
+		if len(b) < offset+4 {
+			return errors.New("short extension header")
+		}
+		offset += 4 + 4*int(binary.BigEndian.Uint16(b[offset+2:]))
+	}
+	end := len(b)
+	if b[0]&0x20 != 0 && end > 0 {
+		end -= int(b[end-1])
+	}
+	if offset > end {
+		return errors.New("short packet")
+	}
+	p.payload = b[offset:end]
+	return nil
+}
+
+// depacketizer assembles the frames of a track from its RTP packets.
+type depacketizer interface {
+	// push adds a packet and returns the frames it completes, with their
+	// RTP timestamps.
+	push(p *rtpPacket) []timedFrame
+}
+
+type timedFrame struct {
+	frame     *Frame
+	timestamp uint32
+}
+
+func newDepacketizer(track *Track) (depacketizer, error) {
+	switch track.Codec {
+	case H264:
+		return &nalDepacketizer{track: track, codec: h264Codec{}}, nil
+	case H265:
+		return &nalDepacketizer{track: track, codec: h265Codec{}}, nil
+	case JPEG:
+		return &jpegDepacketizer{}, nil
+	}
+	return nil, fmt.Errorf("unsupported codec %q", track.Codec)
+}
+
+// nalCodec is what differs between the H.264 and H.265 payload formats.
+type nalCodec interface {
+	// unpack appends the NAL units of the payload to nalus. Fragments are
+	// collected in fragment until the last one arrives.
+	unpack(payload []byte, nalus [][]byte, fragment *[]byte) ([][]byte, error)
+	// classify tells whether the NAL unit is part of a keyframe, a parameter
+	// set to keep on the track, or to be dropped.
+	classify(track *Track, nalu []byte) (keyframe bool, keep bool)
+}
+
+// nalDepacketizer assembles the access units of H.264 and H.265 tracks. An
+// access unit ends with the marker bit or when the timestamp changes, and is
+// dropped when some of its packets are lost.
+type nalDepacketizer struct {
+	track *Track
+	codec nalCodec
+
+	nalus     [][]byte
+	fragment  []byte
+	timestamp uint32
+	started   bool
+	broken    bool
+	lastSeq   uint16
+	seqKnown  bool
+}
+
+func (d *nalDepacketizer) push(p *rtpPacket) []timedFrame {
+	var frames []timedFrame
+	// lost packets may belong to the pending access unit or to this one
+	lost := d.seqKnown && p.sequenceNumber != d.lastSeq+1
+	d.seqKnown = true
+	d.lastSeq = p.sequenceNumber
+	if d.started && p.timestamp != d.timestamp {
+		d.broken = d.broken || lost
+		frames = d.flush(frames)
+	}
+	if lost {
+		d.broken = true
+		d.fragment = nil
+	}
+	if !d.started {
+		d.started = true
+		d.timestamp = p.timestamp
+	}
+
+	nalus, err := d.codec.unpack(p.payload, d.nalus, &d.fragment)
+	if err != nil {
+		klog.V(4).Infof("Invalid %s packet: %v", d.track.Codec, err)
+		d.broken = true
+		d.fragment = nil
+	} else {
+		d.nalus = nalus
+	}
+	if p.marker {
+		frames = d.flush(frames)
+	}
+	return frames
+}
+
+func (d *nalDepacketizer) flush(frames []timedFrame) []timedFrame {
+	nalus, broken := d.nalus, d.broken || d.fragment != nil
+	d.nalus, d.fragment, d.started, d.broken = nil, nil, false, false
+	if broken {
+		klog.V(4).Infof("Drop incomplete %s access unit", d.track.Codec)
+		return frames
+	}
+	frame := &Frame{}
+	for _, nalu := range nalus {
+		keyframe, keep := d.codec.classify(d.track, nalu)
+		frame.Keyframe = frame.Keyframe || keyframe
+		if keep {
+			frame.NALUs = append(frame.NALUs, nalu)
+		}
+	}
+	if len(frame.NALUs) == 0 {
+		return frames
+	}
+	return append(frames, timedFrame{frame: frame, timestamp: d.timestamp})
+}
+
+// unpackAggregate appends the NAL units of an aggregation packet, each one
+// preceded by its 16 bit size.
+func unpackAggregate(b []byte, nalus [][]byte) ([][]byte, error) {
+	for len(b) > 0 {
+		if len(b) < 2 {
+			return nil, errors.New("short aggregation unit")
+		}
+		size := int(binary.BigEndian.Uint16(b))
+		if size == 0 || len(b) < 2+size {
+			return nil, errors.New("invalid aggregation unit size")
+		}
+		nalus = append(nalus, copyBytes(b[2:2+size]))
+		b = b[2+size:]
+	}
+	return nalus, nil
+}
+
+// unpackFragment collects a fragment of a NAL unit whose header is header.
+func unpackFragment(header []byte, data []byte, start, end bool, nalus [][]byte, fragment *[]byte) ([][]byte, error) {
+	if start {
+		if *fragment != nil {
+			return nil, errors.New("fragment started twice")
+		}
+		*fragment = append(append([]byte{}, header...), data...)
+	} else {
+		if *fragment == nil {
+			return nil, errors.New("fragment without start")
+		}
+		*fragment = append(*fragment, data...)
+	}
+	if end {
+		nalus = append(nalus, *fragment)
+		*fragment = nil
+	}
+	return nalus, nil
+}
+
+func copyBytes(b []byte) []byte {
+	return append([]byte{}, b...)
+}
@@ -0,0 +1,187 @@
+/*
+Copyright 2024 The KubeEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rtsptest
+
+// H264SPS returns a baseline profile SPS of the picture size.
+func H264SPS(width, height int) []byte {
+	w := &bitWriter{}
+	w.bits(66, 8)   // profile_idc
+	w.bits(0xc0, 8) // constraint flags
+	w.bits(31, 8)   // level_idc
+	w.ue(0)         // seq_parameter_set_id
+	w.ue(0)         // log2_max_frame_num_minus4
+	w.ue(2)         // pic_order_cnt_type
+	w.ue(1)         // max_num_ref_frames
+	w.bits(0, 1)    // gaps_in_frame_num_value_allowed_flag
+	widthInMbs, heightInMbs := (width+15)/16, (height+15)/16
+	w.ue(widthInMbs - 1)
+	w.ue(heightInMbs - 1)
+	w.bits(1, 1) // frame_mbs_only_flag
+	w.bits(1, 1) // direct_8x8_inference_flag
+	if widthInMbs*16 != width || heightInMbs*16 != height {
+		w.bits(1, 1)
+		w.ue(0)
+		w.ue((widthInMbs*16 - width) / 2)
+		w.ue(0)
+		w.ue((heightInMbs*16 - height) / 2)
+	} else {
+		w.bits(0, 1)
+	}
+	w.bits(0, 1) // vui_parameters_present_flag
+	return append([]byte{0x67}, escape(w.trailing())...)
+}
+
+// H264PPS returns a PPS for H264SPS.
+func H264PPS() []byte {
+	return []byte{0x68, 0xce, 0x3c, 0x80}
+}
+
+// H265VPS returns a Main profile VPS.
+func H265VPS() []byte {
+	return []byte{0x40, 0x01, 0x0c, 0x01, 0xff, 0xff, 0x01, 0x60, 0x00, 0x00, 0x03, 0x00, 0x90, 0x00, 0x00, 0x03,
+		0x00, 0x00, 0x03, 0x00, 0x5d, 0x95, 0x98, 0x09}
+}
+
+// H265SPS returns a Main profile SPS of the picture size.
+func H265SPS(width, height int) []byte {
+	w := &bitWriter{}
+	w.bits(0, 4)           // sps_video_parameter_set_id
+	w.bits(0, 3)           // sps_max_sub_layers_minus1
+	w.bits(1, 1)           // sps_temporal_id_nesting_flag
+	w.bits(1, 8)           // general_profile_space, tier and profile_idc
+	w.bits(0x60000000, 32) // general_profile_compatibility_flags
+	w.bits(0x9, 4)         // progressive, interlaced, non packed and frame only
+	w.bits(0, 44)
+	w.bits(93, 8) // general_level_idc
+	w.ue(0)       // sps_seq_parameter_set_id
+	w.ue(1)       // chroma_format_idc
+	codedWidth, codedHeight := (width+7)/8*8, (height+7)/8*8
+	w.ue(codedWidth)
+	w.ue(codedHeight)
+	if codedWidth != width || codedHeight != height {
+		w.bits(1, 1)
+		w.ue(0)
+		w.ue((codedWidth - width) / 2)
+		w.ue(0)
+		w.ue((codedHeight - height) / 2)
+	} else {
+		w.bits(0, 1)
+	}
+	w.ue(0) // bit_depth_luma_minus8
+	w.ue(0) // bit_depth_chroma_minus8
+	w.ue(4) // log2_max_pic_order_cnt_lsb_minus4
+	return append([]byte{0x42, 0x01}, escape(w.trailing())...)
+}
+
+// H265PPS returns a PPS for H265SPS.
+func H265PPS() []byte {
+	return []byte{0x44, 0x01, 0xc1, 0x72, 0xb4, 0x62, 0x40}
+}
+
+// Frames returns count access units of a single slice of size bytes, a
+// keyframe every gop frames starting with the first.
+func Frames(codec string, count, gop, size int) [][][]byte {
+	frames := make([][][]byte, count)
+	for i := range frames {
+		var header []byte
+		keyframe := i%gop == 0
+		switch {
+		case codec == H265 && keyframe:
+			header = []byte{19 << 1, 1} // IDR_W_RADL
+		case codec == H265:
+			header = []byte{1 << 1, 1} // TRAIL_R
+		case keyframe:
+			header = []byte{0x65}
+		default:
+			header = []byte{0x41}
+		}
+		slice := append(header, make([]byte, size-len(header))...)
+		for j := len(header); j < size; j++ {
+			// never zero, so that the slice has no start code
+			slice[j] = byte(1 + (i*31+j)%255)
+		}
+		frames[i] = [][]byte{slice}
+	}
+	return frames
+}
+
+// IsKeyframe reports whether an access unit holds an IDR or IRAP picture.
+func IsKeyframe(codec string, frame [][]byte) bool {
+	for _, nalu := range frame {
+		if codec == H265 {
+			if typ := nalu[0] >> 1 & 0x3f; typ >= 16 && typ <= 23 {
+				return true
+			}
+		} else if nalu[0]&0x1f == 5 {
+			return true
+		}
+	}
+	return false
+}
+
+// escape adds emulation prevention bytes to the payload of a NAL unit.
+func escape(b []byte) []byte {
+	out := make([]byte, 0, len(b))
+	zeros := 0
+	for _, c := range b {
+		if zeros >= 2 && c <= 3 {
+			out = append(out, 3)
+			zeros = 0
+		}
+		if c == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+type bitWriter struct {
+	data []byte
+	n    int
+}
+
+func (w *bitWriter) bits(v uint64, n int) {
+	for i := n - 1; i >= 0; i-- {
+		if w.n%8 == 0 {
+			w.data = append(w.data, 0)
+		}
+		w.data[len(w.data)-1] |= byte(v>>uint(i)&1) << (7 - uint(w.n%8))
+		w.n++
+	}
+}
+
+// ue writes an unsigned Exp-Golomb code.
+func (w *bitWriter) ue(v int) {
+	length := 0
+	for x := v + 1; x > 1; x >>= 1 {
+		length++
+	}
+	w.bits(0, length)
+	w.bits(uint64(v+1), length+1)
+}
+
+// trailing writes the RBSP trailing bits and returns the payload.
+func (w *bitWriter) trailing() []byte {
+	w.bits(1, 1)
+	for w.n%8 != 0 {
+		w.bits(0, 1)
+	}
+	return w.data
+}
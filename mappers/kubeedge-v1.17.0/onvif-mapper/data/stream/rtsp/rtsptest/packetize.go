@@ -0,0 +1,132 @@
+/*
+Copyright 2024 The KubeEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rtsptest
+
+import (
+	"encoding/binary"
+)
+
+// packetizeNALUs returns the RTP payloads of an access unit. Parameter sets
+// sent in band are aggregated, large NAL units are fragmented.
+func (s *Server) packetizeNALUs(frame [][]byte) [][]byte {
+	var payloads [][]byte
+	if s.stream.InBand && IsKeyframe(s.stream.Codec, frame) {
+		sets := [][]byte{s.stream.SPS, s.stream.PPS}
+		header := []byte{0x78} // STAP-A
+		if s.stream.Codec == H265 {
+			sets = append([][]byte{s.stream.VPS}, sets...)
+			header = []byte{48 << 1, 1} // AP
+		}
+		payload := append([]byte{}, header...)
+		for _, nalu := range sets {
+			payload = append(payload, byte(len(nalu)>>8), byte(len(nalu)))
+			payload = append(payload, nalu...)
+		}
+		payloads = append(payloads, payload)
+	}
+	for _, nalu := range frame {
+		if len(nalu) <= mtu {
+			payloads = append(payloads, nalu)
+			continue
+		}
+		var header []byte
+		var data []byte
+		switch s.stream.Codec {
+		case H265:
+			header = []byte{nalu[0]&0x81 | 49<<1, nalu[1], nalu[0] >> 1 & 0x3f}
+			data = nalu[2:]
+		default:
+			header = []byte{nalu[0]&0xe0 | 28, nalu[0] & 0x1f}
+			data = nalu[1:]
+		}
+		for start := true; len(data) > 0; start = false {
+			n := mtu
+			if n > len(data) {
+				n = len(data)
+			}
+			payload := append([]byte{}, header...)
+			if start {
+				payload[len(payload)-1] |= 0x80
+			}
+			if n == len(data) {
+				payload[len(payload)-1] |= 0x40
+			}
+			payloads = append(payloads, append(payload, data[:n]...))
+			data = data[n:]
+		}
+	}
+	return payloads
+}
+
+// packetizeJPEG returns the RTP payloads of a JPEG file, RFC 2435. The
+// tables are sent in band unless quality is set.
+func packetizeJPEG(image []byte, quality int) [][]byte {
+	var tables []byte
+	var width, height int
+	typ := byte(1)
+	var restartInterval uint16
+	var scan []byte
+	for i := 2; i+4 <= len(image) && scan == nil; {
+		marker := image[i+1]
+		length := int(binary.BigEndian.Uint16(image[i+2:]))
+		segment := image[i+4 : i+2+length]
+		switch marker {
+		case 0xdb: // DQT
+			for len(segment) >= 65 {
+				tables = append(tables, segment[1:65]...)
+				segment = segment[65:]
+			}
+		case 0xc0: // SOF0
+			height = int(binary.BigEndian.Uint16(segment[1:]))
+			width = int(binary.BigEndian.Uint16(segment[3:]))
+			if segment[7] == 0x21 {
+				typ = 0
+			}
+		case 0xdd: // DRI
+			restartInterval = binary.BigEndian.Uint16(segment)
+		case 0xda: // SOS
+			scan = image[i+2+length:]
+		}
+		i += 2 + length
+	}
+
+	q := byte(255)
+	if quality > 0 {
+		q = byte(quality)
+	}
+	if restartInterval != 0 {
+		typ += 64
+	}
+	var payloads [][]byte
+	for offset := 0; offset < len(scan); {
+		header := []byte{0, byte(offset >> 16), byte(offset >> 8), byte(offset), typ, q, byte(width / 8), byte(height / 8)}
+		if restartInterval != 0 {
+			header = append(header, byte(restartInterval>>8), byte(restartInterval), 0xff, 0xff)
+		}
+		if offset == 0 && q >= 128 {
+			header = append(header, 0, 0, byte(len(tables)>>8), byte(len(tables)))
+			header = append(header, tables...)
+		}
+		n := mtu
+		if n > len(scan)-offset {
+			n = len(scan) - offset
+		}
+		payloads = append(payloads, append(header, scan[offset:offset+n]...))
+		offset += n
+	}
+	return payloads
+}
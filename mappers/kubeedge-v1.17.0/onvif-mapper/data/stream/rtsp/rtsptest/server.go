@@ -0,0 +1,345 @@
+/*
+Copyright 2024 The KubeEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package rtsptest provides a local RTSP server for tests that streams
+// prepared frames over TCP like a camera.
+package rtsptest
+
+import (
+	"bufio"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Codecs of the streams.
+const (
+	H264 = "H264"
+	H265 = "H265"
+	JPEG = "JPEG"
+)
+
+const (
+	realm = "rtsptest"
+	nonce = "5f2a0c1d"
+	mtu   = 1400
+)
+
+// Stream is the video the server plays in a loop.
+type Stream struct {
+	Codec string
+	// VPS, SPS and PPS are the parameter sets of H.264 and H.265 streams.
+	VPS, SPS, PPS []byte
+	// InBand sends the parameter sets before every keyframe instead of in
+	// the session description.
+	InBand bool
+	// Frames are the access units of H.264 and H.265 streams.
+	Frames [][][]byte
+	// Images are the JPEG files of JPEG streams, baseline YCbCr.
+	Images [][]byte
+	// Quality sends the JPEG quantization tables as an RFC 2435 Q value
+	// instead of in band. It must be the quality the images were encoded
+	// with.
+	Quality int
+	// FrameDuration is the RTP timestamp increment, 3000 by default.
+	FrameDuration uint32
+	// Interval is the time between frames, 1ms by default.
+	Interval time.Duration
+}
+
+// Server is an RTSP server on a local port.
+type Server struct {
+	// URL is the URI of the stream.
+	URL string
+	// Username and Password, if set, are required with Digest
+	// authentication.
+	Username, Password string
+
+	stream   Stream
+	listener net.Listener
+	mutex    sync.Mutex
+	requests []string
+	conns    map[net.Conn]bool
+	wg       sync.WaitGroup
+}
+
+// NewServer starts a server that plays the stream.
+func NewServer(stream Stream) (*Server, error) {
+	s, err := NewUnstartedServer(stream)
+	if err != nil {
+		return nil, err
+	}
+	s.Start()
+	return s, nil
+}
+
+// NewUnstartedServer returns a server that listens but does not accept
+// connections until it is started, so that its fields can be changed.
+func NewUnstartedServer(stream Stream) (*Server, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	if stream.FrameDuration == 0 {
+		stream.FrameDuration = 3000
+	}
+	if stream.Interval == 0 {
+		stream.Interval = time.Millisecond
+	}
+	return &Server{
+		URL:      "rtsp://" + listener.Addr().String() + "/stream",
+		stream:   stream,
+		listener: listener,
+		conns:    make(map[net.Conn]bool),
+	}, nil
+}
+
+// Start accepts connections.
+func (s *Server) Start() {
+	s.wg.Add(1)
+	go s.serve()
+}
+
+// Requests returns the methods of the requests received so far.
+func (s *Server) Requests() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]string{}, s.requests...)
+}
+
+// Close stops the server and closes its connections.
+func (s *Server) Close() {
+	s.listener.Close()
+	s.mutex.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mutex.Unlock()
+	s.wg.Wait()
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mutex.Lock()
+		s.conns[conn] = true
+		s.mutex.Unlock()
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(conn)
+			s.mutex.Lock()
+			delete(s.conns, conn)
+			s.mutex.Unlock()
+			conn.Close()
+		}()
+	}
+}
+
+// session is a connection of a client.
+type session struct {
+	conn       net.Conn
+	writeMutex sync.Mutex
+	done       chan struct{}
+	playing    bool
+}
+
+func (s *session) write(b []byte) error {
+	s.writeMutex.Lock()
+	defer s.writeMutex.Unlock()
+	_, err := s.conn.Write(b)
+	return err
+}
+
+func (s *Server) handle(conn net.Conn) {
+	sess := &session{conn: conn, done: make(chan struct{})}
+	defer close(sess.done)
+	reader := textproto.NewReader(bufio.NewReader(conn))
+	for {
+		line, err := reader.ReadLine()
+		if err != nil {
+			return
+		}
+		header, err := reader.ReadMIMEHeader()
+		if err != nil && err != io.EOF {
+			return
+		}
+		parts := strings.Fields(line)
+		if len(parts) != 3 {
+			return
+		}
+		method, uri := parts[0], parts[1]
+		s.mutex.Lock()
+		s.requests = append(s.requests, method)
+		s.mutex.Unlock()
+
+		status, extra, body := s.respond(method, uri, header)
+		var b strings.Builder
+		fmt.Fprintf(&b, "RTSP/1.0 %s\r\nCSeq: %s\r\n", status, header.Get("CSeq"))
+		b.WriteString(extra)
+		if body != "" {
+			fmt.Fprintf(&b, "Content-Type: application/sdp\r\nContent-Length: %d\r\n", len(body))
+		}
+		b.WriteString("\r\n")
+		b.WriteString(body)
+		if err = sess.write([]byte(b.String())); err != nil {
+			return
+		}
+		if method == "PLAY" && strings.HasPrefix(status, "200") && !sess.playing {
+			sess.playing = true
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				s.play(sess)
+			}()
+		}
+		if method == "TEARDOWN" {
+			return
+		}
+	}
+}
+
+func (s *Server) respond(method, uri string, header textproto.MIMEHeader) (string, string, string) {
+	if s.Username != "" && !s.authorized(method, uri, header.Get("Authorization")) {
+		return "401 Unauthorized", fmt.Sprintf("WWW-Authenticate: Digest realm=\"%s\", nonce=\"%s\"\r\n", realm, nonce), ""
+	}
+	switch method {
+	case "OPTIONS":
+		return "200 OK", "Public: OPTIONS, DESCRIBE, SETUP, PLAY, TEARDOWN, GET_PARAMETER\r\n", ""
+	case "DESCRIBE":
+		return "200 OK", "Content-Base: " + s.URL + "/\r\n", s.sdp()
+	case "SETUP":
+		if !strings.Contains(header.Get("Transport"), "RTP/AVP/TCP") {
+			return "461 Unsupported Transport", "", ""
+		}
+		return "200 OK", "Transport: RTP/AVP/TCP;unicast;interleaved=0-1\r\nSession: 12345678;timeout=60\r\n", ""
+	case "PLAY", "GET_PARAMETER", "TEARDOWN":
+		if header.Get("Session") != "12345678" {
+			return "454 Session Not Found", "", ""
+		}
+		return "200 OK", "Session: 12345678\r\n", ""
+	}
+	return "501 Not Implemented", "", ""
+}
+
+func (s *Server) authorized(method, uri, authorization string) bool {
+	if !strings.HasPrefix(authorization, "Digest ") {
+		return false
+	}
+	params := make(map[string]string)
+	for _, param := range strings.Split(strings.TrimPrefix(authorization, "Digest "), ",") {
+		kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+		if len(kv) == 2 {
+			params[kv[0]] = strings.Trim(kv[1], `"`)
+		}
+	}
+	ha1 := md5Hex(s.Username + ":" + realm + ":" + s.Password)
+	ha2 := md5Hex(method + ":" + uri)
+	return params["username"] == s.Username && params["uri"] == uri && params["response"] == md5Hex(ha1+":"+nonce+":"+ha2)
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *Server) sdp() string {
+	var b strings.Builder
+	b.WriteString("v=0\r\no=- 0 0 IN IP4 127.0.0.1\r\ns=rtsptest\r\nc=IN IP4 0.0.0.0\r\nt=0 0\r\na=control:*\r\n")
+	b.WriteString("m=audio 0 RTP/AVP 0\r\na=control:trackID=0\r\n")
+	switch s.stream.Codec {
+	case JPEG:
+		b.WriteString("m=video 0 RTP/AVP 26\r\n")
+	case H264:
+		b.WriteString("m=video 0 RTP/AVP 96\r\na=rtpmap:96 H264/90000\r\n")
+		if !s.stream.InBand {
+			fmt.Fprintf(&b, "a=fmtp:96 packetization-mode=1;sprop-parameter-sets=%s,%s\r\n",
+				base64.StdEncoding.EncodeToString(s.stream.SPS), base64.StdEncoding.EncodeToString(s.stream.PPS))
+		}
+	case H265:
+		b.WriteString("m=video 0 RTP/AVP 96\r\na=rtpmap:96 H265/90000\r\n")
+		if !s.stream.InBand {
+			fmt.Fprintf(&b, "a=fmtp:96 sprop-vps=%s; sprop-sps=%s; sprop-pps=%s\r\n", base64.StdEncoding.EncodeToString(s.stream.VPS),
+				base64.StdEncoding.EncodeToString(s.stream.SPS), base64.StdEncoding.EncodeToString(s.stream.PPS))
+		}
+	}
+	b.WriteString("a=control:trackID=1\r\n")
+	return b.String()
+}
+
+// play sends the frames in a loop until the session ends. Sequence numbers
+// and timestamps start close to their wrap around.
+func (s *Server) play(sess *session) {
+	seq := uint16(0xfff0)
+	timestamp := uint32(0xffff0000)
+	ticker := time.NewTicker(s.stream.Interval)
+	defer ticker.Stop()
+	for i := 0; ; i++ {
+		var payloads [][]byte
+		switch s.stream.Codec {
+		case JPEG:
+			if len(s.stream.Images) == 0 {
+				return
+			}
+			payloads = packetizeJPEG(s.stream.Images[i%len(s.stream.Images)], s.stream.Quality)
+		default:
+			if len(s.stream.Frames) == 0 {
+				return
+			}
+			payloads = s.packetizeNALUs(s.stream.Frames[i%len(s.stream.Frames)])
+		}
+		pt := byte(96)
+		if s.stream.Codec == JPEG {
+			pt = 26
+		}
+		for j, payload := range payloads {
+			packet := make([]byte, 4+12, 4+12+len(payload))
+			packet[0], packet[1] = '$', 0
+			binary.BigEndian.PutUint16(packet[2:], uint16(12+len(payload)))
+			packet[4] = 0x80
+			packet[5] = pt
+			if j == len(payloads)-1 {
+				packet[5] |= 0x80
+			}
+			binary.BigEndian.PutUint16(packet[6:], seq)
+			binary.BigEndian.PutUint32(packet[8:], timestamp)
+			binary.BigEndian.PutUint32(packet[12:], 0x1234)
+			packet = append(packet, payload...)
+			seq++
+			if sess.write(packet) != nil {
+				return
+			}
+		}
+		timestamp += s.stream.FrameDuration
+		select {
+		case <-ticker.C:
+		case <-sess.done:
+			return
+		}
+	}
+}
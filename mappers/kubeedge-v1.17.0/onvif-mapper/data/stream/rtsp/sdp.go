@@ -0,0 +1,198 @@
+/*
+Copyright 2024 The KubeEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rtsp
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Codecs of the video tracks the client can play.
+const (
+	H264 = "H264"
+	H265 = "H265"
+	JPEG = "JPEG"
+)
+
+// payloadTypeJPEG is the static RTP payload type of JPEG.
+const payloadTypeJPEG = 26
+
+// Track is a video track of a stream.
+type Track struct {
+	Codec       string
+	PayloadType uint8
+	ClockRate   int
+	// Control is the URI the track is set up with.
+	Control string
+	// SessionControl is the URI of the session, if the SDP sets one.
+	SessionControl string
+	// VPS, SPS and PPS are the parameter sets of H.264 and H.265 tracks,
+	// updated when they are sent in the stream.
+	VPS, SPS, PPS []byte
+}
+
+// parseSDP returns the first video track of the session description that
+// the client can play. Relative control URIs are resolved against base.
+func parseSDP(sdp []byte, base string) (Track, error) {
+	var tracks []Track
+	var sessionControl string
+	var track *Track
+	// media is set once the media descriptions start
+	media := false
+	rtpmaps := make(map[uint8]string)
+	fmtps := make(map[uint8]string)
+	flush := func() {
+		if track == nil {
+			return
+		}
+		if rtpmap, ok := rtpmaps[track.PayloadType]; ok {
+			parts := strings.SplitN(rtpmap, "/", 3)
+			track.Codec = strings.ToUpper(parts[0])
+			if track.Codec == "HEVC" {
+				track.Codec = H265
+			}
+			if len(parts) > 1 {
+				track.ClockRate, _ = strconv.Atoi(parts[1])
+			}
+		} else if track.PayloadType == payloadTypeJPEG {
+			track.Codec = JPEG
+			track.ClockRate = 90000
+		}
+		track.parseFMTP(fmtps[track.PayloadType])
+		tracks = append(tracks, *track)
+		track = nil
+	}
+
+	for _, line := range strings.Split(string(sdp), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "m="):
+			flush()
+			media = true
+			rtpmaps = make(map[uint8]string)
+			fmtps = make(map[uint8]string)
+			fields := strings.Fields(line[2:])
+			if len(fields) < 4 || fields[0] != "video" {
+				continue
+			}
+			pt, err := strconv.ParseUint(fields[3], 10, 7)
+			if err != nil {
+				continue
+			}
+			track = &Track{PayloadType: uint8(pt), Control: base}
+		case strings.HasPrefix(line, "a=control:"):
+			control := resolveControl(base, strings.TrimPrefix(line, "a=control:"))
+			if track != nil {
+				track.Control = control
+			} else if !media {
+				sessionControl = control
+			}
+		case strings.HasPrefix(line, "a=rtpmap:") && track != nil:
+			if pt, value, ok := attributeOf(line, "a=rtpmap:"); ok {
+				rtpmaps[pt] = value
+			}
+		case strings.HasPrefix(line, "a=fmtp:") && track != nil:
+			if pt, value, ok := attributeOf(line, "a=fmtp:"); ok {
+				fmtps[pt] = value
+			}
+		}
+	}
+	flush()
+
+	for _, t := range tracks {
+		switch t.Codec {
+		case H264, H265, JPEG:
+			if t.ClockRate <= 0 {
+				t.ClockRate = 90000
+			}
+			t.SessionControl = sessionControl
+			return t, nil
+		}
+	}
+	if len(tracks) == 0 {
+		return Track{}, errors.New("no video track")
+	}
+	return Track{}, fmt.Errorf("unsupported video codec %q", tracks[0].Codec)
+}
+
+// attributeOf splits an attribute like a=rtpmap:96 H264/90000.
+func attributeOf(line, prefix string) (uint8, string, bool) {
+	fields := strings.SplitN(strings.TrimPrefix(line, prefix), " ", 2)
+	if len(fields) != 2 {
+		return 0, "", false
+	}
+	pt, err := strconv.ParseUint(fields[0], 10, 7)
+	if err != nil {
+		return 0, "", false
+	}
+	return uint8(pt), strings.TrimSpace(fields[1]), true
+}
+
+// parseFMTP reads the parameter sets of the track from its format
+// parameters.
+func (t *Track) parseFMTP(fmtp string) {
+	for _, param := range strings.Split(fmtp, ";") {
+		kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		key, value := strings.ToLower(kv[0]), kv[1]
+		switch key {
+		case "sprop-parameter-sets":
+			for _, set := range strings.Split(value, ",") {
+				nalu, err := base64.StdEncoding.DecodeString(set)
+				if err != nil || len(nalu) == 0 {
+					continue
+				}
+				switch nalu[0] & 0x1f {
+				case h264NALUSPS:
+					t.SPS = nalu
+				case h264NALUPPS:
+					t.PPS = nalu
+				}
+			}
+		case "sprop-vps", "sprop-sps", "sprop-pps":
+			nalu, err := base64.StdEncoding.DecodeString(value)
+			if err != nil || len(nalu) == 0 {
+				continue
+			}
+			switch key {
+			case "sprop-vps":
+				t.VPS = nalu
+			case "sprop-sps":
+				t.SPS = nalu
+			default:
+				t.PPS = nalu
+			}
+		}
+	}
+}
+
+func resolveControl(base, control string) string {
+	switch {
+	case control == "*" || control == "":
+		return base
+	case strings.Contains(control, "://"):
+		return control
+	case strings.HasSuffix(base, "/"):
+		return base + control
+	}
+	return base + "/" + control
+}
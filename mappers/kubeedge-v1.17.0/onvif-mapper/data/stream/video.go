@@ -1,3 +1,5 @@
+//go:build ffmpeg
+
 /*
 Copyright 2024 The KubeEdge Authors.
 
@@ -27,7 +29,7 @@ import (
 )
 
 // SaveVideo save video.
-func SaveVideo(inputFile string, outDir string, format string, frameCount int, videoNum int) error {
+func SaveVideo(inputFile string, out *Artifacts, format string, frameCount int, videoNum int) error {
 	var fragmentedMp4Options int
 	//initialize input file with Context
 	var inputFmtCtx *avformat.Context
@@ -59,7 +61,7 @@ func SaveVideo(inputFile string, outDir string, format string, frameCount int, v
 	defer inCodecParam.AvCodecParametersFree()
 
 	var outputFmtCtx *avformat.Context
-	outputFile := GenFileName(outDir, format)
+	outputFile := out.TempPath(format)
 	avformat.AvAllocOutputContext2(&outputFmtCtx, nil, nil, &outputFile)
 	if outputFmtCtx == nil {
 		return errors.New("Could not create output context")
@@ -96,7 +98,8 @@ func SaveVideo(inputFile string, outDir string, format string, frameCount int, v
 
 	// Capture a set number of video segments
 	for idx := 0; idx < videoNum; idx++ {
-		outputFile = GenFileName(outDir, format)
+		// the video is written to a hidden file, renamed once it is complete
+		outputFile = out.TempPath(format)
 		// initialize output file with Context
 		outputFmtCtx.AvDumpFormat(0, outputFile, 1)
 		if outputFmtCtx.Oformat().GetFlags()&avformat.AVFMT_NOFILE == 0 {
@@ -134,9 +137,13 @@ func SaveVideo(inputFile string, outDir string, format string, frameCount int, v
 		if outputFmtCtx.Oformat().GetFlags()&avformat.AVFMT_NOFILE == 0 {
 			if outputFmtCtx.Pb().Close() != nil {
 				klog.Error("Error close output context")
+				out.Discard(outputFile)
 				return errors.New("error close output context")
 			}
 		}
+		if _, err := out.Commit(outputFile, KindVideo); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -5,8 +5,6 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"os"
-	"os/signal"
 	"strings"
 	"sync"
 	"time"
@@ -31,9 +29,11 @@ type DevPanel struct {
 	deviceMuxs   map[string]context.CancelFunc
 	devices      map[string]*driver.CustomizedDev
 	models       map[string]common.DeviceModel
+	states       map[string]*StateMachine
 	wg           sync.WaitGroup
 	serviceMutex sync.Mutex
-	quitChan     chan os.Signal
+	// workers tracks acquisition, push and database goroutines of all devices
+	workers sync.WaitGroup
 }
 
 var (
@@ -41,7 +41,15 @@ var (
 	once     sync.Once
 )
 
-var ErrEmptyData = errors.New("device or device model list is empty")
+var (
+	ErrEmptyData        = errors.New("device or device model list is empty")
+	ErrDeviceNotFound   = errors.New("device not found")
+	ErrPropertyNotFound = errors.New("property not found")
+	ErrReadOnly         = errors.New("property is read only")
+)
+
+// newStateReporter builds the reporter of device state transitions, tests replace it.
+var newStateReporter = reportDeviceState
 
 // NewDevPanel init and return devPanel
 func NewDevPanel() *DevPanel {
@@ -50,64 +58,147 @@ func NewDevPanel() *DevPanel {
 			deviceMuxs:   make(map[string]context.CancelFunc),
 			devices:      make(map[string]*driver.CustomizedDev),
 			models:       make(map[string]common.DeviceModel),
+			states:       make(map[string]*StateMachine),
 			wg:           sync.WaitGroup{},
 			serviceMutex: sync.Mutex{},
-			quitChan:     make(chan os.Signal),
 		}
 	})
 	return devPanel
 }
 
-// DevStart start all devices.
+// DevStart start all devices and wait until they are stopped by Shutdown.
 func (d *DevPanel) DevStart() {
+	d.serviceMutex.Lock()
 	for id, dev := range d.devices {
 		klog.V(4).Info("Dev: ", id, dev)
 		ctx, cancel := context.WithCancel(context.Background())
 		d.deviceMuxs[id] = cancel
+		d.states[id] = NewStateMachine(id, newStateReporter(dev.Instance.Name, dev.Instance.Namespace))
 		d.wg.Add(1)
-		go d.start(ctx, dev)
+		go d.start(ctx, dev, d.states[id], nil)
+	}
+	d.serviceMutex.Unlock()
+	d.wg.Wait()
+}
+
+// Deregister reports every device as removing to edgecore and waits until the
+// reports are sent or ctx is done. The DMI API has no call to deregister a
+// mapper, edgecore loses the mapper once the gRPC server removes its socket.
+func (d *DevPanel) Deregister(ctx context.Context) error {
+	d.serviceMutex.Lock()
+	for _, state := range d.states {
+		state.Removing("mapper is shutting down")
+	}
+	d.serviceMutex.Unlock()
+	return waitStateReports(ctx)
+}
+
+// Shutdown stops data acquisition of all devices, waits for in-flight pushes
+// and database writes until ctx is done, then closes the driver connections.
+// The panel is only locked to stop the devices, so that handlers and REST
+// calls which need it are not blocked while they are drained.
+func (d *DevPanel) Shutdown(ctx context.Context) error {
+	d.serviceMutex.Lock()
+	for id, cancel := range d.deviceMuxs {
+		d.states[id].Removing("mapper is shutting down")
+		cancel()
 	}
-	signal.Notify(d.quitChan, os.Interrupt)
+	devices := make(map[string]*driver.CustomizedDev, len(d.devices))
+	for id, dev := range d.devices {
+		devices[id] = dev
+	}
+	d.serviceMutex.Unlock()
+
+	drained := make(chan struct{})
 	go func() {
-		<-d.quitChan
-		for id, device := range d.devices {
-			err := device.CustomizedClient.StopDevice()
-			if err != nil {
-				klog.Errorf("Service has stopped but failed to stop %s:%v", id, err)
-			}
+		d.wg.Wait()
+		d.workers.Wait()
+		close(drained)
+	}()
+	var err error
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		err = fmt.Errorf("wait for device handlers to stop: %w", ctx.Err())
+	}
+
+	for id, dev := range devices {
+		if dev.CustomizedClient == nil {
+			continue
+		}
+		if stopErr := dev.CustomizedClient.StopDevice(); stopErr != nil {
+			klog.Errorf("Service has stopped but failed to stop %s:%v", id, stopErr)
 		}
-		klog.V(1).Info("Exit mapper")
-		os.Exit(1)
+	}
+	return err
+}
+
+// spawn runs f in a goroutine that Shutdown waits for.
+func (d *DevPanel) spawn(f func()) {
+	d.workers.Add(1)
+	go func() {
+		defer d.workers.Done()
+		f()
 	}()
-	d.wg.Wait()
 }
 
-// start the device
-func (d *DevPanel) start(ctx context.Context, dev *driver.CustomizedDev) {
+// start the device, changed holds the twins whose desired value differs from
+// the one the device was last started with.
+func (d *DevPanel) start(ctx context.Context, dev *driver.CustomizedDev, state *StateMachine, changed map[string]bool) {
 	defer d.wg.Done()
 
 	var protocolConfig driver.ProtocolConfig
 	if err := json.Unmarshal(dev.Instance.PProtocol.ConfigData, &protocolConfig); err != nil {
 		klog.Errorf("Unmarshal ProtocolConfigs error: %v", err)
+		state.DriverError(err)
 		return
 	}
 	client, err := driver.NewClient(protocolConfig)
 	if err != nil {
 		klog.Errorf("Init dev %s error: %v", dev.Instance.Name, err)
+		state.DriverError(err)
 		return
 	}
 	dev.CustomizedClient = client
-	err = dev.CustomizedClient.InitDevice()
-	if err != nil {
-		klog.Errorf("Init device %s error: %v", dev.Instance.ID, err)
+	if !connect(ctx, dev, state) {
 		return
 	}
-	go dataHandler(ctx, dev)
-	<-ctx.Done()
+	d.spawn(func() { d.dataHandler(ctx, dev, state, changed) })
+	for {
+		select {
+		case <-state.Lost():
+			klog.Warningf("Device %s went offline, reconnecting", dev.Instance.ID)
+			if !connect(ctx, dev, state) {
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// connect initializes the device, retrying with backoff until it succeeds.
+// It returns false if ctx is cancelled first.
+func connect(ctx context.Context, dev *driver.CustomizedDev, state *StateMachine) bool {
+	for attempt := 1; ; attempt++ {
+		err := dev.CustomizedClient.InitDevice()
+		if err == nil {
+			state.Connected()
+			return true
+		}
+		klog.Errorf("Init device %s error: %v", dev.Instance.ID, err)
+		state.ConnectFailed(attempt, err)
+		select {
+		case <-time.After(reconnectBackoff(attempt)):
+		case <-ctx.Done():
+			return false
+		}
+	}
 }
 
 // dataHandler initialize the timer to handle data plane and devicetwin.
-func dataHandler(ctx context.Context, dev *driver.CustomizedDev) {
+func (d *DevPanel) dataHandler(ctx context.Context, dev *driver.CustomizedDev, state *StateMachine, changed map[string]bool) {
+	var eventTwins []*eventTwin
 	for _, twin := range dev.Instance.Twins {
 		twin.Property.PProperty.DataType = strings.ToLower(twin.Property.PProperty.DataType)
 		var visitorConfig driver.VisitorConfig
@@ -118,23 +209,36 @@ func dataHandler(ctx context.Context, dev *driver.CustomizedDev) {
 			klog.Errorf("Unmarshal VisitorConfig error: %v", err)
 			continue
 		}
-		err = setVisitor(&visitorConfig, &twin, dev)
-		if err != nil {
-			klog.Error(err)
-			continue
+		if applyOnStart(&visitorConfig, &twin, changed) {
+			err = setVisitor(&visitorConfig, &twin, dev)
+			if err != nil {
+				klog.Error(err)
+				continue
+			}
 		}
 
 		// If the device property type is streaming, it will directly enter the streaming data processing function,
 		// such as saving frames or saving videos, and will no longer push it to the user database and application.
 		// If there are other needs for stream data processing, users can add functions in the mapper/data/stream directory.
 		if twin.Property.PProperty.DataType == "stream" {
-			err = stream.StreamHandler(&twin, dev.CustomizedClient, &visitorConfig)
+			err = stream.StreamHandler(ctx, dev.Instance.ID, &twin, dev.CustomizedClient, &visitorConfig)
 			if err != nil {
 				klog.Errorf("processed streaming data by %s Error: %v", twin.PropertyName, err)
 			}
 			continue
 		}
 
+		// Event properties are reported when the camera sends an event, see eventHandler.
+		if visitorConfig.Event != nil {
+			eventTwins = append(eventTwins, newEventTwin(dev, twin, &visitorConfig))
+			if twin.Property.PushMethod.DBMethod.DBMethodName != "" {
+				dataModel := common.NewDataModel(dev.Instance.Name, twin.Property.PropertyName, dev.Instance.Namespace, common.WithType(twin.ObservedDesired.Metadata.Type))
+				twin, visitorConfig := twin, visitorConfig
+				d.spawn(func() { dbHandler(ctx, &twin, dev.CustomizedClient, &visitorConfig, dataModel) })
+			}
+			continue
+		}
+
 		// handle twin
 		twinData := &TwinData{
 			DeviceName:      dev.Instance.Name,
@@ -147,37 +251,66 @@ func dataHandler(ctx context.Context, dev *driver.CustomizedDev) {
 			Topic:           fmt.Sprintf(common.TopicTwinUpdate, dev.Instance.ID),
 			CollectCycle:    time.Duration(twin.Property.CollectCycle),
 			ReportToCloud:   twin.Property.ReportToCloud,
+			State:           state,
 		}
-		go twinData.Run(ctx)
+		d.spawn(func() { twinData.Run(ctx) })
 		// handle push method
 		if twin.Property.PushMethod.MethodConfig != nil && twin.Property.PushMethod.MethodName != "" {
 			dataModel := common.NewDataModel(dev.Instance.Name, twin.Property.PropertyName, dev.Instance.Namespace, common.WithType(twin.ObservedDesired.Metadata.Type))
-			pushHandler(ctx, &twin, dev.CustomizedClient, &visitorConfig, dataModel)
+			twin, visitorConfig := twin, visitorConfig
+			d.spawn(func() { pushHandler(ctx, &twin, dev.CustomizedClient, &visitorConfig, dataModel) })
 		}
 		// handle database
 		if twin.Property.PushMethod.DBMethod.DBMethodName != "" {
 			dataModel := common.NewDataModel(dev.Instance.Name, twin.Property.PropertyName, dev.Instance.Namespace, common.WithType(twin.ObservedDesired.Metadata.Type))
-			dbHandler(ctx, &twin, dev.CustomizedClient, &visitorConfig, dataModel)
-			switch twin.Property.PushMethod.DBMethod.DBMethodName {
-			// TODO add more database
-			case "influx":
-				dbInflux.DataHandler(ctx, &twin, dev.CustomizedClient, &visitorConfig, dataModel)
-			case "redis":
-				dbRedis.DataHandler(ctx, &twin, dev.CustomizedClient, &visitorConfig, dataModel)
-			case "tdengine":
-				dbTdengine.DataHandler(ctx, &twin, dev.CustomizedClient, &visitorConfig, dataModel)
-			case "mysql":
-				dbMysql.DataHandler(ctx, &twin, dev.CustomizedClient, &visitorConfig, dataModel)
-			}
+			twin, visitorConfig := twin, visitorConfig
+			d.spawn(func() { dbHandler(ctx, &twin, dev.CustomizedClient, &visitorConfig, dataModel) })
 		}
 	}
+	if len(eventTwins) > 0 {
+		d.spawn(func() { eventHandler(ctx, dev, eventTwins) })
+	}
 }
 
-// pushHandler start data panel work
+// pushHandler pushes device data every report cycle until ctx is done
 func pushHandler(ctx context.Context, twin *common.Twin, client *driver.CustomizedClient, visitorConfig *driver.VisitorConfig, dataModel *common.DataModel) {
+	dataPanel, err := newDataPanel(twin)
+	if err != nil {
+		klog.Error(err)
+		return
+	}
+	reportCycle := time.Duration(twin.Property.ReportCycle)
+	if reportCycle == 0 {
+		reportCycle = common.DefaultReportCycle
+	}
+	ticker := time.NewTicker(reportCycle)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			deviceData, err := client.GetDeviceData(visitorConfig)
+			if err != nil {
+				klog.Errorf("publish error: %v", err)
+				continue
+			}
+			sData, err := common.ConvertToString(deviceData)
+			if err != nil {
+				klog.Errorf("Failed to convert publish method data : %v", err)
+				continue
+			}
+			dataModel.SetValue(sData)
+			dataModel.SetTimeStamp()
+			dataPanel.Push(dataModel)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// newDataPanel initializes the push method of the twin.
+func newDataPanel(twin *common.Twin) (global.DataPanel, error) {
 	var dataPanel global.DataPanel
 	var err error
-	// initialization dataPanel
 	switch twin.Property.PushMethod.MethodName {
 	case "http":
 		dataPanel, err = httpMethod.NewDataPanel(twin.Property.PushMethod.MethodConfig)
@@ -187,45 +320,15 @@ func pushHandler(ctx context.Context, twin *common.Twin, client *driver.Customiz
 		err = errors.New("custom protocols are not currently supported when push data")
 	}
 	if err != nil {
-		klog.Errorf("new data panel error: %v", err)
-		return
-	}
-	// initialization PushMethod
-	err = dataPanel.InitPushMethod()
-	if err != nil {
-		klog.Errorf("init publish method err: %v", err)
-		return
+		return nil, fmt.Errorf("new data panel error: %v", err)
 	}
-	reportCycle := time.Duration(twin.Property.ReportCycle)
-	if reportCycle == 0 {
-		reportCycle = common.DefaultReportCycle
+	if err = dataPanel.InitPushMethod(); err != nil {
+		return nil, fmt.Errorf("init publish method err: %v", err)
 	}
-	ticker := time.NewTicker(reportCycle)
-	go func() {
-		for {
-			select {
-			case <-ticker.C:
-				deviceData, err := client.GetDeviceData(visitorConfig)
-				if err != nil {
-					klog.Errorf("publish error: %v", err)
-					continue
-				}
-				sData, err := common.ConvertToString(deviceData)
-				if err != nil {
-					klog.Errorf("Failed to convert publish method data : %v", err)
-					continue
-				}
-				dataModel.SetValue(sData)
-				dataModel.SetTimeStamp()
-				dataPanel.Push(dataModel)
-			case <-ctx.Done():
-				return
-			}
-		}
-	}()
+	return dataPanel, nil
 }
 
-// dbHandler start db client to save data
+// dbHandler saves device data into the configured database until ctx is done
 func dbHandler(ctx context.Context, twin *common.Twin, client *driver.CustomizedClient, visitorConfig *driver.VisitorConfig, dataModel *common.DataModel) {
 	switch twin.Property.PushMethod.DBMethod.DBMethodName {
 	// TODO add more database
@@ -243,12 +346,47 @@ func dbHandler(ctx context.Context, twin *common.Twin, client *driver.Customized
 	}
 }
 
+// applyOnStart reports whether the desired value of the twin is set when the
+// device starts. The device is restarted on every update, so PTZ commands
+// that are not idempotent only run when their desired value changed.
+func applyOnStart(visitorConfig *driver.VisitorConfig, twin *common.Twin, changed map[string]bool) bool {
+	if visitorConfig.PTZ == nil || visitorConfig.PTZ.Idempotent() {
+		return true
+	}
+	if !changed[twin.PropertyName] {
+		klog.V(3).Infof("Skip PTZ %s of twin %s, its desired value is unchanged", visitorConfig.PTZ.Operation, twin.PropertyName)
+		return false
+	}
+	return true
+}
+
+// changedTwins returns the twins of device whose desired value differs from
+// the one of old.
+func changedTwins(old, device *common.DeviceInstance) map[string]bool {
+	previous := make(map[string]string, len(old.Twins))
+	for _, twin := range old.Twins {
+		previous[twin.PropertyName] = twin.ObservedDesired.Value
+	}
+	changed := make(map[string]bool)
+	for _, twin := range device.Twins {
+		if value, ok := previous[twin.PropertyName]; !ok || value != twin.ObservedDesired.Value {
+			changed[twin.PropertyName] = true
+		}
+	}
+	return changed
+}
+
 // setVisitor check if visitor property is readonly, if not then set it.
 func setVisitor(visitorConfig *driver.VisitorConfig, twin *common.Twin, dev *driver.CustomizedDev) error {
 	if twin.Property.PProperty.AccessMode == "ReadOnly" {
 		klog.V(3).Infof("%s twin readonly property: %s", dev.Instance.Name, twin.PropertyName)
 		return nil
 	}
+	if twin.ObservedDesired.Value == "" {
+		// no desired value to apply, such as a camera setting that is only reported
+		klog.V(3).Infof("%s twin %s has no desired value", dev.Instance.Name, twin.PropertyName)
+		return nil
+	}
 	klog.V(2).Infof("Convert type: %s, value: %s ", twin.Property.PProperty.DataType, twin.ObservedDesired.Value)
 	value, err := common.Convert(twin.Property.PProperty.DataType, twin.ObservedDesired.Value)
 	if err != nil {
@@ -262,6 +400,47 @@ func setVisitor(visitorConfig *driver.VisitorConfig, twin *common.Twin, dev *dri
 	return nil
 }
 
+// WriteDevice writes value to a writable property of the device, as if it
+// was the desired value of its twin.
+func (d *DevPanel) WriteDevice(deviceID string, propertyName string, value string) error {
+	dev, twin, err := d.writableTwin(deviceID, propertyName)
+	if err != nil {
+		return err
+	}
+	var visitorConfig driver.VisitorConfig
+	if err := json.Unmarshal(twin.Property.Visitors, &visitorConfig); err != nil {
+		return err
+	}
+	twin.ObservedDesired.Value = value
+	// the camera is called without holding the service mutex, the driver
+	// serializes its own requests
+	return setVisitor(&visitorConfig, &twin, dev)
+}
+
+// writableTwin returns the device and a copy of its twin of propertyName,
+// if the property can be written.
+func (d *DevPanel) writableTwin(deviceID string, propertyName string) (*driver.CustomizedDev, common.Twin, error) {
+	d.serviceMutex.Lock()
+	defer d.serviceMutex.Unlock()
+	dev, ok := d.devices[deviceID]
+	if !ok {
+		return nil, common.Twin{}, fmt.Errorf("%w: %s", ErrDeviceNotFound, deviceID)
+	}
+	for _, twin := range dev.Instance.Twins {
+		if twin.PropertyName != propertyName {
+			continue
+		}
+		if twin.Property.PProperty.AccessMode == "ReadOnly" {
+			return nil, common.Twin{}, fmt.Errorf("%w: %s", ErrReadOnly, propertyName)
+		}
+		if dev.CustomizedClient == nil {
+			return nil, common.Twin{}, fmt.Errorf("device %s is not initialized", deviceID)
+		}
+		return &driver.CustomizedDev{CustomizedClient: dev.CustomizedClient, Instance: dev.Instance}, twin, nil
+	}
+	return nil, common.Twin{}, fmt.Errorf("%w: %s", ErrPropertyNotFound, propertyName)
+}
+
 // DevInit initialize the device
 func (d *DevPanel) DevInit(deviceList []*dmiapi.Device, deviceModelList []*dmiapi.DeviceModel) error {
 	if len(deviceList) == 0 || len(deviceModelList) == 0 {
@@ -300,7 +479,10 @@ func (d *DevPanel) UpdateDev(model *common.DeviceModel, device *common.DeviceIns
 	d.serviceMutex.Lock()
 	defer d.serviceMutex.Unlock()
 
+	var changed map[string]bool
 	if oldDevice, ok := d.devices[device.ID]; ok {
+		changed = changedTwins(&oldDevice.Instance, device)
+		d.states[device.ID].Removing("device is being updated")
 		err := d.stopDev(oldDevice, device.ID)
 		if err != nil {
 			klog.Error(err)
@@ -313,8 +495,9 @@ func (d *DevPanel) UpdateDev(model *common.DeviceModel, device *common.DeviceIns
 
 	ctx, cancelFunc := context.WithCancel(context.Background())
 	d.deviceMuxs[device.ID] = cancelFunc
+	d.states[device.ID] = NewStateMachine(device.ID, newStateReporter(device.Name, device.Namespace))
 	d.wg.Add(1)
-	go d.start(ctx, d.devices[device.ID])
+	go d.start(ctx, d.devices[device.ID], d.states[device.ID], changed)
 }
 
 // UpdateDevTwins update device's twins
@@ -365,10 +548,6 @@ func getTwinData(deviceID string, twin common.Twin, dev *driver.CustomizedDev) (
 	if err != nil {
 		return nil, err
 	}
-	err = setVisitor(&visitorConfig, &twin, dev)
-	if err != nil {
-		return nil, err
-	}
 	twinData := &TwinData{
 		DeviceName:    deviceID,
 		Client:        dev.CustomizedClient,
@@ -406,6 +585,8 @@ func (d *DevPanel) RemoveDevice(deviceID string) error {
 	defer d.serviceMutex.Unlock()
 	dev := d.devices[deviceID]
 	delete(d.devices, deviceID)
+	d.states[deviceID].Removing("device is being removed")
+	delete(d.states, deviceID)
 	err := d.stopDev(dev, deviceID)
 	if err != nil {
 		return err
@@ -471,7 +652,6 @@ func (d *DevPanel) GetTwinResult(deviceID string, twinName string) (string, stri
 		if err != nil {
 			return "", "", err
 		}
-		err = setVisitor(&visitorConfig, &twin, dev)
 
 		data, err := dev.CustomizedClient.GetDeviceData(&visitorConfig)
 		if err != nil {
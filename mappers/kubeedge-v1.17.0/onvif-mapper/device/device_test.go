@@ -0,0 +1,316 @@
+package device
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	dmiapi "github.com/kubeedge/kubeedge/pkg/apis/dmi/v1beta1"
+	"github.com/kubeedge/mapper-framework/pkg/common"
+	"github.com/kubeedge/mapper-framework/pkg/grpcclient"
+	"github.com/kubeedge/onvif/data/stream"
+	"github.com/kubeedge/onvif/driver"
+)
+
+func newTestPanel(t *testing.T) *DevPanel {
+	newStateReporter = func(string, string) StateReporter { return nil }
+	t.Cleanup(func() { newStateReporter = reportDeviceState })
+	return &DevPanel{
+		deviceMuxs: make(map[string]context.CancelFunc),
+		devices:    make(map[string]*driver.CustomizedDev),
+		models:     make(map[string]common.DeviceModel),
+		states:     make(map[string]*StateMachine),
+	}
+}
+
+func waitForState(t *testing.T, d *DevPanel, id string, want DeviceState) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		d.serviceMutex.Lock()
+		m := d.states[id]
+		d.serviceMutex.Unlock()
+		if state, _ := m.State(); m != nil && state == want {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("device %s did not reach state %s", id, want)
+}
+
+func TestShutdownLeavesNoGoroutines(t *testing.T) {
+	before := runtime.NumGoroutine()
+	d := newTestPanel(t)
+	// the password file of the camera is missing, so it stays in the reconnect loop
+	protocol, err := json.Marshal(driver.ProtocolConfig{ProtocolName: "onvif", ConfigData: driver.ConfigData{
+		URL:      "127.0.0.1:1",
+		UserName: "admin",
+		Password: filepath.Join(t.TempDir(), "password"),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.devices["camera"] = &driver.CustomizedDev{Instance: common.DeviceInstance{
+		ID:        "camera",
+		Name:      "camera",
+		Namespace: "default",
+		PProtocol: common.ProtocolConfig{ProtocolName: "onvif", ConfigData: protocol},
+	}}
+	stopped := make(chan struct{})
+	go func() {
+		d.DevStart()
+		close(stopped)
+	}()
+	waitForState(t, d, "camera", StateOffline)
+	if _, reason := d.states["camera"].State(); !strings.Contains(reason, "Failed to load certificate") {
+		t.Errorf("camera reason = %q, want the missing password", reason)
+	}
+
+	// an in-flight database write which needs a moment to finish once cancelled
+	flushed := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	d.serviceMutex.Lock()
+	d.deviceMuxs["writer"] = cancel
+	d.serviceMutex.Unlock()
+	d.spawn(func() {
+		<-ctx.Done()
+		time.Sleep(50 * time.Millisecond)
+		close(flushed)
+	})
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelShutdown()
+	if err := d.Shutdown(shutdownCtx); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+	select {
+	case <-flushed:
+	default:
+		t.Fatal("Shutdown returned before the in-flight write finished")
+	}
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("DevStart did not return after Shutdown")
+	}
+	if state, _ := d.states["camera"].State(); state != StateRemoving {
+		t.Errorf("device state = %s, want %s", state, StateRemoving)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if left := runtime.NumGoroutine() - before; left > 0 {
+		buf := make([]byte, 1<<16)
+		buf = buf[:runtime.Stack(buf, true)]
+		t.Fatalf("%d goroutines left after Shutdown:\n%s", left, buf)
+	}
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	d := newTestPanel(t)
+	release := make(chan struct{})
+	defer close(release)
+	d.spawn(func() { <-release })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := d.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Shutdown() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestShutdownReleasesPanelWhileDraining(t *testing.T) {
+	d := newTestPanel(t)
+	state := NewStateMachine("camera", nil)
+	d.states["camera"] = state
+	d.deviceMuxs["camera"] = func() {}
+	// an in-flight call which needs the panel once the mapper is shutting down
+	d.spawn(func() {
+		for s, _ := state.State(); s != StateRemoving; s, _ = state.State() {
+			time.Sleep(time.Millisecond)
+		}
+		d.serviceMutex.Lock()
+		d.serviceMutex.Unlock()
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := d.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+}
+
+func TestDeviceWriteHandler(t *testing.T) {
+	d := newTestPanel(t)
+	d.devices["camera"] = &driver.CustomizedDev{Instance: common.DeviceInstance{
+		ID: "camera",
+		Twins: []common.Twin{
+			{PropertyName: "getURI", Property: &common.DeviceProperty{PProperty: common.ModelProperty{AccessMode: "ReadOnly"}}},
+			{PropertyName: "ptzMove", Property: &common.DeviceProperty{PProperty: common.ModelProperty{AccessMode: "ReadWrite"}}},
+		},
+	}}
+	handler := DeviceWriteHandler(d)
+
+	tests := []struct {
+		path string
+		body string
+		code int
+	}{
+		{"/api/v1/device/missing/ptzMove", `{"value":"{}"}`, http.StatusNotFound},
+		{"/api/v1/device/camera/missing", `{"value":"{}"}`, http.StatusNotFound},
+		{"/api/v1/device/camera/getURI", `{"value":"x"}`, http.StatusMethodNotAllowed},
+		{"/api/v1/device/camera/ptzMove", `not json`, http.StatusBadRequest},
+		// the device has not been started, so there is no driver to write to
+		{"/api/v1/device/camera/ptzMove", `{"value":"{}"}`, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		recorder := httptest.NewRecorder()
+		handler(recorder, httptest.NewRequest(http.MethodPut, tt.path, strings.NewReader(tt.body)))
+		if recorder.Code != tt.code {
+			t.Errorf("PUT %s %s: code = %d, want %d (%s)", tt.path, tt.body, recorder.Code, tt.code, recorder.Body)
+		}
+	}
+}
+
+func TestDeviceArtifactHandler(t *testing.T) {
+	d := newTestPanel(t)
+	d.devices["camera"] = &driver.CustomizedDev{Instance: common.DeviceInstance{
+		ID:    "camera",
+		Twins: []common.Twin{{PropertyName: "saveFrame"}, {PropertyName: "saveVideo"}},
+	}}
+	out, err := stream.OpenArtifacts(context.Background(), "camera", "saveFrame", t.TempDir(), stream.Retention{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = out.WriteFile("jpg", stream.KindFrame, []byte("frame")); err != nil {
+		t.Fatal(err)
+	}
+	handler := DeviceArtifactHandler(d)
+
+	tests := []struct {
+		path      string
+		code      int
+		artifacts int
+	}{
+		{"/api/v1/artifact/missing/saveFrame", http.StatusNotFound, 0},
+		{"/api/v1/artifact/camera/missing", http.StatusNotFound, 0},
+		{"/api/v1/artifact/camera/saveFrame?since=yesterday", http.StatusBadRequest, 0},
+		{"/api/v1/artifact/camera/saveFrame", http.StatusOK, 1},
+		{"/api/v1/artifact/camera/saveFrame?since=2999-01-01T00:00:00Z", http.StatusOK, 0},
+		// nothing is saved yet
+		{"/api/v1/artifact/camera/saveVideo", http.StatusOK, 0},
+	}
+	for _, tt := range tests {
+		recorder := httptest.NewRecorder()
+		handler(recorder, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if recorder.Code != tt.code {
+			t.Errorf("GET %s: code = %d, want %d (%s)", tt.path, recorder.Code, tt.code, recorder.Body)
+			continue
+		}
+		if tt.code != http.StatusOK {
+			continue
+		}
+		var response DeviceArtifactResponse
+		if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+		if response.Artifacts == nil || len(response.Artifacts) != tt.artifacts {
+			t.Errorf("GET %s: artifacts = %v, want %d", tt.path, response.Artifacts, tt.artifacts)
+		}
+	}
+}
+
+func TestEventTwinReport(t *testing.T) {
+	var reported []*dmiapi.ReportDeviceStatusRequest
+	reportDeviceStatus = func(request *dmiapi.ReportDeviceStatusRequest) error {
+		reported = append(reported, request)
+		return nil
+	}
+	t.Cleanup(func() { reportDeviceStatus = grpcclient.ReportDeviceStatus })
+
+	twin := common.Twin{
+		PropertyName:    "motion",
+		Property:        &common.DeviceProperty{ReportToCloud: true},
+		ObservedDesired: common.TwinProperty{Metadata: common.Metadata{Type: "boolean"}},
+	}
+	dev := &driver.CustomizedDev{Instance: common.DeviceInstance{Name: "camera", Namespace: "default"}}
+	visitor := &driver.VisitorConfig{VisitorConfigData: driver.VisitorConfigData{Event: &driver.EventVisitorConfig{Topic: driver.EventMotion}}}
+	at := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	event := func(value string, at time.Time) driver.Event {
+		return driver.Event{Topic: "RuleEngine/CellMotionDetector/Motion", Time: at, Data: map[string]string{"IsMotion": value}}
+	}
+
+	twins := []*eventTwin{newEventTwin(dev, twin, visitor)}
+	dispatchEvent(twins, event("true", at))
+	dispatchEvent(twins, event("true", at.Add(time.Second)))
+	dispatchEvent(twins, event("false", at.Add(2*time.Second)))
+	dispatchEvent(twins, driver.Event{Topic: "Device/Trigger/DigitalInput", Time: at, Data: map[string]string{"LogicalState": "true"}})
+
+	if len(reported) != 2 {
+		t.Fatalf("reported %d updates, want one per change", len(reported))
+	}
+	for i, want := range []struct{ value, timestamp string }{{"true", "1714557600000"}, {"false", "1714557602000"}} {
+		got := reported[i].ReportedDevice.Twins[0].Reported
+		if got.Value != want.value || got.Metadata["timestamp"] != want.timestamp || got.Metadata["type"] != "boolean" {
+			t.Errorf("update %d = %v, want %s at %s", i, got, want.value, want.timestamp)
+		}
+	}
+}
+
+func TestApplyOnStart(t *testing.T) {
+	twin := func(name, desired string) common.Twin {
+		return common.Twin{PropertyName: name, ObservedDesired: common.TwinProperty{Value: desired}}
+	}
+	old := &common.DeviceInstance{Twins: []common.Twin{
+		twin("ptzAbsolute", `{"pan":0.5}`),
+		twin("ptzRelative", `{"pan":0.1}`),
+		twin("ptzContinuous", `{"pan":0.1}`),
+		twin("ptzSetPreset", "door"),
+	}}
+	updated := &common.DeviceInstance{Twins: []common.Twin{
+		twin("ptzAbsolute", `{"pan":0.5}`),
+		twin("ptzRelative", `{"pan":0.2}`),
+		twin("ptzContinuous", `{"pan":0.1}`),
+		twin("ptzSetPreset", "door"),
+		twin("ptzRemovePreset", "window"),
+	}}
+	changed := changedTwins(old, updated)
+
+	tests := []struct {
+		name      string
+		operation string
+		changed   map[string]bool
+		apply     bool
+	}{
+		{"ptzAbsolute", driver.PTZAbsoluteMove, nil, true},
+		{"ptzZoom", driver.PTZZoom, nil, true},
+		{"ptzGotoPreset", driver.PTZGotoPreset, nil, true},
+		// the first start of the device applies no relative command
+		{"ptzRelative", driver.PTZRelativeMove, nil, false},
+		{"ptzSetHome", driver.PTZSetHome, nil, false},
+		{"ptzAbsolute", driver.PTZAbsoluteMove, changed, true},
+		{"ptzRelative", driver.PTZRelativeMove, changed, true},
+		{"ptzContinuous", driver.PTZContinuousMove, changed, false},
+		{"ptzSetPreset", driver.PTZSetPreset, changed, false},
+		{"ptzRemovePreset", driver.PTZRemovePreset, changed, true},
+	}
+	for _, tt := range tests {
+		visitor := &driver.VisitorConfig{VisitorConfigData: driver.VisitorConfigData{PTZ: &driver.PTZVisitorConfig{Operation: tt.operation}}}
+		if got := applyOnStart(visitor, &common.Twin{PropertyName: tt.name}, tt.changed); got != tt.apply {
+			t.Errorf("applyOnStart(%s, changed %v) = %v, want %v", tt.name, tt.changed, got, tt.apply)
+		}
+	}
+	// other settings are applied on every start
+	if !applyOnStart(&driver.VisitorConfig{VisitorConfigData: driver.VisitorConfigData{Media: "brightness"}}, &common.Twin{PropertyName: "brightness"}, nil) {
+		t.Error("media settings are not applied on start")
+	}
+}
@@ -0,0 +1,83 @@
+package device
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"github.com/kubeedge/onvif/data/stream"
+)
+
+// DeviceArtifactRoute is the REST route that lists the frames and videos
+// saved for a stream property.
+const DeviceArtifactRoute = "/api/v1/artifact/{id}/{property}"
+
+// DeviceArtifactResponse is returned for a GET request to DeviceArtifactRoute.
+type DeviceArtifactResponse struct {
+	DeviceName   string            `json:"deviceName"`
+	PropertyName string            `json:"propertyName"`
+	Artifacts    []stream.Artifact `json:"artifacts"`
+}
+
+// ListArtifacts returns the artifacts of a stream property created at or
+// after since, oldest first.
+func (d *DevPanel) ListArtifacts(deviceID string, propertyName string, since time.Time) ([]stream.Artifact, error) {
+	d.serviceMutex.Lock()
+	dev, ok := d.devices[deviceID]
+	d.serviceMutex.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrDeviceNotFound, deviceID)
+	}
+	found := false
+	for _, twin := range dev.Instance.Twins {
+		found = found || twin.PropertyName == propertyName
+	}
+	if !found {
+		return nil, fmt.Errorf("%w: %s", ErrPropertyNotFound, propertyName)
+	}
+	artifacts := stream.LookupArtifacts(deviceID, propertyName)
+	if artifacts == nil {
+		return []stream.Artifact{}, nil
+	}
+	return artifacts.List(since), nil
+}
+
+// DeviceArtifactHandler returns the handler of GET requests to
+// DeviceArtifactRoute. The since query parameter, an RFC 3339 time, skips
+// older artifacts.
+func DeviceArtifactHandler(d *DevPanel) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		urlItem := strings.Split(strings.TrimSuffix(request.URL.Path, "/"), "/")
+		deviceID := urlItem[len(urlItem)-2]
+		propertyName := urlItem[len(urlItem)-1]
+
+		var since time.Time
+		if value := request.URL.Query().Get("since"); value != "" {
+			var err error
+			if since, err = time.Parse(time.RFC3339, value); err != nil {
+				http.Error(writer, fmt.Sprintf("Parse since error: %v", err), http.StatusBadRequest)
+				return
+			}
+		}
+		artifacts, err := d.ListArtifacts(deviceID, propertyName, since)
+		switch {
+		case errors.Is(err, ErrDeviceNotFound), errors.Is(err, ErrPropertyNotFound):
+			http.Error(writer, err.Error(), http.StatusNotFound)
+			return
+		case err != nil:
+			http.Error(writer, fmt.Sprintf("List artifacts error: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		writer.Header().Set("Content-Type", "application/json")
+		response := DeviceArtifactResponse{DeviceName: deviceID, PropertyName: propertyName, Artifacts: artifacts}
+		if err := json.NewEncoder(writer).Encode(response); err != nil {
+			klog.Errorf("Write response of %s/%s error: %v", deviceID, propertyName, err)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package device
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	dmiapi "github.com/kubeedge/kubeedge/pkg/apis/dmi/v1beta1"
+	"github.com/kubeedge/mapper-framework/pkg/common"
+	"github.com/kubeedge/mapper-framework/pkg/global"
+	"github.com/kubeedge/mapper-framework/pkg/grpcclient"
+	"github.com/kubeedge/onvif/driver"
+)
+
+// eventTwin is a property that reports the events of a topic.
+type eventTwin struct {
+	deviceName      string
+	deviceNamespace string
+	twin            common.Twin
+	visitorConfig   *driver.VisitorConfig
+	// dataPanel pushes the events, nil if the property has no push method
+	dataPanel global.DataPanel
+	// last value reported, events that do not change it are only pushed
+	last string
+}
+
+// reportDeviceStatus sends twin updates to edgecore, tests replace it.
+var reportDeviceStatus = grpcclient.ReportDeviceStatus
+
+func newEventTwin(dev *driver.CustomizedDev, twin common.Twin, visitorConfig *driver.VisitorConfig) *eventTwin {
+	t := &eventTwin{
+		deviceName:      dev.Instance.Name,
+		deviceNamespace: dev.Instance.Namespace,
+		twin:            twin,
+		visitorConfig:   visitorConfig,
+	}
+	if twin.Property.PushMethod.MethodConfig != nil && twin.Property.PushMethod.MethodName != "" {
+		dataPanel, err := newDataPanel(&twin)
+		if err != nil {
+			klog.Errorf("%s of device %s will not be pushed: %v", twin.PropertyName, dev.Instance.Name, err)
+		}
+		t.dataPanel = dataPanel
+	}
+	return t
+}
+
+// eventHandler reports the events of the camera to the twins they match
+// until ctx is done.
+func eventHandler(ctx context.Context, dev *driver.CustomizedDev, twins []*eventTwin) {
+	dev.CustomizedClient.RunEvents(ctx, func(event driver.Event) {
+		dispatchEvent(twins, event)
+	})
+}
+
+func dispatchEvent(twins []*eventTwin, event driver.Event) {
+	for _, t := range twins {
+		if value, ok := t.visitorConfig.Event.Match(event); ok {
+			t.report(value, event.Time)
+		}
+	}
+}
+
+// report sends the value with the time of the event to the cloud and the
+// push method of the twin.
+func (t *eventTwin) report(value string, at time.Time) {
+	timestamp := strconv.FormatInt(at.UnixMilli(), 10)
+	if t.twin.Property.ReportToCloud && value != t.last {
+		metadata := map[string]string{"type": t.twin.ObservedDesired.Metadata.Type, "timestamp": timestamp}
+		request := &dmiapi.ReportDeviceStatusRequest{
+			DeviceName:      t.deviceName,
+			DeviceNamespace: t.deviceNamespace,
+			ReportedDevice: &dmiapi.DeviceStatus{
+				Twins: []*dmiapi.Twin{{
+					PropertyName:    t.twin.PropertyName,
+					Reported:        &dmiapi.TwinProperty{Value: value, Metadata: metadata},
+					ObservedDesired: &dmiapi.TwinProperty{Value: t.twin.ObservedDesired.Value, Metadata: metadata},
+				}},
+			},
+		}
+		if err := reportDeviceStatus(request); err != nil {
+			klog.Errorf("fail to report event %s of %s with err: %+v", t.twin.PropertyName, t.deviceName, err)
+		} else {
+			t.last = value
+		}
+	}
+	if t.dataPanel != nil {
+		dataModel := common.NewDataModel(t.deviceName, t.twin.PropertyName, t.deviceNamespace,
+			common.WithType(t.twin.ObservedDesired.Metadata.Type), common.WithValue(value), common.WithTimeStamp(at.UnixMilli()))
+		t.dataPanel.Push(dataModel)
+	}
+}
@@ -0,0 +1,206 @@
+package device
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	dmiapi "github.com/kubeedge/kubeedge/pkg/apis/dmi/v1beta1"
+	"github.com/kubeedge/mapper-framework/pkg/common"
+	"github.com/kubeedge/mapper-framework/pkg/grpcclient"
+	"github.com/kubeedge/onvif/driver"
+)
+
+// transitions records the states reported by a StateMachine.
+type transitions struct {
+	mutex  sync.Mutex
+	states []DeviceState
+}
+
+func (r *transitions) report(state DeviceState, _ string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.states = append(r.states, state)
+}
+
+func (r *transitions) get() []DeviceState {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]DeviceState(nil), r.states...)
+}
+
+func equalStates(got, want []DeviceState) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestConnectRetriesUntilCancelled(t *testing.T) {
+	recorder := &transitions{}
+	state := NewStateMachine("camera", recorder.report)
+	// there is no password file, so every attempt fails
+	client, err := driver.NewClient(driver.ProtocolConfig{ConfigData: driver.ConfigData{URL: "127.0.0.1:1", Password: filepath.Join(t.TempDir(), "missing")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dev := &driver.CustomizedDev{CustomizedClient: client, Instance: common.DeviceInstance{ID: "camera"}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan bool)
+	go func() { done <- connect(ctx, dev, state) }()
+	deadline := time.Now().Add(5 * time.Second)
+	for s, _ := state.State(); s != StateOffline && time.Now().Before(deadline); s, _ = state.State() {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	select {
+	case ok := <-done:
+		if ok {
+			t.Fatal("connect() = true for a camera that can not be initialized")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("connect() did not return after the context was cancelled")
+	}
+
+	_, reason := state.State()
+	if !strings.HasPrefix(reason, "connect attempt 1 failed") {
+		t.Errorf("reason = %q, want the failed attempt", reason)
+	}
+	if got, want := recorder.get(), []DeviceState{StateInitializing, StateOffline}; !equalStates(got, want) {
+		t.Errorf("reported %v, want %v", got, want)
+	}
+	// a failed connect is not a lost connection, start() is still connecting
+	select {
+	case <-state.Lost():
+		t.Error("a device which never connected is reported as lost")
+	default:
+	}
+}
+
+func TestTwinReadFailuresDegradeDevice(t *testing.T) {
+	recorder := &transitions{}
+	state := NewStateMachine("camera", recorder.report)
+	state.Connected()
+	client, err := driver.NewClient(driver.ProtocolConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the camera is not initialized, so reading the twin fails
+	twin := &TwinData{
+		DeviceName:    "camera",
+		Client:        client,
+		Name:          "getURI",
+		VisitorConfig: &driver.VisitorConfig{},
+		State:         state,
+	}
+
+	for i := 0; i < MaxReadFailures; i++ {
+		if _, err := twin.GetPayLoad(); err == nil {
+			t.Fatal("GetPayLoad() succeeded without a camera")
+		}
+	}
+	want := []DeviceState{StateInitializing, StateOnline, StateDegraded, StateOffline}
+	if got := recorder.get(); !equalStates(got, want) {
+		t.Fatalf("reported %v, want %v", got, want)
+	}
+	select {
+	case <-state.Lost():
+	default:
+		t.Fatal("the device is not reconnected after the reads failed")
+	}
+}
+
+func TestReportDeviceState(t *testing.T) {
+	states := make(chan *dmiapi.ReportDeviceStatesRequest, 8)
+	twins := make(chan *dmiapi.ReportDeviceStatusRequest, 8)
+	reportDeviceStates = func(request *dmiapi.ReportDeviceStatesRequest) error {
+		states <- request
+		return nil
+	}
+	reportDeviceStatus = func(request *dmiapi.ReportDeviceStatusRequest) error {
+		twins <- request
+		return nil
+	}
+	defer func() {
+		reportDeviceStates = grpcclient.ReportDeviceStates
+		reportDeviceStatus = grpcclient.ReportDeviceStatus
+	}()
+
+	m := NewStateMachine("camera-id", reportDeviceState("camera", "default"))
+	m.ConnectFailed(1, errors.New("connection refused"))
+	m.Connected()
+	m.Removing("device is being removed")
+
+	want := []struct {
+		state  DeviceState
+		reason string
+	}{
+		{StateInitializing, "device is being initialized"},
+		{StateOffline, "connect attempt 1 failed: connection refused"},
+		{StateOnline, "device connected"},
+		{StateRemoving, "device is being removed"},
+	}
+	for _, w := range want {
+		select {
+		case request := <-states:
+			if request.DeviceName != "camera" || request.DeviceNamespace != "default" || request.State != string(w.state) {
+				t.Errorf("state request = %+v, want %s", request, w.state)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("state %s not reported", w.state)
+		}
+		select {
+		case request := <-twins:
+			reported := request.ReportedDevice.Twins
+			if len(reported) != 1 || reported[0].PropertyName != StateTwin {
+				t.Fatalf("twins = %v, want one %s twin", reported, StateTwin)
+			}
+			if value := reported[0].Reported; value.Value != string(w.state) || value.Metadata["reason"] != w.reason {
+				t.Errorf("reported %q (%q), want %q (%q)", value.Value, value.Metadata["reason"], w.state, w.reason)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("reason of state %s not reported", w.state)
+		}
+	}
+}
+
+func TestDeregisterReportsRemoving(t *testing.T) {
+	sent := make(chan string, 8)
+	reportDeviceStates = func(request *dmiapi.ReportDeviceStatesRequest) error {
+		sent <- request.State
+		return nil
+	}
+	reportDeviceStatus = func(*dmiapi.ReportDeviceStatusRequest) error { return nil }
+	defer func() {
+		reportDeviceStates = grpcclient.ReportDeviceStates
+		reportDeviceStatus = grpcclient.ReportDeviceStatus
+	}()
+	d := &DevPanel{states: map[string]*StateMachine{
+		"camera-id": NewStateMachine("camera-id", reportDeviceState("camera", "default")),
+	}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := d.Deregister(ctx); err != nil {
+		t.Fatalf("Deregister() error = %v", err)
+	}
+	// the reports are sent once Deregister returns
+	close(sent)
+	var states []string
+	for state := range sent {
+		states = append(states, state)
+	}
+	if want := []string{string(StateInitializing), string(StateRemoving)}; strings.Join(states, ",") != strings.Join(want, ",") {
+		t.Errorf("reported %v, want %v", states, want)
+	}
+}
@@ -28,6 +28,7 @@ type TwinData struct {
 	Results         interface{}
 	CollectCycle    time.Duration
 	ReportToCloud   bool
+	State           *StateMachine
 }
 
 func (td *TwinData) GetPayLoad() ([]byte, error) {
@@ -35,8 +36,10 @@ func (td *TwinData) GetPayLoad() ([]byte, error) {
 	td.VisitorConfig.VisitorConfigData.DataType = strings.ToLower(td.VisitorConfig.VisitorConfigData.DataType)
 	td.Results, err = td.Client.GetDeviceData(td.VisitorConfig)
 	if err != nil {
+		td.State.ReadFailed(err)
 		return nil, fmt.Errorf("get device data failed: %v", err)
 	}
+	td.State.ReadSucceeded()
 	sData, err := common.ConvertToString(td.Results)
 	if err != nil {
 		klog.Errorf("Failed to convert %s %s value as string : %v", td.DeviceName, td.Name, err)
@@ -80,7 +83,6 @@ func (td *TwinData) PushToEdgeCore() {
 		DeviceNamespace: td.DeviceNamespace,
 		ReportedDevice: &dmiapi.DeviceStatus{
 			Twins: twins,
-			//State: "OK",
 		},
 	}
 
@@ -97,6 +99,7 @@ func (td *TwinData) Run(ctx context.Context) {
 		td.CollectCycle = common.DefaultCollectCycle
 	}
 	ticker := time.NewTicker(td.CollectCycle)
+	defer ticker.Stop()
 	for {
 		select {
 		case <-ticker.C:
@@ -0,0 +1,60 @@
+package device
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+// DeviceWriteRoute is the REST route that writes a value to a device property,
+// such as the PTZ properties of a camera.
+const DeviceWriteRoute = "/api/v1/device/{id}/{property}"
+
+// DeviceWriteRequest is the body of a PUT request to DeviceWriteRoute.
+type DeviceWriteRequest struct {
+	Value string `json:"value"`
+}
+
+// DeviceWriteResponse is returned after a successful write.
+type DeviceWriteResponse struct {
+	DeviceName   string `json:"deviceName"`
+	PropertyName string `json:"propertyName"`
+	Value        string `json:"value"`
+}
+
+// DeviceWriteHandler returns the handler of PUT requests to DeviceWriteRoute.
+func DeviceWriteHandler(d *DevPanel) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		urlItem := strings.Split(strings.TrimSuffix(request.URL.Path, "/"), "/")
+		deviceID := urlItem[len(urlItem)-2]
+		propertyName := urlItem[len(urlItem)-1]
+
+		var body DeviceWriteRequest
+		if err := json.NewDecoder(request.Body).Decode(&body); err != nil {
+			http.Error(writer, fmt.Sprintf("Decode request body error: %v", err), http.StatusBadRequest)
+			return
+		}
+		err := d.WriteDevice(deviceID, propertyName, body.Value)
+		switch {
+		case errors.Is(err, ErrDeviceNotFound), errors.Is(err, ErrPropertyNotFound):
+			http.Error(writer, err.Error(), http.StatusNotFound)
+			return
+		case errors.Is(err, ErrReadOnly):
+			http.Error(writer, err.Error(), http.StatusMethodNotAllowed)
+			return
+		case err != nil:
+			http.Error(writer, fmt.Sprintf("Write device data error: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		writer.Header().Set("Content-Type", "application/json")
+		response := DeviceWriteResponse{DeviceName: deviceID, PropertyName: propertyName, Value: body.Value}
+		if err := json.NewEncoder(writer).Encode(response); err != nil {
+			klog.Errorf("Write response of %s/%s error: %v", deviceID, propertyName, err)
+		}
+	}
+}
@@ -17,7 +17,13 @@ type CustomizedDev struct {
 type CustomizedClient struct {
 	deviceMutex sync.Mutex
 	ProtocolConfig
-	dev *goonvif.Device //Save the device controller created by the device driver
+	dev          *goonvif.Device             //Save the device controller created by the device driver
+	deviceParams goonvif.DeviceParams        // connection parameters of dev, used for calls it can not make itself
+	ptzToken     string                      // profile token used for PTZ operations, resolved on first use
+	ptzWritten   map[PTZVisitorConfig]string // last value written to the PTZ operations that do not move, see getPTZ
+
+	eventMutex sync.Mutex
+	events     map[string]Event // latest event of every topic and source, see RunEvents
 }
 
 type ProtocolConfig struct {
@@ -43,4 +49,46 @@ type VisitorConfigData struct {
 	FrameCount    int    `json:"frameCount"`    // the username of onvif device
 	FrameInterval int    `json:"frameInterval"` // the password of device user
 	VideoNum      int    `json:"videoNum"`      // number of videos collected
+	// Profile selects the media profile by token or name, the first profile of the device if empty
+	Profile string `json:"profile,omitempty"`
+	// Media is the media item the property reads or writes, the stream URI if empty, see media.go
+	Media string `json:"media,omitempty"`
+	// PTZ makes the property a writable pan/tilt/zoom control, see ptz.go
+	PTZ *PTZVisitorConfig `json:"ptz,omitempty"`
+	// Event makes the property report the events of a topic, see event.go
+	Event *EventVisitorConfig `json:"event,omitempty"`
+	// Backend saves the frames and videos of stream properties, native or ffmpeg, see data/stream/backend.go
+	Backend string `json:"backend,omitempty"`
+	// Retention limits the files a stream property keeps in OutputDir, see data/stream/artifact.go
+	Retention *RetentionVisitorConfig `json:"retention,omitempty"`
+	// Upload moves the files of a stream property to an S3 compatible object store, see data/stream/upload.go
+	Upload *UploadVisitorConfig `json:"upload,omitempty"`
+}
+
+type PTZVisitorConfig struct {
+	Operation    string  `json:"operation"`              // one of the PTZ* operations
+	ProfileToken string  `json:"profileToken,omitempty"` // media profile to control, resolved from the device if empty
+	Speed        float64 `json:"speed,omitempty"`        // speed of pan, tilt and zoom, defaults to the maximum
+	Timeout      string  `json:"timeout,omitempty"`      // duration of a continuous move, e.g. PT5S
+}
+
+type EventVisitorConfig struct {
+	Topic    string `json:"topic"`              // motion, tampering, digitalInput or an ONVIF topic such as tns1:VideoSource/MotionAlarm
+	DataItem string `json:"dataItem,omitempty"` // name of the message data item to report, e.g. IsMotion, guessed if empty
+	Source   string `json:"source,omitempty"`   // only report events with this source item value, e.g. a digital input token
+}
+
+type RetentionVisitorConfig struct {
+	MaxFiles int    `json:"maxFiles,omitempty"` // files kept on disk, oldest removed first
+	MaxBytes int64  `json:"maxBytes,omitempty"` // total size of the files kept on disk
+	MaxAge   string `json:"maxAge,omitempty"`   // age of the files kept, e.g. 24h
+}
+
+type UploadVisitorConfig struct {
+	Endpoint      string `json:"endpoint"`                // URL of the object store, e.g. http://minio:9000
+	Region        string `json:"region,omitempty"`        // region of the bucket, us-east-1 if empty
+	Bucket        string `json:"bucket"`                  // bucket of the objects, addressed in the path
+	Prefix        string `json:"prefix,omitempty"`        // prefix of the object keys
+	AccessKey     string `json:"accessKey"`               // access key ID
+	SecretKeyFile string `json:"secretKeyFile,omitempty"` // file holding the secret access key
 }
@@ -1,7 +1,6 @@
 package driver
 
 import (
-	"context"
 	"errors"
 	"fmt"
 	"net/http"
@@ -9,8 +8,6 @@ import (
 	"sync"
 
 	goonvif "github.com/use-go/onvif"
-	"github.com/use-go/onvif/media"
-	mediasdk "github.com/use-go/onvif/sdk/media"
 	"k8s.io/klog/v2"
 )
 
@@ -18,6 +15,8 @@ func NewClient(protocol ProtocolConfig) (*CustomizedClient, error) {
 	client := &CustomizedClient{
 		ProtocolConfig: protocol,
 		deviceMutex:    sync.Mutex{},
+		ptzWritten:     make(map[PTZVisitorConfig]string),
+		events:         make(map[string]Event),
 		// TODO initialize the variables you added
 	}
 	return client, nil
@@ -43,6 +42,8 @@ func (c *CustomizedClient) InitDevice() error {
 		return err
 	}
 	c.dev = dev
+	c.deviceParams = deviceParams
+	c.ptzToken = ""
 	return nil
 
 }
@@ -50,38 +51,51 @@ func (c *CustomizedClient) InitDevice() error {
 func (c *CustomizedClient) GetDeviceData(visitor *VisitorConfig) (interface{}, error) {
 	// you can use c.ProtocolConfig and visitor
 	// Through this function, the authentication file and RTSP URI of the onvif device will be returned.
-	ctx := context.Background()
 	if c.dev == nil {
 		return nil, fmt.Errorf("device does not exist")
 	}
-
-	// get onvif device ProfilesToken
-	getProfiles := media.GetProfiles{}
-	profilesResp, err := mediasdk.Call_GetProfiles(ctx, c.dev, getProfiles)
-	if err != nil {
-		klog.Error(err)
-		return nil, err
-	} else if len(profilesResp.Profiles) == 0 {
-		return "", fmt.Errorf("no onvif profiles found")
+	// PTZ move properties report the current position of the camera
+	if visitor.PTZ != nil {
+		c.deviceMutex.Lock()
+		defer c.deviceMutex.Unlock()
+		return c.getPTZ(visitor.PTZ)
+	}
+	// event properties report the latest event received by RunEvents
+	if visitor.Event != nil {
+		return c.getEvent(visitor.Event), nil
 	}
-	token := profilesResp.Profiles[0].Token
 
-	// get onvif device RTSP Stream Uri with ProfilesToken
-	getStreamUri := media.GetStreamUri{
-		ProfileToken: token,
+	// media properties read the stream URI by default
+	c.deviceMutex.Lock()
+	defer c.deviceMutex.Unlock()
+	return c.getMedia(visitor)
+}
+
+func (c *CustomizedClient) SetDeviceData(data interface{}, visitor *VisitorConfig) error {
+	// Properties with a PTZ configuration control the position of the camera,
+	// media properties change video encoder and imaging settings, other
+	// properties have nothing to set.
+	if visitor.PTZ == nil && visitor.Media == "" {
+		klog.V(4).Infof("onvif visitor has no settable configuration")
+		return nil
 	}
-	uriResp, err := mediasdk.Call_GetStreamUri(ctx, c.dev, getStreamUri)
-	if err != nil {
-		return "", fmt.Errorf("GetStreamURI failed: %v", err.Error())
+	if c.dev == nil {
+		return fmt.Errorf("device does not exist")
+	}
+	c.deviceMutex.Lock()
+	defer c.deviceMutex.Unlock()
+	if visitor.PTZ != nil {
+		return c.setPTZ(data, visitor.PTZ)
 	}
-	return string(uriResp.MediaUri.Uri), nil
+	return c.setMedia(data, visitor)
 }
 
-func (c *CustomizedClient) SetDeviceData(data interface{}, visitor *VisitorConfig) error {
-	// TODO: set device's data, such as controlling the position and posture of the camera, will be added in subsequent versions
-	// you can use c.ProtocolConfig and visitor
-	klog.V(2).Infof("still wait to complete setdevicedata feature")
-	return nil
+// Credentials returns the user name and password of the device, for streams
+// that require them.
+func (c *CustomizedClient) Credentials() (string, string) {
+	c.deviceMutex.Lock()
+	defer c.deviceMutex.Unlock()
+	return c.deviceParams.Username, c.deviceParams.Password
 }
 
 func (c *CustomizedClient) StopDevice() error {
@@ -0,0 +1,409 @@
+package driver
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// Topic aliases that can be configured on an event property instead of a full
+// ONVIF topic. Each alias matches the topics cameras commonly use for it.
+const (
+	EventMotion       = "motion"
+	EventTampering    = "tampering"
+	EventDigitalInput = "digitalInput"
+)
+
+var eventTopics = map[string][]string{
+	EventMotion: {
+		"VideoAnalytics/Motion",
+		"RuleEngine/CellMotionDetector/Motion",
+		"RuleEngine/MotionRegionDetector/Motion",
+		"VideoSource/MotionAlarm",
+	},
+	EventTampering: {
+		"VideoAnalytics/Tampering",
+		"RuleEngine/TamperDetector/Tamper",
+		"VideoSource/GlobalSceneChange",
+		"VideoSource/ImageTooBlurry",
+		"VideoSource/ImageTooDark",
+		"VideoSource/ImageTooBright",
+	},
+	EventDigitalInput: {
+		"Device/Trigger/DigitalInput",
+	},
+}
+
+// data items that carry the state of the well known topics, used when the
+// visitor does not name one and the message has several.
+var stateItems = []string{"State", "IsMotion", "IsTamper", "LogicalState", "Value"}
+
+const (
+	// SubscriptionLifetime is the termination time requested for the pull
+	// point subscription, it is renewed when half of it has passed.
+	SubscriptionLifetime = time.Minute
+	// pullTimeout is how long a PullMessages call waits for events.
+	pullTimeout = 10 * time.Second
+	// eventCallTimeout bounds event service calls on top of their own timeout.
+	eventCallTimeout = 10 * time.Second
+	pullMessageLimit = 100
+)
+
+// Event is a notification received from the camera.
+type Event struct {
+	// Topic without namespace prefixes, e.g. RuleEngine/CellMotionDetector/Motion
+	Topic string
+	// Operation is Initialized, Changed or Deleted for property events
+	Operation string
+	Time      time.Time
+	Source    map[string]string
+	Data      map[string]string
+}
+
+// Match returns the value the event reports for the visitor, booleans are
+// normalized to true or false.
+func (config *EventVisitorConfig) Match(event Event) (string, bool) {
+	if event.Operation == "Deleted" || !config.matchTopic(event.Topic) {
+		return "", false
+	}
+	if config.Source != "" {
+		found := false
+		for _, value := range event.Source {
+			found = found || value == config.Source
+		}
+		if !found {
+			return "", false
+		}
+	}
+	value, ok := dataItem(event.Data, config.DataItem)
+	if !ok {
+		return "", false
+	}
+	if b, err := strconv.ParseBool(value); err == nil {
+		value = strconv.FormatBool(b)
+	}
+	return value, true
+}
+
+func (config *EventVisitorConfig) matchTopic(topic string) bool {
+	topics, ok := eventTopics[config.Topic]
+	if !ok {
+		topics = []string{normalizeTopic(config.Topic)}
+	}
+	for _, t := range topics {
+		if topic == t || strings.HasPrefix(topic, t+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func dataItem(data map[string]string, name string) (string, bool) {
+	if name != "" {
+		value, ok := data[name]
+		return value, ok
+	}
+	if len(data) == 1 {
+		for _, value := range data {
+			return value, true
+		}
+	}
+	for _, item := range stateItems {
+		if value, ok := data[item]; ok {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// normalizeTopic strips the namespace prefixes of a topic expression such as
+// tns1:RuleEngine/tnsaxis:CellMotionDetector/Motion.
+func normalizeTopic(topic string) string {
+	parts := strings.Split(strings.TrimSpace(topic), "/")
+	for i, part := range parts {
+		if j := strings.LastIndex(part, ":"); j >= 0 {
+			parts[i] = part[j+1:]
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+type createPullPointSubscription struct {
+	XMLName                xml.Name `xml:"tev:CreatePullPointSubscription"`
+	InitialTerminationTime string   `xml:"tev:InitialTerminationTime"`
+}
+
+type pullMessages struct {
+	XMLName      xml.Name `xml:"tev:PullMessages"`
+	Timeout      string   `xml:"tev:Timeout"`
+	MessageLimit int      `xml:"tev:MessageLimit"`
+}
+
+type renew struct {
+	XMLName         xml.Name `xml:"wsnt:Renew"`
+	TerminationTime string   `xml:"wsnt:TerminationTime"`
+}
+
+type unsubscribe struct {
+	XMLName xml.Name `xml:"wsnt:Unsubscribe"`
+}
+
+// subscriptionTimes is part of the replies to subscribe and renew requests.
+type subscriptionTimes struct {
+	CurrentTime     string
+	TerminationTime string
+}
+
+type createPullPointSubscriptionResponse struct {
+	SubscriptionReference struct {
+		Address             string
+		ReferenceParameters struct {
+			Items []referenceParameter `xml:",any"`
+		}
+	}
+	subscriptionTimes
+}
+
+type referenceParameter struct {
+	XMLName xml.Name
+	Value   string `xml:",innerxml"`
+}
+
+type pullMessagesResponse struct {
+	NotificationMessage []notificationMessage
+}
+
+type notificationMessage struct {
+	Topic   string
+	Message struct {
+		Message struct {
+			UtcTime           string       `xml:"UtcTime,attr"`
+			PropertyOperation string       `xml:"PropertyOperation,attr"`
+			Source            []simpleItem `xml:"Source>SimpleItem"`
+			Data              []simpleItem `xml:"Data>SimpleItem"`
+		}
+	}
+}
+
+type simpleItem struct {
+	Name  string `xml:"Name,attr"`
+	Value string `xml:"Value,attr"`
+}
+
+func (m notificationMessage) event() Event {
+	msg := m.Message.Message
+	event := Event{
+		Topic:     normalizeTopic(m.Topic),
+		Operation: msg.PropertyOperation,
+		Time:      time.Now(),
+		Source:    make(map[string]string),
+		Data:      make(map[string]string),
+	}
+	if t, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(msg.UtcTime)); err == nil {
+		event.Time = t
+	}
+	for _, item := range msg.Source {
+		event.Source[item.Name] = item.Value
+	}
+	for _, item := range msg.Data {
+		event.Data[item.Name] = item.Value
+	}
+	return event
+}
+
+// key identifies the property an event reports on, its topic and source.
+func (e Event) key() string {
+	items := make([]string, 0, len(e.Source))
+	for name, value := range e.Source {
+		items = append(items, name+"="+value)
+	}
+	sort.Strings(items)
+	return e.Topic + "?" + strings.Join(items, "&")
+}
+
+// subscription is a pull point created on the camera.
+type subscription struct {
+	address  string
+	headers  []string // WS-Addressing headers of calls to the subscription
+	lifetime time.Duration
+	renewAt  time.Time
+}
+
+func (s *subscription) extend(times subscriptionTimes) {
+	s.lifetime = SubscriptionLifetime
+	current, err1 := time.Parse(time.RFC3339Nano, strings.TrimSpace(times.CurrentTime))
+	termination, err2 := time.Parse(time.RFC3339Nano, strings.TrimSpace(times.TerminationTime))
+	// the camera clock may be off, only the difference is used
+	if err1 == nil && err2 == nil && termination.After(current) {
+		s.lifetime = termination.Sub(current)
+	}
+	s.renewAt = time.Now().Add(s.lifetime / 2)
+}
+
+// RunEvents subscribes to the events of the camera and calls handle for
+// every notification until ctx is done. The subscription is renewed before
+// it terminates and created again when the camera drops it, for instance
+// after a reboot.
+func (c *CustomizedClient) RunEvents(ctx context.Context, handle func(Event)) {
+	for attempt := 0; ; {
+		sub, err := c.subscribe(ctx)
+		if err == nil {
+			attempt = 0
+			err = c.pull(ctx, sub, handle)
+			c.unsubscribe(sub)
+		} else {
+			attempt++
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		klog.Warningf("Onvif event subscription of %s failed, retrying: %v", c.URL, err)
+		select {
+		case <-time.After(resubscribeDelay(attempt)):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (c *CustomizedClient) subscribe(ctx context.Context) (*subscription, error) {
+	c.deviceMutex.Lock()
+	dev := c.dev
+	c.deviceMutex.Unlock()
+	if dev == nil {
+		return nil, errors.New("device does not exist")
+	}
+	address := dev.GetEndpoint("events")
+	if address == "" {
+		return nil, errors.New("device has no event service")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, eventCallTimeout)
+	defer cancel()
+	var resp createPullPointSubscriptionResponse
+	request := createPullPointSubscription{InitialTerminationTime: xsdDuration(SubscriptionLifetime)}
+	if err := c.callAddress(ctx, address, nil, request, &resp); err != nil {
+		return nil, err
+	}
+	reference := resp.SubscriptionReference
+	sub := &subscription{address: c.hostAddress(strings.TrimSpace(reference.Address))}
+	if sub.address == "" {
+		return nil, errors.New("no pull point address in the subscription reply")
+	}
+	sub.headers = append(sub.headers, "<wsa:To>"+escapeXML(sub.address)+"</wsa:To>")
+	for _, param := range reference.ReferenceParameters.Items {
+		sub.headers = append(sub.headers, fmt.Sprintf(`<%s xmlns="%s">%s</%s>`,
+			param.XMLName.Local, escapeXML(param.XMLName.Space), param.Value, param.XMLName.Local))
+	}
+	sub.extend(resp.subscriptionTimes)
+	klog.V(2).Infof("Subscribed to onvif events of %s at %s for %v", c.URL, sub.address, sub.lifetime)
+	return sub, nil
+}
+
+// pull receives events until ctx is done or the subscription fails.
+func (c *CustomizedClient) pull(ctx context.Context, sub *subscription, handle func(Event)) error {
+	for ctx.Err() == nil {
+		if !time.Now().Before(sub.renewAt) {
+			if err := c.renew(ctx, sub); err != nil {
+				return err
+			}
+		}
+		timeout := pullTimeout
+		if timeout > sub.lifetime/4 {
+			timeout = sub.lifetime / 4
+		}
+		if timeout < time.Second {
+			timeout = time.Second
+		}
+		callCtx, cancel := context.WithTimeout(ctx, timeout+eventCallTimeout)
+		var resp pullMessagesResponse
+		err := c.callAddress(callCtx, sub.address, sub.headers,
+			pullMessages{Timeout: xsdDuration(timeout), MessageLimit: pullMessageLimit}, &resp)
+		cancel()
+		if err != nil {
+			return err
+		}
+		for _, msg := range resp.NotificationMessage {
+			event := msg.event()
+			klog.V(4).Infof("Onvif event of %s: %s %s %v", c.URL, event.Topic, event.Operation, event.Data)
+			c.eventMutex.Lock()
+			c.events[event.key()] = event
+			c.eventMutex.Unlock()
+			handle(event)
+		}
+	}
+	return ctx.Err()
+}
+
+func (c *CustomizedClient) renew(ctx context.Context, sub *subscription) error {
+	ctx, cancel := context.WithTimeout(ctx, eventCallTimeout)
+	defer cancel()
+	var resp subscriptionTimes
+	if err := c.callAddress(ctx, sub.address, sub.headers, renew{TerminationTime: xsdDuration(SubscriptionLifetime)}, &resp); err != nil {
+		return err
+	}
+	sub.extend(resp)
+	return nil
+}
+
+// unsubscribe releases the pull point, the camera drops it anyway when it
+// is not renewed.
+func (c *CustomizedClient) unsubscribe(sub *subscription) {
+	ctx, cancel := context.WithTimeout(context.Background(), eventCallTimeout)
+	defer cancel()
+	if err := c.callAddress(ctx, sub.address, sub.headers, unsubscribe{}, nil); err != nil {
+		klog.V(2).Infof("Unsubscribe onvif events of %s: %v", c.URL, err)
+	}
+}
+
+// getEvent returns the value of the latest event matching the visitor, or
+// an empty string if the camera has not sent one yet.
+func (c *CustomizedClient) getEvent(config *EventVisitorConfig) string {
+	c.eventMutex.Lock()
+	defer c.eventMutex.Unlock()
+	var latest time.Time
+	var res string
+	for _, event := range c.events {
+		if value, ok := config.Match(event); ok && !event.Time.Before(latest) {
+			latest, res = event.Time, value
+		}
+	}
+	return res
+}
+
+// hostAddress replaces the host of address with the configured one, like
+// the upstream device does for service addresses.
+func (c *CustomizedClient) hostAddress(address string) string {
+	u, err := url.Parse(address)
+	if err != nil || u.Host == "" {
+		return address
+	}
+	u.Host = c.URL
+	return u.String()
+}
+
+func xsdDuration(d time.Duration) string {
+	return fmt.Sprintf("PT%dS", int(d.Seconds()))
+}
+
+func escapeXML(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// resubscribeDelay returns how long to wait before the given subscribe attempt.
+func resubscribeDelay(attempt int) time.Duration {
+	if attempt >= 5 {
+		return 30 * time.Second
+	}
+	return time.Second << uint(attempt)
+}
@@ -0,0 +1,184 @@
+package driver
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// eventReply answers the event service requests of soapCamera. PullMessages
+// waits a little for a queued notification like a camera long-polls.
+func (cam *soapCamera) eventReply(name string) string {
+	now := time.Now().UTC()
+	cam.mutex.Lock()
+	lifetime := cam.lifetime
+	if name == "CreatePullPointSubscription" {
+		cam.subscriptions++
+	}
+	subscriptions := cam.subscriptions
+	cam.mutex.Unlock()
+	times := fmt.Sprintf(`<wsnt:CurrentTime>%s</wsnt:CurrentTime><wsnt:TerminationTime>%s</wsnt:TerminationTime>`,
+		now.Format(time.RFC3339), now.Add(lifetime).Format(time.RFC3339))
+
+	switch name {
+	case "CreatePullPointSubscription":
+		return fmt.Sprintf(`<tev:CreatePullPointSubscriptionResponse><tev:SubscriptionReference>`+
+			`<wsa:Address>%s/onvif/subscription?id=%d</wsa:Address>`+
+			`<wsa:ReferenceParameters><dom0:SubscriptionId xmlns:dom0="http://example.com/event">%[2]d</dom0:SubscriptionId></wsa:ReferenceParameters>`+
+			`</tev:SubscriptionReference>%s</tev:CreatePullPointSubscriptionResponse>`, cam.server.URL, subscriptions, times)
+	case "PullMessages":
+		var messages string
+		select {
+		case msg := <-cam.notifications:
+			messages = msg
+		case <-time.After(50 * time.Millisecond):
+		}
+		return `<tev:PullMessagesResponse>` + times + messages + `</tev:PullMessagesResponse>`
+	case "Renew":
+		return `<wsnt:RenewResponse>` + times + `</wsnt:RenewResponse>`
+	}
+	return `<wsnt:UnsubscribeResponse/>`
+}
+
+func notification(topic, utcTime, source, data string) string {
+	return `<wsnt:NotificationMessage>` +
+		`<wsnt:Topic Dialect="http://www.onvif.org/ver10/tev/topicExpression/ConcreteSet">` + topic + `</wsnt:Topic>` +
+		`<wsnt:Message><tt:Message UtcTime="` + utcTime + `" PropertyOperation="Changed">` +
+		`<tt:Source>` + source + `</tt:Source><tt:Data>` + data + `</tt:Data>` +
+		`</tt:Message></wsnt:Message></wsnt:NotificationMessage>`
+}
+
+func (cam *soapCamera) count(action string) int {
+	cam.mutex.Lock()
+	defer cam.mutex.Unlock()
+	n := 0
+	for _, r := range cam.requests {
+		if r.Action == action {
+			n++
+		}
+	}
+	return n
+}
+
+func TestEventVisitorConfigMatch(t *testing.T) {
+	motion := Event{
+		Topic:     "RuleEngine/CellMotionDetector/Motion",
+		Operation: "Changed",
+		Source:    map[string]string{"VideoSourceConfigurationToken": "vsc0", "Rule": "MyMotionDetectorRule"},
+		Data:      map[string]string{"IsMotion": "1"},
+	}
+	input := Event{
+		Topic:  "Device/Trigger/DigitalInput",
+		Source: map[string]string{"InputToken": "DI_1"},
+		Data:   map[string]string{"LogicalState": "false"},
+	}
+	tests := []struct {
+		config EventVisitorConfig
+		event  Event
+		value  string
+		match  bool
+	}{
+		{EventVisitorConfig{Topic: EventMotion}, motion, "true", true},
+		{EventVisitorConfig{Topic: "tns1:RuleEngine/CellMotionDetector"}, motion, "true", true},
+		{EventVisitorConfig{Topic: EventTampering}, motion, "", false},
+		{EventVisitorConfig{Topic: EventMotion, DataItem: "State"}, motion, "", false},
+		{EventVisitorConfig{Topic: EventDigitalInput, Source: "DI_1"}, input, "false", true},
+		{EventVisitorConfig{Topic: EventDigitalInput, Source: "DI_2"}, input, "", false},
+		{EventVisitorConfig{Topic: EventMotion}, Event{Topic: motion.Topic, Operation: "Deleted", Data: motion.Data}, "", false},
+	}
+	for _, tt := range tests {
+		value, match := tt.config.Match(tt.event)
+		if value != tt.value || match != tt.match {
+			t.Errorf("%+v.Match(%s) = %q, %v, want %q, %v", tt.config, tt.event.Topic, value, match, tt.value, tt.match)
+		}
+	}
+}
+
+func TestRunEvents(t *testing.T) {
+	cam := newSOAPCamera(t)
+	// renew about every second
+	cam.lifetime = 2 * time.Second
+	client := newPTZClient(t, cam)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	received := make(chan Event, 16)
+	done := make(chan struct{})
+	go func() {
+		client.RunEvents(ctx, func(event Event) { received <- event })
+		close(done)
+	}()
+
+	cam.notifications <- notification("tns1:RuleEngine/CellMotionDetector/Motion", "2024-05-01T10:00:00Z",
+		`<tt:SimpleItem Name="VideoSourceConfigurationToken" Value="vsc0"/>`, `<tt:SimpleItem Name="IsMotion" Value="true"/>`)
+	var event Event
+	select {
+	case event = <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event received")
+	}
+	if event.Topic != "RuleEngine/CellMotionDetector/Motion" || event.Data["IsMotion"] != "true" ||
+		!event.Time.Equal(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("event = %+v", event)
+	}
+	motion := &VisitorConfig{VisitorConfigData: VisitorConfigData{Event: &EventVisitorConfig{Topic: EventMotion}}}
+	if got, err := client.GetDeviceData(motion); err != nil || got != "true" {
+		t.Errorf("GetDeviceData() = %v, %v, want true", got, err)
+	}
+
+	// pulls go to the subscription with its reference parameters
+	cam.mutex.Lock()
+	var pull string
+	for _, r := range cam.requests {
+		if r.Action == "PullMessages" {
+			pull = r.Body
+		}
+	}
+	cam.mutex.Unlock()
+	if !strings.Contains(pull, "/onvif/subscription?id=1</wsa:To>") || !strings.Contains(pull, `>1</SubscriptionId>`) {
+		t.Errorf("PullMessages lacks the addressing headers:\n%s", pull)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for cam.count("Renew") == 0 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if cam.count("Renew") == 0 {
+		t.Error("subscription not renewed")
+	}
+
+	// the camera forgets the subscription when it reboots
+	cam.mutex.Lock()
+	cam.faults["PullMessages"] = true
+	cam.mutex.Unlock()
+	for cam.count("CreatePullPointSubscription") < 2 && time.Now().Before(deadline.Add(5*time.Second)) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	cam.mutex.Lock()
+	cam.faults["PullMessages"] = false
+	cam.mutex.Unlock()
+	if n := cam.count("CreatePullPointSubscription"); n < 2 {
+		t.Fatalf("subscriptions = %d, want a new one after the pull failed", n)
+	}
+	cam.notifications <- notification("tns1:RuleEngine/CellMotionDetector/Motion", "2024-05-01T10:00:05Z",
+		`<tt:SimpleItem Name="VideoSourceConfigurationToken" Value="vsc0"/>`, `<tt:SimpleItem Name="IsMotion" Value="false"/>`)
+	select {
+	case event = <-received:
+		if event.Data["IsMotion"] != "false" {
+			t.Errorf("event after resubscribe = %+v", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event received after resubscribe")
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("RunEvents did not return after cancel")
+	}
+	if cam.count("Unsubscribe") == 0 {
+		t.Error("subscription not released")
+	}
+}
@@ -0,0 +1,407 @@
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/beevik/etree"
+	goonvif "github.com/use-go/onvif"
+	imaging "github.com/use-go/onvif/Imaging"
+	"github.com/use-go/onvif/device"
+	"github.com/use-go/onvif/media"
+	"github.com/use-go/onvif/xsd/onvif"
+)
+
+// Media items that can be configured on a property. Settings of the video
+// encoder and imaging can be written, the other items are read only.
+const (
+	// MediaStreamURI is the RTSP URI of the profile, the default item.
+	MediaStreamURI = "streamURI"
+	// MediaSnapshotURI is the HTTP URI of a JPEG snapshot of the profile.
+	MediaSnapshotURI = "snapshotURI"
+	// MediaDeviceInfo is the JSON encoded manufacturer, model, firmware
+	// version, serial number and hardware id of the camera.
+	MediaDeviceInfo = "deviceInfo"
+	// MediaVideoEncoder is the JSON encoded video encoder configuration of
+	// the profile, see encoderElements. Writes change the keys they contain.
+	MediaVideoEncoder = "videoEncoder"
+	// MediaCodec is the encoding of the profile: H264, JPEG or MPEG4.
+	MediaCodec = "codec"
+	// MediaResolution is the resolution of the profile, such as 1920x1080.
+	MediaResolution = "resolution"
+	// MediaBitrate is the bitrate limit of the profile in kbit/s.
+	MediaBitrate = "bitrate"
+	// MediaFramerate is the frame rate limit of the profile in fps.
+	MediaFramerate = "framerate"
+	// MediaImaging is the JSON encoded imaging settings of the video source
+	// of the profile, see imagingElements. Writes change the keys they contain.
+	MediaImaging = "imaging"
+	// MediaBrightness is the brightness of the video source.
+	MediaBrightness = "brightness"
+	// MediaContrast is the contrast of the video source.
+	MediaContrast = "contrast"
+	// MediaIrCutFilter is the IR cut filter mode of the video source: ON, OFF or AUTO.
+	MediaIrCutFilter = "irCutFilter"
+)
+
+var ErrProfileNotFound = errors.New("onvif profile not found")
+
+// settingElement maps a JSON key of a configuration to its element path.
+type settingElement struct {
+	key  string
+	path string
+}
+
+var encoderElements = []settingElement{
+	{"encoding", "Encoding"},
+	{"width", "Resolution/Width"},
+	{"height", "Resolution/Height"},
+	{"quality", "Quality"},
+	{"frameRateLimit", "RateControl/FrameRateLimit"},
+	{"bitrateLimit", "RateControl/BitrateLimit"},
+	{"govLength", "H264/GovLength"},
+}
+
+var imagingElements = []settingElement{
+	{"brightness", "Brightness"},
+	{"contrast", "Contrast"},
+	{"colorSaturation", "ColorSaturation"},
+	{"sharpness", "Sharpness"},
+	{"irCutFilter", "IrCutFilter"},
+}
+
+// mediaSetting is a media item backed by a configuration of the camera.
+type mediaSetting struct {
+	imaging bool     // imaging settings instead of the video encoder configuration
+	keys    []string // keys of the item, all keys as JSON object if empty
+}
+
+var mediaSettings = map[string]mediaSetting{
+	MediaVideoEncoder: {},
+	MediaCodec:        {keys: []string{"encoding"}},
+	MediaResolution:   {keys: []string{"width", "height"}},
+	MediaBitrate:      {keys: []string{"bitrateLimit"}},
+	MediaFramerate:    {keys: []string{"frameRateLimit"}},
+	MediaImaging:      {imaging: true},
+	MediaBrightness:   {imaging: true, keys: []string{"brightness"}},
+	MediaContrast:     {imaging: true, keys: []string{"contrast"}},
+	MediaIrCutFilter:  {imaging: true, keys: []string{"irCutFilter"}},
+}
+
+// mediaProfile decodes the parts of a media profile the mapper uses, the
+// upstream type does not match the namespaced configuration elements.
+type mediaProfile struct {
+	Token                    string `xml:"token,attr"`
+	Name                     string
+	VideoSourceConfiguration struct {
+		SourceToken string
+	}
+	VideoEncoderConfiguration struct {
+		Token string `xml:"token,attr"`
+	}
+}
+
+// DeviceInfo is the value of deviceInfo properties.
+type DeviceInfo struct {
+	Manufacturer    string `json:"manufacturer"`
+	Model           string `json:"model"`
+	FirmwareVersion string `json:"firmwareVersion"`
+	SerialNumber    string `json:"serialNumber"`
+	HardwareID      string `json:"hardwareId"`
+}
+
+// getMedia reads the media item of the visitor.
+func (c *CustomizedClient) getMedia(visitor *VisitorConfig) (interface{}, error) {
+	item := visitor.Media
+	if item == "" {
+		item = MediaStreamURI
+	}
+	if item == MediaDeviceInfo {
+		var resp device.GetDeviceInformationResponse
+		if err := call(c.dev, device.GetDeviceInformation{}, &resp); err != nil {
+			return nil, err
+		}
+		b, err := json.Marshal(DeviceInfo{
+			Manufacturer:    resp.Manufacturer,
+			Model:           resp.Model,
+			FirmwareVersion: resp.FirmwareVersion,
+			SerialNumber:    resp.SerialNumber,
+			HardwareID:      resp.HardwareId,
+		})
+		return string(b), err
+	}
+	profile, err := c.profile(visitor.Profile)
+	if err != nil {
+		return nil, err
+	}
+	var uri struct {
+		MediaUri struct {
+			Uri string
+		}
+	}
+	switch item {
+	case MediaStreamURI:
+		if err := call(c.dev, media.GetStreamUri{ProfileToken: onvif.ReferenceToken(profile.Token)}, &uri); err != nil {
+			return nil, err
+		}
+		return strings.TrimSpace(uri.MediaUri.Uri), nil
+	case MediaSnapshotURI:
+		if err := call(c.dev, media.GetSnapshotUri{ProfileToken: onvif.ReferenceToken(profile.Token)}, &uri); err != nil {
+			return nil, err
+		}
+		return strings.TrimSpace(uri.MediaUri.Uri), nil
+	}
+
+	setting, ok := mediaSettings[item]
+	if !ok {
+		return nil, fmt.Errorf("unsupported media item %q", item)
+	}
+	config, err := c.loadConfiguration(setting.imaging, profile)
+	if err != nil {
+		return nil, err
+	}
+	values := readElements(config, setting.elements())
+	switch {
+	case len(setting.keys) == 0:
+		object := make(map[string]interface{}, len(values))
+		for key, value := range values {
+			if _, err := strconv.ParseFloat(value, 64); err == nil {
+				object[key] = json.Number(value)
+			} else {
+				object[key] = value
+			}
+		}
+		b, err := json.Marshal(object)
+		return string(b), err
+	case item == MediaResolution:
+		return values["width"] + "x" + values["height"], nil
+	}
+	return values[setting.keys[0]], nil
+}
+
+// setMedia writes data to the video encoder or imaging setting of the visitor.
+func (c *CustomizedClient) setMedia(data interface{}, visitor *VisitorConfig) error {
+	setting, ok := mediaSettings[visitor.Media]
+	if !ok {
+		return fmt.Errorf("media item %q can not be written", visitor.Media)
+	}
+	values, err := setting.parse(visitor.Media, data)
+	if err != nil {
+		return err
+	}
+	profile, err := c.profile(visitor.Profile)
+	if err != nil {
+		return err
+	}
+	config, err := c.loadConfiguration(setting.imaging, profile)
+	if err != nil {
+		return err
+	}
+	if err := writeElements(config, setting.elements(), values); err != nil {
+		return err
+	}
+	return c.saveConfiguration(setting.imaging, profile, config)
+}
+
+func (s mediaSetting) elements() []settingElement {
+	if s.imaging {
+		return imagingElements
+	}
+	return encoderElements
+}
+
+// parse returns the configuration values written to the item by key.
+func (s mediaSetting) parse(item string, data interface{}) (map[string]string, error) {
+	values := make(map[string]string)
+	switch {
+	case len(s.keys) == 0:
+		str, ok := data.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s must be a JSON string, got %T", item, data)
+		}
+		var object map[string]interface{}
+		if err := json.Unmarshal([]byte(str), &object); err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %v", item, str, err)
+		}
+		for key, value := range object {
+			values[key] = formatValue(value)
+		}
+	case item == MediaResolution:
+		width, height, ok := strings.Cut(strings.ToLower(formatValue(data)), "x")
+		if !ok {
+			return nil, fmt.Errorf("invalid resolution %v, want WIDTHxHEIGHT", data)
+		}
+		values["width"], values["height"] = strings.TrimSpace(width), strings.TrimSpace(height)
+	default:
+		values[s.keys[0]] = formatValue(data)
+	}
+	// enumerations are upper case, e.g. H264 and AUTO
+	for _, key := range []string{"encoding", "irCutFilter"} {
+		if value, ok := values[key]; ok {
+			values[key] = strings.ToUpper(value)
+		}
+	}
+	return values, nil
+}
+
+// profile returns the media profile with the token or name, or the first
+// profile of the device if selector is empty.
+func (c *CustomizedClient) profile(selector string) (mediaProfile, error) {
+	var resp struct {
+		Profiles []mediaProfile
+	}
+	if err := call(c.dev, media.GetProfiles{}, &resp); err != nil {
+		return mediaProfile{}, err
+	}
+	if len(resp.Profiles) == 0 {
+		return mediaProfile{}, fmt.Errorf("no onvif profiles found")
+	}
+	if selector == "" {
+		return resp.Profiles[0], nil
+	}
+	for _, profile := range resp.Profiles {
+		if profile.Token == selector || strings.TrimSpace(profile.Name) == selector {
+			return profile, nil
+		}
+	}
+	return mediaProfile{}, fmt.Errorf("%w: %s", ErrProfileNotFound, selector)
+}
+
+// loadConfiguration returns the video encoder configuration or the imaging
+// settings of the profile as sent by the camera, so that writing them back
+// keeps the elements the mapper does not know.
+func (c *CustomizedClient) loadConfiguration(isImaging bool, profile mediaProfile) (*etree.Element, error) {
+	var request interface{}
+	var path string
+	if isImaging {
+		request = imaging.GetImagingSettings{VideoSourceToken: onvif.ReferenceToken(profile.VideoSourceConfiguration.SourceToken)}
+		path = "./Envelope/Body/GetImagingSettingsResponse/ImagingSettings"
+	} else {
+		request = media.GetVideoEncoderConfiguration{ConfigurationToken: onvif.ReferenceToken(profile.VideoEncoderConfiguration.Token)}
+		path = "./Envelope/Body/GetVideoEncoderConfigurationResponse/Configuration"
+	}
+	reply, err := c.dev.CallMethod(request)
+	if err != nil {
+		return nil, fmt.Errorf("call %T: %v", request, err)
+	}
+	b, err := readReply(reply)
+	if err != nil {
+		return nil, fmt.Errorf("%T failed: %v", request, err)
+	}
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(b); err != nil {
+		return nil, fmt.Errorf("decode %T reply: %v", request, err)
+	}
+	config := doc.FindElement(path)
+	if config == nil {
+		return nil, fmt.Errorf("%T reply has no configuration", request)
+	}
+	usePrefixes(config)
+	return config, nil
+}
+
+// saveConfiguration writes a configuration returned by loadConfiguration.
+func (c *CustomizedClient) saveConfiguration(isImaging bool, profile mediaProfile, config *etree.Element) error {
+	var request *etree.Element
+	var service string
+	if isImaging {
+		service = "imaging"
+		request = etree.NewElement("timg:SetImagingSettings")
+		request.CreateElement("timg:VideoSourceToken").SetText(profile.VideoSourceConfiguration.SourceToken)
+		config.Space, config.Tag = "timg", "ImagingSettings"
+		request.AddChild(config)
+		request.CreateElement("timg:ForcePersistence").SetText("true")
+	} else {
+		service = "media"
+		request = etree.NewElement("trt:SetVideoEncoderConfiguration")
+		config.Space, config.Tag = "trt", "Configuration"
+		request.AddChild(config)
+		request.CreateElement("trt:ForcePersistence").SetText("true")
+	}
+	address := c.dev.GetEndpoint(service)
+	if address == "" {
+		return fmt.Errorf("device has no %s service", service)
+	}
+	doc := etree.NewDocument()
+	doc.SetRoot(request)
+	body, err := doc.WriteToString()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), eventCallTimeout)
+	defer cancel()
+	reply, err := c.send(ctx, address, nil, body)
+	if err != nil {
+		return fmt.Errorf("call %s: %v", request.Tag, err)
+	}
+	if _, err := readReply(reply); err != nil {
+		return fmt.Errorf("%s failed: %v", request.Tag, err)
+	}
+	return nil
+}
+
+// usePrefixes replaces the prefixes of the configuration with the ones the
+// request envelope declares, the camera may use others. Unknown namespaces
+// are declared on the element.
+func usePrefixes(e *etree.Element) {
+	uri := e.NamespaceURI()
+	known := false
+	for prefix, namespace := range goonvif.Xlmns {
+		if namespace == uri {
+			e.Space, known = prefix, true
+			break
+		}
+	}
+	if !known && e.Space != "" && uri != "" {
+		e.CreateAttr("xmlns:"+e.Space, uri)
+	}
+	for _, child := range e.ChildElements() {
+		usePrefixes(child)
+	}
+}
+
+// formatValue formats written values without exponents, e.g. 4096 kbit/s.
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	}
+	return fmt.Sprint(value)
+}
+
+func readElements(config *etree.Element, elements []settingElement) map[string]string {
+	values := make(map[string]string)
+	for _, element := range elements {
+		if e := config.FindElement("./" + element.path); e != nil {
+			values[element.key] = strings.TrimSpace(e.Text())
+		}
+	}
+	return values
+}
+
+func writeElements(config *etree.Element, elements []settingElement, values map[string]string) error {
+	for key, value := range values {
+		found := false
+		for _, element := range elements {
+			if element.key != key {
+				continue
+			}
+			e := config.FindElement("./" + element.path)
+			if e == nil {
+				return fmt.Errorf("the camera does not report %s", key)
+			}
+			e.SetText(value)
+			found = true
+		}
+		if !found {
+			return fmt.Errorf("unknown setting %q", key)
+		}
+	}
+	return nil
+}
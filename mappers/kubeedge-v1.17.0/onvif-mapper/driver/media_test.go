@@ -0,0 +1,162 @@
+package driver
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// mediaReply answers the media, imaging and device information requests of
+// soapCamera. The configurations contain elements the mapper does not know,
+// one of them in a vendor namespace.
+func mediaReply(name string) string {
+	switch name {
+	case "GetStreamUri":
+		return `<trt:GetStreamUriResponse><trt:MediaUri><tt:Uri>rtsp://camera/main</tt:Uri></trt:MediaUri></trt:GetStreamUriResponse>`
+	case "GetSnapshotUri":
+		return `<trt:GetSnapshotUriResponse><trt:MediaUri><tt:Uri>http://camera/snapshot.jpg</tt:Uri></trt:MediaUri></trt:GetSnapshotUriResponse>`
+	case "GetDeviceInformation":
+		return `<tds:GetDeviceInformationResponse><tds:Manufacturer>ACME</tds:Manufacturer><tds:Model>Cam 1</tds:Model>` +
+			`<tds:FirmwareVersion>1.2.3</tds:FirmwareVersion><tds:SerialNumber>SN42</tds:SerialNumber>` +
+			`<tds:HardwareId>hw7</tds:HardwareId></tds:GetDeviceInformationResponse>`
+	case "GetVideoEncoderConfiguration":
+		return `<trt:GetVideoEncoderConfigurationResponse><trt:Configuration token="enc-main">` +
+			`<tt:Name>main</tt:Name><tt:UseCount>1</tt:UseCount><tt:Encoding>H264</tt:Encoding>` +
+			`<tt:Resolution><tt:Width>1920</tt:Width><tt:Height>1080</tt:Height></tt:Resolution><tt:Quality>4</tt:Quality>` +
+			`<tt:RateControl><tt:FrameRateLimit>25</tt:FrameRateLimit><tt:EncodingInterval>1</tt:EncodingInterval>` +
+			`<tt:BitrateLimit>4096</tt:BitrateLimit></tt:RateControl>` +
+			`<tt:H264><tt:GovLength>50</tt:GovLength><tt:H264Profile>Main</tt:H264Profile></tt:H264>` +
+			`<tt:SessionTimeout>PT60S</tt:SessionTimeout></trt:Configuration></trt:GetVideoEncoderConfigurationResponse>`
+	case "GetImagingSettings":
+		return `<timg:GetImagingSettingsResponse><timg:ImagingSettings>` +
+			`<tt:Brightness>50</tt:Brightness><tt:ColorSaturation>50</tt:ColorSaturation><tt:Contrast>50</tt:Contrast>` +
+			`<tt:IrCutFilter>AUTO</tt:IrCutFilter><tt:Sharpness>50</tt:Sharpness>` +
+			`<tt:Extension><acme:Defog xmlns:acme="http://acme.example/imaging">true</acme:Defog></tt:Extension>` +
+			`</timg:ImagingSettings></timg:GetImagingSettingsResponse>`
+	}
+	return `<` + name + `Response xmlns="http://www.onvif.org/ver10/media/wsdl"/>`
+}
+
+func mediaVisitor(item, profile string) *VisitorConfig {
+	return &VisitorConfig{VisitorConfigData: VisitorConfigData{Media: item, Profile: profile}}
+}
+
+func TestGetDeviceDataMedia(t *testing.T) {
+	cam := newSOAPCamera(t)
+	client := newPTZClient(t, cam)
+	tests := []struct {
+		item, profile string
+		want          string
+	}{
+		{"", "", "rtsp://camera/main"},
+		{MediaSnapshotURI, "main", "http://camera/snapshot.jpg"},
+		{MediaCodec, "", "H264"},
+		{MediaResolution, "", "1920x1080"},
+		{MediaBitrate, "", "4096"},
+		{MediaFramerate, "", "25"},
+		{MediaBrightness, "", "50"},
+		{MediaIrCutFilter, "", "AUTO"},
+	}
+	for _, tt := range tests {
+		got, err := client.GetDeviceData(mediaVisitor(tt.item, tt.profile))
+		if err != nil || got != tt.want {
+			t.Errorf("GetDeviceData(%q) = %v, %v, want %s", tt.item, got, err, tt.want)
+		}
+	}
+
+	var info DeviceInfo
+	got, err := client.GetDeviceData(mediaVisitor(MediaDeviceInfo, ""))
+	if err != nil || json.Unmarshal([]byte(got.(string)), &info) != nil {
+		t.Fatalf("GetDeviceData(deviceInfo) = %v, %v", got, err)
+	}
+	if want := (DeviceInfo{"ACME", "Cam 1", "1.2.3", "SN42", "hw7"}); info != want {
+		t.Errorf("device info = %+v, want %+v", info, want)
+	}
+
+	got, err = client.GetDeviceData(mediaVisitor(MediaVideoEncoder, ""))
+	var encoder map[string]interface{}
+	if err != nil || json.Unmarshal([]byte(got.(string)), &encoder) != nil {
+		t.Fatalf("GetDeviceData(videoEncoder) = %v, %v", got, err)
+	}
+	want := map[string]interface{}{"encoding": "H264", "width": 1920.0, "height": 1080.0, "quality": 4.0,
+		"frameRateLimit": 25.0, "bitrateLimit": 4096.0, "govLength": 50.0}
+	if !reflect.DeepEqual(encoder, want) {
+		t.Errorf("video encoder = %v, want %v", encoder, want)
+	}
+}
+
+func TestGetDeviceDataProfileSelection(t *testing.T) {
+	cam := newSOAPCamera(t)
+	client := newPTZClient(t, cam)
+	for profile, token := range map[string]string{"": "substream", "main": "mainstream", "mainstream": "mainstream"} {
+		cam.take()
+		if _, err := client.GetDeviceData(mediaVisitor(MediaStreamURI, profile)); err != nil {
+			t.Fatal(err)
+		}
+		requests := cam.take()
+		if len(requests) != 1 || !strings.Contains(requests[0].Body, "<trt:ProfileToken>"+token+"</trt:ProfileToken>") {
+			t.Errorf("profile %q: requests = %+v, want stream URI of %s", profile, requests, token)
+		}
+	}
+	if _, err := client.GetDeviceData(mediaVisitor(MediaStreamURI, "third")); !errors.Is(err, ErrProfileNotFound) {
+		t.Errorf("unknown profile error = %v", err)
+	}
+}
+
+func TestSetDeviceDataMedia(t *testing.T) {
+	tests := []struct {
+		item     string
+		data     interface{}
+		action   string
+		contains []string
+	}{
+		{MediaResolution, "1280x720", "SetVideoEncoderConfiguration",
+			[]string{`<onvif:Width>1280</onvif:Width>`, `<onvif:Height>720</onvif:Height>`, `<onvif:BitrateLimit>4096</onvif:BitrateLimit>`}},
+		{MediaBitrate, float64(2048), "SetVideoEncoderConfiguration", []string{`<onvif:BitrateLimit>2048</onvif:BitrateLimit>`}},
+		{MediaCodec, "h264", "SetVideoEncoderConfiguration", []string{`<onvif:Encoding>H264</onvif:Encoding>`}},
+		{MediaVideoEncoder, `{"frameRateLimit":15,"govLength":30}`, "SetVideoEncoderConfiguration",
+			[]string{`<onvif:FrameRateLimit>15</onvif:FrameRateLimit>`, `<onvif:GovLength>30</onvif:GovLength>`, `<onvif:Width>1920</onvif:Width>`}},
+		{MediaIrCutFilter, "off", "SetImagingSettings", []string{`<onvif:IrCutFilter>OFF</onvif:IrCutFilter>`}},
+		{MediaImaging, `{"brightness":60,"contrast":40.5}`, "SetImagingSettings",
+			[]string{`<onvif:Brightness>60</onvif:Brightness>`, `<onvif:Contrast>40.5</onvif:Contrast>`}},
+	}
+	cam := newSOAPCamera(t)
+	client := newPTZClient(t, cam)
+	for _, tt := range tests {
+		t.Run(tt.item, func(t *testing.T) {
+			cam.take()
+			if err := client.SetDeviceData(tt.data, mediaVisitor(tt.item, "main")); err != nil {
+				t.Fatalf("SetDeviceData() error = %v", err)
+			}
+			var set *soapRequest
+			for _, r := range cam.take() {
+				if r.Action == tt.action {
+					r := r
+					set = &r
+				}
+			}
+			if set == nil {
+				t.Fatalf("no %s request", tt.action)
+			}
+			// the configuration is written back as the camera sent it
+			contains := append(tt.contains, `<onvif:SessionTimeout>PT60S</onvif:SessionTimeout>`, `token="enc-main"`)
+			if tt.action == "SetImagingSettings" {
+				contains = append(tt.contains, `<timg:VideoSourceToken>source0</timg:VideoSourceToken>`,
+					`<acme:Defog xmlns:acme="http://acme.example/imaging">true</acme:Defog>`)
+			}
+			for _, want := range append(contains, "ForcePersistence>true<") {
+				if !strings.Contains(set.Body, want) {
+					t.Errorf("%s does not contain %s:\n%s", tt.action, want, set.Body)
+				}
+			}
+		})
+	}
+
+	for item, data := range map[string]interface{}{MediaResolution: "wide", MediaSnapshotURI: "x", MediaVideoEncoder: `{"mirror":true}`} {
+		if err := client.SetDeviceData(data, mediaVisitor(item, "")); err == nil {
+			t.Errorf("SetDeviceData(%s, %v) accepted", item, data)
+		}
+	}
+}
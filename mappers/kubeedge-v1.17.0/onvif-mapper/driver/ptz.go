@@ -0,0 +1,342 @@
+package driver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/use-go/onvif/media"
+	"github.com/use-go/onvif/ptz"
+	"github.com/use-go/onvif/xsd"
+	"github.com/use-go/onvif/xsd/onvif"
+	"k8s.io/klog/v2"
+)
+
+// PTZ operations that can be configured on a writable property.
+const (
+	// PTZAbsoluteMove moves to the PTZPosition written to the property,
+	// axes that are not set keep their current position.
+	PTZAbsoluteMove = "absoluteMove"
+	// PTZRelativeMove moves by the PTZPosition written to the property.
+	PTZRelativeMove = "relativeMove"
+	// PTZContinuousMove moves with the velocities of the PTZPosition written
+	// to the property until the configured timeout or a stop.
+	PTZContinuousMove = "continuousMove"
+	// PTZStop stops any pan, tilt and zoom movement when true is written.
+	PTZStop = "stop"
+	// PTZZoom zooms to the absolute level written to the property.
+	PTZZoom = "zoom"
+	// PTZGotoPreset moves to the preset whose token is written to the property.
+	PTZGotoPreset = "gotoPreset"
+	// PTZSetPreset saves the current position as a preset named by the value.
+	PTZSetPreset = "setPreset"
+	// PTZRemovePreset removes the preset whose token is written to the property.
+	PTZRemovePreset = "removePreset"
+	// PTZGotoHome moves to the home position when true is written.
+	PTZGotoHome = "gotoHome"
+	// PTZSetHome saves the current position as home position when true is written.
+	PTZSetHome = "setHome"
+)
+
+// Idempotent reports whether running the operation again with the same value
+// leaves the camera as it is, moves relative to the current position and
+// changes of the presets are not.
+func (config *PTZVisitorConfig) Idempotent() bool {
+	switch config.Operation {
+	case PTZAbsoluteMove, PTZZoom, PTZGotoPreset, PTZGotoHome, PTZStop:
+		return true
+	}
+	return false
+}
+
+// reportsPosition reports whether reading the property returns the current
+// position, the other operations return the value last written to them.
+func (config *PTZVisitorConfig) reportsPosition() bool {
+	switch config.Operation {
+	case PTZAbsoluteMove, PTZRelativeMove, PTZContinuousMove, PTZZoom:
+		return true
+	}
+	return false
+}
+
+// DefaultPTZTimeout is the duration of a continuous move if none is configured.
+const DefaultPTZTimeout = "PT5S"
+
+var ErrNoPTZProfile = errors.New("no onvif profile with a PTZ configuration found")
+
+// PTZPosition is the value of move properties, written as JSON such as
+// {"pan":0.5,"tilt":-0.2,"zoom":0.1}. Values use the generic ONVIF spaces:
+// pan and tilt in [-1, 1], absolute zoom in [0, 1].
+type PTZPosition struct {
+	Pan  *float64 `json:"pan,omitempty"`
+	Tilt *float64 `json:"tilt,omitempty"`
+	Zoom *float64 `json:"zoom,omitempty"`
+}
+
+// ptzStatusResponse decodes GetStatus replies, the upstream response type
+// does not match the namespaced position elements.
+type ptzStatusResponse struct {
+	PTZStatus struct {
+		Position struct {
+			PanTilt struct {
+				X float64 `xml:"x,attr"`
+				Y float64 `xml:"y,attr"`
+			}
+			Zoom struct {
+				X float64 `xml:"x,attr"`
+			}
+		}
+	}
+}
+
+// setPTZ runs the PTZ operation of the visitor with the written value.
+func (c *CustomizedClient) setPTZ(data interface{}, config *PTZVisitorConfig) error {
+	if err := c.runPTZ(data, config); err != nil {
+		return err
+	}
+	if !config.reportsPosition() {
+		c.ptzWritten[*config] = fmt.Sprint(data)
+	}
+	return nil
+}
+
+func (c *CustomizedClient) runPTZ(data interface{}, config *PTZVisitorConfig) error {
+	token, err := c.profileToken(config.ProfileToken)
+	if err != nil {
+		return err
+	}
+	speed := config.Speed
+	if speed == 0 {
+		speed = 1
+	}
+
+	switch config.Operation {
+	case PTZAbsoluteMove, PTZZoom:
+		var target PTZPosition
+		if config.Operation == PTZZoom {
+			zoom, err := parseFloat(data)
+			if err != nil {
+				return err
+			}
+			target.Zoom = &zoom
+		} else if target, err = parsePosition(data); err != nil {
+			return err
+		}
+		current, err := c.ptzStatus(token)
+		if err != nil {
+			return err
+		}
+		return call(c.dev, ptz.AbsoluteMove{
+			ProfileToken: token,
+			Position:     target.vector(current),
+			Speed:        ptzSpeed(speed),
+		}, nil)
+	case PTZRelativeMove:
+		target, err := parsePosition(data)
+		if err != nil {
+			return err
+		}
+		return call(c.dev, ptz.RelativeMove{
+			ProfileToken: token,
+			Translation:  target.vector(PTZPosition{}),
+			Speed:        ptzSpeed(speed),
+		}, nil)
+	case PTZContinuousMove:
+		velocity, err := parsePosition(data)
+		if err != nil {
+			return err
+		}
+		timeout := config.Timeout
+		if timeout == "" {
+			timeout = DefaultPTZTimeout
+		}
+		vector := velocity.vector(PTZPosition{})
+		return call(c.dev, ptz.ContinuousMove{
+			ProfileToken: token,
+			Velocity:     onvif.PTZSpeed{PanTilt: vector.PanTilt, Zoom: vector.Zoom},
+			Timeout:      xsd.Duration(timeout),
+		}, nil)
+	case PTZStop:
+		if !isTriggered(data) {
+			return nil
+		}
+		return call(c.dev, ptz.Stop{ProfileToken: token, PanTilt: true, Zoom: true}, nil)
+	case PTZGotoPreset:
+		preset, err := parseToken(data)
+		if err != nil {
+			return err
+		}
+		return call(c.dev, ptz.GotoPreset{
+			ProfileToken: token,
+			PresetToken:  onvif.ReferenceToken(preset),
+			Speed:        ptzSpeed(speed),
+		}, nil)
+	case PTZSetPreset:
+		name, err := parseToken(data)
+		if err != nil {
+			return err
+		}
+		var resp ptz.SetPresetResponse
+		if err := call(c.dev, ptz.SetPreset{ProfileToken: token, PresetName: xsd.String(name)}, &resp); err != nil {
+			return err
+		}
+		klog.V(2).Infof("Saved onvif preset %s with token %s", name, resp.PresetToken)
+		return nil
+	case PTZRemovePreset:
+		preset, err := parseToken(data)
+		if err != nil {
+			return err
+		}
+		return call(c.dev, ptz.RemovePreset{ProfileToken: token, PresetToken: onvif.ReferenceToken(preset)}, nil)
+	case PTZGotoHome:
+		if !isTriggered(data) {
+			return nil
+		}
+		return call(c.dev, ptz.GotoHomePosition{ProfileToken: token, Speed: ptzSpeed(speed)}, nil)
+	case PTZSetHome:
+		if !isTriggered(data) {
+			return nil
+		}
+		return call(c.dev, ptz.SetHomePosition{ProfileToken: token}, nil)
+	default:
+		return fmt.Errorf("unsupported PTZ operation %q", config.Operation)
+	}
+}
+
+// getPTZ returns the current position of move operations as the JSON encoded
+// PTZPosition, and the zoom level of zoom operations. Stops, presets and home
+// positions do not change what the camera reports, they return the last value
+// written to them without calling the camera.
+func (c *CustomizedClient) getPTZ(config *PTZVisitorConfig) (string, error) {
+	if !config.reportsPosition() {
+		return c.ptzWritten[*config], nil
+	}
+	token, err := c.profileToken(config.ProfileToken)
+	if err != nil {
+		return "", err
+	}
+	current, err := c.ptzStatus(token)
+	if err != nil {
+		return "", err
+	}
+	if config.Operation == PTZZoom {
+		return strconv.FormatFloat(*current.Zoom, 'f', -1, 64), nil
+	}
+	b, err := json.Marshal(current)
+	return string(b), err
+}
+
+// profileToken returns the configured profile token, or the first profile of
+// the device that has a PTZ configuration.
+func (c *CustomizedClient) profileToken(configured string) (onvif.ReferenceToken, error) {
+	if configured != "" {
+		return onvif.ReferenceToken(configured), nil
+	}
+	if c.ptzToken != "" {
+		return onvif.ReferenceToken(c.ptzToken), nil
+	}
+	var resp media.GetProfilesResponse
+	if err := call(c.dev, media.GetProfiles{}, &resp); err != nil {
+		return "", err
+	}
+	for _, profile := range resp.Profiles {
+		if profile.PTZConfiguration.Token != "" {
+			c.ptzToken = string(profile.Token)
+			return profile.Token, nil
+		}
+	}
+	return "", ErrNoPTZProfile
+}
+
+func (c *CustomizedClient) ptzStatus(token onvif.ReferenceToken) (PTZPosition, error) {
+	var resp ptzStatusResponse
+	if err := call(c.dev, ptz.GetStatus{ProfileToken: token}, &resp); err != nil {
+		return PTZPosition{}, err
+	}
+	position := resp.PTZStatus.Position
+	return PTZPosition{
+		Pan:  &position.PanTilt.X,
+		Tilt: &position.PanTilt.Y,
+		Zoom: &position.Zoom.X,
+	}, nil
+}
+
+// vector fills the axes missing from p with the ones of base.
+func (p PTZPosition) vector(base PTZPosition) onvif.PTZVector {
+	value := func(v, fallback *float64) float64 {
+		if v != nil {
+			return *v
+		}
+		if fallback != nil {
+			return *fallback
+		}
+		return 0
+	}
+	return onvif.PTZVector{
+		PanTilt: onvif.Vector2D{X: value(p.Pan, base.Pan), Y: value(p.Tilt, base.Tilt)},
+		Zoom:    onvif.Vector1D{X: value(p.Zoom, base.Zoom)},
+	}
+}
+
+func ptzSpeed(speed float64) onvif.PTZSpeed {
+	return onvif.PTZSpeed{
+		PanTilt: onvif.Vector2D{X: speed, Y: speed},
+		Zoom:    onvif.Vector1D{X: speed},
+	}
+}
+
+func parsePosition(data interface{}) (PTZPosition, error) {
+	var position PTZPosition
+	s, ok := data.(string)
+	if !ok {
+		return position, fmt.Errorf("PTZ position must be a JSON string, got %T", data)
+	}
+	if err := json.Unmarshal([]byte(s), &position); err != nil {
+		return position, fmt.Errorf("invalid PTZ position %q: %v", s, err)
+	}
+	return position, nil
+}
+
+func parseFloat(data interface{}) (float64, error) {
+	switch v := data.(type) {
+	case float64:
+		return v, nil
+	case float32:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case int:
+		return float64(v), nil
+	case string:
+		return strconv.ParseFloat(v, 64)
+	}
+	return 0, fmt.Errorf("invalid zoom value of type %T", data)
+}
+
+func parseToken(data interface{}) (string, error) {
+	s := fmt.Sprint(data)
+	if data == nil || s == "" {
+		return "", errors.New("empty preset value")
+	}
+	return s, nil
+}
+
+// isTriggered reports whether a write to a trigger property (stop, home)
+// asks for the operation to run.
+func isTriggered(data interface{}) bool {
+	switch v := data.(type) {
+	case bool:
+		return v
+	case string:
+		b, err := strconv.ParseBool(v)
+		return err == nil && b
+	case float64:
+		return v != 0
+	case int64:
+		return v != 0
+	case int:
+		return v != 0
+	}
+	return false
+}
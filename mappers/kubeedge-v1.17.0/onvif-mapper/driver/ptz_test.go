@@ -0,0 +1,315 @@
+package driver
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// soapCamera is a local stand-in for the SOAP services of an ONVIF camera
+// with PTZ and event support. It records every request it receives.
+type soapCamera struct {
+	t      *testing.T
+	server *httptest.Server
+
+	mutex    sync.Mutex
+	requests []soapRequest
+	faults   map[string]bool
+
+	// event service state, see event_test.go
+	notifications chan string
+	subscriptions int
+	lifetime      time.Duration
+}
+
+type soapRequest struct {
+	Action string
+	Body   string
+}
+
+func newSOAPCamera(t *testing.T) *soapCamera {
+	cam := &soapCamera{t: t, faults: make(map[string]bool), notifications: make(chan string, 16), lifetime: time.Minute}
+	cam.server = httptest.NewServer(http.HandlerFunc(cam.serve))
+	t.Cleanup(cam.server.Close)
+	return cam
+}
+
+// action returns the local name of the first element in the SOAP body.
+func action(envelope []byte) string {
+	decoder := xml.NewDecoder(strings.NewReader(string(envelope)))
+	inBody := false
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return ""
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			if inBody {
+				return start.Name.Local
+			}
+			inBody = start.Name.Local == "Body"
+		}
+	}
+}
+
+func (cam *soapCamera) serve(w http.ResponseWriter, r *http.Request) {
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		cam.t.Errorf("read request: %v", err)
+		return
+	}
+	name := action(b)
+	cam.mutex.Lock()
+	cam.requests = append(cam.requests, soapRequest{Action: name, Body: string(b)})
+	fault := cam.faults[name]
+	cam.mutex.Unlock()
+
+	w.Header().Set("Content-Type", "application/soap+xml")
+	if fault {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, envelope(`<s:Fault><s:Code><s:Value>s:Sender</s:Value><s:Subcode><s:Value>ter:InvalidArgVal</s:Value></s:Subcode></s:Code><s:Reason><s:Text xml:lang="en">No such preset</s:Text></s:Reason></s:Fault>`))
+		return
+	}
+	var body string
+	switch name {
+	case "GetCapabilities":
+		body = fmt.Sprintf(`<tds:GetCapabilitiesResponse><tds:Capabilities>`+
+			`<tt:Media><tt:XAddr>%[1]s/onvif/media_service</tt:XAddr></tt:Media>`+
+			`<tt:PTZ><tt:XAddr>%[1]s/onvif/ptz_service</tt:XAddr></tt:PTZ>`+
+			`<tt:Events><tt:XAddr>%[1]s/onvif/event_service</tt:XAddr></tt:Events>`+
+			`<tt:Imaging><tt:XAddr>%[1]s/onvif/imaging_service</tt:XAddr></tt:Imaging>`+
+			`</tds:Capabilities></tds:GetCapabilitiesResponse>`, cam.server.URL)
+	case "GetProfiles":
+		body = `<trt:GetProfilesResponse>` +
+			`<trt:Profiles token="substream"><tt:Name>sub</tt:Name>` +
+			`<tt:VideoSourceConfiguration token="vsc0"><tt:SourceToken>source0</tt:SourceToken></tt:VideoSourceConfiguration>` +
+			`<tt:VideoEncoderConfiguration token="enc-sub"><tt:Name>sub</tt:Name></tt:VideoEncoderConfiguration></trt:Profiles>` +
+			`<trt:Profiles token="mainstream"><tt:Name>main</tt:Name>` +
+			`<tt:VideoSourceConfiguration token="vsc0"><tt:SourceToken>source0</tt:SourceToken></tt:VideoSourceConfiguration>` +
+			`<tt:VideoEncoderConfiguration token="enc-main"><tt:Name>main</tt:Name></tt:VideoEncoderConfiguration>` +
+			`<tt:PTZConfiguration token="ptz0"><tt:Name>ptz</tt:Name></tt:PTZConfiguration></trt:Profiles>` +
+			`</trt:GetProfilesResponse>`
+	case "GetStatus":
+		body = `<tptz:GetStatusResponse><tptz:PTZStatus><tt:Position>` +
+			`<tt:PanTilt x="0.25" y="-0.5"/><tt:Zoom x="0.75"/>` +
+			`</tt:Position></tptz:PTZStatus></tptz:GetStatusResponse>`
+	case "SetPreset":
+		body = `<tptz:SetPresetResponse><tptz:PresetToken>preset-7</tptz:PresetToken></tptz:SetPresetResponse>`
+	case "GetStreamUri", "GetSnapshotUri", "GetDeviceInformation", "GetVideoEncoderConfiguration", "GetImagingSettings",
+		"SetVideoEncoderConfiguration", "SetImagingSettings":
+		body = mediaReply(name)
+	case "CreatePullPointSubscription", "PullMessages", "Renew", "Unsubscribe":
+		body = cam.eventReply(name)
+	default:
+		body = fmt.Sprintf(`<tptz:%sResponse/>`, name)
+	}
+	fmt.Fprint(w, envelope(body))
+}
+
+func envelope(body string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?>` +
+		`<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope" xmlns:tt="http://www.onvif.org/ver10/schema"` +
+		` xmlns:tds="http://www.onvif.org/ver10/device/wsdl" xmlns:trt="http://www.onvif.org/ver10/media/wsdl"` +
+		` xmlns:tptz="http://www.onvif.org/ver20/ptz/wsdl" xmlns:timg="http://www.onvif.org/ver20/imaging/wsdl"` +
+		` xmlns:tev="http://www.onvif.org/ver10/events/wsdl" xmlns:wsnt="http://docs.oasis-open.org/wsn/b-2"` +
+		` xmlns:wsa="http://www.w3.org/2005/08/addressing"><s:Body>` + body + `</s:Body></s:Envelope>`
+}
+
+// take returns the requests received since the last call, except GetStatus
+// and GetProfiles lookups.
+func (cam *soapCamera) take() []soapRequest {
+	cam.mutex.Lock()
+	defer cam.mutex.Unlock()
+	var res []soapRequest
+	for _, r := range cam.requests {
+		if r.Action != "GetStatus" && r.Action != "GetProfiles" && r.Action != "GetCapabilities" {
+			res = append(res, r)
+		}
+	}
+	cam.requests = nil
+	return res
+}
+
+func newPTZClient(t *testing.T, cam *soapCamera) *CustomizedClient {
+	password := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(password, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	client, err := NewClient(ProtocolConfig{
+		ProtocolName: "onvif",
+		ConfigData: ConfigData{
+			URL:      strings.TrimPrefix(cam.server.URL, "http://"),
+			UserName: "admin",
+			Password: password,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.InitDevice(); err != nil {
+		t.Fatalf("InitDevice() error = %v", err)
+	}
+	return client
+}
+
+func ptzVisitor(operation string) *VisitorConfig {
+	return &VisitorConfig{VisitorConfigData: VisitorConfigData{PTZ: &PTZVisitorConfig{Operation: operation}}}
+}
+
+func TestSetDeviceDataPTZ(t *testing.T) {
+	tests := []struct {
+		operation string
+		data      interface{}
+		action    string
+		contains  []string
+	}{
+		{PTZAbsoluteMove, `{"pan":0.5,"tilt":0.1,"zoom":0.2}`, "AbsoluteMove",
+			[]string{`<onvif:PanTilt x="0.5" y="0.1"`, `<onvif:Zoom x="0.2"`}},
+		// axes that are not written keep the position reported by GetStatus
+		{PTZAbsoluteMove, `{"pan":-1}`, "AbsoluteMove",
+			[]string{`<onvif:PanTilt x="-1" y="-0.5"`, `<onvif:Zoom x="0.75"`}},
+		{PTZZoom, 0.4, "AbsoluteMove",
+			[]string{`<onvif:PanTilt x="0.25" y="-0.5"`, `<onvif:Zoom x="0.4"`}},
+		{PTZRelativeMove, `{"tilt":0.1}`, "RelativeMove",
+			[]string{`<onvif:PanTilt x="0" y="0.1"`, `<onvif:Zoom x="0"`}},
+		{PTZContinuousMove, `{"pan":-0.3}`, "ContinuousMove",
+			[]string{`<onvif:PanTilt x="-0.3" y="0"`, `<tptz:Timeout>PT5S</tptz:Timeout>`}},
+		{PTZStop, true, "Stop", []string{`<tptz:PanTilt>true</tptz:PanTilt>`, `<tptz:Zoom>true</tptz:Zoom>`}},
+		{PTZGotoPreset, "preset-1", "GotoPreset", []string{`<tptz:PresetToken>preset-1</tptz:PresetToken>`}},
+		{PTZSetPreset, "door", "SetPreset", []string{`<tptz:PresetName>door</tptz:PresetName>`}},
+		{PTZRemovePreset, "preset-1", "RemovePreset", []string{`<tptz:PresetToken>preset-1</tptz:PresetToken>`}},
+		{PTZGotoHome, "true", "GotoHomePosition", nil},
+		{PTZSetHome, true, "SetHomePosition", nil},
+	}
+	cam := newSOAPCamera(t)
+	client := newPTZClient(t, cam)
+	cam.take()
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s %v", tt.operation, tt.data), func(t *testing.T) {
+			if err := client.SetDeviceData(tt.data, ptzVisitor(tt.operation)); err != nil {
+				t.Fatalf("SetDeviceData() error = %v", err)
+			}
+			requests := cam.take()
+			if len(requests) != 1 || requests[0].Action != tt.action {
+				t.Fatalf("requests = %+v, want one %s", requests, tt.action)
+			}
+			body := requests[0].Body
+			// the profile with a PTZ configuration is used
+			if !strings.Contains(body, `<tptz:ProfileToken>mainstream</tptz:ProfileToken>`) {
+				t.Errorf("%s does not use the PTZ profile:\n%s", tt.action, body)
+			}
+			for _, want := range tt.contains {
+				if !strings.Contains(body, want) {
+					t.Errorf("%s does not contain %s:\n%s", tt.action, want, body)
+				}
+			}
+		})
+	}
+}
+
+func TestSetDeviceDataPTZTriggers(t *testing.T) {
+	cam := newSOAPCamera(t)
+	client := newPTZClient(t, cam)
+	cam.take()
+	for _, data := range []interface{}{false, "false", "", int64(0)} {
+		if err := client.SetDeviceData(data, ptzVisitor(PTZGotoHome)); err != nil {
+			t.Fatalf("SetDeviceData(%v) error = %v", data, err)
+		}
+	}
+	if requests := cam.take(); len(requests) != 0 {
+		t.Errorf("untriggered writes sent %+v", requests)
+	}
+}
+
+func TestSetDeviceDataPTZErrors(t *testing.T) {
+	cam := newSOAPCamera(t)
+	client := newPTZClient(t, cam)
+
+	cam.faults["GotoPreset"] = true
+	err := client.SetDeviceData("missing", ptzVisitor(PTZGotoPreset))
+	if err == nil || !strings.Contains(err.Error(), "No such preset") {
+		t.Errorf("SOAP fault error = %v", err)
+	}
+	if err := client.SetDeviceData("not json", ptzVisitor(PTZAbsoluteMove)); err == nil {
+		t.Error("invalid position accepted")
+	}
+	if err := client.SetDeviceData(true, ptzVisitor("spin")); err == nil {
+		t.Error("unknown operation accepted")
+	}
+	// properties without a PTZ configuration have nothing to set
+	if err := client.SetDeviceData("x", &VisitorConfig{}); err != nil {
+		t.Errorf("SetDeviceData() without PTZ error = %v", err)
+	}
+}
+
+func TestGetDeviceDataPTZPosition(t *testing.T) {
+	cam := newSOAPCamera(t)
+	client := newPTZClient(t, cam)
+	visitor := ptzVisitor(PTZAbsoluteMove)
+	visitor.PTZ.ProfileToken = "custom"
+
+	got, err := client.GetDeviceData(visitor)
+	if err != nil {
+		t.Fatalf("GetDeviceData() error = %v", err)
+	}
+	if want := `{"pan":0.25,"tilt":-0.5,"zoom":0.75}`; got != want {
+		t.Errorf("GetDeviceData() = %v, want %s", got, want)
+	}
+	cam.mutex.Lock()
+	defer cam.mutex.Unlock()
+	last := cam.requests[len(cam.requests)-1]
+	if !strings.Contains(last.Body, `<tptz:ProfileToken>custom</tptz:ProfileToken>`) {
+		t.Errorf("configured profile token not used:\n%s", last.Body)
+	}
+}
+
+func TestGetDeviceDataPTZOperations(t *testing.T) {
+	cam := newSOAPCamera(t)
+	client := newPTZClient(t, cam)
+
+	got, err := client.GetDeviceData(ptzVisitor(PTZZoom))
+	if err != nil {
+		t.Fatalf("GetDeviceData(zoom) error = %v", err)
+	}
+	if got != "0.75" {
+		t.Errorf("GetDeviceData(zoom) = %v, want 0.75", got)
+	}
+
+	// operations that do not move report the last written value without calling the camera
+	cam.take()
+	if got, err := client.GetDeviceData(ptzVisitor(PTZGotoPreset)); err != nil || got != "" {
+		t.Errorf("GetDeviceData(gotoPreset) before a write = %v, %v", got, err)
+	}
+	if err := client.SetDeviceData("preset-1", ptzVisitor(PTZGotoPreset)); err != nil {
+		t.Fatalf("SetDeviceData() error = %v", err)
+	}
+	if err := client.SetDeviceData(true, ptzVisitor(PTZStop)); err != nil {
+		t.Fatalf("SetDeviceData() error = %v", err)
+	}
+	cam.take()
+	for operation, want := range map[string]string{PTZGotoPreset: "preset-1", PTZStop: "true", PTZSetHome: ""} {
+		if got, err := client.GetDeviceData(ptzVisitor(operation)); err != nil || got != want {
+			t.Errorf("GetDeviceData(%s) = %v, %v, want %s", operation, got, err, want)
+		}
+	}
+	if requests := cam.take(); len(requests) != 0 {
+		t.Errorf("reading trigger operations sent %+v", requests)
+	}
+
+	// failed writes are not reported
+	cam.faults["GotoPreset"] = true
+	if err := client.SetDeviceData("missing", ptzVisitor(PTZGotoPreset)); err == nil {
+		t.Fatal("SetDeviceData() with a SOAP fault succeeded")
+	}
+	if got, _ := client.GetDeviceData(ptzVisitor(PTZGotoPreset)); got != "preset-1" {
+		t.Errorf("GetDeviceData(gotoPreset) after a failed write = %v, want preset-1", got)
+	}
+}
@@ -0,0 +1,121 @@
+package driver
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	goonvif "github.com/use-go/onvif"
+	"github.com/use-go/onvif/gosoap"
+)
+
+// soapFault is the body of an ONVIF error reply.
+type soapFault struct {
+	Code   string `xml:"Code>Subcode>Value"`
+	Reason string `xml:"Reason>Text"`
+}
+
+// call sends the request to the device and decodes the reply into response,
+// which may be nil. SOAP faults are returned as errors.
+func call(dev *goonvif.Device, request interface{}, response interface{}) error {
+	reply, err := dev.CallMethod(request)
+	if err != nil {
+		return fmt.Errorf("call %T: %v", request, err)
+	}
+	return decodeReply(reply, request, response)
+}
+
+// callAddress sends the request to address, such as the event service or a
+// subscription manager, which the upstream device can only reach through
+// service packages. headers are added to the SOAP header as they are.
+func (c *CustomizedClient) callAddress(ctx context.Context, address string, headers []string, request interface{}, response interface{}) error {
+	body, err := xml.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("encode %T: %v", request, err)
+	}
+	reply, err := c.send(ctx, address, headers, string(body))
+	if err != nil {
+		return fmt.Errorf("call %T: %v", request, err)
+	}
+	return decodeReply(reply, request, response)
+}
+
+// send posts body, a single request element, to address in a SOAP envelope
+// with the credentials of the device.
+func (c *CustomizedClient) send(ctx context.Context, address string, headers []string, body string) (*http.Response, error) {
+	soap := gosoap.NewEmptySOAP()
+	soap.AddStringBodyContent(body)
+	soap.AddRootNamespaces(goonvif.Xlmns)
+	for _, header := range headers {
+		if err := soap.AddStringHeaderContent(header); err != nil {
+			return nil, fmt.Errorf("add header: %v", err)
+		}
+	}
+	params := c.deviceParams
+	if params.Username != "" && params.Password != "" {
+		soap.AddWSSecurity(params.Username, params.Password)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, address, bytes.NewBufferString(soap.String()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/soap+xml; charset=utf-8")
+	httpClient := params.HttpClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return httpClient.Do(req)
+}
+
+// decodeReply closes the reply and decodes its body into response.
+func decodeReply(reply *http.Response, request interface{}, response interface{}) error {
+	b, err := readReply(reply)
+	if err != nil {
+		return fmt.Errorf("%T failed: %v", request, err)
+	}
+	if response == nil {
+		return nil
+	}
+	var envelope struct {
+		Body struct {
+			Content []byte `xml:",innerxml"`
+		}
+	}
+	if err := xml.Unmarshal(b, &envelope); err != nil {
+		return fmt.Errorf("decode %T reply: %v", request, err)
+	}
+	if err := xml.Unmarshal(envelope.Body.Content, response); err != nil {
+		return fmt.Errorf("decode %T reply: %v", request, err)
+	}
+	return nil
+}
+
+// readReply closes the reply and returns the SOAP envelope it carries.
+// SOAP faults and HTTP errors are returned as errors.
+func readReply(reply *http.Response) ([]byte, error) {
+	defer reply.Body.Close()
+	b, err := io.ReadAll(reply.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read reply: %v", err)
+	}
+	var envelope struct {
+		Body struct {
+			Fault *soapFault `xml:"Fault"`
+		}
+	}
+	if err := xml.Unmarshal(b, &envelope); err != nil {
+		return nil, fmt.Errorf("decode reply: %v", err)
+	}
+	if fault := envelope.Body.Fault; fault != nil {
+		return nil, fmt.Errorf("%s (%s)", fault.Reason, fault.Code)
+	}
+	if reply.StatusCode != http.StatusOK {
+		return nil, errors.New(reply.Status)
+	}
+	return b, nil
+}
@@ -43,12 +43,15 @@ func main() {
 	grpcclient.Init(&c)
 
 	// start grpc server
-	grpcServer := grpcserver.NewServer(
+	grpcServer, err := grpcserver.NewServer(
 		grpcserver.Config{
 			SockPath: c.GrpcServer.SocketPath,
 			Protocol: common.ProtocolModbus,
 		},
 	)
+	if err != nil {
+		klog.Fatal(err)
+	}
 
 	panel := device.NewDevPanel()
 	err = panel.DevInit(&c)
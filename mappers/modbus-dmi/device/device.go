@@ -31,6 +31,7 @@ import (
 	"github.com/kubeedge/mappers-go/mappers/config"
 	"github.com/kubeedge/mappers-go/mappers/pkg/common"
 	"github.com/kubeedge/mappers-go/mappers/pkg/driver/modbus"
+	"github.com/kubeedge/mappers-go/mappers/pkg/global"
 	"github.com/kubeedge/mappers-go/mappers/pkg/util/parse"
 )
 
@@ -44,6 +45,22 @@ type DevPanel struct {
 
 var devPanel *DevPanel
 
+func init() {
+	global.RegisterProtocol(common.ProtocolModbus, global.Protocol{
+		NewDevPanel: func() global.DevPanel { return NewDevPanel() },
+		Twins:       deviceTwins,
+	})
+}
+
+// deviceTwins returns the twins of a device returned by GetDevice.
+func deviceTwins(device interface{}) ([]common.Twin, error) {
+	d, ok := device.(*modbus.ModbusDev)
+	if !ok {
+		return nil, fmt.Errorf("unexpected device type %T", device)
+	}
+	return d.Instance.Twins, nil
+}
+
 // setVisitor check if visitor property is readonly, if not then set it.
 func setVisitor(visitorConfig *modbus.ModbusVisitorConfig, twin *common.Twin, client *modbus.ModbusClient) {
 	if twin.PVisitor.PProperty.AccessMode == "ReadOnly" {
@@ -0,0 +1,125 @@
+/*
+Copyright 2020 The KubeEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package device
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	goburrow "github.com/goburrow/modbus"
+	"github.com/stretchr/testify/assert"
+	"github.com/tbrandon/mbserver"
+
+	dmiapi "github.com/kubeedge/kubeedge/pkg/apis/dmi/v1alpha1"
+	"github.com/kubeedge/mappers-go/mappers/pkg/common"
+	"github.com/kubeedge/mappers-go/mappers/pkg/dmitest"
+	"github.com/kubeedge/mappers-go/mappers/pkg/grpcserver"
+	"github.com/kubeedge/mappers-go/mappers/pkg/util/grpcclient"
+)
+
+// startSimulator starts a Modbus TCP simulator and returns its port.
+func startSimulator(t *testing.T, temperature uint16) int {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := lis.Addr().(*net.TCPAddr).Port
+	lis.Close()
+
+	s := mbserver.NewServer()
+	s.HoldingRegisters[0] = temperature
+	if err = s.ListenTCP(fmt.Sprintf("127.0.0.1:%d", port)); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+	return port
+}
+
+func thermometer(port int) (*dmiapi.DeviceModel, *dmiapi.Device) {
+	model := &dmiapi.DeviceModel{
+		Name: "thermometer-model",
+		Spec: &dmiapi.DeviceModelSpec{Properties: []*dmiapi.DeviceProperty{{
+			Name: "temperature",
+			Type: &dmiapi.PropertyType{Int: &dmiapi.PropertyTypeInt64{AccessMode: "ReadWrite"}},
+		}}},
+	}
+	device := &dmiapi.Device{
+		Name: "thermometer",
+		Spec: &dmiapi.DeviceSpec{
+			DeviceModelReference: model.Name,
+			Protocol: &dmiapi.ProtocolConfig{
+				Modbus: &dmiapi.ProtocolConfigModbus{SlaveID: 1},
+				Common: &dmiapi.ProtocolConfigCommon{Tcp: &dmiapi.ProtocolConfigTCP{Ip: "127.0.0.1", Port: int64(port)}},
+			},
+			PropertyVisitors: []*dmiapi.DevicePropertyVisitor{{
+				PropertyName: "temperature",
+				CollectCycle: int64(100 * time.Millisecond),
+				Modbus: &dmiapi.VisitorConfigModbus{
+					Register: "HoldingRegister", Offset: 0, Limit: 1, Scale: 1,
+				},
+			}},
+		},
+		Status: &dmiapi.DeviceStatus{Twins: []*dmiapi.Twin{{
+			PropertyName: "temperature",
+			Desired:      &dmiapi.TwinProperty{Metadata: map[string]string{"type": "int"}},
+			Reported:     &dmiapi.TwinProperty{Metadata: map[string]string{"type": "int"}},
+		}}},
+	}
+	return model, device
+}
+
+func TestModbusDMI(t *testing.T) {
+	port := startSimulator(t, 42)
+	edge := dmitest.NewEdgeCore(t)
+	cfg := edge.Config(common.ProtocolModbus)
+	grpcclient.Init(cfg)
+
+	server, err := grpcserver.NewServer(grpcserver.Config{SockPath: cfg.GrpcServer.SocketPath, Protocol: common.ProtocolModbus})
+	assert.Nil(t, err)
+	go func() {
+		_ = server.Start()
+	}()
+	mapper := dmitest.DialMapper(t, cfg.GrpcServer.SocketPath)
+
+	model, device := thermometer(port)
+	assert.Nil(t, mapper.CreateDeviceModel(model))
+	assert.Nil(t, mapper.RegisterDevice(device))
+	defer func() { assert.Nil(t, mapper.RemoveDevice(device.Name)) }()
+	edge.AssertTwin(t, device.Name, "temperature", "42", 5*time.Second)
+
+	// The simulator changes the value.
+	handler := goburrow.NewTCPClientHandler(fmt.Sprintf("127.0.0.1:%d", port))
+	assert.Nil(t, handler.Connect())
+	defer handler.Close()
+	_, err = goburrow.NewClient(handler).WriteSingleRegister(0, 43)
+	assert.Nil(t, err)
+	edge.AssertTwin(t, device.Name, "temperature", "43", 5*time.Second)
+
+	// EdgeCore sets the desired value.
+	assert.Nil(t, mapper.UpdateDeviceStatus(device.Name, []*dmiapi.Twin{{
+		PropertyName: "temperature",
+		Desired:      &dmiapi.TwinProperty{Value: "50", Metadata: map[string]string{"type": "int"}},
+		Reported:     &dmiapi.TwinProperty{Metadata: map[string]string{"type": "int"}},
+	}}))
+	edge.AssertTwin(t, device.Name, "temperature", "50", 5*time.Second)
+
+	res, err := mapper.GetDevice(device.Name)
+	assert.Nil(t, err)
+	assert.Equal(t, common.DEVSTOK, res.GetStatus().GetState())
+}
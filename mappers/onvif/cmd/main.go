@@ -18,11 +18,13 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"os"
 
 	"github.com/kubeedge/mappers-go/mappers/common"
 	"github.com/kubeedge/mappers-go/mappers/onvif/config"
 	"github.com/kubeedge/mappers-go/mappers/onvif/device"
+	"github.com/kubeedge/mappers-go/mappers/onvif/discovery"
 	"github.com/kubeedge/mappers-go/mappers/onvif/globals"
 	"k8s.io/klog/v2"
 )
@@ -34,6 +36,14 @@ func main() {
 	klog.InitFlags(nil)
 	defer klog.Flush()
 
+	// "onvif discover ..." finds cameras instead of running the mapper
+	if len(os.Args) > 1 && os.Args[1] == "discover" {
+		if err = discovery.Run(context.Background(), os.Args[2:], os.Stdout); err != nil {
+			klog.Fatal(err)
+		}
+		return
+	}
+
 	if err = c.Parse(); err != nil {
 		klog.Fatal(err)
 		os.Exit(1)
@@ -0,0 +1,99 @@
+/*
+Copyright 2021 The KubeEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"k8s.io/klog/v2"
+)
+
+// Run runs the discover command with its arguments and writes the
+// discovered devices to out.
+func Run(ctx context.Context, args []string, out io.Writer) error {
+	var opts Options
+	var manifestOpts ManifestOptions
+	var output string
+	var readInfo bool
+
+	flags := pflag.NewFlagSet("discover", pflag.ContinueOnError)
+	flags.StringVar(&opts.Interface, "interface", "", "network interface to send probes on")
+	flags.StringVar(&opts.Address, "address", MulticastAddress, "address to send probes to")
+	flags.DurationVar(&opts.Timeout, "timeout", DefaultTimeout, "how long to wait for answers")
+	flags.StringSliceVar(&opts.Types, "types", []string{NetworkVideoTransmitter}, "device types to probe for")
+	flags.StringSliceVar(&opts.Scopes, "scopes", nil, "scopes the devices must be in")
+	flags.StringVar(&manifestOpts.Username, "username", "admin", "user name of the devices")
+	flags.StringVar(&manifestOpts.PasswordFile, "password-file", "/ca/pass", "password file of the devices")
+	flags.BoolVar(&readInfo, "read-info", false, "log in with the password file to read the device information")
+	flags.StringVar(&manifestOpts.Namespace, "namespace", "", "namespace of the Device CRs")
+	flags.StringVar(&manifestOpts.Model, "model", DefaultModel, "device model of the Device CRs")
+	flags.StringVar(&manifestOpts.Node, "node", "", "edge node the devices are bound to")
+	flags.StringVarP(&output, "output", "o", "yaml", "output format, yaml for Device CRs or json")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if output != "yaml" && output != "json" {
+		return fmt.Errorf("unknown output format %q", output)
+	}
+
+	devices, err := Probe(ctx, opts)
+	if err != nil {
+		return err
+	}
+	klog.V(1).Infof("Found %d devices", len(devices))
+	if readInfo {
+		password, err := readPassword(manifestOpts.PasswordFile)
+		if err != nil {
+			return err
+		}
+		for i := range devices {
+			info, err := ReadInformation(&devices[i], manifestOpts.Username, password)
+			if err != nil {
+				klog.Warningf("Failed to read the information of %s: %v", devices[i].Endpoint, err)
+				continue
+			}
+			devices[i].Info = info
+		}
+	}
+
+	var b []byte
+	if output == "json" {
+		b, err = json.MarshalIndent(devices, "", "  ")
+		b = append(b, '\n')
+	} else {
+		b, err = Manifest(devices, manifestOpts)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(b)
+	return err
+}
+
+func readPassword(filename string) (string, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "", fmt.Errorf("read password: %v", err)
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
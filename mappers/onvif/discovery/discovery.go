@@ -0,0 +1,306 @@
+/*
+Copyright 2021 The KubeEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package discovery finds ONVIF cameras with WS-Discovery and describes them
+// as KubeEdge devices.
+package discovery
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// MulticastAddress is the WS-Discovery group probes are sent to.
+const MulticastAddress = "239.255.255.250:3702"
+
+// NetworkVideoTransmitter is the discovery type of ONVIF cameras.
+const NetworkVideoTransmitter = "dn:NetworkVideoTransmitter"
+
+// DefaultTimeout is how long probe matches are collected.
+const DefaultTimeout = 3 * time.Second
+
+const onvifScope = "onvif://www.onvif.org/"
+
+// Options configures a probe.
+type Options struct {
+	// Interface is the network interface probes are sent on, the system
+	// default if empty.
+	Interface string
+	// Address is where probes are sent, MulticastAddress if empty.
+	Address string
+	// Timeout is how long probe matches are collected.
+	Timeout time.Duration
+	// Types the devices must implement, NetworkVideoTransmitter if empty.
+	Types []string
+	// Scopes the devices must be in, such as onvif://www.onvif.org/location/lab.
+	Scopes []string
+}
+
+// Device is a device that answered a probe.
+type Device struct {
+	// Endpoint is the stable address of the device, usually urn:uuid:...
+	Endpoint string   `json:"endpoint"`
+	XAddrs   []string `json:"xaddrs"`
+	Types    []string `json:"types"`
+	Scopes   []string `json:"scopes"`
+	// Name, Hardware and Location are taken from the ONVIF scopes.
+	Name     string `json:"name,omitempty"`
+	Hardware string `json:"hardware,omitempty"`
+	Location string `json:"location,omitempty"`
+	// Info is read from the device when credentials are given.
+	Info *DeviceInformation `json:"info,omitempty"`
+}
+
+// Host returns the host:port of the device service.
+func (d *Device) Host() string {
+	if u, err := url.Parse(d.ServiceAddress()); err == nil {
+		return u.Host
+	}
+	return ""
+}
+
+// ServiceAddress returns the address of the device service, preferring IPv4.
+func (d *Device) ServiceAddress() string {
+	var address string
+	for _, xaddr := range d.XAddrs {
+		u, err := url.Parse(xaddr)
+		if err != nil || u.Host == "" {
+			continue
+		}
+		if ip := net.ParseIP(u.Hostname()); ip != nil && ip.To4() != nil {
+			return xaddr
+		}
+		if address == "" {
+			address = xaddr
+		}
+	}
+	return address
+}
+
+// probeMatches is the reply to a probe.
+type probeMatches struct {
+	RelatesTo string `xml:"Header>RelatesTo"`
+	Matches   []struct {
+		Address string `xml:"EndpointReference>Address"`
+		Types   string `xml:"Types"`
+		Scopes  string `xml:"Scopes"`
+		XAddrs  string `xml:"XAddrs"`
+	} `xml:"Body>ProbeMatches>ProbeMatch"`
+}
+
+// Probe sends a WS-Discovery probe and returns the devices that answered
+// before the timeout or ctx is done, ordered by endpoint.
+func Probe(ctx context.Context, opts Options) ([]Device, error) {
+	address := opts.Address
+	if address == "" {
+		address = MulticastAddress
+	}
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	types := opts.Types
+	if len(types) == 0 {
+		types = []string{NetworkVideoTransmitter}
+	}
+
+	dst, err := net.ResolveUDPAddr("udp4", address)
+	if err != nil {
+		return nil, fmt.Errorf("resolve %s: %v", address, err)
+	}
+	conn, err := listen(opts.Interface)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	messageID, err := newMessageID()
+	if err != nil {
+		return nil, err
+	}
+	if _, err = conn.WriteTo(probeMessage(messageID, types, opts.Scopes), dst); err != nil {
+		return nil, fmt.Errorf("send probe to %s: %v", address, err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err = conn.SetReadDeadline(deadline); err != nil {
+		return nil, err
+	}
+	// unblock the read when ctx is cancelled
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetReadDeadline(time.Now())
+		case <-stop:
+		}
+	}()
+
+	devices := make(map[string]*Device)
+	buf := make([]byte, 64*1024)
+	for {
+		n, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				break
+			}
+			return nil, fmt.Errorf("read probe matches: %v", err)
+		}
+		var reply probeMatches
+		if err := xml.Unmarshal(buf[:n], &reply); err != nil {
+			klog.V(4).Infof("Ignore invalid reply from %s: %v", from, err)
+			continue
+		}
+		if reply.RelatesTo != messageID {
+			continue
+		}
+		for _, match := range reply.Matches {
+			if match.Address == "" || match.XAddrs == "" {
+				continue
+			}
+			if _, ok := devices[match.Address]; ok {
+				continue
+			}
+			device := &Device{
+				Endpoint: match.Address,
+				XAddrs:   strings.Fields(match.XAddrs),
+				Types:    strings.Fields(match.Types),
+				Scopes:   strings.Fields(match.Scopes),
+			}
+			device.parseScopes()
+			devices[match.Address] = device
+			klog.V(2).Infof("Found %s at %v", device.Endpoint, device.XAddrs)
+		}
+	}
+
+	result := make([]Device, 0, len(devices))
+	for _, device := range devices {
+		result = append(result, *device)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Endpoint < result[j].Endpoint })
+	return result, nil
+}
+
+// listen opens the socket probes are sent from. It is bound to the address
+// of the named interface, so multicast probes leave through it.
+func listen(name string) (net.PacketConn, error) {
+	laddr := &net.UDPAddr{}
+	if name != "" {
+		iface, err := net.InterfaceByName(name)
+		if err != nil {
+			return nil, fmt.Errorf("interface %s: %v", name, err)
+		}
+		if laddr.IP, err = interfaceIPv4(iface); err != nil {
+			return nil, err
+		}
+	}
+	conn, err := net.ListenUDP("udp4", laddr)
+	if err != nil {
+		return nil, fmt.Errorf("listen: %v", err)
+	}
+	return conn, nil
+}
+
+func interfaceIPv4(iface *net.Interface) (net.IP, error) {
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("interface %s: %v", iface.Name, err)
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil {
+			return ipNet.IP.To4(), nil
+		}
+	}
+	return nil, fmt.Errorf("interface %s has no IPv4 address", iface.Name)
+}
+
+// newMessageID returns a random urn:uuid.
+func newMessageID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("urn:uuid:%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+func probeMessage(messageID string, types, scopes []string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` +
+		`<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope"` +
+		` xmlns:a="http://schemas.xmlsoap.org/ws/2004/08/addressing"` +
+		` xmlns:d="http://schemas.xmlsoap.org/ws/2005/04/discovery"` +
+		` xmlns:dn="http://www.onvif.org/ver10/network/wsdl"` +
+		` xmlns:tds="http://www.onvif.org/ver10/device/wsdl">` +
+		`<s:Header>` +
+		`<a:Action s:mustUnderstand="1">http://schemas.xmlsoap.org/ws/2005/04/discovery/Probe</a:Action>` +
+		`<a:MessageID>` + messageID + `</a:MessageID>` +
+		`<a:ReplyTo><a:Address>http://schemas.xmlsoap.org/ws/2004/08/addressing/role/anonymous</a:Address></a:ReplyTo>` +
+		`<a:To s:mustUnderstand="1">urn:schemas-xmlsoap-org:ws:2005:04:discovery</a:To>` +
+		`</s:Header><s:Body><d:Probe><d:Types>`)
+	xml.EscapeText(&buf, []byte(strings.Join(types, " ")))
+	buf.WriteString(`</d:Types>`)
+	if len(scopes) > 0 {
+		buf.WriteString(`<d:Scopes>`)
+		xml.EscapeText(&buf, []byte(strings.Join(scopes, " ")))
+		buf.WriteString(`</d:Scopes>`)
+	}
+	buf.WriteString(`</d:Probe></s:Body></s:Envelope>`)
+	return buf.Bytes()
+}
+
+// parseScopes fills the name, hardware and location of the device from
+// scopes like onvif://www.onvif.org/name/Front%20Door.
+func (d *Device) parseScopes() {
+	for _, scope := range d.Scopes {
+		if !strings.HasPrefix(scope, onvifScope) {
+			continue
+		}
+		parts := strings.SplitN(strings.TrimPrefix(scope, onvifScope), "/", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		value, err := url.PathUnescape(parts[1])
+		if err != nil {
+			value = parts[1]
+		}
+		switch parts[0] {
+		case "name":
+			d.Name = value
+		case "hardware":
+			d.Hardware = value
+		case "location":
+			d.Location = value
+		}
+	}
+}
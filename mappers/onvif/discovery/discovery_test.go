@@ -0,0 +1,235 @@
+/*
+Copyright 2021 The KubeEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package discovery
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+// responder answers probes on a local UDP socket like cameras on the
+// WS-Discovery group. Every camera answers with its own packet.
+type responder struct {
+	conn   net.PacketConn
+	probes chan string
+}
+
+func newResponder(t *testing.T, xaddrs ...string) *responder {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	r := &responder{conn: conn, probes: make(chan string, 4)}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 64*1024)
+		for {
+			n, from, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var probe struct {
+				MessageID string `xml:"Header>MessageID"`
+			}
+			if xml.Unmarshal(buf[:n], &probe) != nil {
+				continue
+			}
+			r.probes <- string(buf[:n])
+			// an answer to someone else's probe
+			conn.WriteTo(probeMatch("urn:uuid:other", "urn:uuid:cam-x", "http://10.0.0.9/onvif/device_service", ""), from)
+			for i, xaddr := range xaddrs {
+				scopes := fmt.Sprintf("onvif://www.onvif.org/type/video_encoder onvif://www.onvif.org/name/Front%%20Door%%20%d "+
+					"onvif://www.onvif.org/hardware/DS-2CD2032 onvif://www.onvif.org/location/city/lab", i)
+				conn.WriteTo(probeMatch(probe.MessageID, fmt.Sprintf("urn:uuid:cam-%d", i), xaddr, scopes), from)
+			}
+			// cameras answer on every interface, the copy is dropped
+			if len(xaddrs) > 0 {
+				conn.WriteTo(probeMatch(probe.MessageID, "urn:uuid:cam-0", xaddrs[0], ""), from)
+			}
+			conn.WriteTo([]byte("not xml"), from)
+		}
+	}()
+	return r
+}
+
+func probeMatch(relatesTo, endpoint, xaddrs, scopes string) []byte {
+	return []byte(`<?xml version="1.0" encoding="UTF-8"?>` +
+		`<SOAP-ENV:Envelope xmlns:SOAP-ENV="http://www.w3.org/2003/05/soap-envelope"` +
+		` xmlns:wsa="http://schemas.xmlsoap.org/ws/2004/08/addressing"` +
+		` xmlns:d="http://schemas.xmlsoap.org/ws/2005/04/discovery"` +
+		` xmlns:dn="http://www.onvif.org/ver10/network/wsdl" xmlns:tds="http://www.onvif.org/ver10/device/wsdl">` +
+		`<SOAP-ENV:Header><wsa:MessageID>urn:uuid:reply</wsa:MessageID><wsa:RelatesTo>` + relatesTo + `</wsa:RelatesTo>` +
+		`<wsa:Action>http://schemas.xmlsoap.org/ws/2005/04/discovery/ProbeMatches</wsa:Action></SOAP-ENV:Header>` +
+		`<SOAP-ENV:Body><d:ProbeMatches><d:ProbeMatch>` +
+		`<wsa:EndpointReference><wsa:Address>` + endpoint + `</wsa:Address></wsa:EndpointReference>` +
+		`<d:Types>dn:NetworkVideoTransmitter tds:Device</d:Types><d:Scopes>` + scopes + `</d:Scopes>` +
+		`<d:XAddrs>` + xaddrs + `</d:XAddrs><d:MetadataVersion>10</d:MetadataVersion>` +
+		`</d:ProbeMatch></d:ProbeMatches></SOAP-ENV:Body></SOAP-ENV:Envelope>`)
+}
+
+// newCamera serves the device service of a camera that requires credentials.
+func newCamera(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		var reply string
+		switch {
+		case r.URL.Path != "/onvif/device_service":
+			w.WriteHeader(http.StatusNotFound)
+		case !bytes.Contains(body, []byte("<Username>admin</Username>")):
+			w.WriteHeader(http.StatusBadRequest)
+			reply = `<env:Fault><env:Code><env:Value>env:Sender</env:Value></env:Code>` +
+				`<env:Reason><env:Text xml:lang="en">Sender not Authorized</env:Text></env:Reason></env:Fault>`
+		case bytes.Contains(body, []byte("GetDeviceInformation")):
+			reply = `<tds:GetDeviceInformationResponse><tds:Manufacturer>HIKVISION</tds:Manufacturer>` +
+				`<tds:Model>DS-2CD2032-I</tds:Model><tds:FirmwareVersion>V5.4.5</tds:FirmwareVersion>` +
+				`<tds:SerialNumber>DS-2CD2032-I20160101AAWR123456789</tds:SerialNumber><tds:HardwareId>88</tds:HardwareId>` +
+				`</tds:GetDeviceInformationResponse>`
+		}
+		w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope"` +
+			` xmlns:tds="http://www.onvif.org/ver10/device/wsdl" xmlns:tt="http://www.onvif.org/ver10/schema"><env:Body>` +
+			reply + `</env:Body></env:Envelope>`))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestProbe(t *testing.T) {
+	r := newResponder(t, "http://192.168.1.64/onvif/device_service", "http://[fe80::1]/onvif/device_service http://192.168.1.65:8080/onvif/device_service")
+	devices, err := Probe(context.Background(), Options{
+		Address: r.conn.LocalAddr().String(),
+		Timeout: 300 * time.Millisecond,
+		Scopes:  []string{"onvif://www.onvif.org/location/city"},
+	})
+	require.NoError(t, err)
+
+	probe := <-r.probes
+	assert.Contains(t, probe, "<d:Types>dn:NetworkVideoTransmitter</d:Types>")
+	assert.Contains(t, probe, "<d:Scopes>onvif://www.onvif.org/location/city</d:Scopes>")
+	assert.Contains(t, probe, "http://schemas.xmlsoap.org/ws/2005/04/discovery/Probe</a:Action>")
+
+	require.Len(t, devices, 2)
+	assert.Equal(t, Device{
+		Endpoint: "urn:uuid:cam-0",
+		XAddrs:   []string{"http://192.168.1.64/onvif/device_service"},
+		Types:    []string{"dn:NetworkVideoTransmitter", "tds:Device"},
+		Scopes: []string{"onvif://www.onvif.org/type/video_encoder", "onvif://www.onvif.org/name/Front%20Door%200",
+			"onvif://www.onvif.org/hardware/DS-2CD2032", "onvif://www.onvif.org/location/city/lab"},
+		Name:     "Front Door 0",
+		Hardware: "DS-2CD2032",
+		Location: "city/lab",
+	}, devices[0])
+	assert.Equal(t, "192.168.1.64", devices[0].Host())
+	assert.Equal(t, "urn:uuid:cam-1", devices[1].Endpoint)
+	assert.Equal(t, "192.168.1.65:8080", devices[1].Host())
+}
+
+func TestProbeCancel(t *testing.T) {
+	r := newResponder(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	start := time.Now()
+	devices, err := Probe(ctx, Options{Address: r.conn.LocalAddr().String(), Timeout: time.Minute})
+	require.NoError(t, err)
+	assert.Empty(t, devices)
+	assert.Less(t, int64(time.Since(start)), int64(10*time.Second))
+}
+
+func TestReadInformation(t *testing.T) {
+	camera := newCamera(t)
+	device := Device{Endpoint: "urn:uuid:cam-0", XAddrs: []string{camera.URL + "/onvif/device_service"}}
+
+	info, err := ReadInformation(&device, "admin", "secret")
+	require.NoError(t, err)
+	assert.Equal(t, DeviceInformation{
+		Manufacturer:    "HIKVISION",
+		Model:           "DS-2CD2032-I",
+		FirmwareVersion: "V5.4.5",
+		SerialNumber:    "DS-2CD2032-I20160101AAWR123456789",
+		HardwareID:      "88",
+	}, *info)
+
+	_, err = ReadInformation(&device, "guest", "secret")
+	assert.EqualError(t, err, "get device information of "+camera.URL+"/onvif/device_service: Sender not Authorized")
+}
+
+func TestManifest(t *testing.T) {
+	devices := []Device{
+		{Endpoint: "urn:uuid:cam-0", XAddrs: []string{"http://192.168.1.64/onvif/device_service"}, Name: "Front Door"},
+		{Endpoint: "urn:uuid:cam-1", XAddrs: []string{"http://192.168.1.65:8080/onvif/device_service"}, Name: "front_door",
+			Info: &DeviceInformation{Manufacturer: "HIKVISION", SerialNumber: "SN1"}},
+		{Endpoint: "urn:uuid:4A2B6C10-0000-1000-8000-0012ABCD", XAddrs: []string{"http://192.168.1.66/onvif/device_service"}},
+	}
+	b, err := Manifest(devices, ManifestOptions{Node: "edge-1", Username: "admin", PasswordFile: "/ca/pass"})
+	require.NoError(t, err)
+
+	docs := strings.Split(string(b), "---\n")
+	require.Len(t, docs, 3)
+	var crs []manifest
+	for _, doc := range docs {
+		var cr manifest
+		require.NoError(t, yaml.Unmarshal([]byte(doc), &cr))
+		crs = append(crs, cr)
+	}
+	assert.Equal(t, "front-door", crs[0].Metadata.Name)
+	assert.Equal(t, "front-door-2", crs[1].Metadata.Name)
+	assert.Equal(t, "4a2b6c10-0000-1000-8000-0012abcd", crs[2].Metadata.Name)
+
+	cr := crs[1]
+	assert.Equal(t, "devices.kubeedge.io/v1alpha2", cr.APIVersion)
+	assert.Equal(t, "Device", cr.Kind)
+	assert.Equal(t, DefaultModel, cr.Spec.DeviceModelRef.Name)
+	assert.Equal(t, "onvif", cr.Spec.Protocol.CustomizedProtocol.ProtocolName)
+	assert.Equal(t, map[string]string{"url": "192.168.1.65:8080", "userName": "admin", "password": "/ca/pass"},
+		cr.Spec.Protocol.CustomizedProtocol.ConfigData)
+	assert.Equal(t, []string{"edge-1"}, cr.Spec.NodeSelector.NodeSelectorTerms[0].MatchExpressions[0].Values)
+	assert.Equal(t, "HIKVISION", cr.Metadata.Annotations["onvif.kubeedge.io/manufacturer"])
+	assert.Equal(t, "urn:uuid:cam-1", cr.Metadata.Annotations["onvif.kubeedge.io/endpoint"])
+}
+
+func TestRun(t *testing.T) {
+	camera := newCamera(t)
+	r := newResponder(t, camera.URL+"/onvif/device_service")
+	passwordFile := filepath.Join(t.TempDir(), "pass")
+	require.NoError(t, ioutil.WriteFile(passwordFile, []byte("secret\n"), 0600))
+
+	var out bytes.Buffer
+	err := Run(context.Background(), []string{"--address", r.conn.LocalAddr().String(), "--timeout", "300ms",
+		"--read-info", "--password-file", passwordFile, "--node", "edge-1"}, &out)
+	require.NoError(t, err)
+
+	var cr manifest
+	require.NoError(t, yaml.Unmarshal(out.Bytes(), &cr))
+	assert.Equal(t, "front-door-0", cr.Metadata.Name)
+	assert.Equal(t, strings.TrimPrefix(camera.URL, "http://"), cr.Spec.Protocol.CustomizedProtocol.ConfigData["url"])
+	assert.Equal(t, passwordFile, cr.Spec.Protocol.CustomizedProtocol.ConfigData["password"])
+	assert.Equal(t, "DS-2CD2032-I", cr.Metadata.Annotations["onvif.kubeedge.io/model"])
+
+	assert.Error(t, Run(context.Background(), []string{"--output", "xml"}, &out))
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2021 The KubeEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package discovery
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/beevik/etree"
+	"github.com/use-go/onvif/gosoap"
+)
+
+// requestTimeout bounds the requests to a discovered device.
+const requestTimeout = 10 * time.Second
+
+// DeviceInformation is the GetDeviceInformation reply of a device.
+type DeviceInformation struct {
+	Manufacturer    string `json:"manufacturer"`
+	Model           string `json:"model"`
+	FirmwareVersion string `json:"firmwareVersion"`
+	SerialNumber    string `json:"serialNumber"`
+	HardwareID      string `json:"hardwareId"`
+}
+
+// ReadInformation logs in to the device service of the device and reads
+// its information.
+func ReadInformation(d *Device, username, password string) (*DeviceInformation, error) {
+	address := d.ServiceAddress()
+	if address == "" {
+		return nil, fmt.Errorf("%s has no usable address in %v", d.Endpoint, d.XAddrs)
+	}
+	soap := gosoap.NewEmptySOAP()
+	soap.AddRootNamespace("tds", "http://www.onvif.org/ver10/device/wsdl")
+	soap.AddStringBodyContent("<tds:GetDeviceInformation/>")
+	if username != "" && password != "" {
+		soap.AddWSSecurity(username, password)
+	}
+
+	client := http.Client{Timeout: requestTimeout}
+	resp, err := client.Post(address, "application/soap+xml; charset=utf-8", bytes.NewBufferString(soap.String()))
+	if err != nil {
+		return nil, fmt.Errorf("get device information of %s: %v", address, err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("get device information of %s: %v", address, err)
+	}
+
+	doc := etree.NewDocument()
+	if err = doc.ReadFromBytes(body); err != nil {
+		return nil, fmt.Errorf("get device information of %s: %v", address, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		if reason := doc.FindElement("./Envelope/Body/Fault/Reason/Text"); reason != nil {
+			return nil, fmt.Errorf("get device information of %s: %s", address, reason.Text())
+		}
+		return nil, fmt.Errorf("get device information of %s: %s", address, resp.Status)
+	}
+	reply := doc.FindElement("./Envelope/Body/GetDeviceInformationResponse")
+	if reply == nil {
+		return nil, errors.New("no device information in the reply of " + address)
+	}
+	text := func(tag string) string {
+		if e := reply.SelectElement(tag); e != nil {
+			return e.Text()
+		}
+		return ""
+	}
+	return &DeviceInformation{
+		Manufacturer:    text("Manufacturer"),
+		Model:           text("Model"),
+		FirmwareVersion: text("FirmwareVersion"),
+		SerialNumber:    text("SerialNumber"),
+		HardwareID:      text("HardwareId"),
+	}, nil
+}
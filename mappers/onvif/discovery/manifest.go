@@ -0,0 +1,193 @@
+/*
+Copyright 2021 The KubeEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package discovery
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// DefaultModel is the device model the manifests refer to.
+const DefaultModel = "onvif-model"
+
+const annotationPrefix = "onvif.kubeedge.io/"
+
+// ManifestOptions configures the Device CRs written for discovered devices.
+type ManifestOptions struct {
+	Namespace string
+	// Model is the name of the DeviceModel, DefaultModel if empty.
+	Model string
+	// Node is the edge node the devices are bound to.
+	Node     string
+	Username string
+	// PasswordFile is where the mapper reads the password from.
+	PasswordFile string
+}
+
+type manifest struct {
+	APIVersion string           `yaml:"apiVersion"`
+	Kind       string           `yaml:"kind"`
+	Metadata   manifestMetadata `yaml:"metadata"`
+	Spec       manifestSpec     `yaml:"spec"`
+}
+
+type manifestMetadata struct {
+	Name        string            `yaml:"name"`
+	Namespace   string            `yaml:"namespace,omitempty"`
+	Labels      map[string]string `yaml:"labels,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+}
+
+type manifestSpec struct {
+	DeviceModelRef struct {
+		Name string `yaml:"name"`
+	} `yaml:"deviceModelRef"`
+	Protocol struct {
+		CustomizedProtocol struct {
+			ProtocolName string            `yaml:"protocolName"`
+			ConfigData   map[string]string `yaml:"configData"`
+		} `yaml:"customizedProtocol"`
+	} `yaml:"protocol"`
+	NodeSelector *nodeSelector `yaml:"nodeSelector,omitempty"`
+}
+
+type nodeSelector struct {
+	NodeSelectorTerms []nodeSelectorTerm `yaml:"nodeSelectorTerms"`
+}
+
+type nodeSelectorTerm struct {
+	MatchExpressions []matchExpression `yaml:"matchExpressions"`
+}
+
+type matchExpression struct {
+	Key      string   `yaml:"key"`
+	Operator string   `yaml:"operator"`
+	Values   []string `yaml:"values"`
+}
+
+// Manifest returns the Device CRs of the devices as a multi-document YAML
+// stream, in the format of build/crd-samples/devices/onvif-device.yaml.
+func Manifest(devices []Device, opts ManifestOptions) ([]byte, error) {
+	model := opts.Model
+	if model == "" {
+		model = DefaultModel
+	}
+	names := make(map[string]bool)
+	var buf bytes.Buffer
+	for i := range devices {
+		d := &devices[i]
+		m := manifest{APIVersion: "devices.kubeedge.io/v1alpha2", Kind: "Device"}
+		m.Metadata.Name = uniqueName(names, deviceName(d))
+		m.Metadata.Namespace = opts.Namespace
+		m.Metadata.Labels = map[string]string{"model": model}
+		m.Metadata.Annotations = annotations(d)
+		m.Spec.DeviceModelRef.Name = model
+		m.Spec.Protocol.CustomizedProtocol.ProtocolName = "onvif"
+		m.Spec.Protocol.CustomizedProtocol.ConfigData = map[string]string{
+			"url":      d.Host(),
+			"userName": opts.Username,
+			"password": opts.PasswordFile,
+		}
+		if opts.Node != "" {
+			m.Spec.NodeSelector = &nodeSelector{NodeSelectorTerms: []nodeSelectorTerm{{
+				MatchExpressions: []matchExpression{{Key: "", Operator: "In", Values: []string{opts.Node}}},
+			}}}
+		}
+
+		b, err := yaml.Marshal(&m)
+		if err != nil {
+			return nil, fmt.Errorf("marshal %s: %v", m.Metadata.Name, err)
+		}
+		if i > 0 {
+			buf.WriteString("---\n")
+		}
+		buf.Write(b)
+	}
+	return buf.Bytes(), nil
+}
+
+func annotations(d *Device) map[string]string {
+	a := map[string]string{annotationPrefix + "endpoint": d.Endpoint}
+	set := func(key, value string) {
+		if value != "" {
+			a[annotationPrefix+key] = value
+		}
+	}
+	set("name", d.Name)
+	set("hardware", d.Hardware)
+	set("location", d.Location)
+	if d.Info != nil {
+		set("manufacturer", d.Info.Manufacturer)
+		set("model", d.Info.Model)
+		set("firmware-version", d.Info.FirmwareVersion)
+		set("serial-number", d.Info.SerialNumber)
+	}
+	return a
+}
+
+// deviceName picks a name for the device from its name scope, its serial
+// number or its endpoint.
+func deviceName(d *Device) string {
+	candidates := []string{d.Name}
+	if d.Info != nil {
+		candidates = append(candidates, d.Info.SerialNumber)
+	}
+	candidates = append(candidates, strings.TrimPrefix(d.Endpoint, "urn:uuid:"), d.Host())
+	for _, c := range candidates {
+		if name := dnsLabel(c); name != "" {
+			return name
+		}
+	}
+	return "onvif-camera"
+}
+
+// dnsLabel lowercases s and replaces what is not allowed in a DNS-1123
+// label with dashes.
+func dnsLabel(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(s) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	name := strings.TrimRight(b.String(), "-")
+	if len(name) > 63 {
+		name = strings.TrimRight(name[:63], "-")
+	}
+	return name
+}
+
+func uniqueName(names map[string]bool, name string) string {
+	unique := name
+	for i := 2; names[unique]; i++ {
+		suffix := fmt.Sprintf("-%d", i)
+		if len(name)+len(suffix) > 63 {
+			name = strings.TrimRight(name[:63-len(suffix)], "-")
+		}
+		unique = name + suffix
+	}
+	names[unique] = true
+	return unique
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2021 The KubeEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// The browse command connects to an OPC UA server, browses its address space
+// and prints a DeviceModel and a Device for the variables found.
+package main
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/kubeedge/kubeedge/pkg/apis/devices/v1alpha2"
+	"github.com/spf13/pflag"
+	"k8s.io/klog/v2"
+
+	"github.com/kubeedge/mappers-go/mappers/opcua/driver"
+	"github.com/kubeedge/mappers-go/mappers/opcua/modelgen"
+)
+
+func main() {
+	var config driver.OPCUAConfig
+	var browseConfig driver.BrowseConfig
+	var opts modelgen.Options
+	var output string
+
+	klog.InitFlags(nil)
+	defer klog.Flush()
+
+	pflag.StringVar(&config.URL, "url", "opc.tcp://127.0.0.1:4840", "OPC UA server endpoint")
+	pflag.StringVar(&config.User, "username", "", "username")
+	pflag.StringVar(&config.Passwordfile, "password-file", "", "password file path")
+	pflag.StringVar(&config.SecurityPolicy, "security-policy", "None", "security policy")
+	pflag.StringVar(&config.SecurityMode, "security-mode", "None", "security mode")
+	pflag.StringVar(&config.Certfile, "certification", "", "certification file path")
+	pflag.StringVar(&config.Keyfile, "privatekey", "", "private key file path")
+	pflag.StringVar(&config.RemoteCertfile, "remote-certification", "", "server certification file path")
+	pflag.StringVar(&browseConfig.Root, "root", driver.DefaultBrowseRoot, "node ID to start browsing from")
+	pflag.IntVar(&browseConfig.MaxDepth, "depth", 10, "maximum browse depth")
+	pflag.StringSliceVar(&browseConfig.Include, "include", nil, "browse path patterns of the variables to include, e.g. Boiler/*")
+	pflag.StringSliceVar(&browseConfig.Exclude, "exclude", nil, "browse path patterns of the nodes to exclude")
+	pflag.StringVar(&opts.ModelName, "model-name", "opcua-model", "name of the generated DeviceModel")
+	pflag.StringVar(&opts.DeviceName, "device-name", "opcua-device", "name of the generated Device")
+	pflag.StringVar(&opts.Namespace, "namespace", "default", "namespace of the generated resources")
+	pflag.StringVar(&output, "output", "", "output file, defaults to stdout")
+	pflag.Parse()
+
+	client, err := driver.NewClient(config)
+	if err != nil {
+		klog.Fatalf("Connect to %s failed: %v", config.URL, err)
+	}
+	defer client.Close()
+
+	nodes, err := client.Browse(browseConfig)
+	if err != nil {
+		klog.Fatalf("Browse failed: %v", err)
+	}
+	klog.V(2).Infof("Found %d variables", len(nodes))
+
+	opts.Protocol = v1alpha2.ProtocolConfigOpcUA{
+		URL:            config.URL,
+		UserName:       config.User,
+		Password:       config.Passwordfile,
+		SecurityPolicy: config.SecurityPolicy,
+		SecurityMode:   config.SecurityMode,
+		Certificate:    config.Certfile,
+		PrivateKey:     config.Keyfile,
+	}
+	model, device, err := modelgen.Generate(nodes, opts)
+	if err != nil {
+		klog.Fatal(err)
+	}
+	if config.RemoteCertfile != "" {
+		device.Spec.Protocol.Common = &v1alpha2.ProtocolConfigCommon{
+			CustomizedValues: &v1alpha2.CustomizedValue{Data: map[string]interface{}{"remoteCertificate": config.RemoteCertfile}},
+		}
+	}
+	data, err := modelgen.Marshal(model, device)
+	if err != nil {
+		klog.Fatal(err)
+	}
+
+	if output == "" {
+		_, err = os.Stdout.Write(data)
+	} else {
+		err = ioutil.WriteFile(output, data, 0644)
+	}
+	if err != nil {
+		klog.Fatal(err)
+	}
+}
@@ -25,6 +25,7 @@ import (
 	"github.com/kubeedge/mappers-go/mappers/opcua/config"
 	"github.com/kubeedge/mappers-go/mappers/opcua/device"
 	"github.com/kubeedge/mappers-go/mappers/opcua/globals"
+	"github.com/kubeedge/mappers-go/mappers/opcua/httpserver"
 )
 
 func main() {
@@ -54,5 +55,8 @@ func main() {
 		klog.Fatal(err)
 		os.Exit(1)
 	}
+	if c.HTTP.ServerAddress != "" {
+		go httpserver.Start(c.HTTP.ServerAddress)
+	}
 	device.DevStart()
 }
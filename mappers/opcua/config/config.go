@@ -29,6 +29,13 @@ import (
 type Config struct {
 	Mqtt      Mqtt   `yaml:"mqtt,omitempty"`
 	Configmap string `yaml:"configmap"`
+	HTTP      HTTP   `yaml:"http,omitempty"`
+}
+
+// HTTP is the REST API configuration.
+type HTTP struct {
+	// ServerAddress is the listen address, the REST API is disabled if empty.
+	ServerAddress string `yaml:"server,omitempty"`
 }
 
 // Mqtt is the Mqtt configuration.
@@ -75,6 +82,7 @@ func (c *Config) parseFlags() error {
 	pflag.StringVar(&c.Mqtt.Password, "mqtt-password", c.Mqtt.Password, "password")
 	pflag.StringVar(&c.Mqtt.CertFile, "mqtt-certification", c.Mqtt.CertFile, "certification file path")
 	pflag.StringVar(&c.Mqtt.PrivateKeyFile, "mqtt-priviatekey", c.Mqtt.PrivateKeyFile, "private key file path")
+	pflag.StringVar(&c.HTTP.ServerAddress, "http-address", c.HTTP.ServerAddress, "REST API listen address, disabled if empty")
 
 	pflag.Parse()
 
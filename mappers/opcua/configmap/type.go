@@ -22,6 +22,22 @@ type VisitorConfigOPCUA struct {
 	NodeID string `json:"nodeID,omitempty"`
 	// The name of opc-ua node
 	BrowseName string `json:"browseName,omitempty"`
+	// The method called when the twin desired value changes, the property is
+	// not read periodically.
+	// +optional
+	Method *VisitorConfigOPCUAMethod `json:"method,omitempty"`
+}
+
+// VisitorConfigOPCUAMethod is the opc-ua method of a property.
+type VisitorConfigOPCUAMethod struct {
+	// Required: The ID of the object node the method belongs to, e.g. "ns=2;s=Machine"
+	ObjectID string `json:"objectID,omitempty"`
+	// Required: The ID of the method node, e.g. "ns=2;s=Machine.StartBatch"
+	MethodID string `json:"methodID,omitempty"`
+	// The built-in data types of the input arguments, e.g. ["Int32", "String"].
+	// The desired value is a JSON array if there is more than one argument.
+	// +optional
+	InputArguments []string `json:"inputArguments,omitempty"`
 }
 
 // Configuration for opc-ua protocol.
@@ -35,10 +51,11 @@ type ProtocolConfigOPCUA struct {
 	// +optional
 	Password string `json:"password,omitempty"`
 	// Defaults to "None". The value could be "None", "Basic128Rsa15", "Basic256",
-	// "Basic256Sha256", "Aes128Sha256RsaOaep", "Aes256Sha256RsaPss".
+	// "Basic256Sha256", "Aes128Sha256RsaOaep", "Aes256Sha256RsaPss" or "Auto"
+	// to select the most secure policy offered by the server.
 	// +optional
 	SecurityPolicy string `json:"securityPolicy,omitempty"`
-	// Defaults to "None". The value could be "None", "Sign" and "SignAndEncrypt".
+	// Defaults to "None". The value could be "None", "Sign", "SignAndEncrypt" or "Auto".
 	// +optional
 	SecurityMode string `json:"securityMode,omitempty"`
 	// Certificate file for access opc server.
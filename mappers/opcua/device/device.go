@@ -18,11 +18,13 @@ package device
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/gopcua/opcua/ua"
 	"k8s.io/klog/v2"
 	
 	mappercommon "github.com/kubeedge/mappers-go/mappers/common"
@@ -37,6 +39,15 @@ var models map[string]mappercommon.DeviceModel
 var protocols map[string]mappercommon.Protocol
 var wg sync.WaitGroup
 
+var (
+	// ErrDeviceNotFound error of an unknown device.
+	ErrDeviceNotFound = errors.New("Device not found")
+	// ErrPropertyNotFound error of an unknown property.
+	ErrPropertyNotFound = errors.New("Property not found")
+	// ErrNotMethod error of a property without method.
+	ErrNotMethod = errors.New("Property is not a method")
+)
+
 // setVisitor check if visitory property is readonly, if not then set it.
 func setVisitor(visitorConfig *configmap.VisitorConfigOPCUA, twin *mappercommon.Twin, client *driver.OPCUAClient) {
 	if twin.PVisitor.PProperty.AccessMode == "ReadOnly" {
@@ -51,6 +62,62 @@ func setVisitor(visitorConfig *configmap.VisitorConfigOPCUA, twin *mappercommon.
 	}
 }
 
+// callVisitor call the method of the visitor and report the output arguments,
+// or the status code if the call failed, as twin value.
+func callVisitor(id string, visitorConfig *configmap.VisitorConfigOPCUA, twin *mappercommon.Twin, client *driver.OPCUAClient) {
+	var result string
+	args, err := driver.ParseArguments(twin.Desired.Value, len(visitorConfig.Method.InputArguments))
+	if err != nil {
+		klog.Errorf("Parse arguments of %s failed: %v", twin.PropertyName, err)
+		result = driver.StatusName(ua.StatusBadInvalidArgument)
+	} else if outputs, err := client.Call(methodCall(visitorConfig.Method), args); err != nil {
+		klog.Errorf("Call error: %v, %v", err, visitorConfig.Method)
+		result = driver.StatusName(err)
+	} else {
+		result = driver.FormatOutput(outputs)
+	}
+
+	payload, err := mappercommon.CreateMessageTwinUpdate(twin.PropertyName, twin.Desired.Metadatas.Type, result)
+	if err != nil {
+		klog.Errorf("Create message twin update failed: %v", err)
+		return
+	}
+	topic := fmt.Sprintf(mappercommon.TopicTwinUpdate, id)
+	if err = globals.MqttClient.Publish(topic, payload); err != nil {
+		klog.Errorf("Publish topic %v failed, err: %v", topic, err)
+	}
+}
+
+func methodCall(method *configmap.VisitorConfigOPCUAMethod) driver.MethodCall {
+	return driver.MethodCall{
+		ObjectID:       method.ObjectID,
+		MethodID:       method.MethodID,
+		InputArguments: method.InputArguments,
+	}
+}
+
+// CallMethod call the method of a device property with the input arguments.
+func CallMethod(id string, propertyName string, args []string) ([]string, error) {
+	dev, ok := devices[id]
+	if !ok || dev.OPCUAClient == nil {
+		return nil, ErrDeviceNotFound
+	}
+	for _, visitor := range dev.Instance.PropertyVisitors {
+		if visitor.PropertyName != propertyName {
+			continue
+		}
+		var visitorConfig configmap.VisitorConfigOPCUA
+		if err := json.Unmarshal(visitor.VisitorConfig, &visitorConfig); err != nil {
+			return nil, err
+		}
+		if visitorConfig.Method == nil {
+			return nil, ErrNotMethod
+		}
+		return dev.OPCUAClient.Call(methodCall(visitorConfig.Method), args)
+	}
+	return nil, ErrPropertyNotFound
+}
+
 // onMessage callback function of Mqtt subscribe message.
 func onMessage(client mqtt.Client, message mqtt.Message) {
 	klog.V(2).Info("Receive message", message.Topic())
@@ -86,16 +153,22 @@ func onMessage(client mqtt.Client, message mqtt.Message) {
 			klog.Error("Twin not found: ", twinName)
 			continue
 		}
-		// Desired value is not changed.
-		if dev.Instance.Twins[i].Desired.Value == twinValue {
-			continue
-		}
-		dev.Instance.Twins[i].Desired.Value = twinValue
 		var visitorConfig configmap.VisitorConfigOPCUA
 		if err := json.Unmarshal(dev.Instance.Twins[i].PVisitor.VisitorConfig, &visitorConfig); err != nil {
 			klog.Errorf("Unmarshal VisitorConfig failed: %v", err)
 			continue
 		}
+		// A method is called on each delta, so that it could be triggered again with the same value.
+		if visitorConfig.Method != nil {
+			dev.Instance.Twins[i].Desired.Value = twinValue
+			callVisitor(id, &visitorConfig, &dev.Instance.Twins[i], dev.OPCUAClient)
+			continue
+		}
+		// Desired value is not changed.
+		if dev.Instance.Twins[i].Desired.Value == twinValue {
+			continue
+		}
+		dev.Instance.Twins[i].Desired.Value = twinValue
 		setVisitor(&visitorConfig, &dev.Instance.Twins[i], dev.OPCUAClient)
 	}
 }
@@ -112,13 +185,21 @@ func getRemoteCertfile(customizedValue configmap.CustomizedValue) string {
 	return ""
 }
 
+// getCustomizedValue get an optional customized value as string.
+func getCustomizedValue(customizedValue configmap.CustomizedValue, key string) string {
+	if value, ok := customizedValue[key]; ok {
+		return fmt.Sprintf("%v", value)
+	}
+	return ""
+}
+
 // initOPCUA initialize OPCUA client
 func initOPCUA(protocolConfig configmap.ProtocolConfigOPCUA, protocolCommConfig configmap.ProtocolCommonConfigOPCUA) (client *driver.OPCUAClient, err error) {
-	if protocolConfig.SecurityPolicy == "" {
-		protocolConfig.SecurityPolicy = "None"
-	}
-	if protocolConfig.SecurityMode == "" {
-		protocolConfig.SecurityMode = "None"
+	var maxReconnectInterval time.Duration
+	if interval := getCustomizedValue(protocolCommConfig.CustomizedValues, "maxReconnectInterval"); interval != "" {
+		if maxReconnectInterval, err = time.ParseDuration(interval); err != nil {
+			return nil, fmt.Errorf("invalid maxReconnectInterval %s: %v", interval, err)
+		}
 	}
 	config := driver.OPCUAConfig{
 		URL:            protocolConfig.URL,
@@ -129,6 +210,10 @@ func initOPCUA(protocolConfig configmap.ProtocolConfigOPCUA, protocolCommConfig
 		Certfile:       protocolConfig.Certificate,
 		RemoteCertfile: getRemoteCertfile(protocolCommConfig.CustomizedValues),
 		Keyfile:        protocolConfig.PrivateKey,
+		PKIDir:         getCustomizedValue(protocolCommConfig.CustomizedValues, "pkiDir"),
+		ApplicationURI: getCustomizedValue(protocolCommConfig.CustomizedValues, "applicationURI"),
+
+		MaxReconnectInterval: maxReconnectInterval,
 	}
 
 	return driver.NewClient(config)
@@ -142,6 +227,10 @@ func initTwin(dev *globals.OPCUADev) {
 			klog.Errorf("Unmarshal VisitorConfig error: %v", err)
 			continue
 		}
+		// Methods are only called on twin updates.
+		if visitorConfig.Method != nil {
+			continue
+		}
 		setVisitor(&visitorConfig, &dev.Instance.Twins[i], dev.OPCUAClient)
 
 		twinData := TwinData{Client: dev.OPCUAClient,
@@ -171,6 +260,9 @@ func initData(dev *globals.OPCUADev) {
 			klog.Errorf("Unmarshal VisitorConfig error: %v", err)
 			continue
 		}
+		if visitorConfig.Method != nil {
+			continue
+		}
 
 		twinData := TwinData{Client: dev.OPCUAClient,
 			Name:   dev.Instance.Datas.Properties[i].PropertyName,
@@ -0,0 +1,240 @@
+/*
+Copyright 2021 The KubeEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/gopcua/opcua/id"
+	"github.com/gopcua/opcua/ua"
+	"k8s.io/klog/v2"
+)
+
+// DefaultBrowseRoot is the Objects folder of the server address space.
+const DefaultBrowseRoot = "i=85"
+
+// defaultBrowseDepth limits the recursion if no depth is configured.
+const defaultBrowseDepth = 10
+
+// BrowseConfig configurations for browsing the address space.
+type BrowseConfig struct {
+	// Root is the node ID to start browsing from, defaults to the Objects folder.
+	Root string
+	// MaxDepth is the maximum recursion depth below the root node.
+	MaxDepth int
+	// Include contains browse path patterns, only the variables matching one of
+	// them are returned. All variables are returned if it is empty.
+	Include []string
+	// Exclude contains browse path patterns, the matching nodes and all nodes
+	// below them are skipped.
+	Exclude []string
+}
+
+// NodeDef is a variable node found in the address space.
+type NodeDef struct {
+	NodeID      string
+	BrowseName  string
+	Description string
+	// Path is the browse path below the root node, e.g. "Boiler/Drum/Level".
+	Path string
+	// DataType is the KubeEdge property type: int, float, double, boolean, string or bytes.
+	DataType    string
+	AccessLevel ua.AccessLevelType
+}
+
+// Writable returns true if the current value of the node can be written.
+func (n NodeDef) Writable() bool {
+	return n.AccessLevel&ua.AccessLevelTypeCurrentWrite == ua.AccessLevelTypeCurrentWrite
+}
+
+// AccessMode returns the KubeEdge access mode derived from the access level.
+func (n NodeDef) AccessMode() string {
+	if n.Writable() {
+		return "ReadWrite"
+	}
+	return "ReadOnly"
+}
+
+// addressSpace is the part of the server the browser depends on.
+type addressSpace interface {
+	// attributes reads node class, browse name, description, access level and data type.
+	attributes(nodeID *ua.NodeID) ([]*ua.DataValue, error)
+	// children returns the hierarchical forward references of a node.
+	children(nodeID *ua.NodeID) ([]*ua.NodeID, error)
+}
+
+// clientAddressSpace browses through a connected client.
+type clientAddressSpace struct {
+	c *OPCUAClient
+}
+
+func (s clientAddressSpace) attributes(nodeID *ua.NodeID) ([]*ua.DataValue, error) {
+	return s.c.Client.Node(nodeID).Attributes(ua.AttributeIDNodeClass, ua.AttributeIDBrowseName,
+		ua.AttributeIDDescription, ua.AttributeIDAccessLevel, ua.AttributeIDDataType)
+}
+
+func (s clientAddressSpace) children(nodeID *ua.NodeID) ([]*ua.NodeID, error) {
+	var ids []*ua.NodeID
+	for _, ref := range []uint32{id.HasComponent, id.Organizes, id.HasProperty} {
+		nodes, err := s.c.Client.Node(nodeID).ReferencedNodes(ref, ua.BrowseDirectionForward, ua.NodeClassAll, true)
+		if err != nil {
+			return nil, err
+		}
+		for _, n := range nodes {
+			ids = append(ids, n.ID)
+		}
+	}
+	return ids, nil
+}
+
+// Browse walks the address space from the configured root node and returns
+// the readable variables which pass the include and exclude filters.
+func (c *OPCUAClient) Browse(config BrowseConfig) ([]NodeDef, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.ensureConnected(); err != nil {
+		return nil, err
+	}
+	return browse(clientAddressSpace{c: c}, config)
+}
+
+func browse(space addressSpace, config BrowseConfig) ([]NodeDef, error) {
+	if config.Root == "" {
+		config.Root = DefaultBrowseRoot
+	}
+	if config.MaxDepth <= 0 {
+		config.MaxDepth = defaultBrowseDepth
+	}
+	root, err := ua.ParseNodeID(config.Root)
+	if err != nil {
+		return nil, fmt.Errorf("invalid root node id %s: %v", config.Root, err)
+	}
+
+	b := browser{space: space, config: config, visited: make(map[string]bool)}
+	children, err := space.children(root)
+	if err != nil {
+		return nil, fmt.Errorf("browse %s failed: %v", config.Root, err)
+	}
+	for _, child := range children {
+		if err = b.walk(child, "", 1); err != nil {
+			return nil, err
+		}
+	}
+	return b.nodes, nil
+}
+
+type browser struct {
+	space   addressSpace
+	config  BrowseConfig
+	visited map[string]bool
+	nodes   []NodeDef
+}
+
+func (b *browser) walk(nodeID *ua.NodeID, parent string, depth int) error {
+	if depth > b.config.MaxDepth || b.visited[nodeID.String()] {
+		return nil
+	}
+	b.visited[nodeID.String()] = true
+
+	attrs, err := b.space.attributes(nodeID)
+	if err != nil {
+		return fmt.Errorf("read attributes of %s failed: %v", nodeID, err)
+	}
+	if len(attrs) != 5 || attrs[0].Status != ua.StatusOK || attrs[1].Status != ua.StatusOK {
+		klog.V(4).Infof("Skip node %s without class or browse name", nodeID)
+		return nil
+	}
+
+	def := NodeDef{
+		NodeID:     nodeID.String(),
+		BrowseName: attrs[1].Value.String(),
+	}
+	def.Path = path.Join(parent, def.BrowseName)
+	if matchAny(b.config.Exclude, def.Path) {
+		klog.V(4).Infof("Exclude node %s: %s", def.NodeID, def.Path)
+		return nil
+	}
+
+	if ua.NodeClass(attrs[0].Value.Int()) == ua.NodeClassVariable {
+		if attrs[2].Status == ua.StatusOK {
+			def.Description = attrs[2].Value.String()
+		}
+		if attrs[3].Status == ua.StatusOK {
+			def.AccessLevel = ua.AccessLevelType(attrs[3].Value.Uint())
+		}
+		if attrs[4].Status == ua.StatusOK && attrs[4].Value.NodeID() != nil {
+			def.DataType = propertyType(attrs[4].Value.NodeID())
+		}
+		if def.AccessLevel&ua.AccessLevelTypeCurrentRead == 0 {
+			klog.V(4).Infof("Skip unreadable node %s", def.NodeID)
+		} else if def.DataType == "" {
+			klog.V(4).Infof("Skip node %s with unsupported data type", def.NodeID)
+		} else if len(b.config.Include) == 0 || matchAny(b.config.Include, def.Path) {
+			b.nodes = append(b.nodes, def)
+		}
+	}
+
+	children, err := b.space.children(nodeID)
+	if err != nil {
+		return fmt.Errorf("browse %s failed: %v", nodeID, err)
+	}
+	for _, child := range children {
+		if err = b.walk(child, def.Path, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// matchAny reports whether the browse path or one of its ancestors matches
+// one of the patterns. Patterns use path.Match syntax on "/" separated paths.
+func matchAny(patterns []string, browsePath string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.Trim(pattern, "/")
+		for p := browsePath; p != "." && p != ""; p = path.Dir(p) {
+			if ok, _ := path.Match(pattern, p); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// propertyType converts the built-in OPC UA data type to the KubeEdge property type.
+func propertyType(dataType *ua.NodeID) string {
+	if dataType.Namespace() != 0 {
+		return ""
+	}
+	switch dataType.IntID() {
+	case id.Boolean:
+		return "boolean"
+	case id.SByte, id.Byte, id.Int16, id.UInt16, id.Int32, id.UInt32, id.Int64, id.UInt64:
+		return "int"
+	case id.Float:
+		return "float"
+	case id.Double:
+		return "double"
+	case id.String, id.LocalizedText, id.QualifiedName, id.XMLElement:
+		return "string"
+	case id.ByteString:
+		return "bytes"
+	default:
+		return ""
+	}
+}
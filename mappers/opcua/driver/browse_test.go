@@ -0,0 +1,106 @@
+/*
+Copyright 2021 The KubeEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"testing"
+
+	"github.com/gopcua/opcua/id"
+	"github.com/gopcua/opcua/ua"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeNode struct {
+	class       ua.NodeClass
+	name        string
+	dataType    uint32
+	accessLevel ua.AccessLevelType
+	children    []string
+}
+
+type fakeAddressSpace map[string]fakeNode
+
+func (s fakeAddressSpace) attributes(nodeID *ua.NodeID) ([]*ua.DataValue, error) {
+	n := s[nodeID.String()]
+	values := []*ua.DataValue{
+		{Value: ua.MustVariant(int32(n.class))},
+		{Value: ua.MustVariant(&ua.QualifiedName{Name: n.name})},
+		{Status: ua.StatusBadAttributeIDInvalid},
+		{Status: ua.StatusBadAttributeIDInvalid},
+		{Status: ua.StatusBadAttributeIDInvalid},
+	}
+	if n.class == ua.NodeClassVariable {
+		values[3] = &ua.DataValue{Value: ua.MustVariant(uint8(n.accessLevel))}
+		values[4] = &ua.DataValue{Value: ua.MustVariant(ua.NewNumericNodeID(0, n.dataType))}
+	}
+	return values, nil
+}
+
+func (s fakeAddressSpace) children(nodeID *ua.NodeID) ([]*ua.NodeID, error) {
+	var ids []*ua.NodeID
+	for _, child := range s[nodeID.String()].children {
+		nodeID, err := ua.ParseNodeID(child)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, nodeID)
+	}
+	return ids, nil
+}
+
+var rw = ua.AccessLevelTypeCurrentRead | ua.AccessLevelTypeCurrentWrite
+
+var boiler = fakeAddressSpace{
+	"i=85":      {class: ua.NodeClassObject, name: "Objects", children: []string{"ns=2;i=1", "ns=2;i=10"}},
+	"ns=2;i=1":  {class: ua.NodeClassObject, name: "Boiler", children: []string{"ns=2;i=2", "ns=2;i=3", "ns=2;i=4", "ns=2;i=5"}},
+	"ns=2;i=2":  {class: ua.NodeClassVariable, name: "Temperature", dataType: id.Double, accessLevel: ua.AccessLevelTypeCurrentRead},
+	"ns=2;i=3":  {class: ua.NodeClassVariable, name: "Switch", dataType: id.Boolean, accessLevel: rw},
+	"ns=2;i=4":  {class: ua.NodeClassVariable, name: "Secret", dataType: id.Int32},
+	"ns=2;i=5":  {class: ua.NodeClassObject, name: "Diagnostics", children: []string{"ns=2;i=6", "ns=2;i=1"}},
+	"ns=2;i=6":  {class: ua.NodeClassVariable, name: "Errors", dataType: id.UInt32, accessLevel: ua.AccessLevelTypeCurrentRead},
+	"ns=2;i=10": {class: ua.NodeClassObject, name: "Pump", children: []string{"ns=2;i=11"}},
+	"ns=2;i=11": {class: ua.NodeClassVariable, name: "Speed", dataType: id.Float, accessLevel: rw},
+}
+
+func TestBrowse(t *testing.T) {
+	nodes, err := browse(boiler, BrowseConfig{})
+	assert.Nil(t, err)
+	assert.Equal(t, []NodeDef{
+		{NodeID: "ns=2;i=2", BrowseName: "Temperature", Path: "Boiler/Temperature", DataType: "double", AccessLevel: ua.AccessLevelTypeCurrentRead},
+		{NodeID: "ns=2;i=3", BrowseName: "Switch", Path: "Boiler/Switch", DataType: "boolean", AccessLevel: rw},
+		{NodeID: "ns=2;i=6", BrowseName: "Errors", Path: "Boiler/Diagnostics/Errors", DataType: "int", AccessLevel: ua.AccessLevelTypeCurrentRead},
+		{NodeID: "ns=2;i=11", BrowseName: "Speed", Path: "Pump/Speed", DataType: "float", AccessLevel: rw},
+	}, nodes)
+	assert.Equal(t, "ReadOnly", nodes[0].AccessMode())
+	assert.Equal(t, "ReadWrite", nodes[1].AccessMode())
+}
+
+func TestBrowseFilter(t *testing.T) {
+	nodes, err := browse(boiler, BrowseConfig{Include: []string{"Boiler"}, Exclude: []string{"*/Diagnostics"}})
+	assert.Nil(t, err)
+	assert.Len(t, nodes, 2)
+	assert.Equal(t, "Boiler/Temperature", nodes[0].Path)
+	assert.Equal(t, "Boiler/Switch", nodes[1].Path)
+
+	nodes, err = browse(boiler, BrowseConfig{Root: "ns=2;i=1", MaxDepth: 1})
+	assert.Nil(t, err)
+	assert.Len(t, nodes, 2)
+	assert.Equal(t, "Temperature", nodes[0].Path)
+
+	_, err = browse(boiler, BrowseConfig{Root: "ns=a;i=1"})
+	assert.NotNil(t, err)
+}
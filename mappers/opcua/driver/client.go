@@ -18,17 +18,33 @@ package driver
 
 import (
 	"context"
+	"crypto/rsa"
 	"errors"
+	"fmt"
 	"io/ioutil"
+	"sort"
 	"strconv"
+	"sync"
+	"time"
 
 	"github.com/gopcua/opcua"
+	"github.com/gopcua/opcua/id"
 	"github.com/gopcua/opcua/ua"
 	"k8s.io/klog/v2"
-	
+
 	"github.com/kubeedge/mappers-go/mappers/common"
 )
 
+// SecurityAuto selects the most secure endpoint offered by the server.
+const SecurityAuto = "Auto"
+
+const (
+	minReconnectInterval        = 1 * time.Second
+	defaultMaxReconnectInterval = 1 * time.Minute
+	// A ServiceLevel below 200 means the server runs degraded, see Part 4, 6.6.2.4.
+	healthyServiceLevel = 200
+)
+
 // OPCUAConfig configurations for OPCUA.
 type OPCUAConfig struct {
 	URL            string
@@ -39,14 +55,36 @@ type OPCUAConfig struct {
 	Certfile       string
 	RemoteCertfile string
 	Keyfile        string
+	// PKIDir keeps the generated client certificate in "own" and the trusted
+	// server certificates in "trusted". Untrusted server certificates are
+	// written to "rejected".
+	PKIDir         string
+	ApplicationURI string
+	// MaxReconnectInterval is the upper bound of the reconnection backoff.
+	MaxReconnectInterval time.Duration
 }
 
 // OPCUAClient is the client structure.
 type OPCUAClient struct {
 	Client *opcua.Client
+	Config OPCUAConfig
+
+	mu        sync.Mutex
+	connected bool
+	// retryInterval is the current backoff, nextRetry the earliest time of the next connection attempt.
+	retryInterval time.Duration
+	nextRetry     time.Time
+	pki           *PKI
 }
 
-var clients map[string]*OPCUAClient
+// configError is a connection error which is not solved by reconnecting.
+type configError struct {
+	err error
+}
+
+func (e configError) Error() string {
+	return e.err.Error()
+}
 
 func readPassword(filename string) (string, error) {
 	b, err := ioutil.ReadFile(filename)
@@ -58,44 +96,297 @@ func readPassword(filename string) (string, error) {
 }
 
 // NewClient new the OPCUA client.
+// If the server is not reachable the client is returned anyway and
+// reconnects with backoff when it is used.
 func NewClient(config OPCUAConfig) (client *OPCUAClient, err error) {
-	ctx := context.Background()
-	var opts []opcua.Option
-	if config.Certfile != "" {
-		opts = []opcua.Option{
-			opcua.SecurityPolicy(config.SecurityPolicy),
-			opcua.SecurityModeString(config.SecurityMode),
-			opcua.CertificateFile(config.Certfile),
-			opcua.PrivateKeyFile(config.Keyfile),
-			opcua.RemoteCertificateFile(config.RemoteCertfile),
+	if config.SecurityPolicy == "" {
+		config.SecurityPolicy = "None"
+	}
+	if config.SecurityMode == "" {
+		config.SecurityMode = "None"
+	}
+	if config.MaxReconnectInterval == 0 {
+		config.MaxReconnectInterval = defaultMaxReconnectInterval
+	}
+	client = &OPCUAClient{Config: config, retryInterval: minReconnectInterval}
+	if config.PKIDir != "" {
+		if client.pki, err = NewPKI(config.PKIDir, config.ApplicationURI); err != nil {
+			return nil, err
 		}
-	} else if config.User != "" {
-		password, err := readPassword(config.Passwordfile)
-		if err != nil {
+	}
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	if err = client.connect(); err != nil {
+		var cfgErr configError
+		if errors.As(err, &cfgErr) {
 			return nil, err
 		}
+		klog.Errorf("Connect to %s failed, retry later: %v", config.URL, err)
+	}
+	return client, nil
+}
+
+// selectEndpoint returns the endpoint to connect to. The policy or the mode
+// could be SecurityAuto, then the endpoint with the highest security level is
+// chosen. Secured endpoints are only chosen if the client has a certificate.
+func selectEndpoint(endpoints []*ua.EndpointDescription, policy string, mode string,
+	hasCert bool, tokenType ua.UserTokenType) (*ua.EndpointDescription, error) {
+	candidates := make([]*ua.EndpointDescription, len(endpoints))
+	copy(candidates, endpoints)
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].SecurityLevel > candidates[j].SecurityLevel
+	})
 
-		opts = []opcua.Option{
-			opcua.AuthUsername(config.User, password),
-			opcua.AuthPolicyID("username"),
+	policyURI := ua.FormatSecurityPolicyURI(policy)
+	for _, ep := range candidates {
+		if policy != SecurityAuto && ep.SecurityPolicyURI != policyURI {
+			continue
+		}
+		if mode != SecurityAuto && ep.SecurityMode != ua.MessageSecurityModeFromString(mode) {
+			continue
+		}
+		if ep.SecurityMode != ua.MessageSecurityModeNone && !hasCert {
+			continue
+		}
+		for _, t := range ep.UserIdentityTokens {
+			if t.TokenType == tokenType {
+				return ep, nil
+			}
 		}
-	} else {
-		opts = []opcua.Option{}
 	}
+	return nil, configError{err: fmt.Errorf("no endpoint matches security policy %s and security mode %s",
+		policy, mode)}
+}
 
-	c := opcua.NewClient(config.URL, opts...)
-	if err = c.Connect(ctx); err != nil {
-		return &OPCUAClient{}, err
+// certificate returns the configured client certificate or the one from the
+// PKI directory, which is generated or renewed if necessary.
+func (c *OPCUAClient) certificate() ([]byte, *rsa.PrivateKey, error) {
+	if c.Config.Certfile != "" {
+		return loadKeyPair(c.Config.Certfile, c.Config.Keyfile)
+	}
+	if c.pki != nil {
+		return c.pki.KeyPair()
+	}
+	return nil, nil, nil
+}
+
+// tokenType returns the user identity token type of the configured authentication.
+func (c *OPCUAClient) tokenType() ua.UserTokenType {
+	if c.Config.User != "" {
+		return ua.UserTokenTypeUserName
+	}
+	return ua.UserTokenTypeAnonymous
+}
+
+// options creates the client options for the endpoint.
+func (c *OPCUAClient) options(ep *ua.EndpointDescription, cert []byte, key *rsa.PrivateKey) ([]opcua.Option, error) {
+	opts := []opcua.Option{opcua.SessionTimeout(time.Minute)}
+	if ep.SecurityMode != ua.MessageSecurityModeNone {
+		opts = append(opts, opcua.Certificate(cert), opcua.PrivateKey(key))
+		if c.Config.RemoteCertfile == "" && c.pki != nil {
+			// not a configError, the certificate could be trusted before the next attempt
+			if err := c.pki.VerifyServer(ep.ServerCertificate); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	opts = append(opts, opcua.SecurityFromEndpoint(ep, c.tokenType()))
+	if c.Config.User != "" {
+		password, err := readPassword(c.Config.Passwordfile)
+		if err != nil {
+			return nil, configError{err: err}
+		}
+		opts = append(opts, opcua.AuthUsername(c.Config.User, password))
+	}
+	if c.Config.RemoteCertfile != "" {
+		opts = append(opts, opcua.RemoteCertificateFile(c.Config.RemoteCertfile))
+	}
+	return opts, nil
+}
+
+// connect connects to the server and schedules the next attempt on failure.
+// The caller must hold the lock.
+func (c *OPCUAClient) connect() error {
+	if err := c.dial(); err != nil {
+		c.scheduleRetry()
+		return err
+	}
+	return nil
+}
+
+// dial discovers the endpoints, selects one and connects to it.
+// The previous session is reactivated on the new secure channel if the server
+// still knows it, otherwise a new session is created.
+func (c *OPCUAClient) dial() error {
+	endpoints, err := opcua.GetEndpoints(c.Config.URL)
+	if err != nil {
+		return err
+	}
+	cert, key, err := c.certificate()
+	if err != nil {
+		return configError{err: err}
+	}
+	ep, err := selectEndpoint(endpoints, c.Config.SecurityPolicy, c.Config.SecurityMode, cert != nil, c.tokenType())
+	if err != nil {
+		return err
+	}
+	opts, err := c.options(ep, cert, key)
+	if err != nil {
+		return err
+	}
+	klog.V(2).Infof("Connect to %s with security policy %s, mode %s", c.Config.URL, ep.SecurityPolicyURI, ep.SecurityMode)
+
+	var session *opcua.Session
+	if c.Client != nil {
+		session, _ = c.Client.DetachSession()
+		_ = c.Client.Close()
+		c.Client = nil
+	}
+
+	client := opcua.NewClient(c.Config.URL, opts...)
+	if session != nil {
+		if err = client.Dial(context.Background()); err == nil {
+			if err = client.ActivateSession(session); err == nil {
+				klog.V(1).Infof("Session reactivated on %s", c.Config.URL)
+				c.setConnected(client)
+				return nil
+			}
+			klog.V(2).Infof("Reactivate session failed: %v", err)
+			_ = client.Close()
+		}
+		client = opcua.NewClient(c.Config.URL, opts...)
+	}
+	if err = client.Connect(context.Background()); err != nil {
+		return err
+	}
+	c.setConnected(client)
+	return nil
+}
+
+func (c *OPCUAClient) setConnected(client *opcua.Client) {
+	c.Client = client
+	c.connected = true
+	c.retryInterval = minReconnectInterval
+}
+
+// scheduleRetry doubles the backoff for the next connection attempt.
+func (c *OPCUAClient) scheduleRetry() {
+	c.connected = false
+	c.nextRetry = time.Now().Add(c.retryInterval)
+	c.retryInterval *= 2
+	if c.retryInterval > c.Config.MaxReconnectInterval {
+		c.retryInterval = c.Config.MaxReconnectInterval
+	}
+}
+
+// isConnectionError reports whether the error is caused by a lost secure channel or session.
+func isConnectionError(err error) bool {
+	var status ua.StatusCode
+	if !errors.As(err, &status) {
+		// errors of the transport layer, e.g. io.EOF
+		return true
+	}
+	switch status {
+	case ua.StatusBadSessionIDInvalid, ua.StatusBadSessionClosed, ua.StatusBadSessionNotActivated,
+		ua.StatusBadSecureChannelIDInvalid, ua.StatusBadSecureChannelClosed, ua.StatusBadServerNotConnected,
+		ua.StatusBadNotConnected, ua.StatusBadConnectionClosed, ua.StatusBadCommunicationError,
+		ua.StatusBadTimeout, ua.StatusBadShutdown, ua.StatusBadServerHalted:
+		return true
+	default:
+		return false
+	}
+}
+
+// ensureConnected reconnects if the connection is lost and the backoff has expired.
+// The caller must hold the lock.
+func (c *OPCUAClient) ensureConnected() error {
+	if c.connected {
+		return nil
+	}
+	if time.Now().Before(c.nextRetry) {
+		return ua.StatusBadNotConnected
+	}
+	return c.connect()
+}
+
+// handleError marks the connection as lost if the error requires a reconnection.
+// The caller must hold the lock.
+func (c *OPCUAClient) handleError(err error) {
+	if err != nil && isConnectionError(err) {
+		klog.Errorf("Connection to %s lost: %v", c.Config.URL, err)
+		c.connected = false
+		c.nextRetry = time.Now()
 	}
-	return &OPCUAClient{Client: c}, nil
 }
 
 // GetStatus get device status.
-// Please rewrite this function depending on your devices.
+// The status is derived from the session state, the server state and the
+// ServiceLevel of the server.
 func (c *OPCUAClient) GetStatus() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.pki != nil && c.Config.Certfile == "" && c.connected && c.pki.NeedsRenewal() {
+		klog.V(1).Info("Client certificate expires, reconnect with a renewed certificate")
+		c.connected = false
+	}
+	if err := c.ensureConnected(); err != nil {
+		return common.DEVSTDISCONN
+	}
+
+	req := &ua.ReadRequest{
+		NodesToRead: []*ua.ReadValueID{
+			{NodeID: ua.NewNumericNodeID(0, id.Server_ServerStatus_State), AttributeID: ua.AttributeIDValue},
+			{NodeID: ua.NewNumericNodeID(0, id.Server_ServiceLevel), AttributeID: ua.AttributeIDValue},
+		},
+	}
+	resp, err := c.Client.Read(req)
+	if err != nil {
+		c.handleError(err)
+		if !c.connected {
+			return common.DEVSTDISCONN
+		}
+		return common.DEVSTERR
+	}
+	return healthStatus(resp.Results)
+}
+
+// healthStatus evaluates the server state and the ServiceLevel.
+func healthStatus(results []*ua.DataValue) string {
+	if len(results) != 2 || results[0].Status != ua.StatusOK || results[0].Value == nil {
+		return common.DEVSTUNKNOWN
+	}
+	if state := ua.ServerState(results[0].Value.Int()); state != ua.ServerStateRunning {
+		klog.V(2).Infof("Server state: %v", state)
+		return common.DEVSTUNHEALTHY
+	}
+	// ServiceLevel is optional, the running state is enough without it.
+	if results[1].Status != ua.StatusOK || results[1].Value == nil {
+		return common.DEVSTOK
+	}
+	if level := results[1].Value.Uint(); level < healthyServiceLevel {
+		klog.V(2).Infof("Server service level: %d", level)
+		return common.DEVSTUNHEALTHY
+	}
 	return common.DEVSTOK
 }
 
+// Close closes the session and the connection.
+func (c *OPCUAClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.connected = false
+	if c.Client == nil {
+		return nil
+	}
+	err := c.Client.Close()
+	c.Client = nil
+	return err
+}
+
 func valueToString(v *ua.Variant) string {
 	switch v.Type() {
 	case ua.TypeIDBoolean:
@@ -133,9 +424,15 @@ func (c *OPCUAClient) Get(nodeID string) (results string, err error) {
 		TimestampsToReturn: ua.TimestampsToReturnBoth,
 	}
 
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err = c.ensureConnected(); err != nil {
+		return "", err
+	}
 	resp, err := c.Client.Read(req)
 	if err != nil {
 		klog.Errorf("Read failed: %v", err)
+		c.handleError(err)
 		return "", err
 	}
 	if resp.Results[0].Status != ua.StatusOK {
@@ -172,9 +469,15 @@ func (c *OPCUAClient) Set(nodeID string, value string) (results string, err erro
 		},
 	}
 
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err = c.ensureConnected(); err != nil {
+		return "", err
+	}
 	resp, err := c.Client.Write(req)
 	if err != nil {
 		klog.Errorf("Write failed: %v", err)
+		c.handleError(err)
 		return "", err
 	}
 	klog.V(4).Info("Set node ", nodeID, value)
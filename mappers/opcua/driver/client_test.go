@@ -20,7 +20,14 @@ limitations under the License.
 package driver
 
 import (
+	"errors"
+	"io"
 	"testing"
+
+	"github.com/gopcua/opcua/ua"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kubeedge/mappers-go/mappers/common"
 )
 
 func TestReadWithoutAuth(t *testing.T) {
@@ -98,3 +105,67 @@ func TestWrite(t *testing.T) {
 		fmt.Println("result: ", results)
 	*/
 }
+
+func TestSelectEndpoint(t *testing.T) {
+	anonymous := []*ua.UserTokenPolicy{{TokenType: ua.UserTokenTypeAnonymous}}
+	username := []*ua.UserTokenPolicy{{TokenType: ua.UserTokenTypeUserName}}
+	endpoints := []*ua.EndpointDescription{
+		{SecurityPolicyURI: ua.SecurityPolicyURINone, SecurityMode: ua.MessageSecurityModeNone,
+			SecurityLevel: 0, UserIdentityTokens: anonymous},
+		{SecurityPolicyURI: ua.SecurityPolicyURIBasic256Sha256, SecurityMode: ua.MessageSecurityModeSignAndEncrypt,
+			SecurityLevel: 110, UserIdentityTokens: username},
+		{SecurityPolicyURI: ua.SecurityPolicyURIBasic256Sha256, SecurityMode: ua.MessageSecurityModeSign,
+			SecurityLevel: 100, UserIdentityTokens: append(anonymous, username...)},
+	}
+
+	ep, err := selectEndpoint(endpoints, "None", "None", false, ua.UserTokenTypeAnonymous)
+	assert.Nil(t, err)
+	assert.Equal(t, endpoints[0], ep)
+
+	ep, err = selectEndpoint(endpoints, SecurityAuto, SecurityAuto, true, ua.UserTokenTypeAnonymous)
+	assert.Nil(t, err)
+	assert.Equal(t, endpoints[2], ep)
+
+	ep, err = selectEndpoint(endpoints, SecurityAuto, SecurityAuto, true, ua.UserTokenTypeUserName)
+	assert.Nil(t, err)
+	assert.Equal(t, endpoints[1], ep)
+
+	// Secured endpoints need a client certificate.
+	ep, err = selectEndpoint(endpoints, SecurityAuto, SecurityAuto, false, ua.UserTokenTypeAnonymous)
+	assert.Nil(t, err)
+	assert.Equal(t, endpoints[0], ep)
+
+	_, err = selectEndpoint(endpoints, "Basic256Sha256", "Sign", false, ua.UserTokenTypeAnonymous)
+	var cfgErr configError
+	assert.True(t, errors.As(err, &cfgErr))
+}
+
+func TestIsConnectionError(t *testing.T) {
+	assert.True(t, isConnectionError(io.EOF))
+	assert.True(t, isConnectionError(ua.StatusBadSessionIDInvalid))
+	assert.True(t, isConnectionError(ua.StatusBadSecureChannelClosed))
+	assert.False(t, isConnectionError(ua.StatusBadNodeIDUnknown))
+}
+
+func TestHealthStatus(t *testing.T) {
+	value := func(v interface{}) *ua.DataValue {
+		return &ua.DataValue{Value: ua.MustVariant(v)}
+	}
+	missing := &ua.DataValue{Status: ua.StatusBadNodeIDUnknown}
+
+	assert.Equal(t, common.DEVSTOK, healthStatus([]*ua.DataValue{value(int32(ua.ServerStateRunning)), value(uint8(255))}))
+	assert.Equal(t, common.DEVSTOK, healthStatus([]*ua.DataValue{value(int32(ua.ServerStateRunning)), missing}))
+	assert.Equal(t, common.DEVSTUNHEALTHY, healthStatus([]*ua.DataValue{value(int32(ua.ServerStateRunning)), value(uint8(100))}))
+	assert.Equal(t, common.DEVSTUNHEALTHY, healthStatus([]*ua.DataValue{value(int32(ua.ServerStateSuspended)), value(uint8(255))}))
+	assert.Equal(t, common.DEVSTUNKNOWN, healthStatus([]*ua.DataValue{missing, missing}))
+}
+
+func TestReconnectBackoff(t *testing.T) {
+	c := &OPCUAClient{Config: OPCUAConfig{MaxReconnectInterval: 4 * minReconnectInterval}, retryInterval: minReconnectInterval}
+	for i := 0; i < 4; i++ {
+		c.scheduleRetry()
+	}
+	assert.False(t, c.connected)
+	assert.Equal(t, 4*minReconnectInterval, c.retryInterval)
+	assert.Equal(t, ua.StatusBadNotConnected, c.ensureConnected())
+}
@@ -0,0 +1,217 @@
+/*
+Copyright 2021 The KubeEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gopcua/opcua/ua"
+	"k8s.io/klog/v2"
+)
+
+// MethodCall describes an OPC UA method.
+type MethodCall struct {
+	// ObjectID is the node ID of the object or object type the method belongs to.
+	ObjectID string
+	// MethodID is the node ID of the method.
+	MethodID string
+	// InputArguments are the built-in data types of the input arguments,
+	// e.g. "Int32", "Double", "String".
+	InputArguments []string
+}
+
+// ParseArguments splits a twin value into the method input arguments.
+// A method with one argument takes the value itself, methods with several
+// arguments take a JSON array, e.g. `[1, "batch-7"]`. The value is only a
+// trigger for methods without arguments.
+func ParseArguments(value string, count int) ([]string, error) {
+	switch count {
+	case 0:
+		return nil, nil
+	case 1:
+		if !strings.HasPrefix(strings.TrimSpace(value), "[") {
+			return []string{value}, nil
+		}
+	}
+
+	// Numbers are kept as written, 64-bit integers don't fit in a float64.
+	var values []interface{}
+	decoder := json.NewDecoder(strings.NewReader(value))
+	decoder.UseNumber()
+	if err := decoder.Decode(&values); err != nil {
+		return nil, fmt.Errorf("arguments must be a JSON array: %v", err)
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, errors.New("arguments must be a single JSON array")
+	}
+	args := make([]string, len(values))
+	for i, v := range values {
+		if s, ok := v.(string); ok {
+			args[i] = s
+		} else {
+			args[i] = fmt.Sprint(v)
+		}
+	}
+	return args, nil
+}
+
+// FormatOutput converts the output arguments to one twin value, a single
+// output is returned as is and several outputs as JSON array.
+func FormatOutput(outputs []string) string {
+	switch len(outputs) {
+	case 0:
+		return ""
+	case 1:
+		return outputs[0]
+	default:
+		b, _ := json.Marshal(outputs)
+		return string(b)
+	}
+}
+
+// newVariant converts the string value to a variant of the built-in data type.
+func newVariant(dataType string, value string) (*ua.Variant, error) {
+	var v interface{}
+	var err error
+	switch dataType {
+	case "Boolean":
+		v, err = strconv.ParseBool(value)
+	case "SByte":
+		var i int64
+		i, err = strconv.ParseInt(value, 10, 8)
+		v = int8(i)
+	case "Byte":
+		var u uint64
+		u, err = strconv.ParseUint(value, 10, 8)
+		v = uint8(u)
+	case "Int16":
+		var i int64
+		i, err = strconv.ParseInt(value, 10, 16)
+		v = int16(i)
+	case "UInt16":
+		var u uint64
+		u, err = strconv.ParseUint(value, 10, 16)
+		v = uint16(u)
+	case "Int32":
+		var i int64
+		i, err = strconv.ParseInt(value, 10, 32)
+		v = int32(i)
+	case "UInt32":
+		var u uint64
+		u, err = strconv.ParseUint(value, 10, 32)
+		v = uint32(u)
+	case "Int64":
+		v, err = strconv.ParseInt(value, 10, 64)
+	case "UInt64":
+		v, err = strconv.ParseUint(value, 10, 64)
+	case "Float":
+		var f float64
+		f, err = strconv.ParseFloat(value, 32)
+		v = float32(f)
+	case "Double":
+		v, err = strconv.ParseFloat(value, 64)
+	case "String":
+		v = value
+	case "ByteString":
+		v = []byte(value)
+	case "DateTime":
+		v, err = time.Parse(time.RFC3339, value)
+	default:
+		return nil, fmt.Errorf("unsupported argument type %s", dataType)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s value %s: %v", dataType, value, err)
+	}
+	return ua.NewVariant(v)
+}
+
+// Call calls the method with the input arguments and returns the output arguments.
+// If the server rejects the call, the returned error is the ua.StatusCode.
+func (c *OPCUAClient) Call(method MethodCall, args []string) ([]string, error) {
+	objectID, err := ua.ParseNodeID(method.ObjectID)
+	if err != nil {
+		klog.Errorf("invalid object node id: %v", err)
+		return nil, ua.StatusBadNodeIDInvalid
+	}
+	methodID, err := ua.ParseNodeID(method.MethodID)
+	if err != nil {
+		klog.Errorf("invalid method node id: %v", err)
+		return nil, ua.StatusBadNodeIDInvalid
+	}
+	if len(args) < len(method.InputArguments) {
+		return nil, ua.StatusBadArgumentsMissing
+	}
+	if len(args) > len(method.InputArguments) {
+		return nil, ua.StatusBadTooManyArguments
+	}
+
+	req := &ua.CallMethodRequest{ObjectID: objectID, MethodID: methodID}
+	for i, dataType := range method.InputArguments {
+		v, err := newVariant(dataType, args[i])
+		if err != nil {
+			klog.Errorf("Argument %d: %v", i, err)
+			return nil, ua.StatusBadTypeMismatch
+		}
+		req.InputArguments = append(req.InputArguments, v)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err = c.ensureConnected(); err != nil {
+		return nil, err
+	}
+	resp, err := c.Client.Call(req)
+	if err != nil {
+		klog.Errorf("Call failed: %v", err)
+		c.handleError(err)
+		return nil, err
+	}
+	for i, status := range resp.InputArgumentResults {
+		if status != ua.StatusOK {
+			klog.Errorf("Call %s argument %d rejected: %v", method.MethodID, i, status)
+		}
+	}
+	if resp.StatusCode != ua.StatusOK {
+		return nil, resp.StatusCode
+	}
+
+	outputs := make([]string, len(resp.OutputArguments))
+	for i, v := range resp.OutputArguments {
+		outputs[i] = valueToString(v)
+	}
+	klog.V(4).Infof("Call %s outputs: %v", method.MethodID, outputs)
+	return outputs, nil
+}
+
+// StatusName returns the name of the status code of a call error,
+// e.g. "StatusBadUserAccessDenied".
+func StatusName(err error) string {
+	var status ua.StatusCode
+	if !errors.As(err, &status) {
+		return ua.StatusCodes[ua.StatusBadCommunicationError].Name
+	}
+	if desc, ok := ua.StatusCodes[status]; ok {
+		return desc.Name
+	}
+	return fmt.Sprintf("0x%X", uint32(status))
+}
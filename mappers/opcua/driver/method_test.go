@@ -0,0 +1,95 @@
+/*
+Copyright 2021 The KubeEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/gopcua/opcua/ua"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseArguments(t *testing.T) {
+	args, err := ParseArguments("start", 0)
+	assert.Nil(t, err)
+	assert.Nil(t, args)
+
+	args, err = ParseArguments("batch 7", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"batch 7"}, args)
+
+	args, err = ParseArguments(`[1, "batch-7", true]`, 3)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"1", "batch-7", "true"}, args)
+
+	// 64-bit integers are not rounded through float64.
+	args, err = ParseArguments(`[9007199254740993, 18446744073709551615, -9223372036854775808, 1.25]`, 4)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"9007199254740993", "18446744073709551615", "-9223372036854775808", "1.25"}, args)
+
+	_, err = ParseArguments("1,2", 2)
+	assert.NotNil(t, err)
+	_, err = ParseArguments(`[1, 2] [3]`, 2)
+	assert.NotNil(t, err)
+}
+
+func TestFormatOutput(t *testing.T) {
+	assert.Equal(t, "", FormatOutput(nil))
+	assert.Equal(t, "42", FormatOutput([]string{"42"}))
+	assert.Equal(t, `["42","done"]`, FormatOutput([]string{"42", "done"}))
+}
+
+func TestNewVariant(t *testing.T) {
+	v, err := newVariant("Int32", "-5")
+	assert.Nil(t, err)
+	assert.Equal(t, int32(-5), v.Value())
+
+	v, err = newVariant("Double", "1.5")
+	assert.Nil(t, err)
+	assert.Equal(t, 1.5, v.Value())
+
+	v, err = newVariant("Boolean", "true")
+	assert.Nil(t, err)
+	assert.Equal(t, true, v.Value())
+
+	_, err = newVariant("Byte", "256")
+	assert.NotNil(t, err)
+	_, err = newVariant("Guid", "1")
+	assert.NotNil(t, err)
+}
+
+func TestStatusName(t *testing.T) {
+	assert.Equal(t, "StatusBadUserAccessDenied", StatusName(ua.StatusBadUserAccessDenied))
+	assert.Equal(t, "StatusBadCommunicationError", StatusName(errors.New("EOF")))
+}
+
+func TestCallArguments(t *testing.T) {
+	c := &OPCUAClient{}
+	method := MethodCall{ObjectID: "ns=2;i=1", MethodID: "ns=2;i=2", InputArguments: []string{"Int32"}}
+
+	_, err := c.Call(method, nil)
+	assert.Equal(t, ua.StatusBadArgumentsMissing, err)
+	_, err = c.Call(method, []string{"1", "2"})
+	assert.Equal(t, ua.StatusBadTooManyArguments, err)
+	_, err = c.Call(method, []string{"one"})
+	assert.Equal(t, ua.StatusBadTypeMismatch, err)
+
+	method.MethodID = "ns=a;i=2"
+	_, err = c.Call(method, []string{"1"})
+	assert.Equal(t, ua.StatusBadNodeIDInvalid, err)
+}
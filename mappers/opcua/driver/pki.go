@@ -0,0 +1,254 @@
+/*
+Copyright 2021 The KubeEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+const (
+	defaultCertValidity    = 365 * 24 * time.Hour
+	defaultCertRenewBefore = 30 * 24 * time.Hour
+	certFileName           = "cert.pem"
+	keyFileName            = "key.pem"
+)
+
+// PKI manages the client application instance certificate and the trust list
+// of server certificates in a directory:
+//
+//	own/cert.pem, own/key.pem  the client certificate and private key
+//	trusted/                   trusted server certificates, PEM or DER
+//	rejected/                  server certificates which were not trusted
+type PKI struct {
+	Dir            string
+	ApplicationURI string
+	// Validity is the lifetime of a generated certificate.
+	Validity time.Duration
+	// RenewBefore is the time before expiry when the certificate is renewed.
+	RenewBefore time.Duration
+
+	notAfter time.Time
+}
+
+// NewPKI creates the PKI directory layout.
+func NewPKI(dir string, applicationURI string) (*PKI, error) {
+	if applicationURI == "" {
+		hostname, _ := os.Hostname()
+		applicationURI = fmt.Sprintf("urn:%s:kubeedge:opcua-mapper", hostname)
+	}
+	for _, sub := range []string{"own", "trusted", "rejected"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0700); err != nil {
+			return nil, err
+		}
+	}
+	return &PKI{
+		Dir:            dir,
+		ApplicationURI: applicationURI,
+		Validity:       defaultCertValidity,
+		RenewBefore:    defaultCertRenewBefore,
+	}, nil
+}
+
+// NeedsRenewal reports whether the client certificate expires within RenewBefore.
+func (p *PKI) NeedsRenewal() bool {
+	return time.Now().Add(p.RenewBefore).After(p.notAfter)
+}
+
+// KeyPair returns the DER encoded client certificate and its private key.
+// A new self-signed certificate is generated if none exists or if it needs renewal.
+func (p *PKI) KeyPair() ([]byte, *rsa.PrivateKey, error) {
+	certFile := filepath.Join(p.Dir, "own", certFileName)
+	keyFile := filepath.Join(p.Dir, "own", keyFileName)
+
+	cert, key, err := loadKeyPair(certFile, keyFile)
+	if err == nil {
+		var x509Cert *x509.Certificate
+		if x509Cert, err = x509.ParseCertificate(cert); err != nil {
+			klog.Errorf("Parse client certificate failed, generate a new one: %v", err)
+		} else if !key.PublicKey.Equal(x509Cert.PublicKey) {
+			klog.Errorf("Client certificate %s does not match the private key, generate a new one", certFile)
+		} else {
+			p.notAfter = x509Cert.NotAfter
+			if !p.NeedsRenewal() {
+				return cert, key, nil
+			}
+			klog.V(1).Infof("Client certificate expires at %v, renew it", p.notAfter)
+		}
+	} else if !os.IsNotExist(errors.Unwrap(err)) {
+		klog.Errorf("Load client certificate failed, generate a new one: %v", err)
+	}
+
+	if cert, key, err = p.generate(); err != nil {
+		return nil, nil, err
+	}
+	// Both files are written before either is replaced, a pair which is
+	// still mismatched after a crash is detected and replaced on the next load.
+	keyTmp, certTmp := keyFile+".tmp", certFile+".tmp"
+	if err = ioutil.WriteFile(keyTmp, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key)}), 0600); err != nil {
+		return nil, nil, err
+	}
+	if err = ioutil.WriteFile(certTmp, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert}), 0644); err != nil {
+		os.Remove(keyTmp)
+		return nil, nil, err
+	}
+	if err = os.Rename(keyTmp, keyFile); err != nil {
+		return nil, nil, err
+	}
+	if err = os.Rename(certTmp, certFile); err != nil {
+		return nil, nil, err
+	}
+	klog.V(1).Infof("Generated client certificate %s for %s", certFile, p.ApplicationURI)
+	return cert, key, nil
+}
+
+// generate creates a self-signed application instance certificate.
+func (p *PKI) generate() ([]byte, *rsa.PrivateKey, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+	uri, err := url.Parse(p.ApplicationURI)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid application URI %s: %v", p.ApplicationURI, err)
+	}
+	hostname, _ := os.Hostname()
+
+	now := time.Now()
+	template := x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "KubeEdge OPC UA mapper", Organization: []string{"KubeEdge"}},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(p.Validity),
+		KeyUsage: x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment |
+			x509.KeyUsageKeyEncipherment | x509.KeyUsageDataEncipherment | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		URIs:                  []*url.URL{uri},
+		DNSNames:              []string{hostname},
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	p.notAfter = template.NotAfter
+	return cert, key, nil
+}
+
+// VerifyServer checks that the server certificate is in the trust list.
+// An untrusted certificate is written to the rejected directory, so that it
+// could be trusted by moving it to the trusted directory. The trust list is
+// read on each call, a certificate is trusted from the next connection attempt.
+func (p *PKI) VerifyServer(cert []byte) error {
+	trusted, err := ioutil.ReadDir(filepath.Join(p.Dir, "trusted"))
+	if err != nil {
+		return err
+	}
+	for _, f := range trusted {
+		if f.IsDir() {
+			continue
+		}
+		der, err := readCertificate(filepath.Join(p.Dir, "trusted", f.Name()))
+		if err != nil {
+			klog.Errorf("Skip trusted certificate %s: %v", f.Name(), err)
+			continue
+		}
+		if bytes.Equal(der, cert) {
+			return nil
+		}
+	}
+
+	thumbprint := sha1.Sum(cert)
+	name := filepath.Join(p.Dir, "rejected", hex.EncodeToString(thumbprint[:])+".der")
+	if err = writeFileAtomic(name, cert, 0644); err != nil {
+		klog.Errorf("Write rejected certificate failed: %v", err)
+	}
+	return fmt.Errorf("server certificate is not trusted, move %s to the trusted directory to trust it", name)
+}
+
+// readCertificate reads a PEM or DER encoded certificate.
+func readCertificate(filename string) ([]byte, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if block, _ := pem.Decode(b); block != nil {
+		if block.Type != "CERTIFICATE" {
+			return nil, fmt.Errorf("unexpected PEM block %s", block.Type)
+		}
+		return block.Bytes, nil
+	}
+	return b, nil
+}
+
+// loadKeyPair reads a PEM or DER encoded certificate and RSA private key.
+func loadKeyPair(certFile string, keyFile string) ([]byte, *rsa.PrivateKey, error) {
+	cert, err := readCertificate(certFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load certificate: %w", err)
+	}
+	b, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load private key: %w", err)
+	}
+	if block, _ := pem.Decode(b); block != nil {
+		b = block.Bytes
+	}
+	key, err := x509.ParsePKCS1PrivateKey(b)
+	if err != nil {
+		pkcs8, err8 := x509.ParsePKCS8PrivateKey(b)
+		if err8 != nil {
+			return nil, nil, fmt.Errorf("failed to parse private key: %v", err)
+		}
+		var ok bool
+		if key, ok = pkcs8.(*rsa.PrivateKey); !ok {
+			return nil, nil, errors.New("private key is not a RSA key")
+		}
+	}
+	return cert, key, nil
+}
+
+// writeFileAtomic writes to a temporary file and renames it, so that readers
+// never see a partially written file.
+func writeFileAtomic(filename string, data []byte, perm os.FileMode) error {
+	tmp := filename + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
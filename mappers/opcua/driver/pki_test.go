@@ -0,0 +1,126 @@
+/*
+Copyright 2021 The KubeEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gopcua/opcua/ua"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPKIKeyPair(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pki")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	p, err := NewPKI(dir, "urn:test:mapper")
+	assert.Nil(t, err)
+	cert, key, err := p.KeyPair()
+	assert.Nil(t, err)
+	assert.NotNil(t, key)
+	x509Cert, err := x509.ParseCertificate(cert)
+	assert.Nil(t, err)
+	assert.Equal(t, "urn:test:mapper", x509Cert.URIs[0].String())
+	assert.False(t, p.NeedsRenewal())
+
+	// The stored certificate is reused.
+	again, _, err := p.KeyPair()
+	assert.Nil(t, err)
+	assert.Equal(t, cert, again)
+
+	// A certificate within the renewal period is replaced.
+	p.RenewBefore = 2 * p.Validity
+	assert.True(t, p.NeedsRenewal())
+	renewed, _, err := p.KeyPair()
+	assert.Nil(t, err)
+	assert.NotEqual(t, cert, renewed)
+
+	_, _, err = loadKeyPair(filepath.Join(dir, "own", certFileName), filepath.Join(dir, "own", keyFileName))
+	assert.Nil(t, err)
+
+	// A certificate which does not match the private key is replaced.
+	p.RenewBefore = defaultCertRenewBefore
+	other, _, err := (&PKI{ApplicationURI: "urn:other", Validity: time.Hour}).generate()
+	assert.Nil(t, err)
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "own", certFileName), other, 0644))
+	replaced, key, err := p.KeyPair()
+	assert.Nil(t, err)
+	assert.NotEqual(t, other, replaced)
+	x509Cert, err = x509.ParseCertificate(replaced)
+	assert.Nil(t, err)
+	assert.True(t, key.PublicKey.Equal(x509Cert.PublicKey))
+}
+
+func TestPKIVerifyServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pki")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	p, err := NewPKI(dir, "")
+	assert.Nil(t, err)
+	server, _, err := (&PKI{ApplicationURI: "urn:server", Validity: time.Hour}).generate()
+	assert.Nil(t, err)
+
+	assert.NotNil(t, p.VerifyServer(server))
+	rejected, err := ioutil.ReadDir(filepath.Join(dir, "rejected"))
+	assert.Nil(t, err)
+	assert.Len(t, rejected, 1)
+
+	// Trust the certificate by moving it to the trusted directory.
+	assert.Nil(t, os.Rename(filepath.Join(dir, "rejected", rejected[0].Name()),
+		filepath.Join(dir, "trusted", rejected[0].Name())))
+	assert.Nil(t, p.VerifyServer(server))
+}
+
+func TestUntrustedServerIsRetried(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pki")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	p, err := NewPKI(dir, "")
+	assert.Nil(t, err)
+	cert, key, err := p.KeyPair()
+	assert.Nil(t, err)
+	server, _, err := (&PKI{ApplicationURI: "urn:server", Validity: time.Hour}).generate()
+	assert.Nil(t, err)
+	ep := &ua.EndpointDescription{
+		SecurityPolicyURI: ua.SecurityPolicyURIBasic256Sha256,
+		SecurityMode:      ua.MessageSecurityModeSign,
+		ServerCertificate: server,
+	}
+
+	// An untrusted server is not a configuration error, the client keeps retrying.
+	client := &OPCUAClient{pki: p}
+	_, err = client.options(ep, cert, key)
+	assert.NotNil(t, err)
+	var cfgErr configError
+	assert.False(t, errors.As(err, &cfgErr))
+
+	rejected, err := ioutil.ReadDir(filepath.Join(dir, "rejected"))
+	assert.Nil(t, err)
+	assert.Nil(t, os.Rename(filepath.Join(dir, "rejected", rejected[0].Name()),
+		filepath.Join(dir, "trusted", rejected[0].Name())))
+	_, err = client.options(ep, cert, key)
+	assert.Nil(t, err)
+}
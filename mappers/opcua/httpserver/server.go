@@ -0,0 +1,126 @@
+/*
+Copyright 2021 The KubeEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package httpserver
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gopcua/opcua/ua"
+	"github.com/gorilla/mux"
+	"k8s.io/klog/v2"
+
+	"github.com/kubeedge/mappers-go/mappers/opcua/device"
+	"github.com/kubeedge/mappers-go/mappers/opcua/driver"
+)
+
+// MethodRoute is the route to call the method of a device property.
+const MethodRoute = "/api/v1/device/{id}/method/{property}"
+
+// CallFunc calls the method of a device property.
+type CallFunc func(id string, propertyName string, args []string) ([]string, error)
+
+// MethodRequest is the body of a method call.
+type MethodRequest struct {
+	Arguments []string `json:"arguments,omitempty"`
+}
+
+// MethodResponse is the result of a method call.
+type MethodResponse struct {
+	OutputArguments []string `json:"outputArguments,omitempty"`
+	StatusCode      string   `json:"statusCode"`
+	Message         string   `json:"message,omitempty"`
+}
+
+// NewRouter creates the router of the REST API.
+func NewRouter(call CallFunc) *mux.Router {
+	r := mux.NewRouter()
+	r.HandleFunc(MethodRoute, methodHandler(call)).Methods(http.MethodPost)
+	return r
+}
+
+// Start serves the REST API on the address.
+func Start(address string) {
+	klog.V(1).Infof("Start HTTP server on %s", address)
+	if err := http.ListenAndServe(address, NewRouter(device.CallMethod)); err != nil {
+		klog.Errorf("HTTP server stopped: %v", err)
+	}
+}
+
+func methodHandler(call CallFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		var req MethodRequest
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeResponse(w, http.StatusBadRequest, MethodResponse{
+					StatusCode: driver.StatusName(ua.StatusBadInvalidArgument), Message: err.Error()})
+				return
+			}
+		}
+
+		outputs, err := call(vars["id"], vars["property"], req.Arguments)
+		if err != nil {
+			klog.Errorf("Call method %s of device %s failed: %v", vars["property"], vars["id"], err)
+			code, status := httpStatus(err)
+			writeResponse(w, code, MethodResponse{StatusCode: status, Message: err.Error()})
+			return
+		}
+		writeResponse(w, http.StatusOK, MethodResponse{OutputArguments: outputs,
+			StatusCode: driver.StatusName(ua.StatusOK)})
+	}
+}
+
+// httpStatus maps a call error to the HTTP status code and the OPC UA status name.
+func httpStatus(err error) (int, string) {
+	if errors.Is(err, device.ErrDeviceNotFound) || errors.Is(err, device.ErrPropertyNotFound) {
+		return http.StatusNotFound, driver.StatusName(ua.StatusBadNodeIDUnknown)
+	}
+	if errors.Is(err, device.ErrNotMethod) {
+		return http.StatusBadRequest, driver.StatusName(ua.StatusBadMethodInvalid)
+	}
+
+	var status ua.StatusCode
+	if !errors.As(err, &status) {
+		return http.StatusServiceUnavailable, driver.StatusName(err)
+	}
+	switch status {
+	case ua.StatusBadUserAccessDenied:
+		return http.StatusForbidden, driver.StatusName(err)
+	case ua.StatusBadNodeIDUnknown, ua.StatusBadNodeIDInvalid, ua.StatusBadMethodInvalid:
+		return http.StatusNotFound, driver.StatusName(err)
+	case ua.StatusBadArgumentsMissing, ua.StatusBadTooManyArguments,
+		ua.StatusBadInvalidArgument, ua.StatusBadTypeMismatch:
+		return http.StatusBadRequest, driver.StatusName(err)
+	case ua.StatusBadNotExecutable:
+		return http.StatusConflict, driver.StatusName(err)
+	case ua.StatusBadNotConnected, ua.StatusBadConnectionClosed, ua.StatusBadCommunicationError,
+		ua.StatusBadSecureChannelClosed, ua.StatusBadSessionClosed, ua.StatusBadServerNotConnected:
+		return http.StatusServiceUnavailable, driver.StatusName(err)
+	default:
+		return http.StatusInternalServerError, driver.StatusName(err)
+	}
+}
+
+func writeResponse(w http.ResponseWriter, code int, resp MethodResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		klog.Errorf("Write response failed: %v", err)
+	}
+}
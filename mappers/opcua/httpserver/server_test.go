@@ -0,0 +1,80 @@
+/*
+Copyright 2021 The KubeEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package httpserver
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gopcua/opcua/ua"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kubeedge/mappers-go/mappers/opcua/device"
+)
+
+func TestMethodHandler(t *testing.T) {
+	router := NewRouter(func(id string, propertyName string, args []string) ([]string, error) {
+		switch {
+		case id != "boiler":
+			return nil, device.ErrDeviceNotFound
+		case propertyName == "reset":
+			return nil, ua.StatusBadUserAccessDenied
+		default:
+			return []string{strings.Join(args, "+")}, nil
+		}
+	})
+
+	tests := []struct {
+		url    string
+		body   string
+		code   int
+		status string
+		output []string
+	}{
+		{"/api/v1/device/boiler/method/start", `{"arguments":["1","2"]}`, http.StatusOK, "OK", []string{"1+2"}},
+		{"/api/v1/device/boiler/method/reset", "", http.StatusForbidden, "StatusBadUserAccessDenied", nil},
+		{"/api/v1/device/pump/method/start", "", http.StatusNotFound, "StatusBadNodeIDUnknown", nil},
+		{"/api/v1/device/boiler/method/start", "{", http.StatusBadRequest, "StatusBadInvalidArgument", nil},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, tt.url, strings.NewReader(tt.body)))
+		assert.Equal(t, tt.code, rec.Code, tt.url)
+
+		var resp MethodResponse
+		assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		assert.Equal(t, tt.status, resp.StatusCode)
+		assert.Equal(t, tt.output, resp.OutputArguments)
+	}
+}
+
+func TestHTTPStatus(t *testing.T) {
+	code, _ := httpStatus(ua.StatusBadTypeMismatch)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = httpStatus(ua.StatusBadNotExecutable)
+	assert.Equal(t, http.StatusConflict, code)
+	code, _ = httpStatus(ua.StatusBadNotConnected)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	code, _ = httpStatus(errors.New("EOF"))
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	code, _ = httpStatus(ua.StatusBadInternalError)
+	assert.Equal(t, http.StatusInternalServerError, code)
+}
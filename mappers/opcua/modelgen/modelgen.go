@@ -0,0 +1,155 @@
+/*
+Copyright 2021 The KubeEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package modelgen
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/kubeedge/kubeedge/pkg/apis/devices/v1alpha2"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+
+	"github.com/kubeedge/mappers-go/mappers/opcua/driver"
+)
+
+// Options are the settings of the generated resources.
+type Options struct {
+	ModelName  string
+	DeviceName string
+	Namespace  string
+	// Protocol is the protocol configuration written into the device.
+	Protocol v1alpha2.ProtocolConfigOpcUA
+}
+
+var invalidNameChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// ErrNoProperty error if no variable node is found.
+var ErrNoProperty = errors.New("No variable node found")
+
+// propertyName converts a browse name to a property name.
+func propertyName(name string) string {
+	name = invalidNameChars.ReplaceAllString(strings.ToLower(name), "-")
+	return strings.Trim(name, "-")
+}
+
+// uniqueNames gives every node a property name. The browse name is used if it
+// is unique, otherwise the whole browse path.
+func uniqueNames(nodes []driver.NodeDef) []string {
+	count := make(map[string]int)
+	for _, n := range nodes {
+		count[propertyName(n.BrowseName)]++
+	}
+
+	used := make(map[string]bool)
+	names := make([]string, len(nodes))
+	for i, n := range nodes {
+		name := propertyName(n.BrowseName)
+		if count[name] > 1 || name == "" {
+			name = propertyName(n.Path)
+		}
+		for j, base := 2, name; used[name]; j++ {
+			name = fmt.Sprintf("%s-%d", base, j)
+		}
+		used[name] = true
+		names[i] = name
+	}
+	return names
+}
+
+func propertyType(n driver.NodeDef) v1alpha2.PropertyType {
+	mode := v1alpha2.PropertyAccessMode(n.AccessMode())
+	switch n.DataType {
+	case "int":
+		return v1alpha2.PropertyType{Int: &v1alpha2.PropertyTypeInt64{AccessMode: mode}}
+	case "float":
+		return v1alpha2.PropertyType{Float: &v1alpha2.PropertyTypeFloat{AccessMode: mode}}
+	case "double":
+		return v1alpha2.PropertyType{Double: &v1alpha2.PropertyTypeDouble{AccessMode: mode}}
+	case "boolean":
+		return v1alpha2.PropertyType{Boolean: &v1alpha2.PropertyTypeBoolean{AccessMode: mode}}
+	case "bytes":
+		return v1alpha2.PropertyType{Bytes: &v1alpha2.PropertyTypeBytes{AccessMode: mode}}
+	default:
+		return v1alpha2.PropertyType{String: &v1alpha2.PropertyTypeString{AccessMode: mode}}
+	}
+}
+
+// Generate creates the DeviceModel and the Device for the browsed nodes.
+func Generate(nodes []driver.NodeDef, opts Options) (*v1alpha2.DeviceModel, *v1alpha2.Device, error) {
+	if len(nodes) == 0 {
+		return nil, nil, ErrNoProperty
+	}
+
+	model := &v1alpha2.DeviceModel{
+		TypeMeta: metav1.TypeMeta{APIVersion: v1alpha2.SchemeGroupVersion.String(), Kind: "DeviceModel"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      opts.ModelName,
+			Namespace: opts.Namespace,
+		},
+	}
+	device := &v1alpha2.Device{
+		TypeMeta: metav1.TypeMeta{APIVersion: v1alpha2.SchemeGroupVersion.String(), Kind: "Device"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      opts.DeviceName,
+			Namespace: opts.Namespace,
+			Labels:    map[string]string{"model": opts.ModelName},
+		},
+		Spec: v1alpha2.DeviceSpec{
+			DeviceModelRef: &v1.LocalObjectReference{Name: opts.ModelName},
+			Protocol:       v1alpha2.ProtocolConfig{OpcUA: &opts.Protocol},
+		},
+	}
+
+	for i, name := range uniqueNames(nodes) {
+		model.Spec.Properties = append(model.Spec.Properties, v1alpha2.DeviceProperty{
+			Name:        name,
+			Description: nodes[i].Description,
+			Type:        propertyType(nodes[i]),
+		})
+		device.Spec.PropertyVisitors = append(device.Spec.PropertyVisitors, v1alpha2.DevicePropertyVisitor{
+			PropertyName: name,
+			VisitorConfig: v1alpha2.VisitorConfig{
+				OpcUA: &v1alpha2.VisitorConfigOPCUA{
+					NodeID:     nodes[i].NodeID,
+					BrowseName: nodes[i].BrowseName,
+				},
+			},
+		})
+	}
+	return model, device, nil
+}
+
+// Marshal writes the resources as one multi-document YAML.
+func Marshal(model *v1alpha2.DeviceModel, device *v1alpha2.Device) ([]byte, error) {
+	var buf bytes.Buffer
+	for i, obj := range []interface{}{model, device} {
+		b, err := yaml.Marshal(obj)
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			buf.WriteString("---\n")
+		}
+		buf.Write(b)
+	}
+	return buf.Bytes(), nil
+}
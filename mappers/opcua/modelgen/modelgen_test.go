@@ -0,0 +1,64 @@
+/*
+Copyright 2021 The KubeEdge Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package modelgen
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gopcua/opcua/ua"
+	"github.com/kubeedge/kubeedge/pkg/apis/devices/v1alpha2"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kubeedge/mappers-go/mappers/opcua/driver"
+)
+
+func TestGenerate(t *testing.T) {
+	nodes := []driver.NodeDef{
+		{NodeID: "ns=2;i=2", BrowseName: "Temperature", Path: "Boiler/Temperature", DataType: "double", AccessLevel: ua.AccessLevelTypeCurrentRead},
+		{NodeID: "ns=2;i=3", BrowseName: "Switch", Path: "Boiler/Switch", DataType: "boolean",
+			AccessLevel: ua.AccessLevelTypeCurrentRead | ua.AccessLevelTypeCurrentWrite},
+		{NodeID: "ns=2;i=11", BrowseName: "Temperature", Path: "Pump/Temperature", DataType: "int", AccessLevel: ua.AccessLevelTypeCurrentRead},
+	}
+	opts := Options{ModelName: "boiler-model", DeviceName: "boiler", Namespace: "default",
+		Protocol: v1alpha2.ProtocolConfigOpcUA{URL: "opc.tcp://127.0.0.1:4840"}}
+
+	model, device, err := Generate(nodes, opts)
+	assert.Nil(t, err)
+	assert.Len(t, model.Spec.Properties, 3)
+	assert.Equal(t, "boiler-temperature", model.Spec.Properties[0].Name)
+	assert.Equal(t, v1alpha2.PropertyAccessMode("ReadOnly"), model.Spec.Properties[0].Type.Double.AccessMode)
+	assert.Equal(t, "switch", model.Spec.Properties[1].Name)
+	assert.Equal(t, v1alpha2.PropertyAccessMode("ReadWrite"), model.Spec.Properties[1].Type.Boolean.AccessMode)
+	assert.Equal(t, "pump-temperature", model.Spec.Properties[2].Name)
+	assert.NotNil(t, model.Spec.Properties[2].Type.Int)
+
+	assert.Equal(t, "boiler-model", device.Spec.DeviceModelRef.Name)
+	assert.Equal(t, "switch", device.Spec.PropertyVisitors[1].PropertyName)
+	assert.Equal(t, "ns=2;i=3", device.Spec.PropertyVisitors[1].OpcUA.NodeID)
+
+	data, err := Marshal(model, device)
+	assert.Nil(t, err)
+	docs := strings.Split(string(data), "---\n")
+	assert.Len(t, docs, 2)
+	assert.Contains(t, docs[0], "kind: DeviceModel")
+	assert.Contains(t, docs[1], "kind: Device")
+	assert.Contains(t, docs[1], "nodeID: ns=2;i=11")
+
+	_, _, err = Generate(nil, opts)
+	assert.Equal(t, ErrNoProperty, err)
+}
@@ -0,0 +1,210 @@
+// Package dmitest provides an in-process fake of the EdgeCore DMI server, so
+// that mappers could be tested end to end with go test and without a cluster.
+package dmitest
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+
+	dmiapi "github.com/kubeedge/kubeedge/pkg/apis/dmi/v1alpha1"
+	"github.com/kubeedge/mappers-go/mappers/config"
+)
+
+// EdgeCore is a fake EdgeCore serving the DeviceManagerService on a unix socket.
+// It records the registered mappers and every reported device status.
+type EdgeCore struct {
+	dmiapi.UnimplementedDeviceManagerServiceServer
+
+	// SockPath is the unix socket of the server.
+	SockPath string
+
+	mu      sync.Mutex
+	devices []*dmiapi.Device
+	models  []*dmiapi.DeviceModel
+	mappers []*dmiapi.MapperInfo
+	reports []*dmiapi.ReportDeviceStatusRequest
+	// changed is closed and replaced on every request.
+	changed chan struct{}
+	server  *grpc.Server
+}
+
+// NewEdgeCore starts a fake EdgeCore on a socket in a temporary directory.
+// The server is stopped when the test finishes.
+func NewEdgeCore(t testing.TB) *EdgeCore {
+	t.Helper()
+	e := &EdgeCore{
+		SockPath: filepath.Join(t.TempDir(), "edgecore.sock"),
+		changed:  make(chan struct{}),
+		server:   grpc.NewServer(),
+	}
+	lis, err := net.Listen("unix", e.SockPath)
+	if err != nil {
+		t.Fatalf("failed to listen on %s: %v", e.SockPath, err)
+	}
+	dmiapi.RegisterDeviceManagerServiceServer(e.server, e)
+	go func() {
+		_ = e.server.Serve(lis)
+	}()
+	t.Cleanup(e.server.Stop)
+	return e
+}
+
+// Config returns a mapper configuration connecting to the fake EdgeCore,
+// with the mapper's DMI server on a socket next to it.
+func (e *EdgeCore) Config(protocol string) *config.Config {
+	cfg := &config.Config{}
+	cfg.Common.Name = "test-mapper"
+	cfg.Common.Protocol = protocol
+	cfg.Common.EdgeCoreSock = e.SockPath
+	cfg.GrpcServer.SocketPath = filepath.Join(filepath.Dir(e.SockPath), "mapper.sock")
+	return cfg
+}
+
+// SetDeviceList sets the devices and models returned to mappers registering with data.
+func (e *EdgeCore) SetDeviceList(devices []*dmiapi.Device, models []*dmiapi.DeviceModel) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.devices = devices
+	e.models = models
+}
+
+// MapperRegister records the mapper.
+func (e *EdgeCore) MapperRegister(ctx context.Context, request *dmiapi.MapperRegisterRequest) (*dmiapi.MapperRegisterResponse, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	defer e.notify()
+
+	e.mappers = append(e.mappers, proto.Clone(request.GetMapper()).(*dmiapi.MapperInfo))
+	res := &dmiapi.MapperRegisterResponse{}
+	if request.GetWithData() {
+		res.DeviceList = e.devices
+		res.ModelList = e.models
+	}
+	return res, nil
+}
+
+// ReportDeviceStatus records the device status.
+func (e *EdgeCore) ReportDeviceStatus(ctx context.Context, request *dmiapi.ReportDeviceStatusRequest) (*dmiapi.ReportDeviceStatusResponse, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	defer e.notify()
+
+	e.reports = append(e.reports, proto.Clone(request).(*dmiapi.ReportDeviceStatusRequest))
+	return &dmiapi.ReportDeviceStatusResponse{}, nil
+}
+
+// notify wakes up the waiters, the caller must hold the lock.
+func (e *EdgeCore) notify() {
+	close(e.changed)
+	e.changed = make(chan struct{})
+}
+
+// Mappers returns the registered mappers.
+func (e *EdgeCore) Mappers() []*dmiapi.MapperInfo {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return append([]*dmiapi.MapperInfo(nil), e.mappers...)
+}
+
+// Reports returns all reported device status in order.
+func (e *EdgeCore) Reports() []*dmiapi.ReportDeviceStatusRequest {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return append([]*dmiapi.ReportDeviceStatusRequest(nil), e.reports...)
+}
+
+// Twin returns the last reported twin of the device property.
+func (e *EdgeCore) Twin(deviceName string, propertyName string) (*dmiapi.Twin, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.twin(deviceName, propertyName)
+}
+
+func (e *EdgeCore) twin(deviceName string, propertyName string) (*dmiapi.Twin, bool) {
+	for i := len(e.reports) - 1; i >= 0; i-- {
+		if e.reports[i].GetDeviceName() != deviceName {
+			continue
+		}
+		for _, twin := range e.reports[i].GetReportedDevice().GetTwins() {
+			if twin.GetPropertyName() == propertyName {
+				return twin, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// WaitFor waits until the condition is true, it is checked after every request.
+func (e *EdgeCore) WaitFor(condition func() bool, timeout time.Duration) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		e.mu.Lock()
+		changed := e.changed
+		e.mu.Unlock()
+		if condition() {
+			return true
+		}
+		select {
+		case <-changed:
+		case <-timer.C:
+			return condition()
+		}
+	}
+}
+
+// WaitForTwin waits until the reported value of the device property is the value.
+func (e *EdgeCore) WaitForTwin(deviceName string, propertyName string, value string, timeout time.Duration) error {
+	var last string
+	ok := e.WaitFor(func() bool {
+		twin, found := e.Twin(deviceName, propertyName)
+		if !found {
+			return false
+		}
+		last = twin.GetReported().GetValue()
+		return last == value
+	}, timeout)
+	if !ok {
+		return fmt.Errorf("twin %s of device %s did not reach %q within %v, last reported %q",
+			propertyName, deviceName, value, timeout, last)
+	}
+	return nil
+}
+
+// AssertTwin asserts that the reported value of the device property reaches the value within the timeout.
+func (e *EdgeCore) AssertTwin(t testing.TB, deviceName string, propertyName string, value string, timeout time.Duration) bool {
+	t.Helper()
+	if err := e.WaitForTwin(deviceName, propertyName, value, timeout); err != nil {
+		t.Error(err)
+		return false
+	}
+	return true
+}
+
+// WaitForMapper waits until the mapper of the name is registered.
+func (e *EdgeCore) WaitForMapper(name string, timeout time.Duration) error {
+	ok := e.WaitFor(func() bool {
+		for _, mapper := range e.Mappers() {
+			if mapper.GetName() == name {
+				return true
+			}
+		}
+		return false
+	}, timeout)
+	if !ok {
+		return fmt.Errorf("mapper %s not registered within %v", name, timeout)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package dmitest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	dmiapi "github.com/kubeedge/kubeedge/pkg/apis/dmi/v1alpha1"
+	"github.com/kubeedge/mappers-go/mappers/pkg/util/grpcclient"
+)
+
+func TestEdgeCore(t *testing.T) {
+	edge := NewEdgeCore(t)
+	edge.SetDeviceList([]*dmiapi.Device{{Name: "thermometer"}}, nil)
+	cfg := edge.Config("modbus")
+	grpcclient.Init(cfg)
+
+	devices, _, err := grpcclient.RegisterMapper(cfg, true)
+	assert.Nil(t, err)
+	assert.Len(t, devices, 1)
+	assert.Nil(t, edge.WaitForMapper("test-mapper", time.Second))
+
+	report := func(value string) {
+		assert.Nil(t, grpcclient.ReportDeviceStatus(&dmiapi.ReportDeviceStatusRequest{
+			DeviceName: "thermometer",
+			ReportedDevice: &dmiapi.DeviceStatus{Twins: []*dmiapi.Twin{{
+				PropertyName: "temperature",
+				Reported:     &dmiapi.TwinProperty{Value: value},
+			}}},
+		}))
+	}
+	go func() {
+		report("20")
+		report("21")
+	}()
+	edge.AssertTwin(t, "thermometer", "temperature", "21", time.Second)
+	assert.Len(t, edge.Reports(), 2)
+
+	err = edge.WaitForTwin("thermometer", "temperature", "22", 50*time.Millisecond)
+	assert.EqualError(t, err, `twin temperature of device thermometer did not reach "22" within 50ms, last reported "21"`)
+}
@@ -0,0 +1,127 @@
+package dmitest
+
+import (
+	"context"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+
+	dmiapi "github.com/kubeedge/kubeedge/pkg/apis/dmi/v1alpha1"
+)
+
+// DefaultTimeout is the timeout of the calls to the mapper.
+const DefaultTimeout = 5 * time.Second
+
+// Mapper is a client of the DMI server of a mapper, it pushes the calls EdgeCore does.
+type Mapper struct {
+	client dmiapi.DeviceMapperServiceClient
+}
+
+// DialMapper connects to the DMI server of a mapper, it waits until the socket exists.
+// The connection is closed when the test finishes.
+func DialMapper(t testing.TB, sockPath string) *Mapper {
+	t.Helper()
+	deadline := time.Now().Add(DefaultTimeout)
+	for {
+		if _, err := os.Stat(sockPath); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("mapper socket %s not created within %v", sockPath, DefaultTimeout)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultTimeout)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, sockPath,
+		grpc.WithInsecure(),
+		grpc.WithBlock(),
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", addr)
+		}),
+	)
+	if err != nil {
+		t.Fatalf("failed to connect to mapper %s: %v", sockPath, err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return &Mapper{client: dmiapi.NewDeviceMapperServiceClient(conn)}
+}
+
+func timeout() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), DefaultTimeout)
+}
+
+// CreateDeviceModel creates the device model in the mapper.
+func (m *Mapper) CreateDeviceModel(model *dmiapi.DeviceModel) error {
+	ctx, cancel := timeout()
+	defer cancel()
+	_, err := m.client.CreateDeviceModel(ctx, &dmiapi.CreateDeviceModelRequest{Model: model})
+	return err
+}
+
+// UpdateDeviceModel updates the device model in the mapper.
+func (m *Mapper) UpdateDeviceModel(model *dmiapi.DeviceModel) error {
+	ctx, cancel := timeout()
+	defer cancel()
+	_, err := m.client.UpdateDeviceModel(ctx, &dmiapi.UpdateDeviceModelRequest{Model: model})
+	return err
+}
+
+// RemoveDeviceModel removes the device model from the mapper.
+func (m *Mapper) RemoveDeviceModel(name string) error {
+	ctx, cancel := timeout()
+	defer cancel()
+	_, err := m.client.RemoveDeviceModel(ctx, &dmiapi.RemoveDeviceModelRequest{ModelName: name})
+	return err
+}
+
+// RegisterDevice creates the device in the mapper.
+func (m *Mapper) RegisterDevice(device *dmiapi.Device) error {
+	ctx, cancel := timeout()
+	defer cancel()
+	_, err := m.client.RegisterDevice(ctx, &dmiapi.RegisterDeviceRequest{Device: device})
+	return err
+}
+
+// UpdateDevice updates the device in the mapper.
+func (m *Mapper) UpdateDevice(device *dmiapi.Device) error {
+	ctx, cancel := timeout()
+	defer cancel()
+	_, err := m.client.UpdateDevice(ctx, &dmiapi.UpdateDeviceRequest{Device: device})
+	return err
+}
+
+// RemoveDevice removes the device from the mapper.
+func (m *Mapper) RemoveDevice(name string) error {
+	ctx, cancel := timeout()
+	defer cancel()
+	_, err := m.client.RemoveDevice(ctx, &dmiapi.RemoveDeviceRequest{DeviceName: name})
+	return err
+}
+
+// UpdateDeviceStatus sets the desired twins of the device.
+func (m *Mapper) UpdateDeviceStatus(name string, twins []*dmiapi.Twin) error {
+	ctx, cancel := timeout()
+	defer cancel()
+	_, err := m.client.UpdateDeviceStatus(ctx, &dmiapi.UpdateDeviceStatusRequest{
+		DeviceName:    name,
+		DesiredDevice: &dmiapi.DeviceStatus{Twins: twins},
+	})
+	return err
+}
+
+// GetDevice returns the device status from the mapper.
+func (m *Mapper) GetDevice(name string) (*dmiapi.Device, error) {
+	ctx, cancel := timeout()
+	defer cancel()
+	res, err := m.client.GetDevice(ctx, &dmiapi.GetDeviceRequest{DeviceName: name})
+	if err != nil {
+		return nil, err
+	}
+	return res.GetDevice(), nil
+}
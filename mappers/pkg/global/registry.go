@@ -0,0 +1,72 @@
+package global
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/kubeedge/mappers-go/mappers/pkg/common"
+)
+
+// DevPanelFactory creates the DevPanel of a protocol.
+type DevPanelFactory func() DevPanel
+
+// TwinAccessor returns the twins of a device returned by DevPanel.GetDevice.
+type TwinAccessor func(device interface{}) ([]common.Twin, error)
+
+// Protocol is the DevPanel implementation of a device protocol.
+type Protocol struct {
+	NewDevPanel DevPanelFactory
+	Twins       TwinAccessor
+}
+
+var (
+	protocolsMu sync.RWMutex
+	protocols   = make(map[string]Protocol)
+)
+
+// RegisterProtocol makes the DevPanel of a protocol available to the DMI server.
+// It is called from the init function of the protocol package and panics if
+// the protocol is incomplete or registered twice.
+func RegisterProtocol(name string, protocol Protocol) {
+	protocolsMu.Lock()
+	defer protocolsMu.Unlock()
+
+	if protocol.NewDevPanel == nil || protocol.Twins == nil {
+		panic(fmt.Sprintf("protocol %s: DevPanel factory and twin accessor must not be nil", name))
+	}
+	if _, dup := protocols[name]; dup {
+		panic(fmt.Sprintf("protocol %s registered twice", name))
+	}
+	protocols[name] = protocol
+}
+
+// GetProtocol returns the registered protocol.
+func GetProtocol(name string) (Protocol, error) {
+	protocolsMu.RLock()
+	defer protocolsMu.RUnlock()
+
+	protocol, ok := protocols[name]
+	if !ok {
+		return Protocol{}, fmt.Errorf("unknown device protocol %q, registered protocols: %v, "+
+			"import the protocol package to register it", name, registeredProtocols())
+	}
+	return protocol, nil
+}
+
+// RegisteredProtocols returns the sorted names of the registered protocols.
+func RegisteredProtocols() []string {
+	protocolsMu.RLock()
+	defer protocolsMu.RUnlock()
+
+	return registeredProtocols()
+}
+
+func registeredProtocols() []string {
+	names := make([]string, 0, len(protocols))
+	for name := range protocols {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,33 @@
+package global
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kubeedge/mappers-go/mappers/pkg/common"
+)
+
+func TestRegisterProtocol(t *testing.T) {
+	protocol := Protocol{
+		NewDevPanel: func() DevPanel { return nil },
+		Twins:       func(device interface{}) ([]common.Twin, error) { return nil, nil },
+	}
+	RegisterProtocol("test-protocol", protocol)
+	defer func() {
+		protocolsMu.Lock()
+		delete(protocols, "test-protocol")
+		protocolsMu.Unlock()
+	}()
+
+	_, err := GetProtocol("test-protocol")
+	assert.Nil(t, err)
+	assert.Contains(t, RegisteredProtocols(), "test-protocol")
+
+	_, err = GetProtocol("unknown")
+	assert.EqualError(t, err, `unknown device protocol "unknown", registered protocols: [test-protocol], `+
+		"import the protocol package to register it")
+
+	assert.Panics(t, func() { RegisterProtocol("test-protocol", protocol) })
+	assert.Panics(t, func() { RegisterProtocol("incomplete", Protocol{}) })
+}
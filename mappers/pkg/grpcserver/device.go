@@ -8,7 +8,6 @@ import (
 
 	dmiapi "github.com/kubeedge/kubeedge/pkg/apis/dmi/v1alpha1"
 	"github.com/kubeedge/mappers-go/mappers/pkg/common"
-	"github.com/kubeedge/mappers-go/mappers/pkg/driver/modbus"
 	"github.com/kubeedge/mappers-go/mappers/pkg/util/parse"
 
 	"k8s.io/klog/v2"
@@ -139,18 +138,16 @@ func (s *Server) UpdateDeviceStatus(ctx context.Context, request *dmiapi.UpdateD
 		return nil, err
 	}
 
+	srcTwins, err := s.twins(device)
+	if err != nil {
+		return nil, err
+	}
 	// only can update twin property desired value
-	switch s.cfg.Protocol {
-	case common.ProtocolModbus:
-		d := device.(*modbus.ModbusDev)
-		twins, err := parse.ConvGrpcToTwins(deviceStatus.Twins, d.Instance.Twins)
-		if err != nil {
-			return nil, err
-		}
-		return nil, s.devPanel.UpdateDevTwins(request.GetDeviceName(), twins)
-	default:
-		return nil, fmt.Errorf("current mapper only support protocol %s's device", s.cfg.Protocol)
+	twins, err := parse.ConvGrpcToTwins(deviceStatus.Twins, srcTwins)
+	if err != nil {
+		return nil, err
 	}
+	return &dmiapi.UpdateDeviceStatusResponse{}, s.devPanel.UpdateDevTwins(request.GetDeviceName(), twins)
 }
 
 func (s *Server) GetDevice(ctx context.Context, request *dmiapi.GetDeviceRequest) (*dmiapi.GetDeviceResponse, error) {
@@ -167,17 +164,15 @@ func (s *Server) GetDevice(ctx context.Context, request *dmiapi.GetDeviceRequest
 			Status: &dmiapi.DeviceStatus{},
 		},
 	}
-	switch s.cfg.Protocol {
-	case common.ProtocolModbus:
-		d := device.(*modbus.ModbusDev)
-		twins, err := parse.ConvTwinsToGrpc(d.Instance.Twins)
-		if err != nil {
-			return nil, err
-		}
-		res.Device.Status.Twins = twins
-		res.Device.Status.State = common.DEVSTOK
-	default:
-		return nil, fmt.Errorf("current mapper only support protocol %s's device", s.cfg.Protocol)
+	srcTwins, err := s.twins(device)
+	if err != nil {
+		return nil, err
+	}
+	twins, err := parse.ConvTwinsToGrpc(srcTwins)
+	if err != nil {
+		return nil, err
 	}
+	res.Device.Status.Twins = twins
+	res.Device.Status.State = common.DEVSTOK
 	return res, nil
 }
@@ -10,8 +10,6 @@ import (
 	"k8s.io/klog/v2"
 
 	dmiapi "github.com/kubeedge/kubeedge/pkg/apis/dmi/v1alpha1"
-	modbusdevice "github.com/kubeedge/mappers-go/mappers/modbus-dmi/device"
-	"github.com/kubeedge/mappers-go/mappers/pkg/common"
 	"github.com/kubeedge/mappers-go/mappers/pkg/global"
 )
 
@@ -23,25 +21,21 @@ type Config struct {
 type Server struct {
 	cfg      Config
 	devPanel global.DevPanel
+	twins    global.TwinAccessor
 }
 
-func NewServer(cfg Config) Server {
-	s := Server{cfg: cfg}
-	switch cfg.Protocol {
-	case common.ProtocolModbus:
-		s.devPanel = modbusdevice.NewDevPanel()
-	case common.ProtocolBlueTooth:
-		// TODO
-	case common.ProtocolOpcua:
-		// TODO
-	case common.ProtocolOnvif:
-		// TODO
-	case common.ProtocolCustomized:
-		// TODO
-	default:
-		klog.Fatalf("unknown device protocol %s for grpc server", cfg.Protocol)
+// NewServer creates the DMI server of the protocol. The protocol must be
+// registered with global.RegisterProtocol, usually by importing its device package.
+func NewServer(cfg Config) (Server, error) {
+	protocol, err := global.GetProtocol(cfg.Protocol)
+	if err != nil {
+		return Server{}, fmt.Errorf("failed to create grpc server: %v", err)
 	}
-	return s
+	return Server{
+		cfg:      cfg,
+		devPanel: protocol.NewDevPanel(),
+		twins:    protocol.Twins,
+	}, nil
 }
 
 func (s *Server) Start() error {
@@ -0,0 +1,119 @@
+package grpcserver
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	dmiapi "github.com/kubeedge/kubeedge/pkg/apis/dmi/v1alpha1"
+	"github.com/kubeedge/mappers-go/mappers/config"
+	"github.com/kubeedge/mappers-go/mappers/pkg/common"
+	"github.com/kubeedge/mappers-go/mappers/pkg/global"
+)
+
+type fakeDevice struct {
+	twins []common.Twin
+}
+
+// fakePanel is a DevPanel of devices which only have twins.
+type fakePanel struct {
+	devices map[string]*fakeDevice
+	models  map[string]common.DeviceModel
+}
+
+func (p *fakePanel) DevStart()                        {}
+func (p *fakePanel) DevInit(cfg *config.Config) error { return nil }
+func (p *fakePanel) UpdateDev(model *common.DeviceModel, device *common.DeviceInstance, protocol *common.Protocol) {
+	p.devices[device.ID] = &fakeDevice{twins: device.Twins}
+	p.models[model.Name] = *model
+}
+func (p *fakePanel) UpdateDevTwins(deviceID string, twins []common.Twin) error {
+	d, ok := p.devices[deviceID]
+	if !ok {
+		return fmt.Errorf("device %s not found", deviceID)
+	}
+	d.twins = twins
+	return nil
+}
+func (p *fakePanel) DealDeviceTwinGet(deviceID string, twinName string) (interface{}, error) {
+	return nil, nil
+}
+func (p *fakePanel) GetDevice(deviceID string) (interface{}, error) {
+	d, ok := p.devices[deviceID]
+	if !ok {
+		return nil, fmt.Errorf("device %s not found", deviceID)
+	}
+	return d, nil
+}
+func (p *fakePanel) RemoveDevice(deviceID string) error {
+	delete(p.devices, deviceID)
+	return nil
+}
+func (p *fakePanel) GetModel(modelName string) (common.DeviceModel, error) {
+	m, ok := p.models[modelName]
+	if !ok {
+		return common.DeviceModel{}, fmt.Errorf("model %s not found", modelName)
+	}
+	return m, nil
+}
+func (p *fakePanel) UpdateModel(model *common.DeviceModel) { p.models[model.Name] = *model }
+func (p *fakePanel) RemoveModel(modelName string)          { delete(p.models, modelName) }
+
+var panel = &fakePanel{
+	devices: map[string]*fakeDevice{
+		"thermometer": {twins: []common.Twin{{
+			PropertyName: "temperature",
+			Desired:      common.DesiredData{Value: "20", Metadatas: common.Metadata{Type: "int"}},
+			Reported:     common.ReportedData{Value: "21", Metadatas: common.Metadata{Type: "int"}},
+		}}},
+	},
+	models: map[string]common.DeviceModel{},
+}
+
+func init() {
+	global.RegisterProtocol("fake-protocol", global.Protocol{
+		NewDevPanel: func() global.DevPanel { return panel },
+		Twins: func(device interface{}) ([]common.Twin, error) {
+			return device.(*fakeDevice).twins, nil
+		},
+	})
+}
+
+func TestNewServer(t *testing.T) {
+	_, err := NewServer(Config{Protocol: "unknown"})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "fake-protocol")
+
+	s, err := NewServer(Config{Protocol: "fake-protocol"})
+	assert.Nil(t, err)
+	assert.Equal(t, panel, s.devPanel)
+}
+
+func TestDeviceStatus(t *testing.T) {
+	s, err := NewServer(Config{Protocol: "fake-protocol"})
+	assert.Nil(t, err)
+	ctx := context.Background()
+
+	res, err := s.GetDevice(ctx, &dmiapi.GetDeviceRequest{DeviceName: "thermometer"})
+	assert.Nil(t, err)
+	assert.Equal(t, "21", res.Device.Status.Twins[0].Reported.Value)
+
+	_, err = s.UpdateDeviceStatus(ctx, &dmiapi.UpdateDeviceStatusRequest{
+		DeviceName: "thermometer",
+		DesiredDevice: &dmiapi.DeviceStatus{Twins: []*dmiapi.Twin{{
+			PropertyName: "temperature",
+			Desired:      &dmiapi.TwinProperty{Value: "25"},
+			Reported:     &dmiapi.TwinProperty{Value: "21"},
+		}}},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "25", panel.devices["thermometer"].twins[0].Desired.Value)
+
+	_, err = s.ReportDeviceStatus(ctx, &dmiapi.ReportDeviceStatusRequest{DeviceName: "thermometer"})
+	assert.Nil(t, err)
+
+	_, err = s.GetDevice(ctx, &dmiapi.GetDeviceRequest{DeviceName: "unknown"})
+	assert.NotNil(t, err)
+}
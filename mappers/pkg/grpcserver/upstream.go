@@ -7,8 +7,6 @@ import (
 	"k8s.io/klog/v2"
 
 	dmiapi "github.com/kubeedge/kubeedge/pkg/apis/dmi/v1alpha1"
-	"github.com/kubeedge/mappers-go/mappers/pkg/common"
-	"github.com/kubeedge/mappers-go/mappers/pkg/driver/modbus"
 )
 
 func (s *Server) ReportDeviceStatus(ctx context.Context, request *dmiapi.ReportDeviceStatusRequest) (*dmiapi.ReportDeviceStatusResponse, error) {
@@ -19,41 +17,32 @@ func (s *Server) ReportDeviceStatus(ctx context.Context, request *dmiapi.ReportD
 	if err != nil {
 		return nil, err
 	}
-	reportedTwins := make([]*dmiapi.Twin, 0)
-	switch s.cfg.Protocol {
-	case common.ProtocolModbus:
-		d := device.(*modbus.ModbusDev)
-		for _, twin := range d.Instance.Twins {
-			cur := &dmiapi.Twin{
-				PropertyName: twin.PropertyName,
-				Desired: &dmiapi.TwinProperty{
-					Value: twin.Desired.Value,
-					Metadata: map[string]string{
-						"type":      twin.Desired.Metadatas.Type,
-						"timestamp": twin.Desired.Metadatas.Timestamp,
-					},
+	twins, err := s.twins(device)
+	if err != nil {
+		return nil, err
+	}
+	reportedTwins := make([]*dmiapi.Twin, 0, len(twins))
+	for _, twin := range twins {
+		cur := &dmiapi.Twin{
+			PropertyName: twin.PropertyName,
+			Desired: &dmiapi.TwinProperty{
+				Value: twin.Desired.Value,
+				Metadata: map[string]string{
+					"type":      twin.Desired.Metadatas.Type,
+					"timestamp": twin.Desired.Metadatas.Timestamp,
 				},
-				Reported: &dmiapi.TwinProperty{
-					Value: twin.Reported.Value,
-					Metadata: map[string]string{
-						"type":      twin.Reported.Metadatas.Type,
-						"timestamp": twin.Reported.Metadatas.Timestamp,
-					},
+			},
+			Reported: &dmiapi.TwinProperty{
+				Value: twin.Reported.Value,
+				Metadata: map[string]string{
+					"type":      twin.Reported.Metadatas.Type,
+					"timestamp": twin.Reported.Metadatas.Timestamp,
 				},
-			}
-			reportedTwins = append(reportedTwins, cur)
+			},
 		}
-	case common.ProtocolBlueTooth:
-		// TODO
-	case common.ProtocolOpcua:
-		// TODO
-	case common.ProtocolOnvif:
-		// TODO
-	case common.ProtocolCustomized:
-		// TODO
-	default:
-		klog.Fatalf("unknown device protocol %s for grpc server", s.cfg.Protocol)
+		reportedTwins = append(reportedTwins, cur)
 	}
+	klog.V(4).Infof("report %d twins of device %s", len(reportedTwins), request.GetDeviceName())
 
 	// TODO report to edgecore
 	return &dmiapi.ReportDeviceStatusResponse{}, nil
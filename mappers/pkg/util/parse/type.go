@@ -334,23 +334,35 @@ func ConvGrpcToTwins(twins []*dmiapi.Twin, srcTwins []common.Twin) ([]common.Twi
 func ConvMsgTwinToGrpc(msgTwin map[string]*common.MsgTwin) []*dmiapi.Twin {
 	var twins []*dmiapi.Twin
 	for name, twin := range msgTwin {
+		var valueType string
+		if twin.Metadata != nil {
+			valueType = twin.Metadata.Type
+		}
 		twinData := &dmiapi.Twin{
 			PropertyName: name,
-			Desired: &dmiapi.TwinProperty{
-				Value: *twin.Expected.Value,
-				Metadata: map[string]string{
-					"type":      twin.Metadata.Type,
-					"timestamp": twin.Expected.Metadata.Timestamp,
-				}},
-			Reported: &dmiapi.TwinProperty{
-				Value: *twin.Actual.Value,
-				Metadata: map[string]string{
-					"type":      twin.Metadata.Type,
-					"timestamp": twin.Actual.Metadata.Timestamp,
-				}},
+			Desired:      convTwinValueToGrpc(twin.Expected, valueType),
+			Reported:     convTwinValueToGrpc(twin.Actual, valueType),
 		}
 		twins = append(twins, twinData)
 	}
 
 	return twins
 }
+
+// convTwinValueToGrpc converts the twin value, the twin update message of
+// a mapper usually only carries the actual value.
+func convTwinValueToGrpc(value *common.TwinValue, valueType string) *dmiapi.TwinProperty {
+	property := &dmiapi.TwinProperty{
+		Metadata: map[string]string{
+			"type": valueType,
+		},
+	}
+	if value == nil {
+		return property
+	}
+	if value.Value != nil {
+		property.Value = *value.Value
+	}
+	property.Metadata["timestamp"] = value.Metadata.Timestamp
+	return property
+}
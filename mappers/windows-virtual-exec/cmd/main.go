@@ -38,7 +38,7 @@ func main() {
 	}
 
 	store.InitDB("internal.db")
-	if err := store.DB.AutoMigrate(&model.Mission{}); err != nil {
+	if err := store.DB.AutoMigrate(&model.Mission{}, &model.MissionRun{}); err != nil {
 		klog.Errorf("Failed to init db: %v", err)
 	}
 
@@ -52,6 +52,11 @@ func main() {
 		klog.Fatal(err)
 	}
 
+	missions.InitOutput(c.Output)
+	missions.InitHistory(c.History)
+	if err := missions.InitSandbox(c.Sandbox); err != nil {
+		klog.Fatal(err)
+	}
 	missions.InitCallback(c.NodeName)
 	klog.Info("Start to subscribe")
 	missions.InitMissions(c.NodeName)
@@ -24,8 +24,11 @@ import (
 
 // Config is the Exec mapper configuration.
 type Config struct {
-	Mqtt     Mqtt   `yaml:"mqtt,omitempty"`
-	NodeName string `yaml:"nodeName"`
+	Mqtt     Mqtt    `yaml:"mqtt,omitempty"`
+	NodeName string  `yaml:"nodeName"`
+	Output   Output  `yaml:"output,omitempty"`
+	History  History `yaml:"history,omitempty"`
+	Sandbox  Sandbox `yaml:"sandbox,omitempty"`
 }
 
 // Mqtt is the Mqtt configuration.
@@ -37,6 +40,54 @@ type Mqtt struct {
 	PrivateKey    string `yaml:"privatekey,omitempty"`
 }
 
+// Output is the configuration of the output of missions.
+type Output struct {
+	// MaxSize is the maximum bytes of stdout and of stderr kept for a mission, the rest is truncated.
+	MaxSize int `yaml:"maxSize,omitempty"`
+	// ChunkSize is the maximum bytes of output published in a data message.
+	ChunkSize int `yaml:"chunkSize,omitempty"`
+	// Interval is the interval of the output publication in milliseconds.
+	Interval int `yaml:"interval,omitempty"`
+}
+
+// History is the configuration of the run history of missions.
+type History struct {
+	// MaxRuns is the number of runs kept for each mission.
+	MaxRuns int `yaml:"maxRuns,omitempty"`
+	// ReportedRuns is the number of last runs reported by the history property.
+	ReportedRuns int `yaml:"reportedRuns,omitempty"`
+}
+
+// Sandbox is the configuration of the guardrails of missions.
+type Sandbox struct {
+	// WorkingRoots are the directories which contain the working directories of missions, any directory if empty.
+	WorkingRoots []string `yaml:"workingRoots,omitempty"`
+	// MissionRoot is the directory of the working directories of missions, named after the missions. It must be
+	// in the working roots, it's the first working root by default, or tmp without working roots.
+	MissionRoot string `yaml:"missionRoot,omitempty"`
+	// PublicKey is the PEM file of an ed25519 public key, file contents must be signed by its private key if it's set.
+	PublicKey string `yaml:"publicKey,omitempty"`
+	// RequireChecksum requires the SHA-256 checksum of file contents.
+	RequireChecksum bool `yaml:"requireChecksum,omitempty"`
+	// Commands are regular expressions matching the whole commands which can be run, any command if empty.
+	Commands []string `yaml:"commands,omitempty"`
+	// User runs the commands, the user of the mapper if empty.
+	User string `yaml:"user,omitempty"`
+	// Password of the user, only on windows.
+	Password string `yaml:"password,omitempty"`
+	Limits   Limits `yaml:"limits,omitempty"`
+}
+
+// Limits are the resource limits of the commands of missions, no limit if 0.
+type Limits struct {
+	// CPUTime is the CPU time in seconds.
+	CPUTime int `yaml:"cpuTime,omitempty"`
+	// Memory is the memory in megabytes.
+	Memory int `yaml:"memory,omitempty"`
+	// OutputSize is the size in bytes of stdout and stderr, the command is killed once it's exceeded.
+	OutputSize int `yaml:"outputSize,omitempty"`
+}
+
 // ErrConfigCert error of certification configuration.
 var ErrConfigCert = errors.New("Both certification and private key must be provided")
 
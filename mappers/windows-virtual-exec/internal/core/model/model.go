@@ -13,12 +13,33 @@ limitations under the License.
 
 package model
 
+import "time"
+
 type Mission struct {
 	UniqueName       string `gorm:"primaryKey"`
 	Command          string
 	FileContent      string
 	FileName         string
 	WorkingDirectory string
+	Shell            string
+	Timeout          int
+	Schedule         string
+	RunRequest       string
+	Checksum         string
+	Signature        string
 	Status           string
 	Output           string
+	ExitCode         int
+}
+
+// MissionRun is a run of a mission
+type MissionRun struct {
+	ID         uint   `gorm:"primaryKey"`
+	UniqueName string `gorm:"index"`
+	Trigger    string
+	StartTime  time.Time
+	EndTime    time.Time
+	Status     string
+	ExitCode   int
+	Output     string
 }
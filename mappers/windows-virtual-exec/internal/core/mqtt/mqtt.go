@@ -41,6 +41,8 @@ const (
 	TopicRecModeDeviceListResponse = "$hw/events/node/%s/membership/get/result"
 
 	TopicRecNodeDeviceUpdate = "$hw/events/node/%s/membership/updated"
+
+	TopicPubDataUpdate = "$ke/events/device/%s/data/update"
 )
 
 var client *Client
@@ -49,6 +51,11 @@ func GetClient() *Client {
 	return client
 }
 
+// SetClient replace the client of the mapper, such as with a client which is already connected
+func SetClient(c *Client) {
+	client = c
+}
+
 // MqttClient is parameters for Mqtt client.
 type Client struct {
 	Qos        byte
@@ -170,6 +177,21 @@ func CreateMessageTwinUpdate(info map[string]string) (msg []byte, err error) {
 	return
 }
 
+// CreateMessageData create device data message.
+func CreateMessageData(name string, valueType string, value string) (msg []byte, err error) {
+	var dataMsg dto.DeviceData
+
+	dataMsg.BaseMessage.Timestamp = getTimestamp()
+	dataMsg.Data = map[string]*dto.DataValue{}
+	dataMsg.Data[name] = &dto.DataValue{}
+	dataMsg.Data[name].Value = value
+	dataMsg.Data[name].Metadata.Type = valueType
+	dataMsg.Data[name].Metadata.Timestamp = getTimestamp()
+
+	msg, err = json.Marshal(dataMsg)
+	return
+}
+
 // CreateMessageState create device status message.
 func CreateMessageState(state string) (msg []byte, err error) {
 	var stateMsg dto.DeviceStatusUpdate
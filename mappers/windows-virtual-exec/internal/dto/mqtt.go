@@ -61,6 +61,21 @@ type DeviceTwinDelta struct {
 	Delta map[string]string   `json:"delta"`
 }
 
+type DataMetadata struct {
+	Timestamp int64  `json:"timestamp"`
+	Type      string `json:"type"`
+}
+
+type DataValue struct {
+	Value    string       `json:"value"`
+	Metadata DataMetadata `json:"metadata"`
+}
+
+type DeviceData struct {
+	BaseMessage
+	Data map[string]*DataValue `json:"data"`
+}
+
 type MsgAttr struct {
 	Value    string        `json:"value"`
 	Optional *bool         `json:"optional,omitempty"`
@@ -96,6 +111,12 @@ type MissionDelta struct {
 		ExecCommand     *MsgTwin `json:"exec-command"`
 		ExecFileName    *MsgTwin `json:"exec-file-name"`
 		ExecFileContent *MsgTwin `json:"exec-file-content"`
+		ExecShell       *MsgTwin `json:"exec-shell"`
+		ExecTimeout     *MsgTwin `json:"exec-timeout"`
+		ExecSchedule    *MsgTwin `json:"exec-schedule"`
+		ExecRun         *MsgTwin `json:"exec-run"`
+		ExecFileSHA256  *MsgTwin `json:"exec-file-sha256"`
+		ExecFileSign    *MsgTwin `json:"exec-file-signature"`
 		Output          *MsgTwin `json:"output"`
 		Status          *MsgTwin `json:"status"`
 	} `json:"twin"`
@@ -103,6 +124,12 @@ type MissionDelta struct {
 		ExecCommand     string `json:"exec-command"`
 		ExecFileName    string `json:"exec-file-name"`
 		ExecFileContent string `json:"exec-file-content"`
+		ExecShell       string `json:"exec-shell"`
+		ExecTimeout     string `json:"exec-timeout"`
+		ExecSchedule    string `json:"exec-schedule"`
+		ExecRun         string `json:"exec-run"`
+		ExecFileSHA256  string `json:"exec-file-sha256"`
+		ExecFileSign    string `json:"exec-file-signature"`
 		Output          string `json:"output"`
 		Status          string `json:"status"`
 	} `json:"delta"`
@@ -114,6 +141,12 @@ type MissionTwins struct {
 		ExecCommand     *MsgTwin `json:"exec-command"`
 		ExecFileName    *MsgTwin `json:"exec-file-name"`
 		ExecFileContent *MsgTwin `json:"exec-file-content"`
+		ExecShell       *MsgTwin `json:"exec-shell"`
+		ExecTimeout     *MsgTwin `json:"exec-timeout"`
+		ExecSchedule    *MsgTwin `json:"exec-schedule"`
+		ExecRun         *MsgTwin `json:"exec-run"`
+		ExecFileSHA256  *MsgTwin `json:"exec-file-sha256"`
+		ExecFileSign    *MsgTwin `json:"exec-file-signature"`
 		Output          *MsgTwin `json:"output"`
 		Status          *MsgTwin `json:"status"`
 	} `json:"twin"`
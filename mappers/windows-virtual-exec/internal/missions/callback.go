@@ -16,7 +16,7 @@ package missions
 import (
 	"encoding/json"
 	"fmt"
-	"path"
+	"strconv"
 
 	mq "github.com/eclipse/paho.mqtt.golang"
 	klog "k8s.io/klog/v2"
@@ -120,6 +120,17 @@ func onTwinDelta(_ mq.Client, message mq.Message) {
 		return
 	}
 
+	// the desired status cancelled cancel the mission, until the mission reports it
+	if req.Delta.Status == StatusCancelled {
+		CancelMission(id)
+		return
+	}
+	// a new desired value of exec-run run the mission again
+	if req.Delta.ExecRun != "" {
+		RerunMission(id, req.Delta.ExecRun)
+		return
+	}
+
 	// check params
 	if req.Twin.ExecCommand == nil || req.Twin.ExecFileName == nil || req.Twin.ExecFileContent == nil {
 		klog.Error("Twin format error")
@@ -182,12 +193,52 @@ func onTwinInfo(_ mq.Client, message mq.Message) {
 		return
 	}
 
+	// exec-shell is optional, the default shell of the platform is used without it
+	var shell string
+	if req.Twin.ExecShell != nil && req.Twin.ExecShell.Expected != nil && req.Twin.ExecShell.Expected.Value != nil {
+		shell = *req.Twin.ExecShell.Expected.Value
+	}
+	// exec-timeout is optional too, in seconds, the command isn't limited without it
+	var timeout int
+	if req.Twin.ExecTimeout != nil && req.Twin.ExecTimeout.Expected != nil && req.Twin.ExecTimeout.Expected.Value != nil &&
+		*req.Twin.ExecTimeout.Expected.Value != "" {
+		var err error
+		if timeout, err = strconv.Atoi(*req.Twin.ExecTimeout.Expected.Value); err != nil || timeout < 0 {
+			klog.Error("Twin ExecTimeout format error: ", *req.Twin.ExecTimeout.Expected.Value)
+			return
+		}
+	}
+	// scheduled missions run at the times of the cron schedule in exec-schedule, instead of once created
+	var schedule string
+	if req.Twin.ExecSchedule != nil && req.Twin.ExecSchedule.Expected != nil && req.Twin.ExecSchedule.Expected.Value != nil {
+		schedule = *req.Twin.ExecSchedule.Expected.Value
+	}
+	// the run requested by exec-run when the mission is created is the first one
+	var runRequest string
+	if req.Twin.ExecRun != nil && req.Twin.ExecRun.Expected != nil && req.Twin.ExecRun.Expected.Value != nil {
+		runRequest = *req.Twin.ExecRun.Expected.Value
+	}
+	// the checksum and the signature of the file content are verified before it's run
+	var checksum, signature string
+	if req.Twin.ExecFileSHA256 != nil && req.Twin.ExecFileSHA256.Expected != nil && req.Twin.ExecFileSHA256.Expected.Value != nil {
+		checksum = *req.Twin.ExecFileSHA256.Expected.Value
+	}
+	if req.Twin.ExecFileSign != nil && req.Twin.ExecFileSign.Expected != nil && req.Twin.ExecFileSign.Expected.Value != nil {
+		signature = *req.Twin.ExecFileSign.Expected.Value
+	}
+
 	_, err := NewMission(MissionConfig{
 		UniqueName:       id,
 		Command:          *req.Twin.ExecCommand.Expected.Value,
 		FileContent:      *req.Twin.ExecFileContent.Expected.Value,
 		FileName:         *req.Twin.ExecFileName.Expected.Value,
-		WorkingDirectory: path.Join("tmp", id),
+		WorkingDirectory: sandbox.workingDirectory(id),
+		Shell:            shell,
+		Timeout:          timeout,
+		Schedule:         schedule,
+		RunRequest:       runRequest,
+		Checksum:         checksum,
+		Signature:        signature,
 	})
 	if err != nil {
 		klog.Error("NewMission error: ", err)
@@ -0,0 +1,89 @@
+/*
+Copyright 2024 The KubeEdge Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package missions
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	mq "github.com/eclipse/paho.mqtt.golang"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kubeedge/mappers-go/mappers/windows-virtual-exec/internal/config"
+	"github.com/kubeedge/mappers-go/mappers/windows-virtual-exec/internal/core/mqtt"
+	"github.com/kubeedge/mappers-go/mappers/windows-virtual-exec/internal/dto"
+)
+
+// fakeMessage is a message received from MQTT
+type fakeMessage struct {
+	mq.Message
+	topic   string
+	payload []byte
+}
+
+func (m *fakeMessage) Topic() string   { return m.topic }
+func (m *fakeMessage) Payload() []byte { return m.payload }
+
+// twinInfo get the twins of a mission, with the expected values of twins
+func twinInfo(t *testing.T, id string, twins map[string]string) mq.Message {
+	result := dto.DeviceTwinResult{Twin: map[string]*dto.MsgTwin{}}
+	for name, value := range twins {
+		value := value
+		result.Twin[name] = &dto.MsgTwin{Expected: &dto.TwinValue{Value: &value}}
+	}
+	payload, err := json.Marshal(result)
+	require.NoError(t, err)
+	return &fakeMessage{topic: fmt.Sprintf(mqtt.TopicRecTwinInfoResponse, id), payload: payload}
+}
+
+func TestTwinInfoWorkingDirectory(t *testing.T) {
+	setup(t)
+	root := t.TempDir()
+	twins := map[string]string{
+		"exec-command":      "sh run.sh",
+		"exec-file-name":    "run.sh",
+		"exec-file-content": base64.StdEncoding.EncodeToString([]byte("echo hello from $(basename $(pwd))\n")),
+		"output":            "",
+		"status":            "",
+	}
+
+	for id, c := range map[string]config.Sandbox{
+		// the missions are in the first working root by default
+		"mission-in-root": {WorkingRoots: []string{root}},
+		"mission-in-dir":  {WorkingRoots: []string{root}, MissionRoot: filepath.Join(root, "missions")},
+	} {
+		s := useSandbox(t, c)
+		onTwinInfo(nil, twinInfo(t, id, twins))
+		require.Eventually(t, func() bool {
+			return load(t, id).Status == StatusOK
+		}, 5*time.Second, 10*time.Millisecond)
+		RemoveMission(id)
+		mission := load(t, id)
+		assert.Equal(t, s.workingDirectory(id), mission.WorkingDirectory)
+		assert.Equal(t, "hello from "+id+"\n", mission.Output)
+	}
+	assert.Equal(t, filepath.Join(root, "missions", "mission-in-dir"), load(t, "mission-in-dir").WorkingDirectory)
+
+	// the mission root must be in the working roots
+	_, err := NewSandbox(config.Sandbox{WorkingRoots: []string{root}, MissionRoot: t.TempDir()})
+	assert.Error(t, err)
+	s, err := NewSandbox(config.Sandbox{})
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join("tmp", "mission"), s.workingDirectory("mission"))
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2024 The KubeEdge Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package missions
+
+import (
+	"encoding/json"
+	"time"
+
+	klog "k8s.io/klog/v2"
+
+	"github.com/kubeedge/mappers-go/mappers/windows-virtual-exec/internal/config"
+	"github.com/kubeedge/mappers-go/mappers/windows-virtual-exec/internal/core/model"
+	"github.com/kubeedge/mappers-go/mappers/windows-virtual-exec/internal/core/store"
+)
+
+const (
+	defaultHistoryMaxRuns      = 100
+	defaultHistoryReportedRuns = 5
+)
+
+// historyOptions limits the run history of the missions, see InitHistory
+var historyOptions = config.History{
+	MaxRuns:      defaultHistoryMaxRuns,
+	ReportedRuns: defaultHistoryReportedRuns,
+}
+
+// InitHistory set how many runs of each mission are kept and reported, zero values keep the defaults
+func InitHistory(h config.History) {
+	if h.MaxRuns > 0 {
+		historyOptions.MaxRuns = h.MaxRuns
+	}
+	if h.ReportedRuns > 0 {
+		historyOptions.ReportedRuns = h.ReportedRuns
+	}
+}
+
+// Run is a run of a mission reported by the history twin, without its output
+type Run struct {
+	ID        uint      `json:"id"`
+	Trigger   string    `json:"trigger"`
+	StartTime time.Time `json:"startTime"`
+	EndTime   time.Time `json:"endTime"`
+	Status    string    `json:"status"`
+	ExitCode  int       `json:"exitCode"`
+}
+
+// recordRun save the finished run of the mission, and delete its oldest runs beyond the limit
+func (c *Mission) recordRun(trigger string, startTime time.Time) {
+	err := store.DB.Create(&model.MissionRun{
+		UniqueName: c.Config.UniqueName,
+		Trigger:    trigger,
+		StartTime:  startTime,
+		EndTime:    time.Now(),
+		Status:     c.Status,
+		ExitCode:   c.ExitCode,
+		Output:     c.Output,
+	}).Error
+	if err != nil {
+		klog.Error("Record run error: ", err)
+		return
+	}
+
+	kept := store.DB.Model(&model.MissionRun{}).Select("id").Where("unique_name = ?", c.Config.UniqueName).
+		Order("id desc").Limit(historyOptions.MaxRuns)
+	err = store.DB.Where("unique_name = ? AND id NOT IN (?)", c.Config.UniqueName, kept).Delete(&model.MissionRun{}).Error
+	if err != nil {
+		klog.Error("Delete old runs error: ", err)
+	}
+}
+
+// History return the last n runs of a mission, the last one first
+func History(id string, n int) ([]model.MissionRun, error) {
+	var runs []model.MissionRun
+	err := store.DB.Where("unique_name = ?", id).Order("id desc").Limit(n).Find(&runs).Error
+	return runs, err
+}
+
+// reportedHistory return the last runs of a mission reported by the history twin, as JSON
+func reportedHistory(id string) (string, error) {
+	runs, err := History(id, historyOptions.ReportedRuns)
+	if err != nil {
+		return "", err
+	}
+	reported := make([]Run, 0, len(runs))
+	for _, run := range runs {
+		reported = append(reported, Run{
+			ID:        run.ID,
+			Trigger:   run.Trigger,
+			StartTime: run.StartTime,
+			EndTime:   run.EndTime,
+			Status:    run.Status,
+			ExitCode:  run.ExitCode,
+		})
+	}
+	data, err := json.Marshal(reported)
+	return string(data), err
+}
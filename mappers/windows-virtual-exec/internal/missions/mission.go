@@ -14,17 +14,20 @@ limitations under the License.
 package missions
 
 import (
+	"context"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"strconv"
 	"sync"
+	"time"
 
 	klog "k8s.io/klog/v2"
 
 	"github.com/kubeedge/mappers-go/mappers/windows-virtual-exec/internal/core/model"
 	"github.com/kubeedge/mappers-go/mappers/windows-virtual-exec/internal/core/mqtt"
 	"github.com/kubeedge/mappers-go/mappers/windows-virtual-exec/internal/core/store"
+	"github.com/kubeedge/mappers-go/mappers/windows-virtual-exec/internal/utils/cron"
 	"github.com/kubeedge/mappers-go/mappers/windows-virtual-exec/internal/utils/encode"
 )
 
@@ -33,13 +36,34 @@ const (
 	StatusError   = "error"
 	StatusWaiting = "waiting"
 	StatusWorking = "working"
+	// StatusCancelled is the status of missions cancelled by the desired value of the status twin
+	StatusCancelled = "cancelled"
+	StatusTimeout   = "timeout"
+)
+
+// Triggers of the runs of missions
+const (
+	TriggerCreate   = "create"
+	TriggerRerun    = "rerun"
+	TriggerSchedule = "schedule"
 )
 
 type Mission struct {
-	exec   *Command
-	Config MissionConfig `json:"config"`
-	Status string        `json:"status"` // ok, error, waiting, working
-	Output string        `json:"output"`
+	exec     *Command
+	Config   MissionConfig `json:"config"`
+	Status   string        `json:"status"` // ok, error, waiting, working, cancelled, timeout
+	Output   string        `json:"output"`
+	ExitCode int           `json:"exitCode"`
+
+	// mutex protects started, cancel and the pending run, which are shared by Run, Rerun and Cancel
+	mutex   sync.Mutex
+	started bool
+	cancel  context.CancelFunc
+	// pendingTrigger and pendingRequest are the run requested while the mission is working
+	pendingTrigger string
+	pendingRequest string
+	// stopSchedule stop the scheduled runs of the mission
+	stopSchedule chan struct{}
 }
 
 type MissionConfig struct {
@@ -48,6 +72,18 @@ type MissionConfig struct {
 	FileContent      string `json:"fileContent"`
 	FileName         string `json:"fileName"`
 	WorkingDirectory string `json:"workingDirectory"`
+	// Shell run the command, one of powershell, cmd, sh, bash and exec, DefaultShell if it's empty
+	Shell string `json:"shell,omitempty"`
+	// Timeout of the command in seconds, the command is killed with the processes it starts once it expires
+	Timeout int `json:"timeout,omitempty"`
+	// Schedule is a cron schedule of the runs, scheduled missions don't run once they are created
+	Schedule string `json:"schedule,omitempty"`
+	// RunRequest is the last value of exec-run, the mission runs again when it changes
+	RunRequest string `json:"runRequest,omitempty"`
+	// Checksum is the hex SHA-256 checksum of the decoded file content
+	Checksum string `json:"checksum,omitempty"`
+	// Signature is the base64 ed25519 signature of the decoded file content
+	Signature string `json:"signature,omitempty"`
 }
 
 var cache = sync.Map{}
@@ -56,21 +92,38 @@ var createMutex sync.Mutex
 // NewMission add a new mission in memory cache
 func NewMission(config MissionConfig) (client *Mission, err error) {
 	defer func() {
-		go client.Run()
+		if err == nil && client.Config.Schedule == "" {
+			go client.Run()
+		}
 	}()
+	if err = ValidShell(config.Shell); err != nil {
+		return nil, err
+	}
+	var schedule *cron.Schedule
+	if config.Schedule != "" {
+		if schedule, err = cron.Parse(config.Schedule); err != nil {
+			return nil, err
+		}
+	}
 	// load cached mission
 	if data, ok := cache.Load(config.UniqueName); ok {
 		klog.Info("Get mission from cache: ", config.UniqueName)
-		return data.(*Mission), nil
+		client = data.(*Mission)
+		client.update(config, schedule)
+		return client, nil
 	}
 
 	// prevent New operation simutaneously in different goroutines
 	createMutex.Lock()
 	defer createMutex.Unlock()
+	if data, ok := cache.Load(config.UniqueName); ok {
+		client = data.(*Mission)
+		client.update(config, schedule)
+		return client, nil
+	}
 
 	// not in memory, add a new mission
 	client = &Mission{
-		exec:   &Command{},
 		Config: config,
 	}
 
@@ -81,14 +134,24 @@ func NewMission(config MissionConfig) (client *Mission, err error) {
 		client.Config.FileContent = mission.FileContent
 		client.Config.FileName = mission.FileName
 		client.Config.WorkingDirectory = mission.WorkingDirectory
+		client.Config.Shell = mission.Shell
+		client.Config.Timeout = mission.Timeout
+		client.Config.Schedule = mission.Schedule
+		client.Config.RunRequest = mission.RunRequest
+		client.Config.Checksum = mission.Checksum
+		client.Config.Signature = mission.Signature
 		client.Status = mission.Status
 		client.Output = mission.Output
+		client.ExitCode = mission.ExitCode
+		// the mission is cached so that it can be run again, with the config of the twins
+		cache.Store(config.UniqueName, client)
+		if !client.update(config, schedule) && schedule != nil {
+			client.startSchedule(schedule)
+		}
 		klog.Info("Get mission from db: ", config.UniqueName)
 		return client, nil
 	}
 
-	client.exec.Cmd = exec.Command("powershell", "-c", client.Config.Command)
-	client.exec.Cmd.Dir = client.Config.WorkingDirectory
 	client.Status = StatusWaiting
 
 	if mission.Status == StatusWorking {
@@ -98,6 +161,9 @@ func NewMission(config MissionConfig) (client *Mission, err error) {
 	}
 
 	cache.Store(config.UniqueName, client)
+	if schedule != nil {
+		client.startSchedule(schedule)
+	}
 	client.ReportDeviceStatus()
 	klog.Info("New mission: ", config.UniqueName)
 	return client, nil
@@ -112,9 +178,147 @@ func RemoveMission(id string) {
 		return
 	}
 
+	if data, ok := cache.Load(id); ok {
+		data.(*Mission).stop()
+	}
 	cache.Delete(id)
 }
 
+// RerunMission run a mission again for a new value of exec-run
+func RerunMission(id, request string) {
+	data, ok := cache.Load(id)
+	if !ok {
+		klog.Info("Mission to run again is not found: ", id)
+		return
+	}
+	go data.(*Mission).Rerun(TriggerRerun, request)
+}
+
+// Rerun run the mission again, whatever its status. If the mission is working, it runs again once it's finished.
+// A request is a value of exec-run, the mission doesn't run again for the same request.
+func (c *Mission) Rerun(trigger, request string) {
+	c.mutex.Lock()
+	if request != "" && (request == c.Config.RunRequest || request == c.pendingRequest) {
+		c.mutex.Unlock()
+		klog.Info("Mission already runs for request ", request, ": ", c.Config.UniqueName)
+		return
+	}
+	if c.cancel != nil {
+		c.pendingTrigger, c.pendingRequest = trigger, request
+		c.mutex.Unlock()
+		klog.Info("Mission is working, run it again once it's finished: ", c.Config.UniqueName)
+		return
+	}
+	c.prepare(request)
+	c.mutex.Unlock()
+	c.run(trigger)
+}
+
+// prepare make the mission wait for another run, the mutex must be held
+func (c *Mission) prepare(request string) {
+	c.started = false
+	c.Status = StatusWaiting
+	if request != "" {
+		c.Config.RunRequest = request
+	}
+}
+
+// update apply the config of the twins to a mission which isn't working, and tell whether it changed.
+// A changed mission waits for another run and its schedule starts again, its last exec-run is kept.
+func (c *Mission) update(config MissionConfig, schedule *cron.Schedule) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	config.RunRequest = c.Config.RunRequest
+	if config == c.Config {
+		return false
+	}
+	if c.cancel != nil {
+		klog.Info("Mission is working, skip its new config: ", c.Config.UniqueName)
+		return false
+	}
+	c.Config = config
+	c.prepare("")
+	if c.stopSchedule != nil {
+		close(c.stopSchedule)
+		c.stopSchedule = nil
+	}
+	if schedule != nil {
+		c.startSchedule(schedule)
+	}
+	c.UpdateDB()
+	c.ReportMissionStatus()
+	klog.Info("Mission config updated: ", c.Config.UniqueName)
+	return true
+}
+
+// startSchedule run the mission at the times of its schedule until it's removed
+func (c *Mission) startSchedule(schedule *cron.Schedule) {
+	c.stopSchedule = make(chan struct{})
+	go func(stop <-chan struct{}) {
+		for {
+			next := schedule.Next(time.Now())
+			if next.IsZero() {
+				klog.Info("Mission schedule has no next run: ", c.Config.UniqueName)
+				return
+			}
+			timer := time.NewTimer(time.Until(next))
+			select {
+			case <-timer.C:
+				klog.Info("Scheduled run of mission: ", c.Config.UniqueName)
+				c.Rerun(TriggerSchedule, "")
+			case <-stop:
+				timer.Stop()
+				return
+			}
+		}
+	}(c.stopSchedule)
+}
+
+// stop stop the scheduled runs of the mission, and cancel it if it's working
+func (c *Mission) stop() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.stopSchedule != nil {
+		close(c.stopSchedule)
+		c.stopSchedule = nil
+	}
+	c.pendingTrigger, c.pendingRequest = "", ""
+	if c.cancel != nil {
+		c.cancel()
+	}
+}
+
+// CancelMission cancel a mission which is waiting or working
+func CancelMission(id string) {
+	data, ok := cache.Load(id)
+	if !ok {
+		klog.Info("Mission to cancel is not found: ", id)
+		return
+	}
+	data.(*Mission).Cancel()
+}
+
+// Cancel kill the command of a working mission, a waiting mission is cancelled without running
+func (c *Mission) Cancel() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.cancel != nil {
+		klog.Info("Cancel mission: ", c.Config.UniqueName)
+		c.cancel()
+		return
+	}
+	// the status isn't changed by Run before it starts
+	if c.started || c.Status != StatusWaiting {
+		klog.Info("Mission is not waiting or working, skip cancellation: ", c.Config.UniqueName)
+		return
+	}
+	c.started = true
+	c.Status = StatusCancelled
+	c.UpdateDB()
+	c.ReportMissionStatus()
+	klog.Info("Mission cancelled before start: ", c.Config.UniqueName)
+}
+
 func (c *Mission) InsertDB() {
 	err := store.DB.Create(&model.Mission{
 		UniqueName:       c.Config.UniqueName,
@@ -122,8 +326,15 @@ func (c *Mission) InsertDB() {
 		FileContent:      c.Config.FileContent,
 		FileName:         c.Config.FileName,
 		WorkingDirectory: c.Config.WorkingDirectory,
+		Shell:            c.Config.Shell,
+		Timeout:          c.Config.Timeout,
+		Schedule:         c.Config.Schedule,
+		RunRequest:       c.Config.RunRequest,
+		Checksum:         c.Config.Checksum,
+		Signature:        c.Config.Signature,
 		Status:           c.Status,
 		Output:           c.Output,
+		ExitCode:         c.ExitCode,
 	}).Error
 	if err != nil {
 		klog.Error("InsertDB error: ", err.Error())
@@ -138,63 +349,169 @@ func (c *Mission) UpdateDB() {
 		"file_content":      c.Config.FileContent,
 		"file_name":         c.Config.FileName,
 		"working_directory": c.Config.WorkingDirectory,
+		"shell":             c.Config.Shell,
+		"timeout":           c.Config.Timeout,
+		"schedule":          c.Config.Schedule,
+		"run_request":       c.Config.RunRequest,
+		"checksum":          c.Config.Checksum,
+		"signature":         c.Config.Signature,
+		"exit_code":         c.ExitCode,
 	}).Error
 	if err != nil {
 		klog.Error("InsertDB error: ", err.Error())
 	}
 }
 
+// Run run the mission once it's created, a mission which has run is run again by Rerun
 func (c *Mission) Run() {
-	if c.Status == StatusOK || c.Status == StatusError || c.Status == StatusWorking {
+	c.run(TriggerCreate)
+}
+
+// run run the mission, then the run requested while it's working if any
+func (c *Mission) run(trigger string) {
+	for c.execute(trigger) {
+		c.mutex.Lock()
+		c.cancel = nil
+		trigger = c.pendingTrigger
+		if trigger != "" {
+			c.prepare(c.pendingRequest)
+			c.pendingTrigger, c.pendingRequest = "", ""
+		}
+		c.mutex.Unlock()
+		if trigger == "" {
+			return
+		}
+	}
+}
+
+// execute run the command of the mission if it's waiting, and record the run
+func (c *Mission) execute(trigger string) bool {
+	c.mutex.Lock()
+	if c.started || c.Status == StatusOK || c.Status == StatusError || c.Status == StatusWorking ||
+		c.Status == StatusCancelled || c.Status == StatusTimeout {
 		klog.Info("Mission status is not waiting, skip with current status ", c.Status)
-		return
+		c.mutex.Unlock()
+		return false
+	}
+	// the context is cancelled by Cancel, or expires after the timeout of the mission
+	base, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx := base
+	if c.Config.Timeout > 0 {
+		var stop context.CancelFunc
+		ctx, stop = context.WithTimeout(base, time.Duration(c.Config.Timeout)*time.Second)
+		defer stop()
 	}
+	c.started = true
+	c.cancel = cancel
+	c.Status = StatusWorking
+	c.Output = ""
+	c.ExitCode = 0
+	c.exec = nil
+	c.mutex.Unlock()
 
+	startTime := time.Now()
 	defer func() {
 		c.UpdateDB()
+		c.recordRun(trigger, startTime)
 		c.ReportMissionStatus()
 		klog.Info("Mission finished: ", c.Config.UniqueName, " result: ", c.Status)
 	}()
 
-	c.Status = StatusWorking
 	c.ReportMissionStatus()
 	klog.Info("Mission start: ", c.Config.UniqueName, " status: ", c.Status, " output: ", c.Output)
 
+	// nothing is written before the mission is checked
+	content := encode.DecodeBase64(c.Config.FileContent)
+	if err := sandbox.Check(c.Config, []byte(content)); err != nil {
+		klog.Errorf("Mission %s is rejected: %v", c.Config.UniqueName, err)
+		c.Status = StatusError
+		c.Output = err.Error()
+		return true
+	}
+
 	// clean working directory in  windows
 	dir := c.Config.WorkingDirectory
 	os.RemoveAll(dir)
 	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
 		klog.Errorf("Failed to make workdir %s: %v", dir, err)
-		return
+		c.Status = StatusError
+		c.Output = err.Error()
+		return true
 	}
 
-	file, err := os.Create(filepath.Join(dir, c.Config.FileName))
+	name := filepath.Join(dir, c.Config.FileName)
+	file, err := os.Create(name)
 	if err != nil {
 		klog.Error("Create file error: ", err)
 		c.Status = StatusError
 		c.Output = err.Error()
-		return
+		return true
 	}
-	_, err = file.WriteString(encode.DecodeBase64(c.Config.FileContent))
+	_, err = file.WriteString(content)
 	file.Close()
 
 	if err != nil {
 		klog.Error("Write file error: ", err)
 		c.Status = StatusError
 		c.Output = err.Error()
-		return
+		return true
 	}
 
-	err = c.exec.Exec()
+	// the user which runs the command owns its files
+	if err = sandbox.own(dir); err == nil {
+		err = sandbox.own(name)
+	}
 	if err != nil {
-		klog.Error("Exec error: ", err)
+		klog.Error("Change owner error: ", err)
 		c.Status = StatusError
-		c.Output = fmt.Sprintf("【msg】%s\n【err】%s\n", err.Error(), string(c.exec.StdErr))
-		return
+		c.Output = err.Error()
+		return true
+	}
+
+	c.exec, err = NewCommand(c.Config.Shell, c.Config.Command, dir)
+	if err != nil {
+		klog.Error("Create command error: ", err)
+		c.Status = StatusError
+		c.Output = err.Error()
+		return true
+	}
+
+	// the output is published while the command runs
+	stop := make(chan struct{})
+	streamed := make(chan struct{})
+	go func() {
+		defer close(streamed)
+		c.stream(stop)
+	}()
+	err = c.exec.Exec(ctx)
+	close(stop)
+	<-streamed
+	c.ExitCode = c.exec.ExitCode
+
+	if err != nil {
+		var msg string
+		switch ctx.Err() {
+		case context.Canceled:
+			c.Status = StatusCancelled
+			msg = "the mission is cancelled"
+		case context.DeadlineExceeded:
+			c.Status = StatusTimeout
+			msg = fmt.Sprintf("the mission timed out after %d seconds", c.Config.Timeout)
+		default:
+			klog.Error("Exec error: ", err)
+			c.Status = StatusError
+			c.Output = fmt.Sprintf("【msg】%s\n【err】%s\n", err.Error(), string(c.exec.StdErr))
+			return true
+		}
+		klog.Error("Exec error: ", msg)
+		c.Output = fmt.Sprintf("【msg】%s\n【out】%s\n【err】%s\n", msg, string(c.exec.StdOut), string(c.exec.StdErr))
+		return true
 	}
 
 	c.Status = StatusOK
 	c.Output = string(c.exec.StdOut)
+	return true
 }
 
 func (c *Mission) ReportDeviceStatus() {
@@ -213,13 +530,42 @@ func (c *Mission) ReportDeviceStatus() {
 func (c *Mission) ReportMissionStatus() {
 	var payload []byte
 	var err error
-	if payload, err = mqtt.CreateMessageTwinUpdate(map[string]string{
+	twins := map[string]string{
 		"status":            c.Status,
 		"output":            c.Output,
 		"exec-command":      c.Config.Command,
 		"exec-file-name":    c.Config.FileName,
 		"exec-file-content": c.Config.FileContent,
-	}); err != nil {
+	}
+	// exec-shell and exec-timeout are optional in the device model
+	if c.Config.Shell != "" {
+		twins["exec-shell"] = c.Config.Shell
+	}
+	if c.Config.Timeout > 0 {
+		twins["exec-timeout"] = strconv.Itoa(c.Config.Timeout)
+	}
+	if c.Config.Schedule != "" {
+		twins["exec-schedule"] = c.Config.Schedule
+	}
+	if c.Config.RunRequest != "" {
+		twins["exec-run"] = c.Config.RunRequest
+	}
+	if c.Config.Checksum != "" {
+		twins["exec-file-sha256"] = c.Config.Checksum
+	}
+	if c.Config.Signature != "" {
+		twins["exec-file-signature"] = c.Config.Signature
+	}
+	if history, err := reportedHistory(c.Config.UniqueName); err != nil {
+		klog.Errorf("Get the history of mission %s failed: %v", c.Config.UniqueName, err)
+	} else {
+		twins["history"] = history
+	}
+	// the exit code is known once the command is run
+	if c.exec != nil && c.Status != StatusWorking {
+		twins["exit-code"] = strconv.Itoa(c.ExitCode)
+	}
+	if payload, err = mqtt.CreateMessageTwinUpdate(twins); err != nil {
 		klog.Errorf("Create message state failed: %v", err)
 		return
 	}
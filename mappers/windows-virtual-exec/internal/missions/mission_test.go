@@ -0,0 +1,466 @@
+/*
+Copyright 2024 The KubeEdge Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package missions
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	mq "github.com/eclipse/paho.mqtt.golang"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kubeedge/mappers-go/mappers/windows-virtual-exec/internal/config"
+	"github.com/kubeedge/mappers-go/mappers/windows-virtual-exec/internal/core/model"
+	"github.com/kubeedge/mappers-go/mappers/windows-virtual-exec/internal/core/mqtt"
+	"github.com/kubeedge/mappers-go/mappers/windows-virtual-exec/internal/core/store"
+	"github.com/kubeedge/mappers-go/mappers/windows-virtual-exec/internal/dto"
+)
+
+type fakeToken struct{}
+
+func (t *fakeToken) Wait() bool                     { return true }
+func (t *fakeToken) WaitTimeout(time.Duration) bool { return true }
+func (t *fakeToken) Error() error                   { return nil }
+
+func (t *fakeToken) Done() <-chan struct{} {
+	done := make(chan struct{})
+	close(done)
+	return done
+}
+
+// fakeMQTT record the messages published by the missions
+type fakeMQTT struct {
+	mq.Client
+	mutex     sync.Mutex
+	published map[string][][]byte
+}
+
+func (c *fakeMQTT) Publish(topic string, _ byte, _ bool, payload interface{}) mq.Token {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.published[topic] = append(c.published[topic], payload.([]byte))
+	return &fakeToken{}
+}
+
+// twins return the twins published for a mission
+func (c *fakeMQTT) twins(t *testing.T, id string) []map[string]string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	var updates []map[string]string
+	for _, payload := range c.published[fmt.Sprintf(mqtt.TopicPubTwinUpdateRequest, id)] {
+		var update dto.DeviceTwinUpdate
+		require.NoError(t, json.Unmarshal(payload, &update))
+		twins := map[string]string{}
+		for name, twin := range update.Twin {
+			twins[name] = *twin.Actual.Value
+		}
+		updates = append(updates, twins)
+	}
+	return updates
+}
+
+// setup use a new database and a fake MQTT client for the missions
+func setup(t *testing.T) *fakeMQTT {
+	if runtime.GOOS == "windows" {
+		t.Skip("the missions are tested with sh")
+	}
+	store.InitDB(filepath.Join(t.TempDir(), "internal.db"))
+	require.NoError(t, store.DB.AutoMigrate(&model.Mission{}, &model.MissionRun{}))
+	client := &fakeMQTT{published: map[string][][]byte{}}
+	mqtt.SetClient(&mqtt.Client{Client: client})
+	return client
+}
+
+func newMission(t *testing.T, id, command, content string) *Mission {
+	m := &Mission{
+		Config: MissionConfig{
+			UniqueName:       id,
+			Command:          command,
+			FileContent:      base64.StdEncoding.EncodeToString([]byte(content)),
+			FileName:         "run.sh",
+			WorkingDirectory: filepath.Join(t.TempDir(), id),
+			Shell:            ShellSh,
+		},
+		Status: StatusWaiting,
+	}
+	m.InsertDB()
+	return m
+}
+
+func load(t *testing.T, id string) model.Mission {
+	var mission model.Mission
+	require.NoError(t, store.DB.Where("unique_name = ?", id).First(&mission).Error)
+	return mission
+}
+
+func TestRun(t *testing.T) {
+	client := setup(t)
+	m := newMission(t, "mission-ok", "sh run.sh world", "echo hello, $1\n")
+
+	m.Run()
+	assert.Equal(t, StatusOK, m.Status)
+	assert.Equal(t, "hello, world\n", m.Output)
+	mission := load(t, m.Config.UniqueName)
+	assert.Equal(t, StatusOK, mission.Status)
+	assert.Equal(t, "hello, world\n", mission.Output)
+	assert.Equal(t, ShellSh, mission.Shell)
+
+	twins := client.twins(t, m.Config.UniqueName)
+	require.Len(t, twins, 2)
+	assert.Equal(t, StatusWorking, twins[0]["status"])
+	var history []Run
+	require.NoError(t, json.Unmarshal([]byte(twins[1]["history"]), &history))
+	require.Len(t, history, 1)
+	assert.Equal(t, TriggerCreate, history[0].Trigger)
+	assert.Equal(t, StatusOK, history[0].Status)
+	delete(twins[1], "history")
+	assert.Equal(t, map[string]string{
+		"status":            StatusOK,
+		"output":            "hello, world\n",
+		"exec-command":      "sh run.sh world",
+		"exec-file-name":    "run.sh",
+		"exec-file-content": m.Config.FileContent,
+		"exec-shell":        ShellSh,
+		"exit-code":         "0",
+	}, twins[1])
+
+	// a finished mission is not run again
+	m.Run()
+	assert.Len(t, client.twins(t, m.Config.UniqueName), 2)
+}
+
+func TestRunError(t *testing.T) {
+	client := setup(t)
+	m := newMission(t, "mission-error", ". ./run.sh", "echo failed >&2\nexit 3\n")
+
+	m.Run()
+	assert.Equal(t, StatusError, m.Status)
+	assert.Equal(t, 3, m.ExitCode)
+	assert.Equal(t, 3, load(t, m.Config.UniqueName).ExitCode)
+	assert.Contains(t, m.Output, "failed")
+	assert.Equal(t, StatusError, load(t, m.Config.UniqueName).Status)
+	twins := client.twins(t, m.Config.UniqueName)
+	require.Len(t, twins, 2)
+	assert.Equal(t, StatusError, twins[1]["status"])
+	assert.Equal(t, m.Output, twins[1]["output"])
+	assert.Equal(t, "3", twins[1]["exit-code"])
+}
+
+func TestRunTimeout(t *testing.T) {
+	client := setup(t)
+	// the process started by the script is killed too
+	m := newMission(t, "mission-timeout", "sh run.sh", "echo started\nsleep 30 &\nwait\n")
+	m.Config.Timeout = 1
+
+	begin := time.Now()
+	m.Run()
+	assert.Less(t, time.Since(begin), 10*time.Second)
+	assert.Equal(t, StatusTimeout, m.Status)
+	assert.Contains(t, m.Output, "timed out after 1 seconds")
+	assert.Contains(t, m.Output, "started")
+	assert.Equal(t, -1, m.ExitCode, "the process is killed")
+	mission := load(t, m.Config.UniqueName)
+	assert.Equal(t, StatusTimeout, mission.Status)
+	assert.Equal(t, 1, mission.Timeout)
+	twins := client.twins(t, m.Config.UniqueName)
+	require.Len(t, twins, 2)
+	assert.Equal(t, "1", twins[1]["exec-timeout"])
+	assert.Equal(t, "-1", twins[1]["exit-code"])
+}
+
+func TestCancel(t *testing.T) {
+	client := setup(t)
+	m := newMission(t, "mission-cancel", "sh run.sh", "echo started\nsleep 30\n")
+	cache.Store(m.Config.UniqueName, m)
+	defer cache.Delete(m.Config.UniqueName)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.Run()
+	}()
+	// cancel once the output is streamed
+	topic := fmt.Sprintf(mqtt.TopicPubDataUpdate, m.Config.UniqueName)
+	require.Eventually(t, func() bool {
+		client.mutex.Lock()
+		defer client.mutex.Unlock()
+		return len(client.published[topic]) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+	CancelMission(m.Config.UniqueName)
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("the mission is not cancelled")
+	}
+	assert.Equal(t, StatusCancelled, m.Status)
+	assert.Contains(t, m.Output, "cancelled")
+	assert.Equal(t, StatusCancelled, load(t, m.Config.UniqueName).Status)
+
+	// a waiting mission is cancelled without running
+	waiting := newMission(t, "mission-cancel-waiting", "sh run.sh", "echo started\n")
+	waiting.Cancel()
+	assert.Equal(t, StatusCancelled, load(t, waiting.Config.UniqueName).Status)
+	waiting.Run()
+	assert.Nil(t, waiting.exec)
+	twins := client.twins(t, waiting.Config.UniqueName)
+	require.Len(t, twins, 1)
+	assert.Equal(t, StatusCancelled, twins[0]["status"])
+	assert.NotContains(t, twins[0], "exit-code")
+}
+
+func TestStreamOutput(t *testing.T) {
+	client := setup(t)
+	defer func(o config.Output) { outputOptions = o }(outputOptions)
+	outputOptions = config.Output{MaxSize: 10, ChunkSize: 4, Interval: 10}
+	m := newMission(t, "mission-stream", "sh run.sh", "printf 0123456789abcdef\nprintf failed >&2\n")
+
+	m.Run()
+	assert.Equal(t, StatusOK, m.Status)
+	assert.Equal(t, "0123456789\n[truncated 6 bytes]\n", m.Output)
+
+	var stdout, stderr string
+	client.mutex.Lock()
+	for _, payload := range client.published[fmt.Sprintf(mqtt.TopicPubDataUpdate, m.Config.UniqueName)] {
+		var data dto.DeviceData
+		require.NoError(t, json.Unmarshal(payload, &data))
+		require.Len(t, data.Data, 1)
+		if value, ok := data.Data["stdout"]; ok {
+			if !strings.Contains(value.Value, "truncated") {
+				assert.LessOrEqual(t, len(value.Value), 4, "the output is published in chunks")
+			}
+			stdout += value.Value
+		} else {
+			stderr += data.Data["stderr"].Value
+		}
+	}
+	client.mutex.Unlock()
+	assert.Equal(t, "0123456789\n[truncated, the output exceeds 10 bytes]\n", stdout)
+	assert.Equal(t, "failed", stderr)
+}
+
+func TestRunExec(t *testing.T) {
+	setup(t)
+	m := newMission(t, "mission-exec", "cat run.sh", "not a script")
+	m.Config.Shell = ShellExec
+
+	m.Run()
+	assert.Equal(t, StatusOK, m.Status)
+	assert.Equal(t, "not a script", m.Output)
+}
+
+func TestUpdateDB(t *testing.T) {
+	setup(t)
+	m := newMission(t, "mission-update", "sh run.sh", "")
+
+	m.Status = StatusWorking
+	m.Output = "half way"
+	m.Config.Command = "bash run.sh"
+	m.Config.Shell = ShellBash
+	m.UpdateDB()
+	mission := load(t, m.Config.UniqueName)
+	assert.Equal(t, model.Mission{
+		UniqueName:       "mission-update",
+		Command:          "bash run.sh",
+		FileContent:      m.Config.FileContent,
+		FileName:         "run.sh",
+		WorkingDirectory: m.Config.WorkingDirectory,
+		Shell:            ShellBash,
+		Status:           StatusWorking,
+		Output:           "half way",
+	}, mission)
+}
+
+func TestNewMission(t *testing.T) {
+	client := setup(t)
+	_, err := NewMission(MissionConfig{UniqueName: "mission-unknown", Shell: "zsh"})
+	assert.Error(t, err)
+
+	m, err := NewMission(MissionConfig{
+		UniqueName:       "mission-new",
+		Command:          "echo $0",
+		WorkingDirectory: filepath.Join(t.TempDir(), "mission-new"),
+		FileName:         "empty",
+	})
+	require.NoError(t, err)
+	defer RemoveMission(m.Config.UniqueName)
+	assert.Eventually(t, func() bool {
+		return load(t, m.Config.UniqueName).Status == StatusOK
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "sh\n", load(t, m.Config.UniqueName).Output, "sh is the default shell")
+	client.mutex.Lock()
+	assert.Len(t, client.published[fmt.Sprintf(mqtt.TopicPubDeviceStateUpdateRequest, m.Config.UniqueName)], 1)
+	client.mutex.Unlock()
+}
+
+func TestNewMissionUpdate(t *testing.T) {
+	setup(t)
+	config := MissionConfig{
+		UniqueName:       "mission-update",
+		Command:          "echo first",
+		WorkingDirectory: filepath.Join(t.TempDir(), "mission-update"),
+		FileName:         "empty",
+	}
+	m, err := NewMission(config)
+	require.NoError(t, err)
+	defer RemoveMission(config.UniqueName)
+	finished := func(runs int, output string) func() bool {
+		return func() bool {
+			history, err := History(config.UniqueName, 10)
+			require.NoError(t, err)
+			return len(history) == runs && load(t, config.UniqueName).Output == output
+		}
+	}
+	require.Eventually(t, finished(1, "first\n"), 5*time.Second, 10*time.Millisecond)
+
+	// the same twins don't run the mission again
+	_, err = NewMission(config)
+	require.NoError(t, err)
+	time.Sleep(100 * time.Millisecond)
+	runs, err := History(config.UniqueName, 10)
+	require.NoError(t, err)
+	assert.Len(t, runs, 1)
+
+	// the cached mission runs the new command
+	config.Command = "echo second"
+	cached, err := NewMission(config)
+	require.NoError(t, err)
+	assert.Same(t, m, cached)
+	require.Eventually(t, finished(2, "second\n"), 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "echo second", load(t, config.UniqueName).Command)
+
+	// the mission saved in the database gets the new schedule, it doesn't run once it's loaded
+	RemoveMission(config.UniqueName)
+	config.Command, config.Schedule = "echo third", "@every 1s"
+	loaded, err := NewMission(config)
+	require.NoError(t, err)
+	assert.NotSame(t, m, loaded)
+	assert.Equal(t, StatusWaiting, load(t, config.UniqueName).Status)
+	require.Eventually(t, finished(3, "third\n"), 5*time.Second, 50*time.Millisecond)
+	runs, err = History(config.UniqueName, 10)
+	require.NoError(t, err)
+	assert.Equal(t, TriggerSchedule, runs[0].Trigger)
+	assert.Equal(t, "@every 1s", load(t, config.UniqueName).Schedule)
+}
+
+func TestRerun(t *testing.T) {
+	client := setup(t)
+	defer func(h config.History) { historyOptions = h }(historyOptions)
+	historyOptions.MaxRuns = 2
+	m := newMission(t, "mission-rerun", "sh run.sh", "echo again\n")
+
+	m.Run()
+	m.Run()
+	runs, err := History(m.Config.UniqueName, 10)
+	require.NoError(t, err)
+	require.Len(t, runs, 1, "Run doesn't run a finished mission again")
+
+	m.Rerun(TriggerRerun, "1")
+	m.Rerun(TriggerRerun, "1")
+	runs, err = History(m.Config.UniqueName, 10)
+	require.NoError(t, err)
+	require.Len(t, runs, 2, "the mission runs once for a request")
+	assert.Equal(t, TriggerRerun, runs[0].Trigger)
+	assert.Equal(t, StatusOK, runs[0].Status)
+	assert.Equal(t, "again\n", runs[0].Output)
+	assert.False(t, runs[0].EndTime.Before(runs[0].StartTime))
+	assert.Equal(t, TriggerCreate, runs[1].Trigger)
+	assert.Equal(t, "1", load(t, m.Config.UniqueName).RunRequest)
+	twins := client.twins(t, m.Config.UniqueName)
+	assert.Equal(t, "1", twins[len(twins)-1]["exec-run"])
+
+	m.Rerun(TriggerSchedule, "")
+	runs, err = History(m.Config.UniqueName, 10)
+	require.NoError(t, err)
+	require.Len(t, runs, 2, "the oldest runs are deleted")
+	assert.Equal(t, TriggerSchedule, runs[0].Trigger)
+	assert.Equal(t, TriggerRerun, runs[1].Trigger)
+}
+
+func TestRerunWorking(t *testing.T) {
+	client := setup(t)
+	// the first run is slow, the next one is quick
+	m := newMission(t, "mission-rerun-working", "sh run.sh",
+		"if [ ! -f ../marker ]; then touch ../marker; sleep 1; echo slow; else echo quick; fi\n")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.Run()
+	}()
+	require.Eventually(t, func() bool {
+		return len(client.twins(t, m.Config.UniqueName)) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+	m.Rerun(TriggerRerun, "2")
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("the mission is not finished")
+	}
+
+	runs, err := History(m.Config.UniqueName, 10)
+	require.NoError(t, err)
+	require.Len(t, runs, 2, "the mission runs again once it's finished")
+	assert.Equal(t, "quick\n", runs[0].Output)
+	assert.Equal(t, TriggerRerun, runs[0].Trigger)
+	assert.Equal(t, "slow\n", runs[1].Output)
+	assert.Equal(t, "2", m.Config.RunRequest)
+}
+
+func TestSchedule(t *testing.T) {
+	setup(t)
+	_, err := NewMission(MissionConfig{UniqueName: "mission-bad-schedule", Schedule: "every minute"})
+	assert.Error(t, err)
+
+	m, err := NewMission(MissionConfig{
+		UniqueName:       "mission-schedule",
+		Command:          "echo scheduled",
+		WorkingDirectory: filepath.Join(t.TempDir(), "mission-schedule"),
+		FileName:         "empty",
+		Schedule:         "@every 1s",
+	})
+	require.NoError(t, err)
+	runs, err := History(m.Config.UniqueName, 10)
+	require.NoError(t, err)
+	assert.Empty(t, runs, "a scheduled mission doesn't run once it's created")
+
+	assert.Eventually(t, func() bool {
+		runs, err := History(m.Config.UniqueName, 10)
+		require.NoError(t, err)
+		return len(runs) >= 2
+	}, 5*time.Second, 50*time.Millisecond)
+	RemoveMission(m.Config.UniqueName)
+	runs, err = History(m.Config.UniqueName, 10)
+	require.NoError(t, err)
+	assert.Equal(t, TriggerSchedule, runs[0].Trigger)
+	assert.Equal(t, "scheduled\n", runs[0].Output)
+	assert.Equal(t, "@every 1s", load(t, m.Config.UniqueName).Schedule)
+
+	// the schedule is stopped once the mission is removed
+	time.Sleep(1500 * time.Millisecond)
+	after, err := History(m.Config.UniqueName, 10)
+	require.NoError(t, err)
+	assert.LessOrEqual(t, len(after), len(runs)+1, "a run may be finishing when the mission is removed")
+	time.Sleep(1500 * time.Millisecond)
+	last, err := History(m.Config.UniqueName, 10)
+	require.NoError(t, err)
+	assert.Equal(t, len(after), len(last))
+}
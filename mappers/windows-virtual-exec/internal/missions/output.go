@@ -0,0 +1,185 @@
+/*
+Copyright 2024 The KubeEdge Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package missions
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	klog "k8s.io/klog/v2"
+
+	"github.com/kubeedge/mappers-go/mappers/windows-virtual-exec/internal/config"
+	"github.com/kubeedge/mappers-go/mappers/windows-virtual-exec/internal/core/mqtt"
+)
+
+const (
+	defaultOutputMaxSize   = 64 * 1024
+	defaultOutputChunkSize = 4 * 1024
+	defaultOutputInterval  = 1000 // milliseconds
+)
+
+// outputOptions limits the output of the missions, see InitOutput
+var outputOptions = config.Output{
+	MaxSize:   defaultOutputMaxSize,
+	ChunkSize: defaultOutputChunkSize,
+	Interval:  defaultOutputInterval,
+}
+
+// InitOutput set how the output of the missions is kept and published, zero values keep the defaults
+func InitOutput(o config.Output) {
+	if o.MaxSize > 0 {
+		outputOptions.MaxSize = o.MaxSize
+	}
+	if o.ChunkSize > 0 {
+		outputOptions.ChunkSize = o.ChunkSize
+	}
+	if o.Interval > 0 {
+		outputOptions.Interval = o.Interval
+	}
+}
+
+// output keep the output of a process up to a maximum size, the output which isn't published yet is pending
+type output struct {
+	mutex   sync.Mutex
+	limit   int
+	data    []byte
+	pending []byte
+	// dropped is the size of the output beyond the limit
+	dropped int
+	// marked is true once the truncation is published
+	marked bool
+}
+
+func newOutput(limit int) *output {
+	return &output{limit: limit}
+}
+
+// Write keep p within the limit, it never fails so that the process isn't broken by the limit
+func (o *output) Write(p []byte) (int, error) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	kept := p
+	if room := o.limit - len(o.data); room < len(kept) {
+		if room < 0 {
+			room = 0
+		}
+		kept = kept[:room]
+	}
+	o.dropped += len(p) - len(kept)
+	o.data = append(o.data, kept...)
+	o.pending = append(o.pending, kept...)
+	return len(p), nil
+}
+
+// String return the kept output, followed by a marker if it's truncated
+func (o *output) String() string {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	if o.dropped > 0 {
+		return fmt.Sprintf("%s\n[truncated %d bytes]\n", o.data, o.dropped)
+	}
+	return string(o.data)
+}
+
+// next return at most size bytes of pending output, then a marker once the output is truncated
+func (o *output) next(size int) (string, bool) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	if len(o.pending) > 0 {
+		if size > len(o.pending) {
+			size = len(o.pending)
+		}
+		chunk := string(o.pending[:size])
+		o.pending = o.pending[size:]
+		return chunk, true
+	}
+	if o.dropped > 0 && !o.marked {
+		o.marked = true
+		return fmt.Sprintf("\n[truncated, the output exceeds %d bytes]\n", o.limit), true
+	}
+	return "", false
+}
+
+// outputLimit count the output of a command, exceeded is closed once the output exceeds the limit
+type outputLimit struct {
+	size     int64
+	limit    int64
+	once     sync.Once
+	exceeded chan struct{}
+}
+
+func newOutputLimit(limit int) *outputLimit {
+	return &outputLimit{limit: int64(limit), exceeded: make(chan struct{})}
+}
+
+// writer return a writer to w which counts the output
+func (l *outputLimit) writer(w io.Writer) io.Writer {
+	return &limitedWriter{Writer: w, limit: l}
+}
+
+type limitedWriter struct {
+	io.Writer
+	limit *outputLimit
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	if atomic.AddInt64(&w.limit.size, int64(len(p))) > w.limit.limit {
+		w.limit.once.Do(func() {
+			close(w.limit.exceeded)
+		})
+	}
+	return w.Writer.Write(p)
+}
+
+// stream publish the output of the mission periodically until stop is closed, then the rest of it
+func (c *Mission) stream(stop <-chan struct{}) {
+	ticker := time.NewTicker(time.Duration(outputOptions.Interval) * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.publishOutput()
+		case <-stop:
+			c.publishOutput()
+			return
+		}
+	}
+}
+
+// publishOutput publish the pending stdout and stderr of the mission to its data topic
+func (c *Mission) publishOutput() {
+	for _, o := range []struct {
+		name   string
+		output *output
+	}{{"stdout", c.exec.stdout}, {"stderr", c.exec.stderr}} {
+		for {
+			chunk, ok := o.output.next(outputOptions.ChunkSize)
+			if !ok {
+				break
+			}
+			payload, err := mqtt.CreateMessageData(o.name, "string", chunk)
+			if err != nil {
+				klog.Errorf("Create message data failed: %v", err)
+				return
+			}
+			if err = mqtt.GetClient().Publish(fmt.Sprintf(mqtt.TopicPubDataUpdate, c.Config.UniqueName), payload); err != nil {
+				klog.Errorf("Publish failed: %v", err)
+				return
+			}
+		}
+	}
+}
@@ -14,12 +14,13 @@ limitations under the License.
 package missions
 
 import (
-	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"os/exec"
 	"strings"
-	"syscall"
+
+	klog "k8s.io/klog/v2"
 )
 
 type Command struct {
@@ -27,30 +28,83 @@ type Command struct {
 	StdOut   []byte
 	StdErr   []byte
 	ExitCode int
+
+	// stdout and stderr keep the output while the command runs
+	stdout *output
+	stderr *output
 }
 
 // Exec run command and exit formatted error, callers can print err directly
 // Any running error or non-zero exitcode is consider as error
-func (cmd *Command) Exec() error {
-	var stdoutBuf, stderrBuf bytes.Buffer
-	cmd.Cmd.Stdout = &stdoutBuf
-	cmd.Cmd.Stderr = &stderrBuf
+// The command and the processes it starts are killed once ctx is done
+func (cmd *Command) Exec(ctx context.Context) error {
+	if cmd.stdout == nil {
+		cmd.stdout = newOutput(outputOptions.MaxSize)
+	}
+	if cmd.stderr == nil {
+		cmd.stderr = newOutput(outputOptions.MaxSize)
+	}
+	cmd.Cmd.Stdout = cmd.stdout
+	cmd.Cmd.Stderr = cmd.stderr
+	// exceeded is nil without output limit
+	var exceeded chan struct{}
+	if sandbox.limits.OutputSize > 0 {
+		limit := newOutputLimit(sandbox.limits.OutputSize)
+		cmd.Cmd.Stdout, cmd.Cmd.Stderr = limit.writer(cmd.stdout), limit.writer(cmd.stderr)
+		exceeded = limit.exceeded
+	}
+	setProcessGroup(cmd.Cmd)
 
 	errString := fmt.Sprintf("failed to exec '%s'", cmd.GetCommand())
 
-	err := cmd.Cmd.Start()
+	err := sandbox.prepare(cmd.Cmd)
+	if err == nil {
+		err = cmd.Cmd.Start()
+	}
 	if err != nil {
 		errString = fmt.Sprintf("%s, err: %v", errString, err)
 		return errors.New(errString)
 	}
 
-	err = cmd.Cmd.Wait()
+	release, err := sandbox.started(cmd.Cmd)
 	if err != nil {
-		cmd.StdErr = stderrBuf.Bytes()
+		if kerr := killProcessTree(cmd.Cmd); kerr != nil {
+			klog.Errorf("Failed to kill '%s': %v", cmd.GetCommand(), kerr)
+		}
+		cmd.Cmd.Wait()
+		cmd.ExitCode = 1
+		errString = fmt.Sprintf("%s, err: %v", errString, err)
+		return errors.New(errString)
+	}
+	defer release()
 
+	wait := make(chan error, 1)
+	go func() {
+		wait <- cmd.Cmd.Wait()
+	}()
+	select {
+	case err = <-wait:
+	case <-ctx.Done():
+		if kerr := killProcessTree(cmd.Cmd); kerr != nil {
+			klog.Errorf("Failed to kill '%s': %v", cmd.GetCommand(), kerr)
+		}
+		<-wait
+		err = ctx.Err()
+	case <-exceeded:
+		if kerr := killProcessTree(cmd.Cmd); kerr != nil {
+			klog.Errorf("Failed to kill '%s': %v", cmd.GetCommand(), kerr)
+		}
+		<-wait
+		err = fmt.Errorf("the output exceeds %d bytes", sandbox.limits.OutputSize)
+	}
+
+	cmd.StdOut, cmd.StdErr = []byte(cmd.stdout.String()), []byte(cmd.stderr.String())
+	if err != nil {
 		if exit, ok := err.(*exec.ExitError); ok {
-			cmd.ExitCode = exit.Sys().(syscall.WaitStatus).ExitStatus()
-			errString = fmt.Sprintf("%s, err: %s", errString, stderrBuf.Bytes())
+			cmd.ExitCode = exit.ExitCode()
+			errString = fmt.Sprintf("%s, err: %s", errString, cmd.StdErr)
+		} else if cmd.Cmd.ProcessState != nil {
+			cmd.ExitCode = cmd.Cmd.ProcessState.ExitCode()
 		} else {
 			cmd.ExitCode = 1
 		}
@@ -60,7 +114,6 @@ func (cmd *Command) Exec() error {
 		return errors.New(errString)
 	}
 
-	cmd.StdOut, cmd.StdErr = stdoutBuf.Bytes(), stderrBuf.Bytes()
 	return nil
 }
 
@@ -0,0 +1,86 @@
+/*
+Copyright 2024 The KubeEdge Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package missions
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// Shells which can run the command of a mission
+const (
+	ShellPowershell = "powershell"
+	ShellCmd        = "cmd"
+	ShellSh         = "sh"
+	ShellBash       = "bash"
+	// ShellExec run the command directly, split into arguments by white spaces without any shell
+	ShellExec = "exec"
+)
+
+// shellArgs is the arguments given to each shell before the command
+var shellArgs = map[string][]string{
+	ShellPowershell: {"-c"},
+	ShellCmd:        {"/C"},
+	ShellSh:         {"-c"},
+	ShellBash:       {"-c"},
+}
+
+// DefaultShell return the shell of missions which don't configure one, powershell on windows and sh elsewhere
+func DefaultShell() string {
+	if runtime.GOOS == "windows" {
+		return ShellPowershell
+	}
+	return ShellSh
+}
+
+// ValidShell check the shell is supported, empty means the default shell
+func ValidShell(shell string) error {
+	if shell == "" || shell == ShellExec {
+		return nil
+	}
+	if _, ok := shellArgs[shell]; !ok {
+		return fmt.Errorf("unsupported shell %q", shell)
+	}
+	return nil
+}
+
+// NewCommand create the command run by shell in dir
+func NewCommand(shell, command, dir string) (*Command, error) {
+	if shell == "" {
+		shell = DefaultShell()
+	}
+	if err := ValidShell(shell); err != nil {
+		return nil, err
+	}
+
+	var cmd *exec.Cmd
+	if shell == ShellExec {
+		args := strings.Fields(command)
+		if len(args) == 0 {
+			return nil, errors.New("the command is empty")
+		}
+		cmd = exec.Command(args[0], args[1:]...)
+	} else {
+		cmd = exec.Command(shell, append(shellArgs[shell], command)...)
+	}
+	cmd.Dir = dir
+	return &Command{
+		Cmd:    cmd,
+		stdout: newOutput(outputOptions.MaxSize),
+		stderr: newOutput(outputOptions.MaxSize),
+	}, nil
+}
@@ -0,0 +1,45 @@
+/*
+Copyright 2024 The KubeEdge Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package missions
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewCommand(t *testing.T) {
+	for _, c := range []struct {
+		shell string
+		args  []string
+	}{
+		{shell: ShellPowershell, args: []string{"powershell", "-c", "run.bat  --fast"}},
+		{shell: ShellCmd, args: []string{"cmd", "/C", "run.bat  --fast"}},
+		{shell: ShellSh, args: []string{"sh", "-c", "run.bat  --fast"}},
+		{shell: ShellBash, args: []string{"bash", "-c", "run.bat  --fast"}},
+		{shell: ShellExec, args: []string{"run.bat", "--fast"}},
+		{shell: "", args: []string{DefaultShell(), "-c", "run.bat  --fast"}},
+	} {
+		cmd, err := NewCommand(c.shell, "run.bat  --fast", "work")
+		require.NoError(t, err, c.shell)
+		assert.Equal(t, c.args, cmd.Cmd.Args, c.shell)
+		assert.Equal(t, "work", cmd.Cmd.Dir)
+	}
+
+	_, err := NewCommand("zsh", "run.sh", "")
+	assert.Error(t, err)
+	_, err = NewCommand(ShellExec, " ", "")
+	assert.Error(t, err)
+}
@@ -0,0 +1,232 @@
+/*
+Copyright 2024 The KubeEdge Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package missions
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/kubeedge/mappers-go/mappers/windows-virtual-exec/internal/config"
+)
+
+// defaultMissionRoot is the directory of the working directories of missions without working roots
+const defaultMissionRoot = "tmp"
+
+// Sandbox is the guardrails of the missions: where they run, what they run, as which user and with which limits
+type Sandbox struct {
+	roots []string
+	// missionRoot contains the working directory of each mission
+	missionRoot     string
+	publicKey       ed25519.PublicKey
+	requireChecksum bool
+	commands        []*regexp.Regexp
+	// user runs the commands, nil for the user of the mapper
+	user   *credential
+	limits config.Limits
+}
+
+// sandbox is used by the missions, see InitSandbox
+var sandbox = &Sandbox{missionRoot: defaultMissionRoot}
+
+// InitSandbox set the guardrails of the missions
+func InitSandbox(c config.Sandbox) error {
+	s, err := NewSandbox(c)
+	if err != nil {
+		return err
+	}
+	sandbox = s
+	return nil
+}
+
+// NewSandbox create the guardrails of a configuration
+func NewSandbox(c config.Sandbox) (*Sandbox, error) {
+	s := &Sandbox{requireChecksum: c.RequireChecksum, limits: c.Limits}
+	for _, root := range c.WorkingRoots {
+		abs, err := filepath.Abs(root)
+		if err != nil {
+			return nil, fmt.Errorf("invalid working root %s: %v", root, err)
+		}
+		s.roots = append(s.roots, abs)
+	}
+	if err := s.setMissionRoot(c.MissionRoot); err != nil {
+		return nil, err
+	}
+	if c.PublicKey != "" {
+		var err error
+		if s.publicKey, err = loadPublicKey(c.PublicKey); err != nil {
+			return nil, err
+		}
+	}
+	for _, command := range c.Commands {
+		re, err := regexp.Compile("^(?:" + command + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed command %q: %v", command, err)
+		}
+		s.commands = append(s.commands, re)
+	}
+	if c.User != "" {
+		var err error
+		if s.user, err = lookupUser(c.User, c.Password); err != nil {
+			return nil, fmt.Errorf("invalid user %s: %v", c.User, err)
+		}
+	}
+	if c.Limits.CPUTime < 0 || c.Limits.Memory < 0 || c.Limits.OutputSize < 0 {
+		return nil, errors.New("negative limits")
+	}
+	if err := checkPlatform(s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// setMissionRoot set the directory of the working directories of missions, which is a working root or in one
+func (s *Sandbox) setMissionRoot(dir string) error {
+	if dir == "" {
+		s.missionRoot = defaultMissionRoot
+		if len(s.roots) > 0 {
+			s.missionRoot = s.roots[0]
+		}
+		return nil
+	}
+	s.missionRoot = dir
+	if len(s.roots) == 0 {
+		return nil
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return fmt.Errorf("invalid mission root %s: %v", dir, err)
+	}
+	for _, root := range s.roots {
+		if abs == root || inRoot(root, abs) {
+			return nil
+		}
+	}
+	return fmt.Errorf("the mission root %s is not in the working roots", dir)
+}
+
+// workingDirectory get the working directory of a mission
+func (s *Sandbox) workingDirectory(id string) string {
+	return filepath.Join(s.missionRoot, id)
+}
+
+// loadPublicKey load an ed25519 public key from a PEM file
+func loadPublicKey(name string) (ed25519.PublicKey, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data in %s", name)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key %s: %v", name, err)
+	}
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an ed25519 public key", name)
+	}
+	return publicKey, nil
+}
+
+// Check check a mission can run before anything is written, content is the decoded file content
+func (s *Sandbox) Check(c MissionConfig, content []byte) error {
+	if err := s.checkWorkingDirectory(c.WorkingDirectory); err != nil {
+		return err
+	}
+	if c.FileName == "" || c.FileName == "." || c.FileName == ".." || filepath.Base(c.FileName) != c.FileName ||
+		strings.ContainsAny(c.FileName, `/\`) {
+		return fmt.Errorf("invalid file name %q", c.FileName)
+	}
+	if err := s.checkContent(c, content); err != nil {
+		return err
+	}
+	return s.checkCommand(c.Command)
+}
+
+// checkWorkingDirectory check the working directory is in a working root, it can't be a root which would be wiped
+func (s *Sandbox) checkWorkingDirectory(dir string) error {
+	if dir == "" {
+		return errors.New("the working directory is empty")
+	}
+	if len(s.roots) == 0 {
+		return nil
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return fmt.Errorf("invalid working directory %s: %v", dir, err)
+	}
+	for _, root := range s.roots {
+		if inRoot(root, abs) {
+			return nil
+		}
+	}
+	return fmt.Errorf("the working directory %s is not in the working roots", dir)
+}
+
+// inRoot tell whether the absolute path abs is in the directory root, and isn't root itself
+func inRoot(root, abs string) bool {
+	rel, err := filepath.Rel(root, abs)
+	return err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// checkContent verify the checksum and the signature of the file content
+func (s *Sandbox) checkContent(c MissionConfig, content []byte) error {
+	if c.Checksum != "" {
+		sum := sha256.Sum256(content)
+		if !strings.EqualFold(c.Checksum, hex.EncodeToString(sum[:])) {
+			return errors.New("the checksum of the file content doesn't match")
+		}
+	} else if s.requireChecksum {
+		return errors.New("the checksum of the file content is required")
+	}
+	if s.publicKey == nil {
+		return nil
+	}
+	if c.Signature == "" {
+		return errors.New("the signature of the file content is required")
+	}
+	signature, err := base64.StdEncoding.DecodeString(c.Signature)
+	if err != nil {
+		return fmt.Errorf("invalid signature of the file content: %v", err)
+	}
+	if !ed25519.Verify(s.publicKey, content, signature) {
+		return errors.New("the signature of the file content is not valid")
+	}
+	return nil
+}
+
+// checkCommand check the command is allowed
+func (s *Sandbox) checkCommand(command string) error {
+	if len(s.commands) == 0 {
+		return nil
+	}
+	for _, re := range s.commands {
+		if re.MatchString(command) {
+			return nil
+		}
+	}
+	return fmt.Errorf("the command %q is not allowed", command)
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2024 The KubeEdge Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package missions
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// credential is the user and groups which run the commands
+type credential struct {
+	uid    uint32
+	gid    uint32
+	groups []uint32
+}
+
+func lookupUser(name, _ string) (*credential, error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return nil, err
+	}
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+	if err != nil {
+		return nil, err
+	}
+	c := &credential{uid: uint32(uid), gid: uint32(gid)}
+	groups, err := u.GroupIds()
+	if err != nil {
+		return nil, err
+	}
+	for _, group := range groups {
+		id, err := strconv.ParseUint(group, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		c.groups = append(c.groups, uint32(id))
+	}
+	return c, nil
+}
+
+func checkPlatform(*Sandbox) error {
+	return nil
+}
+
+func (s *Sandbox) hasRlimits() bool {
+	return s.limits.CPUTime > 0 || s.limits.Memory > 0
+}
+
+// prepare set the user of the command. With limits, the command is run by sh which stops itself before it's
+// replaced by the command, so that the limits are set by started before the command runs.
+func (s *Sandbox) prepare(cmd *exec.Cmd) error {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	if s.user != nil {
+		cmd.SysProcAttr.Credential = &syscall.Credential{Uid: s.user.uid, Gid: s.user.gid, Groups: s.user.groups}
+	}
+	if !s.hasRlimits() {
+		return nil
+	}
+	// the path of a command which isn't found isn't resolved
+	if !strings.Contains(cmd.Path, "/") {
+		_, err := exec.LookPath(cmd.Path)
+		return err
+	}
+	cmd.Args = append([]string{"sh", "-c", `kill -STOP $$ && exec "$@"`, "sh", cmd.Path}, cmd.Args[1:]...)
+	cmd.Path = "/bin/sh"
+	return nil
+}
+
+// started set the limits of the command once it's stopped, then continue it
+func (s *Sandbox) started(cmd *exec.Cmd) (func(), error) {
+	release := func() {}
+	if !s.hasRlimits() {
+		return release, nil
+	}
+	pid := cmd.Process.Pid
+	var status syscall.WaitStatus
+	if _, err := syscall.Wait4(pid, &status, syscall.WUNTRACED, nil); err != nil {
+		return nil, fmt.Errorf("wait for the command to stop: %v", err)
+	}
+	if !status.Stopped() {
+		return nil, errors.New("the command isn't stopped before its limits are set")
+	}
+	if s.limits.CPUTime > 0 {
+		limit := uint64(s.limits.CPUTime)
+		if err := unix.Prlimit(pid, unix.RLIMIT_CPU, &unix.Rlimit{Cur: limit, Max: limit}, nil); err != nil {
+			return nil, fmt.Errorf("limit the CPU time: %v", err)
+		}
+	}
+	if s.limits.Memory > 0 {
+		limit := uint64(s.limits.Memory) << 20
+		if err := unix.Prlimit(pid, unix.RLIMIT_AS, &unix.Rlimit{Cur: limit, Max: limit}, nil); err != nil {
+			return nil, fmt.Errorf("limit the memory: %v", err)
+		}
+	}
+	if err := syscall.Kill(pid, syscall.SIGCONT); err != nil {
+		return nil, fmt.Errorf("continue the command: %v", err)
+	}
+	return release, nil
+}
+
+// own give a file of a mission to the user which runs the commands
+func (s *Sandbox) own(name string) error {
+	if s.user == nil {
+		return nil
+	}
+	return os.Lchown(name, int(s.user.uid), int(s.user.gid))
+}
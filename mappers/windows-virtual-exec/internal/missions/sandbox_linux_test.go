@@ -0,0 +1,78 @@
+/*
+Copyright 2024 The KubeEdge Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package missions
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kubeedge/mappers-go/mappers/windows-virtual-exec/internal/config"
+)
+
+func TestSandboxLimits(t *testing.T) {
+	useSandbox(t, config.Sandbox{Limits: config.Limits{CPUTime: 3, Memory: 512}})
+	cmd, err := NewCommand(ShellSh, "ulimit -t; ulimit -v", t.TempDir())
+	require.NoError(t, err)
+	require.NoError(t, cmd.Exec(context.Background()))
+	assert.Equal(t, "3\n524288\n", string(cmd.StdOut))
+}
+
+func TestSandboxCPUTime(t *testing.T) {
+	useSandbox(t, config.Sandbox{Limits: config.Limits{CPUTime: 1}})
+	cmd, err := NewCommand(ShellSh, "while :; do :; done", t.TempDir())
+	require.NoError(t, err)
+	start := time.Now()
+	assert.Error(t, cmd.Exec(context.Background()))
+	assert.Less(t, time.Since(start), 30*time.Second)
+	assert.NotEqual(t, 0, cmd.ExitCode)
+}
+
+func TestSandboxOutputSize(t *testing.T) {
+	useSandbox(t, config.Sandbox{Limits: config.Limits{OutputSize: 1024}})
+	cmd, err := NewCommand(ShellSh, "while :; do echo hello; done", t.TempDir())
+	require.NoError(t, err)
+	err = cmd.Exec(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "the output exceeds 1024 bytes")
+
+	cmd, err = NewCommand(ShellSh, "echo hello", t.TempDir())
+	require.NoError(t, err)
+	require.NoError(t, cmd.Exec(context.Background()))
+	assert.Equal(t, "hello\n", string(cmd.StdOut))
+}
+
+func TestSandboxUser(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("switching the user needs root")
+	}
+	setup(t)
+	root := t.TempDir()
+	// the user needs to reach the working directory
+	require.NoError(t, os.Chmod(filepath.Dir(root), 0755))
+	require.NoError(t, os.Chmod(root, 0755))
+	useSandbox(t, config.Sandbox{WorkingRoots: []string{root}, User: "nobody"})
+
+	m := newMission(t, "mission-nobody", "sh run.sh", "id -un; touch created\n")
+	m.Config.WorkingDirectory = filepath.Join(root, "mission-nobody")
+	m.Run()
+	assert.Equal(t, StatusOK, m.Status, m.Output)
+	assert.Equal(t, "nobody", strings.TrimSpace(m.Output))
+}
@@ -0,0 +1,48 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+/*
+Copyright 2024 The KubeEdge Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package missions
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+)
+
+type credential struct{}
+
+func lookupUser(string, string) (*credential, error) {
+	return nil, fmt.Errorf("running commands as another user is not supported on %s", runtime.GOOS)
+}
+
+func checkPlatform(s *Sandbox) error {
+	if s.limits.CPUTime > 0 || s.limits.Memory > 0 {
+		return fmt.Errorf("CPU time and memory limits are not supported on %s", runtime.GOOS)
+	}
+	return nil
+}
+
+func (s *Sandbox) prepare(*exec.Cmd) error {
+	return nil
+}
+
+func (s *Sandbox) started(*exec.Cmd) (func(), error) {
+	return func() {}, nil
+}
+
+func (s *Sandbox) own(string) error {
+	return nil
+}
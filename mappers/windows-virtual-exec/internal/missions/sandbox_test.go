@@ -0,0 +1,212 @@
+/*
+Copyright 2024 The KubeEdge Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package missions
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kubeedge/mappers-go/mappers/windows-virtual-exec/internal/config"
+)
+
+// useSandbox use the sandbox of c in a test
+func useSandbox(t *testing.T, c config.Sandbox) *Sandbox {
+	s, err := NewSandbox(c)
+	require.NoError(t, err)
+	old := sandbox
+	sandbox = s
+	t.Cleanup(func() {
+		sandbox = old
+	})
+	return s
+}
+
+// writePublicKey write a new ed25519 public key to a PEM file
+func writePublicKey(t *testing.T) (string, ed25519.PrivateKey) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	require.NoError(t, err)
+	name := filepath.Join(t.TempDir(), "key.pem")
+	require.NoError(t, os.WriteFile(name, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600))
+	return name, privateKey
+}
+
+func TestSandboxWorkingDirectory(t *testing.T) {
+	root := t.TempDir()
+	s, err := NewSandbox(config.Sandbox{WorkingRoots: []string{root}})
+	require.NoError(t, err)
+
+	for dir, ok := range map[string]bool{
+		"":                                   false,
+		root:                                 false,
+		filepath.Join(root, "mission"):       true,
+		filepath.Join(root, "a", "b"):        true,
+		filepath.Join(root, "..", "other"):   false,
+		filepath.Join(root, "..a"):           true,
+		filepath.Dir(root):                   false,
+		root + "-other":                      false,
+		filepath.Join(root, "a", "..", ".."): false,
+	} {
+		err := s.Check(MissionConfig{WorkingDirectory: dir, FileName: "run.sh"}, nil)
+		if ok {
+			assert.NoError(t, err, dir)
+		} else {
+			assert.Error(t, err, dir)
+		}
+	}
+
+	// any working directory is allowed without roots
+	s, err = NewSandbox(config.Sandbox{})
+	require.NoError(t, err)
+	assert.NoError(t, s.Check(MissionConfig{WorkingDirectory: root, FileName: "run.sh"}, nil))
+}
+
+func TestSandboxFileName(t *testing.T) {
+	s, err := NewSandbox(config.Sandbox{})
+	require.NoError(t, err)
+	dir := t.TempDir()
+	for name, ok := range map[string]bool{
+		"run.sh":        true,
+		"":              false,
+		".":             false,
+		"..":            false,
+		"../run.sh":     false,
+		"a/run.sh":      false,
+		`a\run.sh`:      false,
+		"/etc/passwd":   false,
+		"run.sh.backup": true,
+	} {
+		err := s.Check(MissionConfig{WorkingDirectory: dir, FileName: name}, nil)
+		if ok {
+			assert.NoError(t, err, name)
+		} else {
+			assert.Error(t, err, name)
+		}
+	}
+}
+
+func TestSandboxChecksum(t *testing.T) {
+	content := []byte("echo hello\n")
+	sum := sha256.Sum256(content)
+	checksum := hex.EncodeToString(sum[:])
+	c := MissionConfig{WorkingDirectory: t.TempDir(), FileName: "run.sh"}
+
+	s, err := NewSandbox(config.Sandbox{})
+	require.NoError(t, err)
+	assert.NoError(t, s.Check(c, content))
+	c.Checksum = checksum
+	assert.NoError(t, s.Check(c, content))
+	assert.Error(t, s.Check(c, []byte("echo bye\n")))
+
+	s, err = NewSandbox(config.Sandbox{RequireChecksum: true})
+	require.NoError(t, err)
+	assert.NoError(t, s.Check(c, content))
+	c.Checksum = ""
+	assert.EqualError(t, s.Check(c, content), "the checksum of the file content is required")
+}
+
+func TestSandboxSignature(t *testing.T) {
+	name, privateKey := writePublicKey(t)
+	s, err := NewSandbox(config.Sandbox{PublicKey: name})
+	require.NoError(t, err)
+
+	content := []byte("echo hello\n")
+	c := MissionConfig{WorkingDirectory: t.TempDir(), FileName: "run.sh"}
+	assert.EqualError(t, s.Check(c, content), "the signature of the file content is required")
+	c.Signature = "not base64"
+	assert.Error(t, s.Check(c, content))
+	c.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, content))
+	assert.NoError(t, s.Check(c, content))
+	assert.EqualError(t, s.Check(c, []byte("echo bye\n")), "the signature of the file content is not valid")
+
+	// a key which isn't ed25519 is rejected
+	_, err = NewSandbox(config.Sandbox{PublicKey: filepath.Join(t.TempDir(), "missing.pem")})
+	assert.Error(t, err)
+	bad := filepath.Join(t.TempDir(), "bad.pem")
+	require.NoError(t, os.WriteFile(bad, []byte("not a key"), 0600))
+	_, err = NewSandbox(config.Sandbox{PublicKey: bad})
+	assert.Error(t, err)
+}
+
+func TestSandboxCommands(t *testing.T) {
+	s, err := NewSandbox(config.Sandbox{Commands: []string{`sh run\.sh`, `sh run\.sh [a-z]+`}})
+	require.NoError(t, err)
+	c := MissionConfig{WorkingDirectory: t.TempDir(), FileName: "run.sh"}
+	for command, ok := range map[string]bool{
+		"sh run.sh":           true,
+		"sh run.sh world":     true,
+		"sh run.sh; rm -rf /": false,
+		"sh run.sh world; ls": false,
+		"echo sh run.sh":      false,
+		"sh run.sh World":     false,
+	} {
+		c.Command = command
+		err := s.Check(c, nil)
+		if ok {
+			assert.NoError(t, err, command)
+		} else {
+			assert.Error(t, err, command)
+		}
+	}
+
+	_, err = NewSandbox(config.Sandbox{Commands: []string{"("}})
+	assert.Error(t, err)
+	_, err = NewSandbox(config.Sandbox{Limits: config.Limits{OutputSize: -1}})
+	assert.Error(t, err)
+}
+
+func TestSandboxRejectMission(t *testing.T) {
+	client := setup(t)
+	root := t.TempDir()
+	useSandbox(t, config.Sandbox{WorkingRoots: []string{root}, RequireChecksum: true})
+
+	// the working directory isn't in the roots, nothing is written
+	m := newMission(t, "mission-rejected", "sh run.sh", "echo hello\n")
+	m.Run()
+	assert.Equal(t, StatusError, m.Status)
+	assert.Contains(t, m.Output, "is not in the working roots")
+	_, err := os.Stat(m.Config.WorkingDirectory)
+	assert.True(t, os.IsNotExist(err))
+	twins := client.twins(t, m.Config.UniqueName)
+	require.NotEmpty(t, twins)
+	assert.Equal(t, StatusError, twins[len(twins)-1]["status"])
+
+	m = newMission(t, "mission-checked", "sh run.sh", "echo hello\n")
+	m.Config.WorkingDirectory = filepath.Join(root, "mission-checked")
+	m.Run()
+	assert.Equal(t, StatusError, m.Status)
+	assert.Equal(t, "the checksum of the file content is required", m.Output)
+
+	sum := sha256.Sum256([]byte("echo hello\n"))
+	m = newMission(t, "mission-checksum", "sh run.sh", "echo hello\n")
+	m.Config.WorkingDirectory = filepath.Join(root, "mission-checksum")
+	m.Config.Checksum = hex.EncodeToString(sum[:])
+	m.UpdateDB()
+	m.Run()
+	assert.Equal(t, StatusOK, m.Status)
+	assert.Equal(t, "hello\n", m.Output)
+	assert.Equal(t, m.Config.Checksum, load(t, m.Config.UniqueName).Checksum)
+}
@@ -0,0 +1,217 @@
+/*
+Copyright 2024 The KubeEdge Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package missions
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+const (
+	logon32LogonInteractive = 2
+	logon32ProviderDefault  = 0
+)
+
+var procLogonUserW = windows.NewLazySystemDLL("advapi32.dll").NewProc("LogonUserW")
+
+// credential is the token and the SID of the user which runs the commands
+type credential struct {
+	token syscall.Token
+	sid   *windows.SID
+}
+
+// lookupUser log on a user, name is user or domain\user
+func lookupUser(name, password string) (*credential, error) {
+	domain := "."
+	if i := strings.Index(name, `\`); i >= 0 {
+		domain, name = name[:i], name[i+1:]
+	}
+	user16, err := windows.UTF16PtrFromString(name)
+	if err != nil {
+		return nil, err
+	}
+	domain16, err := windows.UTF16PtrFromString(domain)
+	if err != nil {
+		return nil, err
+	}
+	password16, err := windows.UTF16PtrFromString(password)
+	if err != nil {
+		return nil, err
+	}
+	var token windows.Token
+	r, _, err := procLogonUserW.Call(uintptr(unsafe.Pointer(user16)), uintptr(unsafe.Pointer(domain16)),
+		uintptr(unsafe.Pointer(password16)), logon32LogonInteractive, logon32ProviderDefault, uintptr(unsafe.Pointer(&token)))
+	if r == 0 {
+		return nil, fmt.Errorf("log on: %v", err)
+	}
+	tokenUser, err := token.GetTokenUser()
+	if err != nil {
+		token.Close()
+		return nil, fmt.Errorf("get the SID: %v", err)
+	}
+	sid, err := tokenUser.User.Sid.Copy()
+	if err != nil {
+		token.Close()
+		return nil, fmt.Errorf("copy the SID: %v", err)
+	}
+	return &credential{token: syscall.Token(token), sid: sid}, nil
+}
+
+func checkPlatform(*Sandbox) error {
+	return nil
+}
+
+// hasJobLimits tell whether the commands are limited by a job object
+func (s *Sandbox) hasJobLimits() bool {
+	return s.limits.CPUTime > 0 || s.limits.Memory > 0
+}
+
+// prepare set the user of the command. A limited command starts suspended, it runs once it's in its job object.
+func (s *Sandbox) prepare(cmd *exec.Cmd) error {
+	if s.user == nil && !s.hasJobLimits() {
+		return nil
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	if s.user != nil {
+		cmd.SysProcAttr.Token = s.user.token
+	}
+	if s.hasJobLimits() {
+		cmd.SysProcAttr.CreationFlags |= windows.CREATE_SUSPENDED
+	}
+	return nil
+}
+
+// started assign the suspended command to a job object which enforces the limits and resume it, the processes
+// of the job are killed once the job is released
+func (s *Sandbox) started(cmd *exec.Cmd) (func(), error) {
+	release := func() {}
+	if !s.hasJobLimits() {
+		return release, nil
+	}
+	job, err := windows.CreateJobObject(nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create job object: %v", err)
+	}
+	var info windows.JOBOBJECT_EXTENDED_LIMIT_INFORMATION
+	info.BasicLimitInformation.LimitFlags = windows.JOB_OBJECT_LIMIT_KILL_ON_JOB_CLOSE
+	if s.limits.CPUTime > 0 {
+		info.BasicLimitInformation.LimitFlags |= windows.JOB_OBJECT_LIMIT_JOB_TIME
+		// in 100 nanoseconds
+		info.BasicLimitInformation.PerJobUserTimeLimit = int64(s.limits.CPUTime) * 10000000
+	}
+	if s.limits.Memory > 0 {
+		info.BasicLimitInformation.LimitFlags |= windows.JOB_OBJECT_LIMIT_JOB_MEMORY
+		info.JobMemoryLimit = uintptr(s.limits.Memory) << 20
+	}
+	if _, err = windows.SetInformationJobObject(job, windows.JobObjectExtendedLimitInformation,
+		uintptr(unsafe.Pointer(&info)), uint32(unsafe.Sizeof(info))); err != nil {
+		windows.CloseHandle(job)
+		return nil, fmt.Errorf("set the limits of the job object: %v", err)
+	}
+	process, err := windows.OpenProcess(windows.PROCESS_SET_QUOTA|windows.PROCESS_TERMINATE, false, uint32(cmd.Process.Pid))
+	if err != nil {
+		windows.CloseHandle(job)
+		return nil, fmt.Errorf("open the process: %v", err)
+	}
+	defer windows.CloseHandle(process)
+	if err = windows.AssignProcessToJobObject(job, process); err != nil {
+		windows.CloseHandle(job)
+		return nil, fmt.Errorf("assign the process to the job object: %v", err)
+	}
+	if err = resumeProcess(uint32(cmd.Process.Pid)); err != nil {
+		windows.CloseHandle(job)
+		return nil, fmt.Errorf("resume the process: %v", err)
+	}
+	return func() {
+		windows.CloseHandle(job)
+	}, nil
+}
+
+// resumeProcess resume the threads of a process started suspended
+func resumeProcess(pid uint32) error {
+	snapshot, err := windows.CreateToolhelp32Snapshot(windows.TH32CS_SNAPTHREAD, 0)
+	if err != nil {
+		return err
+	}
+	defer windows.CloseHandle(snapshot)
+	entry := windows.ThreadEntry32{Size: uint32(unsafe.Sizeof(windows.ThreadEntry32{}))}
+	for err = windows.Thread32First(snapshot, &entry); err == nil; err = windows.Thread32Next(snapshot, &entry) {
+		if entry.OwnerProcessID != pid {
+			continue
+		}
+		thread, openErr := windows.OpenThread(windows.THREAD_SUSPEND_RESUME, false, entry.ThreadID)
+		if openErr != nil {
+			return openErr
+		}
+		_, resumeErr := windows.ResumeThread(thread)
+		windows.CloseHandle(thread)
+		if resumeErr != nil {
+			return resumeErr
+		}
+	}
+	if err != windows.ERROR_NO_MORE_FILES {
+		return err
+	}
+	return nil
+}
+
+// own grant the user which runs the commands full control of a file of a mission, the files created in a
+// directory inherit it
+func (s *Sandbox) own(name string) error {
+	if s.user == nil {
+		return nil
+	}
+	info, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+	inheritance := uint32(windows.NO_INHERITANCE)
+	if info.IsDir() {
+		inheritance = windows.SUB_CONTAINERS_AND_OBJECTS_INHERIT
+	}
+	sd, err := windows.GetNamedSecurityInfo(name, windows.SE_FILE_OBJECT, windows.DACL_SECURITY_INFORMATION)
+	if err != nil {
+		return fmt.Errorf("get the ACL of %s: %v", name, err)
+	}
+	dacl, _, err := sd.DACL()
+	if err != nil {
+		return fmt.Errorf("get the ACL of %s: %v", name, err)
+	}
+	acl, err := windows.ACLFromEntries([]windows.EXPLICIT_ACCESS{{
+		AccessPermissions: windows.GENERIC_ALL,
+		AccessMode:        windows.GRANT_ACCESS,
+		Inheritance:       inheritance,
+		Trustee: windows.TRUSTEE{
+			TrusteeForm:  windows.TRUSTEE_IS_SID,
+			TrusteeType:  windows.TRUSTEE_IS_USER,
+			TrusteeValue: windows.TrusteeValueFromSID(s.user.sid),
+		},
+	}}, dacl)
+	if err != nil {
+		return fmt.Errorf("grant access to %s: %v", name, err)
+	}
+	if err = windows.SetNamedSecurityInfo(name, windows.SE_FILE_OBJECT, windows.DACL_SECURITY_INFORMATION,
+		nil, nil, acl, nil); err != nil {
+		return fmt.Errorf("set the ACL of %s: %v", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2024 The KubeEdge Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cron
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNext(t *testing.T) {
+	// a wednesday
+	now := time.Date(2024, 5, 15, 10, 20, 30, 0, time.UTC)
+	for _, c := range []struct {
+		spec string
+		next time.Time
+	}{
+		{"* * * * *", time.Date(2024, 5, 15, 10, 21, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 5, 15, 10, 30, 0, 0, time.UTC)},
+		{"5/20 * * * *", time.Date(2024, 5, 15, 10, 25, 0, 0, time.UTC)},
+		{"0 8-18/2 * * 1-5", time.Date(2024, 5, 15, 12, 0, 0, 0, time.UTC)},
+		{"30 2 * * *", time.Date(2024, 5, 16, 2, 30, 0, 0, time.UTC)},
+		{"0 0 * * 0", time.Date(2024, 5, 19, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2024, 5, 19, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1,15 * 6", time.Date(2024, 5, 18, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2024, 5, 15, 11, 0, 0, 0, time.UTC)},
+		{"@every 90s", time.Date(2024, 5, 15, 10, 22, 0, 0, time.UTC)},
+		{"0 0 31 2 *", time.Time{}},
+	} {
+		s, err := Parse(c.spec)
+		require.NoError(t, err, c.spec)
+		assert.Equal(t, c.next, s.Next(now), c.spec)
+	}
+}
+
+func TestParseError(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"@every 10ms",
+		"@every often",
+		"@sometimes",
+	} {
+		_, err := Parse(spec)
+		assert.Error(t, err, spec)
+	}
+}